@@ -2,17 +2,14 @@ package main
 
 import (
 	"database/sql"
-	"embed"
 	"os"
 
+	"github.com/jawee/scimtiplexer/cmd/goose/migrations"
 	_ "github.com/joho/godotenv/autoload"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/pressly/goose/v3"
 )
 
-//go:embed migrations/*.sql
-var embedMigrations embed.FS
-
 func main() {
 	// setup database
 	dburl := os.Getenv("DB_URL")
@@ -25,16 +22,20 @@ func main() {
 		panic(err)
 	}
 
-	goose.SetBaseFS(embedMigrations)
-
-	if err := goose.SetDialect("sqlite3"); err != nil {
+	if err := migrations.Setup(); err != nil {
 		panic(err)
 	}
 
-	if err := goose.Up(db, "migrations"); err != nil {
+	// Go migrations are registered by the migrations package, so the goose
+	// cli cannot run them. Commands are passed through to goose from here.
+	command := "up"
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+
+	if err := goose.Run(command, db, ".", os.Args[min(len(os.Args), 2):]...); err != nil {
 		panic(err)
 	}
 
 	// run app
 }
-
@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE organisations ADD COLUMN slug TEXT NOT NULL DEFAULT '';
+
+UPDATE organisations SET slug = lower(replace(name, ' ', '-')) WHERE slug = '';
+
+-- Names that only differ in case or spaces and dashes give the same slug.
+-- The oldest organisation keeps it, the others get their id appended.
+UPDATE organisations SET slug = slug || '-' || id
+WHERE EXISTS (
+    SELECT 1 FROM organisations older
+    WHERE older.slug = organisations.slug
+    AND (older.created_on_utc < organisations.created_on_utc
+        OR (older.created_on_utc = organisations.created_on_utc AND older.id < organisations.id))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_organisations_slug ON organisations (slug);
+
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_organisations_slug;
+ALTER TABLE organisations DROP COLUMN slug;
@@ -0,0 +1,48 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Tokens are stored as a display prefix and a SHA-256 hash. Existing raw tokens
+-- are copied into token_hash here and hashed by the following Go migration.
+CREATE TABLE organisation_tokens_new (
+    id TEXT PRIMARY KEY,
+    organisation_id TEXT NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+    label TEXT,
+    token_prefix TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_by TEXT NOT NULL REFERENCES users(id),
+    created_on_utc DATETIME NOT NULL,
+    modified_on_utc DATETIME NOT NULL,
+    modified_by TEXT REFERENCES users(id)
+);
+
+INSERT INTO organisation_tokens_new (id, organisation_id, token_prefix, token_hash, created_by, created_on_utc, modified_on_utc, modified_by)
+SELECT id, organisation_id, '', token, created_by, created_on_utc, modified_on_utc, modified_by FROM organisation_tokens;
+
+DROP TABLE organisation_tokens;
+ALTER TABLE organisation_tokens_new RENAME TO organisation_tokens;
+
+CREATE INDEX IF NOT EXISTS idx_organisation_tokens_organisation_id ON organisation_tokens (organisation_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+CREATE TABLE organisation_tokens_old (
+    id TEXT PRIMARY KEY,
+    organisation_id TEXT NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+    token TEXT NOT NULL UNIQUE,
+    created_by TEXT NOT NULL REFERENCES users(id),
+    created_on_utc DATETIME NOT NULL,
+    modified_on_utc DATETIME NOT NULL,
+    modified_by TEXT REFERENCES users(id)
+);
+
+-- Hashed tokens cannot be recovered, the old table receives the hashes.
+INSERT INTO organisation_tokens_old (id, organisation_id, token, created_by, created_on_utc, modified_on_utc, modified_by)
+SELECT id, organisation_id, token_hash, created_by, created_on_utc, modified_on_utc, modified_by FROM organisation_tokens;
+
+DROP TABLE organisation_tokens;
+ALTER TABLE organisation_tokens_old RENAME TO organisation_tokens;
+
+-- +goose StatementEnd
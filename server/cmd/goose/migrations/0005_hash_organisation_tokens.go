@@ -0,0 +1,51 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jawee/scimtiplexer/internal/token"
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(upHashOrganisationTokens, downHashOrganisationTokens)
+}
+
+// upHashOrganisationTokens replaces the raw tokens copied by the previous
+// migration with their hash. Rows that already have a prefix were created
+// hashed and are left alone.
+func upHashOrganisationTokens(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, "SELECT id, token_hash FROM organisation_tokens WHERE token_prefix = ''")
+	if err != nil {
+		return err
+	}
+
+	raw := make(map[string]string)
+	for rows.Next() {
+		var id, value string
+		if err := rows.Scan(&id, &value); err != nil {
+			rows.Close()
+			return err
+		}
+		raw[id] = value
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	for id, value := range raw {
+		_, err := tx.ExecContext(ctx, "UPDATE organisation_tokens SET token_prefix = ?, token_hash = ? WHERE id = ?",
+			token.Prefix(value), token.Hash(value), id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// downHashOrganisationTokens is a no-op, a hash cannot be turned back into the token.
+func downHashOrganisationTokens(ctx context.Context, tx *sql.Tx) error {
+	return nil
+}
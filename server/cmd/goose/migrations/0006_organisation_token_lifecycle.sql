@@ -0,0 +1,14 @@
+-- +goose Up
+ALTER TABLE organisation_tokens ADD COLUMN scopes TEXT NOT NULL DEFAULT 'users:read users:write groups:read groups:write bulk';
+ALTER TABLE organisation_tokens ADD COLUMN expires_on_utc DATETIME;
+ALTER TABLE organisation_tokens ADD COLUMN revoked_on_utc DATETIME;
+ALTER TABLE organisation_tokens ADD COLUMN last_used_on_utc DATETIME;
+ALTER TABLE organisation_tokens ADD COLUMN last_used_ip TEXT;
+
+
+-- +goose Down
+ALTER TABLE organisation_tokens DROP COLUMN last_used_ip;
+ALTER TABLE organisation_tokens DROP COLUMN last_used_on_utc;
+ALTER TABLE organisation_tokens DROP COLUMN revoked_on_utc;
+ALTER TABLE organisation_tokens DROP COLUMN expires_on_utc;
+ALTER TABLE organisation_tokens DROP COLUMN scopes;
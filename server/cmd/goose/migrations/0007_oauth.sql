@@ -0,0 +1,30 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    id TEXT PRIMARY KEY,
+    organisation_id TEXT NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+    client_id TEXT NOT NULL UNIQUE,
+    secret_hash TEXT NOT NULL,
+    label TEXT,
+    scopes TEXT NOT NULL,
+    revoked_on_utc DATETIME,
+    created_by TEXT NOT NULL REFERENCES users(id),
+    created_on_utc DATETIME NOT NULL,
+    modified_on_utc DATETIME NOT NULL,
+    modified_by TEXT REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_oauth_clients_organisation_id ON oauth_clients (organisation_id);
+
+
+-- The id is used as the kid of the JWTs signed with the key.
+CREATE TABLE IF NOT EXISTS oauth_signing_keys (
+    id TEXT PRIMARY KEY,
+    algorithm TEXT NOT NULL,
+    private_key TEXT NOT NULL,
+    created_on_utc DATETIME NOT NULL
+);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS oauth_signing_keys;
+DROP TABLE IF EXISTS oauth_clients;
@@ -0,0 +1,25 @@
+-- +goose Up
+-- An external JWT issuer trusted by an organisation. Tokens are mapped to the
+-- organisation when organisation_claim has the value organisation_claim_value.
+CREATE TABLE IF NOT EXISTS trusted_issuers (
+    id TEXT PRIMARY KEY,
+    organisation_id TEXT NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+    issuer TEXT NOT NULL,
+    audience TEXT NOT NULL,
+    jwks_uri TEXT,
+    jwks TEXT,
+    organisation_claim TEXT NOT NULL,
+    organisation_claim_value TEXT NOT NULL,
+    scopes TEXT NOT NULL,
+    created_by TEXT NOT NULL REFERENCES users(id),
+    created_on_utc DATETIME NOT NULL,
+    modified_on_utc DATETIME NOT NULL,
+    modified_by TEXT REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_trusted_issuers_organisation_id ON trusted_issuers (organisation_id);
+CREATE INDEX IF NOT EXISTS idx_trusted_issuers_issuer ON trusted_issuers (issuer);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS trusted_issuers;
@@ -0,0 +1,25 @@
+-- +goose Up
+-- A client certificate mapping authenticates SCIM clients with mutual TLS.
+-- A certificate that chains to ca_bundle and has match_value as its subject
+-- (match_type 'subject') or as a DNS, URI or email SAN is mapped to the
+-- organisation.
+CREATE TABLE IF NOT EXISTS client_certificate_mappings (
+    id TEXT PRIMARY KEY,
+    organisation_id TEXT NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+    label TEXT,
+    ca_bundle TEXT NOT NULL,
+    match_type TEXT NOT NULL,
+    match_value TEXT NOT NULL,
+    scopes TEXT NOT NULL,
+    created_by TEXT NOT NULL REFERENCES users(id),
+    created_on_utc DATETIME NOT NULL,
+    modified_on_utc DATETIME NOT NULL,
+    modified_by TEXT REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_client_certificate_mappings_organisation_id ON client_certificate_mappings (organisation_id);
+CREATE INDEX IF NOT EXISTS idx_client_certificate_mappings_match_value ON client_certificate_mappings (match_value);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS client_certificate_mappings;
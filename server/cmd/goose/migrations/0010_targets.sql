@@ -0,0 +1,22 @@
+-- +goose Up
+-- A downstream system that accepted SCIM changes of the organisation are
+-- forwarded to. config holds the connector specific settings as JSON.
+CREATE TABLE IF NOT EXISTS targets (
+    id TEXT PRIMARY KEY,
+    organisation_id TEXT NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    type TEXT NOT NULL,
+    config TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT 1,
+    created_by TEXT NOT NULL REFERENCES users(id),
+    created_on_utc DATETIME NOT NULL,
+    modified_on_utc DATETIME NOT NULL,
+    modified_by TEXT REFERENCES users(id),
+    UNIQUE (organisation_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_targets_organisation_id ON targets (organisation_id);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS targets;
@@ -0,0 +1,26 @@
+-- +goose Up
+-- An event waiting to be delivered to one target. Events are written in the
+-- same transaction as the change they describe, and are delivered in id order
+-- per target and resource. status is 'pending', 'delivered' or 'dead'.
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    organisation_id TEXT NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+    target_id TEXT NOT NULL REFERENCES targets(id) ON DELETE CASCADE,
+    resource_type TEXT NOT NULL,
+    resource_id TEXT NOT NULL,
+    operation TEXT NOT NULL,
+    payload TEXT,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_on_utc DATETIME NOT NULL,
+    last_error TEXT,
+    created_on_utc DATETIME NOT NULL,
+    delivered_on_utc DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_status_next_attempt ON outbox_events (status, next_attempt_on_utc);
+CREATE INDEX IF NOT EXISTS idx_outbox_events_resource ON outbox_events (target_id, resource_type, resource_id, status);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS outbox_events;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- The id a resource has in a target, and the version the target last
+-- reported for it.
+CREATE TABLE IF NOT EXISTS target_resource_mappings (
+    target_id TEXT NOT NULL REFERENCES targets(id) ON DELETE CASCADE,
+    resource_type TEXT NOT NULL,
+    local_id TEXT NOT NULL,
+    remote_id TEXT NOT NULL,
+    remote_version TEXT,
+    created_on_utc DATETIME NOT NULL,
+    modified_on_utc DATETIME NOT NULL,
+    PRIMARY KEY (target_id, resource_type, local_id)
+);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS target_resource_mappings;
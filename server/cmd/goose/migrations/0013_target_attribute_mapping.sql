@@ -0,0 +1,8 @@
+-- +goose Up
+-- The rules that reshape resources before they are sent to the target, as
+-- JSON. Resources are sent unchanged when it's null.
+ALTER TABLE targets ADD COLUMN attribute_mapping TEXT;
+
+
+-- +goose Down
+ALTER TABLE targets DROP COLUMN attribute_mapping;
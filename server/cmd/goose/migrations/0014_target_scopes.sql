@@ -0,0 +1,35 @@
+-- +goose Up
+-- Scopes are SCIM filters selecting the users and groups sent to a target,
+-- all of them are sent when a scope is null. deprovision_action is what
+-- happens to resources that leave the scope, disable or delete.
+ALTER TABLE targets ADD COLUMN user_scope TEXT;
+ALTER TABLE targets ADD COLUMN group_scope TEXT;
+ALTER TABLE targets ADD COLUMN deprovision_action TEXT NOT NULL DEFAULT 'disable';
+
+-- The resources in the scope of a target, as of the last event queued for
+-- them, so moving in and out of the scope can be told apart from changes.
+CREATE TABLE IF NOT EXISTS target_scoped_resources (
+    target_id TEXT NOT NULL REFERENCES targets(id) ON DELETE CASCADE,
+    resource_type TEXT NOT NULL,
+    resource_id TEXT NOT NULL,
+    created_on_utc DATETIME NOT NULL,
+    PRIMARY KEY (target_id, resource_type, resource_id)
+);
+
+-- Until now every resource was sent to every target.
+INSERT INTO target_scoped_resources (target_id, resource_type, resource_id, created_on_utc)
+SELECT t.id, 'User', u.id, CURRENT_TIMESTAMP
+FROM targets t
+JOIN scim_users u ON u.organisation_id = t.organisation_id;
+
+INSERT INTO target_scoped_resources (target_id, resource_type, resource_id, created_on_utc)
+SELECT t.id, 'Group', g.id, CURRENT_TIMESTAMP
+FROM targets t
+JOIN scim_groups g ON g.organisation_id = t.organisation_id;
+
+
+-- +goose Down
+DROP TABLE IF EXISTS target_scoped_resources;
+ALTER TABLE targets DROP COLUMN deprovision_action;
+ALTER TABLE targets DROP COLUMN group_scope;
+ALTER TABLE targets DROP COLUMN user_scope;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- Security event tokens of set targets that deliver by polling, kept until
+-- the receiver acknowledges them.
+CREATE TABLE IF NOT EXISTS security_events (
+    jti TEXT PRIMARY KEY,
+    target_id TEXT NOT NULL REFERENCES targets(id) ON DELETE CASCADE,
+    token TEXT NOT NULL,
+    created_on_utc DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_security_events_target_id ON security_events (target_id, created_on_utc);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS security_events;
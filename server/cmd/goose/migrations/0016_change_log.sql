@@ -0,0 +1,18 @@
+-- +goose Up
+-- Every change to a user or group, written in the transaction of the change.
+-- The id is the cursor of the change feed and only ever increases.
+CREATE TABLE IF NOT EXISTS change_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    organisation_id TEXT NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+    resource_type TEXT NOT NULL,
+    resource_id TEXT NOT NULL,
+    operation TEXT NOT NULL,
+    resource TEXT,
+    created_on_utc DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_change_log_organisation_id ON change_log (organisation_id, id);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS change_log;
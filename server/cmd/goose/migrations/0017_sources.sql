@@ -0,0 +1,34 @@
+-- +goose Up
+-- The source an organisation token writes as, such as hr or entra. Requests
+-- with tokens without a source write as no source.
+ALTER TABLE organisation_tokens ADD COLUMN source TEXT;
+
+-- Which sources may write a user attribute, highest precedence first and
+-- space separated. on_conflict is what happens when a source writes an
+-- attribute it may not, or one last written by a source with precedence over
+-- it: keep the current value, overwrite it anyway or reject the request.
+CREATE TABLE IF NOT EXISTS attribute_policies (
+    organisation_id TEXT NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+    attribute TEXT NOT NULL,
+    sources TEXT NOT NULL,
+    on_conflict TEXT NOT NULL DEFAULT 'keep',
+    created_on_utc DATETIME NOT NULL,
+    modified_on_utc DATETIME NOT NULL,
+    modified_by TEXT,
+    PRIMARY KEY (organisation_id, attribute)
+);
+
+-- The source that last changed each attribute of a user, and when.
+CREATE TABLE IF NOT EXISTS scim_user_attribute_sources (
+    user_id TEXT NOT NULL REFERENCES scim_users(id) ON DELETE CASCADE,
+    attribute TEXT NOT NULL,
+    source TEXT,
+    modified_on_utc DATETIME NOT NULL,
+    PRIMARY KEY (user_id, attribute)
+);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS scim_user_attribute_sources;
+DROP TABLE IF EXISTS attribute_policies;
+ALTER TABLE organisation_tokens DROP COLUMN source;
@@ -0,0 +1,59 @@
+-- +goose Up
+-- The identities sources know users by. A source addresses a user by the id
+-- of its identity, the identity that created a user has the id of the user.
+-- Identities that were correlated to an existing user record the rule that
+-- linked them and its confidence. resource is the user as last written by
+-- the source, so an identity can be split off again.
+CREATE TABLE IF NOT EXISTS scim_user_identities (
+    id TEXT PRIMARY KEY,
+    organisation_id TEXT NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES scim_users(id) ON DELETE CASCADE,
+    source TEXT,
+    resource TEXT,
+    rules TEXT,
+    confidence INTEGER,
+    created_on_utc DATETIME NOT NULL,
+    modified_on_utc DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_scim_user_identities_user_id ON scim_user_identities (user_id);
+
+INSERT INTO scim_user_identities (id, organisation_id, user_id, created_on_utc, modified_on_utc)
+SELECT id, organisation_id, id, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+FROM scim_users;
+
+-- Rules matching new users to existing ones. match is externalId,
+-- employeeNumber, primaryEmail or nameAndBirthDate, which compares the
+-- normalised name and the birth date at birth_date_attribute.
+CREATE TABLE IF NOT EXISTS correlation_rules (
+    id TEXT PRIMARY KEY,
+    organisation_id TEXT NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+    match TEXT NOT NULL,
+    birth_date_attribute TEXT,
+    confidence INTEGER NOT NULL,
+    created_by TEXT NOT NULL,
+    created_on_utc DATETIME NOT NULL
+);
+
+-- Matches not confident enough to link on their own. status is pending,
+-- linked or dismissed.
+CREATE TABLE IF NOT EXISTS correlation_reviews (
+    id TEXT PRIMARY KEY,
+    organisation_id TEXT NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+    identity_id TEXT NOT NULL REFERENCES scim_user_identities(id) ON DELETE CASCADE,
+    candidate_user_id TEXT NOT NULL REFERENCES scim_users(id) ON DELETE CASCADE,
+    rules TEXT NOT NULL,
+    confidence INTEGER NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    resolved_by TEXT,
+    resolved_on_utc DATETIME,
+    created_on_utc DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_correlation_reviews_organisation_id ON correlation_reviews (organisation_id, status);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS correlation_reviews;
+DROP TABLE IF EXISTS correlation_rules;
+DROP TABLE IF EXISTS scim_user_identities;
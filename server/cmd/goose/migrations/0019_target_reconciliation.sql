@@ -0,0 +1,37 @@
+-- +goose Up
+-- How often a target is reconciled, in seconds, it's only reconciled on
+-- demand when null. reconcile_repair queues the operations that correct the
+-- drift found by scheduled runs.
+ALTER TABLE targets ADD COLUMN reconcile_interval INTEGER;
+ALTER TABLE targets ADD COLUMN reconcile_repair BOOLEAN NOT NULL DEFAULT 0;
+
+-- A comparison of the resources at a target with the local state. status is
+-- 'running', 'completed' or 'failed', and report is the JSON list of the
+-- drift found. trigger is 'schedule' or 'manual', created_by is set for
+-- manual runs.
+CREATE TABLE IF NOT EXISTS target_reconciliations (
+    id TEXT PRIMARY KEY,
+    organisation_id TEXT NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+    target_id TEXT NOT NULL REFERENCES targets(id) ON DELETE CASCADE,
+    trigger TEXT NOT NULL,
+    repair BOOLEAN NOT NULL,
+    status TEXT NOT NULL DEFAULT 'running',
+    missing INTEGER NOT NULL DEFAULT 0,
+    extra INTEGER NOT NULL DEFAULT 0,
+    changed INTEGER NOT NULL DEFAULT 0,
+    membership INTEGER NOT NULL DEFAULT 0,
+    repaired INTEGER NOT NULL DEFAULT 0,
+    report TEXT,
+    error TEXT,
+    created_by TEXT,
+    started_on_utc DATETIME NOT NULL,
+    completed_on_utc DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_target_reconciliations_target_id ON target_reconciliations (target_id, started_on_utc);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS target_reconciliations;
+ALTER TABLE targets DROP COLUMN reconcile_repair;
+ALTER TABLE targets DROP COLUMN reconcile_interval;
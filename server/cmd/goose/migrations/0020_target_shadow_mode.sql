@@ -0,0 +1,27 @@
+-- +goose Up
+-- mode is 'live' or 'shadow'. Nothing is sent to a target in shadow mode,
+-- the operations it would be sent are recorded instead.
+ALTER TABLE targets ADD COLUMN mode TEXT NOT NULL DEFAULT 'live';
+
+-- An operation a target in shadow mode would have been sent, with the mapped
+-- payload. Changes the scope of the target filtered out are recorded as
+-- skipped, and changes that couldn't be mapped with the error.
+CREATE TABLE IF NOT EXISTS target_shadow_operations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    organisation_id TEXT NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+    target_id TEXT NOT NULL REFERENCES targets(id) ON DELETE CASCADE,
+    resource_type TEXT NOT NULL,
+    resource_id TEXT NOT NULL,
+    operation TEXT NOT NULL,
+    payload TEXT,
+    skipped BOOLEAN NOT NULL DEFAULT 0,
+    error TEXT,
+    created_on_utc DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_target_shadow_operations_resource ON target_shadow_operations (target_id, resource_type, resource_id, id);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS target_shadow_operations;
+ALTER TABLE targets DROP COLUMN mode;
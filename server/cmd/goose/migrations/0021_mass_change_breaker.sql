@@ -0,0 +1,66 @@
+-- +goose Up
+-- The mass change threshold of an organisation. The breaker trips when more
+-- than max_count users, or more than max_percent of the users, are deleted or
+-- deactivated within window_seconds. reject rejects deletions and
+-- deactivations while a batch is held, and suspended_until is set when a
+-- batch is approved so the rest of the change goes through.
+CREATE TABLE IF NOT EXISTS mass_change_thresholds (
+    organisation_id TEXT PRIMARY KEY REFERENCES organisations(id) ON DELETE CASCADE,
+    max_count INTEGER,
+    max_percent INTEGER,
+    window_seconds INTEGER NOT NULL,
+    reject BOOLEAN NOT NULL DEFAULT 0,
+    suspended_until DATETIME,
+    modified_on_utc DATETIME NOT NULL,
+    modified_by TEXT
+);
+
+-- The deletions and deactivations counted towards the threshold.
+CREATE TABLE IF NOT EXISTS mass_changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    organisation_id TEXT NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+    resource_id TEXT NOT NULL,
+    operation TEXT NOT NULL,
+    created_on_utc DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_mass_changes_organisation_id ON mass_changes (organisation_id, created_on_utc);
+
+-- The changes held back from the targets of an organisation since its
+-- breaker tripped. status is 'open', 'approved' or 'discarded'. changes and
+-- users are the deletions and deactivations in the window and the users of
+-- the organisation when it tripped, events is the number of events held.
+CREATE TABLE IF NOT EXISTS held_batches (
+    id TEXT PRIMARY KEY,
+    organisation_id TEXT NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'open',
+    changes INTEGER NOT NULL,
+    users INTEGER NOT NULL,
+    events INTEGER NOT NULL DEFAULT 0,
+    opened_on_utc DATETIME NOT NULL,
+    resolved_by TEXT,
+    resolved_on_utc DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_held_batches_organisation_id ON held_batches (organisation_id, status);
+
+CREATE TABLE IF NOT EXISTS held_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    batch_id TEXT NOT NULL REFERENCES held_batches(id) ON DELETE CASCADE,
+    organisation_id TEXT NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+    resource_type TEXT NOT NULL,
+    resource_id TEXT NOT NULL,
+    operation TEXT NOT NULL,
+    resource TEXT,
+    deactivates BOOLEAN NOT NULL DEFAULT 0,
+    created_on_utc DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_held_events_batch_id ON held_events (batch_id, id);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS held_events;
+DROP TABLE IF EXISTS held_batches;
+DROP TABLE IF EXISTS mass_changes;
+DROP TABLE IF EXISTS mass_change_thresholds;
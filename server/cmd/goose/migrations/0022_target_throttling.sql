@@ -0,0 +1,14 @@
+-- +goose Up
+-- rate_limit is the most requests per second sent to a target, and
+-- max_in_flight the most events delivered to it at once. Both fall back to
+-- the defaults of the dispatcher when NULL.
+ALTER TABLE targets ADD COLUMN rate_limit REAL;
+ALTER TABLE targets ADD COLUMN max_in_flight INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_target_status ON outbox_events (target_id, status, next_attempt_on_utc);
+
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_outbox_events_target_status;
+ALTER TABLE targets DROP COLUMN max_in_flight;
+ALTER TABLE targets DROP COLUMN rate_limit;
@@ -0,0 +1,29 @@
+-- +goose Up
+-- A backfill sends every local user and then every group to a target, a page
+-- at a time. phase is the resource type being sent and last_resource_id the
+-- id of the last one sent, so an interrupted backfill resumes after it.
+-- status is 'running', 'paused', 'completed', 'cancelled' or 'failed'.
+CREATE TABLE IF NOT EXISTS target_backfills (
+    id TEXT PRIMARY KEY,
+    organisation_id TEXT NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+    target_id TEXT NOT NULL REFERENCES targets(id) ON DELETE CASCADE,
+    status TEXT NOT NULL,
+    phase TEXT NOT NULL,
+    last_resource_id TEXT NOT NULL DEFAULT '',
+    total_users INTEGER NOT NULL,
+    total_groups INTEGER NOT NULL,
+    processed_users INTEGER NOT NULL DEFAULT 0,
+    processed_groups INTEGER NOT NULL DEFAULT 0,
+    queued INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    created_by TEXT,
+    started_on_utc DATETIME NOT NULL,
+    modified_on_utc DATETIME NOT NULL,
+    completed_on_utc DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_target_backfills_target ON target_backfills (target_id, started_on_utc);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS target_backfills;
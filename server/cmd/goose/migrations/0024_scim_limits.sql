@@ -0,0 +1,20 @@
+-- +goose Up
+-- The limits of the SCIM requests of an organisation, replacing the defaults
+-- of the server. Requests are limited with token buckets refilled at
+-- rate_limit requests per second for the whole organisation and
+-- token_rate_limit per credential, holding up to burst and token_burst
+-- requests. A rate limit of 0 doesn't limit requests. max_body_bytes is the
+-- largest body of a POST, PUT or PATCH request.
+CREATE TABLE IF NOT EXISTS scim_limits (
+    organisation_id TEXT PRIMARY KEY REFERENCES organisations(id) ON DELETE CASCADE,
+    rate_limit REAL NOT NULL,
+    burst INTEGER NOT NULL,
+    token_rate_limit REAL NOT NULL,
+    token_burst INTEGER NOT NULL,
+    max_body_bytes INTEGER NOT NULL,
+    modified_on_utc DATETIME NOT NULL,
+    modified_by TEXT
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS scim_limits;
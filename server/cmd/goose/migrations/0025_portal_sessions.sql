@@ -0,0 +1,28 @@
+-- +goose Up
+-- failed_logins counts the failed logins of a portal user since the last
+-- successful one. The user is locked out until locked_until_utc once it
+-- reaches the limit.
+ALTER TABLE users ADD COLUMN failed_logins INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN locked_until_utc DATETIME;
+
+-- A login to the portal. The refresh token is replaced every time it's used,
+-- refresh_token_hash is the hash of the current one. csrf_token is sent back
+-- in the X-CSRF-Token header of the requests that change anything.
+CREATE TABLE IF NOT EXISTS portal_sessions (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    refresh_token_hash TEXT NOT NULL,
+    csrf_token TEXT NOT NULL,
+    created_on_utc DATETIME NOT NULL,
+    refreshed_on_utc DATETIME NOT NULL,
+    expires_on_utc DATETIME NOT NULL,
+    revoked_on_utc DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_portal_sessions_user_id ON portal_sessions (user_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_portal_sessions_user_id;
+DROP TABLE IF EXISTS portal_sessions;
+ALTER TABLE users DROP COLUMN locked_until_utc;
+ALTER TABLE users DROP COLUMN failed_logins;
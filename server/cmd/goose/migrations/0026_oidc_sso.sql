@@ -0,0 +1,33 @@
+-- +goose Up
+-- The role of a portal user in an organisation. Admins can change anything,
+-- viewers can only read.
+ALTER TABLE user_organisations ADD COLUMN role TEXT NOT NULL DEFAULT 'admin';
+
+-- The accounts at the OIDC provider portal users sign in with. Users created
+-- on their first sign in have no password.
+CREATE TABLE IF NOT EXISTS oidc_identities (
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_on_utc DATETIME NOT NULL,
+    last_login_on_utc DATETIME NOT NULL,
+    PRIMARY KEY (issuer, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_oidc_identities_user_id ON oidc_identities (user_id);
+
+-- Sign ins that were sent to the OIDC provider and haven't come back yet,
+-- keyed by the state parameter.
+CREATE TABLE IF NOT EXISTS oidc_logins (
+    state TEXT PRIMARY KEY,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    redirect TEXT NOT NULL,
+    created_on_utc DATETIME NOT NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS oidc_logins;
+DROP INDEX IF EXISTS idx_oidc_identities_user_id;
+DROP TABLE IF EXISTS oidc_identities;
+ALTER TABLE user_organisations DROP COLUMN role;
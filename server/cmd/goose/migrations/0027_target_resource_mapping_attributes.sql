@@ -0,0 +1,7 @@
+-- +goose Up
+-- The attributes last sent to the target for a resource, so attributes that
+-- are cleared locally can be removed from the target.
+ALTER TABLE target_resource_mappings ADD COLUMN sent_attributes TEXT;
+
+-- +goose Down
+ALTER TABLE target_resource_mappings DROP COLUMN sent_attributes;
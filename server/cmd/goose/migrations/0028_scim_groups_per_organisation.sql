@@ -0,0 +1,69 @@
+-- +goose Up
+-- Group display names and external ids were unique across organisations,
+-- they only need to be unique within one. SQLite can't drop a constraint,
+-- so the table is rebuilt. The memberships are kept aside, as dropping the
+-- table deletes them when foreign keys are enforced.
+CREATE TEMP TABLE scim_user_group_memberships_backup AS
+SELECT user_id, group_id FROM scim_user_group_memberships;
+
+CREATE TABLE scim_groups_new (
+    id TEXT PRIMARY KEY,
+    external_id TEXT,
+    display_name TEXT NOT NULL,
+    meta_resource_type TEXT NOT NULL,
+    meta_created TEXT NOT NULL,
+    meta_last_modified TEXT NOT NULL,
+    meta_version TEXT,
+
+    -- system fields
+    organisation_id TEXT NOT NULL,
+    FOREIGN KEY (organisation_id) REFERENCES organisations(id) ON DELETE CASCADE,
+    UNIQUE (organisation_id, display_name),
+    UNIQUE (organisation_id, external_id)
+);
+
+INSERT INTO scim_groups_new (id, external_id, display_name, meta_resource_type, meta_created, meta_last_modified, meta_version, organisation_id)
+SELECT id, external_id, display_name, meta_resource_type, meta_created, meta_last_modified, meta_version, organisation_id
+FROM scim_groups;
+
+DROP TABLE scim_groups;
+ALTER TABLE scim_groups_new RENAME TO scim_groups;
+
+CREATE INDEX IF NOT EXISTS idx_groups_display_name ON scim_groups (display_name);
+CREATE INDEX IF NOT EXISTS idx_groups_external_id ON scim_groups (external_id);
+
+INSERT OR IGNORE INTO scim_user_group_memberships (user_id, group_id)
+SELECT user_id, group_id FROM scim_user_group_memberships_backup;
+DROP TABLE scim_user_group_memberships_backup;
+
+-- +goose Down
+CREATE TEMP TABLE scim_user_group_memberships_backup AS
+SELECT user_id, group_id FROM scim_user_group_memberships;
+
+CREATE TABLE scim_groups_old (
+    id TEXT PRIMARY KEY,
+    external_id TEXT UNIQUE,
+    display_name TEXT UNIQUE NOT NULL,
+    meta_resource_type TEXT NOT NULL,
+    meta_created TEXT NOT NULL,
+    meta_last_modified TEXT NOT NULL,
+    meta_version TEXT,
+
+    -- system fields
+    organisation_id TEXT NOT NULL,
+    FOREIGN KEY (organisation_id) REFERENCES organisations(id) ON DELETE CASCADE
+);
+
+INSERT INTO scim_groups_old (id, external_id, display_name, meta_resource_type, meta_created, meta_last_modified, meta_version, organisation_id)
+SELECT id, external_id, display_name, meta_resource_type, meta_created, meta_last_modified, meta_version, organisation_id
+FROM scim_groups;
+
+DROP TABLE scim_groups;
+ALTER TABLE scim_groups_old RENAME TO scim_groups;
+
+CREATE INDEX IF NOT EXISTS idx_groups_display_name ON scim_groups (display_name);
+CREATE INDEX IF NOT EXISTS idx_groups_external_id ON scim_groups (external_id);
+
+INSERT OR IGNORE INTO scim_user_group_memberships (user_id, group_id)
+SELECT user_id, group_id FROM scim_user_group_memberships_backup;
+DROP TABLE scim_user_group_memberships_backup;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- There is no /Bulk endpoint for the bulk scope to guard, it is removed from
+-- the credentials that have it.
+UPDATE organisation_tokens SET scopes = trim(replace(' ' || scopes || ' ', ' bulk ', ' '));
+UPDATE oauth_clients SET scopes = trim(replace(' ' || scopes || ' ', ' bulk ', ' '));
+UPDATE trusted_issuers SET scopes = trim(replace(' ' || scopes || ' ', ' bulk ', ' '));
+UPDATE client_certificate_mappings SET scopes = trim(replace(' ' || scopes || ' ', ' bulk ', ' '));
+
+-- +goose Down
+-- Nothing uses the scope, it isn't given back.
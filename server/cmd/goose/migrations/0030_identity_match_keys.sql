@@ -0,0 +1,12 @@
+-- +goose Up
+-- The values nameAndBirthDate correlation rules compare, so identities can
+-- be looked up by them instead of decoding every resource. birth_date is
+-- read from the attribute of the nameAndBirthDate rule of the organisation.
+ALTER TABLE scim_user_identities ADD COLUMN normalised_name TEXT;
+ALTER TABLE scim_user_identities ADD COLUMN birth_date TEXT;
+CREATE INDEX IF NOT EXISTS idx_scim_user_identities_name_birth_date ON scim_user_identities (organisation_id, normalised_name, birth_date);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_scim_user_identities_name_birth_date;
+ALTER TABLE scim_user_identities DROP COLUMN birth_date;
+ALTER TABLE scim_user_identities DROP COLUMN normalised_name;
@@ -0,0 +1,69 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/jawee/scimtiplexer/internal/correlation"
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(upBackfillIdentityMatchKeys, downBackfillIdentityMatchKeys)
+}
+
+// upBackfillIdentityMatchKeys stores the normalised name and birth date of
+// the identities that existed before the previous migration. The birth date
+// is read from the attribute of the oldest nameAndBirthDate rule of the
+// organisation.
+func upBackfillIdentityMatchKeys(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, "SELECT organisation_id, birth_date_attribute FROM correlation_rules WHERE match = ? AND birth_date_attribute IS NOT NULL ORDER BY created_on_utc DESC", correlation.MatchNameAndBirthDate)
+	if err != nil {
+		return err
+	}
+	attributes := make(map[string]string)
+	for rows.Next() {
+		var organisationId, attribute string
+		if err := rows.Scan(&organisationId, &attribute); err != nil {
+			rows.Close()
+			return err
+		}
+		attributes[organisationId] = attribute
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	rows, err = tx.QueryContext(ctx, "SELECT id, organisation_id, resource FROM scim_user_identities WHERE resource IS NOT NULL")
+	if err != nil {
+		return err
+	}
+	keys := make(map[string]correlation.Keys)
+	for rows.Next() {
+		var id, organisationId, resource string
+		if err := rows.Scan(&id, &organisationId, &resource); err != nil {
+			rows.Close()
+			return err
+		}
+		keys[id] = correlation.KeysOf(json.RawMessage(resource), attributes[organisationId])
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	for id, k := range keys {
+		_, err := tx.ExecContext(ctx, "UPDATE scim_user_identities SET normalised_name = ?, birth_date = ? WHERE id = ?",
+			k.NormalisedName, k.BirthDate, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// downBackfillIdentityMatchKeys is a no-op, the columns are dropped by the
+// previous migration.
+func downBackfillIdentityMatchKeys(ctx context.Context, tx *sql.Tx) error {
+	return nil
+}
@@ -0,0 +1,20 @@
+-- +goose Up
+-- A token could be mapped to every organisation that registered the same
+-- issuer, audience and organisation claim, and the oldest registration took
+-- it. The later duplicates never authenticated a token, they are removed so
+-- a registration is unique.
+DELETE FROM trusted_issuers
+WHERE EXISTS (
+    SELECT 1 FROM trusted_issuers earlier
+    WHERE earlier.issuer = trusted_issuers.issuer
+    AND earlier.audience = trusted_issuers.audience
+    AND earlier.organisation_claim = trusted_issuers.organisation_claim
+    AND earlier.organisation_claim_value = trusted_issuers.organisation_claim_value
+    AND earlier.id < trusted_issuers.id
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_trusted_issuers_claim
+ON trusted_issuers (issuer, audience, organisation_claim, organisation_claim_value);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_trusted_issuers_claim;
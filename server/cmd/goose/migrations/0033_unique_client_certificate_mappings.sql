@@ -0,0 +1,20 @@
+-- +goose Up
+-- A certificate could be mapped to every organisation that registered its
+-- subject or SAN with a CA that issued it, and the oldest mapping took it.
+-- CA certificates are public, so a match is made unique. The later
+-- duplicates are removed.
+DELETE FROM client_certificate_mappings
+WHERE EXISTS (
+    SELECT 1 FROM client_certificate_mappings earlier
+    WHERE earlier.match_type = client_certificate_mappings.match_type
+    AND earlier.match_value = client_certificate_mappings.match_value
+    AND earlier.id < client_certificate_mappings.id
+);
+
+DROP INDEX IF EXISTS idx_client_certificate_mappings_match_value;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_client_certificate_mappings_match
+ON client_certificate_mappings (match_type, match_value);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_client_certificate_mappings_match;
+CREATE INDEX IF NOT EXISTS idx_client_certificate_mappings_match_value ON client_certificate_mappings (match_value);
@@ -0,0 +1,27 @@
+// Package migrations holds the database migrations. The SQL migrations are
+// embedded, the Go migrations register themselves with goose.
+package migrations
+
+import (
+	"database/sql"
+	"embed"
+
+	"github.com/pressly/goose/v3"
+)
+
+//go:embed *.sql
+var FS embed.FS
+
+// Setup points goose at the migrations of this package.
+func Setup() error {
+	goose.SetBaseFS(FS)
+	return goose.SetDialect("sqlite3")
+}
+
+// Up applies every migration to db.
+func Up(db *sql.DB) error {
+	if err := Setup(); err != nil {
+		return err
+	}
+	return goose.Up(db, ".")
+}
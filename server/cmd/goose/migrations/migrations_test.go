@@ -0,0 +1,126 @@
+package migrations
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pressly/goose/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// migrateTo returns a database migrated up to version.
+func migrateTo(t *testing.T, version int64) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	goose.SetLogger(goose.NopLogger())
+	require.NoError(t, Setup())
+	require.NoError(t, goose.UpTo(db, ".", version))
+	return db
+}
+
+func TestBackfillIdentityMatchKeys(t *testing.T) {
+	db := migrateTo(t, 30)
+	_, err := db.Exec(`INSERT INTO correlation_rules (id, organisation_id, match, birth_date_attribute, confidence, created_by, created_on_utc)
+		VALUES ('rule-1', 'org-1', 'nameAndBirthDate', 'urn:example:hr:User:birthDate', 60, 'admin', '2025-01-01 00:00:00')`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO scim_user_identities (id, organisation_id, user_id, resource, created_on_utc, modified_on_utc) VALUES
+		('alice', 'org-1', 'alice', '{"name": {"givenName": "Alice", "familyName": "Smith"}, "urn:example:hr:User": {"birthDate": "1980-02-03"}}', '2025-01-01 00:00:00', '2025-01-01 00:00:00'),
+		('bob', 'org-2', 'bob', '{"name": {"formatted": "Bob Jones"}, "urn:example:hr:User": {"birthDate": "1980-02-03"}}', '2025-01-01 00:00:00', '2025-01-01 00:00:00')`)
+	require.NoError(t, err)
+
+	require.NoError(t, goose.UpTo(db, ".", 31))
+
+	var name, birthDate sql.NullString
+	require.NoError(t, db.QueryRow("SELECT normalised_name, birth_date FROM scim_user_identities WHERE id = 'alice'").Scan(&name, &birthDate))
+	assert.Equal(t, "alice smith", name.String)
+	assert.Equal(t, "1980-02-03", birthDate.String)
+
+	require.NoError(t, db.QueryRow("SELECT normalised_name, birth_date FROM scim_user_identities WHERE id = 'bob'").Scan(&name, &birthDate))
+	assert.Equal(t, "bob jones", name.String)
+	assert.False(t, birthDate.Valid, "the organisation has no nameAndBirthDate rule")
+}
+
+func TestOrganisationSlugCollisions(t *testing.T) {
+	db := migrateTo(t, 2)
+	_, err := db.Exec(`INSERT INTO organisations (id, name, created_on_utc, modified_on_utc) VALUES
+		('org-1', 'Acme Corp', '2025-01-01 00:00:00', '2025-01-01 00:00:00'),
+		('org-2', 'acme corp', '2025-01-02 00:00:00', '2025-01-02 00:00:00'),
+		('org-3', 'Acme-Corp', '2025-01-02 00:00:00', '2025-01-02 00:00:00'),
+		('org-4', 'Globex', '2025-01-03 00:00:00', '2025-01-03 00:00:00')`)
+	require.NoError(t, err)
+
+	require.NoError(t, goose.UpTo(db, ".", 3))
+
+	rows, err := db.Query("SELECT id, slug FROM organisations ORDER BY id")
+	require.NoError(t, err)
+	defer rows.Close()
+	slugs := make(map[string]string)
+	for rows.Next() {
+		var id, slug string
+		require.NoError(t, rows.Scan(&id, &slug))
+		slugs[id] = slug
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, map[string]string{
+		"org-1": "acme-corp",
+		"org-2": "acme-corp-org-2",
+		"org-3": "acme-corp-org-3",
+		"org-4": "globex",
+	}, slugs)
+}
+
+func TestTrustedIssuerDuplicates(t *testing.T) {
+	db := migrateTo(t, 31)
+	_, err := db.Exec(`INSERT INTO trusted_issuers (id, organisation_id, issuer, audience, jwks, organisation_claim, organisation_claim_value, scopes, created_by, created_on_utc, modified_on_utc) VALUES
+		('trusted-1', 'org-1', 'https://idp.example.com', 'scim', '{}', 'tenant', 'acme', '', 'admin', '2025-01-01 00:00:00', '2025-01-01 00:00:00'),
+		('trusted-2', 'org-2', 'https://idp.example.com', 'scim', '{}', 'tenant', 'acme', '', 'admin', '2025-01-02 00:00:00', '2025-01-02 00:00:00'),
+		('trusted-3', 'org-2', 'https://idp.example.com', 'scim', '{}', 'tenant', 'globex', '', 'admin', '2025-01-02 00:00:00', '2025-01-02 00:00:00')`)
+	require.NoError(t, err)
+
+	require.NoError(t, goose.UpTo(db, ".", 32))
+
+	var ids []string
+	rows, err := db.Query("SELECT id FROM trusted_issuers ORDER BY id")
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		require.NoError(t, rows.Scan(&id))
+		ids = append(ids, id)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []string{"trusted-1", "trusted-3"}, ids, "the registration that took the tokens is kept")
+
+	_, err = db.Exec(`INSERT INTO trusted_issuers (id, organisation_id, issuer, audience, jwks, organisation_claim, organisation_claim_value, scopes, created_by, created_on_utc, modified_on_utc)
+		VALUES ('trusted-4', 'org-3', 'https://idp.example.com', 'scim', '{}', 'tenant', 'acme', '', 'admin', '2025-01-03 00:00:00', '2025-01-03 00:00:00')`)
+	assert.Error(t, err)
+}
+
+func TestClientCertificateMappingDuplicates(t *testing.T) {
+	db := migrateTo(t, 32)
+	_, err := db.Exec(`INSERT INTO client_certificate_mappings (id, organisation_id, ca_bundle, match_type, match_value, scopes, created_by, created_on_utc, modified_on_utc) VALUES
+		('mapping-1', 'org-1', 'ca', 'dns', 'provisioner.acme.example', '', 'admin', '2025-01-01 00:00:00', '2025-01-01 00:00:00'),
+		('mapping-2', 'org-2', 'ca', 'dns', 'provisioner.acme.example', '', 'admin', '2025-01-02 00:00:00', '2025-01-02 00:00:00'),
+		('mapping-3', 'org-2', 'ca', 'subject', 'provisioner.acme.example', '', 'admin', '2025-01-02 00:00:00', '2025-01-02 00:00:00')`)
+	require.NoError(t, err)
+
+	require.NoError(t, goose.UpTo(db, ".", 33))
+
+	var ids []string
+	rows, err := db.Query("SELECT id FROM client_certificate_mappings ORDER BY id")
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		require.NoError(t, rows.Scan(&id))
+		ids = append(ids, id)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []string{"mapping-1", "mapping-3"}, ids, "the mapping that took the certificates is kept")
+}
@@ -3,11 +3,14 @@ package main
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jawee/scimtiplexer/internal/admin"
 	"github.com/jawee/scimtiplexer/internal/database"
 	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/token"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -34,6 +37,7 @@ func main() {
 	repo.CreateOrganisation(ctx, repository.CreateOrganisationParams{
 		ID:            orgId.String(),
 		Name:          "Test Organisation",
+		Slug:          "test-organisation",
 		Createdonutc:  time.Now().UTC(),
 		Modifiedonutc: time.Now().UTC(),
 	})
@@ -41,6 +45,7 @@ func main() {
 	repo.CreateOrganisationUser(ctx, repository.CreateOrganisationUserParams{
 		Organisationid: orgId.String(),
 		Userid:         userId.String(),
+		Role:           admin.RoleAdmin,
 		Createdonutc:   time.Now().UTC(),
 		Modifiedonutc:  time.Now().UTC(),
 	})
@@ -49,7 +54,9 @@ func main() {
 	repo.CreateOrganisationToken(ctx, repository.CreateOrganisationTokenParams{
 		ID:             tokenId.String(),
 		Organisationid: orgId.String(),
-		Token:          "testtoken",
+		Tokenprefix:    token.Prefix("testtoken"),
+		Tokenhash:      token.Hash("testtoken"),
+		Scopes:         strings.Join(token.AllScopes, " "),
 		Createdby:      userId.String(),
 		Createdonutc:   time.Now().UTC(),
 		Modifiedonutc:  time.Now().UTC(),
@@ -0,0 +1,175 @@
+package admin
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/utils"
+)
+
+// Authenticator guards the admin API. Portal users authenticate with a
+// session started by logging in, or with their username and password as
+// basic auth. Organisation scoped routes additionally require the user to be
+// a member of the organisation in the path.
+type Authenticator struct {
+	repo            repository.Querier
+	sessionSecret   []byte
+	sessionLifetime time.Duration
+	maxFailures     int64
+	lockout         time.Duration
+	throttle        *loginThrottle
+
+	mu    sync.Mutex
+	swept time.Time
+}
+
+// NewAuthenticator creates an authenticator. Session JWTs are signed with
+// PORTAL_SESSION_SECRET, which every server behind a load balancer must
+// share. Without it they're signed with a random key and the portal has to
+// refresh them when the server restarts.
+func NewAuthenticator(repo repository.Querier) *Authenticator {
+	secret := []byte(os.Getenv(utils.EnvPortalSessionSecret))
+	if len(secret) == 0 {
+		slog.Warn("PORTAL_SESSION_SECRET is not set, portal sessions are signed with a random key")
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+
+	return &Authenticator{
+		repo:            repo,
+		sessionSecret:   secret,
+		sessionLifetime: utils.DurationFromEnv(utils.EnvPortalSessionLifetime, 7*24*time.Hour),
+		maxFailures:     intFromEnv(utils.EnvLoginMaxFailures, 5),
+		lockout:         utils.DurationFromEnv(utils.EnvLoginLockoutDuration, 15*time.Minute),
+		throttle:        newLoginThrottle(),
+	}
+}
+
+// RequireUser authenticates the request and stores the user id in the
+// context. Requests authenticated with a session cookie that change anything
+// must send the CSRF token of the session in the X-CSRF-Token header.
+func (a *Authenticator) RequireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var userId string
+		if cookie, err := r.Cookie(sessionCookie); err == nil && r.Header.Get("Authorization") == "" {
+			claims, err := a.verifySession(r.Context(), cookie.Value)
+			if err != nil {
+				if !errors.Is(err, errSessionExpired) {
+					slog.Error("Session verification failed", "error", err)
+					WriteError(w, http.StatusInternalServerError, "Internal server error")
+					return
+				}
+				WriteError(w, http.StatusUnauthorized, "Session has expired")
+				return
+			}
+			if !safeMethod(r.Method) && !validCSRFToken(r, claims.CSRFToken) {
+				WriteError(w, http.StatusForbidden, "Missing or invalid CSRF token")
+				return
+			}
+			userId = claims.Subject
+		} else {
+			username, password, ok := r.BasicAuth()
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Basic realm="scimtiplexer"`)
+				WriteError(w, http.StatusUnauthorized, "Missing credentials")
+				return
+			}
+
+			user, err := a.login(r, username, password)
+			if err != nil {
+				writeLoginError(w, err)
+				return
+			}
+			userId = user.ID
+		}
+
+		ctx := context.WithValue(r.Context(), "userid", userId)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Roles of the members of an organisation. Viewers can only read.
+const (
+	RoleAdmin  = "admin"
+	RoleViewer = "viewer"
+)
+
+// ValidRole reports whether role is a role of organisation members.
+func ValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleViewer
+}
+
+// IsLastAdmin reports whether member is the only admin of its organisation,
+// which must keep an admin to be managed.
+func IsLastAdmin(ctx context.Context, repo repository.Querier, member repository.UserOrganisation) (bool, error) {
+	if member.Role != RoleAdmin {
+		return false, nil
+	}
+	admins, err := repo.CountOrganisationUsersWithRole(ctx, repository.CountOrganisationUsersWithRoleParams{
+		Organisationid: member.OrganisationID,
+		Role:           RoleAdmin,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to CountOrganisationUsersWithRole: %w", err)
+	}
+	return admins <= 1, nil
+}
+
+// RequireOrganisationMember authenticates the request and checks that the user
+// is a member of the organisation given by the orgId path value. Viewers can
+// only make requests that change nothing.
+func (a *Authenticator) RequireOrganisationMember(next http.Handler) http.Handler {
+	return a.RequireUser(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		organisationId := r.PathValue("orgId")
+		member, err := a.repo.GetOrganisationUser(r.Context(), repository.GetOrganisationUserParams{
+			Userid:         UserID(r.Context()),
+			Organisationid: organisationId,
+		})
+		if err != nil {
+			if err == sql.ErrNoRows {
+				WriteError(w, http.StatusForbidden, "Not a member of this organisation")
+				return
+			}
+			slog.Error("GetOrganisationUser failed", "error", err)
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if member.Role != RoleAdmin && !safeMethod(r.Method) {
+			WriteError(w, http.StatusForbidden, "Viewers can't change this organisation")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// UserID returns the id of the authenticated portal user.
+func UserID(ctx context.Context) string {
+	userId, _ := ctx.Value("userid").(string)
+	return userId
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func WriteJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	jsonOutput, _ := json.Marshal(v)
+	w.Write(jsonOutput)
+}
+
+func WriteError(w http.ResponseWriter, status int, message string) {
+	WriteJSON(w, status, ErrorResponse{Error: message})
+}
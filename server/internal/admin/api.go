@@ -0,0 +1,103 @@
+package admin
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// APIPrefix is the base path of the admin API. Every endpoint is also served
+// under the unversioned /api prefix it was first served at.
+const APIPrefix = "/api/v1"
+
+const legacyPrefix = "/api"
+
+// Operation describes an endpoint in the OpenAPI document. Request and
+// Response are values of the types of the request and response bodies, nil
+// when there is none. Status is the status of a successful response, 200 when
+// left out.
+type Operation struct {
+	Summary     string
+	Description string
+	Query       []Param
+	Request     any
+	Response    any
+	Status      int
+}
+
+// Param is a query parameter of an endpoint.
+type Param struct {
+	Name        string
+	Description string
+}
+
+// API registers the endpoints of the admin API and describes them in its
+// OpenAPI document, which is served at /api/v1/openapi.json.
+type API struct {
+	mux  *http.ServeMux
+	auth *Authenticator
+
+	mu         sync.Mutex
+	operations []registeredOperation
+}
+
+type registeredOperation struct {
+	method string
+	path   string
+	public bool
+	Operation
+}
+
+func NewAPI(mux *http.ServeMux, auth *Authenticator) *API {
+	a := &API{mux: mux, auth: auth}
+
+	mux.HandleFunc("GET "+APIPrefix+"/openapi.json", a.handleGetDocument)
+	// Paths no endpoint matches get the JSON errors of the API.
+	mux.HandleFunc(APIPrefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, http.StatusNotFound, "Not found")
+	})
+	return a
+}
+
+// Member registers an endpoint of the organisation in the orgId path value,
+// for the portal users that are members of it. path is relative to the
+// prefix of the API.
+func (a *API) Member(method, path string, handler http.HandlerFunc, op Operation) {
+	a.handle(method, path, a.auth.RequireOrganisationMember(handler), op)
+}
+
+// User registers an endpoint for any portal user.
+func (a *API) User(method, path string, handler http.HandlerFunc, op Operation) {
+	a.handle(method, path, a.auth.RequireUser(handler), op)
+}
+
+// Public registers an endpoint that doesn't require authentication.
+func (a *API) Public(method, path string, handler http.HandlerFunc, op Operation) {
+	a.handle(method, path, handler, op)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.operations[len(a.operations)-1].public = true
+}
+
+func (a *API) handle(method, path string, handler http.Handler, op Operation) {
+	if !strings.HasPrefix(path, "/") {
+		panic("admin: path must start with /: " + path)
+	}
+
+	slog.Debug("Registering admin endpoint", "method", method, "path", path)
+	a.mux.Handle(method+" "+APIPrefix+path, handler)
+	a.mux.Handle(method+" "+legacyPrefix+path, handler)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.operations = append(a.operations, registeredOperation{method: method, path: path, Operation: op})
+}
+
+func (a *API) handleGetDocument(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	operations := append([]registeredOperation(nil), a.operations...)
+	a.mu.Unlock()
+
+	WriteJSON(w, http.StatusOK, newDocument(operations))
+}
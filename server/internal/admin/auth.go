@@ -0,0 +1,148 @@
+package admin
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/repository"
+)
+
+// RegisterEndpoints registers the endpoints portal users log in and out
+// with.
+func RegisterEndpoints(api *API) {
+	h := &authHandler{auth: api.auth}
+
+	slog.Debug("Registering portal authentication endpoints")
+	api.Public("POST", "/auth/login", h.handleLogin, Operation{
+		Summary:     "Log in to the portal",
+		Description: "Sets the session, refresh and CSRF cookies.",
+		Request:     LoginRequest{},
+		Response:    SessionResponse{},
+	})
+	api.Public("POST", "/auth/refresh", h.handleRefresh, Operation{
+		Summary:     "Refresh the session in the refresh cookie",
+		Description: "Requires the CSRF token of the session in the X-CSRF-Token header.",
+		Response:    SessionResponse{},
+	})
+	api.Public("POST", "/auth/logout", h.handleLogout, Operation{
+		Summary:     "Log out of the portal",
+		Description: "Requires the CSRF token of the session in the X-CSRF-Token header.",
+		Status:      http.StatusNoContent,
+	})
+	api.User("GET", "/auth/me", h.handleMe, Operation{
+		Summary:  "Get the portal user that is logged in",
+		Response: UserResponse{},
+	})
+}
+
+type authHandler struct {
+	auth *Authenticator
+}
+
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type UserResponse struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+func newUserResponse(user repository.User) UserResponse {
+	return UserResponse{
+		ID:       user.ID,
+		Username: user.Username,
+		Email:    user.Email,
+	}
+}
+
+// SessionResponse describes a session that was started or refreshed.
+// CsrfToken is sent in the X-CSRF-Token header of requests that change
+// anything, it's also in the scimtiplexer_csrf cookie. The session has to be
+// refreshed before ExpiresOnUtc.
+type SessionResponse struct {
+	User         UserResponse `json:"user"`
+	CsrfToken    string       `json:"csrfToken"`
+	ExpiresOnUtc time.Time    `json:"expiresOnUtc"`
+}
+
+func newSessionResponse(s session) SessionResponse {
+	return SessionResponse{
+		User:         newUserResponse(s.user),
+		CsrfToken:    s.csrfToken,
+		ExpiresOnUtc: s.expiresOnUtc,
+	}
+}
+
+func (h *authHandler) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if !ReadJSON(w, r, &req) {
+		return
+	}
+	if req.Username == "" || req.Password == "" {
+		WriteError(w, http.StatusBadRequest, "username and password are required")
+		return
+	}
+
+	user, err := h.auth.login(r, req.Username, req.Password)
+	if err != nil {
+		writeLoginError(w, err)
+		return
+	}
+
+	s, err := h.auth.startSession(w, r, user)
+	if err != nil {
+		writeSessionError(w, err, "Failed to start session")
+		return
+	}
+
+	slog.Info("Admin user logged in", "userid", user.ID)
+	WriteJSON(w, http.StatusOK, newSessionResponse(s))
+}
+
+func (h *authHandler) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	s, err := h.auth.refreshSession(w, r)
+	if err != nil {
+		writeSessionError(w, err, "Failed to refresh session")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, newSessionResponse(s))
+}
+
+func (h *authHandler) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if err := h.auth.endSession(w, r); err != nil {
+		writeSessionError(w, err, "Failed to end session")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *authHandler) handleMe(w http.ResponseWriter, r *http.Request) {
+	user, err := h.auth.repo.GetUserById(r.Context(), UserID(r.Context()))
+	if err != nil {
+		slog.Error("GetUserById failed", "error", err)
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, newUserResponse(user))
+}
+
+func writeSessionError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, errSessionExpired):
+		WriteError(w, http.StatusUnauthorized, "Session has expired")
+		return
+	case errors.Is(err, errInvalidCSRFToken):
+		WriteError(w, http.StatusForbidden, "Missing or invalid CSRF token")
+		return
+	}
+	slog.Error(message, "error", err)
+	WriteError(w, http.StatusInternalServerError, message)
+}
@@ -0,0 +1,181 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jawee/scimtiplexer/internal/admin"
+	"github.com/jawee/scimtiplexer/internal/database/databasetest"
+	"github.com/jawee/scimtiplexer/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	loginPath   = admin.APIPrefix + "/auth/login"
+	refreshPath = admin.APIPrefix + "/auth/refresh"
+	logoutPath  = admin.APIPrefix + "/auth/logout"
+	mePath      = admin.APIPrefix + "/auth/me"
+	// changePath is an endpoint of org-1 that changes something.
+	changePath = admin.APIPrefix + "/orgs/org-1/changes"
+)
+
+// newTestAPI serves the authentication endpoints and changePath, for the
+// admin of org-1.
+func newTestAPI(t *testing.T) http.Handler {
+	t.Setenv(utils.EnvPortalSessionSecret, "session-secret")
+	repo := databasetest.New(t).GetRepository()
+	databasetest.CreateMember(t, repo, "admin", "org-1", admin.RoleAdmin)
+	mux := http.NewServeMux()
+	api := admin.NewAPI(mux, admin.NewAuthenticator(repo))
+	admin.RegisterEndpoints(api)
+	api.Member("POST", "/orgs/{orgId}/changes", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}, admin.Operation{Summary: "Change something", Status: http.StatusNoContent})
+	return mux
+}
+
+// client is a browser, it keeps the cookies set by the responses.
+type client struct {
+	h       http.Handler
+	cookies map[string]*http.Cookie
+}
+
+func newClient(h http.Handler) *client {
+	return &client{h: h, cookies: make(map[string]*http.Cookie)}
+}
+
+// do sends a request with the cookies and the CSRF token, when it isn't
+// empty, and keeps the cookies of the response.
+func (c *client) do(method, path, body, csrfToken string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for _, cookie := range c.cookies {
+		req.AddCookie(cookie)
+	}
+	if csrfToken != "" {
+		req.Header.Set("X-CSRF-Token", csrfToken)
+	}
+	rec := httptest.NewRecorder()
+	c.h.ServeHTTP(rec, req)
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.MaxAge < 0 {
+			delete(c.cookies, cookie.Name)
+		} else {
+			c.cookies[cookie.Name] = cookie
+		}
+	}
+	return rec
+}
+
+func (c *client) login(t *testing.T, password string) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(admin.LoginRequest{Username: "admin", Password: password})
+	require.NoError(t, err)
+	return c.do("POST", loginPath, string(body), "")
+}
+
+// session logs in and returns the session.
+func (c *client) session(t *testing.T) admin.SessionResponse {
+	t.Helper()
+	rec := c.login(t, databasetest.Password)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var session admin.SessionResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &session))
+	return session
+}
+
+func TestLoginStartsSession(t *testing.T) {
+	c := newClient(newTestAPI(t))
+
+	assert.Equal(t, http.StatusUnauthorized, c.login(t, "wrong").Code)
+	assert.Equal(t, http.StatusUnauthorized, c.do("GET", mePath, "", "").Code)
+
+	session := c.session(t)
+	assert.Equal(t, "admin", session.User.Username)
+	require.NotEmpty(t, session.CsrfToken)
+	for name, cookie := range c.cookies {
+		assert.Equal(t, name != "scimtiplexer_csrf", cookie.HttpOnly, name)
+		assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite, name)
+	}
+	assert.Equal(t, session.CsrfToken, c.cookies["scimtiplexer_csrf"].Value)
+
+	rec := c.do("GET", mePath, "", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), `"username":"admin"`)
+
+	require.Equal(t, http.StatusNoContent, c.do("POST", logoutPath, "", session.CsrfToken).Code)
+	assert.Empty(t, c.cookies)
+}
+
+func TestLoginLocksOutUser(t *testing.T) {
+	t.Setenv(utils.EnvLoginMaxFailures, "3")
+	c := newClient(newTestAPI(t))
+
+	for range 3 {
+		require.Equal(t, http.StatusUnauthorized, c.login(t, "wrong").Code)
+	}
+	rec := c.login(t, databasetest.Password)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code, "the right password is refused while locked out")
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+
+	req := httptest.NewRequest("GET", mePath, nil)
+	req.SetBasicAuth("admin", databasetest.Password)
+	rec = httptest.NewRecorder()
+	c.h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code, "basic auth is locked out too")
+}
+
+func TestLoginThrottlesClient(t *testing.T) {
+	c := newClient(newTestAPI(t))
+
+	for i := range 10 {
+		body := `{"username": "unknown-` + strconv.Itoa(i) + `", "password": "wrong"}`
+		require.Equal(t, http.StatusUnauthorized, c.do("POST", loginPath, body, "").Code)
+	}
+	rec := c.login(t, databasetest.Password)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code, "the address has failed too many logins")
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+}
+
+func TestRefreshTokenCanOnlyBeUsedOnce(t *testing.T) {
+	c := newClient(newTestAPI(t))
+	session := c.session(t)
+	replaced := c.cookies["scimtiplexer_refresh"]
+
+	rec := c.do("POST", refreshPath, "", session.CsrfToken)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NotEqual(t, replaced.Value, c.cookies["scimtiplexer_refresh"].Value)
+	assert.Equal(t, http.StatusOK, c.do("GET", mePath, "", "").Code)
+
+	// A copy of the replaced refresh token ends the session.
+	thief := newClient(c.h)
+	thief.cookies[replaced.Name] = replaced
+	assert.Equal(t, http.StatusUnauthorized, thief.do("POST", refreshPath, "", session.CsrfToken).Code)
+
+	assert.Equal(t, http.StatusUnauthorized, c.do("POST", refreshPath, "", session.CsrfToken).Code)
+	assert.Equal(t, http.StatusUnauthorized, c.do("GET", mePath, "", "").Code)
+}
+
+func TestSessionRequiresCSRFToken(t *testing.T) {
+	c := newClient(newTestAPI(t))
+	session := c.session(t)
+
+	assert.Equal(t, http.StatusForbidden, c.do("POST", changePath, "", "").Code)
+	assert.Equal(t, http.StatusForbidden, c.do("POST", changePath, "", "wrong").Code)
+	assert.Equal(t, http.StatusNoContent, c.do("POST", changePath, "", session.CsrfToken).Code)
+
+	assert.Equal(t, http.StatusForbidden, c.do("POST", refreshPath, "", "").Code)
+	assert.Equal(t, http.StatusForbidden, c.do("POST", logoutPath, "", "wrong").Code)
+	assert.Equal(t, http.StatusOK, c.do("GET", mePath, "", "").Code, "requests that change nothing don't need it")
+
+	// Basic auth isn't sent by the browser on its own, it needs no token.
+	req := httptest.NewRequest("POST", changePath, nil)
+	req.SetBasicAuth("admin", databasetest.Password)
+	rec := httptest.NewRecorder()
+	c.h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
@@ -0,0 +1,215 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// clientFailures is how many failed logins a client address gets before
+	// its logins are throttled. They are forgiven at the same rate per
+	// clientFailureWindow.
+	clientFailures      = 10
+	clientFailureWindow = time.Minute
+)
+
+var errInvalidCredentials = errors.New("invalid credentials")
+
+// throttledError is returned for logins of a locked out user or from a client
+// address that has failed too many logins.
+type throttledError struct {
+	retryAfter time.Duration
+}
+
+func (e *throttledError) Error() string {
+	return fmt.Sprintf("too many failed logins, retry after %s", e.retryAfter)
+}
+
+// dummyHash is compared with the password of logins of unknown users, so
+// they take as long as the logins of users that exist.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("scimtiplexer"), bcrypt.DefaultCost)
+	return hash
+})
+
+// login checks the username and password of a portal user. A user is locked
+// out for LOGIN_LOCKOUT_DURATION after LOGIN_MAX_FAILURES failed logins in a
+// row, whatever address they come from.
+func (a *Authenticator) login(r *http.Request, username, password string) (repository.User, error) {
+	ip := clientIP(r)
+	if wait := a.throttle.wait(ip); wait > 0 {
+		return repository.User{}, &throttledError{retryAfter: wait}
+	}
+
+	user, err := a.repo.GetUserByUsername(r.Context(), username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+			a.throttle.fail(ip)
+			slog.Info("Admin login for unknown user", "username", username, "ip", ip)
+			return repository.User{}, errInvalidCredentials
+		}
+		return repository.User{}, fmt.Errorf("failed to GetUserByUsername: %w", err)
+	}
+
+	if user.LockedUntilUtc.Valid && time.Now().Before(user.LockedUntilUtc.Time) {
+		slog.Info("Admin login for locked out user", "username", username, "ip", ip)
+		return repository.User{}, &throttledError{retryAfter: time.Until(user.LockedUntilUtc.Time)}
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		a.throttle.fail(ip)
+		slog.Info("Admin login with invalid password", "username", username, "ip", ip)
+		if err := a.recordFailedLogin(r.Context(), user); err != nil {
+			return repository.User{}, err
+		}
+		return repository.User{}, errInvalidCredentials
+	}
+
+	if user.FailedLogins > 0 || user.LockedUntilUtc.Valid {
+		if err := a.repo.ResetFailedLogins(r.Context(), user.ID); err != nil {
+			return repository.User{}, fmt.Errorf("failed to ResetFailedLogins: %w", err)
+		}
+	}
+	return user, nil
+}
+
+func (a *Authenticator) recordFailedLogin(ctx context.Context, user repository.User) error {
+	failures, err := a.repo.RecordFailedLogin(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to RecordFailedLogin: %w", err)
+	}
+	if failures < a.maxFailures {
+		return nil
+	}
+
+	lockedUntil := time.Now().UTC().Add(a.lockout)
+	err = a.repo.LockUser(ctx, repository.LockUserParams{
+		Lockeduntilutc: sql.NullTime{Time: lockedUntil, Valid: true},
+		ID:             user.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to LockUser: %w", err)
+	}
+	slog.Warn("Locked out admin user after failed logins", "username", user.Username, "failures", failures, "until", lockedUntil)
+	return nil
+}
+
+// writeLoginError writes the response to a failed login.
+func writeLoginError(w http.ResponseWriter, err error) {
+	var throttled *throttledError
+	switch {
+	case errors.Is(err, errInvalidCredentials):
+		WriteError(w, http.StatusUnauthorized, "Invalid credentials")
+	case errors.As(err, &throttled):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.retryAfter.Seconds()))))
+		WriteError(w, http.StatusTooManyRequests, "Too many failed logins, try again later")
+	default:
+		slog.Error("Admin login failed", "error", err)
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
+
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// loginThrottle counts the failed logins of client addresses in token
+// buckets, so a client can't guess passwords of many users without locking
+// any of them out.
+type loginThrottle struct {
+	mu      sync.Mutex
+	buckets map[string]*failures
+	swept   time.Time
+}
+
+type failures struct {
+	allowed  float64
+	refilled time.Time
+}
+
+func newLoginThrottle() *loginThrottle {
+	return &loginThrottle{
+		buckets: make(map[string]*failures),
+		swept:   time.Now(),
+	}
+}
+
+// wait returns how long the client address has to wait before it can try
+// to log in again, 0 when it can now.
+func (t *loginThrottle) wait(ip string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b := t.refill(ip, time.Now())
+	if b == nil || b.allowed >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.allowed) * float64(clientFailureWindow) / clientFailures)
+}
+
+func (t *loginThrottle) fail(ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(t.swept) > clientFailureWindow {
+		t.sweep(now)
+	}
+	b := t.refill(ip, now)
+	if b == nil {
+		b = &failures{allowed: clientFailures, refilled: now}
+		t.buckets[ip] = b
+	}
+	b.allowed = max(0, b.allowed-1)
+}
+
+func (t *loginThrottle) refill(ip string, now time.Time) *failures {
+	b, ok := t.buckets[ip]
+	if !ok {
+		return nil
+	}
+	b.allowed = min(clientFailures, b.allowed+now.Sub(b.refilled).Seconds()*clientFailures/clientFailureWindow.Seconds())
+	b.refilled = now
+	return b
+}
+
+// sweep drops the buckets that have filled up again.
+func (t *loginThrottle) sweep(now time.Time) {
+	for ip, b := range t.buckets {
+		if now.Sub(b.refilled) > clientFailureWindow {
+			delete(t.buckets, ip)
+		}
+	}
+	t.swept = now
+}
+
+func intFromEnv(key string, fallback int64) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 1 {
+		slog.Warn("Invalid number, using default", "key", key, "value", value, "default", fallback)
+		return fallback
+	}
+	return n
+}
@@ -0,0 +1,283 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The OpenAPI 3.0 document of the admin API is built from the operations the
+// endpoints are registered with. The schemas of the request and response
+// bodies are derived from their Go types and JSON tags.
+
+type document struct {
+	OpenAPI    string                         `json:"openapi"`
+	Info       info                           `json:"info"`
+	Servers    []server                       `json:"servers"`
+	Paths      map[string]map[string]pathItem `json:"paths"`
+	Components components                     `json:"components"`
+	Security   []map[string][]string          `json:"security"`
+}
+
+type info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type server struct {
+	URL string `json:"url"`
+}
+
+type pathItem struct {
+	Summary     string              `json:"summary,omitempty"`
+	Description string              `json:"description,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Parameters  []parameter         `json:"parameters,omitempty"`
+	RequestBody *requestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]response `json:"responses"`
+	// Security is set to an empty list for public endpoints.
+	Security *[]map[string][]string `json:"security,omitempty"`
+}
+
+type parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *schema `json:"schema"`
+}
+
+type requestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type response struct {
+	Description string               `json:"description"`
+	Content     map[string]mediaType `json:"content,omitempty"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type components struct {
+	Schemas         map[string]*schema        `json:"schemas"`
+	SecuritySchemes map[string]securityScheme `json:"securitySchemes"`
+}
+
+type securityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme,omitempty"`
+	In     string `json:"in,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+type schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	AdditionalProperties *schema            `json:"additionalProperties,omitempty"`
+}
+
+var pathParam = regexp.MustCompile(`\{(\w+)\}`)
+
+func newDocument(operations []registeredOperation) document {
+	schemas := &schemaBuilder{
+		schemas: make(map[string]*schema),
+		names:   make(map[reflect.Type]string),
+	}
+	errorSchema := schemas.of(reflect.TypeOf(ErrorResponse{}))
+
+	doc := document{
+		OpenAPI: "3.0.3",
+		Info:    info{Title: "scimtiplexer admin API", Version: "1"},
+		Servers: []server{{URL: APIPrefix}},
+		Paths:   make(map[string]map[string]pathItem),
+		Components: components{
+			Schemas: schemas.schemas,
+			SecuritySchemes: map[string]securityScheme{
+				"basic":   {Type: "http", Scheme: "basic"},
+				"session": {Type: "apiKey", In: "cookie", Name: sessionCookie},
+			},
+		},
+		Security: []map[string][]string{{"basic": {}}, {"session": {}}},
+	}
+
+	for _, op := range operations {
+		item := pathItem{
+			Summary:     op.Summary,
+			Description: op.Description,
+			Tags:        []string{tag(op.path)},
+			Responses: map[string]response{
+				"default": {
+					Description: "Error",
+					Content:     map[string]mediaType{"application/json": {Schema: errorSchema}},
+				},
+			},
+		}
+		if op.public {
+			item.Security = &[]map[string][]string{}
+		}
+		for _, match := range pathParam.FindAllStringSubmatch(op.path, -1) {
+			item.Parameters = append(item.Parameters, parameter{
+				Name:     match[1],
+				In:       "path",
+				Required: true,
+				Schema:   &schema{Type: "string"},
+			})
+		}
+		for _, q := range op.Query {
+			item.Parameters = append(item.Parameters, parameter{
+				Name:        q.Name,
+				In:          "query",
+				Description: q.Description,
+				Schema:      &schema{Type: "string"},
+			})
+		}
+		if op.Request != nil {
+			item.RequestBody = &requestBody{
+				Required: true,
+				Content:  map[string]mediaType{"application/json": {Schema: schemas.of(reflect.TypeOf(op.Request))}},
+			}
+		}
+
+		status := op.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		resp := response{Description: http.StatusText(status)}
+		if op.Response != nil {
+			resp.Content = map[string]mediaType{"application/json": {Schema: schemas.of(reflect.TypeOf(op.Response))}}
+		}
+		item.Responses[strconv.Itoa(status)] = resp
+
+		if doc.Paths[op.path] == nil {
+			doc.Paths[op.path] = make(map[string]pathItem)
+		}
+		doc.Paths[op.path][strings.ToLower(op.method)] = item
+	}
+	return doc
+}
+
+// tag groups an operation by the resource it's under, the first segment
+// after the organisation.
+func tag(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) > 2 && segments[0] == "orgs" {
+		return segments[2]
+	}
+	return segments[0]
+}
+
+// schemaBuilder derives schemas from Go types. Named struct types become
+// components referenced by name.
+type schemaBuilder struct {
+	schemas map[string]*schema
+	names   map[reflect.Type]string
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+func (b *schemaBuilder) of(t reflect.Type) *schema {
+	switch t {
+	case timeType:
+		return &schema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return b.of(t.Elem())
+	case reflect.String:
+		return &schema{Type: "string"}
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &schema{Type: "array", Items: b.of(t.Elem())}
+	case reflect.Map:
+		return &schema{Type: "object", AdditionalProperties: b.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		return &schema{Ref: "#/components/schemas/" + b.component(t)}
+	}
+	return &schema{}
+}
+
+// component adds a named struct type to the components, prefixing the name
+// with the package when another type already has it.
+func (b *schemaBuilder) component(t reflect.Type) string {
+	if name, ok := b.names[t]; ok {
+		return name
+	}
+
+	name := t.Name()
+	if slices.Contains(b.componentNames(), name) {
+		pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+	b.names[t] = name
+	// Registered before the properties, so recursive types refer to it.
+	b.schemas[name] = &schema{}
+	*b.schemas[name] = *b.object(t)
+	return name
+}
+
+func (b *schemaBuilder) componentNames() []string {
+	names := make([]string, 0, len(b.names))
+	for _, name := range b.names {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (b *schemaBuilder) object(t reflect.Type) *schema {
+	s := &schema{Type: "object", Properties: make(map[string]*schema)}
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() != reflect.Struct {
+				continue
+			}
+			embeddedSchema := b.object(embedded)
+			for k, v := range embeddedSchema.Properties {
+				s.Properties[k] = v
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		s.Properties[name] = b.of(field.Type)
+	}
+	return s
+}
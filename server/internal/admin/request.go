@@ -0,0 +1,110 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+)
+
+// maxRequestBytes is the largest request body the admin API reads.
+const maxRequestBytes = 1 << 20
+
+var errEmptyBody = errors.New("body is required")
+
+// ReadJSON decodes the JSON body of a request into v, which is a pointer to
+// the request type. Unknown fields, values of the wrong type, trailing data
+// and bodies over 1 MiB are rejected with a 400 or 413 describing the
+// problem, and ReadJSON reports whether the body was decoded.
+func ReadJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	return readJSON(w, r, v, false)
+}
+
+// ReadOptionalJSON is ReadJSON for requests whose body may be left out,
+// leaving v as it is when it is.
+func ReadOptionalJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	return readJSON(w, r, v, true)
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any, optional bool) bool {
+	err := decodeJSON(w, r, v)
+	if optional && errors.Is(err, errEmptyBody) {
+		return true
+	}
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			WriteError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body is larger than %d bytes", tooLarge.Limit))
+			return false
+		}
+		WriteError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(v)
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.Is(err, io.EOF):
+		return errEmptyBody
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return fmt.Errorf("body must be %s", kind(typeErr.Type))
+		}
+		return fmt.Errorf("%s must be %s", typeErr.Field, kind(typeErr.Type))
+	case errors.As(err, &syntaxErr):
+		return fmt.Errorf("malformed JSON at offset %d", syntaxErr.Offset)
+	case err != nil:
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return err
+		}
+		// Unknown fields are reported as `json: unknown field "name"`.
+		return errors.New(trimJSONPrefix(err.Error()))
+	}
+
+	if decoder.More() {
+		return errors.New("body must be a single JSON value")
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return errors.New("body must be a single JSON value")
+	}
+	return nil
+}
+
+func trimJSONPrefix(message string) string {
+	const prefix = "json: "
+	if len(message) > len(prefix) && message[:len(prefix)] == prefix {
+		return message[len(prefix):]
+	}
+	return message
+}
+
+// kind names the JSON type a Go type is decoded from.
+func kind(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	}
+	return "an object"
+}
@@ -0,0 +1,314 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/utils"
+)
+
+// Portal sessions are kept in three cookies. The session cookie holds a short
+// lived JWT that authenticates requests, and the refresh cookie a token that
+// is exchanged for a new JWT when it expires. Both are HttpOnly. The CSRF
+// cookie holds the token the portal sends back in the X-CSRF-Token header of
+// requests that change anything, which a cross-site request can't read.
+const (
+	sessionCookie = "scimtiplexer_session"
+	refreshCookie = "scimtiplexer_refresh"
+	csrfCookie    = "scimtiplexer_csrf"
+	csrfHeader    = "X-CSRF-Token"
+
+	// sessionIssuer and sessionAudience are the iss and aud claims of the
+	// session JWTs.
+	sessionIssuer   = "scimtiplexer"
+	sessionAudience = "portal"
+	// accessLifetime is how long a session JWT is valid.
+	accessLifetime = 15 * time.Minute
+	// maxSessionAge is how long a session can be refreshed for, however
+	// active it is.
+	maxSessionAge = 30 * 24 * time.Hour
+	// sweepInterval is how often expired sessions are deleted.
+	sweepInterval = time.Hour
+)
+
+var errSessionExpired = errors.New("session has expired")
+
+// sessionClaims are the claims of the JWT in the session cookie.
+type sessionClaims struct {
+	jwt.RegisteredClaims
+	SessionID string `json:"sid"`
+	CSRFToken string `json:"csrf"`
+}
+
+// session is a started or refreshed portal session.
+type session struct {
+	user         repository.User
+	csrfToken    string
+	expiresOnUtc time.Time
+}
+
+// startSession starts a session for a user that logged in and sets its
+// cookies.
+func (a *Authenticator) startSession(w http.ResponseWriter, r *http.Request, user repository.User) (session, error) {
+	a.sweepSessions(r.Context())
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return session{}, fmt.Errorf("failed to generate UUID for new session: %w", err)
+	}
+	secret, err := utils.RandomToken()
+	if err != nil {
+		return session{}, err
+	}
+	csrfToken, err := utils.RandomToken()
+	if err != nil {
+		return session{}, err
+	}
+
+	now := time.Now().UTC()
+	refreshToken := id.String() + "." + secret
+	expiresOnUtc := now.Add(a.sessionLifetime)
+	err = a.repo.CreatePortalSession(r.Context(), repository.CreatePortalSessionParams{
+		ID:               id.String(),
+		Userid:           user.ID,
+		Refreshtokenhash: utils.HashToken(refreshToken),
+		Csrftoken:        csrfToken,
+		Createdonutc:     now,
+		Refreshedonutc:   now,
+		Expiresonutc:     expiresOnUtc,
+	})
+	if err != nil {
+		return session{}, fmt.Errorf("failed to CreatePortalSession: %w", err)
+	}
+
+	return a.setSessionCookies(w, r, user, id.String(), refreshToken, csrfToken, expiresOnUtc)
+}
+
+// StartSession starts a session for a user that was authenticated some other
+// way than with a password, such as single sign-on, and sets its cookies.
+func (a *Authenticator) StartSession(w http.ResponseWriter, r *http.Request, user repository.User) error {
+	_, err := a.startSession(w, r, user)
+	return err
+}
+
+// refreshSession replaces the refresh token of the session in the refresh
+// cookie and issues a new JWT. A refresh token can only be used once, the
+// session is ended when a replaced one is used again as it has been copied.
+func (a *Authenticator) refreshSession(w http.ResponseWriter, r *http.Request) (session, error) {
+	s, refreshToken, err := a.currentSession(r)
+	if err != nil {
+		return session{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(utils.HashToken(refreshToken)), []byte(s.RefreshTokenHash)) != 1 {
+		slog.Warn("Replaced refresh token used, ending session", "sessionid", s.ID, "userid", s.UserID)
+		a.revokeSession(r.Context(), s.ID)
+		return session{}, errSessionExpired
+	}
+
+	user, err := a.repo.GetUserById(r.Context(), s.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return session{}, errSessionExpired
+		}
+		return session{}, fmt.Errorf("failed to GetUserById: %w", err)
+	}
+
+	secret, err := utils.RandomToken()
+	if err != nil {
+		return session{}, err
+	}
+	now := time.Now().UTC()
+	newRefreshToken := s.ID + "." + secret
+	expiresOnUtc := now.Add(a.sessionLifetime)
+	if limit := s.CreatedOnUtc.Add(maxSessionAge); expiresOnUtc.After(limit) {
+		expiresOnUtc = limit
+	}
+	refreshed, err := a.repo.RefreshPortalSession(r.Context(), repository.RefreshPortalSessionParams{
+		Refreshtokenhash:         utils.HashToken(newRefreshToken),
+		Refreshedonutc:           now,
+		Expiresonutc:             expiresOnUtc,
+		ID:                       s.ID,
+		Previousrefreshtokenhash: s.RefreshTokenHash,
+	})
+	if err != nil {
+		return session{}, fmt.Errorf("failed to RefreshPortalSession: %w", err)
+	}
+	if refreshed == 0 {
+		// Another request refreshed or ended it first.
+		return session{}, errSessionExpired
+	}
+
+	return a.setSessionCookies(w, r, user, s.ID, newRefreshToken, s.CsrfToken, expiresOnUtc)
+}
+
+// endSession ends the session in the refresh cookie, if there is one, and
+// clears the cookies.
+func (a *Authenticator) endSession(w http.ResponseWriter, r *http.Request) error {
+	s, _, err := a.currentSession(r)
+	switch {
+	case err == nil:
+		a.revokeSession(r.Context(), s.ID)
+	case !errors.Is(err, errSessionExpired):
+		return err
+	}
+
+	for _, name := range []string{sessionCookie, refreshCookie, csrfCookie} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Path:     "/",
+			MaxAge:   -1,
+			Secure:   r.TLS != nil,
+			HttpOnly: name != csrfCookie,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+	return nil
+}
+
+// currentSession returns the session in the refresh cookie, checking the
+// CSRF token of the request against it.
+func (a *Authenticator) currentSession(r *http.Request) (repository.PortalSession, string, error) {
+	cookie, err := r.Cookie(refreshCookie)
+	if err != nil {
+		return repository.PortalSession{}, "", errSessionExpired
+	}
+	id, _, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return repository.PortalSession{}, "", errSessionExpired
+	}
+
+	s, err := a.repo.GetPortalSession(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return repository.PortalSession{}, "", errSessionExpired
+		}
+		return repository.PortalSession{}, "", fmt.Errorf("failed to GetPortalSession: %w", err)
+	}
+	if s.RevokedOnUtc.Valid || time.Now().After(s.ExpiresOnUtc) {
+		return repository.PortalSession{}, "", errSessionExpired
+	}
+	if !validCSRFToken(r, s.CsrfToken) {
+		return repository.PortalSession{}, "", errInvalidCSRFToken
+	}
+	return s, cookie.Value, nil
+}
+
+func (a *Authenticator) revokeSession(ctx context.Context, id string) {
+	err := a.repo.RevokePortalSession(ctx, repository.RevokePortalSessionParams{
+		Revokedonutc: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		ID:           id,
+	})
+	if err != nil {
+		slog.Error("RevokePortalSession failed", "error", err, "sessionid", id)
+	}
+}
+
+func (a *Authenticator) setSessionCookies(w http.ResponseWriter, r *http.Request, user repository.User, id, refreshToken, csrfToken string, expiresOnUtc time.Time) (session, error) {
+	now := time.Now().UTC()
+	claims := sessionClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    sessionIssuer,
+			Subject:   user.ID,
+			Audience:  jwt.ClaimStrings{sessionAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(accessLifetime)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		SessionID: id,
+		CSRFToken: csrfToken,
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(a.sessionSecret)
+	if err != nil {
+		return session{}, fmt.Errorf("failed to sign session token: %w", err)
+	}
+
+	// The cookies last as long as the session, an expired JWT is answered
+	// with a 401 the portal refreshes on.
+	for name, value := range map[string]string{sessionCookie: signed, refreshCookie: refreshToken, csrfCookie: csrfToken} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    value,
+			Path:     "/",
+			Expires:  expiresOnUtc,
+			Secure:   r.TLS != nil,
+			HttpOnly: name != csrfCookie,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+
+	return session{user: user, csrfToken: csrfToken, expiresOnUtc: expiresOnUtc}, nil
+}
+
+// verifySession validates the JWT of a session cookie. The session is looked
+// up again so logging out takes effect before the JWT expires.
+func (a *Authenticator) verifySession(ctx context.Context, raw string) (sessionClaims, error) {
+	var claims sessionClaims
+	_, err := jwt.ParseWithClaims(raw, &claims, func(t *jwt.Token) (any, error) {
+		return a.sessionSecret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(sessionIssuer),
+		jwt.WithAudience(sessionAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return sessionClaims{}, fmt.Errorf("%w: %w", errSessionExpired, err)
+	}
+
+	s, err := a.repo.GetPortalSession(ctx, claims.SessionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return sessionClaims{}, errSessionExpired
+		}
+		return sessionClaims{}, fmt.Errorf("failed to GetPortalSession: %w", err)
+	}
+	if s.RevokedOnUtc.Valid || time.Now().After(s.ExpiresOnUtc) || s.UserID != claims.Subject {
+		return sessionClaims{}, errSessionExpired
+	}
+	return claims, nil
+}
+
+// sweepSessions deletes the sessions that expired a while ago, at most once
+// per sweepInterval.
+func (a *Authenticator) sweepSessions(ctx context.Context) {
+	a.mu.Lock()
+	if time.Since(a.swept) < sweepInterval {
+		a.mu.Unlock()
+		return
+	}
+	a.swept = time.Now()
+	a.mu.Unlock()
+
+	deleted, err := a.repo.DeleteExpiredPortalSessions(ctx, time.Now().UTC().Add(-sweepInterval))
+	if err != nil {
+		slog.Error("DeleteExpiredPortalSessions failed", "error", err)
+		return
+	}
+	if deleted > 0 {
+		slog.Info("Deleted expired portal sessions", "sessions", deleted)
+	}
+}
+
+var errInvalidCSRFToken = errors.New("missing or invalid CSRF token")
+
+// validCSRFToken reports whether the request sent the CSRF token of its
+// session in the X-CSRF-Token header.
+func validCSRFToken(r *http.Request, csrfToken string) bool {
+	header := r.Header.Get(csrfHeader)
+	return header != "" && subtle.ConstantTimeCompare([]byte(header), []byte(csrfToken)) == 1
+}
+
+// safeMethod reports whether requests with the method change nothing, and so
+// don't need a CSRF token.
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
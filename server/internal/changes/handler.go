@@ -0,0 +1,216 @@
+// Package changes keeps a log of every change to the users and groups of an
+// organisation and serves it as a feed clients can resume from a cursor.
+package changes
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/admin"
+	"github.com/jawee/scimtiplexer/internal/repository"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+	// maxWait bounds how long a JSON request waits for changes.
+	maxWait = time.Minute
+	// pollInterval is how often the log is checked while waiting.
+	pollInterval = time.Second
+	// heartbeatInterval is how often an idle event stream sends a comment,
+	// so proxies don't close it.
+	heartbeatInterval = 15 * time.Second
+)
+
+type handler struct {
+	service *service
+}
+
+func RegisterEndpoints(api *admin.API, repo repository.Querier) {
+	h := &handler{
+		service: &service{repo: repo},
+	}
+
+	slog.Debug("Registering change feed endpoints")
+	api.Member("GET", "/orgs/{orgId}/changes", h.handleGetChanges, admin.Operation{
+		Summary:     "Get the changes to the users and groups of an organisation",
+		Description: "Served as Server-Sent Events following the log when the client accepts text/event-stream.",
+		Query: []admin.Param{
+			{Name: "since", Description: "Cursor of the last change seen, Last-Event-ID is used when left out"},
+			{Name: "limit", Description: fmt.Sprintf("Maximum number of changes, %d by default", defaultLimit)},
+			{Name: "wait", Description: "Seconds to wait for changes when there are none yet"},
+		},
+		Response: ChangesResponse{},
+	})
+}
+
+// ChangeResponse is a change to a resource. Resource is the resource after
+// the change, and is left out for deletes.
+type ChangeResponse struct {
+	Cursor       string          `json:"cursor"`
+	ResourceType string          `json:"resourceType"`
+	ResourceID   string          `json:"resourceId"`
+	Operation    string          `json:"operation"`
+	Resource     json.RawMessage `json:"resource,omitempty"`
+	CreatedOnUtc time.Time       `json:"createdOnUtc"`
+}
+
+func newChangeResponse(change changeDto) ChangeResponse {
+	return ChangeResponse{
+		Cursor:       formatCursor(change.ID),
+		ResourceType: change.ResourceType,
+		ResourceID:   change.ResourceID,
+		Operation:    change.Operation,
+		Resource:     change.Resource,
+		CreatedOnUtc: change.CreatedOnUtc,
+	}
+}
+
+// ChangesResponse is a page of the feed. Cursor is passed as since to get
+// the changes that follow, it's the cursor of the request if there were none.
+type ChangesResponse struct {
+	Changes []ChangeResponse `json:"changes"`
+	Cursor  string           `json:"cursor"`
+	HasMore bool             `json:"hasMore"`
+}
+
+// handleGetChanges returns the changes after the since cursor, as JSON or,
+// when the client accepts text/event-stream, as Server-Sent Events that
+// follow the log until the client disconnects. JSON requests with a wait in
+// seconds wait that long for changes when there are none yet.
+func (h *handler) handleGetChanges(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	cursor := query.Get("since")
+	if cursor == "" {
+		cursor = r.Header.Get("Last-Event-ID")
+	}
+	since, err := parseCursor(cursor)
+	if err != nil {
+		admin.WriteError(w, http.StatusBadRequest, "Invalid since cursor")
+		return
+	}
+
+	limit := defaultLimit
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxLimit {
+			admin.WriteError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxLimit))
+			return
+		}
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		h.streamChanges(w, r, since, limit)
+		return
+	}
+
+	var wait time.Duration
+	if value := query.Get("wait"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 || time.Duration(seconds)*time.Second > maxWait {
+			admin.WriteError(w, http.StatusBadRequest, fmt.Sprintf("wait must be between 0 and %d seconds", int(maxWait.Seconds())))
+			return
+		}
+		wait = time.Duration(seconds) * time.Second
+	}
+	// A long poll may outlast the write timeout of the server.
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(wait + 10*time.Second))
+
+	organisationId := r.PathValue("orgId")
+	deadline := time.Now().Add(wait)
+	for {
+		changes, err := h.service.GetChanges(r.Context(), organisationId, since, limit+1)
+		if err != nil {
+			slog.Error("Failed to get changes", "error", err)
+			admin.WriteError(w, http.StatusInternalServerError, "Failed to get changes")
+			return
+		}
+		if len(changes) > 0 || !time.Now().Before(deadline) {
+			writeChanges(w, changes, since, limit)
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(min(pollInterval, time.Until(deadline))):
+		}
+	}
+}
+
+func writeChanges(w http.ResponseWriter, changes []changeDto, since int64, limit int) {
+	resp := ChangesResponse{
+		Changes: []ChangeResponse{},
+		Cursor:  formatCursor(since),
+	}
+	if len(changes) > limit {
+		changes = changes[:limit]
+		resp.HasMore = true
+	}
+	for _, change := range changes {
+		resp.Changes = append(resp.Changes, newChangeResponse(change))
+		resp.Cursor = formatCursor(change.ID)
+	}
+	admin.WriteJSON(w, http.StatusOK, resp)
+}
+
+// streamChanges sends the changes after since as change events with the
+// cursor as event id, so a reconnecting client resumes with Last-Event-ID.
+func (h *handler) streamChanges(w http.ResponseWriter, r *http.Request, since int64, limit int) {
+	rc := http.NewResponseController(w)
+	// The stream is open until the client goes away.
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		slog.Error("Failed to flush change stream", "error", err)
+		return
+	}
+
+	organisationId := r.PathValue("orgId")
+	heartbeat := time.Now().Add(heartbeatInterval)
+	for {
+		changes, err := h.service.GetChanges(r.Context(), organisationId, since, limit)
+		if err != nil {
+			if r.Context().Err() == nil {
+				slog.Error("Failed to get changes", "error", err)
+			}
+			return
+		}
+
+		for _, change := range changes {
+			data, _ := json.Marshal(newChangeResponse(change))
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: change\ndata: %s\n\n", formatCursor(change.ID), data); err != nil {
+				return
+			}
+			since = change.ID
+		}
+		if len(changes) == 0 && time.Now().After(heartbeat) {
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if len(changes) > 0 || time.Now().After(heartbeat) {
+			if err := rc.Flush(); err != nil {
+				return
+			}
+			heartbeat = time.Now().Add(heartbeatInterval)
+		}
+		if len(changes) == limit {
+			continue
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(pollInterval):
+		}
+	}
+}
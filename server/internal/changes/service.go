@@ -0,0 +1,97 @@
+package changes
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/target"
+)
+
+// service reads the change log of an organisation.
+type service struct {
+	repo repository.Querier
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+type changeDto struct {
+	ID           int64
+	ResourceType string
+	ResourceID   string
+	Operation    string
+	Resource     json.RawMessage
+	CreatedOnUtc time.Time
+}
+
+func newChangeDto(change repository.ChangeLog) changeDto {
+	dto := changeDto{
+		ID:           change.ID,
+		ResourceType: change.ResourceType,
+		ResourceID:   change.ResourceID,
+		Operation:    change.Operation,
+		CreatedOnUtc: change.CreatedOnUtc,
+	}
+	if change.Resource.Valid {
+		dto.Resource = json.RawMessage(change.Resource.String)
+	}
+	return dto
+}
+
+// Record writes a change to the change log. repo should be bound to the
+// transaction that stores the change, so the log has every committed change
+// and nothing else.
+func Record(ctx context.Context, repo repository.Querier, event target.Event) error {
+	err := repo.CreateChange(ctx, repository.CreateChangeParams{
+		Organisationid: event.OrganisationID,
+		Resourcetype:   event.ResourceType,
+		Resourceid:     event.ResourceID,
+		Operation:      string(event.Operation),
+		Resource:       sql.NullString{String: string(event.Resource), Valid: len(event.Resource) > 0},
+		Createdonutc:   time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to CreateChange: %w", err)
+	}
+	return nil
+}
+
+// GetChanges returns up to limit changes after the cursor, oldest first.
+func (s *service) GetChanges(ctx context.Context, organisationId string, since int64, limit int) ([]changeDto, error) {
+	changes, err := s.repo.GetChangesSince(ctx, repository.GetChangesSinceParams{
+		Organisationid: organisationId,
+		Since:          since,
+		Limit:          int64(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetChangesSince: %w", err)
+	}
+
+	dtos := make([]changeDto, len(changes))
+	for i, change := range changes {
+		dtos[i] = newChangeDto(change)
+	}
+	return dtos, nil
+}
+
+// Cursors are the id of the last change seen. They are opaque to clients,
+// an empty cursor starts at the beginning of the log.
+func formatCursor(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+func parseCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil || id < 0 {
+		return 0, errInvalidCursor
+	}
+	return id, nil
+}
@@ -0,0 +1,131 @@
+package clientcert
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/admin"
+	"github.com/jawee/scimtiplexer/internal/repository"
+)
+
+type handler struct {
+	service *service
+}
+
+func RegisterEndpoints(api *admin.API, repo repository.Querier) {
+	h := &handler{
+		service: &service{repo: repo},
+	}
+
+	slog.Debug("Registering client certificate endpoints")
+	api.Member("GET", "/orgs/{orgId}/client-certificates", h.handleGetMappings, admin.Operation{
+		Summary:  "List the client certificate mappings of an organisation",
+		Response: []MappingResponse{},
+	})
+	api.Member("POST", "/orgs/{orgId}/client-certificates", h.handlePostMapping, admin.Operation{
+		Summary:  "Authenticate SCIM clients with certificates matching a mapping",
+		Request:  MappingRequest{},
+		Response: MappingResponse{},
+		Status:   http.StatusCreated,
+	})
+	api.Member("DELETE", "/orgs/{orgId}/client-certificates/{id}", h.handleDeleteMapping, admin.Operation{
+		Summary: "Delete a client certificate mapping",
+		Status:  http.StatusNoContent,
+	})
+}
+
+type MappingResponse struct {
+	ID            string    `json:"id"`
+	Label         string    `json:"label,omitempty"`
+	CaBundle      string    `json:"caBundle"`
+	MatchType     string    `json:"matchType"`
+	MatchValue    string    `json:"matchValue"`
+	Scopes        []string  `json:"scopes"`
+	CreatedBy     string    `json:"createdBy"`
+	CreatedOnUtc  time.Time `json:"createdOnUtc"`
+	ModifiedOnUtc time.Time `json:"modifiedOnUtc"`
+}
+
+func newMappingResponse(mapping mappingDto) MappingResponse {
+	return MappingResponse{
+		ID:            mapping.ID,
+		Label:         mapping.Label,
+		CaBundle:      mapping.CaBundle,
+		MatchType:     mapping.MatchType,
+		MatchValue:    mapping.MatchValue,
+		Scopes:        mapping.Scopes,
+		CreatedBy:     mapping.CreatedBy,
+		CreatedOnUtc:  mapping.CreatedOnUtc,
+		ModifiedOnUtc: mapping.ModifiedOnUtc,
+	}
+}
+
+// MappingRequest trusts client certificates issued by the CAs in CaBundle
+// whose subject, or DNS, URI or email SAN, equals MatchValue. Leaving out
+// scopes allows all of them.
+type MappingRequest struct {
+	Label      string   `json:"label"`
+	CaBundle   string   `json:"caBundle"`
+	MatchType  string   `json:"matchType"`
+	MatchValue string   `json:"matchValue"`
+	Scopes     []string `json:"scopes"`
+}
+
+func (h *handler) handleGetMappings(w http.ResponseWriter, r *http.Request) {
+	mappings, err := h.service.GetMappings(r.Context(), r.PathValue("orgId"))
+	if err != nil {
+		slog.Error("Failed to get client certificate mappings", "error", err)
+		admin.WriteError(w, http.StatusInternalServerError, "Failed to get client certificate mappings")
+		return
+	}
+
+	resp := make([]MappingResponse, len(mappings))
+	for i, mapping := range mappings {
+		resp[i] = newMappingResponse(mapping)
+	}
+	admin.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (h *handler) handlePostMapping(w http.ResponseWriter, r *http.Request) {
+	var req MappingRequest
+	if !admin.ReadJSON(w, r, &req) {
+		return
+	}
+
+	mapping, err := h.service.CreateMapping(r.Context(), r.PathValue("orgId"), admin.UserID(r.Context()), req)
+	if err != nil {
+		writeServiceError(w, err, "Failed to create client certificate mapping")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusCreated, newMappingResponse(mapping))
+}
+
+func (h *handler) handleDeleteMapping(w http.ResponseWriter, r *http.Request) {
+	err := h.service.DeleteMapping(r.Context(), r.PathValue("orgId"), r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, err, "Failed to delete client certificate mapping")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeServiceError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		admin.WriteError(w, http.StatusNotFound, "Client certificate mapping not found")
+		return
+	case errors.Is(err, errInvalidRequest):
+		admin.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, errConflict):
+		admin.WriteError(w, http.StatusConflict, err.Error())
+		return
+	}
+	slog.Error(message, "error", err)
+	admin.WriteError(w, http.StatusInternalServerError, message)
+}
@@ -0,0 +1,174 @@
+package clientcert
+
+import (
+	"context"
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/token"
+)
+
+// service manages the client certificate mappings of an organisation.
+type service struct {
+	repo repository.Querier
+}
+
+var (
+	errInvalidRequest = errors.New("invalid request")
+	errConflict       = errors.New("conflict")
+)
+
+type mappingDto struct {
+	ID            string
+	Label         string
+	CaBundle      string
+	MatchType     string
+	MatchValue    string
+	Scopes        []string
+	CreatedBy     string
+	CreatedOnUtc  time.Time
+	ModifiedOnUtc time.Time
+}
+
+func newMappingDto(mapping repository.ClientCertificateMapping) mappingDto {
+	return mappingDto{
+		ID:            mapping.ID,
+		Label:         mapping.Label.String,
+		CaBundle:      mapping.CaBundle,
+		MatchType:     mapping.MatchType,
+		MatchValue:    mapping.MatchValue,
+		Scopes:        token.ParseScopes(mapping.Scopes),
+		CreatedBy:     mapping.CreatedBy,
+		CreatedOnUtc:  mapping.CreatedOnUtc,
+		ModifiedOnUtc: mapping.ModifiedOnUtc,
+	}
+}
+
+func (s *service) GetMappings(ctx context.Context, organisationId string) ([]mappingDto, error) {
+	mappings, err := s.repo.GetClientCertificateMappings(ctx, organisationId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetClientCertificateMappings: %w", err)
+	}
+
+	dtos := make([]mappingDto, len(mappings))
+	for i, mapping := range mappings {
+		dtos[i] = newMappingDto(mapping)
+	}
+	return dtos, nil
+}
+
+func (s *service) CreateMapping(ctx context.Context, organisationId, userId string, req MappingRequest) (mappingDto, error) {
+	if err := validateRequest(req); err != nil {
+		return mappingDto{}, fmt.Errorf("%w: %w", errInvalidRequest, err)
+	}
+
+	scopes, err := token.FormatScopes(req.Scopes)
+	if err != nil {
+		return mappingDto{}, fmt.Errorf("%w: %w", errInvalidRequest, err)
+	}
+
+	// CA certificates are public, so the subject or SAN alone decides which
+	// organisation a certificate is mapped to.
+	_, err = s.repo.GetClientCertificateMappingByMatch(ctx, repository.GetClientCertificateMappingByMatchParams{
+		Matchtype:  req.MatchType,
+		Matchvalue: req.MatchValue,
+	})
+	if err == nil {
+		return mappingDto{}, fmt.Errorf("%w: the %s %q is already mapped", errConflict, req.MatchType, req.MatchValue)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return mappingDto{}, fmt.Errorf("failed to GetClientCertificateMappingByMatch: %w", err)
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return mappingDto{}, errors.New("failed to generate UUID for new client certificate mapping")
+	}
+
+	now := time.Now().UTC()
+	_, err = s.repo.CreateClientCertificateMapping(ctx, repository.CreateClientCertificateMappingParams{
+		ID:             id.String(),
+		Organisationid: organisationId,
+		Label:          sql.NullString{String: req.Label, Valid: req.Label != ""},
+		Cabundle:       req.CaBundle,
+		Matchtype:      req.MatchType,
+		Matchvalue:     req.MatchValue,
+		Scopes:         scopes,
+		Createdby:      userId,
+		Createdonutc:   now,
+		Modifiedonutc:  now,
+		Modifiedby:     sql.NullString{String: userId, Valid: true},
+	})
+	if err != nil {
+		return mappingDto{}, fmt.Errorf("failed to CreateClientCertificateMapping: %w", err)
+	}
+
+	mapping, err := s.repo.GetClientCertificateMappingById(ctx, repository.GetClientCertificateMappingByIdParams{
+		ID:             id.String(),
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return mappingDto{}, err
+	}
+	return newMappingDto(mapping), nil
+}
+
+func (s *service) DeleteMapping(ctx context.Context, organisationId, id string) error {
+	_, err := s.repo.GetClientCertificateMappingById(ctx, repository.GetClientCertificateMappingByIdParams{
+		ID:             id,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.DeleteClientCertificateMapping(ctx, repository.DeleteClientCertificateMappingParams{
+		ID:             id,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to DeleteClientCertificateMapping: %w", err)
+	}
+	return nil
+}
+
+func validateRequest(req MappingRequest) error {
+	if !slices.Contains(matchTypes, req.MatchType) {
+		return fmt.Errorf("matchType must be one of %v", matchTypes)
+	}
+	if req.MatchValue == "" {
+		return errors.New("matchValue is required")
+	}
+
+	rest := []byte(req.CaBundle)
+	found := 0
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("caBundle contains an invalid certificate: %w", err)
+		}
+		if !cert.IsCA {
+			return fmt.Errorf("caBundle certificate %q is not a CA", cert.Subject.String())
+		}
+		found++
+	}
+	if found == 0 {
+		return errors.New("caBundle must contain at least one PEM encoded certificate")
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package clientcert
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jawee/scimtiplexer/internal/database/databasetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateMappingRejectsDuplicates(t *testing.T) {
+	s := &service{repo: databasetest.New(t).GetRepository()}
+	req := MappingRequest{CaBundle: newTestCA(t, "Public CA").pem, MatchType: MatchDNS, MatchValue: "provisioner.acme.example"}
+	ctx := context.Background()
+
+	_, err := s.CreateMapping(ctx, "org-1", "admin", req)
+	require.NoError(t, err)
+
+	_, err = s.CreateMapping(ctx, "org-2", "admin", req)
+	assert.ErrorIs(t, err, errConflict, "another organisation can't map the same certificates")
+
+	req.MatchType = MatchSubject
+	_, err = s.CreateMapping(ctx, "org-2", "admin", req)
+	assert.NoError(t, err)
+}
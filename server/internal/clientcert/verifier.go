@@ -0,0 +1,130 @@
+package clientcert
+
+import (
+	"context"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/token"
+)
+
+// Match types of a client certificate mapping.
+const (
+	MatchSubject = "subject"
+	MatchDNS     = "dns"
+	MatchURI     = "uri"
+	MatchEmail   = "email"
+)
+
+var matchTypes = []string{MatchSubject, MatchDNS, MatchURI, MatchEmail}
+
+var ErrUnknownCertificate = errors.New("client certificate is not trusted")
+
+// Verifier maps a TLS client certificate to an organisation using the
+// certificate mappings organisations have registered. Certificates are not
+// verified during the handshake since the trusted CAs differ per
+// organisation, the chain is verified here against the CA bundle of each
+// matching mapping.
+type Verifier struct {
+	repo repository.Querier
+}
+
+func NewVerifier(repo repository.Querier) *Verifier {
+	return &Verifier{repo: repo}
+}
+
+// VerifiedCertificate is the organisation and scopes a client certificate
+// grants.
+type VerifiedCertificate struct {
+	MappingID      string
+	Subject        string
+	OrganisationID string
+	Scopes         []string
+}
+
+// identity is a value of a certificate that a mapping can match on.
+type identity struct {
+	matchType string
+	value     string
+}
+
+func identities(cert *x509.Certificate) []identity {
+	ids := []identity{{MatchSubject, cert.Subject.String()}}
+	if cert.Subject.CommonName != "" && cert.Subject.CommonName != cert.Subject.String() {
+		ids = append(ids, identity{MatchSubject, cert.Subject.CommonName})
+	}
+	for _, dns := range cert.DNSNames {
+		ids = append(ids, identity{MatchDNS, dns})
+	}
+	for _, uri := range cert.URIs {
+		ids = append(ids, identity{MatchURI, uri.String()})
+	}
+	for _, email := range cert.EmailAddresses {
+		ids = append(ids, identity{MatchEmail, email})
+	}
+	return ids
+}
+
+// Verify finds a mapping for the leaf certificate whose CA bundle the chain
+// verifies against. peerCertificates is the chain sent by the client, leaf
+// first. A non-empty organisationId limits the mappings to those of that
+// organisation.
+func (v *Verifier) Verify(ctx context.Context, peerCertificates []*x509.Certificate, organisationId string) (VerifiedCertificate, error) {
+	if len(peerCertificates) == 0 {
+		return VerifiedCertificate{}, ErrUnknownCertificate
+	}
+	leaf := peerCertificates[0]
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range peerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	now := time.Now()
+	for _, id := range identities(leaf) {
+		mapping, err := v.repo.GetClientCertificateMappingByMatch(ctx, repository.GetClientCertificateMappingByMatchParams{
+			Matchtype:  id.matchType,
+			Matchvalue: id.value,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return VerifiedCertificate{}, fmt.Errorf("failed to GetClientCertificateMappingByMatch: %w", err)
+		}
+		if organisationId != "" && mapping.OrganisationID != organisationId {
+			continue
+		}
+
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM([]byte(mapping.CaBundle)) {
+			slog.Error("Client certificate mapping has no usable CA certificates", "mappingid", mapping.ID)
+			continue
+		}
+
+		_, err = leaf.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			CurrentTime:   now,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		if err != nil {
+			slog.Debug("Client certificate does not chain to mapping CA", "mappingid", mapping.ID, "reason", err)
+			continue
+		}
+
+		return VerifiedCertificate{
+			MappingID:      mapping.ID,
+			Subject:        leaf.Subject.String(),
+			OrganisationID: mapping.OrganisationID,
+			Scopes:         token.ParseScopes(mapping.Scopes),
+		}, nil
+	}
+
+	return VerifiedCertificate{}, ErrUnknownCertificate
+}
@@ -0,0 +1,150 @@
+package clientcert
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/database/databasetest"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCA is a certificate authority that issues client certificates.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  string
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+	}
+}
+
+// issue returns a client certificate for commonName and dnsNames. edit
+// changes the template before it is signed.
+func (ca *testCA) issue(t *testing.T, commonName string, dnsNames []string, edit func(*x509.Certificate)) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if edit != nil {
+		edit(template)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func createMapping(t *testing.T, repo repository.Querier, id, organisationId string, ca *testCA, matchType, matchValue string) {
+	now := time.Now().UTC()
+	_, err := repo.CreateClientCertificateMapping(context.Background(), repository.CreateClientCertificateMappingParams{
+		ID:             id,
+		Organisationid: organisationId,
+		Cabundle:       ca.pem,
+		Matchtype:      matchType,
+		Matchvalue:     matchValue,
+		Scopes:         "users:read",
+		Createdby:      "admin",
+		Createdonutc:   now,
+		Modifiedonutc:  now,
+	})
+	require.NoError(t, err)
+}
+
+func TestVerify(t *testing.T) {
+	repo := databasetest.New(t).GetRepository()
+	ca := newTestCA(t, "Acme CA")
+	createMapping(t, repo, "mapping-1", "org-1", ca, MatchDNS, "provisioner.acme.example")
+	v := NewVerifier(repo)
+
+	verified, err := v.Verify(context.Background(), []*x509.Certificate{ca.issue(t, "provisioner", []string{"provisioner.acme.example"}, nil)}, "")
+
+	require.NoError(t, err)
+	assert.Equal(t, VerifiedCertificate{
+		MappingID:      "mapping-1",
+		Subject:        "CN=provisioner",
+		OrganisationID: "org-1",
+		Scopes:         []string{"users:read"},
+	}, verified)
+}
+
+func TestVerifyRejectsCertificates(t *testing.T) {
+	repo := databasetest.New(t).GetRepository()
+	ca := newTestCA(t, "Acme CA")
+	other := newTestCA(t, "Other CA")
+	createMapping(t, repo, "mapping-1", "org-1", ca, MatchSubject, "provisioner")
+	v := NewVerifier(repo)
+
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+	}{
+		{"other CA", other.issue(t, "provisioner", nil, nil)},
+		{"other subject", ca.issue(t, "someone-else", nil, nil)},
+		{"expired", ca.issue(t, "provisioner", nil, func(c *x509.Certificate) { c.NotAfter = time.Now().Add(-time.Minute) })},
+		{"server certificate", ca.issue(t, "provisioner", nil, func(c *x509.Certificate) {
+			c.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.Verify(context.Background(), []*x509.Certificate{tt.cert}, "")
+			assert.ErrorIs(t, err, ErrUnknownCertificate)
+		})
+	}
+}
+
+func TestVerifyOnlyTriesMappingsOfOrganisation(t *testing.T) {
+	repo := databasetest.New(t).GetRepository()
+	ca := newTestCA(t, "Public CA")
+	// Another organisation maps the subject of the certificate, with the
+	// same public CA, before its owner maps the SAN.
+	createMapping(t, repo, "mapping-0", "org-2", ca, MatchSubject, "CN=provisioner")
+	createMapping(t, repo, "mapping-1", "org-1", ca, MatchDNS, "provisioner.acme.example")
+	v := NewVerifier(repo)
+	cert := ca.issue(t, "provisioner", []string{"provisioner.acme.example"}, nil)
+
+	verified, err := v.Verify(context.Background(), []*x509.Certificate{cert}, "org-1")
+	require.NoError(t, err)
+	assert.Equal(t, "mapping-1", verified.MappingID)
+
+	_, err = v.Verify(context.Background(), []*x509.Certificate{cert}, "org-3")
+	assert.ErrorIs(t, err, ErrUnknownCertificate)
+}
@@ -0,0 +1,250 @@
+// Package correlation links the identities different sources provision for
+// the same person to one user. Rules match new users to existing ones with a
+// confidence. Confident matches are linked right away, and ambiguous ones
+// are put in a review queue.
+package correlation
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/admin"
+	"github.com/jawee/scimtiplexer/internal/database"
+	"github.com/jawee/scimtiplexer/internal/repository"
+)
+
+type handler struct {
+	service *service
+}
+
+// RegisterEndpoints registers the rule, review and identity endpoints.
+// Linking and unlinking change users, and are served by the SCIM user
+// package.
+func RegisterEndpoints(api *admin.API, db database.Transactor, repo repository.Querier) {
+	h := &handler{
+		service: &service{repo: repo, db: db},
+	}
+
+	slog.Debug("Registering correlation endpoints")
+	api.Member("GET", "/orgs/{orgId}/correlation-rules", h.handleGetRules, admin.Operation{
+		Summary:  "List the correlation rules of an organisation",
+		Response: []RuleResponse{},
+	})
+	api.Member("POST", "/orgs/{orgId}/correlation-rules", h.handlePostRule, admin.Operation{
+		Summary:  "Create a correlation rule",
+		Request:  RuleRequest{},
+		Response: RuleResponse{},
+		Status:   http.StatusCreated,
+	})
+	api.Member("DELETE", "/orgs/{orgId}/correlation-rules/{id}", h.handleDeleteRule, admin.Operation{
+		Summary: "Delete a correlation rule",
+		Status:  http.StatusNoContent,
+	})
+	api.Member("GET", "/orgs/{orgId}/correlation-reviews", h.handleGetReviews, admin.Operation{
+		Summary:  "List the correlation reviews of an organisation",
+		Query:    []admin.Param{{Name: "status", Description: "Status of the reviews, pending by default"}},
+		Response: []ReviewResponse{},
+	})
+	api.Member("POST", "/orgs/{orgId}/correlation-reviews/{id}/dismiss", h.handleDismissReview, admin.Operation{
+		Summary:  "Dismiss a correlation review, keeping the users apart",
+		Response: ReviewResponse{},
+	})
+	api.Member("GET", "/orgs/{orgId}/users/{id}/identities", h.handleGetIdentities, admin.Operation{
+		Summary:  "List the identities linked to a user",
+		Response: []IdentityResponse{},
+	})
+}
+
+type RuleResponse struct {
+	ID                 string    `json:"id"`
+	Match              string    `json:"match"`
+	BirthDateAttribute string    `json:"birthDateAttribute,omitempty"`
+	Confidence         int       `json:"confidence"`
+	CreatedBy          string    `json:"createdBy"`
+	CreatedOnUtc       time.Time `json:"createdOnUtc"`
+}
+
+func newRuleResponse(rule ruleDto) RuleResponse {
+	return RuleResponse{
+		ID:                 rule.ID,
+		Match:              rule.Match,
+		BirthDateAttribute: rule.BirthDateAttribute,
+		Confidence:         rule.Confidence,
+		CreatedBy:          rule.CreatedBy,
+		CreatedOnUtc:       rule.CreatedOnUtc,
+	}
+}
+
+// RuleRequest creates a rule. Match is externalId, employeeNumber,
+// primaryEmail or nameAndBirthDate, and confidence is between 1 and 100.
+// nameAndBirthDate rules compare the birth date at birthDateAttribute, an
+// extension attribute such as urn:example:params:scim:schemas:extension:hr:2.0:User:birthDate.
+type RuleRequest struct {
+	Match              string `json:"match"`
+	BirthDateAttribute string `json:"birthDateAttribute"`
+	Confidence         int    `json:"confidence"`
+}
+
+// ReviewResponse is a possible match of an identity and an existing user.
+// The identity was created as a user of its own until the review is
+// resolved.
+type ReviewResponse struct {
+	ID              string     `json:"id"`
+	IdentityID      string     `json:"identityId"`
+	CandidateUserID string     `json:"candidateUserId"`
+	Rules           []string   `json:"rules"`
+	Confidence      int        `json:"confidence"`
+	Status          string     `json:"status"`
+	ResolvedBy      string     `json:"resolvedBy,omitempty"`
+	ResolvedOnUtc   *time.Time `json:"resolvedOnUtc,omitempty"`
+	CreatedOnUtc    time.Time  `json:"createdOnUtc"`
+}
+
+func newReviewResponse(review reviewDto) ReviewResponse {
+	return ReviewResponse{
+		ID:              review.ID,
+		IdentityID:      review.IdentityID,
+		CandidateUserID: review.CandidateUserID,
+		Rules:           review.Rules,
+		Confidence:      review.Confidence,
+		Status:          review.Status,
+		ResolvedBy:      review.ResolvedBy,
+		ResolvedOnUtc:   review.ResolvedOnUtc,
+		CreatedOnUtc:    review.CreatedOnUtc,
+	}
+}
+
+// IdentityResponse is an identity a source knows a user by. Rules and
+// confidence are set for identities linked by correlation, and resource is
+// the user as last written by the source.
+type IdentityResponse struct {
+	ID            string          `json:"id"`
+	UserID        string          `json:"userId"`
+	Source        string          `json:"source,omitempty"`
+	Rules         []string        `json:"rules,omitempty"`
+	Confidence    *int            `json:"confidence,omitempty"`
+	Resource      json.RawMessage `json:"resource,omitempty"`
+	CreatedOnUtc  time.Time       `json:"createdOnUtc"`
+	ModifiedOnUtc time.Time       `json:"modifiedOnUtc"`
+}
+
+func newIdentityResponse(identity identityDto) IdentityResponse {
+	return IdentityResponse{
+		ID:            identity.ID,
+		UserID:        identity.UserID,
+		Source:        identity.Source,
+		Rules:         identity.Rules,
+		Confidence:    identity.Confidence,
+		Resource:      identity.Resource,
+		CreatedOnUtc:  identity.CreatedOnUtc,
+		ModifiedOnUtc: identity.ModifiedOnUtc,
+	}
+}
+
+func (h *handler) handleGetRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.service.GetRules(r.Context(), r.PathValue("orgId"))
+	if err != nil {
+		slog.Error("Failed to get correlation rules", "error", err)
+		admin.WriteError(w, http.StatusInternalServerError, "Failed to get correlation rules")
+		return
+	}
+
+	resp := make([]RuleResponse, len(rules))
+	for i, rule := range rules {
+		resp[i] = newRuleResponse(rule)
+	}
+	admin.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (h *handler) handlePostRule(w http.ResponseWriter, r *http.Request) {
+	var req RuleRequest
+	if !admin.ReadJSON(w, r, &req) {
+		return
+	}
+
+	rule, err := h.service.CreateRule(r.Context(), r.PathValue("orgId"), admin.UserID(r.Context()), req)
+	if err != nil {
+		writeServiceError(w, err, "Failed to create correlation rule")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusCreated, newRuleResponse(rule))
+}
+
+func (h *handler) handleDeleteRule(w http.ResponseWriter, r *http.Request) {
+	err := h.service.DeleteRule(r.Context(), r.PathValue("orgId"), r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, err, "Failed to delete correlation rule")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetReviews returns the reviews with the status in the query,
+// pending ones by default.
+func (h *handler) handleGetReviews(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = ReviewPending
+	}
+
+	reviews, err := h.service.GetReviews(r.Context(), r.PathValue("orgId"), status)
+	if err != nil {
+		writeServiceError(w, err, "Failed to get correlation reviews")
+		return
+	}
+
+	resp := make([]ReviewResponse, len(reviews))
+	for i, review := range reviews {
+		resp[i] = newReviewResponse(review)
+	}
+	admin.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (h *handler) handleDismissReview(w http.ResponseWriter, r *http.Request) {
+	review, err := h.service.DismissReview(r.Context(), r.PathValue("orgId"), admin.UserID(r.Context()), r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, err, "Failed to dismiss correlation review")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusOK, newReviewResponse(review))
+}
+
+func (h *handler) handleGetIdentities(w http.ResponseWriter, r *http.Request) {
+	identities, err := h.service.GetIdentities(r.Context(), r.PathValue("orgId"), r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, err, "Failed to get identities")
+		return
+	}
+
+	resp := make([]IdentityResponse, len(identities))
+	for i, identity := range identities {
+		resp[i] = newIdentityResponse(identity)
+	}
+	admin.WriteJSON(w, http.StatusOK, resp)
+}
+
+func writeServiceError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		admin.WriteError(w, http.StatusNotFound, "Not found")
+		return
+	case errors.Is(err, errUserNotFound):
+		admin.WriteError(w, http.StatusNotFound, "User not found")
+		return
+	case errors.Is(err, ErrReviewResolved):
+		admin.WriteError(w, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, errInvalidRequest):
+		admin.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	slog.Error(message, "error", err)
+	admin.WriteError(w, http.StatusInternalServerError, message)
+}
@@ -0,0 +1,303 @@
+package correlation
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/scim/schema"
+)
+
+// What a rule matches new users to existing ones on.
+const (
+	MatchExternalID       = "externalId"
+	MatchEmployeeNumber   = "employeeNumber"
+	MatchPrimaryEmail     = "primaryEmail"
+	MatchNameAndBirthDate = "nameAndBirthDate"
+)
+
+var matches = []string{MatchExternalID, MatchEmployeeNumber, MatchPrimaryEmail, MatchNameAndBirthDate}
+
+// Confidence thresholds. A new user is linked to a candidate from
+// LinkConfidence up when no other candidate is that confident. Otherwise the
+// user is created, and candidates from ReviewConfidence up are put up for
+// review.
+const (
+	LinkConfidence   = 90
+	ReviewConfidence = 50
+)
+
+// Candidate is an existing user that a new user may be the same person as.
+// Confidence combines the confidence of the rules that matched, as the
+// chance that at least one of them is right.
+type Candidate struct {
+	UserID     string
+	Confidence int
+	Rules      []string
+}
+
+// Match returns the users of an organisation that the rules of the
+// organisation match to a new user, most confident first.
+func Match(ctx context.Context, repo repository.Querier, organisationId string, resource json.RawMessage) ([]Candidate, error) {
+	rules, err := repo.GetCorrelationRules(ctx, organisationId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetCorrelationRules: %w", err)
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	var user map[string]any
+	if err := json.Unmarshal(resource, &user); err != nil {
+		return nil, fmt.Errorf("failed to decode user: %w", err)
+	}
+
+	candidates := map[string]*Candidate{}
+	for _, rule := range rules {
+		userIds, err := matchRule(ctx, repo, organisationId, rule, user)
+		if err != nil {
+			return nil, err
+		}
+		for _, userId := range userIds {
+			c, ok := candidates[userId]
+			if !ok {
+				c = &Candidate{UserID: userId}
+				candidates[userId] = c
+			}
+			c.Confidence = 100 - (100-c.Confidence)*(100-int(rule.Confidence))/100
+			if !slices.Contains(c.Rules, rule.Match) {
+				c.Rules = append(c.Rules, rule.Match)
+			}
+		}
+	}
+
+	result := make([]Candidate, 0, len(candidates))
+	for _, c := range candidates {
+		result = append(result, *c)
+	}
+	slices.SortFunc(result, func(a, b Candidate) int {
+		return cmp.Or(cmp.Compare(b.Confidence, a.Confidence), cmp.Compare(a.UserID, b.UserID))
+	})
+	return result, nil
+}
+
+// Decide returns the candidate to link a new user to, or the candidates to
+// put up for review when there is none.
+func Decide(candidates []Candidate) (*Candidate, []Candidate) {
+	var confident, review []Candidate
+	for _, c := range candidates {
+		if c.Confidence >= LinkConfidence {
+			confident = append(confident, c)
+		}
+		if c.Confidence >= ReviewConfidence {
+			review = append(review, c)
+		}
+	}
+	if len(confident) == 1 {
+		return &confident[0], nil
+	}
+	return nil, review
+}
+
+// matchRule returns the ids of the users a rule matches. Rules match nothing
+// when the new user lacks the attributes they compare.
+func matchRule(ctx context.Context, repo repository.Querier, organisationId string, rule repository.CorrelationRule, user map[string]any) ([]string, error) {
+	var users []repository.ScimUser
+	var err error
+	switch rule.Match {
+	case MatchExternalID:
+		externalId := stringValue(lookup(user, "externalId"))
+		if externalId == "" {
+			return nil, nil
+		}
+		users, err = repo.GetScimUsersByExternalId(ctx, repository.GetScimUsersByExternalIdParams{
+			Organisationid: organisationId,
+			Externalid:     sql.NullString{String: externalId, Valid: true},
+		})
+	case MatchEmployeeNumber:
+		employeeNumber := stringValue(lookup(lookup(user, schema.EnterpriseUser), "employeeNumber"))
+		if employeeNumber == "" {
+			return nil, nil
+		}
+		users, err = repo.GetScimUsersByEmployeeNumber(ctx, repository.GetScimUsersByEmployeeNumberParams{
+			Organisationid: organisationId,
+			Employeenumber: sql.NullString{String: employeeNumber, Valid: true},
+		})
+	case MatchPrimaryEmail:
+		email := primaryEmail(user)
+		if email == "" {
+			return nil, nil
+		}
+		users, err = repo.GetScimUsersByPrimaryEmail(ctx, repository.GetScimUsersByPrimaryEmailParams{
+			Organisationid: organisationId,
+			Email:          email,
+		})
+	case MatchNameAndBirthDate:
+		return matchNameAndBirthDate(ctx, repo, organisationId, rule.BirthDateAttribute.String, user)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to match %s: %w", rule.Match, err)
+	}
+
+	ids := make([]string, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+	return ids, nil
+}
+
+// matchNameAndBirthDate looks up the identities with the name and birth date
+// of the new user, as birth dates are only kept in what sources have written.
+func matchNameAndBirthDate(ctx context.Context, repo repository.Querier, organisationId, attribute string, user map[string]any) ([]string, error) {
+	keys := keysOf(user, attribute)
+	if !keys.NormalisedName.Valid || !keys.BirthDate.Valid {
+		return nil, nil
+	}
+
+	identities, err := repo.GetUserIdentitiesByNameAndBirthDate(ctx, repository.GetUserIdentitiesByNameAndBirthDateParams{
+		Organisationid: organisationId,
+		Normalisedname: keys.NormalisedName,
+		Birthdate:      keys.BirthDate,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetUserIdentitiesByNameAndBirthDate: %w", err)
+	}
+
+	var ids []string
+	for _, identity := range identities {
+		if !slices.Contains(ids, identity.UserID) {
+			ids = append(ids, identity.UserID)
+		}
+	}
+	return ids, nil
+}
+
+// Keys are the values of an identity that nameAndBirthDate rules compare,
+// stored with the identity to look it up by.
+type Keys struct {
+	NormalisedName sql.NullString
+	BirthDate      sql.NullString
+}
+
+// KeysOf returns the keys of a resource a source wrote. The birth date is
+// read from attribute, the birth date attribute of the nameAndBirthDate rule
+// of the organisation.
+func KeysOf(resource json.RawMessage, attribute string) Keys {
+	var user map[string]any
+	if err := json.Unmarshal(resource, &user); err != nil {
+		return Keys{}
+	}
+	return keysOf(user, attribute)
+}
+
+func keysOf(user map[string]any, attribute string) Keys {
+	name, birthDate := normaliseName(user), birthDateOf(user, attribute)
+	return Keys{
+		NormalisedName: sql.NullString{String: name, Valid: name != ""},
+		BirthDate:      sql.NullString{String: birthDate, Valid: birthDate != ""},
+	}
+}
+
+// LoadKeys returns the keys of a resource a source writes to an
+// organisation.
+func LoadKeys(ctx context.Context, repo repository.Querier, organisationId string, resource json.RawMessage) (Keys, error) {
+	attribute, err := birthDateAttribute(ctx, repo, organisationId)
+	if err != nil {
+		return Keys{}, err
+	}
+	return KeysOf(resource, attribute), nil
+}
+
+// birthDateAttribute returns the birth date attribute of the
+// nameAndBirthDate rule of an organisation, empty without one.
+func birthDateAttribute(ctx context.Context, repo repository.Querier, organisationId string) (string, error) {
+	rules, err := repo.GetCorrelationRules(ctx, organisationId)
+	if err != nil {
+		return "", fmt.Errorf("failed to GetCorrelationRules: %w", err)
+	}
+	for _, rule := range rules {
+		if rule.Match == MatchNameAndBirthDate {
+			return rule.BirthDateAttribute.String, nil
+		}
+	}
+	return "", nil
+}
+
+// ValidateBirthDateAttribute checks that an attribute is an extension
+// attribute, the schema URN followed by a colon and the attribute name.
+func ValidateBirthDateAttribute(attribute string) error {
+	i := strings.LastIndex(attribute, ":")
+	if !strings.HasPrefix(attribute, "urn:") || i < 0 || i == len(attribute)-1 {
+		return fmt.Errorf("invalid birthDateAttribute %q, must be an extension schema URN and attribute name", attribute)
+	}
+	return nil
+}
+
+func birthDateOf(user map[string]any, attribute string) string {
+	i := strings.LastIndex(attribute, ":")
+	if i < 0 {
+		return ""
+	}
+	value := strings.TrimSpace(stringValue(lookup(lookup(user, attribute[:i]), attribute[i+1:])))
+	// Dates may come with a time, only the day is compared.
+	if len(value) > 10 && value[10] == 'T' {
+		value = value[:10]
+	}
+	return value
+}
+
+// normaliseName returns the given and family name, or the formatted name,
+// lower case with everything but letters and digits collapsed to spaces.
+func normaliseName(user map[string]any) string {
+	name := lookup(user, "name")
+	full := stringValue(lookup(name, "givenName")) + " " + stringValue(lookup(name, "familyName"))
+	if strings.TrimSpace(full) == "" {
+		full = stringValue(lookup(name, "formatted"))
+	}
+	return strings.Join(strings.FieldsFunc(strings.ToLower(full), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// primaryEmail returns the primary email of a user, or its only email.
+func primaryEmail(user map[string]any) string {
+	emails, _ := lookup(user, "emails").([]any)
+	for _, email := range emails {
+		if primary, _ := lookup(email, "primary").(bool); primary {
+			return stringValue(lookup(email, "value"))
+		}
+	}
+	if len(emails) == 1 {
+		return stringValue(lookup(emails[0], "value"))
+	}
+	return ""
+}
+
+// lookup returns an attribute of an object, matching the name case
+// insensitively as SCIM does.
+func lookup(value any, name string) any {
+	object, ok := value.(map[string]any)
+	if !ok {
+		return nil
+	}
+	if v, ok := object[name]; ok {
+		return v
+	}
+	for key, v := range object {
+		if strings.EqualFold(key, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+func stringValue(value any) string {
+	s, _ := value.(string)
+	return s
+}
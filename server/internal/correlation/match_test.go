@@ -0,0 +1,72 @@
+package correlation_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/correlation"
+	"github.com/jawee/scimtiplexer/internal/database/databasetest"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const birthDateAttribute = "urn:example:params:scim:schemas:extension:hr:2.0:User:birthDate"
+
+func createIdentity(t *testing.T, repo repository.Querier, id, userId, resource string) {
+	ctx := context.Background()
+	keys, err := correlation.LoadKeys(ctx, repo, "org-1", json.RawMessage(resource))
+	require.NoError(t, err)
+	now := time.Now().UTC()
+	err = repo.CreateUserIdentity(ctx, repository.CreateUserIdentityParams{
+		ID:             id,
+		Organisationid: "org-1",
+		Userid:         userId,
+		Resource:       sql.NullString{String: resource, Valid: true},
+		Normalisedname: keys.NormalisedName,
+		Birthdate:      keys.BirthDate,
+		Createdonutc:   now,
+		Modifiedonutc:  now,
+	})
+	require.NoError(t, err)
+}
+
+func TestKeysOf(t *testing.T) {
+	keys := correlation.KeysOf(json.RawMessage(`{
+		"name": {"givenName": "Anna-Karin", "familyName": " Öberg "},
+		"urn:example:params:scim:schemas:extension:hr:2.0:User": {"birthDate": "1980-02-03T00:00:00Z"}}`), birthDateAttribute)
+
+	assert.Equal(t, sql.NullString{String: "anna karin öberg", Valid: true}, keys.NormalisedName)
+	assert.Equal(t, sql.NullString{String: "1980-02-03", Valid: true}, keys.BirthDate)
+	assert.Equal(t, correlation.Keys{}, correlation.KeysOf(json.RawMessage(`{"userName": "alice"}`), birthDateAttribute))
+}
+
+func TestMatchNameAndBirthDate(t *testing.T) {
+	repo := databasetest.New(t).GetRepository()
+	ctx := context.Background()
+	err := repo.CreateCorrelationRule(ctx, repository.CreateCorrelationRuleParams{
+		ID:                 "rule-1",
+		Organisationid:     "org-1",
+		Match:              correlation.MatchNameAndBirthDate,
+		Birthdateattribute: sql.NullString{String: birthDateAttribute, Valid: true},
+		Confidence:         60,
+		Createdby:          "admin",
+		Createdonutc:       time.Now().UTC(),
+	})
+	require.NoError(t, err)
+	createIdentity(t, repo, "alice", "alice", `{"name": {"givenName": "Alice", "familyName": "Smith"}, "urn:example:params:scim:schemas:extension:hr:2.0:User": {"birthDate": "1980-02-03"}}`)
+	createIdentity(t, repo, "alice-crm", "alice", `{"name": {"formatted": "alice smith"}, "urn:example:params:scim:schemas:extension:hr:2.0:User": {"birthDate": "1980-02-03"}}`)
+	createIdentity(t, repo, "alice-2", "alice-2", `{"name": {"givenName": "Alice", "familyName": "Smith"}, "urn:example:params:scim:schemas:extension:hr:2.0:User": {"birthDate": "1990-05-06"}}`)
+
+	candidates, err := correlation.Match(ctx, repo, "org-1", json.RawMessage(`{"name": {"givenName": "ALICE", "familyName": "smith"}, "urn:example:params:scim:schemas:extension:hr:2.0:User": {"birthDate": "1980-02-03"}}`))
+
+	require.NoError(t, err)
+	assert.Equal(t, []correlation.Candidate{{UserID: "alice", Confidence: 60, Rules: []string{correlation.MatchNameAndBirthDate}}}, candidates)
+
+	candidates, err = correlation.Match(ctx, repo, "org-1", json.RawMessage(`{"name": {"givenName": "Alice", "familyName": "Smith"}}`))
+	require.NoError(t, err)
+	assert.Empty(t, candidates, "nothing matches without a birth date")
+}
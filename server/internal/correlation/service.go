@@ -0,0 +1,365 @@
+package correlation
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jawee/scimtiplexer/internal/database"
+	"github.com/jawee/scimtiplexer/internal/repository"
+)
+
+type service struct {
+	repo repository.Querier
+	db   database.Transactor
+}
+
+var (
+	errInvalidRequest = errors.New("invalid request")
+	errUserNotFound   = errors.New("user not found")
+)
+
+// Statuses of a review.
+const (
+	ReviewPending   = "pending"
+	ReviewLinked    = "linked"
+	ReviewDismissed = "dismissed"
+)
+
+type ruleDto struct {
+	ID                 string
+	Match              string
+	BirthDateAttribute string
+	Confidence         int
+	CreatedBy          string
+	CreatedOnUtc       time.Time
+}
+
+func newRuleDto(rule repository.CorrelationRule) ruleDto {
+	return ruleDto{
+		ID:                 rule.ID,
+		Match:              rule.Match,
+		BirthDateAttribute: rule.BirthDateAttribute.String,
+		Confidence:         int(rule.Confidence),
+		CreatedBy:          rule.CreatedBy,
+		CreatedOnUtc:       rule.CreatedOnUtc,
+	}
+}
+
+type reviewDto struct {
+	ID              string
+	IdentityID      string
+	CandidateUserID string
+	Rules           []string
+	Confidence      int
+	Status          string
+	ResolvedBy      string
+	ResolvedOnUtc   *time.Time
+	CreatedOnUtc    time.Time
+}
+
+func newReviewDto(review repository.CorrelationReview) reviewDto {
+	dto := reviewDto{
+		ID:              review.ID,
+		IdentityID:      review.IdentityID,
+		CandidateUserID: review.CandidateUserID,
+		Rules:           strings.Fields(review.Rules),
+		Confidence:      int(review.Confidence),
+		Status:          review.Status,
+		ResolvedBy:      review.ResolvedBy.String,
+		CreatedOnUtc:    review.CreatedOnUtc,
+	}
+	if review.ResolvedOnUtc.Valid {
+		dto.ResolvedOnUtc = &review.ResolvedOnUtc.Time
+	}
+	return dto
+}
+
+type identityDto struct {
+	ID            string
+	UserID        string
+	Source        string
+	Rules         []string
+	Confidence    *int
+	Resource      json.RawMessage
+	CreatedOnUtc  time.Time
+	ModifiedOnUtc time.Time
+}
+
+func newIdentityDto(identity repository.ScimUserIdentity) identityDto {
+	dto := identityDto{
+		ID:            identity.ID,
+		UserID:        identity.UserID,
+		Source:        identity.Source.String,
+		Rules:         strings.Fields(identity.Rules.String),
+		CreatedOnUtc:  identity.CreatedOnUtc,
+		ModifiedOnUtc: identity.ModifiedOnUtc,
+	}
+	if identity.Confidence.Valid {
+		confidence := int(identity.Confidence.Int64)
+		dto.Confidence = &confidence
+	}
+	if identity.Resource.Valid {
+		dto.Resource = json.RawMessage(identity.Resource.String)
+	}
+	return dto
+}
+
+func (s *service) GetRules(ctx context.Context, organisationId string) ([]ruleDto, error) {
+	rules, err := s.repo.GetCorrelationRules(ctx, organisationId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetCorrelationRules: %w", err)
+	}
+
+	dtos := make([]ruleDto, len(rules))
+	for i, rule := range rules {
+		dtos[i] = newRuleDto(rule)
+	}
+	return dtos, nil
+}
+
+func (s *service) CreateRule(ctx context.Context, organisationId, userId string, req RuleRequest) (ruleDto, error) {
+	if !slices.Contains(matches, req.Match) {
+		return ruleDto{}, fmt.Errorf("%w: match must be one of %s", errInvalidRequest, strings.Join(matches, ", "))
+	}
+	if req.Confidence < 1 || req.Confidence > 100 {
+		return ruleDto{}, fmt.Errorf("%w: confidence must be between 1 and 100", errInvalidRequest)
+	}
+	if req.Match == MatchNameAndBirthDate {
+		if err := ValidateBirthDateAttribute(req.BirthDateAttribute); err != nil {
+			return ruleDto{}, fmt.Errorf("%w: %w", errInvalidRequest, err)
+		}
+	} else if req.BirthDateAttribute != "" {
+		return ruleDto{}, fmt.Errorf("%w: birthDateAttribute is only used by %s rules", errInvalidRequest, MatchNameAndBirthDate)
+	}
+
+	ruleId, err := uuid.NewV7()
+	if err != nil {
+		return ruleDto{}, errors.New("failed to generate UUID for new rule")
+	}
+
+	err = s.db.WithTx(ctx, func(repo repository.Querier) error {
+		if req.Match == MatchNameAndBirthDate {
+			if err := storeBirthDates(ctx, repo, organisationId, req.BirthDateAttribute); err != nil {
+				return err
+			}
+		}
+
+		err := repo.CreateCorrelationRule(ctx, repository.CreateCorrelationRuleParams{
+			ID:                 ruleId.String(),
+			Organisationid:     organisationId,
+			Match:              req.Match,
+			Birthdateattribute: sql.NullString{String: req.BirthDateAttribute, Valid: req.BirthDateAttribute != ""},
+			Confidence:         int64(req.Confidence),
+			Createdby:          userId,
+			Createdonutc:       time.Now().UTC(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to CreateCorrelationRule: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return ruleDto{}, err
+	}
+
+	rule, err := s.repo.GetCorrelationRuleById(ctx, repository.GetCorrelationRuleByIdParams{
+		ID:             ruleId.String(),
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return ruleDto{}, fmt.Errorf("failed to GetCorrelationRuleById: %w", err)
+	}
+	return newRuleDto(rule), nil
+}
+
+// storeBirthDates stores the birth dates of the identities of an
+// organisation from the attribute of a new nameAndBirthDate rule. The birth
+// dates are read from one attribute, so the rules of an organisation must
+// agree on it.
+func storeBirthDates(ctx context.Context, repo repository.Querier, organisationId, attribute string) error {
+	current, err := birthDateAttribute(ctx, repo, organisationId)
+	if err != nil {
+		return err
+	}
+	if current == attribute {
+		return nil
+	}
+	if current != "" {
+		return fmt.Errorf("%w: the %s rules of an organisation must use the same birthDateAttribute, %s", errInvalidRequest, MatchNameAndBirthDate, current)
+	}
+
+	identities, err := repo.GetOrganisationUserIdentities(ctx, organisationId)
+	if err != nil {
+		return fmt.Errorf("failed to GetOrganisationUserIdentities: %w", err)
+	}
+	for _, identity := range identities {
+		err := repo.UpdateUserIdentityBirthDate(ctx, repository.UpdateUserIdentityBirthDateParams{
+			Birthdate: KeysOf(json.RawMessage(identity.Resource.String), attribute).BirthDate,
+			ID:        identity.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to UpdateUserIdentityBirthDate: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *service) DeleteRule(ctx context.Context, organisationId, id string) error {
+	_, err := s.repo.GetCorrelationRuleById(ctx, repository.GetCorrelationRuleByIdParams{
+		ID:             id,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.DeleteCorrelationRule(ctx, repository.DeleteCorrelationRuleParams{
+		ID:             id,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to DeleteCorrelationRule: %w", err)
+	}
+	return nil
+}
+
+func (s *service) GetReviews(ctx context.Context, organisationId, status string) ([]reviewDto, error) {
+	if !slices.Contains([]string{ReviewPending, ReviewLinked, ReviewDismissed}, status) {
+		return nil, fmt.Errorf("%w: status must be pending, linked or dismissed", errInvalidRequest)
+	}
+
+	reviews, err := s.repo.GetCorrelationReviews(ctx, repository.GetCorrelationReviewsParams{
+		Organisationid: organisationId,
+		Status:         status,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetCorrelationReviews: %w", err)
+	}
+
+	dtos := make([]reviewDto, len(reviews))
+	for i, review := range reviews {
+		dtos[i] = newReviewDto(review)
+	}
+	return dtos, nil
+}
+
+// DismissReview keeps the identity of a review apart from the candidate.
+func (s *service) DismissReview(ctx context.Context, organisationId, userId, id string) (reviewDto, error) {
+	review, err := GetPendingReview(ctx, s.repo, organisationId, id)
+	if err != nil {
+		return reviewDto{}, err
+	}
+
+	if err := ResolveReview(ctx, s.repo, review.ID, ReviewDismissed, userId); err != nil {
+		return reviewDto{}, err
+	}
+	return s.getReview(ctx, organisationId, id)
+}
+
+func (s *service) getReview(ctx context.Context, organisationId, id string) (reviewDto, error) {
+	review, err := s.repo.GetCorrelationReviewById(ctx, repository.GetCorrelationReviewByIdParams{
+		ID:             id,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return reviewDto{}, err
+	}
+	return newReviewDto(review), nil
+}
+
+// GetIdentities returns the identities linked to a user, the one that
+// created it first.
+func (s *service) GetIdentities(ctx context.Context, organisationId, userId string) ([]identityDto, error) {
+	_, err := s.repo.GetScimUserById(ctx, repository.GetScimUserByIdParams{
+		Organisationid: organisationId,
+		ID:             userId,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errUserNotFound
+		}
+		return nil, fmt.Errorf("failed to GetScimUserById: %w", err)
+	}
+
+	identities, err := s.repo.GetUserIdentities(ctx, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetUserIdentities: %w", err)
+	}
+
+	dtos := make([]identityDto, len(identities))
+	for i, identity := range identities {
+		dtos[i] = newIdentityDto(identity)
+	}
+	slices.SortStableFunc(dtos, func(a, b identityDto) int {
+		if a.ID == userId {
+			return -1
+		}
+		if b.ID == userId {
+			return 1
+		}
+		return 0
+	})
+	return dtos, nil
+}
+
+// ErrReviewResolved is returned for reviews that are no longer pending.
+var ErrReviewResolved = errors.New("review is already resolved")
+
+// GetPendingReview returns a review that is waiting for a decision.
+func GetPendingReview(ctx context.Context, repo repository.Querier, organisationId, id string) (repository.CorrelationReview, error) {
+	review, err := repo.GetCorrelationReviewById(ctx, repository.GetCorrelationReviewByIdParams{
+		ID:             id,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return repository.CorrelationReview{}, err
+	}
+	if review.Status != ReviewPending {
+		return repository.CorrelationReview{}, ErrReviewResolved
+	}
+	return review, nil
+}
+
+// ResolveReview records the decision on a review.
+func ResolveReview(ctx context.Context, repo repository.Querier, id, status, userId string) error {
+	err := repo.ResolveCorrelationReview(ctx, repository.ResolveCorrelationReviewParams{
+		Status:        status,
+		Resolvedby:    sql.NullString{String: userId, Valid: userId != ""},
+		Resolvedonutc: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		ID:            id,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to ResolveCorrelationReview: %w", err)
+	}
+	return nil
+}
+
+// CreateReviews puts the candidates for an identity up for review.
+func CreateReviews(ctx context.Context, repo repository.Querier, organisationId, identityId string, candidates []Candidate) error {
+	for _, c := range candidates {
+		reviewId, err := uuid.NewV7()
+		if err != nil {
+			return errors.New("failed to generate UUID for new review")
+		}
+		err = repo.CreateCorrelationReview(ctx, repository.CreateCorrelationReviewParams{
+			ID:              reviewId.String(),
+			Organisationid:  organisationId,
+			Identityid:      identityId,
+			Candidateuserid: c.UserID,
+			Rules:           strings.Join(c.Rules, " "),
+			Confidence:      int64(c.Confidence),
+			Createdonutc:    time.Now().UTC(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to CreateCorrelationReview: %w", err)
+		}
+	}
+	return nil
+}
@@ -3,10 +3,12 @@ package database
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/jawee/scimtiplexer/internal/repository"
@@ -25,11 +27,26 @@ type Service interface {
 	Close() error
 
 	GetRepository() repository.Querier
+
+	// WithForeignKeys runs fn with a repository bound to a connection that
+	// enforces foreign keys, so deletes cascade as the schema declares. The
+	// other connections don't enforce them.
+	WithForeignKeys(ctx context.Context, fn func(repo repository.Querier) error) error
+
+	Transactor
+}
+
+// Transactor runs functions in a database transaction.
+type Transactor interface {
+	// WithTx runs fn with a repository bound to a transaction. The transaction
+	// is committed when fn returns nil and rolled back otherwise.
+	WithTx(ctx context.Context, fn func(repo repository.Querier) error) error
 }
 
 type service struct {
 	db *sql.DB
 	repo repository.Querier
+	dsn  string
 }
 
 var (
@@ -43,24 +60,102 @@ func New() Service {
 		return dbInstance
 	}
 
-	db, err := sql.Open("sqlite3", dburl)
+	s, err := open(dburl)
 	if err != nil {
 		// This will not be a connection error, but a DSN parse error or
 		// another initialization error.
 		log.Fatal(err)
 	}
 
-	dbInstance = &service{
+	dbInstance = s
+	return dbInstance
+}
+
+// Open opens the database at dsn. The server uses New, which opens the
+// database at DB_URL once.
+func Open(dsn string) (Service, error) {
+	return open(dsn)
+}
+
+// sqliteDefaults are added to every DSN that doesn't set them. The handlers
+// and the dispatcher workers write concurrently, so writers wait up to five
+// seconds for the lock instead of failing with "database is locked".
+// Transactions take the write lock when they begin: a deferred transaction
+// that reads before it writes can't wait when upgrading its lock.
+var sqliteDefaults = []string{"_busy_timeout=5000", "_txlock=immediate"}
+
+// dsnWithDefaults adds the sqliteDefaults that dsn doesn't set.
+func dsnWithDefaults(dsn string) string {
+	_, query, _ := strings.Cut(dsn, "?")
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	for _, param := range sqliteDefaults {
+		key, _, _ := strings.Cut(param, "=")
+		if strings.HasPrefix(query, key+"=") || strings.Contains(query, "&"+key+"=") {
+			continue
+		}
+		dsn += separator + param
+		separator = "&"
+	}
+	return dsn
+}
+
+func open(dsn string) (*service, error) {
+	db, err := sql.Open("sqlite3", dsnWithDefaults(dsn))
+	if err != nil {
+		return nil, err
+	}
+
+	return &service{
 		db:   db,
 		repo: repository.New(db),
-	}
-	return dbInstance
+		dsn:  dsn,
+	}, nil
 }
 
 func (s *service) GetRepository() repository.Querier {
 	return s.repo
 }
 
+func (s *service) WithTx(ctx context.Context, fn func(repo repository.Querier) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err := fn(repository.New(tx)); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (s *service) WithForeignKeys(ctx context.Context, fn func(repo repository.Querier) error) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	// The connection is discarded afterwards rather than returned to the
+	// pool with foreign keys enforced.
+	defer func() {
+		conn.Raw(func(any) error { return driver.ErrBadConn })
+		conn.Close()
+	}()
+
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = ON"); err != nil {
+		return fmt.Errorf("failed to enable foreign keys: %w", err)
+	}
+	return fn(repository.New(conn))
+}
+
 // Health checks the health of the database connection by pinging the database.
 // It returns a map with keys indicating various health statistics.
 func (s *service) Health() map[string]string {
@@ -117,6 +212,6 @@ func (s *service) Health() map[string]string {
 // If the connection is successfully closed, it returns nil.
 // If an error occurs while closing the connection, it returns the error.
 func (s *service) Close() error {
-	log.Printf("Disconnected from database: %s", dburl)
+	log.Printf("Disconnected from database: %s", s.dsn)
 	return s.db.Close()
 }
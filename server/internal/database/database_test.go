@@ -0,0 +1,61 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/database/databasetest"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func change(id string) repository.CreateChangeParams {
+	return repository.CreateChangeParams{
+		Organisationid: "org-1",
+		Resourcetype:   "User",
+		Resourceid:     id,
+		Operation:      "create",
+		Resource:       sql.NullString{String: "{}", Valid: true},
+		Createdonutc:   time.Now().UTC(),
+	}
+}
+
+// TestConcurrentWrites writes from transactions and single statements at the
+// same time, as the dispatcher workers and the SCIM handlers do.
+func TestConcurrentWrites(t *testing.T) {
+	db := databasetest.New(t)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for range 50 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			// Reads before it writes, as the SCIM handlers do.
+			errs <- db.WithTx(ctx, func(repo repository.Querier) error {
+				if _, err := repo.GetEnabledTargets(ctx, "org-1"); err != nil {
+					return err
+				}
+				return repo.CreateChange(ctx, change("tx"))
+			})
+		}()
+		go func() {
+			defer wg.Done()
+			errs <- db.GetRepository().CreateChange(ctx, change("single"))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	changes, err := db.GetRepository().GetChangesSince(ctx, repository.GetChangesSinceParams{Organisationid: "org-1", Limit: 1000})
+	require.NoError(t, err)
+	assert.Len(t, changes, 100)
+}
@@ -0,0 +1,38 @@
+// Package databasetest creates databases for tests.
+package databasetest
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/jawee/scimtiplexer/cmd/goose/migrations"
+	"github.com/jawee/scimtiplexer/internal/database"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pressly/goose/v3"
+)
+
+// New returns a database with every migration applied. It lives in the
+// temporary directory of the test and is closed when the test ends.
+func New(t testing.TB) database.Service {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	goose.SetLogger(goose.NopLogger())
+	err = migrations.Up(db)
+	db.Close()
+	if err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	s, err := database.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
@@ -0,0 +1,50 @@
+package databasetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password is the password of the portal users created by CreateMember.
+const Password = "correct horse battery staple"
+
+// CreateMember creates a portal user with Password who has role in
+// organisationId, and returns the id of the user.
+func CreateMember(t testing.TB, repo repository.Querier, username, organisationId, role string) string {
+	t.Helper()
+	ctx := context.Background()
+	hash, err := bcrypt.GenerateFromPassword([]byte(Password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+
+	now := time.Now().UTC()
+	id := uuid.NewString()
+	_, err = repo.RegisterUser(ctx, repository.RegisterUserParams{
+		ID:            id,
+		Username:      username,
+		Email:         username + "@example.com",
+		Password:      string(hash),
+		Createdonutc:  now,
+		Modifiedonutc: now,
+	})
+	if err != nil {
+		t.Fatalf("failed to RegisterUser: %v", err)
+	}
+	err = repo.CreateOrganisationUser(ctx, repository.CreateOrganisationUserParams{
+		Userid:         id,
+		Organisationid: organisationId,
+		Role:           role,
+		Createdonutc:   now,
+		Modifiedonutc:  now,
+	})
+	if err != nil {
+		t.Fatalf("failed to CreateOrganisationUser: %v", err)
+	}
+	return id
+}
@@ -0,0 +1,19 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDsnWithDefaults(t *testing.T) {
+	tests := map[string]string{
+		"./db/test.db":              "./db/test.db?_busy_timeout=5000&_txlock=immediate",
+		"file:test.db?cache=shared": "file:test.db?cache=shared&_busy_timeout=5000&_txlock=immediate",
+		"test.db?_busy_timeout=100": "test.db?_busy_timeout=100&_txlock=immediate",
+		"test.db?_txlock=deferred":  "test.db?_txlock=deferred&_busy_timeout=5000",
+	}
+	for dsn, want := range tests {
+		assert.Equal(t, want, dsnWithDefaults(dsn), dsn)
+	}
+}
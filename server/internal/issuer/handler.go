@@ -0,0 +1,140 @@
+package issuer
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/admin"
+	"github.com/jawee/scimtiplexer/internal/repository"
+)
+
+type handler struct {
+	service *service
+}
+
+func RegisterEndpoints(api *admin.API, repo repository.Querier) {
+	h := &handler{
+		service: &service{repo: repo, allowHTTP: allowHTTPFromEnv()},
+	}
+
+	slog.Debug("Registering trusted issuer endpoints")
+	api.Member("GET", "/orgs/{orgId}/trusted-issuers", h.handleGetTrustedIssuers, admin.Operation{
+		Summary:  "List the issuers whose tokens an organisation accepts",
+		Response: []TrustedIssuerResponse{},
+	})
+	api.Member("POST", "/orgs/{orgId}/trusted-issuers", h.handlePostTrustedIssuer, admin.Operation{
+		Summary:  "Trust the tokens of an issuer",
+		Request:  TrustedIssuerRequest{},
+		Response: TrustedIssuerResponse{},
+		Status:   http.StatusCreated,
+	})
+	api.Member("DELETE", "/orgs/{orgId}/trusted-issuers/{id}", h.handleDeleteTrustedIssuer, admin.Operation{
+		Summary: "Stop trusting an issuer",
+		Status:  http.StatusNoContent,
+	})
+}
+
+type TrustedIssuerResponse struct {
+	ID                     string          `json:"id"`
+	Issuer                 string          `json:"issuer"`
+	Audience               string          `json:"audience"`
+	JwksUri                string          `json:"jwksUri,omitempty"`
+	Jwks                   json.RawMessage `json:"jwks,omitempty"`
+	OrganisationClaim      string          `json:"organisationClaim"`
+	OrganisationClaimValue string          `json:"organisationClaimValue"`
+	Scopes                 []string        `json:"scopes"`
+	CreatedBy              string          `json:"createdBy"`
+	CreatedOnUtc           time.Time       `json:"createdOnUtc"`
+	ModifiedOnUtc          time.Time       `json:"modifiedOnUtc"`
+}
+
+func newTrustedIssuerResponse(trusted trustedIssuerDto) TrustedIssuerResponse {
+	return TrustedIssuerResponse{
+		ID:                     trusted.ID,
+		Issuer:                 trusted.Issuer,
+		Audience:               trusted.Audience,
+		JwksUri:                trusted.JwksUri,
+		Jwks:                   trusted.Jwks,
+		OrganisationClaim:      trusted.OrganisationClaim,
+		OrganisationClaimValue: trusted.OrganisationClaimValue,
+		Scopes:                 trusted.Scopes,
+		CreatedBy:              trusted.CreatedBy,
+		CreatedOnUtc:           trusted.CreatedOnUtc,
+		ModifiedOnUtc:          trusted.ModifiedOnUtc,
+	}
+}
+
+// TrustedIssuerRequest registers an issuer. The key set is either given
+// inline in Jwks or referenced by JwksUri, which must be an https URI unless
+// the operator allows http. Tokens map to the organisation when
+// OrganisationClaim equals OrganisationClaimValue. Leaving out scopes allows
+// all of them.
+type TrustedIssuerRequest struct {
+	Issuer                 string          `json:"issuer"`
+	Audience               string          `json:"audience"`
+	JwksUri                string          `json:"jwksUri"`
+	Jwks                   json.RawMessage `json:"jwks"`
+	OrganisationClaim      string          `json:"organisationClaim"`
+	OrganisationClaimValue string          `json:"organisationClaimValue"`
+	Scopes                 []string        `json:"scopes"`
+}
+
+func (h *handler) handleGetTrustedIssuers(w http.ResponseWriter, r *http.Request) {
+	issuers, err := h.service.GetTrustedIssuers(r.Context(), r.PathValue("orgId"))
+	if err != nil {
+		slog.Error("Failed to get trusted issuers", "error", err)
+		admin.WriteError(w, http.StatusInternalServerError, "Failed to get trusted issuers")
+		return
+	}
+
+	resp := make([]TrustedIssuerResponse, len(issuers))
+	for i, trusted := range issuers {
+		resp[i] = newTrustedIssuerResponse(trusted)
+	}
+	admin.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (h *handler) handlePostTrustedIssuer(w http.ResponseWriter, r *http.Request) {
+	var req TrustedIssuerRequest
+	if !admin.ReadJSON(w, r, &req) {
+		return
+	}
+
+	trusted, err := h.service.CreateTrustedIssuer(r.Context(), r.PathValue("orgId"), admin.UserID(r.Context()), req)
+	if err != nil {
+		writeServiceError(w, err, "Failed to create trusted issuer")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusCreated, newTrustedIssuerResponse(trusted))
+}
+
+func (h *handler) handleDeleteTrustedIssuer(w http.ResponseWriter, r *http.Request) {
+	err := h.service.DeleteTrustedIssuer(r.Context(), r.PathValue("orgId"), r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, err, "Failed to delete trusted issuer")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeServiceError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		admin.WriteError(w, http.StatusNotFound, "Trusted issuer not found")
+		return
+	case errors.Is(err, errInvalidRequest):
+		admin.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, errConflict):
+		admin.WriteError(w, http.StatusConflict, err.Error())
+		return
+	}
+	slog.Error(message, "error", err)
+	admin.WriteError(w, http.StatusInternalServerError, message)
+}
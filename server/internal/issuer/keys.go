@@ -0,0 +1,154 @@
+package issuer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/jwks"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/utils"
+)
+
+const (
+	// keySetTTL is how long a fetched key set is used before it is fetched again.
+	keySetTTL = 10 * time.Minute
+	// refreshInterval limits how often an unknown kid forces a refetch, so
+	// tokens with made up kids cannot be used to hammer the issuer.
+	refreshInterval = time.Minute
+	// maxKeySetSize limits the size of a fetched key set.
+	maxKeySetSize = 1 << 20
+)
+
+var errUnknownKey = errors.New("unknown signing key")
+
+type cachedSet struct {
+	set       jwks.Set
+	fetchedAt time.Time
+}
+
+// key returns the public key with the given kid from the key set of a
+// trusted issuer. Inline key sets are used as is, key sets referenced by
+// jwks_uri are fetched and cached.
+func (v *Verifier) key(ctx context.Context, trusted repository.TrustedIssuer, kid string) (any, error) {
+	if trusted.Jwks.Valid {
+		set, err := jwks.Parse([]byte(trusted.Jwks.String))
+		if err != nil {
+			return nil, fmt.Errorf("trusted issuer %s has an invalid key set: %w", trusted.ID, err)
+		}
+		return publicKey(set, kid)
+	}
+	if !trusted.JwksUri.Valid {
+		return nil, fmt.Errorf("trusted issuer %s has no key set", trusted.ID)
+	}
+
+	uri := trusted.JwksUri.String
+	set, err := v.keySet(ctx, uri, false)
+	if err != nil {
+		return nil, err
+	}
+	key, err := publicKey(set, kid)
+	if !errors.Is(err, errUnknownKey) {
+		return key, err
+	}
+
+	// The issuer may have rotated its keys since the set was fetched.
+	set, err = v.keySet(ctx, uri, true)
+	if err != nil {
+		return nil, err
+	}
+	return publicKey(set, kid)
+}
+
+func publicKey(set jwks.Set, kid string) (any, error) {
+	key, ok := set.Find(kid)
+	if !ok {
+		return nil, fmt.Errorf("%w %q", errUnknownKey, kid)
+	}
+	return key.PublicKey()
+}
+
+func (v *Verifier) keySet(ctx context.Context, uri string, refresh bool) (jwks.Set, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := time.Now()
+	cached, ok := v.sets[uri]
+	if ok {
+		age := now.Sub(cached.fetchedAt)
+		if age < keySetTTL && (!refresh || age < refreshInterval) {
+			return cached.set, nil
+		}
+	}
+
+	set, err := v.fetchKeySet(ctx, uri)
+	if err != nil {
+		if ok {
+			slog.Warn("Failed to refresh key set, using cached keys", "uri", uri, "error", err)
+			return cached.set, nil
+		}
+		return jwks.Set{}, err
+	}
+
+	v.sets[uri] = &cachedSet{set: set, fetchedAt: now}
+	return set, nil
+}
+
+// allowHTTPFromEnv reports whether the operator allows key sets to be
+// fetched over plain http, which is meant for local development.
+func allowHTTPFromEnv() bool {
+	allow, _ := strconv.ParseBool(os.Getenv(utils.EnvTrustedIssuerAllowHTTP))
+	return allow
+}
+
+// checkJwksUri requires an https URI, or an http URI when allowHTTP is set.
+// The server fetches the key set itself, so an organisation admin must not be
+// able to point it at local files or at plain http services on the internal
+// network.
+func checkJwksUri(uri string, allowHTTP bool) error {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" {
+		return errors.New("jwksUri must be an absolute URI")
+	}
+	if u.Scheme != "https" && (u.Scheme != "http" || !allowHTTP) {
+		if allowHTTP {
+			return errors.New("jwksUri must be an http or https URI")
+		}
+		return errors.New("jwksUri must be an https URI")
+	}
+	return nil
+}
+
+// fetchKeySet reads a key set from an https URI.
+func (v *Verifier) fetchKeySet(ctx context.Context, uri string) (jwks.Set, error) {
+	if err := checkJwksUri(uri, v.allowHTTP); err != nil {
+		return jwks.Set{}, fmt.Errorf("invalid jwks uri: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return jwks.Set{}, err
+	}
+	req.Header.Set("Accept", "application/jwk-set+json, application/json")
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return jwks.Set{}, fmt.Errorf("failed to fetch key set: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return jwks.Set{}, fmt.Errorf("failed to fetch key set: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxKeySetSize))
+	if err != nil {
+		return jwks.Set{}, fmt.Errorf("failed to read key set: %w", err)
+	}
+
+	return jwks.Parse(data)
+}
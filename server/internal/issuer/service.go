@@ -0,0 +1,176 @@
+package issuer
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jawee/scimtiplexer/internal/jwks"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/token"
+)
+
+// service manages the trusted issuers of an organisation.
+type service struct {
+	repo      repository.Querier
+	allowHTTP bool
+}
+
+var (
+	errInvalidRequest = errors.New("invalid request")
+	errConflict       = errors.New("conflict")
+)
+
+type trustedIssuerDto struct {
+	ID                     string
+	Issuer                 string
+	Audience               string
+	JwksUri                string
+	Jwks                   json.RawMessage
+	OrganisationClaim      string
+	OrganisationClaimValue string
+	Scopes                 []string
+	CreatedBy              string
+	CreatedOnUtc           time.Time
+	ModifiedOnUtc          time.Time
+}
+
+func newTrustedIssuerDto(trusted repository.TrustedIssuer) trustedIssuerDto {
+	dto := trustedIssuerDto{
+		ID:                     trusted.ID,
+		Issuer:                 trusted.Issuer,
+		Audience:               trusted.Audience,
+		JwksUri:                trusted.JwksUri.String,
+		OrganisationClaim:      trusted.OrganisationClaim,
+		OrganisationClaimValue: trusted.OrganisationClaimValue,
+		Scopes:                 token.ParseScopes(trusted.Scopes),
+		CreatedBy:              trusted.CreatedBy,
+		CreatedOnUtc:           trusted.CreatedOnUtc,
+		ModifiedOnUtc:          trusted.ModifiedOnUtc,
+	}
+	if trusted.Jwks.Valid {
+		dto.Jwks = json.RawMessage(trusted.Jwks.String)
+	}
+	return dto
+}
+
+func (s *service) GetTrustedIssuers(ctx context.Context, organisationId string) ([]trustedIssuerDto, error) {
+	issuers, err := s.repo.GetTrustedIssuers(ctx, organisationId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetTrustedIssuers: %w", err)
+	}
+
+	dtos := make([]trustedIssuerDto, len(issuers))
+	for i, trusted := range issuers {
+		dtos[i] = newTrustedIssuerDto(trusted)
+	}
+	return dtos, nil
+}
+
+func (s *service) CreateTrustedIssuer(ctx context.Context, organisationId, userId string, req TrustedIssuerRequest) (trustedIssuerDto, error) {
+	if err := validateRequest(req, s.allowHTTP); err != nil {
+		return trustedIssuerDto{}, fmt.Errorf("%w: %w", errInvalidRequest, err)
+	}
+
+	scopes, err := token.FormatScopes(req.Scopes)
+	if err != nil {
+		return trustedIssuerDto{}, fmt.Errorf("%w: %w", errInvalidRequest, err)
+	}
+
+	// A token is mapped to the organisation of the registration its claims
+	// match, so the same claims can't be registered twice.
+	_, err = s.repo.GetTrustedIssuerByClaimValue(ctx, repository.GetTrustedIssuerByClaimValueParams{
+		Issuer:                 req.Issuer,
+		Audience:               req.Audience,
+		Organisationclaim:      req.OrganisationClaim,
+		Organisationclaimvalue: req.OrganisationClaimValue,
+	})
+	if err == nil {
+		return trustedIssuerDto{}, fmt.Errorf("%w: the issuer is already trusted with this audience and %s value", errConflict, req.OrganisationClaim)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return trustedIssuerDto{}, fmt.Errorf("failed to GetTrustedIssuerByClaimValue: %w", err)
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return trustedIssuerDto{}, errors.New("failed to generate UUID for new trusted issuer")
+	}
+
+	now := time.Now().UTC()
+	_, err = s.repo.CreateTrustedIssuer(ctx, repository.CreateTrustedIssuerParams{
+		ID:                     id.String(),
+		Organisationid:         organisationId,
+		Issuer:                 req.Issuer,
+		Audience:               req.Audience,
+		Jwksuri:                sql.NullString{String: req.JwksUri, Valid: req.JwksUri != ""},
+		Jwks:                   sql.NullString{String: string(req.Jwks), Valid: len(req.Jwks) > 0},
+		Organisationclaim:      req.OrganisationClaim,
+		Organisationclaimvalue: req.OrganisationClaimValue,
+		Scopes:                 scopes,
+		Createdby:              userId,
+		Createdonutc:           now,
+		Modifiedonutc:          now,
+		Modifiedby:             sql.NullString{String: userId, Valid: true},
+	})
+	if err != nil {
+		return trustedIssuerDto{}, fmt.Errorf("failed to CreateTrustedIssuer: %w", err)
+	}
+
+	trusted, err := s.repo.GetTrustedIssuerById(ctx, repository.GetTrustedIssuerByIdParams{
+		ID:             id.String(),
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return trustedIssuerDto{}, err
+	}
+	return newTrustedIssuerDto(trusted), nil
+}
+
+func (s *service) DeleteTrustedIssuer(ctx context.Context, organisationId, id string) error {
+	_, err := s.repo.GetTrustedIssuerById(ctx, repository.GetTrustedIssuerByIdParams{
+		ID:             id,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.DeleteTrustedIssuer(ctx, repository.DeleteTrustedIssuerParams{
+		ID:             id,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to DeleteTrustedIssuer: %w", err)
+	}
+	return nil
+}
+
+func validateRequest(req TrustedIssuerRequest, allowHTTP bool) error {
+	switch {
+	case req.Issuer == "":
+		return errors.New("issuer is required")
+	case req.Audience == "":
+		return errors.New("audience is required")
+	case req.OrganisationClaim == "" || req.OrganisationClaimValue == "":
+		return errors.New("organisationClaim and organisationClaimValue are required")
+	case (req.JwksUri == "") == (len(req.Jwks) == 0):
+		return errors.New("exactly one of jwks and jwksUri is required")
+	}
+
+	if req.JwksUri != "" {
+		if err := checkJwksUri(req.JwksUri, allowHTTP); err != nil {
+			return err
+		}
+	}
+	if len(req.Jwks) > 0 {
+		if _, err := jwks.Parse(req.Jwks); err != nil {
+			return err
+		}
+	}
+	return nil
+}
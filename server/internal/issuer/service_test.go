@@ -0,0 +1,46 @@
+package issuer
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/jawee/scimtiplexer/internal/database/databasetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateTrustedIssuerRejectsDuplicates(t *testing.T) {
+	s := &service{repo: databasetest.New(t).GetRepository()}
+	keys := newKeyServer(t)
+	keys.addKey(t, "k1")
+	set, err := json.Marshal(keys.keySet())
+	require.NoError(t, err)
+	req := TrustedIssuerRequest{
+		Issuer:                 testIssuer,
+		Audience:               testAudience,
+		Jwks:                   json.RawMessage(set),
+		OrganisationClaim:      "tenant",
+		OrganisationClaimValue: "acme",
+	}
+	ctx := context.Background()
+
+	_, err = s.CreateTrustedIssuer(ctx, testOrgId, "admin", req)
+	require.NoError(t, err)
+
+	_, err = s.CreateTrustedIssuer(ctx, "org-2", "admin", req)
+	assert.ErrorIs(t, err, errConflict, "another organisation can't register the same claims")
+
+	req.OrganisationClaimValue = "globex"
+	_, err = s.CreateTrustedIssuer(ctx, "org-2", "admin", req)
+	assert.NoError(t, err)
+}
+
+func TestCheckJwksUri(t *testing.T) {
+	assert.NoError(t, checkJwksUri("https://idp.example.com/keys", false))
+	assert.Error(t, checkJwksUri("http://169.254.169.254/keys", false))
+	assert.NoError(t, checkJwksUri("http://localhost:8081/keys", true), "the operator allows http")
+	assert.Error(t, checkJwksUri("file:///etc/passwd", false))
+	assert.Error(t, checkJwksUri("file:///etc/passwd", true))
+	assert.Error(t, checkJwksUri("/etc/passwd", true))
+}
@@ -0,0 +1,172 @@
+package issuer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/token"
+)
+
+var (
+	ErrUnknownIssuer = errors.New("issuer is not trusted")
+	ErrInvalidToken  = errors.New("token is not valid")
+)
+
+// signingMethods are the algorithms accepted from external issuers.
+var signingMethods = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}
+
+// Verifier validates JWTs issued by the trusted issuers an organisation has
+// registered.
+type Verifier struct {
+	repo      repository.Querier
+	client    *http.Client
+	allowHTTP bool
+
+	mu   sync.Mutex
+	sets map[string]*cachedSet
+}
+
+func NewVerifier(repo repository.Querier) *Verifier {
+	return &Verifier{
+		repo:      repo,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		allowHTTP: allowHTTPFromEnv(),
+		sets:      make(map[string]*cachedSet),
+	}
+}
+
+// VerifiedToken is the organisation and scopes a token from a trusted issuer
+// grants.
+type VerifiedToken struct {
+	TrustedIssuerID string
+	Subject         string
+	OrganisationID  string
+	Scopes          []string
+}
+
+// PeekIssuer returns the iss claim of a JWT without verifying it, so the
+// caller can decide which verifier to use.
+func PeekIssuer(raw string) (string, error) {
+	var claims jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(raw, &claims); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	return claims.Issuer, nil
+}
+
+// Verify validates a token against every organisation that trusts its
+// issuer, and returns the first one the token is valid for. A non-empty
+// organisationId limits the issuers to those of that organisation.
+func (v *Verifier) Verify(ctx context.Context, raw, organisationId string) (VerifiedToken, error) {
+	iss, err := PeekIssuer(raw)
+	if err != nil {
+		return VerifiedToken{}, err
+	}
+	if iss == "" {
+		return VerifiedToken{}, fmt.Errorf("%w: missing iss claim", ErrInvalidToken)
+	}
+
+	candidates, err := v.repo.GetTrustedIssuersByIssuer(ctx, iss)
+	if err != nil {
+		return VerifiedToken{}, fmt.Errorf("failed to GetTrustedIssuersByIssuer: %w", err)
+	}
+	if organisationId != "" {
+		candidates = slices.DeleteFunc(candidates, func(trusted repository.TrustedIssuer) bool {
+			return trusted.OrganisationID != organisationId
+		})
+	}
+	if len(candidates) == 0 {
+		return VerifiedToken{}, ErrUnknownIssuer
+	}
+
+	var lastErr error
+	for _, candidate := range candidates {
+		verified, err := v.verify(ctx, candidate, raw)
+		if err == nil {
+			return verified, nil
+		}
+		if !errors.Is(err, ErrInvalidToken) {
+			return VerifiedToken{}, err
+		}
+		lastErr = err
+	}
+	return VerifiedToken{}, lastErr
+}
+
+func (v *Verifier) verify(ctx context.Context, trusted repository.TrustedIssuer, raw string) (VerifiedToken, error) {
+	var keyErr error
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := v.key(ctx, trusted, kid)
+		if err != nil {
+			keyErr = err
+			return nil, err
+		}
+		return key, nil
+	},
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(trusted.Issuer),
+		jwt.WithAudience(trusted.Audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		if keyErr != nil && !errors.Is(keyErr, errUnknownKey) {
+			return VerifiedToken{}, keyErr
+		}
+		return VerifiedToken{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	value, _ := claims[trusted.OrganisationClaim].(string)
+	if value != trusted.OrganisationClaimValue {
+		return VerifiedToken{}, fmt.Errorf("%w: %s claim does not match", ErrInvalidToken, trusted.OrganisationClaim)
+	}
+
+	subject, _ := claims.GetSubject()
+	return VerifiedToken{
+		TrustedIssuerID: trusted.ID,
+		Subject:         subject,
+		OrganisationID:  trusted.OrganisationID,
+		Scopes:          grantedScopes(claims, token.ParseScopes(trusted.Scopes)),
+	}, nil
+}
+
+// grantedScopes limits the scopes of a token to those configured for the
+// issuer. A token without a scope or scp claim gets every configured scope.
+func grantedScopes(claims jwt.MapClaims, allowed []string) []string {
+	_, hasScp := claims["scp"]
+	_, hasScope := claims["scope"]
+	if !hasScp && !hasScope {
+		return allowed
+	}
+
+	var requested []string
+	switch scp := claims["scp"].(type) {
+	case string:
+		requested = token.ParseScopes(scp)
+	case []any:
+		for _, s := range scp {
+			if str, ok := s.(string); ok {
+				requested = append(requested, str)
+			}
+		}
+	}
+	if scope, ok := claims["scope"].(string); ok {
+		requested = append(requested, token.ParseScopes(scope)...)
+	}
+
+	var granted []string
+	for _, s := range requested {
+		if token.HasScope(allowed, s) && !token.HasScope(granted, s) {
+			granted = append(granted, s)
+		}
+	}
+	return granted
+}
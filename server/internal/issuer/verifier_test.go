@@ -0,0 +1,294 @@
+package issuer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jawee/scimtiplexer/internal/database/databasetest"
+	"github.com/jawee/scimtiplexer/internal/jwks"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testIssuer   = "https://platform.example.com"
+	testAudience = "scimtiplexer"
+	testOrgId    = "org-1"
+)
+
+// keyServer is a local issuer that signs tokens and serves the public keys
+// it publishes as a key set.
+type keyServer struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PrivateKey
+	published []string
+}
+
+func newKeyServer(t *testing.T) *keyServer {
+	s := &keyServer{keys: make(map[string]*rsa.PrivateKey)}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.keySet())
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// addKey generates a key and publishes it.
+func (s *keyServer) addKey(t *testing.T, kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[kid] = key
+	s.published = append(s.published, kid)
+}
+
+// publish sets the keys in the key set.
+func (s *keyServer) publish(kids ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.published = kids
+}
+
+func (s *keyServer) keySet() jwks.Set {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	set := jwks.Set{Keys: []jwks.Key{}}
+	for _, kid := range s.published {
+		set.Keys = append(set.Keys, jwks.FromRSAPublicKey(kid, "RS256", &s.keys[kid].PublicKey))
+	}
+	return set
+}
+
+func (s *keyServer) sign(t *testing.T, kid string, claims jwt.MapClaims) string {
+	s.mu.Lock()
+	key := s.keys[kid]
+	s.mu.Unlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":    testIssuer,
+		"aud":    testAudience,
+		"sub":    "workload-1",
+		"tenant": "acme",
+		"iat":    now.Unix(),
+		"exp":    now.Add(5 * time.Minute).Unix(),
+		"scope":  "users:read",
+	}
+}
+
+// trust registers the issuer for the test organisation, with its keys
+// inline when jwksUri is empty.
+func trust(t *testing.T, repo repository.Querier, id, jwksUri string, inline jwks.Set) {
+	params := repository.CreateTrustedIssuerParams{
+		ID:                     id,
+		Organisationid:         testOrgId,
+		Issuer:                 testIssuer,
+		Audience:               testAudience,
+		Organisationclaim:      "tenant",
+		Organisationclaimvalue: "acme",
+		Scopes:                 "users:read users:write",
+		Createdby:              "admin",
+		Createdonutc:           time.Now().UTC(),
+		Modifiedonutc:          time.Now().UTC(),
+	}
+	if jwksUri != "" {
+		params.Jwksuri = sql.NullString{String: jwksUri, Valid: true}
+	} else {
+		data, err := json.Marshal(inline)
+		require.NoError(t, err)
+		params.Jwks = sql.NullString{String: string(data), Valid: true}
+	}
+	_, err := repo.CreateTrustedIssuer(context.Background(), params)
+	require.NoError(t, err)
+}
+
+// age makes the cached key set of uri look d older.
+func age(v *Verifier, uri string, d time.Duration) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.sets[uri].fetchedAt = v.sets[uri].fetchedAt.Add(-d)
+}
+
+func TestVerifyRoundTrip(t *testing.T) {
+	repo := databasetest.New(t).GetRepository()
+	keys := newKeyServer(t)
+	keys.addKey(t, "k1")
+	trust(t, repo, "trusted-1", "", keys.keySet())
+	v := NewVerifier(repo)
+
+	verified, err := v.Verify(context.Background(), keys.sign(t, "k1", validClaims()), "")
+
+	require.NoError(t, err)
+	assert.Equal(t, VerifiedToken{
+		TrustedIssuerID: "trusted-1",
+		Subject:         "workload-1",
+		OrganisationID:  testOrgId,
+		Scopes:          []string{"users:read"},
+	}, verified)
+}
+
+func TestVerifyKeyRotation(t *testing.T) {
+	repo := databasetest.New(t).GetRepository()
+	keys := newKeyServer(t)
+	keys.addKey(t, "k1")
+	trust(t, repo, "trusted-1", keys.URL, jwks.Set{})
+	v := NewVerifier(repo)
+	v.client = keys.Client()
+	ctx := context.Background()
+
+	oldToken := keys.sign(t, "k1", validClaims())
+	_, err := v.Verify(ctx, oldToken, "")
+	require.NoError(t, err)
+
+	// The issuer starts signing with k2 and publishes both keys.
+	keys.addKey(t, "k2")
+	newToken := keys.sign(t, "k2", validClaims())
+
+	// An unknown kid doesn't refetch the key set more than once a minute.
+	_, err = v.Verify(ctx, newToken, "")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	age(v, keys.URL, refreshInterval)
+	_, err = v.Verify(ctx, newToken, "")
+	require.NoError(t, err, "new kid is accepted after the refetch")
+	_, err = v.Verify(ctx, oldToken, "")
+	require.NoError(t, err, "old kid is accepted until it is retired")
+
+	// The issuer retires k1. It is accepted until the cached set expires.
+	keys.publish("k2")
+	_, err = v.Verify(ctx, oldToken, "")
+	require.NoError(t, err)
+
+	age(v, keys.URL, keySetTTL)
+	_, err = v.Verify(ctx, oldToken, "")
+	assert.ErrorIs(t, err, ErrInvalidToken, "retired kid is rejected")
+	_, err = v.Verify(ctx, newToken, "")
+	assert.NoError(t, err)
+}
+
+func TestVerifyRejectsInvalidTokens(t *testing.T) {
+	repo := databasetest.New(t).GetRepository()
+	keys := newKeyServer(t)
+	keys.addKey(t, "k1")
+	keys.addKey(t, "untrusted")
+	trust(t, repo, "trusted-1", "", jwks.Set{Keys: keys.keySet().Keys[:1]})
+	v := NewVerifier(repo)
+
+	tests := []struct {
+		name   string
+		kid    string
+		claims func(c jwt.MapClaims)
+		err    error
+	}{
+		{"wrong issuer", "k1", func(c jwt.MapClaims) { c["iss"] = "https://attacker.example.com" }, ErrUnknownIssuer},
+		{"missing issuer", "k1", func(c jwt.MapClaims) { delete(c, "iss") }, ErrInvalidToken},
+		{"wrong audience", "k1", func(c jwt.MapClaims) { c["aud"] = "another-service" }, ErrInvalidToken},
+		{"expired", "k1", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }, ErrInvalidToken},
+		{"missing exp", "k1", func(c jwt.MapClaims) { delete(c, "exp") }, ErrInvalidToken},
+		{"not yet valid", "k1", func(c jwt.MapClaims) { c["nbf"] = time.Now().Add(time.Hour).Unix() }, ErrInvalidToken},
+		{"other organisation", "k1", func(c jwt.MapClaims) { c["tenant"] = "globex" }, ErrInvalidToken},
+		{"unknown key", "untrusted", func(c jwt.MapClaims) {}, ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			tt.claims(claims)
+
+			_, err := v.Verify(context.Background(), keys.sign(t, tt.kid, claims), "")
+
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestVerifyRejectsUnsignedToken(t *testing.T) {
+	repo := databasetest.New(t).GetRepository()
+	keys := newKeyServer(t)
+	keys.addKey(t, "k1")
+	trust(t, repo, "trusted-1", "", keys.keySet())
+	v := NewVerifier(repo)
+
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+
+	_, err = v.Verify(context.Background(), unsigned, "")
+
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestVerifyRefusesToReadFiles(t *testing.T) {
+	repo := databasetest.New(t).GetRepository()
+	trust(t, repo, "trusted-1", "file:///etc/passwd", jwks.Set{})
+	keys := newKeyServer(t)
+	keys.addKey(t, "k1")
+	v := NewVerifier(repo)
+
+	_, err := v.Verify(context.Background(), keys.sign(t, "k1", validClaims()), "")
+
+	assert.ErrorContains(t, err, "invalid jwks uri")
+}
+
+func TestGrantedScopes(t *testing.T) {
+	allowed := []string{"users:read", "users:write"}
+
+	assert.Equal(t, allowed, grantedScopes(jwt.MapClaims{}, allowed), "all scopes without a scope claim")
+	assert.Equal(t, []string{"users:write"}, grantedScopes(jwt.MapClaims{"scp": []any{"users:write", "groups:write"}}, allowed))
+	assert.Empty(t, grantedScopes(jwt.MapClaims{"scope": "groups:read"}, allowed))
+}
+
+func TestVerifyOnlyTriesIssuersOfOrganisation(t *testing.T) {
+	repo := databasetest.New(t).GetRepository()
+	keys := newKeyServer(t)
+	keys.addKey(t, "k1")
+	trust(t, repo, "trusted-1", "", keys.keySet())
+	// Another organisation trusts the same issuer and keys, and maps the
+	// tokens to itself by a claim they share.
+	data, err := json.Marshal(keys.keySet())
+	require.NoError(t, err)
+	_, err = repo.CreateTrustedIssuer(context.Background(), repository.CreateTrustedIssuerParams{
+		ID:                     "trusted-0",
+		Organisationid:         "org-2",
+		Issuer:                 testIssuer,
+		Audience:               testAudience,
+		Jwks:                   sql.NullString{String: string(data), Valid: true},
+		Organisationclaim:      "sub",
+		Organisationclaimvalue: "workload-1",
+		Scopes:                 "users:read users:write",
+		Createdby:              "admin",
+		Createdonutc:           time.Now().UTC(),
+		Modifiedonutc:          time.Now().UTC(),
+	})
+	require.NoError(t, err)
+	v := NewVerifier(repo)
+	raw := keys.sign(t, "k1", validClaims())
+
+	verified, err := v.Verify(context.Background(), raw, testOrgId)
+	require.NoError(t, err)
+	assert.Equal(t, "trusted-1", verified.TrustedIssuerID)
+
+	_, err = v.Verify(context.Background(), raw, "org-3")
+	assert.ErrorIs(t, err, ErrUnknownIssuer)
+}
@@ -0,0 +1,125 @@
+package jwks
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Key is a JSON Web Key as defined in RFC 7517. Only the members needed for
+// RSA and EC signature keys are included.
+type Key struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// Set is a JSON Web Key Set, the document served from a jwks_uri.
+type Set struct {
+	Keys []Key `json:"keys"`
+}
+
+// Parse decodes a key set and checks that every key in it can be used.
+func Parse(data []byte) (Set, error) {
+	var set Set
+	if err := json.Unmarshal(data, &set); err != nil {
+		return Set{}, fmt.Errorf("invalid key set: %w", err)
+	}
+	if len(set.Keys) == 0 {
+		return Set{}, errors.New("key set has no keys")
+	}
+	for _, key := range set.Keys {
+		if _, err := key.PublicKey(); err != nil {
+			return Set{}, fmt.Errorf("key %q: %w", key.Kid, err)
+		}
+	}
+	return set, nil
+}
+
+// Find returns the key with the given kid. A set with a single key matches
+// any kid, since issuers with one key often leave the kid header out.
+func (s Set) Find(kid string) (Key, bool) {
+	for _, key := range s.Keys {
+		if key.Kid == kid {
+			return key, true
+		}
+	}
+	if len(s.Keys) == 1 && kid == "" {
+		return s.Keys[0], true
+	}
+	return Key{}, false
+}
+
+// FromRSAPublicKey describes an RSA public key used to verify signatures.
+func FromRSAPublicKey(kid, alg string, key *rsa.PublicKey) Key {
+	return Key{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: alg,
+		Kid: kid,
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// PublicKey decodes the key into an *rsa.PublicKey or *ecdsa.PublicKey.
+func (k Key) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %w", err)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, errors.New("missing value")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/jawee/scimtiplexer/internal/utils"
+)
+
+var (
+	mu       sync.Mutex
+	counters []*Counter
+)
+
+// Counter is a monotonically increasing count, kept per combination of label
+// values. Counters are served in the Prometheus text format and start over
+// when the server restarts.
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]uint64
+}
+
+// NewCounter creates and registers a counter with the given label names.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: make(map[string]uint64),
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	counters = append(counters, c)
+	return c
+}
+
+// Inc increments the count of the given label values, which are in the order
+// of the label names of the counter.
+func (c *Counter) Inc(values ...string) {
+	if len(values) != len(c.labels) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, got %d values", c.name, len(c.labels), len(values)))
+	}
+
+	pairs := make([]string, len(values))
+	for i, value := range values {
+		pairs[i] = fmt.Sprintf("%s=%q", c.labels[i], value)
+	}
+	key := strings.Join(pairs, ",")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key]++
+}
+
+func (c *Counter) write(b *strings.Builder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(b, "# HELP %s %s\n", c.name, c.help)
+	fmt.Fprintf(b, "# TYPE %s counter\n", c.name)
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		if key == "" {
+			fmt.Fprintf(b, "%s %d\n", c.name, c.values[key])
+			continue
+		}
+		fmt.Fprintf(b, "%s{%s} %d\n", c.name, key, c.values[key])
+	}
+}
+
+// RegisterEndpoints registers the endpoint the metrics are scraped from. When
+// METRICS_TOKEN is set scrapers authenticate with it as a bearer token.
+func RegisterEndpoints(mux *http.ServeMux) {
+	h := &handler{token: os.Getenv(utils.EnvMetricsToken)}
+
+	slog.Debug("Registering metrics endpoints")
+	mux.HandleFunc("GET /metrics", h.handleGetMetrics)
+}
+
+type handler struct {
+	token string
+}
+
+func (h *handler) handleGetMetrics(w http.ResponseWriter, r *http.Request) {
+	if h.token != "" {
+		bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(bearer), []byte(h.token)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+
+	mu.Lock()
+	registered := slices.Clone(counters)
+	mu.Unlock()
+
+	var b strings.Builder
+	for _, c := range registered {
+		c.write(&b)
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(b.String()))
+}
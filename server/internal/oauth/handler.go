@@ -0,0 +1,210 @@
+package oauth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/admin"
+	"github.com/jawee/scimtiplexer/internal/repository"
+)
+
+type handler struct {
+	issuer  *TokenIssuer
+	service *service
+}
+
+func RegisterEndpoints(mux *http.ServeMux, api *admin.API, repo repository.Querier, issuer *TokenIssuer) {
+	h := &handler{
+		issuer:  issuer,
+		service: &service{repo: repo},
+	}
+
+	slog.Debug("Registering OAuth endpoints")
+	mux.HandleFunc("POST /oauth/token", h.handleToken)
+	mux.HandleFunc("GET /.well-known/jwks.json", h.handleJwks)
+
+	api.Member("GET", "/orgs/{orgId}/oauth-clients", h.handleGetClients, admin.Operation{
+		Summary:  "List the OAuth clients of an organisation",
+		Response: []ClientResponse{},
+	})
+	api.Member("POST", "/orgs/{orgId}/oauth-clients", h.handlePostClient, admin.Operation{
+		Summary:  "Create an OAuth client, its secret is returned only in this response",
+		Request:  ClientRequest{},
+		Response: ClientResponse{},
+		Status:   http.StatusCreated,
+	})
+	api.Member("DELETE", "/orgs/{orgId}/oauth-clients/{id}", h.handleDeleteClient, admin.Operation{
+		Summary: "Revoke an OAuth client",
+		Status:  http.StatusNoContent,
+	})
+}
+
+// TokenResponse is the successful access token response of RFC 6749 section 5.1.
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+}
+
+// TokenErrorResponse is the error response of RFC 6749 section 5.2.
+type TokenErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+func (h *handler) handleToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if err := r.ParseForm(); err != nil {
+		writeTokenError(w, http.StatusBadRequest, "invalid_request", "Malformed request body")
+		return
+	}
+
+	if grantType := r.PostForm.Get("grant_type"); grantType != "client_credentials" {
+		writeTokenError(w, http.StatusBadRequest, "unsupported_grant_type", "Only client_credentials is supported")
+		return
+	}
+
+	clientId, clientSecret, usedBasic := r.BasicAuth()
+	if !usedBasic {
+		clientId = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+
+	accessToken, err := h.issuer.IssueClientCredentials(r.Context(), clientId, clientSecret, r.PostForm.Get("scope"))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidClient):
+			slog.Info("OAuth client authentication failed", "client_id", clientId)
+			if usedBasic {
+				w.Header().Set("WWW-Authenticate", `Basic realm="scimtiplexer"`)
+			}
+			writeTokenError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		case errors.Is(err, ErrInvalidScope):
+			writeTokenError(w, http.StatusBadRequest, "invalid_scope", err.Error())
+		default:
+			slog.Error("Failed to issue access token", "error", err)
+			writeTokenError(w, http.StatusInternalServerError, "server_error", "")
+		}
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusOK, TokenResponse{
+		AccessToken: accessToken.Token,
+		TokenType:   "Bearer",
+		ExpiresIn:   accessToken.ExpiresIn,
+		Scope:       accessToken.Scope,
+	})
+}
+
+func writeTokenError(w http.ResponseWriter, status int, code, description string) {
+	admin.WriteJSON(w, status, TokenErrorResponse{Error: code, ErrorDescription: description})
+}
+
+func (h *handler) handleJwks(w http.ResponseWriter, r *http.Request) {
+	set, err := h.issuer.KeySet(r.Context())
+	if err != nil {
+		slog.Error("Failed to get key set", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	w.Header().Set("Cache-Control", "max-age=300")
+	w.WriteHeader(http.StatusOK)
+	jsonOutput, _ := json.Marshal(set)
+	w.Write(jsonOutput)
+}
+
+// ClientResponse describes an OAuth client. ClientSecret is only set in the
+// response that creates the client.
+type ClientResponse struct {
+	ID            string     `json:"id"`
+	ClientID      string     `json:"clientId"`
+	ClientSecret  string     `json:"clientSecret,omitempty"`
+	Label         string     `json:"label,omitempty"`
+	Scopes        []string   `json:"scopes"`
+	RevokedOnUtc  *time.Time `json:"revokedOnUtc,omitempty"`
+	CreatedBy     string     `json:"createdBy"`
+	CreatedOnUtc  time.Time  `json:"createdOnUtc"`
+	ModifiedOnUtc time.Time  `json:"modifiedOnUtc"`
+}
+
+func newClientResponse(client clientDto) ClientResponse {
+	return ClientResponse{
+		ID:            client.ID,
+		ClientID:      client.ClientID,
+		ClientSecret:  client.ClientSecret,
+		Label:         client.Label,
+		Scopes:        client.Scopes,
+		RevokedOnUtc:  client.RevokedOnUtc,
+		CreatedBy:     client.CreatedBy,
+		CreatedOnUtc:  client.CreatedOnUtc,
+		ModifiedOnUtc: client.ModifiedOnUtc,
+	}
+}
+
+// ClientRequest creates a client. Leaving out scopes grants all of them.
+type ClientRequest struct {
+	Label  string   `json:"label"`
+	Scopes []string `json:"scopes"`
+}
+
+func (h *handler) handleGetClients(w http.ResponseWriter, r *http.Request) {
+	clients, err := h.service.GetClients(r.Context(), r.PathValue("orgId"))
+	if err != nil {
+		slog.Error("Failed to get OAuth clients", "error", err)
+		admin.WriteError(w, http.StatusInternalServerError, "Failed to get OAuth clients")
+		return
+	}
+
+	resp := make([]ClientResponse, len(clients))
+	for i, client := range clients {
+		resp[i] = newClientResponse(client)
+	}
+	admin.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (h *handler) handlePostClient(w http.ResponseWriter, r *http.Request) {
+	var req ClientRequest
+	if !admin.ReadJSON(w, r, &req) {
+		return
+	}
+
+	client, err := h.service.CreateClient(r.Context(), r.PathValue("orgId"), admin.UserID(r.Context()), req)
+	if err != nil {
+		writeServiceError(w, err, "Failed to create OAuth client")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusCreated, newClientResponse(client))
+}
+
+func (h *handler) handleDeleteClient(w http.ResponseWriter, r *http.Request) {
+	err := h.service.RevokeClient(r.Context(), r.PathValue("orgId"), admin.UserID(r.Context()), r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, err, "Failed to revoke OAuth client")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeServiceError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		admin.WriteError(w, http.StatusNotFound, "OAuth client not found")
+		return
+	case errors.Is(err, errInvalidRequest):
+		admin.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	slog.Error(message, "error", err)
+	admin.WriteError(w, http.StatusInternalServerError, message)
+}
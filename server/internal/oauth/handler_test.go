@@ -0,0 +1,167 @@
+package oauth_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jawee/scimtiplexer/internal/admin"
+	"github.com/jawee/scimtiplexer/internal/database/databasetest"
+	"github.com/jawee/scimtiplexer/internal/jwks"
+	"github.com/jawee/scimtiplexer/internal/oauth"
+	"github.com/jawee/scimtiplexer/internal/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const clientsPath = admin.APIPrefix + "/orgs/org-1/oauth-clients"
+
+// newTestServer serves the OAuth endpoints, with an admin of org-1 to manage
+// the clients.
+func newTestServer(t *testing.T) (http.Handler, *oauth.TokenIssuer) {
+	repo := databasetest.New(t).GetRepository()
+	databasetest.CreateMember(t, repo, "admin", "org-1", admin.RoleAdmin)
+	issuer := oauth.NewTokenIssuer(repo)
+	mux := http.NewServeMux()
+	oauth.RegisterEndpoints(mux, admin.NewAPI(mux, admin.NewAuthenticator(repo)), repo, issuer)
+	return mux, issuer
+}
+
+// createClient creates a client of org-1 with the scopes.
+func createClient(t *testing.T, h http.Handler, scopes ...string) oauth.ClientResponse {
+	t.Helper()
+	body, err := json.Marshal(oauth.ClientRequest{Label: "okta", Scopes: scopes})
+	require.NoError(t, err)
+	rec := serve(h, "POST", clientsPath, string(body), func(r *http.Request) {
+		r.SetBasicAuth("admin", databasetest.Password)
+	})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var client oauth.ClientResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &client))
+	require.NotEmpty(t, client.ClientSecret)
+	return client
+}
+
+func serve(h http.Handler, method, path, body string, prepare func(*http.Request)) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if prepare != nil {
+		prepare(req)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// requestToken posts form to the token endpoint.
+func requestToken(h http.Handler, form url.Values, prepare func(*http.Request)) *httptest.ResponseRecorder {
+	return serve(h, "POST", "/oauth/token", form.Encode(), func(r *http.Request) {
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if prepare != nil {
+			prepare(r)
+		}
+	})
+}
+
+func TestTokenEndpointIssuesVerifiableTokens(t *testing.T) {
+	h, issuer := newTestServer(t)
+	client := createClient(t, h, token.ScopeUsersRead, token.ScopeUsersWrite)
+
+	for name, rec := range map[string]*httptest.ResponseRecorder{
+		"basic": requestToken(h, url.Values{"grant_type": {"client_credentials"}, "scope": {token.ScopeUsersRead}}, func(r *http.Request) {
+			r.SetBasicAuth(client.ClientID, client.ClientSecret)
+		}),
+		"form": requestToken(h, url.Values{
+			"grant_type":    {"client_credentials"},
+			"client_id":     {client.ClientID},
+			"client_secret": {client.ClientSecret},
+			"scope":         {token.ScopeUsersRead},
+		}, nil),
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+			assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+			var resp oauth.TokenResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, "Bearer", resp.TokenType)
+			assert.Equal(t, token.ScopeUsersRead, resp.Scope)
+			assert.Positive(t, resp.ExpiresIn)
+			assert.True(t, oauth.IsJWT(resp.AccessToken))
+
+			verified, err := issuer.Verify(context.Background(), resp.AccessToken)
+			require.NoError(t, err)
+			assert.Equal(t, client.ClientID, verified.ClientID)
+			assert.Equal(t, "org-1", verified.OrganisationID)
+			assert.Equal(t, []string{token.ScopeUsersRead}, verified.Scopes)
+		})
+	}
+}
+
+func TestTokenEndpointRejectsRequests(t *testing.T) {
+	h, _ := newTestServer(t)
+	client := createClient(t, h, token.ScopeUsersRead)
+
+	tests := []struct {
+		name   string
+		form   url.Values
+		status int
+		error  string
+	}{
+		{"wrong grant type", url.Values{"grant_type": {"password"}, "client_id": {client.ClientID}, "client_secret": {client.ClientSecret}}, http.StatusBadRequest, "unsupported_grant_type"},
+		{"wrong secret", url.Values{"grant_type": {"client_credentials"}, "client_id": {client.ClientID}, "client_secret": {"wrong"}}, http.StatusUnauthorized, "invalid_client"},
+		{"unknown client", url.Values{"grant_type": {"client_credentials"}, "client_id": {"unknown"}, "client_secret": {client.ClientSecret}}, http.StatusUnauthorized, "invalid_client"},
+		{"scope not granted", url.Values{"grant_type": {"client_credentials"}, "client_id": {client.ClientID}, "client_secret": {client.ClientSecret}, "scope": {token.ScopeUsersWrite}}, http.StatusBadRequest, "invalid_scope"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := requestToken(h, tt.form, nil)
+			assert.Equal(t, tt.status, rec.Code, rec.Body.String())
+			var resp oauth.TokenErrorResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, tt.error, resp.Error)
+		})
+	}
+}
+
+func TestRevokedClientTokensStopWorking(t *testing.T) {
+	h, issuer := newTestServer(t)
+	client := createClient(t, h)
+	form := url.Values{"grant_type": {"client_credentials"}, "client_id": {client.ClientID}, "client_secret": {client.ClientSecret}}
+	rec := requestToken(h, form, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp oauth.TokenResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+
+	rec = serve(h, "DELETE", clientsPath+"/"+client.ID, "", func(r *http.Request) {
+		r.SetBasicAuth("admin", databasetest.Password)
+	})
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+
+	_, err := issuer.Verify(context.Background(), resp.AccessToken)
+	assert.ErrorIs(t, err, oauth.ErrInvalidToken, "tokens issued before the revocation are rejected")
+	assert.Equal(t, http.StatusUnauthorized, requestToken(h, form, nil).Code, "no new tokens are issued")
+}
+
+func TestJwksPublishesSigningKey(t *testing.T) {
+	h, issuer := newTestServer(t)
+	signed, err := issuer.Sign(context.Background(), jwt.RegisteredClaims{Subject: "test"}, "")
+	require.NoError(t, err)
+
+	rec := serve(h, "GET", "/.well-known/jwks.json", "", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/jwk-set+json", rec.Header().Get("Content-Type"))
+	set, err := jwks.Parse(rec.Body.Bytes())
+	require.NoError(t, err)
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(signed, jwt.MapClaims{})
+	require.NoError(t, err)
+	var kids []string
+	for _, key := range set.Keys {
+		kids = append(kids, key.Kid)
+	}
+	assert.Contains(t, kids, parsed.Header["kid"])
+}
@@ -0,0 +1,216 @@
+package oauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/token"
+	"github.com/jawee/scimtiplexer/internal/utils"
+)
+
+// audience is the aud claim of access tokens, they are only valid for the
+// SCIM endpoints of this server.
+const audience = "scim"
+
+var (
+	ErrInvalidClient = errors.New("client authentication failed")
+	ErrInvalidScope  = errors.New("requested scope is not granted to the client")
+	ErrInvalidToken  = errors.New("access token is not valid")
+)
+
+// TokenIssuer issues and verifies the short lived JWTs handed out by the
+// client credentials grant.
+type TokenIssuer struct {
+	repo     repository.Querier
+	issuer   string
+	lifetime time.Duration
+	rotation time.Duration
+
+	mu   sync.Mutex
+	keys map[string]*signingKey
+}
+
+func NewTokenIssuer(repo repository.Querier) *TokenIssuer {
+	issuer := os.Getenv(utils.EnvOAuthIssuer)
+	if issuer == "" {
+		issuer = "scimtiplexer"
+	}
+
+	return &TokenIssuer{
+		repo:     repo,
+		issuer:   issuer,
+		lifetime: utils.DurationFromEnv(utils.EnvOAuthTokenLifetime, 15*time.Minute),
+		rotation: utils.DurationFromEnv(utils.EnvOAuthKeyRotation, 24*time.Hour),
+		keys:     make(map[string]*signingKey),
+	}
+}
+
+// AccessTokenClaims are the claims of an issued access token.
+type AccessTokenClaims struct {
+	jwt.RegisteredClaims
+	ClientID string `json:"client_id"`
+	Scope    string `json:"scope"`
+}
+
+type AccessToken struct {
+	Token     string
+	ExpiresIn int
+	Scope     string
+}
+
+// VerifiedToken is the client an access token was issued to.
+type VerifiedToken struct {
+	ClientID       string
+	OrganisationID string
+	Scopes         []string
+}
+
+// Issuer is the iss claim of the access tokens this server issues.
+func (i *TokenIssuer) Issuer() string {
+	return i.issuer
+}
+
+// IssueClientCredentials authenticates a client and issues an access token
+// for the requested scopes. An empty scope requests every scope of the client.
+func (i *TokenIssuer) IssueClientCredentials(ctx context.Context, clientId, clientSecret, scope string) (AccessToken, error) {
+	client, err := i.authenticateClient(ctx, clientId, clientSecret)
+	if err != nil {
+		return AccessToken{}, err
+	}
+
+	granted := token.ParseScopes(client.Scopes)
+	requested := token.ParseScopes(scope)
+	if len(requested) == 0 {
+		requested = granted
+	}
+	for _, s := range requested {
+		if !token.HasScope(granted, s) {
+			return AccessToken{}, ErrInvalidScope
+		}
+	}
+
+	jti, err := uuid.NewV7()
+	if err != nil {
+		return AccessToken{}, errors.New("failed to generate UUID for token id")
+	}
+
+	now := time.Now().UTC()
+	claims := AccessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    i.issuer,
+			Subject:   client.ClientID,
+			Audience:  jwt.ClaimStrings{audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(i.lifetime)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        jti.String(),
+		},
+		ClientID: client.ClientID,
+		Scope:    strings.Join(requested, " "),
+	}
+
+	signed, err := i.Sign(ctx, claims, "")
+	if err != nil {
+		return AccessToken{}, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	return AccessToken{
+		Token:     signed,
+		ExpiresIn: int(i.lifetime.Seconds()),
+		Scope:     claims.Scope,
+	}, nil
+}
+
+// Sign signs claims with the current signing key, so they can be verified
+// with the published key set. typ sets the typ header if it isn't empty.
+func (i *TokenIssuer) Sign(ctx context.Context, claims jwt.Claims, typ string) (string, error) {
+	key, err := i.currentKey(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	jwtToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	jwtToken.Header["kid"] = key.id
+	if typ != "" {
+		jwtToken.Header["typ"] = typ
+	}
+	return jwtToken.SignedString(key.privateKey)
+}
+
+func (i *TokenIssuer) authenticateClient(ctx context.Context, clientId, clientSecret string) (repository.OauthClient, error) {
+	if clientId == "" || clientSecret == "" {
+		return repository.OauthClient{}, ErrInvalidClient
+	}
+
+	client, err := i.repo.GetOauthClientByClientId(ctx, clientId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return repository.OauthClient{}, ErrInvalidClient
+		}
+		return repository.OauthClient{}, fmt.Errorf("failed to GetOauthClientByClientId: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(token.Hash(clientSecret)), []byte(client.SecretHash)) != 1 {
+		return repository.OauthClient{}, ErrInvalidClient
+	}
+	if client.RevokedOnUtc.Valid {
+		return repository.OauthClient{}, ErrInvalidClient
+	}
+
+	return client, nil
+}
+
+// Verify validates an access token issued by this server. The client is
+// looked up again so revoking a client takes effect before its tokens expire.
+func (i *TokenIssuer) Verify(ctx context.Context, raw string) (VerifiedToken, error) {
+	var claims AccessTokenClaims
+	_, err := jwt.ParseWithClaims(raw, &claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := i.verificationKey(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		return &key.privateKey.PublicKey, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(i.issuer),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return VerifiedToken{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	client, err := i.repo.GetOauthClientByClientId(ctx, claims.ClientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return VerifiedToken{}, ErrInvalidToken
+		}
+		return VerifiedToken{}, fmt.Errorf("failed to GetOauthClientByClientId: %w", err)
+	}
+	if client.RevokedOnUtc.Valid {
+		return VerifiedToken{}, fmt.Errorf("%w: client has been revoked", ErrInvalidToken)
+	}
+
+	return VerifiedToken{
+		ClientID:       client.ClientID,
+		OrganisationID: client.OrganisationID,
+		Scopes:         token.ParseScopes(claims.Scope),
+	}, nil
+}
+
+// IsJWT reports whether a bearer token looks like a JWT rather than a static
+// organisation token.
+func IsJWT(raw string) bool {
+	return strings.Count(raw, ".") == 2
+}
@@ -0,0 +1,183 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jawee/scimtiplexer/internal/jwks"
+	"github.com/jawee/scimtiplexer/internal/repository"
+)
+
+// signingKey signs tokens for one rotation period, and is published for
+// another token lifetime after that so tokens signed just before a rotation
+// can still be verified.
+type signingKey struct {
+	id           string
+	privateKey   *rsa.PrivateKey
+	createdOnUtc time.Time
+}
+
+// currentKey returns the key new tokens are signed with, creating a new one
+// when the newest key is older than the rotation period.
+func (i *TokenIssuer) currentKey(ctx context.Context) (*signingKey, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	keys, err := i.loadKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if len(keys) > 0 && now.Sub(keys[0].createdOnUtc) < i.rotation {
+		return keys[0], nil
+	}
+
+	key, err := i.createKey(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, old := range keys {
+		if now.Sub(old.createdOnUtc) > i.rotation+i.lifetime {
+			if err := i.repo.DeleteOauthSigningKey(ctx, old.id); err != nil {
+				slog.Error("failed to DeleteOauthSigningKey", "error", err, "kid", old.id)
+				continue
+			}
+			delete(i.keys, old.id)
+		}
+	}
+
+	return key, nil
+}
+
+// verificationKey returns a published key by its kid.
+func (i *TokenIssuer) verificationKey(ctx context.Context, kid string) (*signingKey, error) {
+	keys, err := i.publishedKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if key.id == kid {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (i *TokenIssuer) publishedKeys(ctx context.Context) ([]*signingKey, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	keys, err := i.loadKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	var published []*signingKey
+	for _, key := range keys {
+		if now.Sub(key.createdOnUtc) <= i.rotation+i.lifetime {
+			published = append(published, key)
+		}
+	}
+	return published, nil
+}
+
+// KeySet returns the public keys for the jwks endpoint.
+func (i *TokenIssuer) KeySet(ctx context.Context) (jwks.Set, error) {
+	keys, err := i.publishedKeys(ctx)
+	if err != nil {
+		return jwks.Set{}, err
+	}
+
+	set := jwks.Set{Keys: []jwks.Key{}}
+	for _, key := range keys {
+		set.Keys = append(set.Keys, jwks.FromRSAPublicKey(key.id, jwt.SigningMethodRS256.Alg(), &key.privateKey.PublicKey))
+	}
+	return set, nil
+}
+
+// loadKeys reads the stored keys, newest first. Parsed keys are cached since
+// keys never change once created. The caller must hold i.mu.
+func (i *TokenIssuer) loadKeys(ctx context.Context) ([]*signingKey, error) {
+	rows, err := i.repo.GetOauthSigningKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetOauthSigningKeys: %w", err)
+	}
+
+	keys := make([]*signingKey, 0, len(rows))
+	for _, row := range rows {
+		if key, ok := i.keys[row.ID]; ok {
+			keys = append(keys, key)
+			continue
+		}
+
+		privateKey, err := parsePrivateKey(row.PrivateKey)
+		if err != nil {
+			slog.Error("failed to parse signing key", "error", err, "kid", row.ID)
+			continue
+		}
+		key := &signingKey{id: row.ID, privateKey: privateKey, createdOnUtc: row.CreatedOnUtc.UTC()}
+		i.keys[row.ID] = key
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (i *TokenIssuer) createKey(ctx context.Context, now time.Time) (*signingKey, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal signing key: %w", err)
+	}
+
+	kid, err := uuid.NewV7()
+	if err != nil {
+		return nil, errors.New("failed to generate UUID for signing key")
+	}
+
+	err = i.repo.CreateOauthSigningKey(ctx, repository.CreateOauthSigningKeyParams{
+		ID:           kid.String(),
+		Algorithm:    jwt.SigningMethodRS256.Alg(),
+		Privatekey:   string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		Createdonutc: now,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to CreateOauthSigningKey: %w", err)
+	}
+
+	slog.Info("Created OAuth signing key", "kid", kid.String())
+	key := &signingKey{id: kid.String(), privateKey: privateKey, createdOnUtc: now}
+	i.keys[key.id] = key
+	return key, nil
+}
+
+func parsePrivateKey(encoded string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(encoded))
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("signing key is not an RSA key")
+	}
+	return privateKey, nil
+}
@@ -0,0 +1,142 @@
+package oauth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/token"
+)
+
+// service manages the OAuth clients of an organisation.
+type service struct {
+	repo repository.Querier
+}
+
+var errInvalidRequest = errors.New("invalid request")
+
+type clientDto struct {
+	ID            string
+	ClientID      string
+	ClientSecret  string
+	Label         string
+	Scopes        []string
+	RevokedOnUtc  *time.Time
+	CreatedBy     string
+	CreatedOnUtc  time.Time
+	ModifiedOnUtc time.Time
+}
+
+func newClientDto(client repository.OauthClient) clientDto {
+	dto := clientDto{
+		ID:            client.ID,
+		ClientID:      client.ClientID,
+		Label:         client.Label.String,
+		Scopes:        token.ParseScopes(client.Scopes),
+		CreatedBy:     client.CreatedBy,
+		CreatedOnUtc:  client.CreatedOnUtc,
+		ModifiedOnUtc: client.ModifiedOnUtc,
+	}
+	if client.RevokedOnUtc.Valid {
+		dto.RevokedOnUtc = &client.RevokedOnUtc.Time
+	}
+	return dto
+}
+
+func (s *service) GetClients(ctx context.Context, organisationId string) ([]clientDto, error) {
+	clients, err := s.repo.GetOauthClients(ctx, organisationId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetOauthClients: %w", err)
+	}
+
+	dtos := make([]clientDto, len(clients))
+	for i, client := range clients {
+		dtos[i] = newClientDto(client)
+	}
+	return dtos, nil
+}
+
+// CreateClient registers a client. The returned dto is the only place the
+// client secret is available.
+func (s *service) CreateClient(ctx context.Context, organisationId, userId string, req ClientRequest) (clientDto, error) {
+	scopes, err := token.FormatScopes(req.Scopes)
+	if err != nil {
+		return clientDto{}, fmt.Errorf("%w: %w", errInvalidRequest, err)
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return clientDto{}, errors.New("failed to generate UUID for new client")
+	}
+	clientId, err := uuid.NewRandom()
+	if err != nil {
+		return clientDto{}, errors.New("failed to generate UUID for client id")
+	}
+
+	secret, err := token.Generate()
+	if err != nil {
+		return clientDto{}, fmt.Errorf("failed to generate client secret: %w", err)
+	}
+
+	now := time.Now().UTC()
+	_, err = s.repo.CreateOauthClient(ctx, repository.CreateOauthClientParams{
+		ID:             id.String(),
+		Organisationid: organisationId,
+		Clientid:       clientId.String(),
+		Secrethash:     token.Hash(secret),
+		Label:          sql.NullString{String: req.Label, Valid: req.Label != ""},
+		Scopes:         scopes,
+		Createdby:      userId,
+		Createdonutc:   now,
+		Modifiedonutc:  now,
+		Modifiedby:     sql.NullString{String: userId, Valid: true},
+	})
+	if err != nil {
+		return clientDto{}, fmt.Errorf("failed to CreateOauthClient: %w", err)
+	}
+
+	dto, err := s.getClient(ctx, organisationId, id.String())
+	if err != nil {
+		return clientDto{}, err
+	}
+	dto.ClientSecret = secret
+	return dto, nil
+}
+
+func (s *service) RevokeClient(ctx context.Context, organisationId, userId, id string) error {
+	current, err := s.getClient(ctx, organisationId, id)
+	if err != nil {
+		return err
+	}
+	if current.RevokedOnUtc != nil {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	err = s.repo.RevokeOauthClient(ctx, repository.RevokeOauthClientParams{
+		Revokedonutc:   sql.NullTime{Time: now, Valid: true},
+		Modifiedonutc:  now,
+		Modifiedby:     sql.NullString{String: userId, Valid: true},
+		ID:             id,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to RevokeOauthClient: %w", err)
+	}
+	return nil
+}
+
+func (s *service) getClient(ctx context.Context, organisationId, id string) (clientDto, error) {
+	client, err := s.repo.GetOauthClientById(ctx, repository.GetOauthClientByIdParams{
+		ID:             id,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return clientDto{}, err
+	}
+	return newClientDto(client), nil
+}
@@ -0,0 +1,93 @@
+// Package oidc signs portal users in with an OpenID Connect provider, using
+// the authorization code flow with PKCE. Users are created on their first
+// sign in, and the claims of their ID token decide which organisations they
+// are members of.
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jawee/scimtiplexer/internal/admin"
+	"github.com/jawee/scimtiplexer/internal/utils"
+)
+
+// config is the provider and claim mapping single sign-on uses, from the
+// OIDC_ environment variables. Single sign-on is disabled when OIDC_ISSUER
+// isn't set.
+type config struct {
+	issuer        string
+	clientId      string
+	clientSecret  string
+	redirectURL   string
+	scopes        string
+	usernameClaim string
+	emailClaim    string
+	mapping       []mappingRule
+}
+
+// mappingRule makes the users whose ID token has Value in Claim members of
+// the organisation with the slug Organisation, with Role. The claim can be a
+// string or a list of strings, like a groups claim. Membership of the
+// organisations in the mapping is managed by the rules: a user no rule
+// matches is removed from them when signing in. Membership of other
+// organisations is left alone.
+//
+// OIDC_CLAIM_MAPPING is a JSON list of rules, for example
+// [{"claim":"groups","value":"scim-admins","organisation":"acme","role":"admin"}].
+type mappingRule struct {
+	Claim        string `json:"claim"`
+	Value        string `json:"value"`
+	Organisation string `json:"organisation"`
+	Role         string `json:"role"`
+}
+
+var errNotConfigured = errors.New("single sign-on is not configured")
+
+func loadConfig() (config, error) {
+	cfg := config{
+		issuer:        strings.TrimSuffix(os.Getenv(utils.EnvOIDCIssuer), "/"),
+		clientId:      os.Getenv(utils.EnvOIDCClientID),
+		clientSecret:  os.Getenv(utils.EnvOIDCClientSecret),
+		redirectURL:   os.Getenv(utils.EnvOIDCRedirectURL),
+		scopes:        envOrDefault(utils.EnvOIDCScopes, "openid profile email"),
+		usernameClaim: envOrDefault(utils.EnvOIDCUsernameClaim, "preferred_username"),
+		emailClaim:    envOrDefault(utils.EnvOIDCEmailClaim, "email"),
+	}
+	if cfg.issuer == "" {
+		return config{}, errNotConfigured
+	}
+	if cfg.clientId == "" {
+		return config{}, errors.New("OIDC_CLIENT_ID is required")
+	}
+	if !strings.Contains(" "+cfg.scopes+" ", " openid ") {
+		cfg.scopes = "openid " + cfg.scopes
+	}
+
+	if value := os.Getenv(utils.EnvOIDCClaimMapping); value != "" {
+		if err := json.Unmarshal([]byte(value), &cfg.mapping); err != nil {
+			return config{}, fmt.Errorf("OIDC_CLAIM_MAPPING is not a JSON list of rules: %w", err)
+		}
+	}
+	for i, rule := range cfg.mapping {
+		if rule.Claim == "" || rule.Value == "" || rule.Organisation == "" {
+			return config{}, fmt.Errorf("OIDC_CLAIM_MAPPING rule %d needs a claim, value and organisation", i)
+		}
+		if rule.Role == "" {
+			cfg.mapping[i].Role = admin.RoleAdmin
+		} else if !admin.ValidRole(rule.Role) {
+			return config{}, fmt.Errorf("OIDC_CLAIM_MAPPING rule %d has role %q, it must be admin or viewer", i, rule.Role)
+		}
+	}
+	return cfg, nil
+}
+
+func envOrDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,219 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/admin"
+	"github.com/jawee/scimtiplexer/internal/database"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/utils"
+)
+
+const (
+	// stateCookie binds a sign in to the browser that started it.
+	stateCookie = "scimtiplexer_oidc_state"
+	// loginTTL is how long a user has to sign in at the provider.
+	loginTTL = 10 * time.Minute
+	// callbackPath is where the provider sends the browser back to, the
+	// redirect URI registered for the client.
+	callbackPath = "/auth/oidc/callback"
+)
+
+type handler struct {
+	service  *service
+	provider *provider
+	auth     *admin.Authenticator
+}
+
+// RegisterEndpoints registers the single sign-on endpoints when OIDC_ISSUER
+// is set.
+func RegisterEndpoints(api *admin.API, auth *admin.Authenticator, db database.Transactor, repo repository.Querier) {
+	cfg, err := loadConfig()
+	if err != nil {
+		if errors.Is(err, errNotConfigured) {
+			slog.Debug("Single sign-on is not configured")
+			return
+		}
+		slog.Error("Single sign-on is disabled", "error", err)
+		return
+	}
+
+	h := &handler{
+		service:  &service{db: db, repo: repo, cfg: cfg},
+		provider: newProvider(cfg),
+		auth:     auth,
+	}
+
+	slog.Debug("Registering single sign-on endpoints", "issuer", cfg.issuer)
+	api.Public("GET", "/auth/oidc/login", h.handleLogin, admin.Operation{
+		Summary:     "Sign in to the portal with the OIDC provider",
+		Description: "Redirects to the provider, which redirects back to the callback.",
+		Query:       []admin.Param{{Name: "redirect", Description: "Path of the portal to return to after signing in, / by default"}},
+		Status:      http.StatusFound,
+	})
+	api.Public("GET", callbackPath, h.handleCallback, admin.Operation{
+		Summary:     "Complete a sign in with the OIDC provider",
+		Description: "Starts a portal session like a login and redirects to the path the sign in was started with.",
+		Query: []admin.Param{
+			{Name: "code", Description: "Authorization code from the provider"},
+			{Name: "state", Description: "State the sign in was started with"},
+		},
+		Status: http.StatusFound,
+	})
+}
+
+// handleLogin starts a sign in. The state, nonce and PKCE code verifier are
+// kept until the provider sends the browser back.
+func (h *handler) handleLogin(w http.ResponseWriter, r *http.Request) {
+	redirect := r.URL.Query().Get("redirect")
+	if !localPath(redirect) {
+		redirect = "/"
+	}
+
+	var tokens [3]string
+	for i := range tokens {
+		random, err := utils.RandomToken()
+		if err != nil {
+			slog.Error("Failed to generate sign in state", "error", err)
+			admin.WriteError(w, http.StatusInternalServerError, "Failed to start sign in")
+			return
+		}
+		tokens[i] = random
+	}
+	state, nonce, codeVerifier := tokens[0], tokens[1], tokens[2]
+	challenge := sha256.Sum256([]byte(codeVerifier))
+
+	authorizationURL, err := h.provider.authorizationURL(r.Context(), h.redirectURL(r), state, nonce, base64.RawURLEncoding.EncodeToString(challenge[:]))
+	if err != nil {
+		writeSignInError(w, err)
+		return
+	}
+
+	if err := h.service.StartLogin(r.Context(), state, nonce, codeVerifier, redirect); err != nil {
+		slog.Error("Failed to start sign in", "error", err)
+		admin.WriteError(w, http.StatusInternalServerError, "Failed to start sign in")
+		return
+	}
+
+	// Lax, as the provider sends the browser back with a cross-site redirect.
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookie,
+		Value:    state,
+		Path:     "/",
+		MaxAge:   int(loginTTL.Seconds()),
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authorizationURL, http.StatusFound)
+}
+
+// handleCallback completes a sign in, starting a portal session for the
+// user of the ID token.
+func (h *handler) handleCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if providerError := query.Get("error"); providerError != "" {
+		slog.Info("Sign in rejected by the identity provider", "error", providerError, "description", query.Get("error_description"))
+		admin.WriteError(w, http.StatusUnauthorized, "Sign in was rejected by the identity provider: "+providerError)
+		return
+	}
+
+	state := query.Get("state")
+	cookie, err := r.Cookie(stateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		admin.WriteError(w, http.StatusBadRequest, "Sign in was not started from this browser")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookie,
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	login, err := h.service.TakeLogin(r.Context(), state)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			admin.WriteError(w, http.StatusBadRequest, "Sign in has expired, start it again")
+			return
+		}
+		slog.Error("Failed to get sign in", "error", err)
+		admin.WriteError(w, http.StatusInternalServerError, "Failed to complete sign in")
+		return
+	}
+
+	code := query.Get("code")
+	if code == "" {
+		admin.WriteError(w, http.StatusBadRequest, "code is required")
+		return
+	}
+	idToken, err := h.provider.exchange(r.Context(), h.redirectURL(r), code, login.CodeVerifier)
+	if err != nil {
+		writeSignInError(w, err)
+		return
+	}
+	claims, err := h.provider.verifyIDToken(r.Context(), idToken, login.Nonce)
+	if err != nil {
+		writeSignInError(w, err)
+		return
+	}
+
+	user, err := h.service.SignIn(r.Context(), claims)
+	if err != nil {
+		writeSignInError(w, err)
+		return
+	}
+	if err := h.auth.StartSession(w, r, user); err != nil {
+		slog.Error("Failed to start session", "error", err)
+		admin.WriteError(w, http.StatusInternalServerError, "Failed to start session")
+		return
+	}
+
+	slog.Info("Admin user signed in with single sign-on", "userid", user.ID)
+	http.Redirect(w, r, login.Redirect, http.StatusFound)
+}
+
+// redirectURL is OIDC_REDIRECT_URL, or the callback on the host the request
+// was made to.
+func (h *handler) redirectURL(r *http.Request) string {
+	if h.service.cfg.redirectURL != "" {
+		return h.service.cfg.redirectURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + admin.APIPrefix + callbackPath
+}
+
+// localPath reports whether a redirect stays on this site.
+func localPath(path string) bool {
+	return strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "//") && !strings.HasPrefix(path, "/\\")
+}
+
+func writeSignInError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errProvider):
+		slog.Error("Identity provider request failed", "error", err)
+		admin.WriteError(w, http.StatusBadGateway, "Identity provider request failed")
+	case errors.Is(err, errInvalidIDToken):
+		slog.Info("Rejected ID token", "error", err)
+		admin.WriteError(w, http.StatusUnauthorized, "Invalid ID token")
+	case errors.Is(err, errMissingClaim), errors.Is(err, errConflict):
+		slog.Info("Rejected single sign-on", "error", err)
+		admin.WriteError(w, http.StatusForbidden, err.Error())
+	default:
+		slog.Error("Single sign-on failed", "error", err)
+		admin.WriteError(w, http.StatusInternalServerError, "Failed to complete sign in")
+	}
+}
@@ -0,0 +1,475 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jawee/scimtiplexer/internal/admin"
+	"github.com/jawee/scimtiplexer/internal/database/databasetest"
+	"github.com/jawee/scimtiplexer/internal/jwks"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testClientId     = "scimtiplexer"
+	testClientSecret = "client-secret"
+	loginPath        = admin.APIPrefix + "/auth/oidc/login"
+)
+
+// testProvider is an OpenID provider that authorizes every sign in. The
+// token endpoint checks the PKCE code verifier against the challenge of the
+// authorization.
+type testProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu             sync.Mutex
+	authorizations map[string]url.Values
+	// claims are set in the ID tokens over the default claims, a nil
+	// value removes the claim.
+	claims jwt.MapClaims
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p := &testProvider{key: key, authorizations: make(map[string]url.Values)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, discoveryDocument{
+			Issuer:                p.URL,
+			AuthorizationEndpoint: p.URL + "/authorize",
+			TokenEndpoint:         p.URL + "/token",
+			JwksURI:               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, jwks.Set{Keys: []jwks.Key{jwks.FromRSAPublicKey("k1", "RS256", &p.key.PublicKey)}})
+	})
+	mux.HandleFunc("POST /token", p.handleToken)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// authorize signs the user in at the authorization URL the login redirected
+// to and returns the code the provider sends back.
+func (p *testProvider) authorize(t *testing.T, authorizationURL string) string {
+	t.Helper()
+	u, err := url.Parse(authorizationURL)
+	require.NoError(t, err)
+	require.Equal(t, p.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+
+	query := u.Query()
+	assert.Equal(t, "code", query.Get("response_type"))
+	assert.Equal(t, testClientId, query.Get("client_id"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.Equal(t, "openid profile email", query.Get("scope"))
+
+	code := uuid.NewString()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.authorizations[code] = query
+	return code
+}
+
+func (p *testProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	clientId, clientSecret, _ := r.BasicAuth()
+	if clientId != testClientId || clientSecret != testClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.mu.Lock()
+	authorization, ok := p.authorizations[r.PostFormValue("code")]
+	delete(p.authorizations, r.PostFormValue("code"))
+	claims := p.claims
+	p.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	switch {
+	case !ok,
+		r.PostFormValue("grant_type") != "authorization_code",
+		r.PostFormValue("redirect_uri") != authorization.Get("redirect_uri"),
+		base64.RawURLEncoding.EncodeToString(challenge[:]) != authorization.Get("code_challenge"):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idClaims := jwt.MapClaims{
+		"iss":   p.URL,
+		"aud":   testClientId,
+		"sub":   "subject-1",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(5 * time.Minute).Unix(),
+		"nonce": authorization.Get("nonce"),
+	}
+	for claim, value := range claims {
+		if value == nil {
+			delete(idClaims, claim)
+		} else {
+			idClaims[claim] = value
+		}
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, idClaims)
+	token.Header["kid"] = "k1"
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id_token": idToken, "token_type": "Bearer"})
+}
+
+func (p *testProvider) setClaims(claims jwt.MapClaims) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.claims = claims
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// newTestServer registers the single sign-on endpoints for the provider.
+func newTestServer(t *testing.T, p *testProvider, mapping string) (http.Handler, repository.Querier) {
+	t.Setenv(utils.EnvOIDCIssuer, p.URL)
+	t.Setenv(utils.EnvOIDCClientID, testClientId)
+	t.Setenv(utils.EnvOIDCClientSecret, testClientSecret)
+	t.Setenv(utils.EnvOIDCClaimMapping, mapping)
+	t.Setenv(utils.EnvPortalSessionSecret, "session-secret")
+
+	db := databasetest.New(t)
+	repo := db.GetRepository()
+	auth := admin.NewAuthenticator(repo)
+	mux := http.NewServeMux()
+	RegisterEndpoints(admin.NewAPI(mux, auth), auth, db, repo)
+	return mux, repo
+}
+
+// startLogin starts a sign in and returns the redirect to the provider and
+// the state cookie.
+func startLogin(t *testing.T, h http.Handler, redirect string) (string, *http.Cookie) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, loginPath+"?redirect="+url.QueryEscape(redirect), nil))
+	require.Equal(t, http.StatusFound, rec.Code, rec.Body.String())
+
+	var state *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == stateCookie {
+			state = c
+		}
+	}
+	require.NotNil(t, state)
+	return rec.Header().Get("Location"), state
+}
+
+func callback(h http.Handler, query url.Values, state *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, admin.APIPrefix+callbackPath+"?"+query.Encode(), nil)
+	if state != nil {
+		req.AddCookie(state)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// signIn signs in at the provider and completes the sign in.
+func signIn(t *testing.T, h http.Handler, p *testProvider) *httptest.ResponseRecorder {
+	t.Helper()
+	authorizationURL, state := startLogin(t, h, "/targets")
+	code := p.authorize(t, authorizationURL)
+	return callback(h, url.Values{"code": {code}, "state": {state.Value}}, state)
+}
+
+func hasCookie(rec *httptest.ResponseRecorder, name string) bool {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == name && c.Value != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLoginUsesPKCE(t *testing.T) {
+	p := newTestProvider(t)
+	h, repo := newTestServer(t, p, "")
+
+	authorizationURL, state := startLogin(t, h, "/targets")
+
+	query, err := url.ParseQuery(authorizationURL[len(p.URL+"/authorize?"):])
+	require.NoError(t, err)
+	assert.Equal(t, state.Value, query.Get("state"))
+	assert.Equal(t, "http://example.com"+admin.APIPrefix+callbackPath, query.Get("redirect_uri"))
+	assert.True(t, state.HttpOnly)
+
+	login, err := repo.GetOidcLogin(context.Background(), state.Value)
+	require.NoError(t, err)
+	assert.Equal(t, login.Nonce, query.Get("nonce"))
+	assert.Equal(t, "/targets", login.Redirect)
+	challenge := sha256.Sum256([]byte(login.CodeVerifier))
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(challenge[:]), query.Get("code_challenge"))
+	assert.Len(t, login.CodeVerifier, 43, "verifier is 32 random bytes")
+
+	// The provider refuses to redeem the code without the verifier.
+	code := p.authorize(t, authorizationURL)
+	prov := newProvider(config{issuer: p.URL, clientId: testClientId, clientSecret: testClientSecret})
+	_, err = prov.exchange(context.Background(), query.Get("redirect_uri"), code, "another-verifier")
+	assert.ErrorIs(t, err, errProvider)
+}
+
+func TestLoginKeepsRedirectOnSite(t *testing.T) {
+	p := newTestProvider(t)
+	h, repo := newTestServer(t, p, "")
+
+	for _, redirect := range []string{"https://attacker.example.com", "//attacker.example.com", "/\\attacker.example.com", ""} {
+		_, state := startLogin(t, h, redirect)
+		login, err := repo.GetOidcLogin(context.Background(), state.Value)
+		require.NoError(t, err)
+		assert.Equal(t, "/", login.Redirect, redirect)
+	}
+}
+
+func TestSignInCreatesUserOnFirstLogin(t *testing.T) {
+	p := newTestProvider(t)
+	h, repo := newTestServer(t, p, "")
+	p.setClaims(jwt.MapClaims{"preferred_username": "alice", "email": "alice@example.com"})
+
+	rec := signIn(t, h, p)
+
+	require.Equal(t, http.StatusFound, rec.Code, rec.Body.String())
+	assert.Equal(t, "/targets", rec.Header().Get("Location"))
+	assert.True(t, hasCookie(rec, "scimtiplexer_session"), "session is started")
+	user, err := repo.GetUserByUsername(context.Background(), "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", user.Email)
+	assert.Empty(t, user.Password, "single sign-on users can't log in with a password")
+
+	// The account is linked to the user by its subject from then on.
+	p.setClaims(jwt.MapClaims{"preferred_username": "alice.smith", "email": "alice.smith@example.com"})
+	rec = signIn(t, h, p)
+
+	require.Equal(t, http.StatusFound, rec.Code, rec.Body.String())
+	_, err = repo.GetUserByUsername(context.Background(), "alice.smith")
+	assert.Error(t, err, "no second user is created")
+	identity, err := repo.GetOidcIdentity(context.Background(), repository.GetOidcIdentityParams{Issuer: p.URL, Subject: "subject-1"})
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, identity.UserID)
+}
+
+func TestSignInLinksVerifiedEmail(t *testing.T) {
+	p := newTestProvider(t)
+	h, repo := newTestServer(t, p, "")
+	now := time.Now().UTC()
+	_, err := repo.RegisterUser(context.Background(), repository.RegisterUserParams{
+		ID: "existing", Username: "alice", Email: "alice@example.com", Password: "hash", Createdonutc: now, Modifiedonutc: now,
+	})
+	require.NoError(t, err)
+
+	p.setClaims(jwt.MapClaims{"preferred_username": "asmith", "email": "alice@example.com"})
+	rec := signIn(t, h, p)
+	assert.Equal(t, http.StatusForbidden, rec.Code, "an unverified email doesn't link to the user with it")
+
+	p.setClaims(jwt.MapClaims{"preferred_username": "asmith", "email": "alice@example.com", "email_verified": true})
+	rec = signIn(t, h, p)
+	require.Equal(t, http.StatusFound, rec.Code, rec.Body.String())
+	identity, err := repo.GetOidcIdentity(context.Background(), repository.GetOidcIdentityParams{Issuer: p.URL, Subject: "subject-1"})
+	require.NoError(t, err)
+	assert.Equal(t, "existing", identity.UserID)
+}
+
+func TestCallbackRejectsWrongState(t *testing.T) {
+	p := newTestProvider(t)
+	h, _ := newTestServer(t, p, "")
+	p.setClaims(jwt.MapClaims{"preferred_username": "alice", "email": "alice@example.com"})
+	authorizationURL, state := startLogin(t, h, "/")
+	code := p.authorize(t, authorizationURL)
+	_, otherState := startLogin(t, h, "/")
+
+	tests := []struct {
+		name   string
+		state  string
+		cookie *http.Cookie
+	}{
+		{"missing state", "", state},
+		{"missing cookie", state.Value, nil},
+		{"state of another browser", state.Value, otherState},
+		{"state not started", "unknown", &http.Cookie{Name: stateCookie, Value: "unknown"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := callback(h, url.Values{"code": {code}, "state": {tt.state}}, tt.cookie)
+
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.False(t, hasCookie(rec, "scimtiplexer_session"))
+		})
+	}
+
+	rec := callback(h, url.Values{"code": {code}, "state": {state.Value}}, state)
+	require.Equal(t, http.StatusFound, rec.Code, rec.Body.String())
+	rec = callback(h, url.Values{"code": {code}, "state": {state.Value}}, state)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "a state can only be used once")
+}
+
+func TestCallbackRejectsInvalidIDToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+	}{
+		{"wrong nonce", jwt.MapClaims{"nonce": "replayed"}},
+		{"missing nonce", jwt.MapClaims{"nonce": nil}},
+		{"wrong issuer", jwt.MapClaims{"iss": "https://attacker.example.com"}},
+		{"wrong audience", jwt.MapClaims{"aud": "another-client"}},
+		{"issued to another client", jwt.MapClaims{"aud": []string{testClientId, "another-client"}, "azp": "another-client"}},
+		{"expired", jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}},
+		{"missing subject", jwt.MapClaims{"sub": nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProvider(t)
+			h, repo := newTestServer(t, p, "")
+			claims := jwt.MapClaims{"preferred_username": "alice", "email": "alice@example.com"}
+			for claim, value := range tt.claims {
+				claims[claim] = value
+			}
+			p.setClaims(claims)
+
+			rec := signIn(t, h, p)
+
+			assert.Equal(t, http.StatusUnauthorized, rec.Code, rec.Body.String())
+			assert.False(t, hasCookie(rec, "scimtiplexer_session"))
+			_, err := repo.GetUserByUsername(context.Background(), "alice")
+			assert.Error(t, err, "no user is created")
+		})
+	}
+}
+
+func TestSignInMapsClaimsToRoles(t *testing.T) {
+	p := newTestProvider(t)
+	h, repo := newTestServer(t, p, `[
+		{"claim": "groups", "value": "scim-admins", "organisation": "acme", "role": "admin"},
+		{"claim": "groups", "value": "scim-viewers", "organisation": "acme", "role": "viewer"},
+		{"claim": "groups", "value": "scim-viewers", "organisation": "globex", "role": "viewer"},
+		{"claim": "department", "value": "it", "organisation": "initech"}
+	]`)
+	ctx := context.Background()
+	organisations := make(map[string]string)
+	for _, slug := range []string{"acme", "globex", "initech", "umbrella"} {
+		now := time.Now().UTC()
+		id, err := repo.CreateOrganisation(ctx, repository.CreateOrganisationParams{
+			ID: uuid.NewString(), Name: slug, Slug: slug, Createdonutc: now, Modifiedonutc: now,
+		})
+		require.NoError(t, err)
+		organisations[slug] = id
+	}
+	role := func(userId, slug string) string {
+		member, err := repo.GetOrganisationUser(ctx, repository.GetOrganisationUserParams{Userid: userId, Organisationid: organisations[slug]})
+		if err != nil {
+			return ""
+		}
+		return member.Role
+	}
+
+	p.setClaims(jwt.MapClaims{
+		"preferred_username": "alice",
+		"email":              "alice@example.com",
+		"groups":             []string{"scim-viewers", "scim-admins"},
+		"department":         "it",
+	})
+	rec := signIn(t, h, p)
+
+	require.Equal(t, http.StatusFound, rec.Code, rec.Body.String())
+	user, err := repo.GetUserByUsername(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, admin.RoleAdmin, role(user.ID, "acme"), "admin wins when several rules match")
+	assert.Equal(t, admin.RoleViewer, role(user.ID, "globex"))
+	assert.Equal(t, admin.RoleAdmin, role(user.ID, "initech"), "rules without a role grant admin")
+	assert.Empty(t, role(user.ID, "umbrella"))
+
+	// Membership of organisations outside the mapping is left alone.
+	now := time.Now().UTC()
+	require.NoError(t, repo.CreateOrganisationUser(ctx, repository.CreateOrganisationUserParams{
+		Userid: user.ID, Organisationid: organisations["umbrella"], Role: admin.RoleViewer, Createdonutc: now, Modifiedonutc: now,
+	}))
+	// Another admin, so alice isn't the last one to be demoted or removed.
+	bob := databasetest.CreateMember(t, repo, "bob", organisations["acme"], admin.RoleAdmin)
+	require.NoError(t, repo.CreateOrganisationUser(ctx, repository.CreateOrganisationUserParams{
+		Userid: bob, Organisationid: organisations["initech"], Role: admin.RoleAdmin, Createdonutc: now, Modifiedonutc: now,
+	}))
+
+	p.setClaims(jwt.MapClaims{
+		"preferred_username": "alice",
+		"email":              "alice@example.com",
+		"groups":             "scim-viewers",
+	})
+	rec = signIn(t, h, p)
+
+	require.Equal(t, http.StatusFound, rec.Code, rec.Body.String())
+	assert.Equal(t, admin.RoleViewer, role(user.ID, "acme"))
+	assert.Equal(t, admin.RoleViewer, role(user.ID, "globex"))
+	assert.Empty(t, role(user.ID, "initech"), "removed when no rule matches")
+	assert.Equal(t, admin.RoleViewer, role(user.ID, "umbrella"))
+}
+
+func TestSignInKeepsLastAdmin(t *testing.T) {
+	p := newTestProvider(t)
+	h, repo := newTestServer(t, p, `[
+		{"claim": "groups", "value": "scim-admins", "organisation": "acme", "role": "admin"},
+		{"claim": "groups", "value": "scim-viewers", "organisation": "acme", "role": "viewer"},
+		{"claim": "groups", "value": "scim-admins", "organisation": "globex", "role": "admin"}
+	]`)
+	ctx := context.Background()
+	organisations := make(map[string]string)
+	for _, slug := range []string{"acme", "globex"} {
+		now := time.Now().UTC()
+		id, err := repo.CreateOrganisation(ctx, repository.CreateOrganisationParams{
+			ID: uuid.NewString(), Name: slug, Slug: slug, Createdonutc: now, Modifiedonutc: now,
+		})
+		require.NoError(t, err)
+		organisations[slug] = id
+	}
+	// The acme viewer doesn't count as an admin.
+	databasetest.CreateMember(t, repo, "bob", organisations["acme"], admin.RoleViewer)
+
+	p.setClaims(jwt.MapClaims{
+		"preferred_username": "alice",
+		"email":              "alice@example.com",
+		"groups":             "scim-admins",
+	})
+	require.Equal(t, http.StatusFound, signIn(t, h, p).Code)
+	user, err := repo.GetUserByUsername(ctx, "alice")
+	require.NoError(t, err)
+
+	p.setClaims(jwt.MapClaims{
+		"preferred_username": "alice",
+		"email":              "alice@example.com",
+		"groups":             "scim-viewers",
+	})
+	rec := signIn(t, h, p)
+
+	require.Equal(t, http.StatusFound, rec.Code, rec.Body.String())
+	for _, slug := range []string{"acme", "globex"} {
+		member, err := repo.GetOrganisationUser(ctx, repository.GetOrganisationUserParams{Userid: user.ID, Organisationid: organisations[slug]})
+		require.NoError(t, err, "the last admin of %s is kept", slug)
+		assert.Equal(t, admin.RoleAdmin, member.Role, "the last admin of %s isn't demoted", slug)
+	}
+}
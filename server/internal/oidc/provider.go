@@ -0,0 +1,289 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jawee/scimtiplexer/internal/jwks"
+)
+
+const (
+	// discoveryTTL is how long the discovery document of the provider is
+	// used before it is fetched again.
+	discoveryTTL = time.Hour
+	// keySetTTL is how long a fetched key set is used before it is fetched
+	// again.
+	keySetTTL = 10 * time.Minute
+	// refreshInterval limits how often an unknown kid forces a refetch.
+	refreshInterval = time.Minute
+	// maxResponseSize limits the size of the responses of the provider.
+	maxResponseSize = 1 << 20
+)
+
+var (
+	errProvider       = errors.New("identity provider request failed")
+	errInvalidIDToken = errors.New("ID token is not valid")
+	errUnknownKey     = errors.New("unknown signing key")
+)
+
+// signingMethods are the algorithms accepted for ID tokens.
+var signingMethods = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+// provider talks to the OIDC provider, caching its discovery document and
+// key set.
+type provider struct {
+	cfg    config
+	client *http.Client
+
+	mu           sync.Mutex
+	discovery    discoveryDocument
+	discoveredAt time.Time
+	keys         jwks.Set
+	keysFetched  time.Time
+}
+
+func newProvider(cfg config) *provider {
+	return &provider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *provider) discover(ctx context.Context) (discoveryDocument, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.discoveredAt.IsZero() && time.Since(p.discoveredAt) < discoveryTTL {
+		return p.discovery, nil
+	}
+
+	data, err := p.get(ctx, p.cfg.issuer+"/.well-known/openid-configuration")
+	if err != nil {
+		return discoveryDocument{}, err
+	}
+	var doc discoveryDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return discoveryDocument{}, fmt.Errorf("%w: invalid discovery document: %w", errProvider, err)
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != p.cfg.issuer {
+		return discoveryDocument{}, fmt.Errorf("%w: discovery document is for issuer %q", errProvider, doc.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JwksURI == "" {
+		return discoveryDocument{}, fmt.Errorf("%w: discovery document is missing endpoints", errProvider)
+	}
+
+	p.discovery = doc
+	p.discoveredAt = time.Now()
+	return doc, nil
+}
+
+// authorizationURL is where the browser is sent to sign in.
+func (p *provider) authorizationURL(ctx context.Context, redirectURL, state, nonce, codeChallenge string) (string, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(doc.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid authorization endpoint: %w", errProvider, err)
+	}
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.clientId)
+	query.Set("redirect_uri", redirectURL)
+	query.Set("scope", p.cfg.scopes)
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// exchange redeems an authorization code at the token endpoint and returns
+// the ID token. The client authenticates with client_secret_basic when it
+// has a secret.
+func (p *provider) exchange(ctx context.Context, redirectURL, code, codeVerifier string) (string, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	if p.cfg.clientSecret == "" {
+		form.Set("client_id", p.cfg.clientId)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.clientId), url.QueryEscape(p.cfg.clientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errProvider, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errProvider, err)
+	}
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return "", fmt.Errorf("%w: token endpoint returned %s", errProvider, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: token endpoint returned %s: %s %s", errProvider, resp.Status, tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return "", fmt.Errorf("%w: token endpoint returned no ID token", errProvider)
+	}
+	return tokens.IDToken, nil
+}
+
+// verifyIDToken validates an ID token and returns its claims.
+func (p *provider) verifyIDToken(ctx context.Context, raw, nonce string) (jwt.MapClaims, error) {
+	var keyErr error
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := p.key(ctx, kid)
+		if err != nil {
+			keyErr = err
+			return nil, err
+		}
+		return key, nil
+	},
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(p.cfg.issuer),
+		jwt.WithAudience(p.cfg.clientId),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		if keyErr != nil && !errors.Is(keyErr, errUnknownKey) {
+			return nil, keyErr
+		}
+		return nil, fmt.Errorf("%w: %w", errInvalidIDToken, err)
+	}
+
+	if value, _ := claims["nonce"].(string); value != nonce {
+		return nil, fmt.Errorf("%w: nonce does not match", errInvalidIDToken)
+	}
+	if azp, ok := claims["azp"].(string); ok && azp != p.cfg.clientId {
+		return nil, fmt.Errorf("%w: token was issued to %q", errInvalidIDToken, azp)
+	}
+	if subject, _ := claims.GetSubject(); subject == "" {
+		return nil, fmt.Errorf("%w: missing sub claim", errInvalidIDToken)
+	}
+	return claims, nil
+}
+
+// key returns the public key with the given kid from the key set of the
+// provider, fetching the set again when the kid is unknown as the provider
+// may have rotated its keys.
+func (p *provider) key(ctx context.Context, kid string) (any, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	age := time.Since(p.keysFetched)
+	key, ok := p.keys.Find(kid)
+	if ok && age < keySetTTL {
+		return key.PublicKey()
+	}
+	if !p.keysFetched.IsZero() && age < refreshInterval {
+		return nil, fmt.Errorf("%w %q", errUnknownKey, kid)
+	}
+
+	data, err := p.get(ctx, doc.JwksURI)
+	if err != nil {
+		return nil, err
+	}
+	set, err := jwks.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid key set: %w", errProvider, err)
+	}
+	p.keys = set
+	p.keysFetched = time.Now()
+
+	key, ok = set.Find(kid)
+	if !ok {
+		return nil, fmt.Errorf("%w %q", errUnknownKey, kid)
+	}
+	return key.PublicKey()
+}
+
+func (p *provider) get(ctx context.Context, uri string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errProvider, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s returned %s", errProvider, uri, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errProvider, err)
+	}
+	return data, nil
+}
+
+// claimMatches reports whether a claim is value or a list containing it.
+func claimMatches(claim any, value string) bool {
+	switch c := claim.(type) {
+	case string:
+		return c == value
+	case []any:
+		return slices.ContainsFunc(c, func(v any) bool {
+			s, ok := v.(string)
+			return ok && s == value
+		})
+	case nil:
+		return false
+	}
+	return fmt.Sprint(claim) == value
+}
@@ -0,0 +1,265 @@
+package oidc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jawee/scimtiplexer/internal/admin"
+	"github.com/jawee/scimtiplexer/internal/database"
+	"github.com/jawee/scimtiplexer/internal/repository"
+)
+
+var (
+	errMissingClaim = errors.New("ID token is missing a claim")
+	errConflict     = errors.New("conflict")
+)
+
+type service struct {
+	db   database.Transactor
+	repo repository.Querier
+	cfg  config
+}
+
+// StartLogin keeps a sign in that was sent to the provider until it comes
+// back, and drops the ones that never did.
+func (s *service) StartLogin(ctx context.Context, state, nonce, codeVerifier, redirect string) error {
+	now := time.Now().UTC()
+	if _, err := s.repo.DeleteExpiredOidcLogins(ctx, now.Add(-loginTTL)); err != nil {
+		return fmt.Errorf("failed to DeleteExpiredOidcLogins: %w", err)
+	}
+
+	err := s.repo.CreateOidcLogin(ctx, repository.CreateOidcLoginParams{
+		State:        state,
+		Nonce:        nonce,
+		Codeverifier: codeVerifier,
+		Redirect:     redirect,
+		Createdonutc: now,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to CreateOidcLogin: %w", err)
+	}
+	return nil
+}
+
+// TakeLogin returns a sign in that was started and deletes it, so a state
+// can only be used once. It returns sql.ErrNoRows when there is no such
+// sign in or it has expired.
+func (s *service) TakeLogin(ctx context.Context, state string) (repository.OidcLogin, error) {
+	login, err := s.repo.GetOidcLogin(ctx, state)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return repository.OidcLogin{}, err
+		}
+		return repository.OidcLogin{}, fmt.Errorf("failed to GetOidcLogin: %w", err)
+	}
+	deleted, err := s.repo.DeleteOidcLogin(ctx, state)
+	if err != nil {
+		return repository.OidcLogin{}, fmt.Errorf("failed to DeleteOidcLogin: %w", err)
+	}
+	if deleted == 0 || time.Since(login.CreatedOnUtc) > loginTTL {
+		return repository.OidcLogin{}, sql.ErrNoRows
+	}
+	return login, nil
+}
+
+// SignIn returns the portal user of the account an ID token is for. The
+// first time an account signs in it's linked to the user with its email, if
+// the provider has verified it, or a user is created for it. The
+// memberships of the user are then updated from the claim mapping.
+func (s *service) SignIn(ctx context.Context, claims jwt.MapClaims) (repository.User, error) {
+	subject, _ := claims.GetSubject()
+
+	var user repository.User
+	err := s.db.WithTx(ctx, func(repo repository.Querier) error {
+		now := time.Now().UTC()
+		identity, err := repo.GetOidcIdentity(ctx, repository.GetOidcIdentityParams{
+			Issuer:  s.cfg.issuer,
+			Subject: subject,
+		})
+		switch {
+		case err == nil:
+			user, err = repo.GetUserById(ctx, identity.UserID)
+			if err != nil {
+				return fmt.Errorf("failed to GetUserById: %w", err)
+			}
+			err = repo.UpdateOidcIdentityLastLogin(ctx, repository.UpdateOidcIdentityLastLoginParams{
+				Lastloginonutc: now,
+				Issuer:         s.cfg.issuer,
+				Subject:        subject,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to UpdateOidcIdentityLastLogin: %w", err)
+			}
+		case errors.Is(err, sql.ErrNoRows):
+			user, err = s.linkUser(ctx, repo, claims)
+			if err != nil {
+				return err
+			}
+			err = repo.CreateOidcIdentity(ctx, repository.CreateOidcIdentityParams{
+				Issuer:         s.cfg.issuer,
+				Subject:        subject,
+				Userid:         user.ID,
+				Createdonutc:   now,
+				Lastloginonutc: now,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to CreateOidcIdentity: %w", err)
+			}
+		default:
+			return fmt.Errorf("failed to GetOidcIdentity: %w", err)
+		}
+
+		return s.syncMemberships(ctx, repo, user, claims)
+	})
+	if err != nil {
+		return repository.User{}, err
+	}
+	return user, nil
+}
+
+// linkUser finds or creates the portal user for an account signing in for
+// the first time.
+func (s *service) linkUser(ctx context.Context, repo repository.Querier, claims jwt.MapClaims) (repository.User, error) {
+	subject, _ := claims.GetSubject()
+	email, _ := claims[s.cfg.emailClaim].(string)
+	if email == "" {
+		return repository.User{}, fmt.Errorf("%w: %s", errMissingClaim, s.cfg.emailClaim)
+	}
+
+	if verified, _ := claims["email_verified"].(bool); verified {
+		user, err := repo.GetUserByEmail(ctx, email)
+		if err == nil {
+			slog.Info("Linked single sign-on account to portal user", "userid", user.ID, "subject", subject)
+			return user, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return repository.User{}, fmt.Errorf("failed to GetUserByEmail: %w", err)
+		}
+	}
+
+	username, _ := claims[s.cfg.usernameClaim].(string)
+	if username == "" {
+		username = email
+	}
+	if _, err := repo.GetUserByUsername(ctx, username); err == nil {
+		return repository.User{}, fmt.Errorf("%w: a portal user named %s already exists", errConflict, username)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return repository.User{}, fmt.Errorf("failed to GetUserByUsername: %w", err)
+	}
+	if _, err := repo.GetUserByEmail(ctx, email); err == nil {
+		return repository.User{}, fmt.Errorf("%w: another portal user has the email %s", errConflict, email)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return repository.User{}, fmt.Errorf("failed to GetUserByEmail: %w", err)
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return repository.User{}, errors.New("failed to generate UUID for new user")
+	}
+	now := time.Now().UTC()
+	// Users created by single sign-on have no password, they can't log in
+	// with one.
+	_, err = repo.RegisterUser(ctx, repository.RegisterUserParams{
+		ID:            id.String(),
+		Username:      username,
+		Email:         email,
+		Password:      "",
+		Createdonutc:  now,
+		Modifiedonutc: now,
+	})
+	if err != nil {
+		return repository.User{}, fmt.Errorf("failed to RegisterUser: %w", err)
+	}
+
+	slog.Info("Created portal user on first single sign-on", "userid", id.String(), "username", username, "subject", subject)
+	return repo.GetUserById(ctx, id.String())
+}
+
+// syncMemberships makes the user a member of the organisations the claim
+// mapping grants it, and removes it from the organisations in the mapping
+// that it doesn't. When several rules match an organisation admin wins. The
+// last admin of an organisation is neither removed nor made a viewer.
+func (s *service) syncMemberships(ctx context.Context, repo repository.Querier, user repository.User, claims jwt.MapClaims) error {
+	roles := make(map[string]string)
+	var slugs []string
+	for _, rule := range s.cfg.mapping {
+		if _, ok := roles[rule.Organisation]; !ok {
+			roles[rule.Organisation] = ""
+			slugs = append(slugs, rule.Organisation)
+		}
+		if claimMatches(claims[rule.Claim], rule.Value) && roles[rule.Organisation] != admin.RoleAdmin {
+			roles[rule.Organisation] = rule.Role
+		}
+	}
+
+	now := time.Now().UTC()
+	for _, slug := range slugs {
+		organisation, err := repo.GetOrganisationBySlug(ctx, slug)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				slog.Warn("Claim mapping refers to an unknown organisation", "slug", slug)
+				continue
+			}
+			return fmt.Errorf("failed to GetOrganisationBySlug: %w", err)
+		}
+
+		role := roles[slug]
+		if role != admin.RoleAdmin {
+			keep, err := isLastAdmin(ctx, repo, user.ID, organisation.ID)
+			if err != nil {
+				return err
+			}
+			if keep {
+				slog.Warn("Kept the last admin of an organisation despite the claim mapping", "userid", user.ID, "organisationid", organisation.ID)
+				continue
+			}
+		}
+		if role == "" {
+			removed, err := repo.DeleteOrganisationUser(ctx, repository.DeleteOrganisationUserParams{
+				Userid:         user.ID,
+				Organisationid: organisation.ID,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to DeleteOrganisationUser: %w", err)
+			}
+			if removed > 0 {
+				slog.Info("Removed portal user from organisation by claim mapping", "userid", user.ID, "organisationid", organisation.ID)
+			}
+			continue
+		}
+
+		err = repo.UpsertOrganisationUser(ctx, repository.UpsertOrganisationUserParams{
+			Userid:         user.ID,
+			Organisationid: organisation.ID,
+			Role:           role,
+			Createdonutc:   now,
+			Modifiedonutc:  now,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to UpsertOrganisationUser: %w", err)
+		}
+	}
+	return nil
+}
+
+// isLastAdmin reports whether the user is the last admin of the
+// organisation.
+func isLastAdmin(ctx context.Context, repo repository.Querier, userId, organisationId string) (bool, error) {
+	member, err := repo.GetOrganisationUser(ctx, repository.GetOrganisationUserParams{
+		Userid:         userId,
+		Organisationid: organisationId,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to GetOrganisationUser: %w", err)
+	}
+	return admin.IsLastAdmin(ctx, repo, member)
+}
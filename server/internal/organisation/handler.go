@@ -0,0 +1,249 @@
+package organisation
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/admin"
+	"github.com/jawee/scimtiplexer/internal/database"
+	"github.com/jawee/scimtiplexer/internal/repository"
+)
+
+type handler struct {
+	service *service
+}
+
+func RegisterEndpoints(api *admin.API, db database.Service, repo repository.Querier) {
+	h := &handler{
+		service: &service{db: db, repo: repo},
+	}
+
+	slog.Debug("Registering organisation endpoints")
+	api.User("GET", "/orgs", h.handleGetOrganisations, admin.Operation{
+		Summary:  "List the organisations you are a member of",
+		Response: []OrganisationResponse{},
+	})
+	api.User("POST", "/orgs", h.handlePostOrganisation, admin.Operation{
+		Summary:  "Create an organisation, with you as its first member",
+		Request:  OrganisationRequest{},
+		Response: OrganisationResponse{},
+		Status:   http.StatusCreated,
+	})
+	api.Member("GET", "/orgs/{orgId}", h.handleGetOrganisation, admin.Operation{
+		Summary:  "Get an organisation",
+		Response: OrganisationResponse{},
+	})
+	api.Member("PATCH", "/orgs/{orgId}", h.handlePatchOrganisation, admin.Operation{
+		Summary:  "Rename an organisation or change its slug",
+		Request:  OrganisationUpdateRequest{},
+		Response: OrganisationResponse{},
+	})
+	api.Member("DELETE", "/orgs/{orgId}", h.handleDeleteOrganisation, admin.Operation{
+		Summary: "Delete an organisation and everything it holds",
+		Status:  http.StatusNoContent,
+	})
+	api.Member("GET", "/orgs/{orgId}/members", h.handleGetMembers, admin.Operation{
+		Summary:  "List the members of an organisation",
+		Response: []MemberResponse{},
+	})
+	api.Member("POST", "/orgs/{orgId}/members", h.handlePostMember, admin.Operation{
+		Summary:  "Invite a portal user to an organisation",
+		Request:  MemberRequest{},
+		Response: MemberResponse{},
+		Status:   http.StatusCreated,
+	})
+	api.Member("DELETE", "/orgs/{orgId}/members/{userId}", h.handleDeleteMember, admin.Operation{
+		Summary: "Remove a member from an organisation",
+		Status:  http.StatusNoContent,
+	})
+}
+
+// OrganisationResponse describes an organisation. Its SCIM endpoints are
+// also served under /scim/{slug}/v2/.
+type OrganisationResponse struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	Slug          string    `json:"slug"`
+	CreatedBy     string    `json:"createdBy,omitempty"`
+	CreatedOnUtc  time.Time `json:"createdOnUtc"`
+	ModifiedOnUtc time.Time `json:"modifiedOnUtc"`
+}
+
+func newOrganisationResponse(o organisationDto) OrganisationResponse {
+	return OrganisationResponse{
+		ID:            o.ID,
+		Name:          o.Name,
+		Slug:          o.Slug,
+		CreatedBy:     o.CreatedBy,
+		CreatedOnUtc:  o.CreatedOnUtc,
+		ModifiedOnUtc: o.ModifiedOnUtc,
+	}
+}
+
+// OrganisationRequest creates an organisation. Slug is lowercase letters,
+// digits and hyphens, such as acme-corp.
+type OrganisationRequest struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+// OrganisationUpdateRequest changes the fields that are set.
+type OrganisationUpdateRequest struct {
+	Name *string `json:"name"`
+	Slug *string `json:"slug"`
+}
+
+// MemberResponse describes a member of an organisation. InitialPassword is
+// only set in the response that created the portal user.
+type MemberResponse struct {
+	ID              string    `json:"id"`
+	Username        string    `json:"username"`
+	Email           string    `json:"email"`
+	Role            string    `json:"role"`
+	MemberSinceUtc  time.Time `json:"memberSinceUtc"`
+	InitialPassword string    `json:"initialPassword,omitempty"`
+}
+
+func newMemberResponse(m memberDto) MemberResponse {
+	return MemberResponse{
+		ID:              m.ID,
+		Username:        m.Username,
+		Email:           m.Email,
+		Role:            m.Role,
+		MemberSinceUtc:  m.MemberSinceUtc,
+		InitialPassword: m.InitialPassword,
+	}
+}
+
+// MemberRequest invites the portal user with Username, or with Email when
+// Username is left out. A user that doesn't exist yet is created when both
+// are given. Role is admin or viewer, admin when left out.
+type MemberRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+}
+
+func (h *handler) handleGetOrganisations(w http.ResponseWriter, r *http.Request) {
+	organisations, err := h.service.GetOrganisations(r.Context(), admin.UserID(r.Context()))
+	if err != nil {
+		writeServiceError(w, err, "Failed to get organisations")
+		return
+	}
+
+	resp := make([]OrganisationResponse, len(organisations))
+	for i, o := range organisations {
+		resp[i] = newOrganisationResponse(o)
+	}
+	admin.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (h *handler) handlePostOrganisation(w http.ResponseWriter, r *http.Request) {
+	var req OrganisationRequest
+	if !admin.ReadJSON(w, r, &req) {
+		return
+	}
+
+	organisation, err := h.service.CreateOrganisation(r.Context(), admin.UserID(r.Context()), req)
+	if err != nil {
+		writeServiceError(w, err, "Failed to create organisation")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusCreated, newOrganisationResponse(organisation))
+}
+
+func (h *handler) handleGetOrganisation(w http.ResponseWriter, r *http.Request) {
+	organisation, err := h.service.GetOrganisation(r.Context(), r.PathValue("orgId"))
+	if err != nil {
+		writeServiceError(w, err, "Failed to get organisation")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusOK, newOrganisationResponse(organisation))
+}
+
+func (h *handler) handlePatchOrganisation(w http.ResponseWriter, r *http.Request) {
+	var req OrganisationUpdateRequest
+	if !admin.ReadJSON(w, r, &req) {
+		return
+	}
+
+	organisation, err := h.service.UpdateOrganisation(r.Context(), r.PathValue("orgId"), admin.UserID(r.Context()), req)
+	if err != nil {
+		writeServiceError(w, err, "Failed to update organisation")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusOK, newOrganisationResponse(organisation))
+}
+
+func (h *handler) handleDeleteOrganisation(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.DeleteOrganisation(r.Context(), r.PathValue("orgId")); err != nil {
+		writeServiceError(w, err, "Failed to delete organisation")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) handleGetMembers(w http.ResponseWriter, r *http.Request) {
+	members, err := h.service.GetMembers(r.Context(), r.PathValue("orgId"))
+	if err != nil {
+		writeServiceError(w, err, "Failed to get members")
+		return
+	}
+
+	resp := make([]MemberResponse, len(members))
+	for i, m := range members {
+		resp[i] = newMemberResponse(m)
+	}
+	admin.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (h *handler) handlePostMember(w http.ResponseWriter, r *http.Request) {
+	var req MemberRequest
+	if !admin.ReadJSON(w, r, &req) {
+		return
+	}
+
+	member, err := h.service.AddMember(r.Context(), r.PathValue("orgId"), admin.UserID(r.Context()), req)
+	if err != nil {
+		writeServiceError(w, err, "Failed to add member")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusCreated, newMemberResponse(member))
+}
+
+func (h *handler) handleDeleteMember(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.RemoveMember(r.Context(), r.PathValue("orgId"), r.PathValue("userId")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			admin.WriteError(w, http.StatusNotFound, "Member not found")
+			return
+		}
+		writeServiceError(w, err, "Failed to remove member")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeServiceError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		admin.WriteError(w, http.StatusNotFound, "Organisation not found")
+		return
+	case errors.Is(err, errInvalidRequest):
+		admin.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, errConflict), errors.Is(err, errLastAdmin):
+		admin.WriteError(w, http.StatusConflict, err.Error())
+		return
+	}
+	slog.Error(message, "error", err)
+	admin.WriteError(w, http.StatusInternalServerError, message)
+}
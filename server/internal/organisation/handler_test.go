@@ -0,0 +1,38 @@
+package organisation_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jawee/scimtiplexer/internal/admin"
+	"github.com/jawee/scimtiplexer/internal/database/databasetest"
+	"github.com/jawee/scimtiplexer/internal/organisation"
+	"github.com/stretchr/testify/assert"
+)
+
+const membersPath = admin.APIPrefix + "/orgs/org-1/members/"
+
+func TestRemoveMemberKeepsLastAdmin(t *testing.T) {
+	db := databasetest.New(t)
+	repo := db.GetRepository()
+	alice := databasetest.CreateMember(t, repo, "alice", "org-1", admin.RoleAdmin)
+	bob := databasetest.CreateMember(t, repo, "bob", "org-1", admin.RoleViewer)
+	mux := http.NewServeMux()
+	organisation.RegisterEndpoints(admin.NewAPI(mux, admin.NewAuthenticator(repo)), db, repo)
+
+	remove := func(userId string) int {
+		req := httptest.NewRequest("DELETE", membersPath+userId, nil)
+		req.SetBasicAuth("alice", databasetest.Password)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// The viewer remaining doesn't count as an admin.
+	assert.Equal(t, http.StatusConflict, remove(alice))
+
+	databasetest.CreateMember(t, repo, "carol", "org-1", admin.RoleAdmin)
+	assert.Equal(t, http.StatusNoContent, remove(bob))
+	assert.Equal(t, http.StatusNoContent, remove(alice))
+}
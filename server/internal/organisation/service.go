@@ -0,0 +1,425 @@
+package organisation
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jawee/scimtiplexer/internal/admin"
+	"github.com/jawee/scimtiplexer/internal/database"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// service manages organisations and their members.
+type service struct {
+	db   database.Service
+	repo repository.Querier
+}
+
+var (
+	errInvalidRequest = errors.New("invalid request")
+	errConflict       = errors.New("conflict")
+	errLastAdmin      = errors.New("the last admin of an organisation can't be removed")
+)
+
+const (
+	maxNameLength     = 200
+	maxUsernameLength = 64
+)
+
+// slugPattern is the slug of an organisation, which is part of its SCIM base
+// URL.
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+type organisationDto struct {
+	ID            string
+	Name          string
+	Slug          string
+	CreatedBy     string
+	CreatedOnUtc  time.Time
+	ModifiedOnUtc time.Time
+}
+
+func newOrganisationDto(o repository.Organisation) organisationDto {
+	return organisationDto{
+		ID:            o.ID,
+		Name:          o.Name,
+		Slug:          o.Slug,
+		CreatedBy:     o.CreatedBy.String,
+		CreatedOnUtc:  o.CreatedOnUtc,
+		ModifiedOnUtc: o.ModifiedOnUtc,
+	}
+}
+
+type memberDto struct {
+	ID              string
+	Username        string
+	Email           string
+	Role            string
+	MemberSinceUtc  time.Time
+	InitialPassword string
+}
+
+// GetOrganisations lists the organisations a portal user is a member of.
+func (s *service) GetOrganisations(ctx context.Context, userId string) ([]organisationDto, error) {
+	organisations, err := s.repo.GetOrganisationsForUser(ctx, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetOrganisationsForUser: %w", err)
+	}
+
+	dtos := make([]organisationDto, len(organisations))
+	for i, o := range organisations {
+		dtos[i] = newOrganisationDto(o)
+	}
+	return dtos, nil
+}
+
+func (s *service) GetOrganisation(ctx context.Context, id string) (organisationDto, error) {
+	o, err := s.repo.GetOrganisationById(ctx, id)
+	if err != nil {
+		return organisationDto{}, err
+	}
+	return newOrganisationDto(o), nil
+}
+
+// CreateOrganisation creates an organisation with the portal user creating it
+// as its first member.
+func (s *service) CreateOrganisation(ctx context.Context, userId string, req OrganisationRequest) (organisationDto, error) {
+	name, slug, err := validateOrganisation(req.Name, req.Slug)
+	if err != nil {
+		return organisationDto{}, err
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return organisationDto{}, errors.New("failed to generate UUID for new organisation")
+	}
+
+	err = s.db.WithTx(ctx, func(repo repository.Querier) error {
+		if err := checkUnique(ctx, repo, "", name, slug); err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		_, err := repo.CreateOrganisation(ctx, repository.CreateOrganisationParams{
+			ID:            id.String(),
+			Name:          name,
+			Slug:          slug,
+			Createdby:     sql.NullString{String: userId, Valid: true},
+			Createdonutc:  now,
+			Modifiedonutc: now,
+			Modifiedby:    sql.NullString{String: userId, Valid: true},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to CreateOrganisation: %w", err)
+		}
+
+		err = repo.CreateOrganisationUser(ctx, repository.CreateOrganisationUserParams{
+			Userid:         userId,
+			Organisationid: id.String(),
+			Role:           admin.RoleAdmin,
+			Createdonutc:   now,
+			Modifiedonutc:  now,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to CreateOrganisationUser: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return organisationDto{}, err
+	}
+
+	return s.GetOrganisation(ctx, id.String())
+}
+
+// UpdateOrganisation renames an organisation or changes its slug. Changing
+// the slug changes the SCIM base URL of the organisation.
+func (s *service) UpdateOrganisation(ctx context.Context, id, userId string, req OrganisationUpdateRequest) (organisationDto, error) {
+	current, err := s.repo.GetOrganisationById(ctx, id)
+	if err != nil {
+		return organisationDto{}, err
+	}
+
+	name, slug := current.Name, current.Slug
+	if req.Name != nil {
+		name = *req.Name
+	}
+	if req.Slug != nil {
+		slug = *req.Slug
+	}
+	name, slug, err = validateOrganisation(name, slug)
+	if err != nil {
+		return organisationDto{}, err
+	}
+
+	err = s.db.WithTx(ctx, func(repo repository.Querier) error {
+		if err := checkUnique(ctx, repo, id, name, slug); err != nil {
+			return err
+		}
+
+		err := repo.UpdateOrganisation(ctx, repository.UpdateOrganisationParams{
+			Name:          name,
+			Slug:          slug,
+			Modifiedonutc: time.Now().UTC(),
+			Modifiedby:    sql.NullString{String: userId, Valid: true},
+			ID:            id,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to UpdateOrganisation: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return organisationDto{}, err
+	}
+
+	return s.GetOrganisation(ctx, id)
+}
+
+// DeleteOrganisation deletes an organisation with everything it holds: its
+// users and groups, tokens, targets and their outboxes.
+func (s *service) DeleteOrganisation(ctx context.Context, id string) error {
+	return s.db.WithForeignKeys(ctx, func(repo repository.Querier) error {
+		rows, err := repo.DeleteOrganisation(ctx, id)
+		if err != nil {
+			return fmt.Errorf("failed to DeleteOrganisation: %w", err)
+		}
+		if rows == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+}
+
+func validateOrganisation(name, slug string) (string, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxNameLength {
+		return "", "", fmt.Errorf("%w: name is required and at most %d characters", errInvalidRequest, maxNameLength)
+	}
+	if len(slug) > 63 || !slugPattern.MatchString(slug) {
+		return "", "", fmt.Errorf("%w: slug must be at most 63 lowercase letters, digits and single hyphens", errInvalidRequest)
+	}
+	return name, slug, nil
+}
+
+// checkUnique checks that no other organisation than id has the name or
+// slug.
+func checkUnique(ctx context.Context, repo repository.Querier, id, name, slug string) error {
+	existing, err := repo.GetOrganisationByName(ctx, name)
+	switch {
+	case err == nil && existing.ID != id:
+		return fmt.Errorf("%w: an organisation named %q already exists", errConflict, name)
+	case err != nil && !errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("failed to GetOrganisationByName: %w", err)
+	}
+
+	existing, err = repo.GetOrganisationBySlug(ctx, slug)
+	switch {
+	case err == nil && existing.ID != id:
+		return fmt.Errorf("%w: an organisation with the slug %q already exists", errConflict, slug)
+	case err != nil && !errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("failed to GetOrganisationBySlug: %w", err)
+	}
+	return nil
+}
+
+func (s *service) GetMembers(ctx context.Context, organisationId string) ([]memberDto, error) {
+	members, err := s.repo.GetOrganisationMembers(ctx, organisationId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetOrganisationMembers: %w", err)
+	}
+
+	dtos := make([]memberDto, len(members))
+	for i, m := range members {
+		dtos[i] = memberDto{
+			ID:             m.ID,
+			Username:       m.Username,
+			Email:          m.Email,
+			Role:           m.Role,
+			MemberSinceUtc: m.CreatedOnUtc,
+		}
+	}
+	return dtos, nil
+}
+
+// AddMember invites a portal user to an organisation. The user is looked up
+// by username, or by email when no username is given. When there is no such
+// user and both are given the user is created with a random initial
+// password, which is only returned here.
+func (s *service) AddMember(ctx context.Context, organisationId, userId string, req MemberRequest) (memberDto, error) {
+	req.Username = strings.TrimSpace(req.Username)
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Username == "" && req.Email == "" {
+		return memberDto{}, fmt.Errorf("%w: username or email is required", errInvalidRequest)
+	}
+	if req.Role == "" {
+		req.Role = admin.RoleAdmin
+	}
+	if !admin.ValidRole(req.Role) {
+		return memberDto{}, fmt.Errorf("%w: role must be admin or viewer", errInvalidRequest)
+	}
+
+	var member memberDto
+	err := s.db.WithTx(ctx, func(repo repository.Querier) error {
+		user, err := findUser(ctx, repo, req)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			user, member.InitialPassword, err = createUser(ctx, repo, userId, req)
+			if err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		}
+
+		_, err = repo.GetOrganisationUser(ctx, repository.GetOrganisationUserParams{
+			Userid:         user.ID,
+			Organisationid: organisationId,
+		})
+		if err == nil {
+			return fmt.Errorf("%w: %s is already a member", errConflict, user.Username)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to GetOrganisationUser: %w", err)
+		}
+
+		now := time.Now().UTC()
+		err = repo.CreateOrganisationUser(ctx, repository.CreateOrganisationUserParams{
+			Userid:         user.ID,
+			Organisationid: organisationId,
+			Role:           req.Role,
+			Createdonutc:   now,
+			Modifiedonutc:  now,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to CreateOrganisationUser: %w", err)
+		}
+
+		member.ID = user.ID
+		member.Username = user.Username
+		member.Email = user.Email
+		member.Role = req.Role
+		member.MemberSinceUtc = now
+		return nil
+	})
+	if err != nil {
+		return memberDto{}, err
+	}
+	return member, nil
+}
+
+func findUser(ctx context.Context, repo repository.Querier, req MemberRequest) (repository.User, error) {
+	if req.Username != "" {
+		user, err := repo.GetUserByUsername(ctx, req.Username)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return repository.User{}, fmt.Errorf("failed to GetUserByUsername: %w", err)
+		}
+		return user, err
+	}
+
+	user, err := repo.GetUserByEmail(ctx, req.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return repository.User{}, fmt.Errorf("failed to GetUserByEmail: %w", err)
+	}
+	return user, err
+}
+
+// createUser registers a portal user, returning it with its initial
+// password.
+func createUser(ctx context.Context, repo repository.Querier, userId string, req MemberRequest) (repository.User, string, error) {
+	if req.Username == "" || req.Email == "" {
+		return repository.User{}, "", fmt.Errorf("%w: no such user, username and email are required to create one", errInvalidRequest)
+	}
+	if len(req.Username) > maxUsernameLength {
+		return repository.User{}, "", fmt.Errorf("%w: username must be at most %d characters", errInvalidRequest, maxUsernameLength)
+	}
+	if address, err := mail.ParseAddress(req.Email); err != nil || address.Address != req.Email {
+		return repository.User{}, "", fmt.Errorf("%w: email must be an email address", errInvalidRequest)
+	}
+	if _, err := repo.GetUserByEmail(ctx, req.Email); err == nil {
+		return repository.User{}, "", fmt.Errorf("%w: another user has the email %s", errConflict, req.Email)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return repository.User{}, "", fmt.Errorf("failed to GetUserByEmail: %w", err)
+	}
+
+	secret := make([]byte, 18)
+	if _, err := rand.Read(secret); err != nil {
+		return repository.User{}, "", fmt.Errorf("failed to generate password: %w", err)
+	}
+	password := base64.RawURLEncoding.EncodeToString(secret)
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return repository.User{}, "", fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return repository.User{}, "", errors.New("failed to generate UUID for new user")
+	}
+	now := time.Now().UTC()
+	user := repository.User{
+		ID:            id.String(),
+		Username:      req.Username,
+		Email:         req.Email,
+		Password:      string(hash),
+		CreatedBy:     sql.NullString{String: userId, Valid: true},
+		CreatedOnUtc:  now,
+		ModifiedOnUtc: now,
+		ModifiedBy:    sql.NullString{String: userId, Valid: true},
+	}
+	_, err = repo.RegisterUser(ctx, repository.RegisterUserParams{
+		ID:            user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		Password:      user.Password,
+		Createdby:     user.CreatedBy,
+		Createdonutc:  user.CreatedOnUtc,
+		Modifiedonutc: user.ModifiedOnUtc,
+		Modifiedby:    user.ModifiedBy,
+	})
+	if err != nil {
+		return repository.User{}, "", fmt.Errorf("failed to RegisterUser: %w", err)
+	}
+	return user, password, nil
+}
+
+// RemoveMember removes a portal user from an organisation. The user itself
+// is kept. The last admin can't be removed, which would leave nobody to
+// manage the organisation.
+func (s *service) RemoveMember(ctx context.Context, organisationId, userId string) error {
+	return s.db.WithTx(ctx, func(repo repository.Querier) error {
+		member, err := repo.GetOrganisationUser(ctx, repository.GetOrganisationUserParams{
+			Userid:         userId,
+			Organisationid: organisationId,
+		})
+		if err != nil {
+			return err
+		}
+		lastAdmin, err := admin.IsLastAdmin(ctx, repo, member)
+		if err != nil {
+			return err
+		}
+		if lastAdmin {
+			return errLastAdmin
+		}
+
+		_, err = repo.DeleteOrganisationUser(ctx, repository.DeleteOrganisationUserParams{
+			Userid:         userId,
+			Organisationid: organisationId,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to DeleteOrganisationUser: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/admin"
+	"github.com/jawee/scimtiplexer/internal/repository"
+)
+
+type handler struct {
+	service *service
+}
+
+func RegisterEndpoints(api *admin.API, repo repository.Querier, limiter *Limiter) {
+	h := &handler{
+		service: &service{repo: repo, limiter: limiter},
+	}
+
+	slog.Debug("Registering SCIM limit endpoints")
+	api.Member("GET", "/orgs/{orgId}/scim-limits", h.handleGetLimits, admin.Operation{
+		Summary:  "Get the SCIM rate and body size limits of an organisation",
+		Response: LimitsResponse{},
+	})
+	api.Member("PUT", "/orgs/{orgId}/scim-limits", h.handlePutLimits, admin.Operation{
+		Summary:  "Set the SCIM limits of an organisation",
+		Request:  LimitsRequest{},
+		Response: LimitsResponse{},
+	})
+	api.Member("DELETE", "/orgs/{orgId}/scim-limits", h.handleDeleteLimits, admin.Operation{
+		Summary: "Return an organisation to the default SCIM limits",
+		Status:  http.StatusNoContent,
+	})
+}
+
+// LimitsResponse describes the SCIM limits of an organisation. Default is
+// set when the organisation has the defaults of the server.
+type LimitsResponse struct {
+	RateLimit      float64    `json:"rateLimit"`
+	Burst          int64      `json:"burst"`
+	TokenRateLimit float64    `json:"tokenRateLimit"`
+	TokenBurst     int64      `json:"tokenBurst"`
+	MaxBodyBytes   int64      `json:"maxBodyBytes"`
+	Default        bool       `json:"default"`
+	ModifiedBy     string     `json:"modifiedBy,omitempty"`
+	ModifiedOnUtc  *time.Time `json:"modifiedOnUtc,omitempty"`
+}
+
+func newLimitsResponse(l limitsDto) LimitsResponse {
+	return LimitsResponse{
+		RateLimit:      l.RateLimit,
+		Burst:          l.Burst,
+		TokenRateLimit: l.TokenRateLimit,
+		TokenBurst:     l.TokenBurst,
+		MaxBodyBytes:   l.MaxBodyBytes,
+		Default:        l.Default,
+		ModifiedBy:     l.ModifiedBy,
+		ModifiedOnUtc:  l.ModifiedOnUtc,
+	}
+}
+
+// LimitsRequest sets the SCIM limits of an organisation. RateLimit limits the
+// requests per second of the whole organisation and TokenRateLimit those of
+// each token or client, 0 doesn't limit them. Burst and TokenBurst are how
+// many requests may be sent at once. Requests over the limits are answered
+// with 429 and a Retry-After header. MaxBodyBytes is the largest body of a
+// POST, PUT or PATCH request, larger ones are answered with 413.
+type LimitsRequest struct {
+	RateLimit      *float64 `json:"rateLimit"`
+	Burst          *int64   `json:"burst"`
+	TokenRateLimit *float64 `json:"tokenRateLimit"`
+	TokenBurst     *int64   `json:"tokenBurst"`
+	MaxBodyBytes   *int64   `json:"maxBodyBytes"`
+}
+
+func (h *handler) handleGetLimits(w http.ResponseWriter, r *http.Request) {
+	limits, err := h.service.GetLimits(r.Context(), r.PathValue("orgId"))
+	if err != nil {
+		writeServiceError(w, err, "Failed to get SCIM limits")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusOK, newLimitsResponse(limits))
+}
+
+func (h *handler) handlePutLimits(w http.ResponseWriter, r *http.Request) {
+	var req LimitsRequest
+	if !admin.ReadJSON(w, r, &req) {
+		return
+	}
+
+	limits, err := h.service.SetLimits(r.Context(), r.PathValue("orgId"), admin.UserID(r.Context()), req)
+	if err != nil {
+		writeServiceError(w, err, "Failed to set SCIM limits")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusOK, newLimitsResponse(limits))
+}
+
+func (h *handler) handleDeleteLimits(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.DeleteLimits(r.Context(), r.PathValue("orgId")); err != nil {
+		writeServiceError(w, err, "Failed to delete SCIM limits")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeServiceError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		admin.WriteError(w, http.StatusNotFound, "Organisation has the default SCIM limits")
+		return
+	case errors.Is(err, errInvalidRequest):
+		admin.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	slog.Error(message, "error", err)
+	admin.WriteError(w, http.StatusInternalServerError, message)
+}
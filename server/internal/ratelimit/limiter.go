@@ -0,0 +1,237 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/metrics"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/utils"
+)
+
+// Limits exceeded by a request.
+const (
+	LimitOrganisation = "organisation"
+	LimitToken        = "token"
+)
+
+const (
+	// limitsTTL is how long the limits of an organisation are cached. Limits
+	// changed through the API apply at once on the server that changed them.
+	limitsTTL = 30 * time.Second
+	// bucketIdle is how long the bucket of an organisation or credential that
+	// sends no requests is kept. An idle bucket is full, dropping it changes
+	// nothing.
+	bucketIdle = 10 * time.Minute
+	// sweepInterval is how often idle buckets are dropped.
+	sweepInterval = time.Minute
+	// minBodyBytes and maxBodyBytes bound the body size limit.
+	minBodyBytes = 1 << 10
+	maxBodyBytes = 64 << 20
+)
+
+var (
+	requests = metrics.NewCounter("scim_requests_total",
+		"SCIM requests authenticated, by organisation.", "organisation")
+	throttled = metrics.NewCounter("scim_requests_throttled_total",
+		"SCIM requests rejected with 429, by organisation and the limit they exceeded.", "organisation", "limit")
+	tooLarge = metrics.NewCounter("scim_requests_too_large_total",
+		"SCIM requests rejected as their body exceeded the size limit, by organisation.", "organisation")
+)
+
+// Limits are the limits of the SCIM requests of an organisation. Requests
+// are counted in token buckets, one for the organisation and one per
+// credential it authenticates with, refilled at the rate limit in requests
+// per second and holding up to the burst. A rate limit of 0 doesn't limit
+// requests.
+type Limits struct {
+	RateLimit      float64
+	Burst          int64
+	TokenRateLimit float64
+	TokenBurst     int64
+	MaxBodyBytes   int64
+}
+
+func newLimits(l repository.ScimLimit) Limits {
+	return Limits{
+		RateLimit:      l.RateLimit,
+		Burst:          l.Burst,
+		TokenRateLimit: l.TokenRateLimit,
+		TokenBurst:     l.TokenBurst,
+		MaxBodyBytes:   l.MaxBodyBytes,
+	}
+}
+
+// defaultLimits are the limits of organisations that don't set their own,
+// from SCIM_RATE_LIMIT, SCIM_TOKEN_RATE_LIMIT and SCIM_MAX_BODY_BYTES. The
+// bursts allow two seconds worth of requests.
+func defaultLimits() Limits {
+	rate := floatFromEnv(utils.EnvScimRateLimit, 50)
+	tokenRate := floatFromEnv(utils.EnvScimTokenRateLimit, 25)
+	return Limits{
+		RateLimit:      rate,
+		Burst:          int64(math.Ceil(2 * rate)),
+		TokenRateLimit: tokenRate,
+		TokenBurst:     int64(math.Ceil(2 * tokenRate)),
+		MaxBodyBytes:   min(max(int64(floatFromEnv(utils.EnvScimMaxBodyBytes, 1<<20)), minBodyBytes), maxBodyBytes),
+	}
+}
+
+func floatFromEnv(key string, fallback float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 || math.IsInf(n, 0) || math.IsNaN(n) {
+		slog.Warn("Invalid number, using default", "key", key, "value", value, "default", fallback)
+		return fallback
+	}
+	return n
+}
+
+// Limiter limits the SCIM requests of organisations, protecting the server
+// from a misbehaving identity provider. The buckets are kept in memory, per
+// server.
+type Limiter struct {
+	repo     repository.Querier
+	defaults Limits
+
+	mu      sync.Mutex
+	limits  map[string]cachedLimits
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type cachedLimits struct {
+	limits   Limits
+	loadedOn time.Time
+}
+
+type bucket struct {
+	tokens   float64
+	refilled time.Time
+}
+
+func NewLimiter(repo repository.Querier) *Limiter {
+	return &Limiter{
+		repo:     repo,
+		defaults: defaultLimits(),
+		limits:   make(map[string]cachedLimits),
+		buckets:  make(map[string]*bucket),
+		swept:    time.Now(),
+	}
+}
+
+// Limits returns the limits of an organisation.
+func (l *Limiter) Limits(ctx context.Context, organisationId string) (Limits, error) {
+	l.mu.Lock()
+	cached, ok := l.limits[organisationId]
+	l.mu.Unlock()
+	if ok && time.Since(cached.loadedOn) < limitsTTL {
+		return cached.limits, nil
+	}
+
+	limits := l.defaults
+	stored, err := l.repo.GetScimLimits(ctx, organisationId)
+	switch {
+	case err == nil:
+		limits = newLimits(stored)
+	case !errors.Is(err, sql.ErrNoRows):
+		return Limits{}, fmt.Errorf("failed to GetScimLimits: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits[organisationId] = cachedLimits{limits: limits, loadedOn: time.Now()}
+	return limits, nil
+}
+
+// forget drops the cached limits of an organisation after they changed.
+func (l *Limiter) forget(organisationId string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.limits, organisationId)
+}
+
+// Allow counts a request of an organisation made with a credential, such as
+// the id of the token or the OAuth client. When the request exceeds a limit
+// nothing is counted, and Allow returns the limit and how long until the
+// request would be allowed.
+func (l *Limiter) Allow(organisationId, credential string, limits Limits) (string, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.swept) > sweepInterval {
+		l.sweep(now)
+	}
+	requests.Inc(organisationId)
+
+	type check struct {
+		limit  string
+		key    string
+		rate   float64
+		burst  int64
+		bucket *bucket
+	}
+	checks := []check{
+		{limit: LimitOrganisation, key: "organisation:" + organisationId, rate: limits.RateLimit, burst: limits.Burst},
+		{limit: LimitToken, key: "token:" + organisationId + ":" + credential, rate: limits.TokenRateLimit, burst: limits.TokenBurst},
+	}
+	for i := range checks {
+		c := &checks[i]
+		if c.rate <= 0 {
+			continue
+		}
+		capacity := float64(max(1, c.burst))
+		b, ok := l.buckets[c.key]
+		if !ok {
+			b = &bucket{tokens: capacity, refilled: now}
+			l.buckets[c.key] = b
+		}
+		b.tokens = min(capacity, b.tokens+now.Sub(b.refilled).Seconds()*c.rate)
+		b.refilled = now
+		if b.tokens < 1 {
+			throttled.Inc(organisationId, c.limit)
+			return c.limit, time.Duration((1 - b.tokens) / c.rate * float64(time.Second))
+		}
+		c.bucket = b
+	}
+
+	for _, c := range checks {
+		if c.bucket != nil {
+			c.bucket.tokens--
+		}
+	}
+	return "", 0
+}
+
+// sweep drops the buckets that haven't been used for a while.
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.refilled) > bucketIdle {
+			delete(l.buckets, key)
+		}
+	}
+	for id, cached := range l.limits {
+		if now.Sub(cached.loadedOn) > limitsTTL {
+			delete(l.limits, id)
+		}
+	}
+	l.swept = now
+}
+
+// TooLarge counts a request whose body exceeded the size limit of its
+// organisation.
+func (l *Limiter) TooLarge(organisationId string) {
+	tooLarge.Inc(organisationId)
+}
@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/database/databasetest"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllow(t *testing.T) {
+	l := NewLimiter(databasetest.New(t).GetRepository())
+	limits := Limits{RateLimit: 1, Burst: 3, TokenRateLimit: 1, TokenBurst: 2}
+
+	for range 2 {
+		limit, _ := l.Allow("org-1", "token-1", limits)
+		require.Empty(t, limit)
+	}
+	limit, wait := l.Allow("org-1", "token-1", limits)
+	assert.Equal(t, LimitToken, limit)
+	assert.InDelta(t, time.Second, wait, float64(50*time.Millisecond))
+
+	limit, _ = l.Allow("org-1", "token-2", limits)
+	require.Empty(t, limit, "each credential has its own bucket")
+	limit, _ = l.Allow("org-1", "token-3", limits)
+	assert.Equal(t, LimitOrganisation, limit, "the organisation shares a bucket")
+
+	limit, _ = l.Allow("org-2", "token-4", limits)
+	assert.Empty(t, limit, "other organisations aren't limited")
+}
+
+func TestAllowWithoutRateLimit(t *testing.T) {
+	l := NewLimiter(databasetest.New(t).GetRepository())
+
+	for range 100 {
+		limit, _ := l.Allow("org-1", "token-1", Limits{})
+		require.Empty(t, limit)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	t.Setenv(utils.EnvScimRateLimit, "10")
+	t.Setenv(utils.EnvScimTokenRateLimit, "5")
+	t.Setenv(utils.EnvScimMaxBodyBytes, "1")
+	repo := databasetest.New(t).GetRepository()
+	l := NewLimiter(repo)
+	ctx := context.Background()
+
+	limits, err := l.Limits(ctx, "org-1")
+	require.NoError(t, err)
+	assert.Equal(t, Limits{RateLimit: 10, Burst: 20, TokenRateLimit: 5, TokenBurst: 10, MaxBodyBytes: minBodyBytes}, limits)
+
+	stored := Limits{RateLimit: 2, Burst: 4, TokenRateLimit: 1, TokenBurst: 2, MaxBodyBytes: 4096}
+	require.NoError(t, repo.UpsertScimLimits(ctx, repository.UpsertScimLimitsParams{
+		Organisationid: "org-1",
+		Ratelimit:      stored.RateLimit,
+		Burst:          stored.Burst,
+		Tokenratelimit: stored.TokenRateLimit,
+		Tokenburst:     stored.TokenBurst,
+		Maxbodybytes:   stored.MaxBodyBytes,
+		Modifiedonutc:  time.Now().UTC(),
+	}))
+	limits, err = l.Limits(ctx, "org-1")
+	require.NoError(t, err)
+	assert.NotEqual(t, stored, limits, "limits are cached")
+
+	l.forget("org-1")
+	limits, err = l.Limits(ctx, "org-1")
+	require.NoError(t, err)
+	assert.Equal(t, stored, limits)
+}
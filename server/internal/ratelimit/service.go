@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/repository"
+)
+
+// service manages the SCIM limits of an organisation.
+type service struct {
+	repo    repository.Querier
+	limiter *Limiter
+}
+
+var errInvalidRequest = errors.New("invalid request")
+
+type limitsDto struct {
+	Limits
+	Default       bool
+	ModifiedBy    string
+	ModifiedOnUtc *time.Time
+}
+
+// GetLimits returns the limits of an organisation, the defaults of the
+// server when it hasn't set its own.
+func (s *service) GetLimits(ctx context.Context, organisationId string) (limitsDto, error) {
+	stored, err := s.repo.GetScimLimits(ctx, organisationId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return limitsDto{Limits: s.limiter.defaults, Default: true}, nil
+	}
+	if err != nil {
+		return limitsDto{}, fmt.Errorf("failed to GetScimLimits: %w", err)
+	}
+
+	return limitsDto{
+		Limits:        newLimits(stored),
+		ModifiedBy:    stored.ModifiedBy.String,
+		ModifiedOnUtc: &stored.ModifiedOnUtc,
+	}, nil
+}
+
+func (s *service) SetLimits(ctx context.Context, organisationId, userId string, req LimitsRequest) (limitsDto, error) {
+	limits, err := validateRequest(req, s.limiter.defaults)
+	if err != nil {
+		return limitsDto{}, fmt.Errorf("%w: %w", errInvalidRequest, err)
+	}
+
+	err = s.repo.UpsertScimLimits(ctx, repository.UpsertScimLimitsParams{
+		Organisationid: organisationId,
+		Ratelimit:      limits.RateLimit,
+		Burst:          limits.Burst,
+		Tokenratelimit: limits.TokenRateLimit,
+		Tokenburst:     limits.TokenBurst,
+		Maxbodybytes:   limits.MaxBodyBytes,
+		Modifiedonutc:  time.Now().UTC(),
+		Modifiedby:     sql.NullString{String: userId, Valid: userId != ""},
+	})
+	if err != nil {
+		return limitsDto{}, fmt.Errorf("failed to UpsertScimLimits: %w", err)
+	}
+	s.limiter.forget(organisationId)
+
+	return s.GetLimits(ctx, organisationId)
+}
+
+// DeleteLimits returns an organisation to the defaults of the server.
+func (s *service) DeleteLimits(ctx context.Context, organisationId string) error {
+	rows, err := s.repo.DeleteScimLimits(ctx, organisationId)
+	if err != nil {
+		return fmt.Errorf("failed to DeleteScimLimits: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	s.limiter.forget(organisationId)
+	return nil
+}
+
+// validateRequest turns a request into limits. Left out limits keep the
+// default of the server, and left out bursts allow two seconds worth of
+// requests.
+func validateRequest(req LimitsRequest, defaults Limits) (Limits, error) {
+	limits := defaults
+	if req.RateLimit != nil {
+		limits.RateLimit = *req.RateLimit
+		limits.Burst = int64(math.Ceil(2 * *req.RateLimit))
+	}
+	if req.TokenRateLimit != nil {
+		limits.TokenRateLimit = *req.TokenRateLimit
+		limits.TokenBurst = int64(math.Ceil(2 * *req.TokenRateLimit))
+	}
+	if req.Burst != nil {
+		limits.Burst = *req.Burst
+	}
+	if req.TokenBurst != nil {
+		limits.TokenBurst = *req.TokenBurst
+	}
+	if req.MaxBodyBytes != nil {
+		limits.MaxBodyBytes = *req.MaxBodyBytes
+	}
+
+	if !validRate(limits.RateLimit) || !validRate(limits.TokenRateLimit) {
+		return Limits{}, errors.New("rateLimit and tokenRateLimit must be 0 or more requests per second")
+	}
+	if limits.Burst < 0 || limits.TokenBurst < 0 {
+		return Limits{}, errors.New("burst and tokenBurst must be 0 or more requests")
+	}
+	if limits.MaxBodyBytes < minBodyBytes || limits.MaxBodyBytes > maxBodyBytes {
+		return Limits{}, fmt.Errorf("maxBodyBytes must be between %d and %d", minBodyBytes, maxBodyBytes)
+	}
+	return limits, nil
+}
+
+func validRate(rate float64) bool {
+	return rate >= 0 && !math.IsInf(rate, 0) && !math.IsNaN(rate)
+}
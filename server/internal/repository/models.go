@@ -9,6 +9,143 @@ import (
 	"time"
 )
 
+type AttributePolicy struct {
+	OrganisationID string
+	Attribute      string
+	Sources        string
+	OnConflict     string
+	CreatedOnUtc   time.Time
+	ModifiedOnUtc  time.Time
+	ModifiedBy     sql.NullString
+}
+
+type ChangeLog struct {
+	ID             int64
+	OrganisationID string
+	ResourceType   string
+	ResourceID     string
+	Operation      string
+	Resource       sql.NullString
+	CreatedOnUtc   time.Time
+}
+
+type ClientCertificateMapping struct {
+	ID             string
+	OrganisationID string
+	Label          sql.NullString
+	CaBundle       string
+	MatchType      string
+	MatchValue     string
+	Scopes         string
+	CreatedBy      string
+	CreatedOnUtc   time.Time
+	ModifiedOnUtc  time.Time
+	ModifiedBy     sql.NullString
+}
+
+type CorrelationReview struct {
+	ID              string
+	OrganisationID  string
+	IdentityID      string
+	CandidateUserID string
+	Rules           string
+	Confidence      int64
+	Status          string
+	ResolvedBy      sql.NullString
+	ResolvedOnUtc   sql.NullTime
+	CreatedOnUtc    time.Time
+}
+
+type CorrelationRule struct {
+	ID                 string
+	OrganisationID     string
+	Match              string
+	BirthDateAttribute sql.NullString
+	Confidence         int64
+	CreatedBy          string
+	CreatedOnUtc       time.Time
+}
+
+type HeldBatch struct {
+	ID             string
+	OrganisationID string
+	Status         string
+	Changes        int64
+	Users          int64
+	Events         int64
+	OpenedOnUtc    time.Time
+	ResolvedBy     sql.NullString
+	ResolvedOnUtc  sql.NullTime
+}
+
+type HeldEvent struct {
+	ID             int64
+	BatchID        string
+	OrganisationID string
+	ResourceType   string
+	ResourceID     string
+	Operation      string
+	Resource       sql.NullString
+	Deactivates    bool
+	CreatedOnUtc   time.Time
+}
+
+type MassChange struct {
+	ID             int64
+	OrganisationID string
+	ResourceID     string
+	Operation      string
+	CreatedOnUtc   time.Time
+}
+
+type MassChangeThreshold struct {
+	OrganisationID string
+	MaxCount       sql.NullInt64
+	MaxPercent     sql.NullInt64
+	WindowSeconds  int64
+	Reject         bool
+	SuspendedUntil sql.NullTime
+	ModifiedOnUtc  time.Time
+	ModifiedBy     sql.NullString
+}
+
+type OauthClient struct {
+	ID             string
+	OrganisationID string
+	ClientID       string
+	SecretHash     string
+	Label          sql.NullString
+	Scopes         string
+	RevokedOnUtc   sql.NullTime
+	CreatedBy      string
+	CreatedOnUtc   time.Time
+	ModifiedOnUtc  time.Time
+	ModifiedBy     sql.NullString
+}
+
+type OauthSigningKey struct {
+	ID           string
+	Algorithm    string
+	PrivateKey   string
+	CreatedOnUtc time.Time
+}
+
+type OidcIdentity struct {
+	Issuer         string
+	Subject        string
+	UserID         string
+	CreatedOnUtc   time.Time
+	LastLoginOnUtc time.Time
+}
+
+type OidcLogin struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+	Redirect     string
+	CreatedOnUtc time.Time
+}
+
 type Organisation struct {
 	ID            string
 	Name          string
@@ -16,16 +153,52 @@ type Organisation struct {
 	CreatedOnUtc  time.Time
 	ModifiedOnUtc time.Time
 	ModifiedBy    sql.NullString
+	Slug          string
 }
 
 type OrganisationToken struct {
 	ID             string
 	OrganisationID string
-	Token          string
+	Label          sql.NullString
+	TokenPrefix    string
+	TokenHash      string
 	CreatedBy      string
 	CreatedOnUtc   time.Time
 	ModifiedOnUtc  time.Time
 	ModifiedBy     sql.NullString
+	Scopes         string
+	ExpiresOnUtc   sql.NullTime
+	RevokedOnUtc   sql.NullTime
+	LastUsedOnUtc  sql.NullTime
+	LastUsedIp     sql.NullString
+	Source         sql.NullString
+}
+
+type OutboxEvent struct {
+	ID               int64
+	OrganisationID   string
+	TargetID         string
+	ResourceType     string
+	ResourceID       string
+	Operation        string
+	Payload          sql.NullString
+	Status           string
+	Attempts         int64
+	NextAttemptOnUtc time.Time
+	LastError        sql.NullString
+	CreatedOnUtc     time.Time
+	DeliveredOnUtc   sql.NullTime
+}
+
+type PortalSession struct {
+	ID               string
+	UserID           string
+	RefreshTokenHash string
+	CsrfToken        string
+	CreatedOnUtc     time.Time
+	RefreshedOnUtc   time.Time
+	ExpiresOnUtc     time.Time
+	RevokedOnUtc     sql.NullTime
 }
 
 type ScimGroup struct {
@@ -39,6 +212,17 @@ type ScimGroup struct {
 	OrganisationID   string
 }
 
+type ScimLimit struct {
+	OrganisationID string
+	RateLimit      float64
+	Burst          int64
+	TokenRateLimit float64
+	TokenBurst     int64
+	MaxBodyBytes   int64
+	ModifiedOnUtc  time.Time
+	ModifiedBy     sql.NullString
+}
+
 type ScimUser struct {
 	ID                  string
 	ExternalID          sql.NullString
@@ -72,6 +256,13 @@ type ScimUser struct {
 	OrganisationID      string
 }
 
+type ScimUserAttributeSource struct {
+	UserID        string
+	Attribute     string
+	Source        sql.NullString
+	ModifiedOnUtc time.Time
+}
+
 type ScimUserEmail struct {
 	ID           string
 	UserID       string
@@ -86,6 +277,20 @@ type ScimUserGroupMembership struct {
 	GroupID string
 }
 
+type ScimUserIdentity struct {
+	ID             string
+	OrganisationID string
+	UserID         string
+	Source         sql.NullString
+	Resource       sql.NullString
+	Rules          sql.NullString
+	Confidence     sql.NullInt64
+	CreatedOnUtc   time.Time
+	ModifiedOnUtc  time.Time
+	NormalisedName sql.NullString
+	BirthDate      sql.NullString
+}
+
 type ScimUserPhoneNumber struct {
 	ID                 string
 	UserID             string
@@ -95,15 +300,131 @@ type ScimUserPhoneNumber struct {
 	PrimaryPhoneNumber sql.NullBool
 }
 
+type SecurityEvent struct {
+	Jti          string
+	TargetID     string
+	Token        string
+	CreatedOnUtc time.Time
+}
+
+type Target struct {
+	ID                string
+	OrganisationID    string
+	Name              string
+	Type              string
+	Config            string
+	Enabled           bool
+	CreatedBy         string
+	CreatedOnUtc      time.Time
+	ModifiedOnUtc     time.Time
+	ModifiedBy        sql.NullString
+	AttributeMapping  sql.NullString
+	UserScope         sql.NullString
+	GroupScope        sql.NullString
+	DeprovisionAction string
+	ReconcileInterval sql.NullInt64
+	ReconcileRepair   bool
+	Mode              string
+	RateLimit         sql.NullFloat64
+	MaxInFlight       sql.NullInt64
+}
+
+type TargetBackfill struct {
+	ID              string
+	OrganisationID  string
+	TargetID        string
+	Status          string
+	Phase           string
+	LastResourceID  string
+	TotalUsers      int64
+	TotalGroups     int64
+	ProcessedUsers  int64
+	ProcessedGroups int64
+	Queued          int64
+	Error           sql.NullString
+	CreatedBy       sql.NullString
+	StartedOnUtc    time.Time
+	ModifiedOnUtc   time.Time
+	CompletedOnUtc  sql.NullTime
+}
+
+type TargetReconciliation struct {
+	ID             string
+	OrganisationID string
+	TargetID       string
+	Trigger        string
+	Repair         bool
+	Status         string
+	Missing        int64
+	Extra          int64
+	Changed        int64
+	Membership     int64
+	Repaired       int64
+	Report         sql.NullString
+	Error          sql.NullString
+	CreatedBy      sql.NullString
+	StartedOnUtc   time.Time
+	CompletedOnUtc sql.NullTime
+}
+
+type TargetResourceMapping struct {
+	TargetID       string
+	ResourceType   string
+	LocalID        string
+	RemoteID       string
+	RemoteVersion  sql.NullString
+	CreatedOnUtc   time.Time
+	ModifiedOnUtc  time.Time
+	SentAttributes sql.NullString
+}
+
+type TargetScopedResource struct {
+	TargetID     string
+	ResourceType string
+	ResourceID   string
+	CreatedOnUtc time.Time
+}
+
+type TargetShadowOperation struct {
+	ID             int64
+	OrganisationID string
+	TargetID       string
+	ResourceType   string
+	ResourceID     string
+	Operation      string
+	Payload        sql.NullString
+	Skipped        bool
+	Error          sql.NullString
+	CreatedOnUtc   time.Time
+}
+
+type TrustedIssuer struct {
+	ID                     string
+	OrganisationID         string
+	Issuer                 string
+	Audience               string
+	JwksUri                sql.NullString
+	Jwks                   sql.NullString
+	OrganisationClaim      string
+	OrganisationClaimValue string
+	Scopes                 string
+	CreatedBy              string
+	CreatedOnUtc           time.Time
+	ModifiedOnUtc          time.Time
+	ModifiedBy             sql.NullString
+}
+
 type User struct {
-	ID            string
-	Username      string
-	Email         string
-	Password      string
-	CreatedBy     sql.NullString
-	CreatedOnUtc  time.Time
-	ModifiedOnUtc time.Time
-	ModifiedBy    sql.NullString
+	ID             string
+	Username       string
+	Email          string
+	Password       string
+	CreatedBy      sql.NullString
+	CreatedOnUtc   time.Time
+	ModifiedOnUtc  time.Time
+	ModifiedBy     sql.NullString
+	FailedLogins   int64
+	LockedUntilUtc sql.NullTime
 }
 
 type UserOrganisation struct {
@@ -111,4 +432,5 @@ type UserOrganisation struct {
 	OrganisationID string
 	CreatedOnUtc   time.Time
 	ModifiedOnUtc  time.Time
+	Role           string
 }
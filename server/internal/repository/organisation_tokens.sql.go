@@ -12,15 +12,20 @@ import (
 )
 
 const createOrganisationToken = `-- name: CreateOrganisationToken :one
-INSERT INTO organisation_tokens (id, organisation_id, token, created_by, created_on_utc, modified_on_utc, modified_by)
-VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7)
+INSERT INTO organisation_tokens (id, organisation_id, label, token_prefix, token_hash, scopes, source, expires_on_utc, created_by, created_on_utc, modified_on_utc, modified_by)
+VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10, ?11, ?12)
 RETURNING id
 `
 
 type CreateOrganisationTokenParams struct {
 	ID             string
 	Organisationid string
-	Token          string
+	Label          sql.NullString
+	Tokenprefix    string
+	Tokenhash      string
+	Scopes         string
+	Source         sql.NullString
+	Expiresonutc   sql.NullTime
 	Createdby      string
 	Createdonutc   time.Time
 	Modifiedonutc  time.Time
@@ -31,7 +36,12 @@ func (q *Queries) CreateOrganisationToken(ctx context.Context, arg CreateOrganis
 	row := q.db.QueryRowContext(ctx, createOrganisationToken,
 		arg.ID,
 		arg.Organisationid,
-		arg.Token,
+		arg.Label,
+		arg.Tokenprefix,
+		arg.Tokenhash,
+		arg.Scopes,
+		arg.Source,
+		arg.Expiresonutc,
 		arg.Createdby,
 		arg.Createdonutc,
 		arg.Modifiedonutc,
@@ -42,28 +52,70 @@ func (q *Queries) CreateOrganisationToken(ctx context.Context, arg CreateOrganis
 	return id, err
 }
 
-const getOrganisationTokenByToken = `-- name: GetOrganisationTokenByToken :one
-SELECT id, organisation_id, token, created_by, created_on_utc, modified_on_utc, modified_by FROM organisation_tokens
-WHERE token = ?1
+const getOrganisationTokenByHash = `-- name: GetOrganisationTokenByHash :one
+SELECT id, organisation_id, label, token_prefix, token_hash, created_by, created_on_utc, modified_on_utc, modified_by, scopes, expires_on_utc, revoked_on_utc, last_used_on_utc, last_used_ip, source FROM organisation_tokens
+WHERE token_hash = ?1
 `
 
-func (q *Queries) GetOrganisationTokenByToken(ctx context.Context, token string) (OrganisationToken, error) {
-	row := q.db.QueryRowContext(ctx, getOrganisationTokenByToken, token)
+func (q *Queries) GetOrganisationTokenByHash(ctx context.Context, tokenhash string) (OrganisationToken, error) {
+	row := q.db.QueryRowContext(ctx, getOrganisationTokenByHash, tokenhash)
 	var i OrganisationToken
 	err := row.Scan(
 		&i.ID,
 		&i.OrganisationID,
-		&i.Token,
+		&i.Label,
+		&i.TokenPrefix,
+		&i.TokenHash,
 		&i.CreatedBy,
 		&i.CreatedOnUtc,
 		&i.ModifiedOnUtc,
 		&i.ModifiedBy,
+		&i.Scopes,
+		&i.ExpiresOnUtc,
+		&i.RevokedOnUtc,
+		&i.LastUsedOnUtc,
+		&i.LastUsedIp,
+		&i.Source,
+	)
+	return i, err
+}
+
+const getOrganisationTokenById = `-- name: GetOrganisationTokenById :one
+SELECT id, organisation_id, label, token_prefix, token_hash, created_by, created_on_utc, modified_on_utc, modified_by, scopes, expires_on_utc, revoked_on_utc, last_used_on_utc, last_used_ip, source FROM organisation_tokens
+WHERE id = ?1
+AND organisation_id = ?2
+`
+
+type GetOrganisationTokenByIdParams struct {
+	ID             string
+	Organisationid string
+}
+
+func (q *Queries) GetOrganisationTokenById(ctx context.Context, arg GetOrganisationTokenByIdParams) (OrganisationToken, error) {
+	row := q.db.QueryRowContext(ctx, getOrganisationTokenById, arg.ID, arg.Organisationid)
+	var i OrganisationToken
+	err := row.Scan(
+		&i.ID,
+		&i.OrganisationID,
+		&i.Label,
+		&i.TokenPrefix,
+		&i.TokenHash,
+		&i.CreatedBy,
+		&i.CreatedOnUtc,
+		&i.ModifiedOnUtc,
+		&i.ModifiedBy,
+		&i.Scopes,
+		&i.ExpiresOnUtc,
+		&i.RevokedOnUtc,
+		&i.LastUsedOnUtc,
+		&i.LastUsedIp,
+		&i.Source,
 	)
 	return i, err
 }
 
 const getOrganisationTokens = `-- name: GetOrganisationTokens :many
-SELECT id, organisation_id, token, created_by, created_on_utc, modified_on_utc, modified_by FROM organisation_tokens
+SELECT id, organisation_id, label, token_prefix, token_hash, created_by, created_on_utc, modified_on_utc, modified_by, scopes, expires_on_utc, revoked_on_utc, last_used_on_utc, last_used_ip, source FROM organisation_tokens
 WHERE organisation_id = ?1
 ORDER BY id DESC
 `
@@ -80,11 +132,19 @@ func (q *Queries) GetOrganisationTokens(ctx context.Context, organisationid stri
 		if err := rows.Scan(
 			&i.ID,
 			&i.OrganisationID,
-			&i.Token,
+			&i.Label,
+			&i.TokenPrefix,
+			&i.TokenHash,
 			&i.CreatedBy,
 			&i.CreatedOnUtc,
 			&i.ModifiedOnUtc,
 			&i.ModifiedBy,
+			&i.Scopes,
+			&i.ExpiresOnUtc,
+			&i.RevokedOnUtc,
+			&i.LastUsedOnUtc,
+			&i.LastUsedIp,
+			&i.Source,
 		); err != nil {
 			return nil, err
 		}
@@ -98,3 +158,106 @@ func (q *Queries) GetOrganisationTokens(ctx context.Context, organisationid stri
 	}
 	return items, nil
 }
+
+const revokeOrganisationToken = `-- name: RevokeOrganisationToken :exec
+UPDATE organisation_tokens
+SET revoked_on_utc = ?1, modified_on_utc = ?2, modified_by = ?3
+WHERE id = ?4
+AND organisation_id = ?5
+`
+
+type RevokeOrganisationTokenParams struct {
+	Revokedonutc   sql.NullTime
+	Modifiedonutc  time.Time
+	Modifiedby     sql.NullString
+	ID             string
+	Organisationid string
+}
+
+func (q *Queries) RevokeOrganisationToken(ctx context.Context, arg RevokeOrganisationTokenParams) error {
+	_, err := q.db.ExecContext(ctx, revokeOrganisationToken,
+		arg.Revokedonutc,
+		arg.Modifiedonutc,
+		arg.Modifiedby,
+		arg.ID,
+		arg.Organisationid,
+	)
+	return err
+}
+
+const updateOrganisationToken = `-- name: UpdateOrganisationToken :exec
+UPDATE organisation_tokens
+SET label = ?1, scopes = ?2, source = ?3, expires_on_utc = ?4, modified_on_utc = ?5, modified_by = ?6
+WHERE id = ?7
+AND organisation_id = ?8
+`
+
+type UpdateOrganisationTokenParams struct {
+	Label          sql.NullString
+	Scopes         string
+	Source         sql.NullString
+	Expiresonutc   sql.NullTime
+	Modifiedonutc  time.Time
+	Modifiedby     sql.NullString
+	ID             string
+	Organisationid string
+}
+
+func (q *Queries) UpdateOrganisationToken(ctx context.Context, arg UpdateOrganisationTokenParams) error {
+	_, err := q.db.ExecContext(ctx, updateOrganisationToken,
+		arg.Label,
+		arg.Scopes,
+		arg.Source,
+		arg.Expiresonutc,
+		arg.Modifiedonutc,
+		arg.Modifiedby,
+		arg.ID,
+		arg.Organisationid,
+	)
+	return err
+}
+
+const updateOrganisationTokenHash = `-- name: UpdateOrganisationTokenHash :exec
+UPDATE organisation_tokens
+SET token_prefix = ?1, token_hash = ?2, modified_on_utc = ?3, modified_by = ?4
+WHERE id = ?5
+AND organisation_id = ?6
+`
+
+type UpdateOrganisationTokenHashParams struct {
+	Tokenprefix    string
+	Tokenhash      string
+	Modifiedonutc  time.Time
+	Modifiedby     sql.NullString
+	ID             string
+	Organisationid string
+}
+
+func (q *Queries) UpdateOrganisationTokenHash(ctx context.Context, arg UpdateOrganisationTokenHashParams) error {
+	_, err := q.db.ExecContext(ctx, updateOrganisationTokenHash,
+		arg.Tokenprefix,
+		arg.Tokenhash,
+		arg.Modifiedonutc,
+		arg.Modifiedby,
+		arg.ID,
+		arg.Organisationid,
+	)
+	return err
+}
+
+const updateOrganisationTokenLastUsed = `-- name: UpdateOrganisationTokenLastUsed :exec
+UPDATE organisation_tokens
+SET last_used_on_utc = ?1, last_used_ip = ?2
+WHERE id = ?3
+`
+
+type UpdateOrganisationTokenLastUsedParams struct {
+	Lastusedonutc sql.NullTime
+	Lastusedip    sql.NullString
+	ID            string
+}
+
+func (q *Queries) UpdateOrganisationTokenLastUsed(ctx context.Context, arg UpdateOrganisationTokenLastUsedParams) error {
+	_, err := q.db.ExecContext(ctx, updateOrganisationTokenLastUsed, arg.Lastusedonutc, arg.Lastusedip, arg.ID)
+	return err
+}
@@ -10,14 +10,33 @@ import (
 	"time"
 )
 
+const countOrganisationUsersWithRole = `-- name: CountOrganisationUsersWithRole :one
+SELECT COUNT(*) FROM user_organisations
+WHERE organisation_id = ?1
+AND role = ?2
+`
+
+type CountOrganisationUsersWithRoleParams struct {
+	Organisationid string
+	Role           string
+}
+
+func (q *Queries) CountOrganisationUsersWithRole(ctx context.Context, arg CountOrganisationUsersWithRoleParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countOrganisationUsersWithRole, arg.Organisationid, arg.Role)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createOrganisationUser = `-- name: CreateOrganisationUser :exec
-INSERT INTO user_organisations (user_id, organisation_id, created_on_utc, modified_on_utc)
-VALUES (?1, ?2, ?3, ?4)
+INSERT INTO user_organisations (user_id, organisation_id, role, created_on_utc, modified_on_utc)
+VALUES (?1, ?2, ?3, ?4, ?5)
 `
 
 type CreateOrganisationUserParams struct {
 	Userid         string
 	Organisationid string
+	Role           string
 	Createdonutc   time.Time
 	Modifiedonutc  time.Time
 }
@@ -26,6 +45,122 @@ func (q *Queries) CreateOrganisationUser(ctx context.Context, arg CreateOrganisa
 	_, err := q.db.ExecContext(ctx, createOrganisationUser,
 		arg.Userid,
 		arg.Organisationid,
+		arg.Role,
+		arg.Createdonutc,
+		arg.Modifiedonutc,
+	)
+	return err
+}
+
+const deleteOrganisationUser = `-- name: DeleteOrganisationUser :execrows
+DELETE FROM user_organisations
+WHERE user_id = ?1
+AND organisation_id = ?2
+`
+
+type DeleteOrganisationUserParams struct {
+	Userid         string
+	Organisationid string
+}
+
+func (q *Queries) DeleteOrganisationUser(ctx context.Context, arg DeleteOrganisationUserParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteOrganisationUser, arg.Userid, arg.Organisationid)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getOrganisationMembers = `-- name: GetOrganisationMembers :many
+SELECT users.id, users.username, users.email, user_organisations.role, user_organisations.created_on_utc FROM user_organisations
+JOIN users ON users.id = user_organisations.user_id
+WHERE user_organisations.organisation_id = ?1
+ORDER BY users.username
+`
+
+type GetOrganisationMembersRow struct {
+	ID           string
+	Username     string
+	Email        string
+	Role         string
+	CreatedOnUtc time.Time
+}
+
+func (q *Queries) GetOrganisationMembers(ctx context.Context, organisationid string) ([]GetOrganisationMembersRow, error) {
+	rows, err := q.db.QueryContext(ctx, getOrganisationMembers, organisationid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetOrganisationMembersRow{}
+	for rows.Next() {
+		var i GetOrganisationMembersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.Email,
+			&i.Role,
+			&i.CreatedOnUtc,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getOrganisationUser = `-- name: GetOrganisationUser :one
+SELECT user_id, organisation_id, created_on_utc, modified_on_utc, role FROM user_organisations
+WHERE user_id = ?1
+AND organisation_id = ?2
+`
+
+type GetOrganisationUserParams struct {
+	Userid         string
+	Organisationid string
+}
+
+func (q *Queries) GetOrganisationUser(ctx context.Context, arg GetOrganisationUserParams) (UserOrganisation, error) {
+	row := q.db.QueryRowContext(ctx, getOrganisationUser, arg.Userid, arg.Organisationid)
+	var i UserOrganisation
+	err := row.Scan(
+		&i.UserID,
+		&i.OrganisationID,
+		&i.CreatedOnUtc,
+		&i.ModifiedOnUtc,
+		&i.Role,
+	)
+	return i, err
+}
+
+const upsertOrganisationUser = `-- name: UpsertOrganisationUser :exec
+INSERT INTO user_organisations (user_id, organisation_id, role, created_on_utc, modified_on_utc)
+VALUES (?1, ?2, ?3, ?4, ?5)
+ON CONFLICT (user_id, organisation_id) DO UPDATE
+SET role = excluded.role,
+    modified_on_utc = excluded.modified_on_utc
+WHERE role != excluded.role
+`
+
+type UpsertOrganisationUserParams struct {
+	Userid         string
+	Organisationid string
+	Role           string
+	Createdonutc   time.Time
+	Modifiedonutc  time.Time
+}
+
+func (q *Queries) UpsertOrganisationUser(ctx context.Context, arg UpsertOrganisationUserParams) error {
+	_, err := q.db.ExecContext(ctx, upsertOrganisationUser,
+		arg.Userid,
+		arg.Organisationid,
+		arg.Role,
 		arg.Createdonutc,
 		arg.Modifiedonutc,
 	)
@@ -12,14 +12,15 @@ import (
 )
 
 const createOrganisation = `-- name: CreateOrganisation :one
-INSERT INTO organisations (id, name, created_by, created_on_utc, modified_on_utc, modified_by)
-VALUES (?1, ?2, ?3, ?4, ?5, ?6)
+INSERT INTO organisations (id, name, slug, created_by, created_on_utc, modified_on_utc, modified_by)
+VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7)
 RETURNING id
 `
 
 type CreateOrganisationParams struct {
 	ID            string
 	Name          string
+	Slug          string
 	Createdby     sql.NullString
 	Createdonutc  time.Time
 	Modifiedonutc time.Time
@@ -30,6 +31,7 @@ func (q *Queries) CreateOrganisation(ctx context.Context, arg CreateOrganisation
 	row := q.db.QueryRowContext(ctx, createOrganisation,
 		arg.ID,
 		arg.Name,
+		arg.Slug,
 		arg.Createdby,
 		arg.Createdonutc,
 		arg.Modifiedonutc,
@@ -39,3 +41,141 @@ func (q *Queries) CreateOrganisation(ctx context.Context, arg CreateOrganisation
 	err := row.Scan(&id)
 	return id, err
 }
+
+const deleteOrganisation = `-- name: DeleteOrganisation :execrows
+DELETE FROM organisations
+WHERE id = ?1
+`
+
+func (q *Queries) DeleteOrganisation(ctx context.Context, id string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteOrganisation, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getOrganisationById = `-- name: GetOrganisationById :one
+SELECT id, name, created_by, created_on_utc, modified_on_utc, modified_by, slug FROM organisations
+WHERE id = ?1
+`
+
+func (q *Queries) GetOrganisationById(ctx context.Context, id string) (Organisation, error) {
+	row := q.db.QueryRowContext(ctx, getOrganisationById, id)
+	var i Organisation
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.CreatedBy,
+		&i.CreatedOnUtc,
+		&i.ModifiedOnUtc,
+		&i.ModifiedBy,
+		&i.Slug,
+	)
+	return i, err
+}
+
+const getOrganisationByName = `-- name: GetOrganisationByName :one
+SELECT id, name, created_by, created_on_utc, modified_on_utc, modified_by, slug FROM organisations
+WHERE name = ?1
+`
+
+func (q *Queries) GetOrganisationByName(ctx context.Context, name string) (Organisation, error) {
+	row := q.db.QueryRowContext(ctx, getOrganisationByName, name)
+	var i Organisation
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.CreatedBy,
+		&i.CreatedOnUtc,
+		&i.ModifiedOnUtc,
+		&i.ModifiedBy,
+		&i.Slug,
+	)
+	return i, err
+}
+
+const getOrganisationBySlug = `-- name: GetOrganisationBySlug :one
+SELECT id, name, created_by, created_on_utc, modified_on_utc, modified_by, slug FROM organisations
+WHERE slug = ?1
+`
+
+func (q *Queries) GetOrganisationBySlug(ctx context.Context, slug string) (Organisation, error) {
+	row := q.db.QueryRowContext(ctx, getOrganisationBySlug, slug)
+	var i Organisation
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.CreatedBy,
+		&i.CreatedOnUtc,
+		&i.ModifiedOnUtc,
+		&i.ModifiedBy,
+		&i.Slug,
+	)
+	return i, err
+}
+
+const getOrganisationsForUser = `-- name: GetOrganisationsForUser :many
+SELECT id, name, created_by, created_on_utc, modified_on_utc, modified_by, slug FROM organisations
+WHERE id IN (SELECT organisation_id FROM user_organisations WHERE user_organisations.user_id = ?1)
+ORDER BY name
+`
+
+func (q *Queries) GetOrganisationsForUser(ctx context.Context, userid string) ([]Organisation, error) {
+	rows, err := q.db.QueryContext(ctx, getOrganisationsForUser, userid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Organisation{}
+	for rows.Next() {
+		var i Organisation
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.CreatedBy,
+			&i.CreatedOnUtc,
+			&i.ModifiedOnUtc,
+			&i.ModifiedBy,
+			&i.Slug,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateOrganisation = `-- name: UpdateOrganisation :exec
+UPDATE organisations
+SET name = ?1,
+    slug = ?2,
+    modified_on_utc = ?3,
+    modified_by = ?4
+WHERE id = ?5
+`
+
+type UpdateOrganisationParams struct {
+	Name          string
+	Slug          string
+	Modifiedonutc time.Time
+	Modifiedby    sql.NullString
+	ID            string
+}
+
+func (q *Queries) UpdateOrganisation(ctx context.Context, arg UpdateOrganisationParams) error {
+	_, err := q.db.ExecContext(ctx, updateOrganisation,
+		arg.Name,
+		arg.Slug,
+		arg.Modifiedonutc,
+		arg.Modifiedby,
+		arg.ID,
+	)
+	return err
+}
@@ -6,27 +6,206 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"time"
 )
 
 type Querier interface {
+	CompleteTargetBackfill(ctx context.Context, arg CompleteTargetBackfillParams) (int64, error)
+	CompleteTargetReconciliation(ctx context.Context, arg CompleteTargetReconciliationParams) error
+	CountFailedTargetShadowOperations(ctx context.Context, targetid string) (int64, error)
+	CountMassChanges(ctx context.Context, arg CountMassChangesParams) (int64, error)
+	CountOrganisationUsersWithRole(ctx context.Context, arg CountOrganisationUsersWithRoleParams) (int64, error)
+	CountScimGroups(ctx context.Context, organisationid string) (int64, error)
+	CountScimUsers(ctx context.Context, organisationid string) (int64, error)
+	CountSecurityEvents(ctx context.Context, targetid string) (int64, error)
+	CountTargetOutboxEvents(ctx context.Context, arg CountTargetOutboxEventsParams) ([]CountTargetOutboxEventsRow, error)
+	CountTargetShadowResources(ctx context.Context, targetid string) (int64, error)
+	CreateChange(ctx context.Context, arg CreateChangeParams) error
+	CreateClientCertificateMapping(ctx context.Context, arg CreateClientCertificateMappingParams) (string, error)
+	CreateCorrelationReview(ctx context.Context, arg CreateCorrelationReviewParams) error
+	CreateCorrelationRule(ctx context.Context, arg CreateCorrelationRuleParams) error
+	CreateHeldBatch(ctx context.Context, arg CreateHeldBatchParams) error
+	CreateHeldEvent(ctx context.Context, arg CreateHeldEventParams) error
+	CreateMassChange(ctx context.Context, arg CreateMassChangeParams) error
+	CreateOauthClient(ctx context.Context, arg CreateOauthClientParams) (string, error)
+	CreateOauthSigningKey(ctx context.Context, arg CreateOauthSigningKeyParams) error
+	CreateOidcIdentity(ctx context.Context, arg CreateOidcIdentityParams) error
+	CreateOidcLogin(ctx context.Context, arg CreateOidcLoginParams) error
 	CreateOrganisation(ctx context.Context, arg CreateOrganisationParams) (string, error)
 	CreateOrganisationToken(ctx context.Context, arg CreateOrganisationTokenParams) (string, error)
 	CreateOrganisationUser(ctx context.Context, arg CreateOrganisationUserParams) error
+	CreateOutboxEvent(ctx context.Context, arg CreateOutboxEventParams) error
+	CreatePortalSession(ctx context.Context, arg CreatePortalSessionParams) error
 	CreateScimGroup(ctx context.Context, arg CreateScimGroupParams) (string, error)
 	CreateScimUser(ctx context.Context, arg CreateScimUserParams) (string, error)
+	CreateSecurityEvent(ctx context.Context, arg CreateSecurityEventParams) error
+	CreateTarget(ctx context.Context, arg CreateTargetParams) (string, error)
+	CreateTargetBackfill(ctx context.Context, arg CreateTargetBackfillParams) error
+	CreateTargetReconciliation(ctx context.Context, arg CreateTargetReconciliationParams) error
+	CreateTargetScopedResource(ctx context.Context, arg CreateTargetScopedResourceParams) error
+	CreateTargetShadowOperation(ctx context.Context, arg CreateTargetShadowOperationParams) error
+	CreateTrustedIssuer(ctx context.Context, arg CreateTrustedIssuerParams) (string, error)
 	CreateUserEmail(ctx context.Context, arg CreateUserEmailParams) error
 	CreateUserGroupMembership(ctx context.Context, arg CreateUserGroupMembershipParams) error
+	CreateUserIdentity(ctx context.Context, arg CreateUserIdentityParams) error
 	CreateUserPhoneNumber(ctx context.Context, arg CreateUserPhoneNumberParams) error
+	DeleteAttributePolicy(ctx context.Context, arg DeleteAttributePolicyParams) error
+	DeleteCandidateCorrelationReviews(ctx context.Context, candidateuserid string) error
+	DeleteClientCertificateMapping(ctx context.Context, arg DeleteClientCertificateMappingParams) error
+	DeleteCorrelationRule(ctx context.Context, arg DeleteCorrelationRuleParams) error
+	DeleteDeliveredOutboxEvents(ctx context.Context, deliveredbefore sql.NullTime) error
+	DeleteExpiredOidcLogins(ctx context.Context, before time.Time) (int64, error)
+	DeleteExpiredPortalSessions(ctx context.Context, before time.Time) (int64, error)
+	DeleteGroupMembers(ctx context.Context, groupID string) error
+	DeleteHeldEvents(ctx context.Context, batchid string) error
+	DeleteIdentityCorrelationReviews(ctx context.Context, identityid string) error
+	DeleteMassChangeThreshold(ctx context.Context, organisationid string) (int64, error)
+	DeleteMassChanges(ctx context.Context, organisationid string) error
+	DeleteOauthSigningKey(ctx context.Context, id string) error
+	DeleteOidcLogin(ctx context.Context, state string) (int64, error)
+	DeleteOldMassChanges(ctx context.Context, createdbefore time.Time) error
+	DeleteOldTargetShadowOperations(ctx context.Context, createdbefore time.Time) error
+	DeleteOrganisation(ctx context.Context, id string) (int64, error)
+	DeleteOrganisationUser(ctx context.Context, arg DeleteOrganisationUserParams) (int64, error)
+	DeleteScimGroup(ctx context.Context, arg DeleteScimGroupParams) (int64, error)
+	DeleteScimLimits(ctx context.Context, organisationid string) (int64, error)
+	DeleteScimUser(ctx context.Context, arg DeleteScimUserParams) error
+	DeleteSecurityEvent(ctx context.Context, arg DeleteSecurityEventParams) error
+	DeleteTarget(ctx context.Context, arg DeleteTargetParams) error
+	DeleteTargetResourceMapping(ctx context.Context, arg DeleteTargetResourceMappingParams) error
+	DeleteTargetScopedResource(ctx context.Context, arg DeleteTargetScopedResourceParams) error
+	DeleteTargetShadowOperations(ctx context.Context, arg DeleteTargetShadowOperationsParams) error
+	DeleteTrustedIssuer(ctx context.Context, arg DeleteTrustedIssuerParams) error
+	DeleteUserAttributeSources(ctx context.Context, userid string) error
+	DeleteUserEmails(ctx context.Context, userID string) error
+	DeleteUserGroupMemberships(ctx context.Context, userID string) error
+	DeleteUserIdentity(ctx context.Context, arg DeleteUserIdentityParams) error
+	DeleteUserPhoneNumbers(ctx context.Context, userID string) error
+	DiscardOutboxEvent(ctx context.Context, arg DiscardOutboxEventParams) (int64, error)
+	DismissUserCorrelationReviews(ctx context.Context, arg DismissUserCorrelationReviewsParams) error
+	FailRunningTargetReconciliations(ctx context.Context, arg FailRunningTargetReconciliationsParams) error
+	GetActiveTargetBackfill(ctx context.Context, targetid string) (TargetBackfill, error)
 	GetAllScimGroups(ctx context.Context, organisationid string) ([]ScimGroup, error)
 	GetAllScimUsers(ctx context.Context, organisationid string) ([]ScimUser, error)
 	GetAllUsers(ctx context.Context) ([]User, error)
-	GetOrganisationTokenByToken(ctx context.Context, token string) (OrganisationToken, error)
+	GetAttributePolicies(ctx context.Context, organisationid string) ([]AttributePolicy, error)
+	GetAttributePolicy(ctx context.Context, arg GetAttributePolicyParams) (AttributePolicy, error)
+	GetChangesSince(ctx context.Context, arg GetChangesSinceParams) ([]ChangeLog, error)
+	GetClientCertificateMappingById(ctx context.Context, arg GetClientCertificateMappingByIdParams) (ClientCertificateMapping, error)
+	GetClientCertificateMappingByMatch(ctx context.Context, arg GetClientCertificateMappingByMatchParams) (ClientCertificateMapping, error)
+	GetClientCertificateMappings(ctx context.Context, organisationid string) ([]ClientCertificateMapping, error)
+	GetCorrelationReviewById(ctx context.Context, arg GetCorrelationReviewByIdParams) (CorrelationReview, error)
+	GetCorrelationReviews(ctx context.Context, arg GetCorrelationReviewsParams) ([]CorrelationReview, error)
+	GetCorrelationRuleById(ctx context.Context, arg GetCorrelationRuleByIdParams) (CorrelationRule, error)
+	GetCorrelationRules(ctx context.Context, organisationid string) ([]CorrelationRule, error)
+	GetEnabledTargets(ctx context.Context, organisationid string) ([]Target, error)
+	GetGroupMembers(ctx context.Context, groupID string) ([]ScimUserGroupMembership, error)
+	GetHeldBatch(ctx context.Context, arg GetHeldBatchParams) (HeldBatch, error)
+	GetHeldBatches(ctx context.Context, arg GetHeldBatchesParams) ([]HeldBatch, error)
+	GetHeldEvents(ctx context.Context, arg GetHeldEventsParams) ([]HeldEvent, error)
+	GetLatestTargetReconciliation(ctx context.Context, targetid string) (TargetReconciliation, error)
+	GetMassChangeThreshold(ctx context.Context, organisationid string) (MassChangeThreshold, error)
+	GetNextDeliveredOutboxEvent(ctx context.Context, arg GetNextDeliveredOutboxEventParams) (OutboxEvent, error)
+	GetOauthClientByClientId(ctx context.Context, clientid string) (OauthClient, error)
+	GetOauthClientById(ctx context.Context, arg GetOauthClientByIdParams) (OauthClient, error)
+	GetOauthClients(ctx context.Context, organisationid string) ([]OauthClient, error)
+	GetOauthSigningKeys(ctx context.Context) ([]OauthSigningKey, error)
+	GetOidcIdentity(ctx context.Context, arg GetOidcIdentityParams) (OidcIdentity, error)
+	GetOidcLogin(ctx context.Context, state string) (OidcLogin, error)
+	GetOpenHeldBatch(ctx context.Context, organisationid string) (HeldBatch, error)
+	GetOrganisationById(ctx context.Context, id string) (Organisation, error)
+	GetOrganisationByName(ctx context.Context, name string) (Organisation, error)
+	GetOrganisationBySlug(ctx context.Context, slug string) (Organisation, error)
+	GetOrganisationMembers(ctx context.Context, organisationid string) ([]GetOrganisationMembersRow, error)
+	GetOrganisationTokenByHash(ctx context.Context, tokenhash string) (OrganisationToken, error)
+	GetOrganisationTokenById(ctx context.Context, arg GetOrganisationTokenByIdParams) (OrganisationToken, error)
 	GetOrganisationTokens(ctx context.Context, organisationid string) ([]OrganisationToken, error)
+	GetOrganisationUser(ctx context.Context, arg GetOrganisationUserParams) (UserOrganisation, error)
+	GetOrganisationUserIdentities(ctx context.Context, organisationid string) ([]ScimUserIdentity, error)
+	GetOrganisationsForUser(ctx context.Context, userid string) ([]Organisation, error)
+	GetOutboxEvent(ctx context.Context, arg GetOutboxEventParams) (OutboxEvent, error)
+	GetOutboxEventsByTarget(ctx context.Context, arg GetOutboxEventsByTargetParams) ([]OutboxEvent, error)
+	GetPendingOutboxResources(ctx context.Context, targetid string) ([]GetPendingOutboxResourcesRow, error)
+	GetPortalSession(ctx context.Context, id string) (PortalSession, error)
+	GetPreviousOutboxEvent(ctx context.Context, arg GetPreviousOutboxEventParams) (OutboxEvent, error)
+	GetPreviousTargetShadowOperation(ctx context.Context, arg GetPreviousTargetShadowOperationParams) (TargetShadowOperation, error)
+	GetReadyOutboxEvents(ctx context.Context, arg GetReadyOutboxEventsParams) ([]OutboxEvent, error)
+	GetReadyOutboxTargets(ctx context.Context, now time.Time) ([]Target, error)
+	GetRunningTargetBackfills(ctx context.Context) ([]TargetBackfill, error)
+	GetScheduledReconciliationTargets(ctx context.Context) ([]Target, error)
+	GetScimGroupByDisplayName(ctx context.Context, arg GetScimGroupByDisplayNameParams) (ScimGroup, error)
+	GetScimGroupById(ctx context.Context, arg GetScimGroupByIdParams) (ScimGroup, error)
+	GetScimGroupsAfter(ctx context.Context, arg GetScimGroupsAfterParams) ([]ScimGroup, error)
+	GetScimLimits(ctx context.Context, organisationid string) (ScimLimit, error)
 	GetScimUserById(ctx context.Context, arg GetScimUserByIdParams) (ScimUser, error)
+	GetScimUserByUserName(ctx context.Context, username string) (ScimUser, error)
+	GetScimUserIdsAfter(ctx context.Context, arg GetScimUserIdsAfterParams) ([]string, error)
+	GetScimUsersByEmployeeNumber(ctx context.Context, arg GetScimUsersByEmployeeNumberParams) ([]ScimUser, error)
+	GetScimUsersByExternalId(ctx context.Context, arg GetScimUsersByExternalIdParams) ([]ScimUser, error)
+	GetScimUsersByPrimaryEmail(ctx context.Context, arg GetScimUsersByPrimaryEmailParams) ([]ScimUser, error)
+	GetSecurityEvents(ctx context.Context, arg GetSecurityEventsParams) ([]SecurityEvent, error)
+	GetSourceUserIdentities(ctx context.Context, arg GetSourceUserIdentitiesParams) ([]ScimUserIdentity, error)
+	GetTargetBackfill(ctx context.Context, arg GetTargetBackfillParams) (TargetBackfill, error)
+	GetTargetBackfills(ctx context.Context, arg GetTargetBackfillsParams) ([]TargetBackfill, error)
+	GetTargetById(ctx context.Context, arg GetTargetByIdParams) (Target, error)
+	GetTargetReconciliation(ctx context.Context, arg GetTargetReconciliationParams) (TargetReconciliation, error)
+	GetTargetReconciliations(ctx context.Context, arg GetTargetReconciliationsParams) ([]TargetReconciliation, error)
+	GetTargetResourceMapping(ctx context.Context, arg GetTargetResourceMappingParams) (TargetResourceMapping, error)
+	GetTargetResourceMappings(ctx context.Context, arg GetTargetResourceMappingsParams) ([]TargetResourceMapping, error)
+	GetTargetScopedResource(ctx context.Context, arg GetTargetScopedResourceParams) (TargetScopedResource, error)
+	GetTargetShadowOperationCounts(ctx context.Context, targetid string) ([]GetTargetShadowOperationCountsRow, error)
+	GetTargetShadowOperations(ctx context.Context, arg GetTargetShadowOperationsParams) ([]TargetShadowOperation, error)
+	GetTargets(ctx context.Context, organisationid string) ([]Target, error)
+	GetTrustedIssuerByClaimValue(ctx context.Context, arg GetTrustedIssuerByClaimValueParams) (TrustedIssuer, error)
+	GetTrustedIssuerById(ctx context.Context, arg GetTrustedIssuerByIdParams) (TrustedIssuer, error)
+	GetTrustedIssuers(ctx context.Context, organisationid string) ([]TrustedIssuer, error)
+	GetTrustedIssuersByIssuer(ctx context.Context, issuer string) ([]TrustedIssuer, error)
+	GetUserAttributeSources(ctx context.Context, userid string) ([]ScimUserAttributeSource, error)
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	GetUserById(ctx context.Context, id string) (User, error)
+	GetUserByUsername(ctx context.Context, username string) (User, error)
 	GetUserEmails(ctx context.Context, userID string) ([]ScimUserEmail, error)
 	GetUserGroupMemberships(ctx context.Context, userID string) ([]ScimUserGroupMembership, error)
+	GetUserIdentities(ctx context.Context, userid string) ([]ScimUserIdentity, error)
+	GetUserIdentitiesByNameAndBirthDate(ctx context.Context, arg GetUserIdentitiesByNameAndBirthDateParams) ([]ScimUserIdentity, error)
+	GetUserIdentity(ctx context.Context, arg GetUserIdentityParams) (ScimUserIdentity, error)
 	GetUserPhoneNumbers(ctx context.Context, userID string) ([]ScimUserPhoneNumber, error)
+	IncrementHeldBatchEvents(ctx context.Context, id string) error
+	LockUser(ctx context.Context, arg LockUserParams) error
+	MarkOutboxEventDelivered(ctx context.Context, arg MarkOutboxEventDeliveredParams) error
+	MarkOutboxEventFailed(ctx context.Context, arg MarkOutboxEventFailedParams) error
+	MoveUserIdentities(ctx context.Context, arg MoveUserIdentitiesParams) error
+	RecordFailedLogin(ctx context.Context, id string) (int64, error)
+	RefreshPortalSession(ctx context.Context, arg RefreshPortalSessionParams) (int64, error)
 	RegisterUser(ctx context.Context, arg RegisterUserParams) (string, error)
+	RequeueOutboxEvent(ctx context.Context, arg RequeueOutboxEventParams) (int64, error)
+	ResetFailedLogins(ctx context.Context, id string) error
+	ResolveCorrelationReview(ctx context.Context, arg ResolveCorrelationReviewParams) error
+	ResolveHeldBatch(ctx context.Context, arg ResolveHeldBatchParams) (int64, error)
+	RevokeOauthClient(ctx context.Context, arg RevokeOauthClientParams) error
+	RevokeOrganisationToken(ctx context.Context, arg RevokeOrganisationTokenParams) error
+	RevokePortalSession(ctx context.Context, arg RevokePortalSessionParams) error
+	SetTargetBackfillStatus(ctx context.Context, arg SetTargetBackfillStatusParams) (int64, error)
+	SuspendMassChangeThreshold(ctx context.Context, arg SuspendMassChangeThresholdParams) error
+	UpdateOidcIdentityLastLogin(ctx context.Context, arg UpdateOidcIdentityLastLoginParams) error
+	UpdateOrganisation(ctx context.Context, arg UpdateOrganisationParams) error
+	UpdateOrganisationToken(ctx context.Context, arg UpdateOrganisationTokenParams) error
+	UpdateOrganisationTokenHash(ctx context.Context, arg UpdateOrganisationTokenHashParams) error
+	UpdateOrganisationTokenLastUsed(ctx context.Context, arg UpdateOrganisationTokenLastUsedParams) error
+	UpdateScimGroup(ctx context.Context, arg UpdateScimGroupParams) error
+	UpdateScimUser(ctx context.Context, arg UpdateScimUserParams) error
+	UpdateTarget(ctx context.Context, arg UpdateTargetParams) error
+	UpdateTargetBackfillProgress(ctx context.Context, arg UpdateTargetBackfillProgressParams) error
+	UpdateUserIdentityBirthDate(ctx context.Context, arg UpdateUserIdentityBirthDateParams) error
+	UpdateUserIdentityResource(ctx context.Context, arg UpdateUserIdentityResourceParams) error
+	UpdateUserIdentityUser(ctx context.Context, arg UpdateUserIdentityUserParams) error
+	UpsertAttributePolicy(ctx context.Context, arg UpsertAttributePolicyParams) error
+	UpsertMassChangeThreshold(ctx context.Context, arg UpsertMassChangeThresholdParams) error
+	UpsertOrganisationUser(ctx context.Context, arg UpsertOrganisationUserParams) error
+	UpsertScimLimits(ctx context.Context, arg UpsertScimLimitsParams) error
+	UpsertTargetResourceMapping(ctx context.Context, arg UpsertTargetResourceMappingParams) error
+	UpsertUserAttributeSource(ctx context.Context, arg UpsertUserAttributeSourceParams) error
 }
 
 var _ Querier = (*Queries)(nil)
@@ -10,9 +10,21 @@ import (
 	"database/sql"
 )
 
+const countScimGroups = `-- name: CountScimGroups :one
+SELECT COUNT(*) FROM scim_groups
+WHERE organisation_id = ?1
+`
+
+func (q *Queries) CountScimGroups(ctx context.Context, organisationid string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countScimGroups, organisationid)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createScimGroup = `-- name: CreateScimGroup :one
-INSERT INTO scim_groups (id, display_name, external_id, meta_version, organisation_id)
-VALUES (?1, ?2, ?3, ?4, ?5)
+INSERT INTO scim_groups (id, display_name, external_id, meta_resource_type, meta_created, meta_last_modified, meta_version, organisation_id)
+VALUES (?1, ?2, ?3, 'Group', ?4, ?4, ?5, ?6)
 RETURNING id
 `
 
@@ -20,6 +32,7 @@ type CreateScimGroupParams struct {
 	ID             string
 	Displayname    string
 	Externalid     sql.NullString
+	Metacreated    string
 	Metaversion    sql.NullString
 	Organisationid string
 }
@@ -29,6 +42,7 @@ func (q *Queries) CreateScimGroup(ctx context.Context, arg CreateScimGroupParams
 		arg.ID,
 		arg.Displayname,
 		arg.Externalid,
+		arg.Metacreated,
 		arg.Metaversion,
 		arg.Organisationid,
 	)
@@ -37,6 +51,25 @@ func (q *Queries) CreateScimGroup(ctx context.Context, arg CreateScimGroupParams
 	return id, err
 }
 
+const deleteScimGroup = `-- name: DeleteScimGroup :execrows
+DELETE FROM scim_groups
+WHERE id = ?1
+AND organisation_id = ?2
+`
+
+type DeleteScimGroupParams struct {
+	ID             string
+	Organisationid string
+}
+
+func (q *Queries) DeleteScimGroup(ctx context.Context, arg DeleteScimGroupParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteScimGroup, arg.ID, arg.Organisationid)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getAllScimGroups = `-- name: GetAllScimGroups :many
 SELECT id, external_id, display_name, meta_resource_type, meta_created, meta_last_modified, meta_version, organisation_id FROM scim_groups
 WHERE organisation_id = ?1
@@ -74,3 +107,131 @@ func (q *Queries) GetAllScimGroups(ctx context.Context, organisationid string) (
 	}
 	return items, nil
 }
+
+const getScimGroupByDisplayName = `-- name: GetScimGroupByDisplayName :one
+SELECT id, external_id, display_name, meta_resource_type, meta_created, meta_last_modified, meta_version, organisation_id FROM scim_groups
+WHERE organisation_id = ?1
+AND display_name = ?2 COLLATE NOCASE
+`
+
+type GetScimGroupByDisplayNameParams struct {
+	Organisationid string
+	Displayname    string
+}
+
+func (q *Queries) GetScimGroupByDisplayName(ctx context.Context, arg GetScimGroupByDisplayNameParams) (ScimGroup, error) {
+	row := q.db.QueryRowContext(ctx, getScimGroupByDisplayName, arg.Organisationid, arg.Displayname)
+	var i ScimGroup
+	err := row.Scan(
+		&i.ID,
+		&i.ExternalID,
+		&i.DisplayName,
+		&i.MetaResourceType,
+		&i.MetaCreated,
+		&i.MetaLastModified,
+		&i.MetaVersion,
+		&i.OrganisationID,
+	)
+	return i, err
+}
+
+const getScimGroupById = `-- name: GetScimGroupById :one
+SELECT id, external_id, display_name, meta_resource_type, meta_created, meta_last_modified, meta_version, organisation_id FROM scim_groups
+WHERE id = ?1
+AND organisation_id = ?2
+`
+
+type GetScimGroupByIdParams struct {
+	ID             string
+	Organisationid string
+}
+
+func (q *Queries) GetScimGroupById(ctx context.Context, arg GetScimGroupByIdParams) (ScimGroup, error) {
+	row := q.db.QueryRowContext(ctx, getScimGroupById, arg.ID, arg.Organisationid)
+	var i ScimGroup
+	err := row.Scan(
+		&i.ID,
+		&i.ExternalID,
+		&i.DisplayName,
+		&i.MetaResourceType,
+		&i.MetaCreated,
+		&i.MetaLastModified,
+		&i.MetaVersion,
+		&i.OrganisationID,
+	)
+	return i, err
+}
+
+const getScimGroupsAfter = `-- name: GetScimGroupsAfter :many
+SELECT id, external_id, display_name, meta_resource_type, meta_created, meta_last_modified, meta_version, organisation_id FROM scim_groups
+WHERE organisation_id = ?1
+AND id > ?2
+ORDER BY id
+LIMIT ?3
+`
+
+type GetScimGroupsAfterParams struct {
+	Organisationid string
+	After          string
+	Limit          int64
+}
+
+func (q *Queries) GetScimGroupsAfter(ctx context.Context, arg GetScimGroupsAfterParams) ([]ScimGroup, error) {
+	rows, err := q.db.QueryContext(ctx, getScimGroupsAfter, arg.Organisationid, arg.After, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ScimGroup{}
+	for rows.Next() {
+		var i ScimGroup
+		if err := rows.Scan(
+			&i.ID,
+			&i.ExternalID,
+			&i.DisplayName,
+			&i.MetaResourceType,
+			&i.MetaCreated,
+			&i.MetaLastModified,
+			&i.MetaVersion,
+			&i.OrganisationID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateScimGroup = `-- name: UpdateScimGroup :exec
+UPDATE scim_groups
+SET display_name = ?1,
+    external_id = ?2,
+    meta_last_modified = ?3
+WHERE id = ?4
+AND organisation_id = ?5
+`
+
+type UpdateScimGroupParams struct {
+	Displayname      string
+	Externalid       sql.NullString
+	Metalastmodified string
+	ID               string
+	Organisationid   string
+}
+
+func (q *Queries) UpdateScimGroup(ctx context.Context, arg UpdateScimGroupParams) error {
+	_, err := q.db.ExecContext(ctx, updateScimGroup,
+		arg.Displayname,
+		arg.Externalid,
+		arg.Metalastmodified,
+		arg.ID,
+		arg.Organisationid,
+	)
+	return err
+}
@@ -49,6 +49,16 @@ func (q *Queries) CreateUserEmail(ctx context.Context, arg CreateUserEmailParams
 	return err
 }
 
+const deleteUserEmails = `-- name: DeleteUserEmails :exec
+DELETE FROM scim_user_emails
+WHERE user_id = ?1
+`
+
+func (q *Queries) DeleteUserEmails(ctx context.Context, userID string) error {
+	_, err := q.db.ExecContext(ctx, deleteUserEmails, userID)
+	return err
+}
+
 const getUserEmails = `-- name: GetUserEmails :many
 SELECT
     id, user_id, value, display, type, primary_email
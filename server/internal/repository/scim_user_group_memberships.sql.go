@@ -29,6 +29,58 @@ func (q *Queries) CreateUserGroupMembership(ctx context.Context, arg CreateUserG
 	return err
 }
 
+const deleteGroupMembers = `-- name: DeleteGroupMembers :exec
+DELETE FROM scim_user_group_memberships
+WHERE group_id = ?1
+`
+
+func (q *Queries) DeleteGroupMembers(ctx context.Context, groupID string) error {
+	_, err := q.db.ExecContext(ctx, deleteGroupMembers, groupID)
+	return err
+}
+
+const deleteUserGroupMemberships = `-- name: DeleteUserGroupMemberships :exec
+DELETE FROM scim_user_group_memberships
+WHERE user_id = ?1
+`
+
+func (q *Queries) DeleteUserGroupMemberships(ctx context.Context, userID string) error {
+	_, err := q.db.ExecContext(ctx, deleteUserGroupMemberships, userID)
+	return err
+}
+
+const getGroupMembers = `-- name: GetGroupMembers :many
+SELECT
+    user_id,
+    group_id
+FROM scim_user_group_memberships
+WHERE group_id = ?1
+ORDER BY user_id
+`
+
+func (q *Queries) GetGroupMembers(ctx context.Context, groupID string) ([]ScimUserGroupMembership, error) {
+	rows, err := q.db.QueryContext(ctx, getGroupMembers, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ScimUserGroupMembership{}
+	for rows.Next() {
+		var i ScimUserGroupMembership
+		if err := rows.Scan(&i.UserID, &i.GroupID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserGroupMemberships = `-- name: GetUserGroupMemberships :many
 SELECT
     user_id,
@@ -49,6 +49,16 @@ func (q *Queries) CreateUserPhoneNumber(ctx context.Context, arg CreateUserPhone
 	return err
 }
 
+const deleteUserPhoneNumbers = `-- name: DeleteUserPhoneNumbers :exec
+DELETE FROM scim_user_phone_numbers
+WHERE user_id = ?1
+`
+
+func (q *Queries) DeleteUserPhoneNumbers(ctx context.Context, userID string) error {
+	_, err := q.db.ExecContext(ctx, deleteUserPhoneNumbers, userID)
+	return err
+}
+
 const getUserPhoneNumbers = `-- name: GetUserPhoneNumbers :many
 SELECT id, user_id, value, display, type, primary_phone_number FROM scim_user_phone_numbers
 WHERE user_id = ?1
@@ -10,6 +10,18 @@ import (
 	"database/sql"
 )
 
+const countScimUsers = `-- name: CountScimUsers :one
+SELECT COUNT(*) FROM scim_users
+WHERE organisation_id = ?1
+`
+
+func (q *Queries) CountScimUsers(ctx context.Context, organisationid string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countScimUsers, organisationid)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createScimUser = `-- name: CreateScimUser :one
 INSERT INTO scim_users (
     id,
@@ -147,6 +159,22 @@ func (q *Queries) CreateScimUser(ctx context.Context, arg CreateScimUserParams)
 	return id, err
 }
 
+const deleteScimUser = `-- name: DeleteScimUser :exec
+DELETE FROM scim_users
+WHERE id = ?1
+AND organisation_id = ?2
+`
+
+type DeleteScimUserParams struct {
+	ID             string
+	Organisationid string
+}
+
+func (q *Queries) DeleteScimUser(ctx context.Context, arg DeleteScimUserParams) error {
+	_, err := q.db.ExecContext(ctx, deleteScimUser, arg.ID, arg.Organisationid)
+	return err
+}
+
 const getAllScimUsers = `-- name: GetAllScimUsers :many
 SELECT id, external_id, user_name, display_name, nick_name, profile_url, title, user_type, preferred_language, locale, timezone, active, password, meta_resource_type, meta_created, meta_last_modified, meta_version, name_formatted, name_family_name, name_given_name, name_middle_name, name_honorific_prefix, name_honorific_suffix, employee_number, organization, department, division, cost_center, manager_id, organisation_id FROM scim_users
 WHERE organisation_id = ?1
@@ -255,3 +283,373 @@ func (q *Queries) GetScimUserById(ctx context.Context, arg GetScimUserByIdParams
 	)
 	return i, err
 }
+
+const getScimUserByUserName = `-- name: GetScimUserByUserName :one
+SELECT id, external_id, user_name, display_name, nick_name, profile_url, title, user_type, preferred_language, locale, timezone, active, password, meta_resource_type, meta_created, meta_last_modified, meta_version, name_formatted, name_family_name, name_given_name, name_middle_name, name_honorific_prefix, name_honorific_suffix, employee_number, organization, department, division, cost_center, manager_id, organisation_id FROM scim_users
+WHERE user_name = ?1
+`
+
+func (q *Queries) GetScimUserByUserName(ctx context.Context, username string) (ScimUser, error) {
+	row := q.db.QueryRowContext(ctx, getScimUserByUserName, username)
+	var i ScimUser
+	err := row.Scan(
+		&i.ID,
+		&i.ExternalID,
+		&i.UserName,
+		&i.DisplayName,
+		&i.NickName,
+		&i.ProfileUrl,
+		&i.Title,
+		&i.UserType,
+		&i.PreferredLanguage,
+		&i.Locale,
+		&i.Timezone,
+		&i.Active,
+		&i.Password,
+		&i.MetaResourceType,
+		&i.MetaCreated,
+		&i.MetaLastModified,
+		&i.MetaVersion,
+		&i.NameFormatted,
+		&i.NameFamilyName,
+		&i.NameGivenName,
+		&i.NameMiddleName,
+		&i.NameHonorificPrefix,
+		&i.NameHonorificSuffix,
+		&i.EmployeeNumber,
+		&i.Organization,
+		&i.Department,
+		&i.Division,
+		&i.CostCenter,
+		&i.ManagerID,
+		&i.OrganisationID,
+	)
+	return i, err
+}
+
+const getScimUserIdsAfter = `-- name: GetScimUserIdsAfter :many
+SELECT id FROM scim_users
+WHERE organisation_id = ?1
+AND id > ?2
+ORDER BY id
+LIMIT ?3
+`
+
+type GetScimUserIdsAfterParams struct {
+	Organisationid string
+	After          string
+	Limit          int64
+}
+
+func (q *Queries) GetScimUserIdsAfter(ctx context.Context, arg GetScimUserIdsAfterParams) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, getScimUserIdsAfter, arg.Organisationid, arg.After, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getScimUsersByEmployeeNumber = `-- name: GetScimUsersByEmployeeNumber :many
+SELECT id, external_id, user_name, display_name, nick_name, profile_url, title, user_type, preferred_language, locale, timezone, active, password, meta_resource_type, meta_created, meta_last_modified, meta_version, name_formatted, name_family_name, name_given_name, name_middle_name, name_honorific_prefix, name_honorific_suffix, employee_number, organization, department, division, cost_center, manager_id, organisation_id FROM scim_users
+WHERE organisation_id = ?1
+AND employee_number = ?2
+`
+
+type GetScimUsersByEmployeeNumberParams struct {
+	Organisationid string
+	Employeenumber sql.NullString
+}
+
+func (q *Queries) GetScimUsersByEmployeeNumber(ctx context.Context, arg GetScimUsersByEmployeeNumberParams) ([]ScimUser, error) {
+	rows, err := q.db.QueryContext(ctx, getScimUsersByEmployeeNumber, arg.Organisationid, arg.Employeenumber)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ScimUser{}
+	for rows.Next() {
+		var i ScimUser
+		if err := rows.Scan(
+			&i.ID,
+			&i.ExternalID,
+			&i.UserName,
+			&i.DisplayName,
+			&i.NickName,
+			&i.ProfileUrl,
+			&i.Title,
+			&i.UserType,
+			&i.PreferredLanguage,
+			&i.Locale,
+			&i.Timezone,
+			&i.Active,
+			&i.Password,
+			&i.MetaResourceType,
+			&i.MetaCreated,
+			&i.MetaLastModified,
+			&i.MetaVersion,
+			&i.NameFormatted,
+			&i.NameFamilyName,
+			&i.NameGivenName,
+			&i.NameMiddleName,
+			&i.NameHonorificPrefix,
+			&i.NameHonorificSuffix,
+			&i.EmployeeNumber,
+			&i.Organization,
+			&i.Department,
+			&i.Division,
+			&i.CostCenter,
+			&i.ManagerID,
+			&i.OrganisationID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getScimUsersByExternalId = `-- name: GetScimUsersByExternalId :many
+SELECT id, external_id, user_name, display_name, nick_name, profile_url, title, user_type, preferred_language, locale, timezone, active, password, meta_resource_type, meta_created, meta_last_modified, meta_version, name_formatted, name_family_name, name_given_name, name_middle_name, name_honorific_prefix, name_honorific_suffix, employee_number, organization, department, division, cost_center, manager_id, organisation_id FROM scim_users
+WHERE organisation_id = ?1
+AND external_id = ?2
+`
+
+type GetScimUsersByExternalIdParams struct {
+	Organisationid string
+	Externalid     sql.NullString
+}
+
+func (q *Queries) GetScimUsersByExternalId(ctx context.Context, arg GetScimUsersByExternalIdParams) ([]ScimUser, error) {
+	rows, err := q.db.QueryContext(ctx, getScimUsersByExternalId, arg.Organisationid, arg.Externalid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ScimUser{}
+	for rows.Next() {
+		var i ScimUser
+		if err := rows.Scan(
+			&i.ID,
+			&i.ExternalID,
+			&i.UserName,
+			&i.DisplayName,
+			&i.NickName,
+			&i.ProfileUrl,
+			&i.Title,
+			&i.UserType,
+			&i.PreferredLanguage,
+			&i.Locale,
+			&i.Timezone,
+			&i.Active,
+			&i.Password,
+			&i.MetaResourceType,
+			&i.MetaCreated,
+			&i.MetaLastModified,
+			&i.MetaVersion,
+			&i.NameFormatted,
+			&i.NameFamilyName,
+			&i.NameGivenName,
+			&i.NameMiddleName,
+			&i.NameHonorificPrefix,
+			&i.NameHonorificSuffix,
+			&i.EmployeeNumber,
+			&i.Organization,
+			&i.Department,
+			&i.Division,
+			&i.CostCenter,
+			&i.ManagerID,
+			&i.OrganisationID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getScimUsersByPrimaryEmail = `-- name: GetScimUsersByPrimaryEmail :many
+SELECT id, external_id, user_name, display_name, nick_name, profile_url, title, user_type, preferred_language, locale, timezone, active, password, meta_resource_type, meta_created, meta_last_modified, meta_version, name_formatted, name_family_name, name_given_name, name_middle_name, name_honorific_prefix, name_honorific_suffix, employee_number, organization, department, division, cost_center, manager_id, organisation_id FROM scim_users
+WHERE organisation_id = ?1
+AND id IN (
+    SELECT user_id FROM scim_user_emails
+    WHERE scim_user_emails.value = ?2 COLLATE NOCASE
+    AND primary_email = TRUE
+)
+`
+
+type GetScimUsersByPrimaryEmailParams struct {
+	Organisationid string
+	Email          string
+}
+
+func (q *Queries) GetScimUsersByPrimaryEmail(ctx context.Context, arg GetScimUsersByPrimaryEmailParams) ([]ScimUser, error) {
+	rows, err := q.db.QueryContext(ctx, getScimUsersByPrimaryEmail, arg.Organisationid, arg.Email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ScimUser{}
+	for rows.Next() {
+		var i ScimUser
+		if err := rows.Scan(
+			&i.ID,
+			&i.ExternalID,
+			&i.UserName,
+			&i.DisplayName,
+			&i.NickName,
+			&i.ProfileUrl,
+			&i.Title,
+			&i.UserType,
+			&i.PreferredLanguage,
+			&i.Locale,
+			&i.Timezone,
+			&i.Active,
+			&i.Password,
+			&i.MetaResourceType,
+			&i.MetaCreated,
+			&i.MetaLastModified,
+			&i.MetaVersion,
+			&i.NameFormatted,
+			&i.NameFamilyName,
+			&i.NameGivenName,
+			&i.NameMiddleName,
+			&i.NameHonorificPrefix,
+			&i.NameHonorificSuffix,
+			&i.EmployeeNumber,
+			&i.Organization,
+			&i.Department,
+			&i.Division,
+			&i.CostCenter,
+			&i.ManagerID,
+			&i.OrganisationID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateScimUser = `-- name: UpdateScimUser :exec
+UPDATE scim_users
+SET external_id = ?1,
+    user_name = ?2,
+    display_name = ?3,
+    nick_name = ?4,
+    profile_url = ?5,
+    title = ?6,
+    user_type = ?7,
+    preferred_language = ?8,
+    locale = ?9,
+    timezone = ?10,
+    active = ?11,
+    meta_last_modified = ?12,
+    name_formatted = ?13,
+    name_family_name = ?14,
+    name_given_name = ?15,
+    name_middle_name = ?16,
+    name_honorific_prefix = ?17,
+    name_honorific_suffix = ?18,
+    employee_number = ?19,
+    organization = ?20,
+    department = ?21,
+    division = ?22,
+    cost_center = ?23,
+    manager_id = ?24
+WHERE id = ?25
+AND organisation_id = ?26
+`
+
+type UpdateScimUserParams struct {
+	ExternalID          sql.NullString
+	UserName            string
+	DisplayName         sql.NullString
+	NickName            sql.NullString
+	ProfileUrl          sql.NullString
+	Title               sql.NullString
+	UserType            sql.NullString
+	PreferredLanguage   sql.NullString
+	Locale              sql.NullString
+	Timezone            sql.NullString
+	Active              bool
+	MetaLastModified    string
+	NameFormatted       sql.NullString
+	NameFamilyName      sql.NullString
+	NameGivenName       sql.NullString
+	NameMiddleName      sql.NullString
+	NameHonorificPrefix sql.NullString
+	NameHonorificSuffix sql.NullString
+	EmployeeNumber      sql.NullString
+	Organization        sql.NullString
+	Department          sql.NullString
+	Division            sql.NullString
+	CostCenter          sql.NullString
+	ManagerID           sql.NullString
+	ID                  string
+	OrganisationID      string
+}
+
+func (q *Queries) UpdateScimUser(ctx context.Context, arg UpdateScimUserParams) error {
+	_, err := q.db.ExecContext(ctx, updateScimUser,
+		arg.ExternalID,
+		arg.UserName,
+		arg.DisplayName,
+		arg.NickName,
+		arg.ProfileUrl,
+		arg.Title,
+		arg.UserType,
+		arg.PreferredLanguage,
+		arg.Locale,
+		arg.Timezone,
+		arg.Active,
+		arg.MetaLastModified,
+		arg.NameFormatted,
+		arg.NameFamilyName,
+		arg.NameGivenName,
+		arg.NameMiddleName,
+		arg.NameHonorificPrefix,
+		arg.NameHonorificSuffix,
+		arg.EmployeeNumber,
+		arg.Organization,
+		arg.Department,
+		arg.Division,
+		arg.CostCenter,
+		arg.ManagerID,
+		arg.ID,
+		arg.OrganisationID,
+	)
+	return err
+}
@@ -12,7 +12,7 @@ import (
 )
 
 const getAllUsers = `-- name: GetAllUsers :many
-SELECT id, username, email, password, created_by, created_on_utc, modified_on_utc, modified_by FROM users
+SELECT id, username, email, password, created_by, created_on_utc, modified_on_utc, modified_by, failed_logins, locked_until_utc FROM users
 `
 
 func (q *Queries) GetAllUsers(ctx context.Context) ([]User, error) {
@@ -33,6 +33,8 @@ func (q *Queries) GetAllUsers(ctx context.Context) ([]User, error) {
 			&i.CreatedOnUtc,
 			&i.ModifiedOnUtc,
 			&i.ModifiedBy,
+			&i.FailedLogins,
+			&i.LockedUntilUtc,
 		); err != nil {
 			return nil, err
 		}
@@ -47,6 +49,106 @@ func (q *Queries) GetAllUsers(ctx context.Context) ([]User, error) {
 	return items, nil
 }
 
+const getUserByEmail = `-- name: GetUserByEmail :one
+SELECT id, username, email, password, created_by, created_on_utc, modified_on_utc, modified_by, failed_logins, locked_until_utc FROM users
+WHERE email = ?1
+`
+
+func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByEmail, email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.Password,
+		&i.CreatedBy,
+		&i.CreatedOnUtc,
+		&i.ModifiedOnUtc,
+		&i.ModifiedBy,
+		&i.FailedLogins,
+		&i.LockedUntilUtc,
+	)
+	return i, err
+}
+
+const getUserById = `-- name: GetUserById :one
+SELECT id, username, email, password, created_by, created_on_utc, modified_on_utc, modified_by, failed_logins, locked_until_utc FROM users
+WHERE id = ?1
+`
+
+func (q *Queries) GetUserById(ctx context.Context, id string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserById, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.Password,
+		&i.CreatedBy,
+		&i.CreatedOnUtc,
+		&i.ModifiedOnUtc,
+		&i.ModifiedBy,
+		&i.FailedLogins,
+		&i.LockedUntilUtc,
+	)
+	return i, err
+}
+
+const getUserByUsername = `-- name: GetUserByUsername :one
+SELECT id, username, email, password, created_by, created_on_utc, modified_on_utc, modified_by, failed_logins, locked_until_utc FROM users
+WHERE username = ?1
+`
+
+func (q *Queries) GetUserByUsername(ctx context.Context, username string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByUsername, username)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.Password,
+		&i.CreatedBy,
+		&i.CreatedOnUtc,
+		&i.ModifiedOnUtc,
+		&i.ModifiedBy,
+		&i.FailedLogins,
+		&i.LockedUntilUtc,
+	)
+	return i, err
+}
+
+const lockUser = `-- name: LockUser :exec
+UPDATE users
+SET failed_logins = 0,
+    locked_until_utc = ?1
+WHERE id = ?2
+`
+
+type LockUserParams struct {
+	Lockeduntilutc sql.NullTime
+	ID             string
+}
+
+func (q *Queries) LockUser(ctx context.Context, arg LockUserParams) error {
+	_, err := q.db.ExecContext(ctx, lockUser, arg.Lockeduntilutc, arg.ID)
+	return err
+}
+
+const recordFailedLogin = `-- name: RecordFailedLogin :one
+UPDATE users
+SET failed_logins = failed_logins + 1
+WHERE id = ?1
+RETURNING failed_logins
+`
+
+func (q *Queries) RecordFailedLogin(ctx context.Context, id string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, recordFailedLogin, id)
+	var failedLogins int64
+	err := row.Scan(&failedLogins)
+	return failedLogins, err
+}
+
 const registerUser = `-- name: RegisterUser :one
 INSERT INTO users (id, username, email, password, created_by, created_on_utc, modified_on_utc, modified_by)
 VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8)
@@ -79,3 +181,15 @@ func (q *Queries) RegisterUser(ctx context.Context, arg RegisterUserParams) (str
 	err := row.Scan(&id)
 	return id, err
 }
+
+const resetFailedLogins = `-- name: ResetFailedLogins :exec
+UPDATE users
+SET failed_logins = 0,
+    locked_until_utc = NULL
+WHERE id = ?1
+`
+
+func (q *Queries) ResetFailedLogins(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, resetFailedLogins, id)
+	return err
+}
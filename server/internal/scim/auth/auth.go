@@ -0,0 +1,319 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/clientcert"
+	"github.com/jawee/scimtiplexer/internal/issuer"
+	"github.com/jawee/scimtiplexer/internal/oauth"
+	"github.com/jawee/scimtiplexer/internal/ratelimit"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/scim"
+	"github.com/jawee/scimtiplexer/internal/token"
+)
+
+// lastUsedInterval limits how often the last used columns of a token are written.
+const lastUsedInterval = time.Minute
+
+// Authenticator authenticates requests to the SCIM endpoints. Clients send
+// a static organisation token, a JWT from the OAuth token endpoint or a JWT
+// from an issuer the organisation trusts. Requests without a bearer token may
+// instead authenticate with a TLS client certificate. Authenticated requests
+// are held to the SCIM limits of their organisation.
+type Authenticator struct {
+	repo     repository.Querier
+	issuer   *oauth.TokenIssuer
+	verifier *issuer.Verifier
+	certs    *clientcert.Verifier
+	limiter  *ratelimit.Limiter
+}
+
+func NewAuthenticator(repo repository.Querier, tokenIssuer *oauth.TokenIssuer, verifier *issuer.Verifier, certs *clientcert.Verifier, limiter *ratelimit.Limiter) *Authenticator {
+	return &Authenticator{
+		repo:     repo,
+		issuer:   tokenIssuer,
+		verifier: verifier,
+		certs:    certs,
+		limiter:  limiter,
+	}
+}
+
+// principal is the organisation and scopes a request is authenticated as.
+// source is the inbound source of organisation tokens that have one, and
+// credential identifies the token, client or certificate mapping the request
+// authenticated with for its rate limit.
+type principal struct {
+	organisationId string
+	scopes         []string
+	source         string
+	credential     string
+}
+
+// authError is returned when a request cannot be authenticated, and carries
+// the response to send.
+type authError struct {
+	status int
+	detail string
+}
+
+func (e *authError) Error() string {
+	return e.detail
+}
+
+// ScimEndpointAuth authenticates the bearer token of a SCIM request and
+// requires it to hold the given scope.
+func (a *Authenticator) ScimEndpointAuth(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slog.Debug("ScimEndpointAuth called", "method", r.Method, "url", r.URL.Path)
+
+		authHeader := r.Header.Get("Authorization")
+		hasCertificate := r.TLS != nil && len(r.TLS.PeerCertificates) > 0
+		if (authHeader == "" && !hasCertificate) || (authHeader != "" && !strings.HasPrefix(authHeader, "Bearer ")) {
+			scim.WriteError(w, http.StatusUnauthorized, "Missing bearer token")
+			return
+		}
+
+		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
+
+		// The organisation routes only try the trusted issuers and
+		// certificate mappings of their organisation, so another
+		// organisation registering the same ones can't take the request.
+		var pathOrganisationId string
+		if orgSlug := r.PathValue("orgSlug"); orgSlug != "" {
+			organisation, err := a.repo.GetOrganisationBySlug(r.Context(), orgSlug)
+			if err != nil && err != sql.ErrNoRows {
+				slog.Error("GetOrganisationBySlug failed", "error", err, "slug", orgSlug)
+				scim.WriteError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			if err == sql.ErrNoRows {
+				slog.Info("Organisation not found", "slug", orgSlug)
+				scim.WriteError(w, http.StatusForbidden, "Token is not valid for this organisation")
+				return
+			}
+			pathOrganisationId = organisation.ID
+		}
+
+		var p principal
+		var err error
+		switch {
+		case authHeader == "":
+			p, err = a.authenticateCertificate(r, pathOrganisationId)
+		case oauth.IsJWT(tokenStr):
+			p, err = a.authenticateJWT(r.Context(), tokenStr, pathOrganisationId)
+		default:
+			p, err = a.authenticateToken(r, tokenStr)
+		}
+		if err != nil {
+			var authErr *authError
+			if errors.As(err, &authErr) {
+				scim.WriteError(w, authErr.status, authErr.detail)
+				return
+			}
+			slog.Error("Authentication failed", "error", err)
+			scim.WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		if !token.HasScope(p.scopes, scope) {
+			slog.Info("Credentials are missing scope", "orgid", p.organisationId, "scope", scope)
+			scim.WriteError(w, http.StatusForbidden, "Token does not have the "+scope+" scope")
+			return
+		}
+
+		if pathOrganisationId != "" && pathOrganisationId != p.organisationId {
+			slog.Info("Token does not belong to organisation", "slug", r.PathValue("orgSlug"), "orgid", p.organisationId)
+			scim.WriteError(w, http.StatusForbidden, "Token is not valid for this organisation")
+			return
+		}
+
+		r, ok := a.limit(w, r, p)
+		if !ok {
+			return
+		}
+
+		claimsCtx := context.WithValue(r.Context(), "orgid", p.organisationId)
+		claimsCtx = context.WithValue(claimsCtx, "source", p.source)
+		r = r.WithContext(claimsCtx)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticateToken looks up a static organisation token.
+func (a *Authenticator) authenticateToken(r *http.Request, tokenStr string) (principal, error) {
+	orgToken, err := a.repo.GetOrganisationTokenByHash(r.Context(), token.Hash(tokenStr))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			slog.Info("Token not found in database")
+			return principal{}, &authError{http.StatusUnauthorized, "Invalid bearer token"}
+		}
+		return principal{}, err
+	}
+
+	now := time.Now().UTC()
+	if err := token.Validate(orgToken, now); err != nil {
+		slog.Info("Rejected token", "tokenid", orgToken.ID, "reason", err)
+		return principal{}, &authError{http.StatusUnauthorized, "Bearer token is no longer valid: " + err.Error()}
+	}
+
+	if !orgToken.LastUsedOnUtc.Valid || now.Sub(orgToken.LastUsedOnUtc.Time) > lastUsedInterval {
+		a.updateTokenLastUsed(r, orgToken.ID, now)
+	}
+
+	return principal{
+		organisationId: orgToken.OrganisationID,
+		scopes:         token.ParseScopes(orgToken.Scopes),
+		source:         orgToken.Source.String,
+		credential:     "token:" + orgToken.ID,
+	}, nil
+}
+
+// authenticateJWT verifies an access token from the OAuth token endpoint, or
+// a token from a trusted external issuer of the organisation organisationId,
+// or of any organisation when it is empty.
+func (a *Authenticator) authenticateJWT(ctx context.Context, tokenStr, organisationId string) (principal, error) {
+	iss, err := issuer.PeekIssuer(tokenStr)
+	if err != nil {
+		slog.Info("Rejected malformed JWT", "reason", err)
+		return principal{}, &authError{http.StatusUnauthorized, "Invalid access token"}
+	}
+	if iss != a.issuer.Issuer() {
+		return a.authenticateTrustedJWT(ctx, tokenStr, organisationId)
+	}
+
+	verified, err := a.issuer.Verify(ctx, tokenStr)
+	if err != nil {
+		if errors.Is(err, oauth.ErrInvalidToken) {
+			slog.Info("Rejected access token", "reason", err)
+			return principal{}, &authError{http.StatusUnauthorized, "Invalid access token"}
+		}
+		return principal{}, err
+	}
+
+	return principal{
+		organisationId: verified.OrganisationID,
+		scopes:         verified.Scopes,
+		credential:     "client:" + verified.ClientID,
+	}, nil
+}
+
+func (a *Authenticator) authenticateTrustedJWT(ctx context.Context, tokenStr, organisationId string) (principal, error) {
+	verified, err := a.verifier.Verify(ctx, tokenStr, organisationId)
+	if err != nil {
+		if errors.Is(err, issuer.ErrInvalidToken) || errors.Is(err, issuer.ErrUnknownIssuer) {
+			slog.Info("Rejected external token", "reason", err)
+			return principal{}, &authError{http.StatusUnauthorized, "Invalid access token"}
+		}
+		return principal{}, err
+	}
+
+	slog.Debug("Authenticated external token", "trustedissuerid", verified.TrustedIssuerID, "sub", verified.Subject)
+	return principal{
+		organisationId: verified.OrganisationID,
+		scopes:         verified.Scopes,
+		credential:     "issuer:" + verified.TrustedIssuerID + ":" + verified.Subject,
+	}, nil
+}
+
+// authenticateCertificate maps the TLS client certificate of the request to
+// the organisation organisationId, or to any organisation when it is empty.
+func (a *Authenticator) authenticateCertificate(r *http.Request, organisationId string) (principal, error) {
+	verified, err := a.certs.Verify(r.Context(), r.TLS.PeerCertificates, organisationId)
+	if err != nil {
+		if errors.Is(err, clientcert.ErrUnknownCertificate) {
+			slog.Info("Rejected client certificate", "subject", r.TLS.PeerCertificates[0].Subject.String())
+			return principal{}, &authError{http.StatusUnauthorized, "Client certificate is not trusted"}
+		}
+		return principal{}, err
+	}
+
+	slog.Debug("Authenticated client certificate", "mappingid", verified.MappingID, "subject", verified.Subject)
+	return principal{
+		organisationId: verified.OrganisationID,
+		scopes:         verified.Scopes,
+		credential:     "certificate:" + verified.MappingID,
+	}, nil
+}
+
+func (a *Authenticator) updateTokenLastUsed(r *http.Request, tokenId string, now time.Time) {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	err = a.repo.UpdateOrganisationTokenLastUsed(r.Context(), repository.UpdateOrganisationTokenLastUsedParams{
+		Lastusedonutc: sql.NullTime{Time: now, Valid: true},
+		Lastusedip:    sql.NullString{String: ip, Valid: ip != ""},
+		ID:            tokenId,
+	})
+	if err != nil {
+		slog.Error("UpdateOrganisationTokenLastUsed failed", "error", err, "tokenid", tokenId)
+	}
+}
+
+// limit applies the SCIM limits of the organisation of a request. Requests
+// over a rate limit are answered with 429 and a Retry-After header. The body
+// of a POST, PUT or PATCH request is limited to the size limit, a larger
+// Content-Length is answered with 413 at once and reading past the limit
+// fails with an *http.MaxBytesError.
+func (a *Authenticator) limit(w http.ResponseWriter, r *http.Request, p principal) (*http.Request, bool) {
+	limits, err := a.limiter.Limits(r.Context(), p.organisationId)
+	if err != nil {
+		slog.Error("Failed to get SCIM limits", "error", err, "orgid", p.organisationId)
+		scim.WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return r, false
+	}
+
+	if limit, wait := a.limiter.Allow(p.organisationId, p.credential, limits); limit != "" {
+		retryAfter := max(1, int(math.Ceil(wait.Seconds())))
+		slog.Info("Rate limited SCIM request", "orgid", p.organisationId, "limit", limit, "retryAfter", retryAfter)
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		scim.WriteError(w, http.StatusTooManyRequests, "Too many requests, the "+limit+" rate limit was exceeded")
+		return r, false
+	}
+
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return r, true
+	}
+	if r.ContentLength > limits.MaxBodyBytes {
+		a.limiter.TooLarge(p.organisationId)
+		scim.WriteError(w, http.StatusRequestEntityTooLarge, "Request body is larger than "+strconv.FormatInt(limits.MaxBodyBytes, 10)+" bytes")
+		return r, false
+	}
+	r.Body = &limitedBody{
+		ReadCloser: http.MaxBytesReader(w, r.Body, limits.MaxBodyBytes),
+		exceeded:   func() { a.limiter.TooLarge(p.organisationId) },
+	}
+	return r, true
+}
+
+// limitedBody counts a body without a Content-Length that turns out to
+// exceed the size limit.
+type limitedBody struct {
+	io.ReadCloser
+	exceeded func()
+	counted  bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var tooLarge *http.MaxBytesError
+	if !b.counted && errors.As(err, &tooLarge) {
+		b.counted = true
+		b.exceeded()
+	}
+	return n, err
+}
@@ -0,0 +1,331 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jawee/scimtiplexer/internal/clientcert"
+	"github.com/jawee/scimtiplexer/internal/database/databasetest"
+	"github.com/jawee/scimtiplexer/internal/issuer"
+	"github.com/jawee/scimtiplexer/internal/oauth"
+	"github.com/jawee/scimtiplexer/internal/ratelimit"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/scim/auth"
+	"github.com/jawee/scimtiplexer/internal/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testServer serves a users endpoint behind the authenticator, for the
+// organisations acme and globex.
+type testServer struct {
+	http.Handler
+	repo          repository.Querier
+	tokenIssuer   *oauth.TokenIssuer
+	organisations map[string]string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	repo := databasetest.New(t).GetRepository()
+	s := &testServer{
+		repo:          repo,
+		tokenIssuer:   oauth.NewTokenIssuer(repo),
+		organisations: make(map[string]string),
+	}
+	for _, slug := range []string{"acme", "globex"} {
+		now := time.Now().UTC()
+		id, err := repo.CreateOrganisation(context.Background(), repository.CreateOrganisationParams{
+			ID: uuid.NewString(), Name: slug, Slug: slug, Createdonutc: now, Modifiedonutc: now,
+		})
+		require.NoError(t, err)
+		s.organisations[slug] = id
+	}
+
+	a := auth.NewAuthenticator(repo, s.tokenIssuer, issuer.NewVerifier(repo), clientcert.NewVerifier(repo), ratelimit.NewLimiter(repo))
+	// The handler answers with the organisation the request authenticated
+	// as, and reads the body like the SCIM handlers do.
+	users := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		io.WriteString(w, r.Context().Value("orgid").(string))
+	})
+	mux := http.NewServeMux()
+	mux.Handle("GET /scim/v2/Users", a.ScimEndpointAuth(token.ScopeUsersRead, users))
+	mux.Handle("GET /scim/v2/{orgSlug}/Users", a.ScimEndpointAuth(token.ScopeUsersRead, users))
+	mux.Handle("POST /scim/v2/{orgSlug}/Users", a.ScimEndpointAuth(token.ScopeUsersWrite, users))
+	s.Handler = mux
+	return s
+}
+
+// createToken stores a token of the organisation slug with the scopes and
+// returns its id and the token.
+func (s *testServer) createToken(t *testing.T, slug, scopes string) (string, string) {
+	t.Helper()
+	raw, err := token.Generate()
+	require.NoError(t, err)
+	now := time.Now().UTC()
+	id, err := s.repo.CreateOrganisationToken(context.Background(), repository.CreateOrganisationTokenParams{
+		ID:             uuid.NewString(),
+		Organisationid: s.organisations[slug],
+		Tokenprefix:    token.Prefix(raw),
+		Tokenhash:      token.Hash(raw),
+		Scopes:         scopes,
+		Createdby:      "test",
+		Createdonutc:   now,
+		Modifiedonutc:  now,
+	})
+	require.NoError(t, err)
+	return id, raw
+}
+
+func (s *testServer) do(method, path, bearer, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestTokenIsLookedUpByHash(t *testing.T) {
+	s := newTestServer(t)
+	_, raw := s.createToken(t, "acme", token.ScopeUsersRead)
+
+	rec := s.do("GET", "/scim/v2/Users", raw, "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, s.organisations["acme"], rec.Body.String())
+
+	assert.Equal(t, http.StatusOK, s.do("GET", "/scim/v2/acme/Users", raw, "").Code)
+	assert.Equal(t, http.StatusForbidden, s.do("GET", "/scim/v2/globex/Users", raw, "").Code)
+
+	for name, bearer := range map[string]string{
+		"stored hash":   token.Hash(raw),
+		"unknown token": "stx_unknown",
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, http.StatusUnauthorized, s.do("GET", "/scim/v2/Users", bearer, "").Code)
+		})
+	}
+	assert.Equal(t, http.StatusUnauthorized, s.do("GET", "/scim/v2/Users", "", "").Code)
+}
+
+func TestRejectsExpiredAndRevokedTokens(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	expiredId, expired := s.createToken(t, "acme", token.ScopeUsersRead)
+	require.NoError(t, s.repo.UpdateOrganisationToken(ctx, repository.UpdateOrganisationTokenParams{
+		Scopes:         token.ScopeUsersRead,
+		Expiresonutc:   sql.NullTime{Time: now.Add(-time.Minute), Valid: true},
+		Modifiedonutc:  now,
+		ID:             expiredId,
+		Organisationid: s.organisations["acme"],
+	}))
+	revokedId, revoked := s.createToken(t, "acme", token.ScopeUsersRead)
+	require.NoError(t, s.repo.RevokeOrganisationToken(ctx, repository.RevokeOrganisationTokenParams{
+		Revokedonutc:   sql.NullTime{Time: now, Valid: true},
+		Modifiedonutc:  now,
+		ID:             revokedId,
+		Organisationid: s.organisations["acme"],
+	}))
+
+	rec := s.do("GET", "/scim/v2/acme/Users", expired, "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), token.ErrTokenExpired.Error())
+
+	rec = s.do("GET", "/scim/v2/acme/Users", revoked, "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), token.ErrTokenRevoked.Error())
+}
+
+func TestChecksScopePerRoute(t *testing.T) {
+	s := newTestServer(t)
+	_, reader := s.createToken(t, "acme", token.ScopeUsersRead)
+	_, writer := s.createToken(t, "acme", token.ScopeUsersWrite)
+
+	assert.Equal(t, http.StatusOK, s.do("GET", "/scim/v2/acme/Users", reader, "").Code)
+	assert.Equal(t, http.StatusForbidden, s.do("POST", "/scim/v2/acme/Users", reader, "{}").Code)
+	assert.Equal(t, http.StatusOK, s.do("POST", "/scim/v2/acme/Users", writer, "{}").Code)
+	assert.Equal(t, http.StatusForbidden, s.do("GET", "/scim/v2/acme/Users", writer, "").Code)
+}
+
+func TestRecordsTokenLastUsed(t *testing.T) {
+	s := newTestServer(t)
+	id, raw := s.createToken(t, "acme", token.ScopeUsersRead)
+
+	require.Equal(t, http.StatusOK, s.do("GET", "/scim/v2/acme/Users", raw, "").Code)
+
+	stored, err := s.repo.GetOrganisationTokenByHash(context.Background(), token.Hash(raw))
+	require.NoError(t, err)
+	assert.Equal(t, id, stored.ID)
+	assert.True(t, stored.LastUsedOnUtc.Valid)
+	assert.Equal(t, "192.0.2.1", stored.LastUsedIp.String, "the address of httptest requests")
+}
+
+func TestAuthenticatesClientAccessTokens(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	id := uuid.NewString()
+	_, err := s.repo.CreateOauthClient(ctx, repository.CreateOauthClientParams{
+		ID:             id,
+		Organisationid: s.organisations["acme"],
+		Clientid:       "okta",
+		Secrethash:     token.Hash("secret"),
+		Scopes:         token.ScopeUsersRead,
+		Createdby:      "test",
+		Createdonutc:   now,
+		Modifiedonutc:  now,
+	})
+	require.NoError(t, err)
+	accessToken, err := s.tokenIssuer.IssueClientCredentials(ctx, "okta", "secret", "")
+	require.NoError(t, err)
+
+	rec := s.do("GET", "/scim/v2/acme/Users", accessToken.Token, "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, s.organisations["acme"], rec.Body.String())
+	assert.Equal(t, http.StatusForbidden, s.do("POST", "/scim/v2/acme/Users", accessToken.Token, "{}").Code)
+	assert.Equal(t, http.StatusForbidden, s.do("GET", "/scim/v2/globex/Users", accessToken.Token, "").Code)
+
+	require.NoError(t, s.repo.RevokeOauthClient(ctx, repository.RevokeOauthClientParams{
+		Revokedonutc:   sql.NullTime{Time: now, Valid: true},
+		Modifiedonutc:  now,
+		ID:             id,
+		Organisationid: s.organisations["acme"],
+	}))
+	assert.Equal(t, http.StatusUnauthorized, s.do("GET", "/scim/v2/acme/Users", accessToken.Token, "").Code)
+}
+
+// issueCertificate returns the PEM of a new certificate authority and a
+// client certificate it issued for commonName.
+func issueCertificate(t *testing.T, commonName string) (string, *x509.Certificate) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDer, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDer)
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, &key.PublicKey, caKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDer})), cert
+}
+
+func TestAuthenticatesClientCertificates(t *testing.T) {
+	s := newTestServer(t)
+	caPem, cert := issueCertificate(t, "provisioner")
+	_, untrusted := issueCertificate(t, "provisioner")
+	now := time.Now().UTC()
+	_, err := s.repo.CreateClientCertificateMapping(context.Background(), repository.CreateClientCertificateMappingParams{
+		ID:             uuid.NewString(),
+		Organisationid: s.organisations["acme"],
+		Cabundle:       caPem,
+		Matchtype:      clientcert.MatchSubject,
+		Matchvalue:     "provisioner",
+		Scopes:         token.ScopeUsersRead,
+		Createdby:      "test",
+		Createdonutc:   now,
+		Modifiedonutc:  now,
+	})
+	require.NoError(t, err)
+	withCertificate := func(cert *x509.Certificate, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := withCertificate(cert, "/scim/v2/acme/Users")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, s.organisations["acme"], rec.Body.String())
+	assert.Equal(t, http.StatusOK, withCertificate(cert, "/scim/v2/Users").Code)
+
+	assert.Equal(t, http.StatusUnauthorized, withCertificate(cert, "/scim/v2/globex/Users").Code, "only the mappings of the organisation are tried")
+	assert.Equal(t, http.StatusUnauthorized, withCertificate(untrusted, "/scim/v2/acme/Users").Code, "the certificate must chain to the mapped CA")
+}
+
+// setLimits stores the SCIM limits of the organisation slug.
+func (s *testServer) setLimits(t *testing.T, slug string, params repository.UpsertScimLimitsParams) {
+	t.Helper()
+	params.Organisationid = s.organisations[slug]
+	params.Modifiedonutc = time.Now().UTC()
+	require.NoError(t, s.repo.UpsertScimLimits(context.Background(), params))
+}
+
+func TestRateLimitsRequests(t *testing.T) {
+	s := newTestServer(t)
+	s.setLimits(t, "acme", repository.UpsertScimLimitsParams{Tokenratelimit: 0.1, Tokenburst: 2, Maxbodybytes: 1 << 20})
+	_, first := s.createToken(t, "acme", token.ScopeUsersRead)
+	_, second := s.createToken(t, "acme", token.ScopeUsersRead)
+
+	for range 2 {
+		require.Equal(t, http.StatusOK, s.do("GET", "/scim/v2/acme/Users", first, "").Code)
+	}
+	rec := s.do("GET", "/scim/v2/acme/Users", first, "")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "10", rec.Header().Get("Retry-After"))
+	assert.Contains(t, rec.Body.String(), ratelimit.LimitToken)
+
+	assert.Equal(t, http.StatusOK, s.do("GET", "/scim/v2/acme/Users", second, "").Code, "other tokens have their own limit")
+}
+
+func TestLimitsBodySize(t *testing.T) {
+	s := newTestServer(t)
+	s.setLimits(t, "acme", repository.UpsertScimLimitsParams{Maxbodybytes: 1024})
+	_, raw := s.createToken(t, "acme", token.ScopeUsersWrite)
+	small := strings.Repeat("a", 1024)
+	large := strings.Repeat("a", 1025)
+
+	assert.Equal(t, http.StatusOK, s.do("POST", "/scim/v2/acme/Users", raw, small).Code)
+	rec := s.do("POST", "/scim/v2/acme/Users", raw, large)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Contains(t, rec.Body.String(), "1024 bytes")
+
+	// Without a Content-Length the body is cut off while it is read.
+	req := httptest.NewRequest("POST", "/scim/v2/acme/Users", strings.NewReader(large))
+	req.ContentLength = -1
+	req.Header.Set("Authorization", "Bearer "+raw)
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
@@ -0,0 +1,48 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+const SchemaError = "urn:ietf:params:scim:api:messages:2.0:Error"
+
+// ErrorResponse is the SCIM error message defined in RFC 7644 section 3.12.
+type ErrorResponse struct {
+	Schemas  []string `json:"schemas"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+	Status   string   `json:"status"`
+}
+
+func WriteError(w http.ResponseWriter, status int, detail string) {
+	WriteTypedError(w, status, "", detail)
+}
+
+// WriteTypedError writes an error with a scimType, one of the detail error
+// keywords of RFC 7644 section 3.12.
+func WriteTypedError(w http.ResponseWriter, status int, scimType, detail string) {
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(status)
+	errResp := ErrorResponse{
+		Schemas:  []string{SchemaError},
+		ScimType: scimType,
+		Detail:   detail,
+		Status:   strconv.Itoa(status),
+	}
+	jsonOutput, _ := json.Marshal(errResp)
+	w.Write(jsonOutput)
+}
+
+// WriteBodyError writes the error for a request body that couldn't be read,
+// 413 when it's larger than the size limit of the organisation.
+func WriteBodyError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		WriteError(w, http.StatusRequestEntityTooLarge, "Request body is larger than "+strconv.FormatInt(tooLarge.Limit, 10)+" bytes")
+		return
+	}
+	WriteTypedError(w, http.StatusBadRequest, "invalidSyntax", "Invalid request body")
+}
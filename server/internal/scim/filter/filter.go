@@ -0,0 +1,542 @@
+// Package filter parses SCIM filters, RFC 7644 section 3.4.2.2, and
+// evaluates them against decoded SCIM resources.
+package filter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jawee/scimtiplexer/internal/scim/schema"
+)
+
+// ErrInvalidFilter is returned for filters that can't be parsed.
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// Filter is a parsed filter expression.
+type Filter struct {
+	root  node
+	paths []string
+}
+
+// Parse parses a filter such as
+// active eq true and emails[type eq "work" and value ew "@example.com"].
+func Parse(filter string) (*Filter, error) {
+	tokens, err := tokenize(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEnd {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidFilter, t.text)
+	}
+	return &Filter{root: root, paths: p.paths}, nil
+}
+
+// Matches reports whether a resource, decoded from JSON, matches the filter.
+// String comparisons are case insensitive. A comparison with a multi-valued
+// attribute matches if any of its values does.
+func (f *Filter) Matches(resource map[string]any) bool {
+	return f.root.matches(resource)
+}
+
+// Paths returns the attribute paths the filter refers to. Attributes within
+// a value filter are returned as sub-attributes, emails[type eq "work"]
+// refers to emails.type.
+func (f *Filter) Paths() []string {
+	return f.paths
+}
+
+type node interface {
+	matches(object map[string]any) bool
+}
+
+type logical struct {
+	and         bool
+	left, right node
+}
+
+func (n logical) matches(object map[string]any) bool {
+	if n.and {
+		return n.left.matches(object) && n.right.matches(object)
+	}
+	return n.left.matches(object) || n.right.matches(object)
+}
+
+type negation struct {
+	node node
+}
+
+func (n negation) matches(object map[string]any) bool {
+	return !n.node.matches(object)
+}
+
+// present matches attributes that have a non-empty value.
+type present struct {
+	path attributePath
+}
+
+func (n present) matches(object map[string]any) bool {
+	return len(n.path.values(object)) > 0
+}
+
+type comparison struct {
+	path     attributePath
+	operator string
+	value    any
+}
+
+func (n comparison) matches(object map[string]any) bool {
+	values := n.path.values(object)
+	switch {
+	case n.value == nil && n.operator == "eq":
+		return len(values) == 0
+	case n.value == nil && n.operator == "ne":
+		return len(values) > 0
+	case n.operator == "ne":
+		for _, v := range values {
+			if compare(v, "eq", n.value) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, v := range values {
+		if compare(v, n.operator, n.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// valueFilter matches if any value of a multi-valued attribute matches the
+// filter.
+type valueFilter struct {
+	path   attributePath
+	filter node
+}
+
+func (n valueFilter) matches(object map[string]any) bool {
+	container := n.path.container(object)
+	if container == nil {
+		return false
+	}
+	value := lookup(container, n.path.name)
+	values, ok := value.([]any)
+	if !ok {
+		values = []any{value}
+	}
+	for _, v := range values {
+		if element, ok := v.(map[string]any); ok && n.filter.matches(element) {
+			return true
+		}
+	}
+	return false
+}
+
+func compare(attribute any, operator string, value any) bool {
+	switch a := attribute.(type) {
+	case string:
+		v, ok := value.(string)
+		if !ok {
+			return false
+		}
+		a, v = strings.ToLower(a), strings.ToLower(v)
+		switch operator {
+		case "eq":
+			return a == v
+		case "co":
+			return strings.Contains(a, v)
+		case "sw":
+			return strings.HasPrefix(a, v)
+		case "ew":
+			return strings.HasSuffix(a, v)
+		case "gt":
+			return a > v
+		case "ge":
+			return a >= v
+		case "lt":
+			return a < v
+		case "le":
+			return a <= v
+		}
+	case float64:
+		v, ok := value.(float64)
+		if !ok {
+			return false
+		}
+		switch operator {
+		case "eq":
+			return a == v
+		case "gt":
+			return a > v
+		case "ge":
+			return a >= v
+		case "lt":
+			return a < v
+		case "le":
+			return a <= v
+		}
+	case bool:
+		v, ok := value.(bool)
+		return ok && operator == "eq" && a == v
+	}
+	return false
+}
+
+// attributePath is an attribute, optionally of a schema extension, with an
+// optional sub-attribute.
+type attributePath struct {
+	schema string
+	name   string
+	sub    string
+}
+
+func parsePath(path string) (attributePath, error) {
+	var p attributePath
+	rest := path
+	if strings.HasPrefix(strings.ToLower(path), "urn:") {
+		i := strings.LastIndex(path, ":")
+		p.schema, rest = path[:i], path[i+1:]
+	}
+	p.name, p.sub, _ = strings.Cut(rest, ".")
+	if !validName(p.name) || (p.sub != "" && !validName(p.sub)) {
+		return attributePath{}, fmt.Errorf("%w: invalid attribute path %q", ErrInvalidFilter, path)
+	}
+	return p, nil
+}
+
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		letter := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '$'
+		if !letter && (i == 0 || !(r >= '0' && r <= '9' || r == '_' || r == '-')) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p attributePath) String() string {
+	s := p.name
+	if p.sub != "" {
+		s += "." + p.sub
+	}
+	if p.schema != "" {
+		s = p.schema + ":" + s
+	}
+	return s
+}
+
+// container returns the object holding the attribute, the resource itself
+// for core attributes.
+func (p attributePath) container(object map[string]any) map[string]any {
+	if p.schema == "" || strings.EqualFold(p.schema, schema.User) || strings.EqualFold(p.schema, schema.Group) {
+		return object
+	}
+	ext, _ := lookup(object, p.schema).(map[string]any)
+	return ext
+}
+
+// values returns the non-empty values of the attribute. Multi-valued complex
+// attributes without a sub-attribute are compared by their value
+// sub-attribute.
+func (p attributePath) values(object map[string]any) []any {
+	container := p.container(object)
+	if container == nil {
+		return nil
+	}
+
+	var values []any
+	add := func(v any) {
+		switch v := v.(type) {
+		case nil:
+		case string:
+			if v != "" {
+				values = append(values, v)
+			}
+		case []any:
+			if len(v) > 0 {
+				values = append(values, v...)
+			}
+		default:
+			values = append(values, v)
+		}
+	}
+
+	value := lookup(container, p.name)
+	elements, multiValued := value.([]any)
+	if !multiValued {
+		elements = []any{value}
+	}
+	for _, element := range elements {
+		object, complex := element.(map[string]any)
+		switch {
+		case p.sub != "" && complex:
+			add(lookup(object, p.sub))
+		case p.sub != "":
+		case complex && multiValued:
+			add(lookup(object, "value"))
+		default:
+			add(element)
+		}
+	}
+	return values
+}
+
+// lookup returns an attribute of an object, names are case insensitive.
+func lookup(object map[string]any, name string) any {
+	if object == nil {
+		return nil
+	}
+	if v, ok := object[name]; ok {
+		return v
+	}
+	for key, v := range object {
+		if strings.EqualFold(key, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenWord
+	tokenString
+	tokenOpen
+	tokenClose
+	tokenOpenBracket
+	tokenCloseBracket
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokenOpen, "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenClose, ")"})
+			i++
+		case c == '[':
+			tokens = append(tokens, token{tokenOpenBracket, "["})
+			i++
+		case c == ']':
+			tokens = append(tokens, token{tokenCloseBracket, "]"})
+			i++
+		case c == '"':
+			end := i + 1
+			for ; end < len(s) && s[end] != '"'; end++ {
+				if s[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("%w: unterminated string", ErrInvalidFilter)
+			}
+			tokens = append(tokens, token{tokenString, s[i : end+1]})
+			i = end + 1
+		default:
+			end := i
+			for end < len(s) && !strings.ContainsRune(" \t\n\r()[]\"", rune(s[end])) {
+				end++
+			}
+			tokens = append(tokens, token{tokenWord, s[i:end]})
+			i = end
+		}
+	}
+	return append(tokens, token{kind: tokenEnd}), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	paths  []string
+	// prefix is the multi-valued attribute of the value filter being
+	// parsed.
+	prefix *attributePath
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEnd {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) keyword(word string) bool {
+	t := p.peek()
+	if t.kind == tokenWord && strings.EqualFold(t.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(kind tokenKind, text string) error {
+	if t := p.next(); t.kind != kind {
+		return fmt.Errorf("%w: expected %q", ErrInvalidFilter, text)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logical{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = logical{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.keyword("not") {
+		if err := p.expect(tokenOpen, "("); err != nil {
+			return nil, err
+		}
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenClose, ")"); err != nil {
+			return nil, err
+		}
+		return negation{n}, nil
+	}
+
+	if p.peek().kind == tokenOpen {
+		p.next()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenClose, ")"); err != nil {
+			return nil, err
+		}
+		return n, nil
+	}
+
+	t := p.next()
+	if t.kind != tokenWord {
+		return nil, fmt.Errorf("%w: expected an attribute path", ErrInvalidFilter)
+	}
+	path, err := parsePath(t.text)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek().kind == tokenOpenBracket {
+		return p.parseValueFilter(path)
+	}
+	p.addPath(path)
+
+	operator := strings.ToLower(p.next().text)
+	switch operator {
+	case "pr":
+		return present{path}, nil
+	case "eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le":
+	default:
+		return nil, fmt.Errorf("%w: unknown operator %q", ErrInvalidFilter, operator)
+	}
+
+	value, err := parseValue(p.next())
+	if err != nil {
+		return nil, err
+	}
+	return comparison{path: path, operator: operator, value: value}, nil
+}
+
+func (p *parser) parseValueFilter(path attributePath) (node, error) {
+	if p.prefix != nil || path.sub != "" {
+		return nil, fmt.Errorf("%w: unexpected [ after %s", ErrInvalidFilter, path)
+	}
+	p.next()
+	p.prefix = &path
+	n, err := p.parseOr()
+	p.prefix = nil
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(tokenCloseBracket, "]"); err != nil {
+		return nil, err
+	}
+	return valueFilter{path: path, filter: n}, nil
+}
+
+// addPath records a path the filter refers to.
+func (p *parser) addPath(path attributePath) {
+	if p.prefix != nil {
+		path = attributePath{schema: p.prefix.schema, name: p.prefix.name, sub: path.name}
+	}
+	p.paths = append(p.paths, path.String())
+}
+
+func parseValue(t token) (any, error) {
+	switch t.kind {
+	case tokenString:
+		var s string
+		if err := json.Unmarshal([]byte(t.text), &s); err != nil {
+			return nil, fmt.Errorf("%w: invalid string %s", ErrInvalidFilter, t.text)
+		}
+		return s, nil
+	case tokenWord:
+		switch strings.ToLower(t.text) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		if n, err := strconv.ParseFloat(t.text, 64); err == nil {
+			return n, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: invalid value %q", ErrInvalidFilter, t.text)
+}
@@ -0,0 +1,286 @@
+package group
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/database"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/scim"
+	"github.com/jawee/scimtiplexer/internal/scim/auth"
+	"github.com/jawee/scimtiplexer/internal/scim/filter"
+	"github.com/jawee/scimtiplexer/internal/scim/schema"
+	scimuser "github.com/jawee/scimtiplexer/internal/scim/user"
+	"github.com/jawee/scimtiplexer/internal/target"
+	"github.com/jawee/scimtiplexer/internal/token"
+)
+
+type handler struct {
+	service *service
+	auth    *auth.Authenticator
+}
+
+func RegisterEndpoints(mux *http.ServeMux, repo repository.Querier, db database.Transactor, authenticator *auth.Authenticator, dispatcher *target.Dispatcher) {
+	h := &handler{
+		service: &service{repo: repo, db: db, dispatcher: dispatcher},
+		auth:    authenticator,
+	}
+
+	slog.Debug("Registering SCIM group endpoints")
+	h.registerScimEndpoint(mux, "GET", "Groups", token.ScopeGroupsRead, http.HandlerFunc(h.handleGetGroups))
+	h.registerScimEndpoint(mux, "GET", "Groups/", token.ScopeGroupsRead, http.HandlerFunc(h.handleGetGroups))
+	h.registerScimEndpoint(mux, "POST", "Groups", token.ScopeGroupsWrite, http.HandlerFunc(h.handlePostGroups))
+
+	h.registerScimEndpoint(mux, "GET", "Groups/{id}", token.ScopeGroupsRead, http.HandlerFunc(h.handleGetGroupById))
+	h.registerScimEndpoint(mux, "PUT", "Groups/{id}", token.ScopeGroupsWrite, http.HandlerFunc(h.handlePutGroup))
+	h.registerScimEndpoint(mux, "PATCH", "Groups/{id}", token.ScopeGroupsWrite, http.HandlerFunc(h.handlePatchGroup))
+	h.registerScimEndpoint(mux, "DELETE", "Groups/{id}", token.ScopeGroupsWrite, http.HandlerFunc(h.handleDeleteGroup))
+}
+
+func (s *handler) registerScimEndpoint(mux *http.ServeMux, method, resource, scope string, handler http.Handler) {
+	for _, prefix := range []string{scimuser.SCIM_PREFIX, scimuser.SCIM_TENANT_PREFIX} {
+		mux.Handle(method+" "+prefix+resource, s.auth.ScimEndpointAuth(scope, handler))
+		mux.Handle(method+" "+prefix+strings.ToLower(resource), s.auth.ScimEndpointAuth(scope, handler))
+	}
+}
+
+// handleGetGroups lists the groups of the organisation, optionally those
+// that match a filter.
+func (s *handler) handleGetGroups(w http.ResponseWriter, r *http.Request) {
+	var f *filter.Filter
+	if text := r.URL.Query().Get("filter"); text != "" {
+		var err error
+		if f, err = filter.Parse(text); err != nil {
+			scim.WriteTypedError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+			return
+		}
+	}
+
+	groups, err := s.service.GetAllGroups(r.Context(), organisationId(r), source(r))
+	if err != nil {
+		slog.Error("Failed to get groups", "error", err)
+		scim.WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	resources := []Group{}
+	for _, group := range groups {
+		resp := ScimGroupResponse(group)
+		if f != nil && !matches(f, resp) {
+			continue
+		}
+		resources = append(resources, resp)
+	}
+
+	writeJSON(w, http.StatusOK, ListResponse{
+		Schemas:      []string{scimuser.SchemaListResponse},
+		TotalResults: len(resources),
+		StartIndex:   1,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+func matches(f *filter.Filter, group Group) bool {
+	data, _ := json.Marshal(group)
+	var resource map[string]any
+	if err := json.Unmarshal(data, &resource); err != nil {
+		return false
+	}
+	return f.Matches(resource)
+}
+
+func (s *handler) handlePostGroups(w http.ResponseWriter, r *http.Request) {
+	req, ok := readGroupRequest(w, r)
+	if !ok {
+		return
+	}
+
+	group, err := s.service.CreateGroup(r.Context(), organisationId(r), source(r), req)
+	if err != nil {
+		writeGroupError(w, err, "Failed to create group")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, ScimGroupResponse(group))
+}
+
+func (s *handler) handleGetGroupById(w http.ResponseWriter, r *http.Request) {
+	group, err := s.service.GetGroup(r.Context(), organisationId(r), source(r), r.PathValue("id"))
+	if err != nil {
+		writeGroupError(w, err, "Failed to get group")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ScimGroupResponse(group))
+}
+
+func (s *handler) handlePutGroup(w http.ResponseWriter, r *http.Request) {
+	req, ok := readGroupRequest(w, r)
+	if !ok {
+		return
+	}
+
+	group, err := s.service.ReplaceGroup(r.Context(), organisationId(r), source(r), r.PathValue("id"), req)
+	if err != nil {
+		writeGroupError(w, err, "Failed to replace group")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ScimGroupResponse(group))
+}
+
+func (s *handler) handlePatchGroup(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.Error("Failed to read group patch request", "error", err)
+		scim.WriteBodyError(w, err)
+		return
+	}
+	operations, err := scim.ParsePatch(body)
+	if err != nil {
+		scim.WritePatchError(w, err)
+		return
+	}
+
+	group, err := s.service.PatchGroup(r.Context(), organisationId(r), source(r), r.PathValue("id"), operations)
+	if err != nil {
+		writeGroupError(w, err, "Failed to patch group")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ScimGroupResponse(group))
+}
+
+func (s *handler) handleDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	if err := s.service.DeleteGroup(r.Context(), organisationId(r), r.PathValue("id")); err != nil {
+		writeGroupError(w, err, "Failed to delete group")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func readGroupRequest(w http.ResponseWriter, r *http.Request) (GroupRequest, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.Error("Failed to read group request", "error", err)
+		scim.WriteBodyError(w, err)
+		return GroupRequest{}, false
+	}
+	var req GroupRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		slog.Error("Failed to decode group request", "error", err)
+		scim.WriteTypedError(w, http.StatusBadRequest, "invalidSyntax", "Invalid request body")
+		return GroupRequest{}, false
+	}
+	return req, true
+}
+
+// writeGroupError writes the response to a failed group request.
+func writeGroupError(w http.ResponseWriter, err error, message string) {
+	var massChange *target.MassChangeError
+	switch {
+	case scim.WritePatchError(w, err):
+	case errors.As(err, &massChange):
+		slog.Warn("Write rejected by mass change threshold", "retryafter", massChange.RetryAfter)
+		w.Header().Set("Retry-After", strconv.Itoa(int(massChange.RetryAfter.Seconds())))
+		scim.WriteError(w, http.StatusServiceUnavailable, massChange.Error())
+	case errors.Is(err, sql.ErrNoRows):
+		scim.WriteError(w, http.StatusNotFound, "Group not found")
+	case errors.Is(err, errInvalidRequest):
+		scim.WriteTypedError(w, http.StatusBadRequest, "invalidValue", err.Error())
+	case errors.Is(err, errDisplayNameTaken):
+		scim.WriteTypedError(w, http.StatusConflict, "uniqueness", err.Error())
+	default:
+		slog.Error(message, "error", err)
+		scim.WriteError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(status)
+	jsonOutput, _ := json.Marshal(v)
+	w.Write(jsonOutput)
+}
+
+func organisationId(r *http.Request) string {
+	organisationId, _ := r.Context().Value("orgid").(string)
+	return organisationId
+}
+
+// source returns the inbound source the request writes as, empty if the
+// credentials have none.
+func source(r *http.Request) string {
+	source, _ := r.Context().Value("source").(string)
+	return source
+}
+
+type Member struct {
+	Value   string `json:"value"`
+	Ref     string `json:"$ref,omitempty"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+}
+
+type Group struct {
+	Schemas    []string      `json:"schemas"`
+	ID         string        `json:"id"`
+	ExternalID string        `json:"externalId,omitempty"`
+	Meta       scimuser.Meta `json:"meta"`
+
+	DisplayName string   `json:"displayName"`
+	Members     []Member `json:"members"`
+}
+
+type GroupRequest struct {
+	Schemas    []string `json:"schemas"`
+	ExternalID string   `json:"externalId,omitempty"`
+
+	DisplayName string   `json:"displayName"`
+	Members     []Member `json:"members,omitempty"`
+}
+
+type ListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []Group  `json:"Resources"`
+}
+
+func ScimGroupResponse(group groupDto) Group {
+	createdAt, _ := time.Parse(time.RFC3339, group.MetaCreated)
+	lastModifiedAt, _ := time.Parse(time.RFC3339, group.MetaLastModified)
+
+	resp := Group{
+		Schemas:    []string{schema.Group},
+		ID:         group.ID,
+		ExternalID: group.ExternalID,
+		Meta: scimuser.Meta{
+			ResourceType: "Group",
+			Created:      createdAt.UTC(),
+			LastModified: lastModifiedAt.UTC(),
+			Location:     "https://api.example.com/scim/v2/Groups/" + group.ID,
+			Version:      group.MetaVersion,
+		},
+		DisplayName: group.DisplayName,
+		Members:     []Member{},
+	}
+	for _, id := range group.Members {
+		resp.Members = append(resp.Members, Member{
+			Value: id,
+			Ref:   "https://api.example.com/scim/v2/Users/" + id,
+			Type:  target.ResourceUser,
+		})
+	}
+	return resp
+}
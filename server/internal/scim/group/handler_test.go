@@ -0,0 +1,201 @@
+package group
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/database/databasetest"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/scim"
+	"github.com/jawee/scimtiplexer/internal/target"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testOrg = "org-1"
+
+func newTestHandler(t *testing.T) (*handler, repository.Querier) {
+	db := databasetest.New(t)
+	repo := db.GetRepository()
+	dispatcher := target.NewDispatcher(repo, nil)
+	return &handler{service: &service{repo: repo, db: db, dispatcher: dispatcher}}, repo
+}
+
+// createUser stores a user with an identity from source, whose id is the
+// identity id.
+func createUser(t *testing.T, repo repository.Querier, userId, identityId, source string) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	_, err := repo.CreateScimUser(ctx, repository.CreateScimUserParams{
+		ID:               userId,
+		OrganisationID:   testOrg,
+		UserName:         userId,
+		Active:           true,
+		MetaResourceType: "User",
+		MetaCreated:      now.Format(time.RFC3339),
+		MetaLastModified: now.Format(time.RFC3339),
+	})
+	require.NoError(t, err)
+	err = repo.CreateUserIdentity(ctx, repository.CreateUserIdentityParams{
+		ID:             identityId,
+		Organisationid: testOrg,
+		Userid:         userId,
+		Source:         sql.NullString{String: source, Valid: source != ""},
+		Createdonutc:   now,
+		Modifiedonutc:  now,
+	})
+	require.NoError(t, err)
+}
+
+func serve(t *testing.T, handle http.HandlerFunc, method, id, source, body string) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+	r := httptest.NewRequest(method, "/scim/v2/Groups", strings.NewReader(body))
+	r.SetPathValue("id", id)
+	ctx := context.WithValue(r.Context(), "orgid", testOrg)
+	ctx = context.WithValue(ctx, "source", source)
+	w := httptest.NewRecorder()
+
+	handle(w, r.WithContext(ctx))
+
+	var resource map[string]any
+	if w.Body.Len() > 0 {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resource))
+	}
+	return w, resource
+}
+
+func memberValues(resource map[string]any) []string {
+	var values []string
+	members, _ := resource["members"].([]any)
+	for _, m := range members {
+		values = append(values, m.(map[string]any)["value"].(string))
+	}
+	return values
+}
+
+// groupChanges returns the group changes recorded for the targets, as
+// operation and the ids of the member users.
+func groupChanges(t *testing.T, repo repository.Querier) []string {
+	changes, err := repo.GetChangesSince(context.Background(), repository.GetChangesSinceParams{Organisationid: testOrg, Limit: 100})
+	require.NoError(t, err)
+
+	var result []string
+	for _, change := range changes {
+		require.Equal(t, target.ResourceGroup, change.ResourceType)
+		var resource map[string]any
+		require.NoError(t, json.Unmarshal([]byte(change.Resource.String), &resource))
+		result = append(result, change.Operation+" "+strings.Join(memberValues(resource), ","))
+	}
+	return result
+}
+
+func TestGroupLifecycle(t *testing.T) {
+	h, repo := newTestHandler(t)
+	createUser(t, repo, "alice", "alice", "hr")
+	createUser(t, repo, "bob", "bob-hr", "hr")
+
+	w, group := serve(t, h.handlePostGroups, "POST", "", "hr", `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:Group"], "displayName": "Engineering", "members": [{"value": "alice"}]}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	id := group["id"].(string)
+	assert.Equal(t, "Engineering", group["displayName"])
+	assert.Equal(t, []string{"alice"}, memberValues(group))
+
+	w, group = serve(t, h.handlePutGroup, "PUT", id, "hr", `{"displayName": "R&D", "members": [{"value": "alice"}, {"value": "bob-hr"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "R&D", group["displayName"])
+	assert.ElementsMatch(t, []string{"alice", "bob-hr"}, memberValues(group), "members have the ids the source knows")
+
+	w, group = serve(t, h.handlePatchGroup, "PATCH", id, "hr", `{"schemas": ["`+scim.SchemaPatchOp+`"], "Operations": [{"op": "remove", "path": "members[value eq \"alice\"]"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []string{"bob-hr"}, memberValues(group))
+
+	w, group = serve(t, h.handleGetGroupById, "GET", id, "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"bob"}, memberValues(group), "callers without a source see the user ids")
+
+	w, _ = serve(t, h.handleDeleteGroup, "DELETE", id, "hr", "")
+	require.Equal(t, http.StatusNoContent, w.Code)
+	w, _ = serve(t, h.handleGetGroupById, "GET", id, "hr", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	assert.Equal(t, []string{
+		"create alice",
+		"replace alice,bob",
+		"replace bob",
+		"delete bob",
+	}, groupChanges(t, repo), "targets get the user ids")
+}
+
+func TestPatchGroupAddsMembers(t *testing.T) {
+	h, repo := newTestHandler(t)
+	createUser(t, repo, "alice", "alice", "hr")
+	createUser(t, repo, "bob", "bob", "hr")
+	_, group := serve(t, h.handlePostGroups, "POST", "", "hr", `{"displayName": "Engineering"}`)
+	id := group["id"].(string)
+
+	w, group := serve(t, h.handlePatchGroup, "PATCH", id, "hr", `{"schemas": ["`+scim.SchemaPatchOp+`"], "Operations": [
+		{"op": "Add", "path": "members", "value": [{"value": "alice"}, {"value": "bob"}]},
+		{"op": "Replace", "path": "displayName", "value": "R&D"}]}`)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "R&D", group["displayName"])
+	assert.ElementsMatch(t, []string{"alice", "bob"}, memberValues(group))
+}
+
+func TestGetGroupsFilter(t *testing.T) {
+	h, _ := newTestHandler(t)
+	serve(t, h.handlePostGroups, "POST", "", "", `{"displayName": "Engineering"}`)
+	serve(t, h.handlePostGroups, "POST", "", "", `{"displayName": "Sales"}`)
+
+	r := httptest.NewRequest("GET", `/scim/v2/Groups?filter=displayName+eq+"sales"`, nil)
+	r = r.WithContext(context.WithValue(r.Context(), "orgid", testOrg))
+	w := httptest.NewRecorder()
+	h.handleGetGroups(w, r)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var list ListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Resources, 1)
+	assert.Equal(t, "Sales", list.Resources[0].DisplayName)
+}
+
+func TestGroupErrors(t *testing.T) {
+	h, _ := newTestHandler(t)
+	_, group := serve(t, h.handlePostGroups, "POST", "", "", `{"displayName": "Engineering"}`)
+	id := group["id"].(string)
+
+	tests := []struct {
+		name     string
+		handle   http.HandlerFunc
+		method   string
+		id       string
+		body     string
+		status   int
+		scimType string
+	}{
+		{"missing display name", h.handlePostGroups, "POST", "", `{"members": []}`, http.StatusBadRequest, "invalidValue"},
+		{"taken display name", h.handlePostGroups, "POST", "", `{"displayName": "engineering"}`, http.StatusConflict, "uniqueness"},
+		{"unknown member", h.handlePostGroups, "POST", "", `{"displayName": "Sales", "members": [{"value": "nobody"}]}`, http.StatusBadRequest, "invalidValue"},
+		{"group member", h.handlePutGroup, "PUT", id, `{"displayName": "Engineering", "members": [{"value": "` + id + `", "type": "Group"}]}`, http.StatusBadRequest, "invalidValue"},
+		{"unknown group", h.handlePutGroup, "PUT", "nope", `{"displayName": "Sales"}`, http.StatusNotFound, ""},
+		{"invalid patch", h.handlePatchGroup, "PATCH", id, `{"Operations": []}`, http.StatusBadRequest, "invalidSyntax"},
+		{"invalid patch path", h.handlePatchGroup, "PATCH", id, `{"schemas": ["` + scim.SchemaPatchOp + `"], "Operations": [{"op": "replace", "path": "members[value eq]", "value": "x"}]}`, http.StatusBadRequest, "invalidFilter"},
+		{"unknown group delete", h.handleDeleteGroup, "DELETE", "nope", "", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, resp := serve(t, tt.handle, tt.method, tt.id, "", tt.body)
+
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+			if tt.scimType != "" {
+				assert.Equal(t, tt.scimType, resp["scimType"])
+			}
+		})
+	}
+}
@@ -0,0 +1,374 @@
+package group
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jawee/scimtiplexer/internal/changes"
+	"github.com/jawee/scimtiplexer/internal/database"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/scim"
+	"github.com/jawee/scimtiplexer/internal/scim/schema"
+	scimuser "github.com/jawee/scimtiplexer/internal/scim/user"
+	"github.com/jawee/scimtiplexer/internal/target"
+)
+
+type service struct {
+	repo       repository.Querier
+	db         database.Transactor
+	dispatcher *target.Dispatcher
+}
+
+var (
+	errInvalidRequest   = errors.New("invalid request")
+	errDisplayNameTaken = errors.New("displayName is taken")
+)
+
+type groupDto struct {
+	ID               string
+	ExternalID       string
+	DisplayName      string
+	MetaCreated      string
+	MetaLastModified string
+	MetaVersion      string
+	// Members are the ids of the member users as the source that asks
+	// knows them.
+	Members []string
+}
+
+func newGroupDto(group repository.ScimGroup, members []repository.ScimUserGroupMembership, ids scimuser.Ids) groupDto {
+	dto := groupDto{
+		ID:               group.ID,
+		ExternalID:       group.ExternalID.String,
+		DisplayName:      group.DisplayName,
+		MetaCreated:      group.MetaCreated,
+		MetaLastModified: group.MetaLastModified,
+		MetaVersion:      group.MetaVersion.String,
+	}
+	for _, member := range members {
+		dto.Members = append(dto.Members, ids.ID(member.UserID))
+	}
+	return dto
+}
+
+func (s *service) GetAllGroups(ctx context.Context, organisationId, source string) ([]groupDto, error) {
+	groups, err := s.repo.GetAllScimGroups(ctx, organisationId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetAllScimGroups: %w", err)
+	}
+	ids, err := scimuser.IdentityIds(ctx, s.repo, organisationId, source)
+	if err != nil {
+		return nil, err
+	}
+
+	dtos := make([]groupDto, 0, len(groups))
+	for _, group := range groups {
+		members, err := s.repo.GetGroupMembers(ctx, group.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to GetGroupMembers: %w", err)
+		}
+		dtos = append(dtos, newGroupDto(group, members, ids))
+	}
+	return dtos, nil
+}
+
+func (s *service) GetGroup(ctx context.Context, organisationId, source, id string) (groupDto, error) {
+	return getGroup(ctx, s.repo, organisationId, source, id)
+}
+
+func getGroup(ctx context.Context, repo repository.Querier, organisationId, source, id string) (groupDto, error) {
+	group, err := repo.GetScimGroupById(ctx, repository.GetScimGroupByIdParams{
+		ID:             id,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return groupDto{}, err
+	}
+	members, err := repo.GetGroupMembers(ctx, id)
+	if err != nil {
+		return groupDto{}, fmt.Errorf("failed to GetGroupMembers: %w", err)
+	}
+	ids, err := scimuser.IdentityIds(ctx, repo, organisationId, source)
+	if err != nil {
+		return groupDto{}, err
+	}
+	return newGroupDto(group, members, ids), nil
+}
+
+// CreateGroup stores the group and queues it for the targets of the
+// organisation in one transaction.
+func (s *service) CreateGroup(ctx context.Context, organisationId, source string, req GroupRequest) (groupDto, error) {
+	var dto groupDto
+	err := s.db.WithTx(ctx, func(repo repository.Querier) error {
+		members, err := resolveMembers(ctx, repo, organisationId, req.Members)
+		if err != nil {
+			return err
+		}
+		if err := checkDisplayName(ctx, repo, organisationId, "", req.DisplayName); err != nil {
+			return err
+		}
+
+		id, err := uuid.NewV7()
+		if err != nil {
+			return errors.New("failed to generate UUID for new group")
+		}
+		_, err = repo.CreateScimGroup(ctx, repository.CreateScimGroupParams{
+			ID:             id.String(),
+			Displayname:    req.DisplayName,
+			Externalid:     nullString(req.ExternalID),
+			Metacreated:    time.Now().UTC().Format(time.RFC3339),
+			Organisationid: organisationId,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to CreateScimGroup: %w", err)
+		}
+
+		dto, err = s.writeMembers(ctx, repo, target.OperationCreate, organisationId, source, id.String(), members)
+		return err
+	})
+	if err != nil {
+		return groupDto{}, err
+	}
+
+	s.dispatcher.Notify()
+	return dto, nil
+}
+
+// ReplaceGroup replaces the display name, external id and members of a
+// group.
+func (s *service) ReplaceGroup(ctx context.Context, organisationId, source, id string, req GroupRequest) (groupDto, error) {
+	var dto groupDto
+	err := s.db.WithTx(ctx, func(repo repository.Querier) error {
+		var err error
+		dto, err = s.replaceGroup(ctx, repo, organisationId, source, id, req)
+		return err
+	})
+	if err != nil {
+		return groupDto{}, err
+	}
+
+	s.dispatcher.Notify()
+	return dto, nil
+}
+
+// PatchGroup applies PATCH operations to a group. Members are patched by the
+// ids the source knows them by.
+func (s *service) PatchGroup(ctx context.Context, organisationId, source, id string, operations []scim.PatchOperation) (groupDto, error) {
+	var dto groupDto
+	err := s.db.WithTx(ctx, func(repo repository.Querier) error {
+		current, err := getGroup(ctx, repo, organisationId, source, id)
+		if err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(ScimGroupResponse(current))
+		if err != nil {
+			return fmt.Errorf("failed to marshal group: %w", err)
+		}
+		var resource map[string]any
+		if err := json.Unmarshal(data, &resource); err != nil {
+			return fmt.Errorf("failed to decode group: %w", err)
+		}
+		if err := scim.ApplyPatch(resource, operations, schema.Group); err != nil {
+			return err
+		}
+
+		data, err = json.Marshal(resource)
+		if err != nil {
+			return fmt.Errorf("failed to marshal patched group: %w", err)
+		}
+		var req GroupRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			return fmt.Errorf("%w: %v", errInvalidRequest, err)
+		}
+
+		dto, err = s.replaceGroup(ctx, repo, organisationId, source, id, req)
+		return err
+	})
+	if err != nil {
+		return groupDto{}, err
+	}
+
+	s.dispatcher.Notify()
+	return dto, nil
+}
+
+func (s *service) replaceGroup(ctx context.Context, repo repository.Querier, organisationId, source, id string, req GroupRequest) (groupDto, error) {
+	if _, err := repo.GetScimGroupById(ctx, repository.GetScimGroupByIdParams{ID: id, Organisationid: organisationId}); err != nil {
+		return groupDto{}, err
+	}
+	members, err := resolveMembers(ctx, repo, organisationId, req.Members)
+	if err != nil {
+		return groupDto{}, err
+	}
+	if err := checkDisplayName(ctx, repo, organisationId, id, req.DisplayName); err != nil {
+		return groupDto{}, err
+	}
+
+	err = repo.UpdateScimGroup(ctx, repository.UpdateScimGroupParams{
+		Displayname:      req.DisplayName,
+		Externalid:       nullString(req.ExternalID),
+		Metalastmodified: time.Now().UTC().Format(time.RFC3339),
+		ID:               id,
+		Organisationid:   organisationId,
+	})
+	if err != nil {
+		return groupDto{}, fmt.Errorf("failed to UpdateScimGroup: %w", err)
+	}
+	if err := repo.DeleteGroupMembers(ctx, id); err != nil {
+		return groupDto{}, fmt.Errorf("failed to DeleteGroupMembers: %w", err)
+	}
+	return s.writeMembers(ctx, repo, target.OperationReplace, organisationId, source, id, members)
+}
+
+// DeleteGroup deletes a group and its memberships, and queues the deletion
+// for the targets of the organisation.
+func (s *service) DeleteGroup(ctx context.Context, organisationId, id string) error {
+	err := s.db.WithTx(ctx, func(repo repository.Querier) error {
+		group, err := repo.GetScimGroupById(ctx, repository.GetScimGroupByIdParams{ID: id, Organisationid: organisationId})
+		if err != nil {
+			return err
+		}
+		members, err := repo.GetGroupMembers(ctx, id)
+		if err != nil {
+			return fmt.Errorf("failed to GetGroupMembers: %w", err)
+		}
+
+		if err := repo.DeleteGroupMembers(ctx, id); err != nil {
+			return fmt.Errorf("failed to DeleteGroupMembers: %w", err)
+		}
+		if _, err := repo.DeleteScimGroup(ctx, repository.DeleteScimGroupParams{ID: id, Organisationid: organisationId}); err != nil {
+			return fmt.Errorf("failed to DeleteScimGroup: %w", err)
+		}
+		return s.enqueue(ctx, repo, target.OperationDelete, group, members)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.dispatcher.Notify()
+	return nil
+}
+
+// writeMembers stores the members of a group and queues the group for the
+// targets of the organisation.
+func (s *service) writeMembers(ctx context.Context, repo repository.Querier, operation target.Operation, organisationId, source, id string, userIds []string) (groupDto, error) {
+	for _, userId := range userIds {
+		err := repo.CreateUserGroupMembership(ctx, repository.CreateUserGroupMembershipParams{
+			UserID:  userId,
+			GroupID: id,
+		})
+		if err != nil {
+			return groupDto{}, fmt.Errorf("failed to CreateUserGroupMembership: %w", err)
+		}
+	}
+
+	group, err := repo.GetScimGroupById(ctx, repository.GetScimGroupByIdParams{ID: id, Organisationid: organisationId})
+	if err != nil {
+		return groupDto{}, fmt.Errorf("failed to GetScimGroupById: %w", err)
+	}
+	members, err := repo.GetGroupMembers(ctx, id)
+	if err != nil {
+		return groupDto{}, fmt.Errorf("failed to GetGroupMembers: %w", err)
+	}
+	if err := s.enqueue(ctx, repo, operation, group, members); err != nil {
+		return groupDto{}, err
+	}
+
+	ids, err := scimuser.IdentityIds(ctx, repo, organisationId, source)
+	if err != nil {
+		return groupDto{}, err
+	}
+	return newGroupDto(group, members, ids), nil
+}
+
+// resolveMembers returns the ids of the users members refer to, by the id
+// of one of their identities or by their own id.
+func resolveMembers(ctx context.Context, repo repository.Querier, organisationId string, members []Member) ([]string, error) {
+	var userIds []string
+	seen := make(map[string]bool)
+	for _, member := range members {
+		if member.Type != "" && member.Type != target.ResourceUser {
+			return nil, fmt.Errorf("%w: member %s is a %s, only users can be members", errInvalidRequest, member.Value, member.Type)
+		}
+		userId, err := resolveMember(ctx, repo, organisationId, member.Value)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[userId] {
+			seen[userId] = true
+			userIds = append(userIds, userId)
+		}
+	}
+	return userIds, nil
+}
+
+func resolveMember(ctx context.Context, repo repository.Querier, organisationId, id string) (string, error) {
+	identity, err := repo.GetUserIdentity(ctx, repository.GetUserIdentityParams{ID: id, Organisationid: organisationId})
+	if err == nil {
+		return identity.UserID, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("failed to GetUserIdentity: %w", err)
+	}
+
+	user, err := repo.GetScimUserById(ctx, repository.GetScimUserByIdParams{ID: id, Organisationid: organisationId})
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("%w: member %q is not a user", errInvalidRequest, id)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to GetScimUserById: %w", err)
+	}
+	return user.ID, nil
+}
+
+// checkDisplayName returns errDisplayNameTaken if another group of the
+// organisation has the display name.
+func checkDisplayName(ctx context.Context, repo repository.Querier, organisationId, id, displayName string) error {
+	if displayName == "" {
+		return fmt.Errorf("%w: displayName is required", errInvalidRequest)
+	}
+	existing, err := repo.GetScimGroupByDisplayName(ctx, repository.GetScimGroupByDisplayNameParams{
+		Organisationid: organisationId,
+		Displayname:    displayName,
+	})
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to GetScimGroupByDisplayName: %w", err)
+	case existing.ID != id:
+		return fmt.Errorf("%w: %s", errDisplayNameTaken, displayName)
+	}
+	return nil
+}
+
+// enqueue records a change of a group in the change log and queues it for
+// the targets of its organisation.
+func (s *service) enqueue(ctx context.Context, repo repository.Querier, operation target.Operation, group repository.ScimGroup, members []repository.ScimUserGroupMembership) error {
+	resource, err := target.GroupResource(group, members)
+	if err != nil {
+		return fmt.Errorf("failed to marshal group for targets: %w", err)
+	}
+
+	event := target.Event{
+		OrganisationID: group.OrganisationID,
+		ResourceType:   target.ResourceGroup,
+		ResourceID:     group.ID,
+		Operation:      operation,
+		Resource:       resource,
+	}
+	if err := changes.Record(ctx, repo, event); err != nil {
+		return err
+	}
+	return s.dispatcher.Enqueue(ctx, repo, event)
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,408 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jawee/scimtiplexer/internal/scim/filter"
+)
+
+// SchemaPatchOp is the schema of PATCH requests, RFC 7644 section 3.5.2.
+const SchemaPatchOp = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+
+// PatchOperation is an operation of a PATCH request. Op is in lower case.
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+type patchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+// PatchError is returned for PATCH requests that can't be applied. ScimType
+// is the detail error keyword of the response.
+type PatchError struct {
+	ScimType string
+	Detail   string
+}
+
+func (e *PatchError) Error() string {
+	return e.Detail
+}
+
+func patchError(scimType, format string, args ...any) error {
+	return &PatchError{ScimType: scimType, Detail: fmt.Sprintf(format, args...)}
+}
+
+// WritePatchError writes the response to a PATCH request that can't be
+// applied, and reports whether err was a PatchError.
+func WritePatchError(w http.ResponseWriter, err error) bool {
+	var patchErr *PatchError
+	if !errors.As(err, &patchErr) {
+		return false
+	}
+	WriteTypedError(w, http.StatusBadRequest, patchErr.ScimType, patchErr.Detail)
+	return true
+}
+
+// ParsePatch decodes the operations of a PATCH request. Operation names are
+// case insensitive, as some clients capitalise them.
+func ParsePatch(body []byte) ([]PatchOperation, error) {
+	var req patchRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, patchError("invalidSyntax", "Invalid request body")
+	}
+	if !slices.ContainsFunc(req.Schemas, func(s string) bool { return strings.EqualFold(s, SchemaPatchOp) }) {
+		return nil, patchError("invalidSyntax", "schemas must contain %s", SchemaPatchOp)
+	}
+	if len(req.Operations) == 0 {
+		return nil, patchError("invalidSyntax", "Operations is required")
+	}
+	for i := range req.Operations {
+		op := &req.Operations[i]
+		op.Op = strings.ToLower(op.Op)
+		switch op.Op {
+		case "add", "replace":
+			if len(op.Value) == 0 {
+				return nil, patchError("invalidValue", "%s operation %d has no value", op.Op, i)
+			}
+		case "remove":
+			if op.Path == "" {
+				return nil, patchError("noTarget", "remove operation %d has no path", i)
+			}
+		default:
+			return nil, patchError("invalidSyntax", "unknown operation %q", op.Op)
+		}
+	}
+	return req.Operations, nil
+}
+
+// ApplyPatch applies PATCH operations to a resource decoded from JSON.
+// schemas are the core schema of the resource followed by its extensions,
+// paths may be prefixed with them. Attribute names are case insensitive.
+//
+// A value filter that matches nothing is an error for add and replace,
+// except for a filter on one sub-attribute such as emails[type eq "work"],
+// which adds a value with that sub-attribute. Removing something that isn't
+// there isn't an error.
+func ApplyPatch(resource map[string]any, operations []PatchOperation, schemas ...string) error {
+	for _, op := range operations {
+		var value any
+		if len(op.Value) > 0 {
+			if err := json.Unmarshal(op.Value, &value); err != nil {
+				return patchError("invalidValue", "Invalid value of %s operation", op.Op)
+			}
+		}
+
+		if op.Path != "" {
+			if err := applyPath(resource, op.Op, op.Path, value, schemas); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Without a path the value holds the attributes to change, by
+		// name or path.
+		object, ok := value.(map[string]any)
+		if !ok {
+			return patchError("invalidValue", "value of %s operation without a path must be an object", op.Op)
+		}
+		for _, name := range slices.Sorted(maps.Keys(object)) {
+			extension, ok := object[name].(map[string]any)
+			if isExtension(name, schemas) && ok {
+				for _, sub := range slices.Sorted(maps.Keys(extension)) {
+					if err := applyPath(resource, op.Op, name+":"+sub, extension[sub], schemas); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if err := applyPath(resource, op.Op, name, object[name], schemas); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// patchPath is the target of an operation, RFC 7644 section 3.5.2.
+type patchPath struct {
+	extension  string
+	name       string
+	filter     *filter.Filter
+	filterText string
+	sub        string
+}
+
+func isExtension(name string, schemas []string) bool {
+	return len(schemas) > 1 && slices.ContainsFunc(schemas[1:], func(s string) bool { return strings.EqualFold(s, name) })
+}
+
+func parsePatchPath(path string, schemas []string) (patchPath, error) {
+	var p patchPath
+	rest := path
+	if strings.HasPrefix(strings.ToLower(path), "urn:") {
+		known := false
+		for i, s := range schemas {
+			if len(path) < len(s) || !strings.EqualFold(path[:len(s)], s) {
+				continue
+			}
+			if len(path) == len(s) && i > 0 {
+				// The extension itself, an attribute of the resource.
+				return patchPath{name: s}, nil
+			}
+			if len(path) > len(s) && path[len(s)] == ':' {
+				rest = path[len(s)+1:]
+				if i > 0 {
+					p.extension = s
+				}
+				known = true
+				break
+			}
+		}
+		if !known {
+			return patchPath{}, patchError("invalidPath", "Unknown schema in path %q", path)
+		}
+	}
+
+	if i := strings.Index(rest, "["); i >= 0 {
+		j := strings.LastIndex(rest, "]")
+		if j < i {
+			return patchPath{}, patchError("invalidPath", "Invalid path %q", path)
+		}
+		p.name, p.filterText = rest[:i], rest[i+1:j]
+		if after := rest[j+1:]; after != "" {
+			sub, ok := strings.CutPrefix(after, ".")
+			if !ok {
+				return patchPath{}, patchError("invalidPath", "Invalid path %q", path)
+			}
+			p.sub = sub
+		}
+		f, err := filter.Parse(p.filterText)
+		if err != nil {
+			return patchPath{}, patchError("invalidFilter", "Invalid filter in path %q: %v", path, err)
+		}
+		p.filter = f
+	} else {
+		p.name, p.sub, _ = strings.Cut(rest, ".")
+	}
+	if p.name == "" || strings.ContainsAny(p.name+p.sub, "[]. ") {
+		return patchPath{}, patchError("invalidPath", "Invalid path %q", path)
+	}
+	return p, nil
+}
+
+func applyPath(resource map[string]any, op, path string, value any, schemas []string) error {
+	p, err := parsePatchPath(path, schemas)
+	if err != nil {
+		return err
+	}
+
+	container := resource
+	if p.extension != "" {
+		k := key(resource, p.extension)
+		extension, _ := resource[k].(map[string]any)
+		if extension == nil {
+			if op == "remove" {
+				return nil
+			}
+			extension = make(map[string]any)
+			resource[k] = extension
+		}
+		container = extension
+	}
+	k := key(container, p.name)
+	current := container[k]
+
+	switch {
+	case p.filter != nil:
+		return applyFiltered(container, k, op, p, value)
+
+	case p.sub != "":
+		object, _ := current.(map[string]any)
+		if op == "remove" {
+			if object != nil {
+				delete(object, key(object, p.sub))
+			}
+			return nil
+		}
+		if object == nil {
+			object = make(map[string]any)
+			container[k] = object
+		}
+		object[key(object, p.sub)] = value
+
+	case op == "remove":
+		elements, multiValued := current.([]any)
+		if value == nil || !multiValued {
+			delete(container, k)
+			return nil
+		}
+		// Values to remove from a multi-valued attribute, as some clients
+		// send them instead of a filter.
+		remove, ok := value.([]any)
+		if !ok {
+			remove = []any{value}
+		}
+		elements = slices.DeleteFunc(elements, func(e any) bool { return containsValue(remove, e) })
+		if len(elements) == 0 {
+			delete(container, k)
+		} else {
+			container[k] = elements
+		}
+
+	case op == "add":
+		switch v := value.(type) {
+		case []any:
+			elements, _ := current.([]any)
+			for _, e := range v {
+				if !containsValue(elements, e) {
+					elements = append(elements, e)
+				}
+			}
+			container[k] = elements
+		case map[string]any:
+			if object, ok := current.(map[string]any); ok {
+				merge(object, v)
+			} else {
+				container[k] = v
+			}
+		default:
+			container[k] = v
+		}
+
+	default:
+		// Replacing a complex attribute leaves the sub-attributes the value
+		// doesn't have unchanged.
+		object, currentOk := current.(map[string]any)
+		v, valueOk := value.(map[string]any)
+		if currentOk && valueOk {
+			merge(object, v)
+		} else {
+			container[k] = value
+		}
+	}
+	return nil
+}
+
+// applyFiltered applies an operation to the values of the multi-valued
+// attribute k that match the filter of the path.
+func applyFiltered(container map[string]any, k, op string, p patchPath, value any) error {
+	elements, _ := container[k].([]any)
+	matched := false
+	var kept []any
+	for i, e := range elements {
+		object, ok := e.(map[string]any)
+		if !ok || !p.filter.Matches(object) {
+			kept = append(kept, e)
+			continue
+		}
+		matched = true
+		switch {
+		case op == "remove" && p.sub == "":
+			continue
+		case op == "remove":
+			delete(object, key(object, p.sub))
+		case p.sub != "":
+			object[key(object, p.sub)] = value
+		default:
+			v, ok := value.(map[string]any)
+			if !ok {
+				return patchError("invalidValue", "value for %s[%s] must be an object", p.name, p.filterText)
+			}
+			if op == "replace" {
+				elements[i] = v
+				object = v
+			} else {
+				merge(object, v)
+			}
+		}
+		kept = append(kept, object)
+	}
+
+	if !matched && op != "remove" {
+		object, ok := equalityFilter(p.filterText)
+		if !ok {
+			return patchError("noTarget", "No value of %s matches %s", p.name, p.filterText)
+		}
+		if p.sub != "" {
+			object[p.sub] = value
+		} else if v, ok := value.(map[string]any); ok {
+			merge(object, v)
+		} else {
+			return patchError("invalidValue", "value for %s[%s] must be an object", p.name, p.filterText)
+		}
+		kept = append(kept, object)
+	}
+
+	if len(kept) == 0 {
+		delete(container, k)
+	} else {
+		container[k] = kept
+	}
+	return nil
+}
+
+var equalityPattern = regexp.MustCompile(`^\s*([A-Za-z][\w-]*)\s+(?i:eq)\s+("(?:[^"\\]|\\.)*")\s*$`)
+
+// equalityFilter returns the value a filter on one sub-attribute, such as
+// type eq "work", describes.
+func equalityFilter(text string) (map[string]any, bool) {
+	match := equalityPattern.FindStringSubmatch(text)
+	if match == nil {
+		return nil, false
+	}
+	value, err := strconv.Unquote(match[2])
+	if err != nil {
+		return nil, false
+	}
+	return map[string]any{match[1]: value}, true
+}
+
+// key returns the key of an object an attribute name refers to in any case,
+// or the name when the object doesn't have it.
+func key(object map[string]any, name string) string {
+	if _, ok := object[name]; ok {
+		return name
+	}
+	for k := range object {
+		if strings.EqualFold(k, name) {
+			return k
+		}
+	}
+	return name
+}
+
+func merge(dst, src map[string]any) {
+	for name, value := range src {
+		dst[key(dst, name)] = value
+	}
+}
+
+// containsValue reports whether a multi-valued attribute has a value,
+// comparing complex values by their value sub-attribute.
+func containsValue(elements []any, value any) bool {
+	return slices.ContainsFunc(elements, func(e any) bool {
+		return reflect.DeepEqual(valueOf(e), valueOf(value))
+	})
+}
+
+func valueOf(element any) any {
+	if object, ok := element.(map[string]any); ok {
+		if v, ok := object[key(object, "value")]; ok {
+			return v
+		}
+	}
+	return element
+}
@@ -0,0 +1,203 @@
+package scim
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jawee/scimtiplexer/internal/scim/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decode(t *testing.T, s string) map[string]any {
+	t.Helper()
+	var object map[string]any
+	require.NoError(t, json.Unmarshal([]byte(s), &object))
+	return object
+}
+
+func patch(t *testing.T, resource, operations string) (map[string]any, error) {
+	t.Helper()
+	ops, err := ParsePatch([]byte(`{"schemas": ["` + SchemaPatchOp + `"], "Operations": ` + operations + `}`))
+	require.NoError(t, err)
+	object := decode(t, resource)
+	return object, ApplyPatch(object, ops, schema.User, schema.EnterpriseUser)
+}
+
+func TestParsePatch(t *testing.T) {
+	ops, err := ParsePatch([]byte(`{"schemas": ["` + SchemaPatchOp + `"], "Operations": [{"op": "Replace", "path": "active", "value": false}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, []PatchOperation{{Op: "replace", Path: "active", Value: json.RawMessage("false")}}, ops)
+
+	tests := []struct {
+		name     string
+		body     string
+		scimType string
+	}{
+		{"not json", `{`, "invalidSyntax"},
+		{"missing schema", `{"Operations": [{"op": "add", "path": "title", "value": "x"}]}`, "invalidSyntax"},
+		{"no operations", `{"schemas": ["` + SchemaPatchOp + `"]}`, "invalidSyntax"},
+		{"unknown op", `{"schemas": ["` + SchemaPatchOp + `"], "Operations": [{"op": "move", "path": "title"}]}`, "invalidSyntax"},
+		{"add without value", `{"schemas": ["` + SchemaPatchOp + `"], "Operations": [{"op": "add", "path": "title"}]}`, "invalidValue"},
+		{"remove without path", `{"schemas": ["` + SchemaPatchOp + `"], "Operations": [{"op": "remove"}]}`, "noTarget"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePatch([]byte(tt.body))
+
+			var patchErr *PatchError
+			require.ErrorAs(t, err, &patchErr)
+			assert.Equal(t, tt.scimType, patchErr.ScimType)
+		})
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		resource   string
+		operations string
+		expected   string
+	}{
+		{
+			"replace attribute",
+			`{"userName": "alice", "title": "Engineer"}`,
+			`[{"op": "replace", "path": "title", "value": "Manager"}]`,
+			`{"userName": "alice", "title": "Manager"}`,
+		},
+		{
+			"attribute names are case insensitive",
+			`{"userName": "alice", "title": "Engineer"}`,
+			`[{"op": "replace", "path": "TITLE", "value": "Manager"}]`,
+			`{"userName": "alice", "title": "Manager"}`,
+		},
+		{
+			"replace without path",
+			`{"userName": "alice", "active": true, "name": {"givenName": "Alice", "familyName": "Smith"}}`,
+			`[{"op": "replace", "value": {"active": false, "name.familyName": "Jones"}}]`,
+			`{"userName": "alice", "active": false, "name": {"givenName": "Alice", "familyName": "Jones"}}`,
+		},
+		{
+			"replace complex attribute keeps other sub-attributes",
+			`{"name": {"givenName": "Alice", "familyName": "Smith"}}`,
+			`[{"op": "replace", "path": "name", "value": {"familyName": "Jones"}}]`,
+			`{"name": {"givenName": "Alice", "familyName": "Jones"}}`,
+		},
+		{
+			"add sub-attribute",
+			`{"userName": "alice"}`,
+			`[{"op": "add", "path": "name.givenName", "value": "Alice"}]`,
+			`{"userName": "alice", "name": {"givenName": "Alice"}}`,
+		},
+		{
+			"remove attribute",
+			`{"userName": "alice", "title": "Engineer"}`,
+			`[{"op": "remove", "path": "title"}]`,
+			`{"userName": "alice"}`,
+		},
+		{
+			"remove missing attribute",
+			`{"userName": "alice"}`,
+			`[{"op": "remove", "path": "name.givenName"}, {"op": "remove", "path": "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager"}]`,
+			`{"userName": "alice"}`,
+		},
+		{
+			"extension attribute",
+			`{"userName": "alice"}`,
+			`[{"op": "add", "path": "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department", "value": "R&D"},
+			  {"op": "replace", "path": "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager", "value": {"value": "bob"}}]`,
+			`{"userName": "alice", "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"department": "R&D", "manager": {"value": "bob"}}}`,
+		},
+		{
+			"extension without path",
+			`{"userName": "alice", "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"department": "R&D", "costCenter": "CC1"}}`,
+			`[{"op": "replace", "value": {"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"department": "Sales"}}}]`,
+			`{"userName": "alice", "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"department": "Sales", "costCenter": "CC1"}}`,
+		},
+		{
+			"core schema prefix",
+			`{"userName": "alice"}`,
+			`[{"op": "replace", "path": "urn:ietf:params:scim:schemas:core:2.0:User:userName", "value": "alice.smith"}]`,
+			`{"userName": "alice.smith"}`,
+		},
+		{
+			"add values",
+			`{"emails": [{"value": "alice@example.com", "type": "work"}]}`,
+			`[{"op": "add", "path": "emails", "value": [{"value": "alice@example.com", "type": "work"}, {"value": "alice@home.example", "type": "home"}]}]`,
+			`{"emails": [{"value": "alice@example.com", "type": "work"}, {"value": "alice@home.example", "type": "home"}]}`,
+		},
+		{
+			"replace values",
+			`{"emails": [{"value": "alice@example.com", "type": "work"}]}`,
+			`[{"op": "replace", "path": "emails", "value": [{"value": "alice@home.example", "type": "home"}]}]`,
+			`{"emails": [{"value": "alice@home.example", "type": "home"}]}`,
+		},
+		{
+			"replace sub-attribute of filtered value",
+			`{"emails": [{"value": "alice@example.com", "type": "work"}, {"value": "alice@home.example", "type": "home"}]}`,
+			`[{"op": "replace", "path": "emails[type eq \"work\"].value", "value": "alice.smith@example.com"}]`,
+			`{"emails": [{"value": "alice.smith@example.com", "type": "work"}, {"value": "alice@home.example", "type": "home"}]}`,
+		},
+		{
+			"filter without match adds the value",
+			`{"userName": "alice"}`,
+			`[{"op": "replace", "path": "emails[type eq \"work\"].value", "value": "alice@example.com"}]`,
+			`{"userName": "alice", "emails": [{"type": "work", "value": "alice@example.com"}]}`,
+		},
+		{
+			"remove filtered value",
+			`{"members": [{"value": "alice"}, {"value": "bob"}]}`,
+			`[{"op": "remove", "path": "members[value eq \"alice\"]"}]`,
+			`{"members": [{"value": "bob"}]}`,
+		},
+		{
+			"remove last filtered value",
+			`{"members": [{"value": "alice"}]}`,
+			`[{"op": "remove", "path": "members[value eq \"alice\"]"}]`,
+			`{}`,
+		},
+		{
+			"remove values",
+			`{"members": [{"value": "alice"}, {"value": "bob"}, {"value": "carol"}]}`,
+			`[{"op": "Remove", "path": "members", "value": [{"value": "alice"}, {"value": "carol"}]}]`,
+			`{"members": [{"value": "bob"}]}`,
+		},
+		{
+			"remove all values",
+			`{"members": [{"value": "alice"}, {"value": "bob"}]}`,
+			`[{"op": "remove", "path": "members"}]`,
+			`{}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource, err := patch(t, tt.resource, tt.operations)
+
+			require.NoError(t, err)
+			assert.Equal(t, decode(t, tt.expected), resource)
+		})
+	}
+}
+
+func TestApplyPatchErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		operations string
+		scimType   string
+	}{
+		{"unknown schema", `[{"op": "add", "path": "urn:example:Other:title", "value": "x"}]`, "invalidPath"},
+		{"invalid path", `[{"op": "add", "path": "name.given.name", "value": "x"}]`, "invalidPath"},
+		{"invalid filter", `[{"op": "replace", "path": "emails[type eq].value", "value": "x"}]`, "invalidFilter"},
+		{"filter without match", `[{"op": "replace", "path": "emails[type eq \"work\" and primary eq true]", "value": {"value": "x"}}]`, "noTarget"},
+		{"value without path", `[{"op": "replace", "value": "x"}]`, "invalidValue"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := patch(t, `{"userName": "alice"}`, tt.operations)
+
+			var patchErr *PatchError
+			require.ErrorAs(t, err, &patchErr)
+			assert.Equal(t, tt.scimType, patchErr.ScimType)
+		})
+	}
+}
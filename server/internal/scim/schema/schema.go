@@ -0,0 +1,174 @@
+package schema
+
+import "strings"
+
+// Schema URNs of the resources scimtiplexer serves.
+const (
+	User           = "urn:ietf:params:scim:schemas:core:2.0:User"
+	EnterpriseUser = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+	Group          = "urn:ietf:params:scim:schemas:core:2.0:Group"
+)
+
+// Attribute types of RFC 7643 section 2.3.
+const (
+	TypeString    = "string"
+	TypeBoolean   = "boolean"
+	TypeDateTime  = "dateTime"
+	TypeReference = "reference"
+	TypeComplex   = "complex"
+)
+
+// Attribute describes an attribute of a schema.
+type Attribute struct {
+	Name          string
+	Type          string
+	MultiValued   bool
+	SubAttributes []Attribute
+}
+
+// Schema describes the attributes of a core schema or schema extension.
+type Schema struct {
+	ID         string
+	Name       string
+	Attributes []Attribute
+}
+
+// Resource is a resource type with its core schema and extensions.
+type Resource struct {
+	Name       string
+	Schema     Schema
+	Extensions []Schema
+}
+
+func str(name string) Attribute { return Attribute{Name: name, Type: TypeString} }
+
+// multi is a multi-valued complex attribute with the usual sub-attributes.
+func multi(name string) Attribute {
+	return Attribute{Name: name, Type: TypeComplex, MultiValued: true, SubAttributes: []Attribute{
+		str("value"), str("display"), str("type"), {Name: "primary", Type: TypeBoolean},
+	}}
+}
+
+// common are the attributes of every resource, RFC 7643 section 3.1.
+var common = []Attribute{
+	str("id"),
+	str("externalId"),
+	{Name: "meta", Type: TypeComplex, SubAttributes: []Attribute{
+		str("resourceType"), {Name: "created", Type: TypeDateTime}, {Name: "lastModified", Type: TypeDateTime},
+		{Name: "location", Type: TypeReference}, str("version"),
+	}},
+}
+
+var userSchema = Schema{
+	ID:   User,
+	Name: "User",
+	Attributes: append(common[:len(common):len(common)],
+		str("userName"),
+		Attribute{Name: "name", Type: TypeComplex, SubAttributes: []Attribute{
+			str("formatted"), str("familyName"), str("givenName"), str("middleName"),
+			str("honorificPrefix"), str("honorificSuffix"),
+		}},
+		str("displayName"),
+		str("nickName"),
+		Attribute{Name: "profileUrl", Type: TypeReference},
+		str("title"),
+		str("userType"),
+		str("preferredLanguage"),
+		str("locale"),
+		str("timezone"),
+		Attribute{Name: "active", Type: TypeBoolean},
+		str("password"),
+		multi("emails"),
+		multi("phoneNumbers"),
+		multi("ims"),
+		multi("photos"),
+		Attribute{Name: "addresses", Type: TypeComplex, MultiValued: true, SubAttributes: []Attribute{
+			str("formatted"), str("streetAddress"), str("locality"), str("region"), str("postalCode"),
+			str("country"), str("type"), {Name: "primary", Type: TypeBoolean},
+		}},
+		Attribute{Name: "groups", Type: TypeComplex, MultiValued: true, SubAttributes: []Attribute{
+			str("value"), {Name: "$ref", Type: TypeReference}, str("display"), str("type"),
+		}},
+		multi("entitlements"),
+		multi("roles"),
+		multi("x509Certificates"),
+	),
+}
+
+var enterpriseUserSchema = Schema{
+	ID:   EnterpriseUser,
+	Name: "EnterpriseUser",
+	Attributes: []Attribute{
+		str("employeeNumber"),
+		str("costCenter"),
+		str("organization"),
+		str("division"),
+		str("department"),
+		{Name: "manager", Type: TypeComplex, SubAttributes: []Attribute{
+			str("value"), {Name: "$ref", Type: TypeReference}, str("displayName"),
+		}},
+	},
+}
+
+var groupSchema = Schema{
+	ID:   Group,
+	Name: "Group",
+	Attributes: append(common[:len(common):len(common)],
+		str("displayName"),
+		Attribute{Name: "members", Type: TypeComplex, MultiValued: true, SubAttributes: []Attribute{
+			str("value"), {Name: "$ref", Type: TypeReference}, str("display"), str("type"),
+		}},
+	),
+}
+
+var resources = map[string]Resource{
+	"User":  {Name: "User", Schema: userSchema, Extensions: []Schema{enterpriseUserSchema}},
+	"Group": {Name: "Group", Schema: groupSchema},
+}
+
+// ResourceType returns the schemas of a resource type, User or Group.
+func ResourceType(name string) (Resource, bool) {
+	r, ok := resources[name]
+	return r, ok
+}
+
+// Known reports whether id is a schema of any resource type.
+func Known(id string) bool {
+	for _, r := range resources {
+		if strings.EqualFold(r.Schema.ID, id) {
+			return true
+		}
+		for _, ext := range r.Extensions {
+			if strings.EqualFold(ext.ID, id) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Find resolves an attribute name, and optionally a sub-attribute, in the
+// schema with the given id. Names are case insensitive.
+func (r Resource) Find(schemaId string, name, subName string) (Attribute, bool) {
+	schemas := append([]Schema{r.Schema}, r.Extensions...)
+	for _, s := range schemas {
+		if !strings.EqualFold(s.ID, schemaId) {
+			continue
+		}
+		attr, ok := findAttribute(s.Attributes, name)
+		if !ok || subName == "" {
+			return attr, ok
+		}
+		return findAttribute(attr.SubAttributes, subName)
+	}
+	return Attribute{}, false
+}
+
+func findAttribute(attributes []Attribute, name string) (Attribute, bool) {
+	for _, a := range attributes {
+		if strings.EqualFold(a.Name, name) {
+			return a, true
+		}
+	}
+	return Attribute{}, false
+}
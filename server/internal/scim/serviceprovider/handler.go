@@ -0,0 +1,111 @@
+package serviceprovider
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+const SchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+
+type handler struct {
+	config ServiceProviderConfig
+}
+
+// RegisterEndpoints registers the ServiceProviderConfig endpoint. It is
+// served without authentication so clients can discover how to authenticate.
+func RegisterEndpoints(mux *http.ServeMux, clientCertificates bool) {
+	h := &handler{
+		config: newServiceProviderConfig(clientCertificates),
+	}
+
+	slog.Debug("Registering ServiceProviderConfig endpoint")
+	for _, prefix := range []string{"/scim/v2/", "/scim/{orgSlug}/v2/"} {
+		mux.HandleFunc("GET "+prefix+"ServiceProviderConfig", h.handleGetServiceProviderConfig)
+		mux.HandleFunc("GET "+prefix+strings.ToLower("ServiceProviderConfig"), h.handleGetServiceProviderConfig)
+	}
+}
+
+type Supported struct {
+	Supported bool `json:"supported"`
+}
+
+type BulkSupported struct {
+	Supported      bool `json:"supported"`
+	MaxOperations  int  `json:"maxOperations"`
+	MaxPayloadSize int  `json:"maxPayloadSize"`
+}
+
+type FilterSupported struct {
+	Supported  bool `json:"supported"`
+	MaxResults int  `json:"maxResults"`
+}
+
+type AuthenticationScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	SpecURI     string `json:"specUri,omitempty"`
+	Primary     bool   `json:"primary,omitempty"`
+}
+
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location"`
+}
+
+// ServiceProviderConfig is the resource of RFC 7643 section 5.
+type ServiceProviderConfig struct {
+	Schemas               []string               `json:"schemas"`
+	Patch                 Supported              `json:"patch"`
+	Bulk                  BulkSupported          `json:"bulk"`
+	Filter                FilterSupported        `json:"filter"`
+	ChangePassword        Supported              `json:"changePassword"`
+	Sort                  Supported              `json:"sort"`
+	Etag                  Supported              `json:"etag"`
+	AuthenticationSchemes []AuthenticationScheme `json:"authenticationSchemes"`
+	Meta                  Meta                   `json:"meta"`
+}
+
+func newServiceProviderConfig(clientCertificates bool) ServiceProviderConfig {
+	schemes := []AuthenticationScheme{
+		{
+			Type:        "oauthbearertoken",
+			Name:        "OAuth Bearer Token",
+			Description: "Organisation token, access token from the client credentials grant at /oauth/token, or a JWT from a trusted issuer",
+			SpecURI:     "https://www.rfc-editor.org/rfc/rfc6750",
+			Primary:     true,
+		},
+	}
+	if clientCertificates {
+		schemes = append(schemes, AuthenticationScheme{
+			Type:        "mtls",
+			Name:        "Mutual TLS",
+			Description: "TLS client certificate issued by a CA trusted by the organisation",
+			SpecURI:     "https://www.rfc-editor.org/rfc/rfc8446#section-4.4.2",
+		})
+	}
+
+	return ServiceProviderConfig{
+		Schemas:               []string{SchemaServiceProviderConfig},
+		Patch:                 Supported{Supported: true},
+		Bulk:                  BulkSupported{Supported: false},
+		Filter:                FilterSupported{Supported: false},
+		ChangePassword:        Supported{Supported: false},
+		Sort:                  Supported{Supported: false},
+		Etag:                  Supported{Supported: false},
+		AuthenticationSchemes: schemes,
+		Meta: Meta{
+			ResourceType: "ServiceProviderConfig",
+			Location:     "/scim/v2/ServiceProviderConfig",
+		},
+	}
+}
+
+func (h *handler) handleGetServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(http.StatusOK)
+	jsonOutput, _ := json.Marshal(h.config)
+	w.Write(jsonOutput)
+}
@@ -1,47 +1,78 @@
 package user
 
 import (
-	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/jawee/scimtiplexer/internal/admin"
+	"github.com/jawee/scimtiplexer/internal/correlation"
+	"github.com/jawee/scimtiplexer/internal/database"
 	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/scim"
+	"github.com/jawee/scimtiplexer/internal/scim/auth"
+	"github.com/jawee/scimtiplexer/internal/sources"
+	"github.com/jawee/scimtiplexer/internal/target"
+	"github.com/jawee/scimtiplexer/internal/token"
 )
 
 type handler struct {
-	repo    repository.Querier
 	service *service
+	auth    *auth.Authenticator
 }
 
-func RegisterEndpoints(mux *http.ServeMux, repo repository.Querier) {
+func RegisterEndpoints(mux *http.ServeMux, repo repository.Querier, db database.Transactor, authenticator *auth.Authenticator, api *admin.API, dispatcher *target.Dispatcher) {
 	h := &handler{
-		repo:    repo,
-		service: &service{repo: repo},
+		service: &service{repo: repo, db: db, dispatcher: dispatcher},
+		auth:    authenticator,
 	}
 
 	slog.Debug("Registering SCIM endpoints")
 	h.registerScimEndpoints(mux)
 
+	// Linking and unlinking identities change users, the rest of the
+	// correlation endpoints are registered by the correlation package.
+	api.Member("POST", "/orgs/{orgId}/correlation-reviews/{id}/link", h.handleLinkReview, admin.Operation{
+		Summary:  "Link the identity of a correlation review to the candidate user",
+		Response: User{},
+	})
+	api.Member("POST", "/orgs/{orgId}/users/{id}/identities/{identityId}/unlink", h.handleUnlinkIdentity, admin.Operation{
+		Summary:  "Split an identity off a user into a user of its own",
+		Response: User{},
+		Status:   http.StatusCreated,
+	})
+
 	slog.Debug("SCIM endpoints registered")
 }
 
 var SCIM_PREFIX = "/scim/v2/"
 
-func (s *handler) registerScimEndpoints(mux *http.ServeMux) {
-	s.registerScimEndpoint(mux, "GET", "Users", http.HandlerFunc(s.handleGetUsers))
-	s.registerScimEndpoint(mux, "GET", "Users/", http.HandlerFunc(s.handleGetUsers))
-	s.registerScimEndpoint(mux, "POST", "Users", http.HandlerFunc(s.handlePostUsers))
+// SCIM_TENANT_PREFIX serves the same endpoints under an organisation specific
+// base URL, for clients that want a distinct tenant URL per organisation.
+var SCIM_TENANT_PREFIX = "/scim/{orgSlug}/v2/"
 
-	s.registerScimEndpoint(mux, "GET", "Users/{id}", http.HandlerFunc(s.handleGetUserById))
+func (s *handler) registerScimEndpoints(mux *http.ServeMux) {
+	s.registerScimEndpoint(mux, "GET", "Users", token.ScopeUsersRead, http.HandlerFunc(s.handleGetUsers))
+	s.registerScimEndpoint(mux, "GET", "Users/", token.ScopeUsersRead, http.HandlerFunc(s.handleGetUsers))
+	s.registerScimEndpoint(mux, "POST", "Users", token.ScopeUsersWrite, http.HandlerFunc(s.handlePostUsers))
+
+	s.registerScimEndpoint(mux, "GET", "Users/{id}", token.ScopeUsersRead, http.HandlerFunc(s.handleGetUserById))
+	s.registerScimEndpoint(mux, "PUT", "Users/{id}", token.ScopeUsersWrite, http.HandlerFunc(s.handlePutUser))
+	s.registerScimEndpoint(mux, "PATCH", "Users/{id}", token.ScopeUsersWrite, http.HandlerFunc(s.handlePatchUser))
+	s.registerScimEndpoint(mux, "DELETE", "Users/{id}", token.ScopeUsersWrite, http.HandlerFunc(s.handleDeleteUser))
 }
 
-func (s *handler) registerScimEndpoint(mux *http.ServeMux, method, resource string, handler http.Handler) {
-	mux.Handle(method+" "+SCIM_PREFIX+resource, s.ScimEndpointAuth(handler))
-	mux.Handle(method+" "+SCIM_PREFIX+strings.ToLower(resource), s.ScimEndpointAuth(handler))
+func (s *handler) registerScimEndpoint(mux *http.ServeMux, method, resource, scope string, handler http.Handler) {
+	for _, prefix := range []string{SCIM_PREFIX, SCIM_TENANT_PREFIX} {
+		mux.Handle(method+" "+prefix+resource, s.auth.ScimEndpointAuth(scope, handler))
+		mux.Handle(method+" "+prefix+strings.ToLower(resource), s.auth.ScimEndpointAuth(scope, handler))
+	}
 }
 
 func (s *handler) handleGetUsers(w http.ResponseWriter, r *http.Request) {
@@ -58,7 +89,7 @@ func (s *handler) handleGetUsers(w http.ResponseWriter, r *http.Request) {
 	queryParams := r.URL.Query()
 	slog.Debug("Query parameters", "params", queryParams)
 
-	users, err := s.service.GetAllUsers(r.Context(), organisationId)
+	users, err := s.service.GetAllUsers(r.Context(), organisationId, source(r))
 	if err != nil {
 		slog.Error("Failed to get users", "error", err)
 		if err == sql.ErrNoRows {
@@ -85,8 +116,14 @@ func (s *handler) handleGetUsers(w http.ResponseWriter, r *http.Request) {
 func (s *handler) handlePostUsers(w http.ResponseWriter, r *http.Request) {
 	slog.Debug("handlePostUsers called for organisation", "orgid", r.Context().Value("orgid"))
 
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.Error("Failed to read user creation request", "error", err)
+		scim.WriteBodyError(w, err)
+		return
+	}
 	var userReq UserCreateRequest
-	if err := json.NewDecoder(r.Body).Decode(&userReq); err != nil {
+	if err := json.Unmarshal(body, &userReq); err != nil {
 		slog.Error("Failed to decode user creation request", "error", err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
@@ -94,8 +131,11 @@ func (s *handler) handlePostUsers(w http.ResponseWriter, r *http.Request) {
 
 	slog.Debug("User creation request", "request", userReq)
 
-	createdUser, err := s.service.CreateUser(r.Context(), r.Context().Value("orgid").(string), userReq)
+	createdUser, err := s.service.CreateUser(r.Context(), r.Context().Value("orgid").(string), source(r), userReq, body)
 	if err != nil {
+		if writeMergeError(w, err) {
+			return
+		}
 		slog.Error("Failed to create user", "error", err)
 		if err == sql.ErrNoRows {
 			slog.Info("User creation failed, no rows affected")
@@ -138,35 +178,185 @@ func (s *handler) handleGetUserById(w http.ResponseWriter, r *http.Request) {
 	w.Write(jsonOutput)
 }
 
-func (s *handler) ScimEndpointAuth(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		slog.Debug("ScimEndpointAuth called", "method", r.Method, "url", r.URL.Path)
+// handlePutUser replaces the user an identity is linked to. Attributes the
+// source of the request may not write under the attribute policies keep
+// their value.
+func (s *handler) handlePutUser(w http.ResponseWriter, r *http.Request) {
+	slog.Debug("handlePutUser called for organisation", "orgid", r.Context().Value("orgid"))
+	requestedId := r.PathValue("id")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.Error("Failed to read user replace request", "error", err)
+		scim.WriteBodyError(w, err)
+		return
+	}
+	var userReq UserCreateRequest
+	if err := json.Unmarshal(body, &userReq); err != nil {
+		slog.Error("Failed to decode user replace request", "error", err)
+		scim.WriteTypedError(w, http.StatusBadRequest, "invalidSyntax", "Invalid request body")
+		return
+	}
 
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-			w.WriteHeader(http.StatusUnauthorized)
+	user, err := s.service.ReplaceUser(r.Context(), r.Context().Value("orgid").(string), source(r), requestedId, userReq, body)
+	if err != nil {
+		if writeMergeError(w, err) {
+			return
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			slog.Info("User not found", "id", requestedId)
+			scim.WriteError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		slog.Error("Failed to replace user", "error", err, "id", requestedId)
+		scim.WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(http.StatusOK)
+	userResp := ScimUserResponse(user)
+	jsonOutput, _ := json.Marshal(userResp)
+	w.Write(jsonOutput)
+}
+
+// handlePatchUser applies PATCH operations to the user an identity is linked
+// to. Attribute policies apply as they do to PUT.
+func (s *handler) handlePatchUser(w http.ResponseWriter, r *http.Request) {
+	requestedId := r.PathValue("id")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.Error("Failed to read user patch request", "error", err)
+		scim.WriteBodyError(w, err)
+		return
+	}
+	operations, err := scim.ParsePatch(body)
+	if err != nil {
+		scim.WritePatchError(w, err)
+		return
+	}
+
+	user, err := s.service.PatchUser(r.Context(), r.Context().Value("orgid").(string), source(r), requestedId, operations)
+	if err != nil {
+		if scim.WritePatchError(w, err) || writeMergeError(w, err) {
+			return
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			slog.Info("User not found", "id", requestedId)
+			scim.WriteError(w, http.StatusNotFound, "User not found")
 			return
 		}
+		slog.Error("Failed to patch user", "error", err, "id", requestedId)
+		scim.WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(http.StatusOK)
+	userResp := ScimUserResponse(user)
+	jsonOutput, _ := json.Marshal(userResp)
+	w.Write(jsonOutput)
+}
+
+// handleDeleteUser deletes an identity, and the user it is linked to when no
+// other source has an identity of it.
+func (s *handler) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	requestedId := r.PathValue("id")
 
-		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-
-		token, err := s.repo.GetOrganisationTokenByToken(r.Context(), tokenStr)
-		if err != nil {
-			slog.Error("GetOrganisationTokenByToken failed", "error", err)
-			if err == sql.ErrNoRows {
-				slog.Info("Token not found in database", "token", tokenStr)
-				w.WriteHeader(http.StatusUnauthorized)
-				return
-			}
-			w.WriteHeader(http.StatusInternalServerError)
+	err := s.service.DeleteUser(r.Context(), r.Context().Value("orgid").(string), requestedId)
+	if err != nil {
+		if writeMergeError(w, err) {
+			return
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			slog.Info("User not found", "id", requestedId)
+			scim.WriteError(w, http.StatusNotFound, "User not found")
 			return
 		}
+		slog.Error("Failed to delete user", "error", err, "id", requestedId)
+		scim.WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
 
-		claimsCtx := context.WithValue(r.Context(), "orgid", token.OrganisationID)
-		r = r.WithContext(claimsCtx)
+	w.WriteHeader(http.StatusNoContent)
+}
 
-		next.ServeHTTP(w, r)
-	})
+// handleLinkReview links the identity of a review to the candidate user and
+// returns the merged user.
+func (s *handler) handleLinkReview(w http.ResponseWriter, r *http.Request) {
+	user, err := s.service.LinkReview(r.Context(), r.PathValue("orgId"), admin.UserID(r.Context()), r.PathValue("id"))
+	if err != nil {
+		writeAdminError(w, err, "Failed to link identity")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusOK, ScimUserResponse(user))
+}
+
+// handleUnlinkIdentity splits an identity off a user and returns the user
+// created for it.
+func (s *handler) handleUnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	user, err := s.service.UnlinkIdentity(r.Context(), r.PathValue("orgId"), r.PathValue("id"), r.PathValue("identityId"))
+	if err != nil {
+		writeAdminError(w, err, "Failed to unlink identity")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusCreated, ScimUserResponse(user))
+}
+
+func writeAdminError(w http.ResponseWriter, err error, message string) {
+	var conflict *sources.ConflictError
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		admin.WriteError(w, http.StatusNotFound, "Not found")
+		return
+	case errors.Is(err, correlation.ErrReviewResolved), errors.Is(err, errUserNameTaken):
+		admin.WriteError(w, http.StatusConflict, err.Error())
+		return
+	case errors.As(err, &conflict):
+		admin.WriteError(w, http.StatusConflict, conflict.Error())
+		return
+	case errors.Is(err, errInvalidRequest):
+		admin.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	slog.Error(message, "error", err)
+	admin.WriteError(w, http.StatusInternalServerError, message)
+}
+
+// source returns the inbound source the request writes as, empty if the
+// credentials have none.
+func source(r *http.Request) string {
+	source, _ := r.Context().Value("source").(string)
+	return source
+}
+
+// writeMergeError writes the response to writes that are invalid, conflict
+// with another user, are rejected by an attribute policy or by the mass
+// change threshold, and reports whether err was one of them.
+func writeMergeError(w http.ResponseWriter, err error) bool {
+	var conflict *sources.ConflictError
+	var massChange *target.MassChangeError
+	switch {
+	case errors.As(err, &massChange):
+		slog.Warn("Write rejected by mass change threshold", "retryafter", massChange.RetryAfter)
+		w.Header().Set("Retry-After", strconv.Itoa(int(massChange.RetryAfter.Seconds())))
+		scim.WriteError(w, http.StatusServiceUnavailable, massChange.Error())
+		return true
+	case errors.As(err, &conflict):
+		slog.Info("Write rejected by attribute policy", "attribute", conflict.Attribute, "source", conflict.Source, "owner", conflict.Owner)
+		scim.WriteTypedError(w, http.StatusBadRequest, "mutability", conflict.Error())
+		return true
+	case errors.Is(err, errInvalidRequest):
+		scim.WriteTypedError(w, http.StatusBadRequest, "invalidValue", err.Error())
+		return true
+	case errors.Is(err, errUserNameTaken):
+		scim.WriteTypedError(w, http.StatusConflict, "uniqueness", err.Error())
+		return true
+	}
+	return false
 }
 
 const (
@@ -177,7 +367,7 @@ const (
 	SchemaResourceType          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
 	SchemaSchema                = "urn:ietf:params:scim:schemas:core:2.0:Schema"
 	SchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
-	SchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SchemaError                 = scim.SchemaError
 )
 
 type Meta struct {
@@ -330,11 +520,13 @@ func ScimUserResponse(user scimUserDto) User {
 		Department:     user.Department,
 		Division:       user.Division,
 		CostCenter:     user.CostCenter,
-		Manager: &Manager{
+	}
+	if user.ManagerID != "" {
+		usr.EnterpriseUser.Manager = &Manager{
 			Value:       user.ManagerID,
 			Ref:         "https://api.example.com/scim/v2/Users/" + user.ManagerID,
 			DisplayName: "", //TODO: Fetch manager display name if available
-		},
+		}
 	}
 
 	for _, email := range user.Emails {
@@ -353,6 +545,13 @@ func ScimUserResponse(user scimUserDto) User {
 			Primary: phone.Primary,
 		})
 	}
+	for _, groupId := range user.GroupIDs {
+		usr.Groups = append(usr.Groups, GroupMember{
+			Value: groupId,
+			Ref:   "https://api.example.com/scim/v2/Groups/" + groupId,
+			Type:  "direct",
+		})
+	}
 
 	return usr
 }
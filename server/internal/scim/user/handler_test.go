@@ -0,0 +1,22 @@
+package user
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScimUserResponseManager(t *testing.T) {
+	data, err := json.Marshal(ScimUserResponse(scimUserDto{ID: "alice", UserName: "alice", Department: "R&D"}))
+	require.NoError(t, err)
+	var resource map[string]any
+	require.NoError(t, json.Unmarshal(data, &resource))
+	assert.Equal(t, map[string]any{"department": "R&D"}, resource[SchemaEnterpriseUser], "no manager without a manager id")
+
+	user := ScimUserResponse(scimUserDto{ID: "alice", UserName: "alice", ManagerID: "bob"})
+	require.NotNil(t, user.EnterpriseUser.Manager)
+	assert.Equal(t, "bob", user.EnterpriseUser.Manager.Value)
+	assert.Equal(t, "https://api.example.com/scim/v2/Users/bob", user.EnterpriseUser.Manager.Ref)
+}
@@ -0,0 +1,261 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jawee/scimtiplexer/internal/correlation"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/sources"
+	"github.com/jawee/scimtiplexer/internal/target"
+)
+
+var errUserNameTaken = errors.New("userName is already in use")
+
+// checkUserName checks that no other user has the userName of a user.
+func checkUserName(ctx context.Context, repo repository.Querier, user scimUserDto) error {
+	existing, err := repo.GetScimUserByUserName(ctx, user.UserName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to GetScimUserByUserName: %w", err)
+	}
+	if existing.ID != user.ID {
+		return fmt.Errorf("%w: %s belongs to another user", errUserNameTaken, user.UserName)
+	}
+	return nil
+}
+
+// createIdentity records an identity of a user. match is the candidate the
+// identity was correlated to, nil for the identity that created the user.
+func createIdentity(ctx context.Context, repo repository.Querier, organisationId, id, userId, source string, resource json.RawMessage, match *correlation.Candidate) error {
+	keys, err := correlation.LoadKeys(ctx, repo, organisationId, resource)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	params := repository.CreateUserIdentityParams{
+		ID:             id,
+		Organisationid: organisationId,
+		Userid:         userId,
+		Source:         sql.NullString{String: source, Valid: source != ""},
+		Resource:       sql.NullString{String: string(resource), Valid: len(resource) > 0},
+		Normalisedname: keys.NormalisedName,
+		Birthdate:      keys.BirthDate,
+		Createdonutc:   now,
+		Modifiedonutc:  now,
+	}
+	if match != nil {
+		params.Rules = sql.NullString{String: strings.Join(match.Rules, " "), Valid: true}
+		params.Confidence = sql.NullInt64{Int64: int64(match.Confidence), Valid: true}
+	}
+	if err := repo.CreateUserIdentity(ctx, params); err != nil {
+		return fmt.Errorf("failed to CreateUserIdentity: %w", err)
+	}
+	return nil
+}
+
+// linkIdentity creates a user for a source by linking a new identity to the
+// existing user it was correlated to, and applies what the source wrote to
+// it. The user is returned as the source knows it, with the identity id.
+func (s *service) linkIdentity(ctx context.Context, repo repository.Querier, organisationId, source string, user UserCreateRequest, resource json.RawMessage, match correlation.Candidate) (scimUserDto, error) {
+	identityId, err := uuid.NewV7()
+	if err != nil {
+		return scimUserDto{}, errors.New("failed to generate UUID for new identity")
+	}
+	if err := createIdentity(ctx, repo, organisationId, identityId.String(), match.UserID, source, resource, &match); err != nil {
+		return scimUserDto{}, err
+	}
+
+	userDto, err := s.writeUser(ctx, repo, organisationId, source, match.UserID, user.toScimUserDto(), writtenAttributes(resource))
+	if err != nil {
+		return scimUserDto{}, err
+	}
+	userDto.ID = identityId.String()
+	return userDto, nil
+}
+
+// LinkReview links the identity of a review to the candidate user. The user
+// the identity created is deleted, and its identities move to the candidate.
+func (s *service) LinkReview(ctx context.Context, organisationId, adminUserId, reviewId string) (scimUserDto, error) {
+	var userDto scimUserDto
+	err := s.db.WithTx(ctx, func(repo repository.Querier) error {
+		review, err := correlation.GetPendingReview(ctx, repo, organisationId, reviewId)
+		if err != nil {
+			return err
+		}
+		identity, err := repo.GetUserIdentity(ctx, repository.GetUserIdentityParams{
+			ID:             review.IdentityID,
+			Organisationid: organisationId,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to GetUserIdentity: %w", err)
+		}
+
+		previousUserId := identity.UserID
+		if previousUserId != review.CandidateUserID {
+			// Every other review of the user that goes away is moot.
+			err = repo.DismissUserCorrelationReviews(ctx, repository.DismissUserCorrelationReviewsParams{
+				Resolvedby:    sql.NullString{String: adminUserId, Valid: true},
+				Resolvedonutc: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+				Userid:        previousUserId,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to DismissUserCorrelationReviews: %w", err)
+			}
+			if err := s.deleteUser(ctx, repo, organisationId, previousUserId); err != nil {
+				return err
+			}
+			err = repo.MoveUserIdentities(ctx, repository.MoveUserIdentitiesParams{
+				Userid:         review.CandidateUserID,
+				Modifiedonutc:  time.Now().UTC(),
+				Previoususerid: previousUserId,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to MoveUserIdentities: %w", err)
+			}
+			err = repo.UpdateUserIdentityUser(ctx, repository.UpdateUserIdentityUserParams{
+				Userid:        review.CandidateUserID,
+				Rules:         sql.NullString{String: review.Rules, Valid: true},
+				Confidence:    sql.NullInt64{Int64: review.Confidence, Valid: true},
+				Modifiedonutc: time.Now().UTC(),
+				ID:            identity.ID,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to UpdateUserIdentityUser: %w", err)
+			}
+		}
+
+		userDto, err = getUser(ctx, repo, organisationId, review.CandidateUserID)
+		if err != nil {
+			return err
+		}
+		if identity.Resource.Valid {
+			var user UserCreateRequest
+			if err := json.Unmarshal([]byte(identity.Resource.String), &user); err != nil {
+				return fmt.Errorf("failed to decode identity resource: %w", err)
+			}
+			userDto, err = s.writeUser(ctx, repo, organisationId, identity.Source.String, review.CandidateUserID, user.toScimUserDto(), writtenAttributes(json.RawMessage(identity.Resource.String)))
+			if err != nil {
+				return err
+			}
+		}
+
+		return correlation.ResolveReview(ctx, repo, review.ID, correlation.ReviewLinked, adminUserId)
+	})
+	if err != nil {
+		return scimUserDto{}, err
+	}
+
+	s.dispatcher.Notify()
+	return userDto, nil
+}
+
+// UnlinkIdentity splits an identity off the user it is linked to, creating a
+// user of its own from what its source last wrote. The new user gets the id
+// of the identity, so the source keeps addressing it by the same id. The
+// attributes the source wrote to the user it leaves stay as they are.
+func (s *service) UnlinkIdentity(ctx context.Context, organisationId, userId, identityId string) (scimUserDto, error) {
+	var userDto scimUserDto
+	err := s.db.WithTx(ctx, func(repo repository.Querier) error {
+		identity, err := repo.GetUserIdentity(ctx, repository.GetUserIdentityParams{
+			ID:             identityId,
+			Organisationid: organisationId,
+		})
+		if err != nil {
+			return err
+		}
+		if identity.UserID != userId {
+			return sql.ErrNoRows
+		}
+		if identity.ID == identity.UserID {
+			return fmt.Errorf("%w: the identity that created a user can't be unlinked from it", errInvalidRequest)
+		}
+		if !identity.Resource.Valid {
+			return fmt.Errorf("%w: the identity has no resource to create a user from", errInvalidRequest)
+		}
+
+		var user UserCreateRequest
+		if err := json.Unmarshal([]byte(identity.Resource.String), &user); err != nil {
+			return fmt.Errorf("failed to decode identity resource: %w", err)
+		}
+		policies, err := sources.LoadPolicies(ctx, repo, organisationId)
+		if err != nil {
+			return err
+		}
+		merged, changed, err := mergeUser(policies, nil, identity.Source.String, scimUserDto{}, user.toScimUserDto(), writtenAttributes(json.RawMessage(identity.Resource.String)))
+		if err != nil {
+			return err
+		}
+		if merged.UserName == "" {
+			return fmt.Errorf("%w: userName is required", errInvalidRequest)
+		}
+		if err := checkUserName(ctx, repo, merged); err != nil {
+			if errors.Is(err, errUserNameTaken) {
+				return fmt.Errorf("%w, the identity can't be split off until its source changes it", err)
+			}
+			return err
+		}
+
+		merged.ID = identity.ID
+		userDto, err = createUser(ctx, repo, organisationId, merged)
+		if err != nil {
+			return err
+		}
+		if err := recordProvenance(ctx, repo, userDto.ID, identity.Source.String, changed); err != nil {
+			return err
+		}
+		err = repo.UpdateUserIdentityUser(ctx, repository.UpdateUserIdentityUserParams{
+			Userid:        identity.ID,
+			Modifiedonutc: time.Now().UTC(),
+			ID:            identity.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to UpdateUserIdentityUser: %w", err)
+		}
+		return s.enqueue(ctx, repo, target.OperationCreate, userDto, false)
+	})
+	if err != nil {
+		return scimUserDto{}, err
+	}
+
+	s.dispatcher.Notify()
+	return userDto, nil
+}
+
+// deleteUser deletes a user and everything stored for it but its
+// identities, and queues the delete for the targets of its organisation.
+func (s *service) deleteUser(ctx context.Context, repo repository.Querier, organisationId, id string) error {
+	user, err := getUser(ctx, repo, organisationId, id)
+	if err != nil {
+		return fmt.Errorf("failed to GetScimUserById: %w", err)
+	}
+
+	if err := repo.DeleteUserEmails(ctx, id); err != nil {
+		return fmt.Errorf("failed to DeleteUserEmails: %w", err)
+	}
+	if err := repo.DeleteUserPhoneNumbers(ctx, id); err != nil {
+		return fmt.Errorf("failed to DeleteUserPhoneNumbers: %w", err)
+	}
+	if err := repo.DeleteUserGroupMemberships(ctx, id); err != nil {
+		return fmt.Errorf("failed to DeleteUserGroupMemberships: %w", err)
+	}
+	if err := repo.DeleteUserAttributeSources(ctx, id); err != nil {
+		return fmt.Errorf("failed to DeleteUserAttributeSources: %w", err)
+	}
+	err = repo.DeleteScimUser(ctx, repository.DeleteScimUserParams{
+		ID:             id,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to DeleteScimUser: %w", err)
+	}
+	return s.enqueue(ctx, repo, target.OperationDelete, user, false)
+}
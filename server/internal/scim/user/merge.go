@@ -0,0 +1,210 @@
+package user
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/sources"
+)
+
+// userAttribute compares and copies one of sources.Attributes between users.
+type userAttribute struct {
+	name  string
+	equal func(a, b *scimUserDto) bool
+	copy  func(dst, src *scimUserDto)
+}
+
+func stringAttribute(name string, field func(u *scimUserDto) *string) userAttribute {
+	return userAttribute{
+		name:  name,
+		equal: func(a, b *scimUserDto) bool { return *field(a) == *field(b) },
+		copy:  func(dst, src *scimUserDto) { *field(dst) = *field(src) },
+	}
+}
+
+var userAttributes = []userAttribute{
+	stringAttribute("externalId", func(u *scimUserDto) *string { return &u.ExternalID }),
+	stringAttribute("userName", func(u *scimUserDto) *string { return &u.UserName }),
+	stringAttribute("displayName", func(u *scimUserDto) *string { return &u.DisplayName }),
+	stringAttribute("nickName", func(u *scimUserDto) *string { return &u.NickName }),
+	stringAttribute("profileUrl", func(u *scimUserDto) *string { return &u.ProfileUrl }),
+	stringAttribute("title", func(u *scimUserDto) *string { return &u.Title }),
+	stringAttribute("userType", func(u *scimUserDto) *string { return &u.UserType }),
+	stringAttribute("preferredLanguage", func(u *scimUserDto) *string { return &u.PreferredLanguage }),
+	stringAttribute("locale", func(u *scimUserDto) *string { return &u.Locale }),
+	stringAttribute("timezone", func(u *scimUserDto) *string { return &u.Timezone }),
+	{
+		name:  "active",
+		equal: func(a, b *scimUserDto) bool { return a.Active == b.Active },
+		copy:  func(dst, src *scimUserDto) { dst.Active = src.Active },
+	},
+	stringAttribute("name.formatted", func(u *scimUserDto) *string { return &u.NameFormatted }),
+	stringAttribute("name.familyName", func(u *scimUserDto) *string { return &u.NameFamilyName }),
+	stringAttribute("name.givenName", func(u *scimUserDto) *string { return &u.NameGivenName }),
+	stringAttribute("name.middleName", func(u *scimUserDto) *string { return &u.NameMiddleName }),
+	stringAttribute("name.honorificPrefix", func(u *scimUserDto) *string { return &u.NameHonorificPrefix }),
+	stringAttribute("name.honorificSuffix", func(u *scimUserDto) *string { return &u.NameHonorificSuffix }),
+	{
+		name:  "emails",
+		equal: func(a, b *scimUserDto) bool { return slices.Equal(sortedEmails(a.Emails), sortedEmails(b.Emails)) },
+		copy:  func(dst, src *scimUserDto) { dst.Emails = src.Emails },
+	},
+	{
+		name: "phoneNumbers",
+		equal: func(a, b *scimUserDto) bool {
+			return slices.Equal(sortedPhoneNumbers(a.PhoneNumbers), sortedPhoneNumbers(b.PhoneNumbers))
+		},
+		copy: func(dst, src *scimUserDto) { dst.PhoneNumbers = src.PhoneNumbers },
+	},
+	stringAttribute("employeeNumber", func(u *scimUserDto) *string { return &u.EmployeeNumber }),
+	stringAttribute("organization", func(u *scimUserDto) *string { return &u.Organization }),
+	stringAttribute("department", func(u *scimUserDto) *string { return &u.Department }),
+	stringAttribute("division", func(u *scimUserDto) *string { return &u.Division }),
+	stringAttribute("costCenter", func(u *scimUserDto) *string { return &u.CostCenter }),
+	stringAttribute("manager", func(u *scimUserDto) *string { return &u.ManagerID }),
+}
+
+// enterpriseAttributes are the attributes of the enterprise extension.
+var enterpriseAttributes = []string{"employeeNumber", "organization", "department", "division", "costCenter", "manager"}
+
+// writtenAttributes returns the attributes a resource has, by the names of
+// userAttributes. Attributes that are missing from it aren't written, so a
+// source that only sends some attributes leaves the others as they are. An
+// attribute that is null is written, clearing it. Attribute names are case
+// insensitive.
+func writtenAttributes(resource json.RawMessage) map[string]bool {
+	written := make(map[string]bool)
+	top, ok := jsonObject(resource)
+	if !ok {
+		return written
+	}
+
+	for key, value := range top {
+		switch key {
+		case "name":
+			writtenSubAttributes(written, "name.", value, nameAttributes())
+		case strings.ToLower(SchemaEnterpriseUser):
+			writtenSubAttributes(written, "", value, enterpriseAttributes)
+		default:
+			if name, ok := attributeName(key); ok && !slices.Contains(enterpriseAttributes, name) {
+				written[name] = true
+			}
+		}
+	}
+	return written
+}
+
+// writtenSubAttributes adds the sub-attributes a complex attribute has, or
+// all of them when it is null.
+func writtenSubAttributes(written map[string]bool, prefix string, value json.RawMessage, all []string) {
+	if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+		for _, name := range all {
+			written[name] = true
+		}
+		return
+	}
+	sub, _ := jsonObject(value)
+	for key := range sub {
+		if name, ok := attributeName(prefix + key); ok && slices.Contains(all, name) {
+			written[name] = true
+		}
+	}
+}
+
+// jsonObject decodes a JSON object with its keys in lower case.
+func jsonObject(data json.RawMessage) (map[string]json.RawMessage, bool) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil || object == nil {
+		return nil, false
+	}
+	lower := make(map[string]json.RawMessage, len(object))
+	for key, value := range object {
+		lower[strings.ToLower(key)] = value
+	}
+	return lower, true
+}
+
+func nameAttributes() []string {
+	var names []string
+	for _, attribute := range userAttributes {
+		if strings.HasPrefix(attribute.name, "name.") {
+			names = append(names, attribute.name)
+		}
+	}
+	return names
+}
+
+// attributeName returns the name in userAttributes of an attribute in any
+// case.
+func attributeName(key string) (string, bool) {
+	for _, attribute := range userAttributes {
+		if strings.EqualFold(attribute.name, key) {
+			return attribute.name, true
+		}
+	}
+	return "", false
+}
+
+// sortedEmails returns the emails without their ids, ordered by value, so
+// stored and requested emails compare equal.
+func sortedEmails(emails []scimUserEmailsDto) []scimUserEmailsDto {
+	sorted := make([]scimUserEmailsDto, len(emails))
+	for i, email := range emails {
+		email.ID = ""
+		sorted[i] = email
+	}
+	slices.SortFunc(sorted, func(a, b scimUserEmailsDto) int { return cmp.Compare(a.Value, b.Value) })
+	return sorted
+}
+
+func sortedPhoneNumbers(phoneNumbers []scimUserPhoneNumbersDto) []scimUserPhoneNumbersDto {
+	sorted := make([]scimUserPhoneNumbersDto, len(phoneNumbers))
+	for i, phone := range phoneNumbers {
+		phone.ID = ""
+		sorted[i] = phone
+	}
+	slices.SortFunc(sorted, func(a, b scimUserPhoneNumbersDto) int { return cmp.Compare(a.Value, b.Value) })
+	return sorted
+}
+
+// mergeUser applies the attributes a source writes to the current user, the
+// zero user for creates. Only the written attributes are applied, see
+// writtenAttributes, and attributes the policies don't let the source change
+// keep their current value. It returns the merged user and the attributes
+// that changed.
+func mergeUser(policies sources.Policies, provenance map[string]sources.Provenance, source string, current, incoming scimUserDto, written map[string]bool) (scimUserDto, []string, error) {
+	merged := current
+	var changed []string
+	for _, attribute := range userAttributes {
+		if !written[attribute.name] || attribute.equal(&current, &incoming) {
+			continue
+		}
+		allowed, err := policies.Resolve(attribute.name, source, provenance[attribute.name].Source)
+		if err != nil {
+			return scimUserDto{}, nil, err
+		}
+		if !allowed {
+			continue
+		}
+		attribute.copy(&merged, &incoming)
+		changed = append(changed, attribute.name)
+	}
+	return merged, changed, nil
+}
+
+// recordProvenance records that source changed the attributes of a user.
+func recordProvenance(ctx context.Context, repo repository.Querier, userId, source string, attributes []string) error {
+	now := time.Now().UTC()
+	for _, attribute := range attributes {
+		if err := sources.SetProvenance(ctx, repo, userId, attribute, source, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package user
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jawee/scimtiplexer/internal/sources"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// write merges a request body of source into current, like the SCIM
+// endpoints do.
+func write(t *testing.T, policies sources.Policies, source string, current scimUserDto, body string) (scimUserDto, []string) {
+	t.Helper()
+	var req UserCreateRequest
+	require.NoError(t, json.Unmarshal([]byte(body), &req))
+	merged, changed, err := mergeUser(policies, nil, source, current, req.toScimUserDto(), writtenAttributes(json.RawMessage(body)))
+	require.NoError(t, err)
+	return merged, changed
+}
+
+func TestMergeUserPartialSourceKeepsOtherAttributes(t *testing.T) {
+	entra, _ := write(t, sources.Policies{}, "entra", scimUserDto{}, `{
+		"userName": "alice",
+		"active": true,
+		"name": {"givenName": "Alice", "familyName": "Smith"},
+		"emails": [{"value": "alice@example.com", "primary": true}],
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"manager": {"value": "bob"}}
+	}`)
+
+	merged, changed := write(t, sources.Policies{}, "hr", entra, `{
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"department": "Engineering", "costCenter": "CC1"}
+	}`)
+
+	assert.ElementsMatch(t, []string{"department", "costCenter"}, changed)
+	assert.Equal(t, "alice", merged.UserName)
+	assert.True(t, merged.Active)
+	assert.Equal(t, "Alice", merged.NameGivenName)
+	assert.Equal(t, "Smith", merged.NameFamilyName)
+	assert.Equal(t, entra.Emails, merged.Emails)
+	assert.Equal(t, "bob", merged.ManagerID)
+	assert.Equal(t, "Engineering", merged.Department)
+	assert.Equal(t, "CC1", merged.CostCenter)
+}
+
+func TestMergeUserPartialName(t *testing.T) {
+	current, _ := write(t, sources.Policies{}, "entra", scimUserDto{}, `{"userName": "alice", "name": {"givenName": "Alice", "familyName": "Smith"}}`)
+
+	merged, changed := write(t, sources.Policies{}, "hr", current, `{"name": {"familyName": "Jones"}}`)
+
+	assert.Equal(t, []string{"name.familyName"}, changed)
+	assert.Equal(t, "Alice", merged.NameGivenName)
+	assert.Equal(t, "Jones", merged.NameFamilyName)
+}
+
+func TestMergeUserNullClears(t *testing.T) {
+	current, _ := write(t, sources.Policies{}, "entra", scimUserDto{}, `{"userName": "alice", "title": "Engineer", "name": {"givenName": "Alice"}}`)
+
+	merged, changed := write(t, sources.Policies{}, "entra", current, `{"title": null, "name": null}`)
+
+	assert.ElementsMatch(t, []string{"title", "name.givenName"}, changed)
+	assert.Empty(t, merged.Title)
+	assert.Empty(t, merged.NameGivenName)
+	assert.Equal(t, "alice", merged.UserName)
+}
+
+func TestMergeUserMissingActiveKeepsActive(t *testing.T) {
+	current, _ := write(t, sources.Policies{}, "entra", scimUserDto{}, `{"userName": "alice", "active": true}`)
+
+	merged, changed := write(t, sources.Policies{}, "entra", current, `{"userName": "alice", "displayName": "Alice"}`)
+
+	assert.Equal(t, []string{"displayName"}, changed)
+	assert.True(t, merged.Active)
+}
+
+func TestMergeUserAttributeNamesAreCaseInsensitive(t *testing.T) {
+	written := writtenAttributes(json.RawMessage(`{"USERNAME": "alice", "Name": {"GivenName": "Alice"}, "urn:ietf:params:scim:schemas:extension:enterprise:2.0:user": {"Department": "x"}}`))
+
+	assert.Equal(t, map[string]bool{"userName": true, "name.givenName": true, "department": true}, written)
+}
+
+func TestMergeUserPolicyKeepsOwnedAttribute(t *testing.T) {
+	policies := sources.Policies{
+		"department": {Attribute: "department", Sources: []string{"hr", "entra"}, Conflict: sources.ConflictKeep},
+	}
+	current := scimUserDto{UserName: "alice", Department: "Engineering"}
+	provenance := map[string]sources.Provenance{"department": {Attribute: "department", Source: "hr"}}
+	body := `{"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"department": "Sales"}}`
+
+	var req UserCreateRequest
+	require.NoError(t, json.Unmarshal([]byte(body), &req))
+	merged, changed, err := mergeUser(policies, provenance, "entra", current, req.toScimUserDto(), writtenAttributes(json.RawMessage(body)))
+
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+	assert.Equal(t, "Engineering", merged.Department)
+}
@@ -3,22 +3,41 @@ package user
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jawee/scimtiplexer/internal/changes"
+	"github.com/jawee/scimtiplexer/internal/correlation"
+	"github.com/jawee/scimtiplexer/internal/database"
 	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/scim"
+	"github.com/jawee/scimtiplexer/internal/scim/schema"
+	"github.com/jawee/scimtiplexer/internal/sources"
+	"github.com/jawee/scimtiplexer/internal/target"
 )
 
 type service struct {
-	repo repository.Querier
+	repo       repository.Querier
+	db         database.Transactor
+	dispatcher *target.Dispatcher
 }
 
-func (s *service) GetAllUsers(ctx context.Context, organisationId string) ([]scimUserDto, error) {
+// GetAllUsers returns the users of an organisation with the ids of their
+// identities from source, see IdentityIds.
+func (s *service) GetAllUsers(ctx context.Context, organisationId, source string) ([]scimUserDto, error) {
 	users, err := s.repo.GetAllScimUsers(ctx, organisationId)
 	if err != nil {
-		return nil, fmt.Errorf("failed to GetScimUsersByOrganisationId: %w", err)
+		return nil, fmt.Errorf("failed to GetAllScimUsers: %w", err)
+	}
+	ids, err := IdentityIds(ctx, s.repo, organisationId, source)
+	if err != nil {
+		return nil, err
 	}
 
 	var userDtos []scimUserDto
@@ -31,16 +50,76 @@ func (s *service) GetAllUsers(ctx context.Context, organisationId string) ([]sci
 		if err != nil {
 			slog.Error("failed to GetUserPhoneNumbers", "error", err, "userId", user.ID)
 		}
+		userGroups, err := s.repo.GetUserGroupMemberships(ctx, user.ID)
+		if err != nil {
+			slog.Error("failed to GetUserGroupMemberships", "error", err, "userId", user.ID)
+		}
 
-		dto := newScimUserDto(user, userEmails, userPhoneNumbers)
+		dto := newScimUserDto(user, userEmails, userPhoneNumbers, userGroups)
+		dto.ID = ids.ID(user.ID)
 		userDtos = append(userDtos, dto)
 	}
 
 	return userDtos, nil
 }
 
+// Ids maps the ids of users to the ids of their identities from a source.
+type Ids map[string]string
+
+// ID returns the id of the identity of a user, or the user id when the
+// source has no identity of it. The user id is also the id of the identity
+// that created the user, so it can be used for the user in requests.
+func (ids Ids) ID(userId string) string {
+	if id, ok := ids[userId]; ok {
+		return id
+	}
+	return userId
+}
+
+// IdentityIds returns the ids of the identities a source has of the users of
+// an organisation, the oldest when it has several of a user. Credentials
+// without a source get the user ids.
+func IdentityIds(ctx context.Context, repo repository.Querier, organisationId, source string) (Ids, error) {
+	ids := make(Ids)
+	if source == "" {
+		return ids, nil
+	}
+	identities, err := repo.GetSourceUserIdentities(ctx, repository.GetSourceUserIdentitiesParams{
+		Organisationid: organisationId,
+		Source:         sql.NullString{String: source, Valid: true},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetSourceUserIdentities: %w", err)
+	}
+	for _, identity := range identities {
+		if _, ok := ids[identity.UserID]; !ok {
+			ids[identity.UserID] = identity.ID
+		}
+	}
+	return ids, nil
+}
+
+// GetUser returns a user by the id of one of its identities. The user is
+// returned with that id, as the source that asks knows it.
 func (s *service) GetUser(ctx context.Context, organisationId, id string) (scimUserDto, error) {
-	user, err := s.repo.GetScimUserById(ctx, repository.GetScimUserByIdParams{
+	identity, err := s.repo.GetUserIdentity(ctx, repository.GetUserIdentityParams{
+		ID:             id,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return scimUserDto{}, err
+	}
+
+	user, err := getUser(ctx, s.repo, organisationId, identity.UserID)
+	if err != nil {
+		return scimUserDto{}, err
+	}
+	user.ID = id
+	return user, nil
+}
+
+func getUser(ctx context.Context, repo repository.Querier, organisationId, id string) (scimUserDto, error) {
+	user, err := repo.GetScimUserById(ctx, repository.GetScimUserByIdParams{
 		Organisationid: organisationId,
 		ID:             id,
 	})
@@ -48,40 +127,161 @@ func (s *service) GetUser(ctx context.Context, organisationId, id string) (scimU
 	if err != nil {
 		return scimUserDto{}, err
 	}
-	userEmails, err := s.repo.GetUserEmails(ctx, id)
+	userEmails, err := repo.GetUserEmails(ctx, id)
 	if err != nil {
 		slog.Error("failed to GetUserEmails", "error", err, "userId", id)
 	}
-	userPhoneNumbers, err := s.repo.GetUserPhoneNumbers(ctx, id)
+	userPhoneNumbers, err := repo.GetUserPhoneNumbers(ctx, id)
 	if err != nil {
 		slog.Error("failed to GetUserPhoneNumbers", "error", err, "userId", id)
 	}
+	userGroups, err := repo.GetUserGroupMemberships(ctx, id)
+	if err != nil {
+		slog.Error("failed to GetUserGroupMemberships", "error", err, "userId", id)
+	}
 
-	dto := newScimUserDto(user, userEmails, userPhoneNumbers)
+	dto := newScimUserDto(user, userEmails, userPhoneNumbers, userGroups)
 	return dto, nil
 }
 
-func (u *UserCreateRequest) toCreateScimUserParams(organisationId string) (repository.CreateScimUserParams, error) {
-	userId, err := uuid.NewV7()
-	if err != nil {
-		return repository.CreateScimUserParams{}, errors.New("failed to generate UUID for new user")
+var errInvalidRequest = errors.New("invalid request")
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// toScimUserDto returns the user a request writes.
+func (u *UserCreateRequest) toScimUserDto() scimUserDto {
+	dto := scimUserDto{
+		ExternalID:        u.ExternalID,
+		UserName:          u.UserName,
+		DisplayName:       u.DisplayName,
+		NickName:          u.NickName,
+		ProfileUrl:        u.ProfileURL,
+		Title:             u.Title,
+		UserType:          u.UserType,
+		PreferredLanguage: u.PreferredLanguage,
+		Locale:            u.Locale,
+		Timezone:          u.Timezone,
+		Active:            u.Active,
+	}
+	if u.Name != nil {
+		dto.NameFormatted = u.Name.Formatted
+		dto.NameFamilyName = u.Name.FamilyName
+		dto.NameGivenName = u.Name.GivenName
+		dto.NameMiddleName = u.Name.MiddleName
+		dto.NameHonorificPrefix = u.Name.HonorificPrefix
+		dto.NameHonorificSuffix = u.Name.HonorificSuffix
+	}
+	if u.EnterpriseUser != nil {
+		dto.EmployeeNumber = u.EnterpriseUser.EmployeeNumber
+		dto.Organization = u.EnterpriseUser.Organization
+		dto.Department = u.EnterpriseUser.Department
+		dto.Division = u.EnterpriseUser.Division
+		dto.CostCenter = u.EnterpriseUser.CostCenter
+		if u.EnterpriseUser.Manager != nil {
+			dto.ManagerID = u.EnterpriseUser.Manager.Value
+		}
 	}
+	for _, email := range u.Emails {
+		dto.Emails = append(dto.Emails, scimUserEmailsDto{
+			DisplayName: email.Display,
+			Type:        email.Type,
+			Value:       email.Value,
+			Primary:     email.Primary,
+		})
+	}
+	for _, phone := range u.PhoneNumbers {
+		dto.PhoneNumbers = append(dto.PhoneNumbers, scimUserPhoneNumbersDto{
+			DisplayName: phone.Display,
+			Type:        phone.Type,
+			Value:       phone.Value,
+			Primary:     phone.Primary,
+		})
+	}
+	return dto
+}
 
+// toCreateScimUserParams returns the params to create the user, with a new id
+// unless the user has one.
+func (u *scimUserDto) toCreateScimUserParams(organisationId string) (repository.CreateScimUserParams, error) {
+	id := u.ID
+	if id == "" {
+		userId, err := uuid.NewV7()
+		if err != nil {
+			return repository.CreateScimUserParams{}, errors.New("failed to generate UUID for new user")
+		}
+		id = userId.String()
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
 	scimUser := repository.CreateScimUserParams{
-		ID:             userId.String(),
+		ID:             id,
 		OrganisationID: organisationId,
 
-		UserName: u.UserName,
-		DisplayName: sql.NullString{
-			String: u.DisplayName,
-			Valid:  u.DisplayName != "",
-		},
-		Active: u.Active,
+		ExternalID:          nullString(u.ExternalID),
+		UserName:            u.UserName,
+		DisplayName:         nullString(u.DisplayName),
+		NickName:            nullString(u.NickName),
+		ProfileUrl:          nullString(u.ProfileUrl),
+		Title:               nullString(u.Title),
+		UserType:            nullString(u.UserType),
+		PreferredLanguage:   nullString(u.PreferredLanguage),
+		Locale:              nullString(u.Locale),
+		Timezone:            nullString(u.Timezone),
+		Active:              u.Active,
+		MetaResourceType:    "User",
+		MetaCreated:         now,
+		MetaLastModified:    now,
+		NameFormatted:       nullString(u.NameFormatted),
+		NameFamilyName:      nullString(u.NameFamilyName),
+		NameGivenName:       nullString(u.NameGivenName),
+		NameMiddleName:      nullString(u.NameMiddleName),
+		NameHonorificPrefix: nullString(u.NameHonorificPrefix),
+		NameHonorificSuffix: nullString(u.NameHonorificSuffix),
+		EmployeeNumber:      nullString(u.EmployeeNumber),
+		Organization:        nullString(u.Organization),
+		Department:          nullString(u.Department),
+		Division:            nullString(u.Division),
+		CostCenter:          nullString(u.CostCenter),
+		ManagerID:           nullString(u.ManagerID),
 	}
 
 	return scimUser, nil
 }
 
+func (u *scimUserDto) toUpdateScimUserParams() repository.UpdateScimUserParams {
+	return repository.UpdateScimUserParams{
+		ID:             u.ID,
+		OrganisationID: u.OrganisationID,
+
+		ExternalID:          nullString(u.ExternalID),
+		UserName:            u.UserName,
+		DisplayName:         nullString(u.DisplayName),
+		NickName:            nullString(u.NickName),
+		ProfileUrl:          nullString(u.ProfileUrl),
+		Title:               nullString(u.Title),
+		UserType:            nullString(u.UserType),
+		PreferredLanguage:   nullString(u.PreferredLanguage),
+		Locale:              nullString(u.Locale),
+		Timezone:            nullString(u.Timezone),
+		Active:              u.Active,
+		MetaLastModified:    time.Now().UTC().Format(time.RFC3339),
+		NameFormatted:       nullString(u.NameFormatted),
+		NameFamilyName:      nullString(u.NameFamilyName),
+		NameGivenName:       nullString(u.NameGivenName),
+		NameMiddleName:      nullString(u.NameMiddleName),
+		NameHonorificPrefix: nullString(u.NameHonorificPrefix),
+		NameHonorificSuffix: nullString(u.NameHonorificSuffix),
+		EmployeeNumber:      nullString(u.EmployeeNumber),
+		Organization:        nullString(u.Organization),
+		Department:          nullString(u.Department),
+		Division:            nullString(u.Division),
+		CostCenter:          nullString(u.CostCenter),
+		ManagerID:           nullString(u.ManagerID),
+	}
+}
+
 type scimUserEmailsDto struct {
 	ID          string
 	DisplayName string
@@ -129,9 +329,10 @@ type scimUserDto struct {
 	CostCenter          string
 	ManagerID           string
 	OrganisationID      string
+	GroupIDs            []string
 }
 
-func newScimUserDto(user repository.ScimUser, emails []repository.ScimUserEmail, phoneNumbers []repository.ScimUserPhoneNumber) scimUserDto {
+func newScimUserDto(user repository.ScimUser, emails []repository.ScimUserEmail, phoneNumbers []repository.ScimUserPhoneNumber, groups []repository.ScimUserGroupMembership) scimUserDto {
 	dto := scimUserDto{
 		ID:                  user.ID,
 		DisplayName:         user.DisplayName.String,
@@ -161,6 +362,7 @@ func newScimUserDto(user repository.ScimUser, emails []repository.ScimUserEmail,
 		Division:            user.Division.String,
 		CostCenter:          user.CostCenter.String,
 		ManagerID:           user.ManagerID.String,
+		OrganisationID:      user.OrganisationID,
 	}
 
 	for _, email := range emails {
@@ -183,15 +385,299 @@ func newScimUserDto(user repository.ScimUser, emails []repository.ScimUserEmail,
 		})
 	}
 
+	for _, group := range groups {
+		dto.GroupIDs = append(dto.GroupIDs, group.GroupID)
+	}
+
 	return dto
 }
 
-func (s *service) CreateUser(ctx context.Context, organisationId string, user UserCreateRequest) (scimUserDto, error) {
+// CreateUser stores the user and queues it for the targets of the
+// organisation in one transaction. The attribute policies of the
+// organisation decide which attributes source may set. A user the
+// correlation rules confidently match to an existing one is linked to it
+// instead, and ambiguous matches are put up for review.
+func (s *service) CreateUser(ctx context.Context, organisationId, source string, user UserCreateRequest, resource json.RawMessage) (scimUserDto, error) {
+	var userDto scimUserDto
+	err := s.db.WithTx(ctx, func(repo repository.Querier) error {
+		candidates, err := correlation.Match(ctx, repo, organisationId, resource)
+		if err != nil {
+			return err
+		}
+		link, review := correlation.Decide(candidates)
+		if link != nil {
+			userDto, err = s.linkIdentity(ctx, repo, organisationId, source, user, resource, *link)
+			return err
+		}
+
+		policies, err := sources.LoadPolicies(ctx, repo, organisationId)
+		if err != nil {
+			return err
+		}
+		merged, changed, err := mergeUser(policies, nil, source, scimUserDto{}, user.toScimUserDto(), writtenAttributes(resource))
+		if err != nil {
+			return err
+		}
+		if merged.UserName == "" {
+			return fmt.Errorf("%w: userName is required", errInvalidRequest)
+		}
+		if err := checkUserName(ctx, repo, merged); err != nil {
+			return err
+		}
+
+		userDto, err = createUser(ctx, repo, organisationId, merged)
+		if err != nil {
+			return err
+		}
+		if err := recordProvenance(ctx, repo, userDto.ID, source, changed); err != nil {
+			return err
+		}
+		if err := createIdentity(ctx, repo, organisationId, userDto.ID, userDto.ID, source, resource, nil); err != nil {
+			return err
+		}
+		if err := correlation.CreateReviews(ctx, repo, organisationId, userDto.ID, review); err != nil {
+			return err
+		}
+		return s.enqueue(ctx, repo, target.OperationCreate, userDto, false)
+	})
+	if err != nil {
+		return scimUserDto{}, err
+	}
+
+	s.dispatcher.Notify()
+	return userDto, nil
+}
+
+// ReplaceUser replaces the attributes of the user an identity is linked to
+// that source may change under the attribute policies of the organisation,
+// the others keep their value.
+func (s *service) ReplaceUser(ctx context.Context, organisationId, source, id string, user UserCreateRequest, resource json.RawMessage) (scimUserDto, error) {
+	var userDto scimUserDto
+	err := s.db.WithTx(ctx, func(repo repository.Querier) error {
+		identity, err := repo.GetUserIdentity(ctx, repository.GetUserIdentityParams{
+			ID:             id,
+			Organisationid: organisationId,
+		})
+		if err != nil {
+			return err
+		}
+
+		userDto, err = s.writeUser(ctx, repo, organisationId, source, identity.UserID, user.toScimUserDto(), writtenAttributes(resource))
+		if err != nil {
+			return err
+		}
+		userDto.ID = id
+
+		return updateIdentityResource(ctx, repo, organisationId, id, resource)
+	})
+	if err != nil {
+		return scimUserDto{}, err
+	}
+
+	s.dispatcher.Notify()
+	return userDto, nil
+}
+
+// PatchUser applies PATCH operations to what the source of an identity last
+// wrote, and writes the attributes they change to the user the identity is
+// linked to, as ReplaceUser does.
+func (s *service) PatchUser(ctx context.Context, organisationId, source, id string, operations []scim.PatchOperation) (scimUserDto, error) {
+	var userDto scimUserDto
+	err := s.db.WithTx(ctx, func(repo repository.Querier) error {
+		identity, err := repo.GetUserIdentity(ctx, repository.GetUserIdentityParams{
+			ID:             id,
+			Organisationid: organisationId,
+		})
+		if err != nil {
+			return err
+		}
+
+		// Identities from before resources were stored are patched as the
+		// user is now.
+		previous := json.RawMessage(identity.Resource.String)
+		if !identity.Resource.Valid {
+			current, err := getUser(ctx, repo, organisationId, identity.UserID)
+			if err != nil {
+				return err
+			}
+			if previous, err = json.Marshal(ScimUserResponse(current)); err != nil {
+				return fmt.Errorf("failed to marshal user: %w", err)
+			}
+		}
+		resource, err := patchResource(previous, operations)
+		if err != nil {
+			return err
+		}
+
+		var before, after UserCreateRequest
+		if err := json.Unmarshal(previous, &before); err != nil {
+			return fmt.Errorf("failed to decode identity resource: %w", err)
+		}
+		if err := json.Unmarshal(resource, &after); err != nil {
+			return fmt.Errorf("%w: %v", errInvalidRequest, err)
+		}
+		// Only the attributes the operations change are written, the source
+		// may have written others before the attribute policies let it.
+		beforeDto, afterDto := before.toScimUserDto(), after.toScimUserDto()
+		written := make(map[string]bool)
+		for _, attribute := range userAttributes {
+			written[attribute.name] = !attribute.equal(&beforeDto, &afterDto)
+		}
+
+		userDto, err = s.writeUser(ctx, repo, organisationId, source, identity.UserID, afterDto, written)
+		if err != nil {
+			return err
+		}
+		userDto.ID = id
+
+		return updateIdentityResource(ctx, repo, organisationId, id, resource)
+	})
+	if err != nil {
+		return scimUserDto{}, err
+	}
+
+	s.dispatcher.Notify()
+	return userDto, nil
+}
+
+// patchResource applies PATCH operations to a user resource. Some clients
+// send active as the string "True" or "False", it is stored as a boolean.
+func patchResource(resource json.RawMessage, operations []scim.PatchOperation) (json.RawMessage, error) {
+	var object map[string]any
+	if err := json.Unmarshal(resource, &object); err != nil {
+		return nil, fmt.Errorf("failed to decode identity resource: %w", err)
+	}
+	if object == nil {
+		object = make(map[string]any)
+	}
+	if err := scim.ApplyPatch(object, operations, schema.User, schema.EnterpriseUser); err != nil {
+		return nil, err
+	}
+	for key, value := range object {
+		if active, ok := value.(string); ok && strings.EqualFold(key, "active") {
+			b, err := strconv.ParseBool(active)
+			if err != nil {
+				return nil, fmt.Errorf("%w: active must be a boolean", errInvalidRequest)
+			}
+			object[key] = b
+		}
+	}
+	return json.Marshal(object)
+}
+
+// DeleteUser deletes an identity. The user it is linked to is deleted with
+// its last identity, until then the other sources keep it.
+func (s *service) DeleteUser(ctx context.Context, organisationId, id string) error {
+	err := s.db.WithTx(ctx, func(repo repository.Querier) error {
+		identity, err := repo.GetUserIdentity(ctx, repository.GetUserIdentityParams{
+			ID:             id,
+			Organisationid: organisationId,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := repo.DeleteIdentityCorrelationReviews(ctx, id); err != nil {
+			return fmt.Errorf("failed to DeleteIdentityCorrelationReviews: %w", err)
+		}
+		err = repo.DeleteUserIdentity(ctx, repository.DeleteUserIdentityParams{
+			ID:             id,
+			Organisationid: organisationId,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to DeleteUserIdentity: %w", err)
+		}
+
+		remaining, err := repo.GetUserIdentities(ctx, identity.UserID)
+		if err != nil {
+			return fmt.Errorf("failed to GetUserIdentities: %w", err)
+		}
+		if len(remaining) > 0 {
+			return nil
+		}
+		if err := repo.DeleteCandidateCorrelationReviews(ctx, identity.UserID); err != nil {
+			return fmt.Errorf("failed to DeleteCandidateCorrelationReviews: %w", err)
+		}
+		return s.deleteUser(ctx, repo, organisationId, identity.UserID)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.dispatcher.Notify()
+	return nil
+}
+
+// updateIdentityResource stores what the source of an identity last wrote.
+func updateIdentityResource(ctx context.Context, repo repository.Querier, organisationId, id string, resource json.RawMessage) error {
+	keys, err := correlation.LoadKeys(ctx, repo, organisationId, resource)
+	if err != nil {
+		return err
+	}
+	err = repo.UpdateUserIdentityResource(ctx, repository.UpdateUserIdentityResourceParams{
+		Resource:       sql.NullString{String: string(resource), Valid: true},
+		Normalisedname: keys.NormalisedName,
+		Birthdate:      keys.BirthDate,
+		Modifiedonutc:  time.Now().UTC(),
+		ID:             id,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to UpdateUserIdentityResource: %w", err)
+	}
+	return nil
+}
+
+// writeUser merges the attributes source writes into an existing user and
+// stores the result. The user is queued for the targets when anything
+// changed.
+func (s *service) writeUser(ctx context.Context, repo repository.Querier, organisationId, source, id string, incoming scimUserDto, written map[string]bool) (scimUserDto, error) {
+	current, err := getUser(ctx, repo, organisationId, id)
+	if err != nil {
+		return scimUserDto{}, err
+	}
+	policies, err := sources.LoadPolicies(ctx, repo, organisationId)
+	if err != nil {
+		return scimUserDto{}, err
+	}
+	provenance, err := sources.GetProvenance(ctx, repo, id)
+	if err != nil {
+		return scimUserDto{}, err
+	}
+
+	merged, changed, err := mergeUser(policies, provenance, source, current, incoming, written)
+	if err != nil {
+		return scimUserDto{}, err
+	}
+	if merged.UserName == "" {
+		return scimUserDto{}, fmt.Errorf("%w: userName is required", errInvalidRequest)
+	}
+	if len(changed) == 0 {
+		return current, nil
+	}
+	if err := checkUserName(ctx, repo, merged); err != nil {
+		return scimUserDto{}, err
+	}
+
+	updated, err := updateUser(ctx, repo, merged)
+	if err != nil {
+		return scimUserDto{}, err
+	}
+	if err := recordProvenance(ctx, repo, id, source, changed); err != nil {
+		return scimUserDto{}, err
+	}
+	deactivates := current.Active && !updated.Active
+	if err := s.enqueue(ctx, repo, target.OperationReplace, updated, deactivates); err != nil {
+		return scimUserDto{}, err
+	}
+	return updated, nil
+}
+
+func createUser(ctx context.Context, repo repository.Querier, organisationId string, user scimUserDto) (scimUserDto, error) {
 	newUser, err := user.toCreateScimUserParams(organisationId)
 	if err != nil {
-		return scimUserDto{}, fmt.Errorf("failed to convert user create request to params: %w", err)
+		return scimUserDto{}, fmt.Errorf("failed to convert user to params: %w", err)
 	}
-	userCreateResp, err := s.repo.CreateScimUser(ctx, newUser)
+	userCreateResp, err := repo.CreateScimUser(ctx, newUser)
 	if err != nil {
 		return scimUserDto{}, fmt.Errorf("failed to CreateScimUser: %w", err)
 	}
@@ -200,86 +686,120 @@ func (s *service) CreateUser(ctx context.Context, organisationId string, user Us
 		return scimUserDto{}, errors.New("failed to create user, no ID returned")
 	}
 
+	createUserValues(ctx, repo, userCreateResp, user)
+
+	createdUser, err := getUser(ctx, repo, organisationId, userCreateResp)
+	if err != nil {
+		return scimUserDto{}, fmt.Errorf("failed to GetScimUserById: %w", err)
+	}
+	return createdUser, nil
+}
+
+// updateUser stores all attributes of a user, replacing its emails and phone
+// numbers.
+func updateUser(ctx context.Context, repo repository.Querier, user scimUserDto) (scimUserDto, error) {
+	if err := repo.UpdateScimUser(ctx, user.toUpdateScimUserParams()); err != nil {
+		return scimUserDto{}, fmt.Errorf("failed to UpdateScimUser: %w", err)
+	}
+	if err := repo.DeleteUserEmails(ctx, user.ID); err != nil {
+		return scimUserDto{}, fmt.Errorf("failed to DeleteUserEmails: %w", err)
+	}
+	if err := repo.DeleteUserPhoneNumbers(ctx, user.ID); err != nil {
+		return scimUserDto{}, fmt.Errorf("failed to DeleteUserPhoneNumbers: %w", err)
+	}
+
+	createUserValues(ctx, repo, user.ID, user)
+
+	updatedUser, err := getUser(ctx, repo, user.OrganisationID, user.ID)
+	if err != nil {
+		return scimUserDto{}, fmt.Errorf("failed to GetScimUserById: %w", err)
+	}
+	return updatedUser, nil
+}
+
+// createUserValues stores the emails and phone numbers of a user.
+func createUserValues(ctx context.Context, repo repository.Querier, userId string, user scimUserDto) {
 	for _, email := range user.Emails {
 		emailId, err := uuid.NewV7()
 		if err != nil {
-			slog.Error("failed to generate UUID for email", "error", err, "email", email, "userId", userCreateResp)
+			slog.Error("failed to generate UUID for email", "error", err, "email", email, "userId", userId)
 			continue
 		}
 		param := repository.CreateUserEmailParams{
-			ID:     emailId.String(),
-			UserID: userCreateResp,
-			Display: sql.NullString{
-				String: email.Display,
-				Valid:  email.Display != "",
-			},
-			Type: sql.NullString{
-				String: email.Type,
-				Valid:  email.Type != "",
-			},
-			Value: email.Value,
+			ID:      emailId.String(),
+			UserID:  userId,
+			Display: nullString(email.DisplayName),
+			Type:    nullString(email.Type),
+			Value:   email.Value,
 			PrimaryEmail: sql.NullBool{
 				Bool:  email.Primary,
 				Valid: true,
 			},
 		}
 
-		err = s.repo.CreateUserEmail(ctx, param)
+		err = repo.CreateUserEmail(ctx, param)
 		if err != nil {
-			slog.Error("failed to create user email", "error", err, "email", email, "userId", userCreateResp)
+			slog.Error("failed to create user email", "error", err, "email", email, "userId", userId)
 		}
 	}
 
 	for _, phone := range user.PhoneNumbers {
 		phoneId, err := uuid.NewV7()
 		if err != nil {
-			slog.Error("failed to generate UUID for phone", "error", err, "phone", phone, "userId", userCreateResp)
+			slog.Error("failed to generate UUID for phone", "error", err, "phone", phone, "userId", userId)
 			continue
 		}
 		param := repository.CreateUserPhoneNumberParams{
-			ID:     phoneId.String(),
-			UserID: userCreateResp,
-			Display: sql.NullString{
-				String: phone.Display,
-				Valid:  phone.Display != "",
-			},
-			Type: sql.NullString{
-				String: phone.Type,
-				Valid:  phone.Type != "",
-			},
-			Value: phone.Value,
+			ID:      phoneId.String(),
+			UserID:  userId,
+			Display: nullString(phone.DisplayName),
+			Type:    nullString(phone.Type),
+			Value:   phone.Value,
 			PrimaryPhoneNumber: sql.NullBool{
 				Bool:  phone.Primary,
 				Valid: true,
 			},
 		}
-		err = s.repo.CreateUserPhoneNumber(ctx, param)
+		err = repo.CreateUserPhoneNumber(ctx, param)
 		if err != nil {
 			slog.Error("failed to create user phone", "error", err, "phone",
-				phone, "userId", userCreateResp)
+				phone, "userId", userId)
 		}
 	}
+}
 
-	createdUser, err := s.repo.GetScimUserById(ctx, repository.GetScimUserByIdParams{
-		Organisationid: organisationId,
-		ID:             userCreateResp,
-	})
-
+// enqueue records a change of a user in the change log and queues it for the
+// targets of its organisation. deactivates marks a replace that deactivates
+// the user.
+func (s *service) enqueue(ctx context.Context, repo repository.Querier, operation target.Operation, user scimUserDto, deactivates bool) error {
+	resource, err := json.Marshal(ScimUserResponse(user))
 	if err != nil {
-		return scimUserDto{}, fmt.Errorf("failed to GetScimUserById: %w", err)
+		return fmt.Errorf("failed to marshal user for targets: %w", err)
 	}
 
-	userEmails, err := s.repo.GetUserEmails(ctx, userCreateResp)
-	if err != nil {
-		slog.Error("failed to GetUserEmails", "error", err, "userId", userCreateResp)
+	event := target.Event{
+		OrganisationID: user.OrganisationID,
+		ResourceType:   target.ResourceUser,
+		ResourceID:     user.ID,
+		Operation:      operation,
+		Resource:       resource,
+		Deactivates:    deactivates,
 	}
-
-	userPhoneNumbers, err := s.repo.GetUserPhoneNumbers(ctx, userCreateResp)
-	if err != nil {
-		slog.Error("failed to GetUserPhoneNumbers", "error", err, "userId", userCreateResp)
+	if err := changes.Record(ctx, repo, event); err != nil {
+		return err
 	}
+	return s.dispatcher.Enqueue(ctx, repo, event)
+}
 
-	userDto := newScimUserDto(createdUser, userEmails, userPhoneNumbers)
-
-	return userDto, nil
+// NewResourceLoader returns a loader for the SCIM representation of stored
+// users, for the packages that can't depend on this one.
+func NewResourceLoader(repo repository.Querier) target.ResourceLoader {
+	s := &service{repo: repo}
+	return func(ctx context.Context, organisationId, id string) (json.RawMessage, error) {
+		user, err := s.GetUser(ctx, organisationId, id)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(ScimUserResponse(user))
+	}
 }
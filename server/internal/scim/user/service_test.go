@@ -0,0 +1,161 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/database/databasetest"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/scim"
+	"github.com/jawee/scimtiplexer/internal/target"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestService(t *testing.T) (*service, repository.Querier) {
+	db := databasetest.New(t)
+	repo := db.GetRepository()
+	return &service{repo: repo, db: db, dispatcher: target.NewDispatcher(repo, nil)}, repo
+}
+
+func createTestUser(t *testing.T, s *service, source, body string) scimUserDto {
+	var req UserCreateRequest
+	require.NoError(t, json.Unmarshal([]byte(body), &req))
+	user, err := s.CreateUser(context.Background(), "org-1", source, req, json.RawMessage(body))
+	require.NoError(t, err)
+	return user
+}
+
+func patchOperations(t *testing.T, operations string) []scim.PatchOperation {
+	ops, err := scim.ParsePatch([]byte(`{"schemas": ["` + scim.SchemaPatchOp + `"], "Operations": ` + operations + `}`))
+	require.NoError(t, err)
+	return ops
+}
+
+// userChanges returns the operations of the user changes recorded for the
+// targets.
+func userChanges(t *testing.T, repo repository.Querier) []string {
+	changes, err := repo.GetChangesSince(context.Background(), repository.GetChangesSinceParams{Organisationid: "org-1", Limit: 100})
+	require.NoError(t, err)
+	var operations []string
+	for _, change := range changes {
+		operations = append(operations, change.Operation)
+	}
+	return operations
+}
+
+func TestPatchUser(t *testing.T) {
+	s, repo := newTestService(t)
+	ctx := context.Background()
+	created := createTestUser(t, s, "hr", `{"userName": "alice", "active": true, "title": "Engineer", "name": {"givenName": "Alice", "familyName": "Smith"}}`)
+
+	user, err := s.PatchUser(ctx, "org-1", "hr", created.ID, patchOperations(t, `[
+		{"op": "Replace", "path": "active", "value": "False"},
+		{"op": "replace", "path": "name.familyName", "value": "Jones"},
+		{"op": "remove", "path": "title"}]`))
+
+	require.NoError(t, err)
+	assert.False(t, user.Active)
+	assert.Equal(t, "Alice", user.NameGivenName)
+	assert.Equal(t, "Jones", user.NameFamilyName)
+	assert.Empty(t, user.Title)
+
+	identity, err := repo.GetUserIdentity(ctx, repository.GetUserIdentityParams{ID: created.ID, Organisationid: "org-1"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"userName": "alice", "active": false, "name": {"givenName": "Alice", "familyName": "Jones"}}`, identity.Resource.String)
+	assert.Equal(t, []string{"create", "replace"}, userChanges(t, repo))
+}
+
+func TestPatchUserWithoutChanges(t *testing.T) {
+	s, repo := newTestService(t)
+	created := createTestUser(t, s, "hr", `{"userName": "alice", "active": true, "title": "Engineer"}`)
+
+	_, err := s.PatchUser(context.Background(), "org-1", "hr", created.ID, patchOperations(t, `[{"op": "replace", "path": "title", "value": "Engineer"}]`))
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"create"}, userChanges(t, repo), "nothing is queued for the targets")
+}
+
+func TestPatchUserErrors(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+	created := createTestUser(t, s, "hr", `{"userName": "alice", "active": true}`)
+
+	_, err := s.PatchUser(ctx, "org-1", "hr", "nobody", patchOperations(t, `[{"op": "remove", "path": "title"}]`))
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = s.PatchUser(ctx, "org-1", "hr", created.ID, patchOperations(t, `[{"op": "remove", "path": "userName"}]`))
+	assert.ErrorIs(t, err, errInvalidRequest)
+
+	_, err = s.PatchUser(ctx, "org-1", "hr", created.ID, patchOperations(t, `[{"op": "replace", "path": "active", "value": "maybe"}]`))
+	assert.ErrorIs(t, err, errInvalidRequest)
+
+	_, err = s.PatchUser(ctx, "org-1", "hr", created.ID, patchOperations(t, `[{"op": "replace", "path": "emails[type eq].value", "value": "x"}]`))
+	var patchErr *scim.PatchError
+	require.ErrorAs(t, err, &patchErr)
+	assert.Equal(t, "invalidFilter", patchErr.ScimType)
+}
+
+func TestDeleteUser(t *testing.T) {
+	s, repo := newTestService(t)
+	ctx := context.Background()
+	created := createTestUser(t, s, "hr", `{"userName": "alice", "active": true}`)
+	now := time.Now().UTC()
+	require.NoError(t, repo.CreateUserIdentity(ctx, repository.CreateUserIdentityParams{
+		ID:             "alice-crm",
+		Organisationid: "org-1",
+		Userid:         created.ID,
+		Source:         sql.NullString{String: "crm", Valid: true},
+		Createdonutc:   now,
+		Modifiedonutc:  now,
+	}))
+
+	require.NoError(t, s.DeleteUser(ctx, "org-1", created.ID))
+
+	_, err := s.GetUser(ctx, "org-1", created.ID)
+	assert.ErrorIs(t, err, sql.ErrNoRows, "the identity is gone")
+	user, err := s.GetUser(ctx, "org-1", "alice-crm")
+	require.NoError(t, err, "the user stays while another source has it")
+	assert.Equal(t, "alice", user.UserName)
+	assert.Equal(t, []string{"create"}, userChanges(t, repo))
+
+	require.NoError(t, s.DeleteUser(ctx, "org-1", "alice-crm"))
+
+	_, err = repo.GetScimUserById(ctx, repository.GetScimUserByIdParams{ID: created.ID, Organisationid: "org-1"})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.Equal(t, []string{"create", "delete"}, userChanges(t, repo))
+	assert.ErrorIs(t, s.DeleteUser(ctx, "org-1", "alice-crm"), sql.ErrNoRows)
+}
+
+func TestGetAllUsersUsesIdentityIdsOfSource(t *testing.T) {
+	s, repo := newTestService(t)
+	ctx := context.Background()
+	alice := createTestUser(t, s, "hr", `{"userName": "alice", "active": true}`)
+	bob := createTestUser(t, s, "hr", `{"userName": "bob", "active": true}`)
+	now := time.Now().UTC()
+	require.NoError(t, repo.CreateUserIdentity(ctx, repository.CreateUserIdentityParams{
+		ID:             "alice-crm",
+		Organisationid: "org-1",
+		Userid:         alice.ID,
+		Source:         sql.NullString{String: "crm", Valid: true},
+		Createdonutc:   now,
+		Modifiedonutc:  now,
+	}))
+
+	ids := func(source string) map[string]string {
+		users, err := s.GetAllUsers(ctx, "org-1", source)
+		require.NoError(t, err)
+		result := make(map[string]string)
+		for _, user := range users {
+			result[user.UserName] = user.ID
+		}
+		return result
+	}
+
+	assert.Equal(t, map[string]string{"alice": "alice-crm", "bob": bob.ID}, ids("crm"))
+	assert.Equal(t, map[string]string{"alice": alice.ID, "bob": bob.ID}, ids("hr"))
+	assert.Equal(t, map[string]string{"alice": alice.ID, "bob": bob.ID}, ids(""))
+}
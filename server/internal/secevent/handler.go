@@ -0,0 +1,188 @@
+// Package secevent serves the security event tokens of set targets that
+// deliver by polling, RFC 8936.
+package secevent
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/scim/auth"
+	"github.com/jawee/scimtiplexer/internal/target"
+	"github.com/jawee/scimtiplexer/internal/token"
+)
+
+const (
+	// defaultMaxEvents is how many tokens are returned when the request
+	// doesn't say, maxMaxEvents is the most that are returned.
+	defaultMaxEvents = 100
+	maxMaxEvents     = 1000
+	// longPollTimeout is how long a request that doesn't return immediately
+	// waits for tokens.
+	longPollTimeout  = 30 * time.Second
+	longPollInterval = time.Second
+)
+
+type handler struct {
+	repo repository.Querier
+}
+
+func RegisterEndpoints(mux *http.ServeMux, repo repository.Querier, authenticator *auth.Authenticator) {
+	h := &handler{repo: repo}
+
+	slog.Debug("Registering security event endpoints")
+	for _, prefix := range []string{"/scim/v2/", "/scim/{orgSlug}/v2/"} {
+		mux.Handle("POST "+prefix+"Events/{streamId}", authenticator.ScimEndpointAuth(token.ScopeEventsRead, http.HandlerFunc(h.handlePoll)))
+	}
+}
+
+// PollRequest acknowledges received tokens and asks for more, RFC 8936
+// section 2.4. Tokens the receiver failed to process are reported in SetErrs
+// and aren't delivered again.
+type PollRequest struct {
+	Ack               []string            `json:"ack"`
+	SetErrs           map[string]SetError `json:"setErrs"`
+	MaxEvents         *int                `json:"maxEvents"`
+	ReturnImmediately bool                `json:"returnImmediately"`
+}
+
+type SetError struct {
+	Err         string `json:"err"`
+	Description string `json:"description"`
+}
+
+// PollResponse holds the tokens by jti.
+type PollResponse struct {
+	Sets          map[string]string `json:"sets"`
+	MoreAvailable bool              `json:"moreAvailable,omitempty"`
+}
+
+// handlePoll serves the tokens of a stream, the set target with the id
+// streamId. Without returnImmediately the request waits a while for tokens
+// if there are none.
+func (h *handler) handlePoll(w http.ResponseWriter, r *http.Request) {
+	organisationId, ok := r.Context().Value("orgid").(string)
+	if !ok || organisationId == "" {
+		slog.Error("Organisation ID not found in context")
+		writeError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	streamId := r.PathValue("streamId")
+	t, err := h.repo.GetTargetById(r.Context(), repository.GetTargetByIdParams{
+		ID:             streamId,
+		Organisationid: organisationId,
+	})
+	if err != nil || t.Type != target.TypeSet {
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			slog.Error("failed to GetTargetById", "error", err, "streamId", streamId)
+			writeError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+			return
+		}
+		writeError(w, http.StatusNotFound, "not_found", "Event stream not found")
+		return
+	}
+
+	var req PollRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid request body")
+		return
+	}
+	maxEvents := defaultMaxEvents
+	if req.MaxEvents != nil {
+		maxEvents = min(max(*req.MaxEvents, 0), maxMaxEvents)
+	}
+
+	if err := h.acknowledge(r.Context(), streamId, req); err != nil {
+		slog.Error("Failed to acknowledge security events", "error", err, "streamId", streamId)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	// The long poll outlasts the write timeout of the server.
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(longPollTimeout + 10*time.Second))
+
+	resp, err := h.poll(r.Context(), streamId, maxEvents, !req.ReturnImmediately)
+	if err != nil {
+		slog.Error("Failed to get security events", "error", err, "streamId", streamId)
+		writeError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// poll returns up to maxEvents tokens of the stream. If wait is set and
+// there are none, it checks again until there are or the long poll times out.
+func (h *handler) poll(ctx context.Context, streamId string, maxEvents int, wait bool) (PollResponse, error) {
+	resp := PollResponse{Sets: map[string]string{}}
+	if maxEvents == 0 {
+		return resp, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, longPollTimeout)
+	defer cancel()
+	for {
+		events, err := h.repo.GetSecurityEvents(ctx, repository.GetSecurityEventsParams{
+			Targetid: streamId,
+			Limit:    int64(maxEvents + 1),
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return resp, nil
+			}
+			return PollResponse{}, fmt.Errorf("failed to GetSecurityEvents: %w", err)
+		}
+		for i, event := range events {
+			if i == maxEvents {
+				resp.MoreAvailable = true
+				break
+			}
+			resp.Sets[event.Jti] = event.Token
+		}
+		if len(resp.Sets) > 0 || !wait {
+			return resp, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return resp, nil
+		case <-time.After(longPollInterval):
+		}
+	}
+}
+
+// acknowledge removes the tokens the receiver is done with.
+func (h *handler) acknowledge(ctx context.Context, streamId string, req PollRequest) error {
+	for jti, setErr := range req.SetErrs {
+		slog.Warn("Security event rejected by receiver", "streamId", streamId, "jti", jti, "err", setErr.Err, "description", setErr.Description)
+		req.Ack = append(req.Ack, jti)
+	}
+	for _, jti := range req.Ack {
+		err := h.repo.DeleteSecurityEvent(ctx, repository.DeleteSecurityEventParams{
+			Jti:      jti,
+			Targetid: streamId,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeError writes an error response in the format of RFC 8935 section 2.3.
+func writeError(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, map[string]string{"err": code, "description": description})
+}
@@ -3,7 +3,25 @@ package server
 import (
 	"log/slog"
 	"net/http"
+
+	"github.com/jawee/scimtiplexer/internal/admin"
+	"github.com/jawee/scimtiplexer/internal/changes"
+	"github.com/jawee/scimtiplexer/internal/clientcert"
+	"github.com/jawee/scimtiplexer/internal/correlation"
+	"github.com/jawee/scimtiplexer/internal/issuer"
+	"github.com/jawee/scimtiplexer/internal/metrics"
+	"github.com/jawee/scimtiplexer/internal/oauth"
+	"github.com/jawee/scimtiplexer/internal/oidc"
+	"github.com/jawee/scimtiplexer/internal/organisation"
+	"github.com/jawee/scimtiplexer/internal/ratelimit"
+	"github.com/jawee/scimtiplexer/internal/scim/auth"
+	scimgroup "github.com/jawee/scimtiplexer/internal/scim/group"
+	"github.com/jawee/scimtiplexer/internal/scim/serviceprovider"
 	scimuser "github.com/jawee/scimtiplexer/internal/scim/user"
+	"github.com/jawee/scimtiplexer/internal/secevent"
+	"github.com/jawee/scimtiplexer/internal/sources"
+	"github.com/jawee/scimtiplexer/internal/target"
+	"github.com/jawee/scimtiplexer/internal/token"
 )
 
 func (s *Server) RegisterRoutes() http.Handler {
@@ -11,7 +29,36 @@ func (s *Server) RegisterRoutes() http.Handler {
 
 	// s.registerScimEndpoints(mux)
 
-	scimuser.RegisterEndpoints(mux, s.db.GetRepository())
+	repo := s.db.GetRepository()
+	tokenIssuer := oauth.NewTokenIssuer(repo)
+	verifier := issuer.NewVerifier(repo)
+	certVerifier := clientcert.NewVerifier(repo)
+	limiter := ratelimit.NewLimiter(repo)
+	scimAuth := auth.NewAuthenticator(repo, tokenIssuer, verifier, certVerifier, limiter)
+	adminAuth := admin.NewAuthenticator(repo)
+	api := admin.NewAPI(mux, adminAuth)
+	s.dispatcher = target.NewDispatcher(repo, tokenIssuer)
+	s.reconciler = target.NewReconciler(repo, s.dispatcher, scimuser.NewResourceLoader(repo))
+	s.backfiller = target.NewBackfiller(s.db, repo, s.dispatcher, scimuser.NewResourceLoader(repo))
+
+	scimuser.RegisterEndpoints(mux, repo, s.db, scimAuth, api, s.dispatcher)
+	scimgroup.RegisterEndpoints(mux, repo, s.db, scimAuth, s.dispatcher)
+	serviceprovider.RegisterEndpoints(mux, s.clientCertificates)
+
+	admin.RegisterEndpoints(api)
+	oidc.RegisterEndpoints(api, adminAuth, s.db, repo)
+	organisation.RegisterEndpoints(api, s.db, repo)
+	token.RegisterEndpoints(api, repo)
+	oauth.RegisterEndpoints(mux, api, repo, tokenIssuer)
+	issuer.RegisterEndpoints(api, repo)
+	clientcert.RegisterEndpoints(api, repo)
+	target.RegisterEndpoints(api, s.db, repo, s.dispatcher, s.reconciler, s.backfiller, scimuser.NewResourceLoader(repo))
+	secevent.RegisterEndpoints(mux, repo, scimAuth)
+	changes.RegisterEndpoints(api, repo)
+	sources.RegisterEndpoints(api, repo)
+	correlation.RegisterEndpoints(api, s.db, repo)
+	ratelimit.RegisterEndpoints(api, repo, limiter)
+	metrics.RegisterEndpoints(mux)
 
 	return s.corsMiddleware(s.loggingMiddleware(mux))
 }
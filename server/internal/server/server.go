@@ -1,22 +1,43 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strconv"
 	"time"
 
 	"github.com/jawee/scimtiplexer/internal/database"
+	"github.com/jawee/scimtiplexer/internal/target"
+	"github.com/jawee/scimtiplexer/internal/utils"
 	_ "github.com/joho/godotenv/autoload"
 )
 
 type Server struct {
-	port int
-	db   database.Service
+	*http.Server
+
+	port       int
+	db         database.Service
+	dispatcher *target.Dispatcher
+	reconciler *target.Reconciler
+	backfiller *target.Backfiller
+
+	// clientCertificates is set when TLS is enabled and clients may
+	// authenticate to the SCIM endpoints with a certificate.
+	clientCertificates bool
 }
 
-func NewServer() *http.Server {
+// NewServer creates the HTTP server, starts delivering queued events to
+// targets, reconciling targets on their schedule and resuming backfills.
+// When TLS_CERT_FILE and TLS_KEY_FILE are set, TLSConfig is set and the
+// server should be started with ListenAndServeTLS. TLS_CLIENT_AUTH=true
+// additionally requests a client certificate, which is verified per
+// organisation by the SCIM authenticator.
+func NewServer() *Server {
 	port, _ := strconv.Atoi(os.Getenv("PORT"))
 	NewServer := &Server{
 		port: port,
@@ -24,13 +45,66 @@ func NewServer() *http.Server {
 		db: database.New(),
 	}
 
-	server := &http.Server{
+	tlsConfig := newTLSConfig()
+	NewServer.clientCertificates = tlsConfig != nil && tlsConfig.ClientAuth != tls.NoClientCert
+
+	NewServer.Server = &http.Server{
 		Addr:         fmt.Sprintf(":%d", NewServer.port),
 		Handler:      NewServer.RegisterRoutes(),
+		TLSConfig:    tlsConfig,
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
 
-	return server
+	NewServer.dispatcher.Start()
+	NewServer.reconciler.Start()
+	NewServer.backfiller.Start()
+
+	return NewServer
+}
+
+// Shutdown stops accepting requests and waits for the requests in flight,
+// then for the backfills, reconciliations and target deliveries in flight,
+// within the deadline of ctx. Undelivered events stay in the outbox, and
+// backfills resume after the next start.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.Server.Shutdown(ctx)
+	if backfillErr := s.backfiller.Shutdown(ctx); backfillErr != nil {
+		slog.Error("Target backfills did not finish before shutdown", "error", backfillErr)
+	}
+	if reconcileErr := s.reconciler.Shutdown(ctx); reconcileErr != nil {
+		slog.Error("Target reconciliations did not finish before shutdown", "error", reconcileErr)
+	}
+	if dispatchErr := s.dispatcher.Shutdown(ctx); dispatchErr != nil {
+		slog.Error("Target deliveries did not finish before shutdown", "error", dispatchErr)
+	}
+	return err
+}
+
+func newTLSConfig() *tls.Config {
+	certFile := os.Getenv(utils.EnvTLSCertFile)
+	keyFile := os.Getenv(utils.EnvTLSKeyFile)
+	if certFile == "" && keyFile == "" {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		log.Fatalf("failed to load TLS certificate: %v", err)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	// The trusted client CAs are configured per organisation, so the chain
+	// can't be verified during the handshake.
+	if clientAuth, _ := strconv.ParseBool(os.Getenv(utils.EnvTLSClientAuth)); clientAuth {
+		config.ClientAuth = tls.RequestClientCert
+	}
+
+	slog.Info("TLS enabled", "clientCertificates", config.ClientAuth != tls.NoClientCert)
+	return config
 }
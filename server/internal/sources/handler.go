@@ -0,0 +1,160 @@
+// Package sources merges the writes of the inbound sources of an
+// organisation. Each organisation token writes as a named source, and
+// attribute policies decide which sources may write an attribute and which
+// one wins. The source and time of the last change of every user attribute
+// is kept, so the merged user can be explained.
+package sources
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/admin"
+	"github.com/jawee/scimtiplexer/internal/repository"
+)
+
+type handler struct {
+	service *service
+}
+
+func RegisterEndpoints(api *admin.API, repo repository.Querier) {
+	h := &handler{
+		service: &service{repo: repo},
+	}
+
+	slog.Debug("Registering source endpoints")
+	api.Member("GET", "/orgs/{orgId}/attribute-policies", h.handleGetPolicies, admin.Operation{
+		Summary:  "List the attribute policies of an organisation",
+		Response: []PolicyResponse{},
+	})
+	api.Member("PUT", "/orgs/{orgId}/attribute-policies/{attribute}", h.handlePutPolicy, admin.Operation{
+		Summary:  "Set the sources allowed to write an attribute",
+		Request:  PolicyRequest{},
+		Response: PolicyResponse{},
+	})
+	api.Member("DELETE", "/orgs/{orgId}/attribute-policies/{attribute}", h.handleDeletePolicy, admin.Operation{
+		Summary: "Remove the policy of an attribute",
+		Status:  http.StatusNoContent,
+	})
+	api.Member("GET", "/orgs/{orgId}/users/{id}/provenance", h.handleGetProvenance, admin.Operation{
+		Summary:  "Get the sources that last changed the attributes of a user",
+		Response: []ProvenanceResponse{},
+	})
+}
+
+// PolicyResponse describes the policy of an attribute. Sources are ordered
+// by precedence, highest first.
+type PolicyResponse struct {
+	Attribute     string    `json:"attribute"`
+	Sources       []string  `json:"sources"`
+	OnConflict    string    `json:"onConflict"`
+	CreatedOnUtc  time.Time `json:"createdOnUtc"`
+	ModifiedOnUtc time.Time `json:"modifiedOnUtc"`
+	ModifiedBy    string    `json:"modifiedBy,omitempty"`
+}
+
+func newPolicyResponse(policy Policy) PolicyResponse {
+	return PolicyResponse{
+		Attribute:     policy.Attribute,
+		Sources:       policy.Sources,
+		OnConflict:    policy.Conflict,
+		CreatedOnUtc:  policy.CreatedOnUtc,
+		ModifiedOnUtc: policy.ModifiedOnUtc,
+		ModifiedBy:    policy.ModifiedBy,
+	}
+}
+
+// PolicyRequest sets the policy of an attribute. Only the listed sources may
+// write it, and a source may not change a value written by a source listed
+// before it. OnConflict is what happens to writes that aren't allowed: keep
+// (the default) ignores them, reject fails the request, and overwrite allows
+// every listed source to write regardless of order.
+type PolicyRequest struct {
+	Sources    []string `json:"sources"`
+	OnConflict string   `json:"onConflict"`
+}
+
+// ProvenanceResponse is the source that last changed an attribute of a user.
+// Source is left out for changes by credentials without a source.
+type ProvenanceResponse struct {
+	Attribute     string    `json:"attribute"`
+	Source        string    `json:"source,omitempty"`
+	ModifiedOnUtc time.Time `json:"modifiedOnUtc"`
+}
+
+func (h *handler) handleGetPolicies(w http.ResponseWriter, r *http.Request) {
+	policies, err := h.service.GetPolicies(r.Context(), r.PathValue("orgId"))
+	if err != nil {
+		slog.Error("Failed to get attribute policies", "error", err)
+		admin.WriteError(w, http.StatusInternalServerError, "Failed to get attribute policies")
+		return
+	}
+
+	resp := make([]PolicyResponse, len(policies))
+	for i, policy := range policies {
+		resp[i] = newPolicyResponse(policy)
+	}
+	admin.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (h *handler) handlePutPolicy(w http.ResponseWriter, r *http.Request) {
+	var req PolicyRequest
+	if !admin.ReadJSON(w, r, &req) {
+		return
+	}
+
+	policy, err := h.service.SetPolicy(r.Context(), r.PathValue("orgId"), admin.UserID(r.Context()), r.PathValue("attribute"), req)
+	if err != nil {
+		writeServiceError(w, err, "Failed to set attribute policy")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusOK, newPolicyResponse(policy))
+}
+
+func (h *handler) handleDeletePolicy(w http.ResponseWriter, r *http.Request) {
+	err := h.service.DeletePolicy(r.Context(), r.PathValue("orgId"), r.PathValue("attribute"))
+	if err != nil {
+		writeServiceError(w, err, "Failed to delete attribute policy")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) handleGetProvenance(w http.ResponseWriter, r *http.Request) {
+	provenance, err := h.service.GetUserProvenance(r.Context(), r.PathValue("orgId"), r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, err, "Failed to get provenance")
+		return
+	}
+
+	resp := make([]ProvenanceResponse, len(provenance))
+	for i, p := range provenance {
+		resp[i] = ProvenanceResponse{
+			Attribute:     p.Attribute,
+			Source:        p.Source,
+			ModifiedOnUtc: p.ModifiedOnUtc,
+		}
+	}
+	admin.WriteJSON(w, http.StatusOK, resp)
+}
+
+func writeServiceError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		admin.WriteError(w, http.StatusNotFound, "Attribute policy not found")
+		return
+	case errors.Is(err, errUserNotFound):
+		admin.WriteError(w, http.StatusNotFound, "User not found")
+		return
+	case errors.Is(err, errInvalidRequest):
+		admin.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	slog.Error(message, "error", err)
+	admin.WriteError(w, http.StatusInternalServerError, message)
+}
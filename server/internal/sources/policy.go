@@ -0,0 +1,189 @@
+package sources
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/repository"
+)
+
+// What happens when a source writes an attribute it may not, or one last
+// written by a source with precedence over it.
+const (
+	// ConflictKeep keeps the current value and ignores the write.
+	ConflictKeep = "keep"
+	// ConflictOverwrite lets every listed source write, the last write wins.
+	ConflictOverwrite = "overwrite"
+	// ConflictReject fails the request.
+	ConflictReject = "reject"
+)
+
+// Attributes are the user attributes policies are set for and provenance is
+// kept of. Sub-attributes of name are separate attributes, multi-valued
+// attributes are written as a whole.
+var Attributes = []string{
+	"externalId",
+	"userName",
+	"displayName",
+	"nickName",
+	"profileUrl",
+	"title",
+	"userType",
+	"preferredLanguage",
+	"locale",
+	"timezone",
+	"active",
+	"name.formatted",
+	"name.familyName",
+	"name.givenName",
+	"name.middleName",
+	"name.honorificPrefix",
+	"name.honorificSuffix",
+	"emails",
+	"phoneNumbers",
+	"employeeNumber",
+	"organization",
+	"department",
+	"division",
+	"costCenter",
+	"manager",
+}
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// ValidateName checks that a source name is lower case letters, digits,
+// dashes and underscores.
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid source %q, must be lower case letters, digits, - and _", name)
+	}
+	return nil
+}
+
+// Policy decides which sources may write an attribute. Sources are ordered by
+// precedence, highest first.
+type Policy struct {
+	Attribute     string
+	Sources       []string
+	Conflict      string
+	CreatedOnUtc  time.Time
+	ModifiedOnUtc time.Time
+	ModifiedBy    string
+}
+
+func newPolicy(policy repository.AttributePolicy) Policy {
+	return Policy{
+		Attribute:     policy.Attribute,
+		Sources:       strings.Fields(policy.Sources),
+		Conflict:      policy.OnConflict,
+		CreatedOnUtc:  policy.CreatedOnUtc,
+		ModifiedOnUtc: policy.ModifiedOnUtc,
+		ModifiedBy:    policy.ModifiedBy.String,
+	}
+}
+
+// Policies are the policies of an organisation by attribute. Attributes
+// without a policy are written by every source, the last write wins.
+type Policies map[string]Policy
+
+// LoadPolicies returns the attribute policies of an organisation.
+func LoadPolicies(ctx context.Context, repo repository.Querier, organisationId string) (Policies, error) {
+	policies, err := repo.GetAttributePolicies(ctx, organisationId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetAttributePolicies: %w", err)
+	}
+
+	p := Policies{}
+	for _, policy := range policies {
+		p[policy.Attribute] = newPolicy(policy)
+	}
+	return p, nil
+}
+
+// ConflictError is returned for a write that a policy rejects.
+type ConflictError struct {
+	Attribute string
+	Source    string
+	Owner     string
+}
+
+func (e *ConflictError) Error() string {
+	source := e.Source
+	if source == "" {
+		source = "requests without a source"
+	}
+	if e.Owner != "" {
+		return fmt.Sprintf("%s is owned by %s and can't be changed by %s", e.Attribute, e.Owner, source)
+	}
+	return fmt.Sprintf("%s can't be changed by %s", e.Attribute, source)
+}
+
+// Resolve reports whether source may change an attribute that owner changed
+// last. owner is empty for attributes that have never been written. Writes
+// that aren't allowed under a reject policy return a ConflictError.
+func (p Policies) Resolve(attribute, source, owner string) (bool, error) {
+	policy, ok := p[attribute]
+	if !ok {
+		return true, nil
+	}
+
+	rank := slices.Index(policy.Sources, source)
+	allowed := rank >= 0
+	if allowed && policy.Conflict != ConflictOverwrite {
+		// Owners that are no longer listed have lost their precedence.
+		ownerRank := slices.Index(policy.Sources, owner)
+		allowed = ownerRank < 0 || rank <= ownerRank
+	}
+	if allowed {
+		return true, nil
+	}
+	if policy.Conflict == ConflictReject {
+		return false, &ConflictError{Attribute: attribute, Source: source, Owner: owner}
+	}
+	return false, nil
+}
+
+// Provenance is the source that last changed an attribute, and when.
+type Provenance struct {
+	Attribute     string
+	Source        string
+	ModifiedOnUtc time.Time
+}
+
+// GetProvenance returns the provenance of the attributes of a user by
+// attribute.
+func GetProvenance(ctx context.Context, repo repository.Querier, userId string) (map[string]Provenance, error) {
+	rows, err := repo.GetUserAttributeSources(ctx, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetUserAttributeSources: %w", err)
+	}
+
+	provenance := make(map[string]Provenance, len(rows))
+	for _, row := range rows {
+		provenance[row.Attribute] = Provenance{
+			Attribute:     row.Attribute,
+			Source:        row.Source.String,
+			ModifiedOnUtc: row.ModifiedOnUtc,
+		}
+	}
+	return provenance, nil
+}
+
+// SetProvenance records that source changed an attribute of a user.
+func SetProvenance(ctx context.Context, repo repository.Querier, userId, attribute, source string, now time.Time) error {
+	err := repo.UpsertUserAttributeSource(ctx, repository.UpsertUserAttributeSourceParams{
+		Userid:        userId,
+		Attribute:     attribute,
+		Source:        sql.NullString{String: source, Valid: source != ""},
+		Modifiedonutc: now,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to UpsertUserAttributeSource: %w", err)
+	}
+	return nil
+}
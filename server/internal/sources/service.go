@@ -0,0 +1,130 @@
+package sources
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/repository"
+)
+
+type service struct {
+	repo repository.Querier
+}
+
+var (
+	errInvalidRequest = errors.New("invalid request")
+	errUserNotFound   = errors.New("user not found")
+)
+
+func (s *service) GetPolicies(ctx context.Context, organisationId string) ([]Policy, error) {
+	policies, err := s.repo.GetAttributePolicies(ctx, organisationId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetAttributePolicies: %w", err)
+	}
+
+	dtos := make([]Policy, len(policies))
+	for i, policy := range policies {
+		dtos[i] = newPolicy(policy)
+	}
+	return dtos, nil
+}
+
+// SetPolicy creates or replaces the policy of an attribute.
+func (s *service) SetPolicy(ctx context.Context, organisationId, userId, attribute string, req PolicyRequest) (Policy, error) {
+	if !slices.Contains(Attributes, attribute) {
+		return Policy{}, fmt.Errorf("%w: unknown attribute %q, must be one of %s", errInvalidRequest, attribute, strings.Join(Attributes, ", "))
+	}
+	if len(req.Sources) == 0 {
+		return Policy{}, fmt.Errorf("%w: sources is required", errInvalidRequest)
+	}
+	for i, source := range req.Sources {
+		if err := ValidateName(source); err != nil {
+			return Policy{}, fmt.Errorf("%w: %w", errInvalidRequest, err)
+		}
+		if slices.Contains(req.Sources[:i], source) {
+			return Policy{}, fmt.Errorf("%w: source %q is listed twice", errInvalidRequest, source)
+		}
+	}
+	switch req.OnConflict {
+	case "":
+		req.OnConflict = ConflictKeep
+	case ConflictKeep, ConflictOverwrite, ConflictReject:
+	default:
+		return Policy{}, fmt.Errorf("%w: onConflict must be keep, overwrite or reject", errInvalidRequest)
+	}
+
+	now := time.Now().UTC()
+	err := s.repo.UpsertAttributePolicy(ctx, repository.UpsertAttributePolicyParams{
+		Organisationid: organisationId,
+		Attribute:      attribute,
+		Sources:        strings.Join(req.Sources, " "),
+		Onconflict:     req.OnConflict,
+		Createdonutc:   now,
+		Modifiedonutc:  now,
+		Modifiedby:     sql.NullString{String: userId, Valid: true},
+	})
+	if err != nil {
+		return Policy{}, fmt.Errorf("failed to UpsertAttributePolicy: %w", err)
+	}
+
+	policy, err := s.repo.GetAttributePolicy(ctx, repository.GetAttributePolicyParams{
+		Organisationid: organisationId,
+		Attribute:      attribute,
+	})
+	if err != nil {
+		return Policy{}, fmt.Errorf("failed to GetAttributePolicy: %w", err)
+	}
+	return newPolicy(policy), nil
+}
+
+func (s *service) DeletePolicy(ctx context.Context, organisationId, attribute string) error {
+	_, err := s.repo.GetAttributePolicy(ctx, repository.GetAttributePolicyParams{
+		Organisationid: organisationId,
+		Attribute:      attribute,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.DeleteAttributePolicy(ctx, repository.DeleteAttributePolicyParams{
+		Organisationid: organisationId,
+		Attribute:      attribute,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to DeleteAttributePolicy: %w", err)
+	}
+	return nil
+}
+
+// GetUserProvenance returns the provenance of the attributes of a user,
+// ordered by attribute.
+func (s *service) GetUserProvenance(ctx context.Context, organisationId, userId string) ([]Provenance, error) {
+	_, err := s.repo.GetScimUserById(ctx, repository.GetScimUserByIdParams{
+		Organisationid: organisationId,
+		ID:             userId,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errUserNotFound
+		}
+		return nil, fmt.Errorf("failed to GetScimUserById: %w", err)
+	}
+
+	provenance, err := GetProvenance(ctx, s.repo, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	dtos := []Provenance{}
+	for _, attribute := range Attributes {
+		if p, ok := provenance[attribute]; ok {
+			dtos = append(dtos, p)
+		}
+	}
+	return dtos, nil
+}
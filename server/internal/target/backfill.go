@@ -0,0 +1,517 @@
+package target
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jawee/scimtiplexer/internal/database"
+	"github.com/jawee/scimtiplexer/internal/repository"
+)
+
+const (
+	// backfillPageSize is how many resources are sent to a target at a time.
+	backfillPageSize = 100
+	// backfillMaxPending is how many events may wait in the outbox of a
+	// target before the next page is written, so a backfill goes at the pace
+	// the target is delivered to.
+	backfillMaxPending = 2 * backfillPageSize
+	// backfillWait is how long a backfill waits for the outbox of its target
+	// to drain.
+	backfillWait = time.Second
+)
+
+// Backfill statuses. A running backfill that a restart interrupted resumes
+// when the server starts again.
+const (
+	BackfillRunning   = "running"
+	BackfillPaused    = "paused"
+	BackfillCompleted = "completed"
+	BackfillCancelled = "cancelled"
+	BackfillFailed    = "failed"
+)
+
+var (
+	errBackfilling    = errors.New("target already has a backfill in progress")
+	errBackfillStatus = errors.New("backfill can't be changed")
+	errTargetDisabled = fmt.Errorf("%w: target is disabled", errInvalidRequest)
+	errTargetDeleted  = errors.New("target was deleted")
+)
+
+// Backfiller sends every local user and group to a target, such as a new
+// one or one whose mapping changed, which would otherwise only see the
+// changes made from then on. Resources are read a page at a time in id
+// order, and the progress is stored with every page so a backfill can be
+// paused, and resumes where it was after a restart. Pages are written to the
+// outbox of the target like changes, and only while it's keeping up, so the
+// rate limits of the target apply.
+type Backfiller struct {
+	db         database.Transactor
+	repo       repository.Querier
+	dispatcher *Dispatcher
+	users      ResourceLoader
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+
+	// ctx is cancelled when shutdown runs out of time, aborting the pages in
+	// progress.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	running map[string]bool
+	stopped bool
+}
+
+// NewBackfiller creates a backfiller. Pages are written with dispatcher, and
+// users loads the local users.
+func NewBackfiller(db database.Transactor, repo repository.Querier, dispatcher *Dispatcher, users ResourceLoader) *Backfiller {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Backfiller{
+		db:         db,
+		repo:       repo,
+		dispatcher: dispatcher,
+		users:      users,
+		stop:       make(chan struct{}),
+		ctx:        ctx,
+		cancel:     cancel,
+		running:    make(map[string]bool),
+	}
+}
+
+// Start resumes the backfills that were running when the server stopped.
+func (b *Backfiller) Start() {
+	backfills, err := b.repo.GetRunningTargetBackfills(b.ctx)
+	if err != nil {
+		slog.Error("failed to GetRunningTargetBackfills", "error", err)
+		return
+	}
+	for _, job := range backfills {
+		slog.Info("Resuming backfill of target", "targetid", job.TargetID, "backfillid", job.ID)
+		if err := b.run(job); err != nil {
+			slog.Error("Failed to resume backfill", "error", err, "backfillid", job.ID)
+		}
+	}
+}
+
+// Shutdown stops the backfills after the page they are sending, they are
+// resumed by the next start. Pages still in progress when ctx is done are
+// aborted and sent again.
+func (b *Backfiller) Shutdown(ctx context.Context) error {
+	b.mu.Lock()
+	b.stopped = true
+	b.mu.Unlock()
+	close(b.stop)
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Backfill starts a backfill of a target and returns its id. userId is who
+// started it.
+func (b *Backfiller) Backfill(ctx context.Context, t repository.Target, userId string) (string, error) {
+	if err := b.check(ctx, t.ID, t.Enabled); err != nil {
+		return "", err
+	}
+
+	users, err := b.repo.CountScimUsers(ctx, t.OrganisationID)
+	if err != nil {
+		return "", fmt.Errorf("failed to CountScimUsers: %w", err)
+	}
+	groups, err := b.repo.CountScimGroups(ctx, t.OrganisationID)
+	if err != nil {
+		return "", fmt.Errorf("failed to CountScimGroups: %w", err)
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return "", errors.New("failed to generate UUID for new backfill")
+	}
+	now := time.Now().UTC()
+	job := repository.TargetBackfill{
+		ID:             id.String(),
+		OrganisationID: t.OrganisationID,
+		TargetID:       t.ID,
+		Status:         BackfillRunning,
+		Phase:          ResourceUser,
+		TotalUsers:     users,
+		TotalGroups:    groups,
+		CreatedBy:      sql.NullString{String: userId, Valid: userId != ""},
+		StartedOnUtc:   now,
+		ModifiedOnUtc:  now,
+	}
+	err = b.repo.CreateTargetBackfill(ctx, repository.CreateTargetBackfillParams{
+		ID:             job.ID,
+		Organisationid: job.OrganisationID,
+		Targetid:       job.TargetID,
+		Status:         job.Status,
+		Phase:          job.Phase,
+		Totalusers:     job.TotalUsers,
+		Totalgroups:    job.TotalGroups,
+		Createdby:      job.CreatedBy,
+		Startedonutc:   job.StartedOnUtc,
+		Modifiedonutc:  job.ModifiedOnUtc,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to CreateTargetBackfill: %w", err)
+	}
+
+	slog.Info("Backfilling target", "targetid", t.ID, "backfillid", job.ID, "users", users, "groups", groups)
+	return job.ID, b.run(job)
+}
+
+// check returns an error if a backfill of a target can't be started, as it's
+// disabled or already has a backfill in progress.
+func (b *Backfiller) check(ctx context.Context, targetId string, enabled bool) error {
+	if !enabled {
+		return errTargetDisabled
+	}
+	_, err := b.repo.GetActiveTargetBackfill(ctx, targetId)
+	if err == nil {
+		return errBackfilling
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to GetActiveTargetBackfill: %w", err)
+	}
+	return nil
+}
+
+// Pause stops a running backfill after the page it's sending.
+func (b *Backfiller) Pause(ctx context.Context, job repository.TargetBackfill) error {
+	return b.setStatus(ctx, job, BackfillRunning, BackfillPaused)
+}
+
+// Resume continues a paused backfill where it was.
+func (b *Backfiller) Resume(ctx context.Context, job repository.TargetBackfill) error {
+	// Held while the backfill is started, so a backfill that is stopping
+	// after being paused isn't taken for one still running.
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stopped {
+		return errStopping
+	}
+	if err := b.setStatus(ctx, job, BackfillPaused, BackfillRunning); err != nil {
+		return err
+	}
+	b.start(job)
+	return nil
+}
+
+// Cancel ends a running or paused backfill. The events it already wrote to
+// the outbox are still delivered.
+func (b *Backfiller) Cancel(ctx context.Context, job repository.TargetBackfill) error {
+	now := time.Now().UTC()
+	rows, err := b.repo.CompleteTargetBackfill(ctx, repository.CompleteTargetBackfillParams{
+		Status:         BackfillCancelled,
+		Completedonutc: now,
+		ID:             job.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to CompleteTargetBackfill: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("%w: backfill is %s", errBackfillStatus, job.Status)
+	}
+	return nil
+}
+
+func (b *Backfiller) setStatus(ctx context.Context, job repository.TargetBackfill, current, status string) error {
+	rows, err := b.repo.SetTargetBackfillStatus(ctx, repository.SetTargetBackfillStatusParams{
+		Status:        status,
+		Modifiedonutc: time.Now().UTC(),
+		ID:            job.ID,
+		Currentstatus: current,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to SetTargetBackfillStatus: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("%w: backfill is %s", errBackfillStatus, job.Status)
+	}
+	return nil
+}
+
+// run starts sending the pages of a backfill in the background.
+func (b *Backfiller) run(job repository.TargetBackfill) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stopped {
+		return errStopping
+	}
+	b.start(job)
+	return nil
+}
+
+// start starts a backfill unless it's already running. b.mu must be held.
+func (b *Backfiller) start(job repository.TargetBackfill) {
+	if b.running[job.ID] {
+		return
+	}
+	b.running[job.ID] = true
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		b.backfill(job)
+	}()
+}
+
+// forget marks a backfill as no longer running.
+func (b *Backfiller) forget(id string) {
+	b.mu.Lock()
+	delete(b.running, id)
+	b.mu.Unlock()
+}
+
+// proceed returns the current state of a backfill if it should send its
+// next page. It's forgotten otherwise, in the same critical section, so a
+// resume starts it again.
+func (b *Backfiller) proceed(job repository.TargetBackfill) (repository.TargetBackfill, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	select {
+	case <-b.stop:
+		delete(b.running, job.ID)
+		return job, false
+	default:
+	}
+
+	current, err := b.repo.GetTargetBackfill(b.ctx, repository.GetTargetBackfillParams{
+		ID:             job.ID,
+		Targetid:       job.TargetID,
+		Organisationid: job.OrganisationID,
+	})
+	if err != nil || current.Status != BackfillRunning {
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			slog.Error("failed to GetTargetBackfill", "error", err, "backfillid", job.ID)
+		}
+		delete(b.running, job.ID)
+		return job, false
+	}
+	return current, true
+}
+
+// backfill sends the pages of a backfill until it's done, paused, cancelled
+// or the server stops.
+func (b *Backfiller) backfill(job repository.TargetBackfill) {
+	for {
+		current, ok := b.proceed(job)
+		if !ok {
+			return
+		}
+		job = current
+
+		done, err := b.step(job)
+		if err != nil && b.ctx.Err() != nil {
+			// Shutdown aborted the page, it's sent again after the next
+			// start.
+			b.forget(job.ID)
+			return
+		}
+		if err == nil && !done {
+			continue
+		}
+
+		params := repository.CompleteTargetBackfillParams{
+			Status:         BackfillCompleted,
+			Completedonutc: time.Now().UTC(),
+			ID:             job.ID,
+		}
+		if err != nil {
+			slog.Warn("Failed to backfill target", "error", err, "targetid", job.TargetID, "backfillid", job.ID)
+			params.Status = BackfillFailed
+			params.Error = sql.NullString{String: err.Error(), Valid: true}
+		} else {
+			slog.Info("Backfilled target", "targetid", job.TargetID, "backfillid", job.ID,
+				"users", job.ProcessedUsers, "groups", job.ProcessedGroups, "queued", job.Queued)
+		}
+		if _, err := b.repo.CompleteTargetBackfill(b.ctx, params); err != nil {
+			slog.Error("failed to CompleteTargetBackfill", "error", err, "backfillid", job.ID)
+		}
+		b.forget(job.ID)
+		return
+	}
+}
+
+// step sends the next page of a backfill to its target and reports whether
+// there was nothing left to send. It sends nothing while the outbox of the
+// target is full or the target is disabled.
+func (b *Backfiller) step(job repository.TargetBackfill) (bool, error) {
+	ctx := b.ctx
+	t, err := b.repo.GetTargetById(ctx, repository.GetTargetByIdParams{
+		ID:             job.TargetID,
+		Organisationid: job.OrganisationID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, errTargetDeleted
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to GetTargetById: %w", err)
+	}
+
+	if t.Mode == ModeLive {
+		counts, err := b.repo.CountTargetOutboxEvents(ctx, repository.CountTargetOutboxEventsParams{
+			Targetid:       t.ID,
+			Organisationid: t.OrganisationID,
+		})
+		if err != nil {
+			return false, fmt.Errorf("failed to CountTargetOutboxEvents: %w", err)
+		}
+		pending := int64(0)
+		for _, c := range counts {
+			if c.Status == StatusPending {
+				pending = c.Count
+			}
+		}
+		if !t.Enabled || pending >= backfillMaxPending {
+			b.wait()
+			return false, nil
+		}
+	}
+
+	events, last, err := b.page(ctx, job)
+	if err != nil {
+		return false, err
+	}
+	if len(events) == 0 {
+		if job.Phase == ResourceGroup {
+			return true, nil
+		}
+		job.Phase = ResourceGroup
+		job.LastResourceID = ""
+		return false, b.saveProgress(ctx, b.repo, job)
+	}
+
+	err = b.db.WithTx(ctx, func(repo repository.Querier) error {
+		for _, event := range events {
+			sent, err := sendToTarget(ctx, repo, t, event)
+			if err != nil {
+				return err
+			}
+			if sent {
+				job.Queued++
+			}
+		}
+		if job.Phase == ResourceUser {
+			job.ProcessedUsers += int64(len(events))
+		} else {
+			job.ProcessedGroups += int64(len(events))
+		}
+		job.LastResourceID = last
+		return b.saveProgress(ctx, repo, job)
+	})
+	if err != nil {
+		return false, err
+	}
+	b.dispatcher.Notify()
+	return false, nil
+}
+
+// page returns the events of the next page of resources of a backfill, and
+// the id of the last resource of the page.
+func (b *Backfiller) page(ctx context.Context, job repository.TargetBackfill) ([]Event, string, error) {
+	event := func(resourceType, id string, resource json.RawMessage) Event {
+		return Event{
+			OrganisationID: job.OrganisationID,
+			ResourceType:   resourceType,
+			ResourceID:     id,
+			Operation:      OperationReplace,
+			Resource:       resource,
+		}
+	}
+
+	var events []Event
+	if job.Phase == ResourceUser {
+		ids, err := b.repo.GetScimUserIdsAfter(ctx, repository.GetScimUserIdsAfterParams{
+			Organisationid: job.OrganisationID,
+			After:          job.LastResourceID,
+			Limit:          backfillPageSize,
+		})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to GetScimUserIdsAfter: %w", err)
+		}
+		if len(ids) == 0 {
+			return nil, "", nil
+		}
+		for _, id := range ids {
+			resource, err := b.users(ctx, job.OrganisationID, id)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to load user: %w", err)
+			}
+			events = append(events, event(ResourceUser, id, resource))
+		}
+		return events, ids[len(ids)-1], nil
+	}
+
+	groups, err := b.repo.GetScimGroupsAfter(ctx, repository.GetScimGroupsAfterParams{
+		Organisationid: job.OrganisationID,
+		After:          job.LastResourceID,
+		Limit:          backfillPageSize,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to GetScimGroupsAfter: %w", err)
+	}
+	if len(groups) == 0 {
+		return nil, "", nil
+	}
+	for _, g := range groups {
+		members, err := b.repo.GetGroupMembers(ctx, g.ID)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to GetGroupMembers: %w", err)
+		}
+		resource, err := GroupResource(g, members)
+		if err != nil {
+			return nil, "", err
+		}
+		events = append(events, event(ResourceGroup, g.ID, resource))
+	}
+	return events, groups[len(groups)-1].ID, nil
+}
+
+func (b *Backfiller) saveProgress(ctx context.Context, repo repository.Querier, job repository.TargetBackfill) error {
+	err := repo.UpdateTargetBackfillProgress(ctx, repository.UpdateTargetBackfillProgressParams{
+		Phase:           job.Phase,
+		Lastresourceid:  job.LastResourceID,
+		Processedusers:  job.ProcessedUsers,
+		Processedgroups: job.ProcessedGroups,
+		Queued:          job.Queued,
+		Modifiedonutc:   time.Now().UTC(),
+		ID:              job.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to UpdateTargetBackfillProgress: %w", err)
+	}
+	return nil
+}
+
+// wait waits for the outbox of a target to drain, or for shutdown.
+func (b *Backfiller) wait() {
+	timer := time.NewTimer(backfillWait)
+	defer timer.Stop()
+	select {
+	case <-b.stop:
+	case <-timer.C:
+	}
+}
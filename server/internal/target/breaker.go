@@ -0,0 +1,234 @@
+package target
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jawee/scimtiplexer/internal/repository"
+)
+
+// Held batch statuses.
+const (
+	BatchOpen      = "open"
+	BatchApproved  = "approved"
+	BatchDiscarded = "discarded"
+)
+
+const (
+	// minThresholdWindow and maxThresholdWindow bound the window deletions
+	// and deactivations are counted in.
+	minThresholdWindow = time.Minute
+	maxThresholdWindow = 7 * 24 * time.Hour
+)
+
+// MassChangeError rejects a deletion or deactivation while the changes of
+// its organisation are held and its threshold rejects them. RetryAfter is
+// when the client should try again.
+type MassChangeError struct {
+	RetryAfter time.Duration
+}
+
+func (e *MassChangeError) Error() string {
+	return "too many users were deleted or deactivated, changes are held until they are reviewed"
+}
+
+var errBatchResolved = errors.New("held batch is already resolved")
+
+// destructive reports whether an event deletes or deactivates a user.
+func destructive(event Event) bool {
+	return event.ResourceType == ResourceUser && (event.Operation == OperationDelete || event.Deactivates)
+}
+
+// hold applies the mass change threshold of the organisation of an event.
+// Deletions and deactivations are counted, and once the window holds more
+// than the threshold allows a batch is opened. The events of the
+// organisation are held in the open batch instead of being sent to its
+// targets until the batch is approved or discarded. It reports whether the
+// event was held.
+func hold(ctx context.Context, repo repository.Querier, event Event) (bool, error) {
+	batch, err := repo.GetOpenHeldBatch(ctx, event.OrganisationID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("failed to GetOpenHeldBatch: %w", err)
+	}
+	open := err == nil
+
+	if destructive(event) {
+		threshold, err := repo.GetMassChangeThreshold(ctx, event.OrganisationID)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			return false, fmt.Errorf("failed to GetMassChangeThreshold: %w", err)
+		case open && threshold.Reject:
+			return false, &MassChangeError{RetryAfter: time.Duration(threshold.WindowSeconds) * time.Second}
+		case !open:
+			if batch, open, err = countMassChange(ctx, repo, threshold, event); err != nil {
+				return false, err
+			}
+		}
+	}
+	if !open {
+		return false, nil
+	}
+
+	err = repo.CreateHeldEvent(ctx, repository.CreateHeldEventParams{
+		Batchid:        batch.ID,
+		Organisationid: event.OrganisationID,
+		Resourcetype:   event.ResourceType,
+		Resourceid:     event.ResourceID,
+		Operation:      string(event.Operation),
+		Resource:       sql.NullString{String: string(event.Resource), Valid: len(event.Resource) > 0},
+		Deactivates:    event.Deactivates,
+		Createdonutc:   time.Now().UTC(),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to CreateHeldEvent: %w", err)
+	}
+	if err := repo.IncrementHeldBatchEvents(ctx, batch.ID); err != nil {
+		return false, fmt.Errorf("failed to IncrementHeldBatchEvents: %w", err)
+	}
+	return true, nil
+}
+
+// countMassChange counts a deletion or deactivation, and opens a batch when
+// the threshold is exceeded. Nothing is counted while the threshold is
+// suspended.
+func countMassChange(ctx context.Context, repo repository.Querier, threshold repository.MassChangeThreshold, event Event) (repository.HeldBatch, bool, error) {
+	now := time.Now().UTC()
+	if threshold.SuspendedUntil.Valid && now.Before(threshold.SuspendedUntil.Time) {
+		return repository.HeldBatch{}, false, nil
+	}
+
+	err := repo.CreateMassChange(ctx, repository.CreateMassChangeParams{
+		Organisationid: event.OrganisationID,
+		Resourceid:     event.ResourceID,
+		Operation:      string(event.Operation),
+		Createdonutc:   now,
+	})
+	if err != nil {
+		return repository.HeldBatch{}, false, fmt.Errorf("failed to CreateMassChange: %w", err)
+	}
+
+	window := time.Duration(threshold.WindowSeconds) * time.Second
+	changes, err := repo.CountMassChanges(ctx, repository.CountMassChangesParams{
+		Organisationid: event.OrganisationID,
+		Since:          now.Add(-window),
+	})
+	if err != nil {
+		return repository.HeldBatch{}, false, fmt.Errorf("failed to CountMassChanges: %w", err)
+	}
+	users, err := repo.CountScimUsers(ctx, event.OrganisationID)
+	if err != nil {
+		return repository.HeldBatch{}, false, fmt.Errorf("failed to CountScimUsers: %w", err)
+	}
+	if !exceeds(threshold, changes, users) {
+		return repository.HeldBatch{}, false, nil
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return repository.HeldBatch{}, false, errors.New("failed to generate UUID for new held batch")
+	}
+	batch := repository.HeldBatch{
+		ID:             id.String(),
+		OrganisationID: event.OrganisationID,
+		Status:         BatchOpen,
+		Changes:        changes,
+		Users:          users,
+		OpenedOnUtc:    now,
+	}
+	err = repo.CreateHeldBatch(ctx, repository.CreateHeldBatchParams{
+		ID:             batch.ID,
+		Organisationid: batch.OrganisationID,
+		Changes:        batch.Changes,
+		Users:          batch.Users,
+		Openedonutc:    batch.OpenedOnUtc,
+	})
+	if err != nil {
+		return repository.HeldBatch{}, false, fmt.Errorf("failed to CreateHeldBatch: %w", err)
+	}
+
+	slog.Error("Mass change threshold exceeded, holding changes back from targets", "organisationid", event.OrganisationID,
+		"batchid", batch.ID, "changes", changes, "users", users, "window", window.String())
+	return batch, true, nil
+}
+
+// exceeds reports whether the deletions and deactivations in the window
+// exceed a threshold. The percentage is of the users the organisation has
+// now.
+func exceeds(threshold repository.MassChangeThreshold, changes, users int64) bool {
+	if threshold.MaxCount.Valid && changes > threshold.MaxCount.Int64 {
+		return true
+	}
+	return threshold.MaxPercent.Valid && changes*100 > threshold.MaxPercent.Int64*users
+}
+
+// release resolves the open batch of an organisation. Approved events are
+// sent to the targets as if they had just happened, and the threshold is
+// suspended for a window so the rest of the change goes through. Discarded
+// events are dropped, the changes stay in the local state but the targets
+// never see them. Counting starts over either way.
+func release(ctx context.Context, repo repository.Querier, organisationId, userId, id, status string) error {
+	rows, err := repo.ResolveHeldBatch(ctx, repository.ResolveHeldBatchParams{
+		Status:         status,
+		Resolvedby:     sql.NullString{String: userId, Valid: userId != ""},
+		Resolvedonutc:  sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		ID:             id,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to ResolveHeldBatch: %w", err)
+	}
+	if rows == 0 {
+		if _, err := repo.GetHeldBatch(ctx, repository.GetHeldBatchParams{ID: id, Organisationid: organisationId}); err != nil {
+			return err
+		}
+		return errBatchResolved
+	}
+
+	if status == BatchApproved {
+		events, err := repo.GetHeldEvents(ctx, repository.GetHeldEventsParams{Batchid: id, Limit: -1})
+		if err != nil {
+			return fmt.Errorf("failed to GetHeldEvents: %w", err)
+		}
+		for _, e := range events {
+			err := fanOut(ctx, repo, Event{
+				OrganisationID: e.OrganisationID,
+				ResourceType:   e.ResourceType,
+				ResourceID:     e.ResourceID,
+				Operation:      Operation(e.Operation),
+				Resource:       []byte(e.Resource.String),
+				Deactivates:    e.Deactivates,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		threshold, err := repo.GetMassChangeThreshold(ctx, organisationId)
+		switch {
+		case err == nil:
+			err = repo.SuspendMassChangeThreshold(ctx, repository.SuspendMassChangeThresholdParams{
+				Suspendeduntil: sql.NullTime{Time: time.Now().UTC().Add(time.Duration(threshold.WindowSeconds) * time.Second), Valid: true},
+				Organisationid: organisationId,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to SuspendMassChangeThreshold: %w", err)
+			}
+		case !errors.Is(err, sql.ErrNoRows):
+			return fmt.Errorf("failed to GetMassChangeThreshold: %w", err)
+		}
+	}
+
+	if err := repo.DeleteHeldEvents(ctx, id); err != nil {
+		return fmt.Errorf("failed to DeleteHeldEvents: %w", err)
+	}
+	if err := repo.DeleteMassChanges(ctx, organisationId); err != nil {
+		return fmt.Errorf("failed to DeleteMassChanges: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,474 @@
+package target
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/utils"
+)
+
+const (
+	// deliveryTimeout bounds how long one target may take to apply an event.
+	deliveryTimeout = 30 * time.Second
+	// pollInterval is how often the outbox is checked for events that are
+	// due, in addition to the wake up after every enqueue.
+	pollInterval = time.Second
+	// pollBatchSize is how many events are read from the outbox at a time.
+	pollBatchSize = 100
+	// minBackoff and maxBackoff bound the delay between attempts.
+	minBackoff = 2 * time.Second
+	maxBackoff = time.Hour
+	// deliveredRetention is how long delivered events are kept.
+	deliveredRetention = 7 * 24 * time.Hour
+	purgeInterval      = time.Hour
+)
+
+// Outbox event statuses.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+	StatusDiscarded = "discarded"
+)
+
+// Dispatcher forwards accepted changes to the targets of the organisation
+// they belong to. Events are written to the outbox in the transaction of the
+// change and delivered by a pool of workers, so they survive restarts.
+// Events for the same target and resource are delivered in the order they
+// were written. Failed deliveries are retried with exponential backoff until
+// the attempts run out, after which the event is dead lettered. A dead
+// lettered event keeps holding back the later events of its resource until
+// it is retried or discarded, so an update never overtakes the create it
+// follows.
+//
+// Each target is delivered to through a gate that applies its rate limit,
+// holds off while it's throttling and opens its circuit after consecutive
+// failures. A target gets at most its maxInFlight of the workers, half of
+// them by default, so a slow target can't hold up the others.
+type Dispatcher struct {
+	repo        repository.Querier
+	signer      Signer
+	workers     int
+	maxAttempts int64
+
+	notify chan struct{}
+	jobs   chan delivery
+	stop   chan struct{}
+	wg     sync.WaitGroup
+
+	// ctx is cancelled when shutdown runs out of time, aborting deliveries
+	// in flight.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	inFlight map[int64]bool
+	gates    map[string]*gate
+}
+
+// delivery is an outbox event handed to a worker, with the gate of its
+// target that admitted it.
+type delivery struct {
+	event repository.OutboxEvent
+	gate  *gate
+}
+
+// NewDispatcher creates a dispatcher. signer signs the security event tokens
+// of set targets.
+func NewDispatcher(repo repository.Querier, signer Signer) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		repo:        repo,
+		signer:      signer,
+		workers:     intFromEnv(utils.EnvOutboxWorkers, 4),
+		maxAttempts: int64(intFromEnv(utils.EnvOutboxMaxAttempts, 10)),
+		notify:      make(chan struct{}, 1),
+		jobs:        make(chan delivery),
+		stop:        make(chan struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+		inFlight:    make(map[int64]bool),
+		gates:       make(map[string]*gate),
+	}
+}
+
+func intFromEnv(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		slog.Warn("Invalid number, using default", "key", key, "value", value, "default", fallback)
+		return fallback
+	}
+	return n
+}
+
+// Enqueue writes the event to the outbox of every enabled target of its
+// organisation that has the resource in scope, with the resource mapped for
+// each target. Targets in shadow mode have the operation recorded instead,
+// along with the changes their scope filters out. While the mass change
+// threshold of the organisation holds its changes back the event is held
+// instead, and deletions and deactivations may be rejected with a
+// MassChangeError. repo should be bound to the transaction that stores the
+// change, and Notify called once it has been committed.
+func (d *Dispatcher) Enqueue(ctx context.Context, repo repository.Querier, event Event) error {
+	held, err := hold(ctx, repo, event)
+	if err != nil || held {
+		return err
+	}
+	return fanOut(ctx, repo, event)
+}
+
+// fanOut writes the event to the outbox of the targets of its organisation.
+func fanOut(ctx context.Context, repo repository.Querier, event Event) error {
+	targets, err := repo.GetEnabledTargets(ctx, event.OrganisationID)
+	if err != nil {
+		return fmt.Errorf("failed to GetEnabledTargets: %w", err)
+	}
+
+	for _, t := range targets {
+		if _, err := sendToTarget(ctx, repo, t, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendToTarget writes the event to the outbox of a target if the resource is
+// in its scope, mapped for the target. It reports whether an operation was
+// written.
+func sendToTarget(ctx context.Context, repo repository.Querier, t repository.Target, event Event) (bool, error) {
+	shadow := t.Mode == ModeShadow
+	// Scopes and mappings are validated when they are saved, so errors are
+	// unexpected. The target is skipped rather than sent resources it wasn't
+	// configured for.
+	in, err := inScope(t, event)
+	if err != nil {
+		slog.Error("Failed to evaluate scope of target", "error", err, "targetId", t.ID, "resourceId", event.ResourceID)
+		if shadow {
+			return false, recordShadow(ctx, repo, t, event, false, err)
+		}
+		return false, nil
+	}
+	scoped, ok, err := scopeEvent(ctx, repo, t, event, in)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		if shadow {
+			return false, recordShadow(ctx, repo, t, event, true, nil)
+		}
+		return false, nil
+	}
+	payload, err := mapResource(t.AttributeMapping.String, scoped.ResourceType, scoped.Resource)
+	if err != nil {
+		slog.Error("Failed to map resource for target", "error", err, "targetId", t.ID, "resourceId", event.ResourceID)
+		if shadow {
+			return false, recordShadow(ctx, repo, t, scoped, false, err)
+		}
+		return false, nil
+	}
+
+	scoped.Resource = payload
+	if err := writeEvent(ctx, repo, t, scoped); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Notify wakes the dispatcher to deliver newly enqueued events.
+func (d *Dispatcher) Notify() {
+	select {
+	case d.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Start starts delivering events in the background.
+func (d *Dispatcher) Start() {
+	for range d.workers {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			for job := range d.jobs {
+				d.deliver(job)
+			}
+		}()
+	}
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.run()
+	}()
+}
+
+// Shutdown stops reading the outbox and waits for the deliveries in flight.
+// Deliveries still running when ctx is done are aborted, and retried after
+// the next start.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	close(d.stop)
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (d *Dispatcher) run() {
+	defer close(d.jobs)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	lastPurge := time.Time{}
+
+	for {
+		if time.Since(lastPurge) > purgeInterval {
+			d.purge()
+			lastPurge = time.Now()
+		}
+		if !d.poll() {
+			return
+		}
+
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		case <-d.notify:
+		}
+	}
+}
+
+// poll hands the events that are due to the workers. It returns false when
+// the dispatcher is stopping.
+func (d *Dispatcher) poll() bool {
+	targets, err := d.repo.GetReadyOutboxTargets(d.ctx, time.Now().UTC())
+	if err != nil {
+		slog.Error("failed to GetReadyOutboxTargets", "error", err)
+		return true
+	}
+
+	for _, t := range targets {
+		if !d.pollTarget(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// pollTarget hands the events of a target that are due to the workers, as
+// many as its gate admits.
+func (d *Dispatcher) pollTarget(t repository.Target) bool {
+	events, err := d.repo.GetReadyOutboxEvents(d.ctx, repository.GetReadyOutboxEventsParams{
+		Targetid: t.ID,
+		Now:      time.Now().UTC(),
+		Limit:    pollBatchSize,
+	})
+	if err != nil {
+		slog.Error("failed to GetReadyOutboxEvents", "error", err, "targetid", t.ID)
+		return true
+	}
+
+	g := d.gate(t)
+	for _, event := range events {
+		d.mu.Lock()
+		busy := d.inFlight[event.ID]
+		d.mu.Unlock()
+		if busy {
+			continue
+		}
+		if !g.admit(time.Now()) {
+			return true
+		}
+
+		d.mu.Lock()
+		d.inFlight[event.ID] = true
+		d.mu.Unlock()
+		select {
+		case d.jobs <- delivery{event: event, gate: g}:
+		case <-d.stop:
+			g.abandon()
+			d.done(event.ID)
+			return false
+		}
+	}
+	return true
+}
+
+func (d *Dispatcher) done(id int64) {
+	d.mu.Lock()
+	delete(d.inFlight, id)
+	d.mu.Unlock()
+}
+
+func (d *Dispatcher) purge() {
+	err := d.repo.DeleteDeliveredOutboxEvents(d.ctx, sql.NullTime{Time: time.Now().UTC().Add(-deliveredRetention), Valid: true})
+	if err != nil {
+		slog.Error("failed to DeleteDeliveredOutboxEvents", "error", err)
+	}
+	err = d.repo.DeleteOldTargetShadowOperations(d.ctx, time.Now().UTC().Add(-shadowRetention))
+	if err != nil {
+		slog.Error("failed to DeleteOldTargetShadowOperations", "error", err)
+	}
+	// No threshold counts further back than the longest window.
+	err = d.repo.DeleteOldMassChanges(d.ctx, time.Now().UTC().Add(-maxThresholdWindow))
+	if err != nil {
+		slog.Error("failed to DeleteOldMassChanges", "error", err)
+	}
+	d.forgetIdleGates()
+}
+
+func (d *Dispatcher) deliver(job delivery) {
+	event := job.event
+	defer d.done(event.ID)
+	// The next event of the resource may be waiting for this one.
+	defer d.Notify()
+
+	err := d.apply(event, job.gate)
+	job.gate.done(event.TargetID, err)
+	// The outcome is recorded even when shutdown aborted the delivery.
+	ctx := context.WithoutCancel(d.ctx)
+	now := time.Now().UTC()
+
+	if err == nil {
+		err := d.repo.MarkOutboxEventDelivered(ctx, repository.MarkOutboxEventDeliveredParams{
+			Deliveredonutc: sql.NullTime{Time: now, Valid: true},
+			ID:             event.ID,
+		})
+		if err != nil {
+			slog.Error("failed to MarkOutboxEventDelivered", "error", err, "eventid", event.ID)
+		}
+		slog.Debug("Delivered event to target", "eventid", event.ID, "targetid", event.TargetID,
+			"resourceType", event.ResourceType, "resourceId", event.ResourceID, "operation", event.Operation)
+		return
+	}
+
+	// A throttled delivery is retried once the target allows it, without
+	// using up an attempt.
+	var throttled *ThrottledError
+	if errors.As(err, &throttled) {
+		slog.Info("Target throttled delivery of event", "eventid", event.ID, "targetid", event.TargetID,
+			"status", throttled.Status, "retryafter", throttled.RetryAfter.String())
+		err = d.repo.MarkOutboxEventFailed(ctx, repository.MarkOutboxEventFailedParams{
+			Status:           StatusPending,
+			Attempts:         event.Attempts,
+			Nextattemptonutc: now.Add(throttled.RetryAfter),
+			Lasterror:        sql.NullString{String: throttled.Error(), Valid: true},
+			ID:               event.ID,
+		})
+		if err != nil {
+			slog.Error("failed to MarkOutboxEventFailed", "error", err, "eventid", event.ID)
+		}
+		return
+	}
+
+	attempts := event.Attempts + 1
+	status := StatusPending
+	if attempts >= d.maxAttempts || errors.Is(err, ErrPermanent) {
+		status = StatusDead
+	}
+
+	slog.Warn("Failed to deliver event to target", "error", err, "eventid", event.ID, "targetid", event.TargetID,
+		"resourceType", event.ResourceType, "resourceId", event.ResourceID, "operation", event.Operation,
+		"attempts", attempts, "status", status)
+
+	err = d.repo.MarkOutboxEventFailed(ctx, repository.MarkOutboxEventFailedParams{
+		Status:           status,
+		Attempts:         attempts,
+		Nextattemptonutc: now.Add(backoff(attempts)),
+		Lasterror:        sql.NullString{String: err.Error(), Valid: true},
+		ID:               event.ID,
+	})
+	if err != nil {
+		slog.Error("failed to MarkOutboxEventFailed", "error", err, "eventid", event.ID)
+	}
+}
+
+func (d *Dispatcher) apply(event repository.OutboxEvent, g *gate) error {
+	t, err := d.repo.GetTargetById(d.ctx, repository.GetTargetByIdParams{
+		ID:             event.TargetID,
+		Organisationid: event.OrganisationID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to GetTargetById: %w", err)
+	}
+
+	connector, err := newConnector(t, connectorDeps{
+		repo:      d.repo,
+		signer:    d.signer,
+		transport: &gateTransport{gate: g, base: http.DefaultTransport},
+	})
+	if err != nil {
+		return fmt.Errorf("%w: invalid target config: %w", ErrPermanent, err)
+	}
+
+	ctx, cancel := context.WithTimeout(d.ctx, deliveryTimeout)
+	defer cancel()
+
+	return connector.Apply(ctx, Event{
+		OrganisationID: event.OrganisationID,
+		ResourceType:   event.ResourceType,
+		ResourceID:     event.ResourceID,
+		Operation:      Operation(event.Operation),
+		Resource:       json.RawMessage(event.Payload.String),
+		Sequence:       event.ID,
+		CreatedOnUtc:   event.CreatedOnUtc,
+	})
+}
+
+// backoff is the delay before the next attempt, doubling with every attempt
+// with some jitter so failed events don't retry in lockstep.
+func backoff(attempts int64) time.Duration {
+	delay := maxBackoff
+	if attempts < 32 {
+		delay = min(minBackoff<<(attempts-1), maxBackoff)
+	}
+	jitter := time.Duration(rand.Int64N(int64(delay) / 5))
+	return delay - delay/10 + jitter
+}
+
+// previousResource returns the resource as it was sent to a target with the
+// event before this one, or nil if that isn't known, such as for new
+// resources or once the previous event has been purged.
+func previousResource(ctx context.Context, repo repository.Querier, targetId string, event Event) (json.RawMessage, error) {
+	previous, err := repo.GetPreviousOutboxEvent(ctx, repository.GetPreviousOutboxEventParams{
+		Targetid:     targetId,
+		Resourcetype: event.ResourceType,
+		Resourceid:   event.ResourceID,
+		ID:           event.Sequence,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetPreviousOutboxEvent: %w", err)
+	}
+	if !previous.Payload.Valid {
+		return nil, nil
+	}
+	return json.RawMessage(previous.Payload.String), nil
+}
@@ -0,0 +1,360 @@
+package target
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/repository"
+)
+
+// Circuit states of a target. An open circuit sends the target nothing until
+// the cooldown has passed, after which it's half open and a single delivery
+// probes whether the target has recovered.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+const (
+	// breakerFailures is the number of consecutive failed deliveries that
+	// opens the circuit of a target, and breakerCooldown how long it stays
+	// open.
+	breakerFailures = 5
+	breakerCooldown = time.Minute
+	// defaultRetryAfter is how long a target that answers 429 without a
+	// Retry-After header is left alone.
+	defaultRetryAfter = 30 * time.Second
+	// gateIdle is how long the state of a target that isn't delivered to is
+	// kept.
+	gateIdle = 24 * time.Hour
+)
+
+// ThrottledError is returned for requests a target answered with 429, or
+// with 503 and a Retry-After header. Nothing is sent to the target until
+// RetryAfter has passed, and the event is retried then without counting the
+// attempt.
+type ThrottledError struct {
+	Status     int
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("target returned %d, retrying after %s", e.Status, e.RetryAfter)
+}
+
+// gate limits the deliveries to one target. It holds the rate limit,
+// concurrency and circuit breaker state of the target, which is kept in
+// memory and starts over when the server restarts.
+type gate struct {
+	mu          sync.Mutex
+	rateLimit   float64
+	maxInFlight int
+	inFlight    int
+	tokens      float64
+	refilled    time.Time
+
+	state          string
+	failures       int
+	openedOn       time.Time
+	probing        bool
+	throttledUntil time.Time
+
+	lastSuccess time.Time
+	lastFailure time.Time
+	lastError   string
+	lastUsed    time.Time
+}
+
+// gate returns the gate of a target, updated with its current limits.
+func (d *Dispatcher) gate(t repository.Target) *gate {
+	d.mu.Lock()
+	g, ok := d.gates[t.ID]
+	if !ok {
+		g = &gate{state: CircuitClosed, refilled: time.Now()}
+		d.gates[t.ID] = g
+	}
+	d.mu.Unlock()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.rateLimit = t.RateLimit.Float64
+	g.maxInFlight = max(1, d.workers/2)
+	if t.MaxInFlight.Valid {
+		g.maxInFlight = int(t.MaxInFlight.Int64)
+	}
+	if !ok {
+		g.tokens = g.burst()
+	}
+	return g
+}
+
+// forgetIdleGates drops the state of targets that haven't been delivered to
+// for a while, such as deleted ones.
+func (d *Dispatcher) forgetIdleGates() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, g := range d.gates {
+		g.mu.Lock()
+		idle := g.inFlight == 0 && g.state == CircuitClosed && time.Since(g.lastUsed) > gateIdle
+		g.mu.Unlock()
+		if idle {
+			delete(d.gates, id)
+		}
+	}
+}
+
+// burst is the number of requests that may be sent at once after the target
+// has been idle.
+func (g *gate) burst() float64 {
+	return max(1, g.rateLimit)
+}
+
+func (g *gate) refill(now time.Time) {
+	if g.rateLimit <= 0 {
+		return
+	}
+	g.tokens = min(g.burst(), g.tokens+now.Sub(g.refilled).Seconds()*g.rateLimit)
+	g.refilled = now
+}
+
+// admit reports whether an event may be delivered to the target now, and
+// counts it as in flight if so. Once the cooldown of an open circuit has
+// passed the circuit is half open and the event admitted is the probe.
+func (g *gate) admit(now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if now.Before(g.throttledUntil) || g.inFlight >= g.maxInFlight {
+		return false
+	}
+	switch g.state {
+	case CircuitOpen:
+		if now.Sub(g.openedOn) < breakerCooldown {
+			return false
+		}
+		g.state = CircuitHalfOpen
+		g.probing = true
+	case CircuitHalfOpen:
+		if g.probing {
+			return false
+		}
+		g.probing = true
+	}
+	// The token is taken when the request is sent, workers aren't handed
+	// events only to wait for one.
+	g.refill(now)
+	if g.rateLimit > 0 && g.tokens < 1 {
+		if g.state == CircuitHalfOpen {
+			g.probing = false
+		}
+		return false
+	}
+
+	g.inFlight++
+	g.lastUsed = now
+	return true
+}
+
+// wait takes a token, waiting for one if the rate limit has been used up.
+func (g *gate) wait(ctx context.Context) error {
+	for {
+		g.mu.Lock()
+		now := time.Now()
+		g.refill(now)
+		if g.rateLimit <= 0 || g.tokens >= 1 {
+			if g.rateLimit > 0 {
+				g.tokens--
+			}
+			g.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - g.tokens) / g.rateLimit * float64(time.Second))
+		g.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// abandon takes back the admission of an event that wasn't delivered.
+func (g *gate) abandon() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.inFlight--
+	if g.state == CircuitHalfOpen {
+		g.probing = false
+	}
+}
+
+// transport returns the transport the connectors of a target send their
+// requests with.
+func (d *Dispatcher) transport(t repository.Target) http.RoundTripper {
+	return &gateTransport{gate: d.gate(t), base: http.DefaultTransport}
+}
+
+// throttle leaves the target alone for a while.
+func (g *gate) throttle(retryAfter time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if until := time.Now().Add(retryAfter); until.After(g.throttledUntil) {
+		g.throttledUntil = until
+	}
+}
+
+// done records the outcome of a delivery. Deliveries the target rejected as
+// invalid show it's up and don't count towards opening the circuit, and
+// throttled ones count neither way.
+func (g *gate) done(targetId string, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	g.inFlight--
+	g.lastUsed = now
+	probe := g.state == CircuitHalfOpen && g.probing
+	if probe {
+		g.probing = false
+	}
+
+	if err != nil {
+		g.lastFailure = now
+		g.lastError = err.Error()
+	}
+	var throttled *ThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		return
+	case err == nil || errors.Is(err, ErrPermanent):
+		if err == nil {
+			g.lastSuccess = now
+		}
+		if g.state != CircuitClosed {
+			slog.Info("Circuit of target closed", "targetid", targetId)
+			g.state = CircuitClosed
+		}
+		g.failures = 0
+		return
+	}
+
+	g.failures++
+	switch {
+	case probe:
+		g.state = CircuitOpen
+		g.openedOn = now
+		slog.Warn("Circuit of target opened again, probe failed", "targetid", targetId, "error", err)
+	case g.state == CircuitClosed && g.failures >= breakerFailures:
+		g.state = CircuitOpen
+		g.openedOn = now
+		slog.Warn("Circuit of target opened", "targetid", targetId, "failures", g.failures, "cooldown", breakerCooldown.String(), "error", err)
+	}
+}
+
+// gateTransport sends the requests of a connector through the gate of its
+// target, waiting for the rate limit and turning throttling responses into
+// a ThrottledError.
+type gateTransport struct {
+	gate *gate
+	base http.RoundTripper
+}
+
+func (t *gateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.gate.wait(req.Context()); err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"))
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		if !ok {
+			retryAfter = defaultRetryAfter
+		}
+	case resp.StatusCode == http.StatusServiceUnavailable && ok:
+	default:
+		return resp, nil
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	resp.Body.Close()
+
+	retryAfter = min(retryAfter, maxBackoff)
+	t.gate.throttle(retryAfter)
+	return nil, &ThrottledError{Status: resp.StatusCode, RetryAfter: retryAfter}
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of
+// seconds or an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(0, time.Until(date)), true
+	}
+	return 0, false
+}
+
+// targetHealth is the delivery state of a target.
+type targetHealth struct {
+	State               string
+	ConsecutiveFailures int
+	OpenedOn            *time.Time
+	ThrottledUntil      *time.Time
+	InFlight            int
+	MaxInFlight         int
+	RateLimit           float64
+	LastSuccess         *time.Time
+	LastFailure         *time.Time
+	LastError           string
+}
+
+// health returns the delivery state of a target. A target nothing has been
+// delivered to since the server started is healthy.
+func (d *Dispatcher) health(t repository.Target) targetHealth {
+	g := d.gate(t)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	health := targetHealth{
+		State:               g.state,
+		ConsecutiveFailures: g.failures,
+		InFlight:            g.inFlight,
+		MaxInFlight:         g.maxInFlight,
+		RateLimit:           g.rateLimit,
+		LastError:           g.lastError,
+	}
+	timeOrNil := func(t time.Time) *time.Time {
+		if t.IsZero() {
+			return nil
+		}
+		utc := t.UTC()
+		return &utc
+	}
+	if g.state != CircuitClosed {
+		health.OpenedOn = timeOrNil(g.openedOn)
+	}
+	if time.Now().Before(g.throttledUntil) {
+		health.ThrottledUntil = timeOrNil(g.throttledUntil)
+	}
+	health.LastSuccess = timeOrNil(g.lastSuccess)
+	health.LastFailure = timeOrNil(g.lastFailure)
+	return health
+}
@@ -0,0 +1,1004 @@
+package target
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/admin"
+	"github.com/jawee/scimtiplexer/internal/database"
+	"github.com/jawee/scimtiplexer/internal/repository"
+)
+
+type handler struct {
+	service    *service
+	dispatcher *Dispatcher
+}
+
+// RegisterEndpoints registers the target endpoints, and the endpoints of the
+// mass change threshold that holds changes back from them. users loads the
+// users mappings are previewed for.
+func RegisterEndpoints(api *admin.API, db database.Transactor, repo repository.Querier, dispatcher *Dispatcher, reconciler *Reconciler, backfiller *Backfiller, users ResourceLoader) {
+	h := &handler{
+		service: &service{
+			db:         db,
+			repo:       repo,
+			users:      users,
+			dispatcher: dispatcher,
+			reconciler: reconciler,
+			backfiller: backfiller,
+		},
+		dispatcher: dispatcher,
+	}
+
+	slog.Debug("Registering target endpoints")
+	api.Member("GET", "/orgs/{orgId}/targets", h.handleGetTargets, admin.Operation{
+		Summary:  "List the targets of an organisation",
+		Response: []TargetResponse{},
+	})
+	api.Member("POST", "/orgs/{orgId}/targets", h.handlePostTarget, admin.Operation{
+		Summary:  "Create a target",
+		Request:  TargetCreateRequest{},
+		Response: TargetResponse{},
+		Status:   http.StatusCreated,
+	})
+	api.Member("GET", "/orgs/{orgId}/targets/{id}", h.handleGetTarget, admin.Operation{
+		Summary:  "Get a target",
+		Response: TargetResponse{},
+	})
+	api.Member("PATCH", "/orgs/{orgId}/targets/{id}", h.handlePatchTarget, admin.Operation{
+		Summary:  "Change the configuration, mapping or scopes of a target",
+		Request:  TargetUpdateRequest{},
+		Response: TargetResponse{},
+	})
+	api.Member("DELETE", "/orgs/{orgId}/targets/{id}", h.handleDeleteTarget, admin.Operation{
+		Summary: "Delete a target",
+		Status:  http.StatusNoContent,
+	})
+	api.Member("POST", "/orgs/{orgId}/targets/{id}/preview", h.handlePreview, admin.Operation{
+		Summary:  "Preview the payload the mapping of a target produces for a user",
+		Request:  PreviewRequest{},
+		Response: json.RawMessage{},
+	})
+	api.Member("GET", "/orgs/{orgId}/targets/{id}/events", h.handleGetEvents, admin.Operation{
+		Summary:  "List the outbox events of a target",
+		Query:    []admin.Param{{Name: "status", Description: "Status of the events, dead by default"}},
+		Response: []EventResponse{},
+	})
+	api.Member("GET", "/orgs/{orgId}/targets/{id}/health", h.handleGetHealth, admin.Operation{
+		Summary:  "Get the delivery state of a target",
+		Response: HealthResponse{},
+	})
+	api.Member("POST", "/orgs/{orgId}/targets/{id}/events/{eventId}/retry", h.handleRetryEvent, admin.Operation{
+		Summary:     "Retry a dead lettered event",
+		Description: "The later events for the resource wait until the event is retried or discarded. An event that was followed by a delivered event for the same resource can't be retried, as it would send a state that is no longer current. A reconciliation repairs what it left out.",
+		Status:      http.StatusAccepted,
+	})
+	api.Member("POST", "/orgs/{orgId}/targets/{id}/events/{eventId}/discard", h.handleDiscardEvent, admin.Operation{
+		Summary:     "Discard a dead lettered event",
+		Description: "The later events for the resource are delivered without it. A reconciliation repairs what it left out.",
+		Status:      http.StatusAccepted,
+	})
+	api.Member("GET", "/orgs/{orgId}/targets/{id}/reconciliations", h.handleGetReconciliations, admin.Operation{
+		Summary:  "List the reconciliations of a target",
+		Response: []ReconciliationResponse{},
+	})
+	api.Member("POST", "/orgs/{orgId}/targets/{id}/reconciliations", h.handlePostReconciliation, admin.Operation{
+		Summary:  "Start a reconciliation of a target",
+		Request:  ReconciliationRequest{},
+		Response: ReconciliationResponse{},
+		Status:   http.StatusAccepted,
+	})
+	api.Member("GET", "/orgs/{orgId}/targets/{id}/reconciliations/{reconciliationId}", h.handleGetReconciliation, admin.Operation{
+		Summary:  "Get a reconciliation and the drift it found",
+		Response: ReconciliationResponse{},
+	})
+	api.Member("GET", "/orgs/{orgId}/targets/{id}/backfills", h.handleGetBackfills, admin.Operation{
+		Summary:  "List the backfills of a target",
+		Response: []BackfillResponse{},
+	})
+	api.Member("POST", "/orgs/{orgId}/targets/{id}/backfills", h.handlePostBackfill, admin.Operation{
+		Summary:  "Start a backfill of the users and groups of the organisation into a target",
+		Response: BackfillResponse{},
+		Status:   http.StatusAccepted,
+	})
+	api.Member("GET", "/orgs/{orgId}/targets/{id}/backfills/{backfillId}", h.handleGetBackfill, admin.Operation{
+		Summary:  "Get the progress of a backfill",
+		Response: BackfillResponse{},
+	})
+	for _, action := range []string{backfillPause, backfillResume, backfillCancel} {
+		api.Member("POST", "/orgs/{orgId}/targets/{id}/backfills/{backfillId}/"+action, h.handleChangeBackfill(action), admin.Operation{
+			Summary:  strings.ToUpper(action[:1]) + action[1:] + " a backfill",
+			Response: BackfillResponse{},
+		})
+	}
+	api.Member("GET", "/orgs/{orgId}/targets/{id}/shadow", h.handleGetShadowReport, admin.Operation{
+		Summary: "Report the operations recorded for a target in shadow mode",
+		Query: []admin.Param{
+			{Name: "limit", Description: "Maximum number of operations, 100 by default"},
+			{Name: "before", Description: "Cursor of the previous page"},
+		},
+		Response: ShadowReportResponse{},
+	})
+	api.Member("DELETE", "/orgs/{orgId}/targets/{id}/shadow", h.handleDeleteShadowOperations, admin.Operation{
+		Summary: "Clear the operations recorded for a target in shadow mode",
+		Status:  http.StatusNoContent,
+	})
+	api.Member("GET", "/orgs/{orgId}/mass-change-threshold", h.handleGetThreshold, admin.Operation{
+		Summary:  "Get the mass change threshold of an organisation",
+		Response: ThresholdResponse{},
+	})
+	api.Member("PUT", "/orgs/{orgId}/mass-change-threshold", h.handlePutThreshold, admin.Operation{
+		Summary:  "Set the mass change threshold of an organisation",
+		Request:  ThresholdRequest{},
+		Response: ThresholdResponse{},
+	})
+	api.Member("DELETE", "/orgs/{orgId}/mass-change-threshold", h.handleDeleteThreshold, admin.Operation{
+		Summary: "Remove the mass change threshold of an organisation",
+		Status:  http.StatusNoContent,
+	})
+	api.Member("GET", "/orgs/{orgId}/held-batches", h.handleGetHeldBatches, admin.Operation{
+		Summary:  "List the changes held back from the targets of an organisation",
+		Query:    []admin.Param{{Name: "status", Description: "Status of the batches, open by default"}},
+		Response: []HeldBatchResponse{},
+	})
+	api.Member("GET", "/orgs/{orgId}/held-batches/{batchId}", h.handleGetHeldBatch, admin.Operation{
+		Summary:  "Get a held batch and the oldest of its events",
+		Response: HeldBatchResponse{},
+	})
+	api.Member("POST", "/orgs/{orgId}/held-batches/{batchId}/approve", h.handleApproveHeldBatch, admin.Operation{
+		Summary:  "Send the held events to the targets",
+		Response: HeldBatchResponse{},
+	})
+	api.Member("POST", "/orgs/{orgId}/held-batches/{batchId}/discard", h.handleDiscardHeldBatch, admin.Operation{
+		Summary:  "Drop the held events",
+		Response: HeldBatchResponse{},
+	})
+}
+
+// TargetResponse describes a target. Secret config fields are left out.
+type TargetResponse struct {
+	ID                string          `json:"id"`
+	Name              string          `json:"name"`
+	Type              string          `json:"type"`
+	Config            json.RawMessage `json:"config"`
+	AttributeMapping  json.RawMessage `json:"attributeMapping,omitempty"`
+	UserScope         string          `json:"userScope,omitempty"`
+	GroupScope        string          `json:"groupScope,omitempty"`
+	DeprovisionAction string          `json:"deprovisionAction"`
+	ReconcileInterval string          `json:"reconcileInterval,omitempty"`
+	ReconcileRepair   bool            `json:"reconcileRepair"`
+	Mode              string          `json:"mode"`
+	RateLimit         float64         `json:"rateLimit,omitempty"`
+	MaxInFlight       int64           `json:"maxInFlight,omitempty"`
+	Enabled           bool            `json:"enabled"`
+	CreatedBy         string          `json:"createdBy"`
+	CreatedOnUtc      time.Time       `json:"createdOnUtc"`
+	ModifiedOnUtc     time.Time       `json:"modifiedOnUtc"`
+}
+
+func newTargetResponse(t targetDto) TargetResponse {
+	resp := TargetResponse{
+		ID:                t.ID,
+		Name:              t.Name,
+		Type:              t.Type,
+		Config:            t.Config,
+		AttributeMapping:  t.AttributeMapping,
+		UserScope:         t.UserScope,
+		GroupScope:        t.GroupScope,
+		DeprovisionAction: t.DeprovisionAction,
+		ReconcileRepair:   t.ReconcileRepair,
+		Mode:              t.Mode,
+		RateLimit:         t.RateLimit,
+		MaxInFlight:       t.MaxInFlight,
+		Enabled:           t.Enabled,
+		CreatedBy:         t.CreatedBy,
+		CreatedOnUtc:      t.CreatedOnUtc,
+		ModifiedOnUtc:     t.ModifiedOnUtc,
+	}
+	if t.ReconcileInterval > 0 {
+		resp.ReconcileInterval = t.ReconcileInterval.String()
+	}
+	return resp
+}
+
+// TargetCreateRequest creates a target. Config depends on the type, a scim
+// target takes baseUrl and bearerToken, a webhook target takes url, secret
+// and an optional format, full or patch. A set target is a stream of
+// security event tokens, it takes delivery, push or poll, an optional
+// audience, and endpointUrl and authorizationHeader for push. AttributeMapping is an optional
+// Mapping of the resources sent to the target.
+//
+// UserScope and GroupScope are SCIM filters selecting the resources sent to
+// the target, such as active eq true, all are sent without one. Resources
+// that leave the scope are disabled or deleted at the target depending on
+// DeprovisionAction, disable by default. Scopes apply to the changes made
+// after they're set. Targets are enabled unless Enabled is false.
+//
+// ReconcileInterval is a duration such as 24h after which a scim target is
+// compared with the local state again, it's only reconciled on demand
+// without one. ReconcileRepair queues the operations that correct the drift
+// found by the scheduled runs.
+//
+// Mode is live by default. A target in shadow mode is sent nothing, the
+// operations it would be sent are recorded with their mapped payload and
+// reported by the shadow endpoint, so the mapping and scopes can be checked
+// against real changes before the target is switched to live.
+//
+// RateLimit is the most requests per second sent to the target, and may be
+// a fraction such as 0.5. MaxInFlight is the most events delivered to the
+// target at once, half of the delivery workers by default. A target that
+// answers 429, or 503 with Retry-After, is sent nothing until it allows it
+// again.
+//
+// A target is only sent the changes made after it's created. Backfill starts
+// a backfill that sends it every existing user and group.
+type TargetCreateRequest struct {
+	Name              string          `json:"name"`
+	Type              string          `json:"type"`
+	Config            json.RawMessage `json:"config"`
+	AttributeMapping  json.RawMessage `json:"attributeMapping"`
+	UserScope         string          `json:"userScope"`
+	GroupScope        string          `json:"groupScope"`
+	DeprovisionAction string          `json:"deprovisionAction"`
+	ReconcileInterval string          `json:"reconcileInterval"`
+	ReconcileRepair   bool            `json:"reconcileRepair"`
+	Mode              string          `json:"mode"`
+	RateLimit         float64         `json:"rateLimit"`
+	MaxInFlight       int64           `json:"maxInFlight"`
+	Enabled           *bool           `json:"enabled"`
+	Backfill          bool            `json:"backfill"`
+}
+
+// TargetUpdateRequest changes the fields that are set. The type of a target
+// can't be changed. An attributeMapping of null removes the mapping, and an
+// empty scope or reconcileInterval, or a rateLimit or maxInFlight of 0,
+// removes it. A target switched from shadow
+// to live isn't sent the changes made while it was in shadow mode, a
+// reconciliation with repair or a backfill provisions them. Backfill starts
+// a backfill once the target is updated, such as after its mapping changed.
+type TargetUpdateRequest struct {
+	Name              *string         `json:"name"`
+	Config            json.RawMessage `json:"config"`
+	AttributeMapping  json.RawMessage `json:"attributeMapping"`
+	UserScope         *string         `json:"userScope"`
+	GroupScope        *string         `json:"groupScope"`
+	DeprovisionAction *string         `json:"deprovisionAction"`
+	ReconcileInterval *string         `json:"reconcileInterval"`
+	ReconcileRepair   *bool           `json:"reconcileRepair"`
+	Mode              *string         `json:"mode"`
+	RateLimit         *float64        `json:"rateLimit"`
+	MaxInFlight       *int64          `json:"maxInFlight"`
+	Enabled           *bool           `json:"enabled"`
+	Backfill          bool            `json:"backfill"`
+}
+
+// PreviewRequest renders the payload sent to a target for a user. An
+// AttributeMapping in the request is used instead of the target's, so a
+// mapping can be tried before it's saved.
+type PreviewRequest struct {
+	UserID           string          `json:"userId"`
+	AttributeMapping json.RawMessage `json:"attributeMapping"`
+}
+
+func (h *handler) handleGetTargets(w http.ResponseWriter, r *http.Request) {
+	targets, err := h.service.GetTargets(r.Context(), r.PathValue("orgId"))
+	if err != nil {
+		slog.Error("Failed to get targets", "error", err)
+		admin.WriteError(w, http.StatusInternalServerError, "Failed to get targets")
+		return
+	}
+
+	resp := make([]TargetResponse, len(targets))
+	for i, t := range targets {
+		resp[i] = newTargetResponse(t)
+	}
+	admin.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (h *handler) handleGetTarget(w http.ResponseWriter, r *http.Request) {
+	t, err := h.service.GetTarget(r.Context(), r.PathValue("orgId"), r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, err, "Failed to get target")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusOK, newTargetResponse(t))
+}
+
+func (h *handler) handlePostTarget(w http.ResponseWriter, r *http.Request) {
+	var req TargetCreateRequest
+	if !admin.ReadJSON(w, r, &req) {
+		return
+	}
+
+	t, err := h.service.CreateTarget(r.Context(), r.PathValue("orgId"), admin.UserID(r.Context()), req)
+	if err != nil {
+		writeServiceError(w, err, "Failed to create target")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusCreated, newTargetResponse(t))
+}
+
+func (h *handler) handlePatchTarget(w http.ResponseWriter, r *http.Request) {
+	var req TargetUpdateRequest
+	if !admin.ReadJSON(w, r, &req) {
+		return
+	}
+
+	t, err := h.service.UpdateTarget(r.Context(), r.PathValue("orgId"), admin.UserID(r.Context()), r.PathValue("id"), req)
+	if err != nil {
+		writeServiceError(w, err, "Failed to update target")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusOK, newTargetResponse(t))
+}
+
+func (h *handler) handleDeleteTarget(w http.ResponseWriter, r *http.Request) {
+	err := h.service.DeleteTarget(r.Context(), r.PathValue("orgId"), r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, err, "Failed to delete target")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) handlePreview(w http.ResponseWriter, r *http.Request) {
+	var req PreviewRequest
+	if !admin.ReadJSON(w, r, &req) {
+		return
+	}
+
+	payload, err := h.service.PreviewMapping(r.Context(), r.PathValue("orgId"), r.PathValue("id"), req)
+	if err != nil {
+		if errors.Is(err, errUserNotFound) {
+			admin.WriteError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		writeServiceError(w, err, "Failed to preview mapping")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusOK, payload)
+}
+
+// EventResponse describes an outbox event of a target.
+type EventResponse struct {
+	ID               int64      `json:"id"`
+	ResourceType     string     `json:"resourceType"`
+	ResourceID       string     `json:"resourceId"`
+	Operation        string     `json:"operation"`
+	Status           string     `json:"status"`
+	Attempts         int64      `json:"attempts"`
+	NextAttemptOnUtc time.Time  `json:"nextAttemptOnUtc"`
+	LastError        string     `json:"lastError,omitempty"`
+	CreatedOnUtc     time.Time  `json:"createdOnUtc"`
+	DeliveredOnUtc   *time.Time `json:"deliveredOnUtc,omitempty"`
+}
+
+func newEventResponse(event eventDto) EventResponse {
+	return EventResponse{
+		ID:               event.ID,
+		ResourceType:     event.ResourceType,
+		ResourceID:       event.ResourceID,
+		Operation:        event.Operation,
+		Status:           event.Status,
+		Attempts:         event.Attempts,
+		NextAttemptOnUtc: event.NextAttemptOnUtc,
+		LastError:        event.LastError,
+		CreatedOnUtc:     event.CreatedOnUtc,
+		DeliveredOnUtc:   event.DeliveredOnUtc,
+	}
+}
+
+// handleGetEvents lists the outbox events of a target, by default the dead
+// lettered ones.
+func (h *handler) handleGetEvents(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = StatusDead
+	}
+
+	events, err := h.service.GetEvents(r.Context(), r.PathValue("orgId"), r.PathValue("id"), status)
+	if err != nil {
+		writeServiceError(w, err, "Failed to get target events")
+		return
+	}
+
+	resp := make([]EventResponse, len(events))
+	for i, event := range events {
+		resp[i] = newEventResponse(event)
+	}
+	admin.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (h *handler) handleRetryEvent(w http.ResponseWriter, r *http.Request) {
+	eventId, err := strconv.ParseInt(r.PathValue("eventId"), 10, 64)
+	if err != nil {
+		admin.WriteError(w, http.StatusNotFound, "Event not found")
+		return
+	}
+
+	err = h.service.RetryEvent(r.Context(), r.PathValue("orgId"), r.PathValue("id"), eventId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			admin.WriteError(w, http.StatusNotFound, "Dead lettered event not found")
+			return
+		}
+		writeServiceError(w, err, "Failed to retry event")
+		return
+	}
+
+	h.dispatcher.Notify()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *handler) handleDiscardEvent(w http.ResponseWriter, r *http.Request) {
+	eventId, err := strconv.ParseInt(r.PathValue("eventId"), 10, 64)
+	if err != nil {
+		admin.WriteError(w, http.StatusNotFound, "Event not found")
+		return
+	}
+
+	err = h.service.DiscardEvent(r.Context(), r.PathValue("orgId"), r.PathValue("id"), eventId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			admin.WriteError(w, http.StatusNotFound, "Dead lettered event not found")
+			return
+		}
+		writeServiceError(w, err, "Failed to discard event")
+		return
+	}
+
+	h.dispatcher.Notify()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// BackfillResponse describes a backfill of a target. Phase is the resource
+// type being sent, users first and then groups. The totals are the resources
+// there were when the backfill started, and Queued the number of operations
+// written to the outbox of the target, which leaves out the resources outside
+// its scope.
+type BackfillResponse struct {
+	ID              string     `json:"id"`
+	Status          string     `json:"status"`
+	Phase           string     `json:"phase"`
+	TotalUsers      int64      `json:"totalUsers"`
+	TotalGroups     int64      `json:"totalGroups"`
+	ProcessedUsers  int64      `json:"processedUsers"`
+	ProcessedGroups int64      `json:"processedGroups"`
+	Queued          int64      `json:"queued"`
+	Error           string     `json:"error,omitempty"`
+	CreatedBy       string     `json:"createdBy,omitempty"`
+	StartedOnUtc    time.Time  `json:"startedOnUtc"`
+	ModifiedOnUtc   time.Time  `json:"modifiedOnUtc"`
+	CompletedOnUtc  *time.Time `json:"completedOnUtc,omitempty"`
+}
+
+func newBackfillResponse(b backfillDto) BackfillResponse {
+	return BackfillResponse(b)
+}
+
+func (h *handler) handleGetBackfills(w http.ResponseWriter, r *http.Request) {
+	backfills, err := h.service.GetBackfills(r.Context(), r.PathValue("orgId"), r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, err, "Failed to get backfills")
+		return
+	}
+
+	resp := make([]BackfillResponse, len(backfills))
+	for i, b := range backfills {
+		resp[i] = newBackfillResponse(b)
+	}
+	admin.WriteJSON(w, http.StatusOK, resp)
+}
+
+// handlePostBackfill starts a backfill of a target. It continues in the
+// background, its progress is read from the backfill returned.
+func (h *handler) handlePostBackfill(w http.ResponseWriter, r *http.Request) {
+	backfill, err := h.service.StartBackfill(r.Context(), r.PathValue("orgId"), admin.UserID(r.Context()), r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, err, "Failed to start backfill")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusAccepted, newBackfillResponse(backfill))
+}
+
+func (h *handler) handleGetBackfill(w http.ResponseWriter, r *http.Request) {
+	backfill, err := h.service.GetBackfill(r.Context(), r.PathValue("orgId"), r.PathValue("id"), r.PathValue("backfillId"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			admin.WriteError(w, http.StatusNotFound, "Backfill not found")
+			return
+		}
+		writeServiceError(w, err, "Failed to get backfill")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusOK, newBackfillResponse(backfill))
+}
+
+// handleChangeBackfill pauses, resumes or cancels a backfill. A paused
+// backfill stops after the page it's sending and resumes where it was.
+func (h *handler) handleChangeBackfill(action string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		backfill, err := h.service.ChangeBackfill(r.Context(), r.PathValue("orgId"), r.PathValue("id"), r.PathValue("backfillId"), action)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				admin.WriteError(w, http.StatusNotFound, "Backfill not found")
+				return
+			}
+			writeServiceError(w, err, "Failed to "+action+" backfill")
+			return
+		}
+
+		admin.WriteJSON(w, http.StatusOK, newBackfillResponse(backfill))
+	}
+}
+
+// HealthResponse describes the delivery state of a target. State is the
+// state of its circuit, which opens after consecutive failed deliveries and
+// sends the target nothing until a probe succeeds. OpenedOnUtc is set while
+// the circuit isn't closed, and ThrottledUntil while the target has asked to
+// be left alone with a 429. Pending and Dead count the events in its outbox.
+// The state is kept in memory and starts over when the server restarts.
+type HealthResponse struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	OpenedOnUtc         *time.Time `json:"openedOnUtc,omitempty"`
+	ThrottledUntil      *time.Time `json:"throttledUntil,omitempty"`
+	InFlight            int        `json:"inFlight"`
+	MaxInFlight         int        `json:"maxInFlight"`
+	RateLimit           float64    `json:"rateLimit,omitempty"`
+	Pending             int64      `json:"pending"`
+	Dead                int64      `json:"dead"`
+	LastSuccessOnUtc    *time.Time `json:"lastSuccessOnUtc,omitempty"`
+	LastFailureOnUtc    *time.Time `json:"lastFailureOnUtc,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+}
+
+func (h *handler) handleGetHealth(w http.ResponseWriter, r *http.Request) {
+	health, err := h.service.GetHealth(r.Context(), r.PathValue("orgId"), r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, err, "Failed to get target health")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusOK, HealthResponse{
+		State:               health.State,
+		ConsecutiveFailures: health.ConsecutiveFailures,
+		OpenedOnUtc:         health.OpenedOn,
+		ThrottledUntil:      health.ThrottledUntil,
+		InFlight:            health.InFlight,
+		MaxInFlight:         health.MaxInFlight,
+		RateLimit:           health.RateLimit,
+		Pending:             health.Pending,
+		Dead:                health.Dead,
+		LastSuccessOnUtc:    health.LastSuccess,
+		LastFailureOnUtc:    health.LastFailure,
+		LastError:           health.LastError,
+	})
+}
+
+// ReconciliationResponse describes a reconciliation of a target. The counts
+// are the drift found of each kind, and Repaired the number of resources
+// corrections were queued for. Report lists the drift and is only returned
+// for a single reconciliation.
+type ReconciliationResponse struct {
+	ID             string     `json:"id"`
+	Trigger        string     `json:"trigger"`
+	Repair         bool       `json:"repair"`
+	Status         string     `json:"status"`
+	Missing        int64      `json:"missing"`
+	Extra          int64      `json:"extra"`
+	Changed        int64      `json:"changed"`
+	Membership     int64      `json:"membership"`
+	Repaired       int64      `json:"repaired"`
+	Report         []Drift    `json:"report,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	CreatedBy      string     `json:"createdBy,omitempty"`
+	StartedOnUtc   time.Time  `json:"startedOnUtc"`
+	CompletedOnUtc *time.Time `json:"completedOnUtc,omitempty"`
+}
+
+func newReconciliationResponse(r reconciliationDto) ReconciliationResponse {
+	return ReconciliationResponse{
+		ID:             r.ID,
+		Trigger:        r.Trigger,
+		Repair:         r.Repair,
+		Status:         r.Status,
+		Missing:        r.Missing,
+		Extra:          r.Extra,
+		Changed:        r.Changed,
+		Membership:     r.Membership,
+		Repaired:       r.Repaired,
+		Report:         r.Report,
+		Error:          r.Error,
+		CreatedBy:      r.CreatedBy,
+		StartedOnUtc:   r.StartedOnUtc,
+		CompletedOnUtc: r.CompletedOnUtc,
+	}
+}
+
+// ReconciliationRequest starts a reconciliation. Repair queues the
+// operations that correct the drift found.
+type ReconciliationRequest struct {
+	Repair bool `json:"repair"`
+}
+
+func (h *handler) handleGetReconciliations(w http.ResponseWriter, r *http.Request) {
+	reconciliations, err := h.service.GetReconciliations(r.Context(), r.PathValue("orgId"), r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, err, "Failed to get reconciliations")
+		return
+	}
+
+	resp := make([]ReconciliationResponse, len(reconciliations))
+	for i, rec := range reconciliations {
+		resp[i] = newReconciliationResponse(rec)
+	}
+	admin.WriteJSON(w, http.StatusOK, resp)
+}
+
+// handlePostReconciliation starts reconciling a target. The run continues
+// in the background, its report is read from the reconciliation returned.
+func (h *handler) handlePostReconciliation(w http.ResponseWriter, r *http.Request) {
+	var req ReconciliationRequest
+	if !admin.ReadOptionalJSON(w, r, &req) {
+		return
+	}
+
+	rec, err := h.service.Reconcile(r.Context(), r.PathValue("orgId"), admin.UserID(r.Context()), r.PathValue("id"), req.Repair)
+	if err != nil {
+		writeServiceError(w, err, "Failed to start reconciliation")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusAccepted, newReconciliationResponse(rec))
+}
+
+func (h *handler) handleGetReconciliation(w http.ResponseWriter, r *http.Request) {
+	rec, err := h.service.GetReconciliation(r.Context(), r.PathValue("orgId"), r.PathValue("id"), r.PathValue("reconciliationId"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			admin.WriteError(w, http.StatusNotFound, "Reconciliation not found")
+			return
+		}
+		writeServiceError(w, err, "Failed to get reconciliation")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusOK, newReconciliationResponse(rec))
+}
+
+// ShadowReportResponse describes the operations recorded for a target in
+// shadow mode. Summary counts all of them, Operations lists the newest, and
+// Cursor is passed as before to list the ones older than those.
+type ShadowReportResponse struct {
+	Summary    ShadowSummaryResponse     `json:"summary"`
+	Operations []ShadowOperationResponse `json:"operations"`
+	Cursor     string                    `json:"cursor,omitempty"`
+}
+
+// ShadowSummaryResponse counts the operations a target would have been sent,
+// the changes its scope filtered out, the changes that couldn't be mapped and
+// the resources the operations were for.
+type ShadowSummaryResponse struct {
+	Create    int64 `json:"create"`
+	Replace   int64 `json:"replace"`
+	Delete    int64 `json:"delete"`
+	Skipped   int64 `json:"skipped"`
+	Failed    int64 `json:"failed"`
+	Resources int64 `json:"resources"`
+}
+
+// ShadowOperationResponse is an operation a target would have been sent.
+// Payload is what would have been sent, and Patch the JSON Patch from the
+// payload of the previous operation of the resource, if there is one.
+type ShadowOperationResponse struct {
+	ID           int64            `json:"id"`
+	ResourceType string           `json:"resourceType"`
+	ResourceID   string           `json:"resourceId"`
+	Operation    string           `json:"operation"`
+	Payload      json.RawMessage  `json:"payload,omitempty"`
+	Patch        []patchOperation `json:"patch,omitempty"`
+	Skipped      bool             `json:"skipped,omitempty"`
+	Error        string           `json:"error,omitempty"`
+	CreatedOnUtc time.Time        `json:"createdOnUtc"`
+}
+
+func newShadowReportResponse(report shadowReportDto, limit int) ShadowReportResponse {
+	resp := ShadowReportResponse{
+		Summary: ShadowSummaryResponse{
+			Create:    report.Summary.Create,
+			Replace:   report.Summary.Replace,
+			Delete:    report.Summary.Delete,
+			Skipped:   report.Summary.Skipped,
+			Failed:    report.Summary.Failed,
+			Resources: report.Summary.Resources,
+		},
+		Operations: make([]ShadowOperationResponse, len(report.Operations)),
+	}
+	for i, op := range report.Operations {
+		resp.Operations[i] = ShadowOperationResponse{
+			ID:           op.ID,
+			ResourceType: op.ResourceType,
+			ResourceID:   op.ResourceID,
+			Operation:    op.Operation,
+			Payload:      op.Payload,
+			Patch:        op.Patch,
+			Skipped:      op.Skipped,
+			Error:        op.Error,
+			CreatedOnUtc: op.CreatedOnUtc,
+		}
+	}
+	if len(report.Operations) == limit {
+		resp.Cursor = strconv.FormatInt(report.Operations[limit-1].ID, 10)
+	}
+	return resp
+}
+
+// handleGetShadowReport reports the operations recorded for a target in
+// shadow mode, newest first. limit is 100 by default, and before is the
+// cursor of the previous page.
+func (h *handler) handleGetShadowReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := 100
+	if value := query.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxShadowOperations {
+			admin.WriteError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxShadowOperations))
+			return
+		}
+	}
+	var before int64
+	if value := query.Get("before"); value != "" {
+		var err error
+		before, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || before < 1 {
+			admin.WriteError(w, http.StatusBadRequest, "Invalid before cursor")
+			return
+		}
+	}
+
+	report, err := h.service.GetShadowReport(r.Context(), r.PathValue("orgId"), r.PathValue("id"), before, limit)
+	if err != nil {
+		writeServiceError(w, err, "Failed to get shadow report")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusOK, newShadowReportResponse(report, limit))
+}
+
+func (h *handler) handleDeleteShadowOperations(w http.ResponseWriter, r *http.Request) {
+	err := h.service.ClearShadowOperations(r.Context(), r.PathValue("orgId"), r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, err, "Failed to clear shadow operations")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ThresholdResponse describes the mass change threshold of an organisation.
+// SuspendedUntil is set while nothing is counted after a batch was approved.
+type ThresholdResponse struct {
+	MaxCount       *int64     `json:"maxCount,omitempty"`
+	MaxPercent     *int64     `json:"maxPercent,omitempty"`
+	Window         string     `json:"window"`
+	Reject         bool       `json:"reject"`
+	SuspendedUntil *time.Time `json:"suspendedUntil,omitempty"`
+	ModifiedBy     string     `json:"modifiedBy,omitempty"`
+	ModifiedOnUtc  time.Time  `json:"modifiedOnUtc"`
+}
+
+func newThresholdResponse(t thresholdDto) ThresholdResponse {
+	return ThresholdResponse{
+		MaxCount:       t.MaxCount,
+		MaxPercent:     t.MaxPercent,
+		Window:         t.Window.String(),
+		Reject:         t.Reject,
+		SuspendedUntil: t.SuspendedUntil,
+		ModifiedBy:     t.ModifiedBy,
+		ModifiedOnUtc:  t.ModifiedOnUtc,
+	}
+}
+
+// ThresholdRequest sets the mass change threshold of an organisation. When a
+// source deletes or deactivates more than MaxCount users, or more than
+// MaxPercent percent of them, within Window, a duration such as 1h, the
+// changes of the organisation are held back from its targets until the held
+// batch is approved or discarded. At least one of the limits is required.
+// Reject makes SCIM deletions and deactivations fail with 503 while a batch
+// is open instead of being held.
+type ThresholdRequest struct {
+	MaxCount   *int64 `json:"maxCount"`
+	MaxPercent *int64 `json:"maxPercent"`
+	Window     string `json:"window"`
+	Reject     bool   `json:"reject"`
+}
+
+func (h *handler) handleGetThreshold(w http.ResponseWriter, r *http.Request) {
+	threshold, err := h.service.GetThreshold(r.Context(), r.PathValue("orgId"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			admin.WriteError(w, http.StatusNotFound, "Mass change threshold not found")
+			return
+		}
+		writeServiceError(w, err, "Failed to get mass change threshold")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusOK, newThresholdResponse(threshold))
+}
+
+func (h *handler) handlePutThreshold(w http.ResponseWriter, r *http.Request) {
+	var req ThresholdRequest
+	if !admin.ReadJSON(w, r, &req) {
+		return
+	}
+
+	threshold, err := h.service.SetThreshold(r.Context(), r.PathValue("orgId"), admin.UserID(r.Context()), req)
+	if err != nil {
+		writeServiceError(w, err, "Failed to set mass change threshold")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusOK, newThresholdResponse(threshold))
+}
+
+func (h *handler) handleDeleteThreshold(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.DeleteThreshold(r.Context(), r.PathValue("orgId")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			admin.WriteError(w, http.StatusNotFound, "Mass change threshold not found")
+			return
+		}
+		writeServiceError(w, err, "Failed to delete mass change threshold")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HeldBatchResponse describes the changes held back from the targets of an
+// organisation. Changes is the number of deletions and deactivations that
+// exceeded the threshold out of Users, and Events the number of events
+// held. HeldEvents lists the oldest of them and is only returned for a
+// single batch.
+type HeldBatchResponse struct {
+	ID            string              `json:"id"`
+	Status        string              `json:"status"`
+	Changes       int64               `json:"changes"`
+	Users         int64               `json:"users"`
+	Events        int64               `json:"events"`
+	HeldEvents    []HeldEventResponse `json:"heldEvents,omitempty"`
+	OpenedOnUtc   time.Time           `json:"openedOnUtc"`
+	ResolvedBy    string              `json:"resolvedBy,omitempty"`
+	ResolvedOnUtc *time.Time          `json:"resolvedOnUtc,omitempty"`
+}
+
+type HeldEventResponse struct {
+	ResourceType string    `json:"resourceType"`
+	ResourceID   string    `json:"resourceId"`
+	Operation    string    `json:"operation"`
+	Deactivates  bool      `json:"deactivates,omitempty"`
+	CreatedOnUtc time.Time `json:"createdOnUtc"`
+}
+
+func newHeldBatchResponse(b heldBatchDto) HeldBatchResponse {
+	resp := HeldBatchResponse{
+		ID:            b.ID,
+		Status:        b.Status,
+		Changes:       b.Changes,
+		Users:         b.Users,
+		Events:        b.Events,
+		OpenedOnUtc:   b.OpenedOnUtc,
+		ResolvedBy:    b.ResolvedBy,
+		ResolvedOnUtc: b.ResolvedOnUtc,
+	}
+	for _, e := range b.HeldEvents {
+		resp.HeldEvents = append(resp.HeldEvents, HeldEventResponse(e))
+	}
+	return resp
+}
+
+func (h *handler) handleGetHeldBatches(w http.ResponseWriter, r *http.Request) {
+	batches, err := h.service.GetHeldBatches(r.Context(), r.PathValue("orgId"), r.URL.Query().Get("status"))
+	if err != nil {
+		writeServiceError(w, err, "Failed to get held batches")
+		return
+	}
+
+	resp := make([]HeldBatchResponse, len(batches))
+	for i, b := range batches {
+		resp[i] = newHeldBatchResponse(b)
+	}
+	admin.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (h *handler) handleGetHeldBatch(w http.ResponseWriter, r *http.Request) {
+	batch, err := h.service.GetHeldBatch(r.Context(), r.PathValue("orgId"), r.PathValue("batchId"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			admin.WriteError(w, http.StatusNotFound, "Held batch not found")
+			return
+		}
+		writeServiceError(w, err, "Failed to get held batch")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusOK, newHeldBatchResponse(batch))
+}
+
+// handleApproveHeldBatch sends the held events to the targets in the order
+// they happened. The threshold counts nothing for a window afterwards so the
+// rest of the change isn't held again.
+func (h *handler) handleApproveHeldBatch(w http.ResponseWriter, r *http.Request) {
+	h.resolveHeldBatch(w, r, BatchApproved)
+}
+
+// handleDiscardHeldBatch drops the held events. The changes stay in the
+// local state but the targets are never sent them, the source should be
+// corrected or the targets reconciled.
+func (h *handler) handleDiscardHeldBatch(w http.ResponseWriter, r *http.Request) {
+	h.resolveHeldBatch(w, r, BatchDiscarded)
+}
+
+func (h *handler) resolveHeldBatch(w http.ResponseWriter, r *http.Request, status string) {
+	batch, err := h.service.ResolveHeldBatch(r.Context(), r.PathValue("orgId"), admin.UserID(r.Context()), r.PathValue("batchId"), status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			admin.WriteError(w, http.StatusNotFound, "Held batch not found")
+			return
+		}
+		writeServiceError(w, err, "Failed to resolve held batch")
+		return
+	}
+
+	if status == BatchApproved {
+		h.dispatcher.Notify()
+	}
+	admin.WriteJSON(w, http.StatusOK, newHeldBatchResponse(batch))
+}
+
+func writeServiceError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		admin.WriteError(w, http.StatusNotFound, "Target not found")
+		return
+	case errors.Is(err, errReconciling):
+		admin.WriteError(w, http.StatusConflict, "Target is already being reconciled")
+		return
+	case errors.Is(err, errBackfilling):
+		admin.WriteError(w, http.StatusConflict, "Target already has a backfill in progress")
+		return
+	case errors.Is(err, errBackfillStatus):
+		admin.WriteError(w, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, errEventSuperseded):
+		admin.WriteError(w, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, errBatchResolved):
+		admin.WriteError(w, http.StatusConflict, "Held batch is already resolved")
+		return
+	case errors.Is(err, errStopping):
+		admin.WriteError(w, http.StatusServiceUnavailable, "Server is shutting down")
+		return
+	case errors.Is(err, errInvalidRequest):
+		admin.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	slog.Error(message, "error", err)
+	admin.WriteError(w, http.StatusInternalServerError, message)
+}
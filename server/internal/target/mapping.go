@@ -0,0 +1,647 @@
+package target
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jawee/scimtiplexer/internal/scim/schema"
+)
+
+// Mapping reshapes the resources sent to a target. Each resource type has its
+// own rules, resources of a type without rules are sent unchanged.
+type Mapping struct {
+	Users  *ResourceMapping `json:"users,omitempty"`
+	Groups *ResourceMapping `json:"groups,omitempty"`
+}
+
+// ResourceMapping sets the attributes of a resource in order. The rules are
+// applied to a copy of the SCIM representation of the resource, unless
+// Replace is set, in which case only mapped attributes are sent.
+type ResourceMapping struct {
+	Replace    bool            `json:"replace,omitempty"`
+	Attributes []AttributeRule `json:"attributes"`
+}
+
+// AttributeRule sets the attribute at Target to the value of the expression.
+// An empty value removes the attribute.
+//
+// Paths are attribute names with an optional sub-attribute, such as
+// name.givenName. Multi-valued attributes take a filter on one of their
+// sub-attributes, emails[type eq "work"].value, without a filter the primary
+// or first value is used. Attributes of schema extensions are prefixed with
+// the schema URN, such as
+// urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department.
+// Targets can use custom extensions, which are added to schemas.
+type AttributeRule struct {
+	Target string `json:"target"`
+	Expression
+
+	target attributePath
+}
+
+// Expression computes a value from exactly one of a source path, a constant,
+// a template with {{path}} placeholders or the first non-empty value of a
+// list of expressions. Functions are applied to the value in order, then
+// Default is used if the value is empty.
+type Expression struct {
+	Source    string          `json:"source,omitempty"`
+	Constant  json.RawMessage `json:"constant,omitempty"`
+	Template  string          `json:"template,omitempty"`
+	Coalesce  []Expression    `json:"coalesce,omitempty"`
+	Functions []Function      `json:"functions,omitempty"`
+	Default   json.RawMessage `json:"default,omitempty"`
+
+	source   attributePath
+	constant any
+	template []templatePart
+	fallback any
+}
+
+// Function transforms a string value. Name is one of lower, upper, trim,
+// split, which keeps the part at Index of the value split by Separator
+// (negative indexes count from the end), and regexReplace, which replaces
+// matches of Pattern with Replacement.
+type Function struct {
+	Name        string `json:"name"`
+	Separator   string `json:"separator,omitempty"`
+	Index       int    `json:"index,omitempty"`
+	Pattern     string `json:"pattern,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// parseMapping parses and validates a mapping against the schemas of the
+// resource types.
+func parseMapping(data []byte) (*Mapping, error) {
+	var m Mapping
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid attribute mapping: %w", err)
+	}
+
+	if m.Users != nil {
+		if err := m.Users.compile(ResourceUser); err != nil {
+			return nil, fmt.Errorf("invalid users mapping: %w", err)
+		}
+	}
+	if m.Groups != nil {
+		if err := m.Groups.compile(ResourceGroup); err != nil {
+			return nil, fmt.Errorf("invalid groups mapping: %w", err)
+		}
+	}
+	return &m, nil
+}
+
+// mapResource applies the mapping of a target to a resource. Resources are
+// returned unchanged if the target has no mapping for their type.
+func mapResource(mapping string, resourceType string, resource json.RawMessage) (json.RawMessage, error) {
+	if mapping == "" || len(resource) == 0 {
+		return resource, nil
+	}
+	m, err := parseMapping([]byte(mapping))
+	if err != nil {
+		return nil, err
+	}
+	return m.Apply(resourceType, resource)
+}
+
+// Apply maps a resource of the given type.
+func (m *Mapping) Apply(resourceType string, resource json.RawMessage) (json.RawMessage, error) {
+	rules := m.Users
+	if resourceType == ResourceGroup {
+		rules = m.Groups
+	}
+	if rules == nil {
+		return resource, nil
+	}
+
+	var source map[string]any
+	if err := json.Unmarshal(resource, &source); err != nil {
+		return nil, fmt.Errorf("failed to decode resource: %w", err)
+	}
+	return json.Marshal(rules.apply(source))
+}
+
+func (rm *ResourceMapping) compile(resourceType string) error {
+	r, _ := schema.ResourceType(resourceType)
+	for i := range rm.Attributes {
+		rule := &rm.Attributes[i]
+		target, err := parsePath(r, rule.Target, true)
+		if err != nil {
+			return fmt.Errorf("attribute %d: target: %w", i, err)
+		}
+		if target.schema == r.Schema.ID && (target.name == "id" || target.name == "meta") {
+			return fmt.Errorf("attribute %d: target: %s can't be mapped", i, target.name)
+		}
+		if target.filter != nil && target.sub == "" {
+			return fmt.Errorf("attribute %d: target: a filtered target needs a sub-attribute", i)
+		}
+		rule.target = target
+
+		if err := rule.Expression.compile(r); err != nil {
+			return fmt.Errorf("attribute %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (rm *ResourceMapping) apply(source map[string]any) map[string]any {
+	out := map[string]any{}
+	if rm.Replace {
+		for _, key := range []string{"schemas", "id"} {
+			if value, ok := source[key]; ok {
+				out[key] = copyValue(value)
+			}
+		}
+	} else {
+		out = copyValue(source).(map[string]any)
+	}
+
+	for _, rule := range rm.Attributes {
+		rule.target.set(out, rule.Expression.eval(source))
+	}
+	return out
+}
+
+func (e *Expression) compile(r schema.Resource) error {
+	set := 0
+	if e.Source != "" {
+		set++
+		source, err := parsePath(r, e.Source, false)
+		if err != nil {
+			return fmt.Errorf("source: %w", err)
+		}
+		e.source = source
+	}
+	if len(e.Constant) > 0 {
+		set++
+		if err := json.Unmarshal(e.Constant, &e.constant); err != nil {
+			return fmt.Errorf("constant: %w", err)
+		}
+	}
+	if e.Template != "" {
+		set++
+		template, err := parseTemplate(r, e.Template)
+		if err != nil {
+			return fmt.Errorf("template: %w", err)
+		}
+		e.template = template
+	}
+	if len(e.Coalesce) > 0 {
+		set++
+		for i := range e.Coalesce {
+			if err := e.Coalesce[i].compile(r); err != nil {
+				return fmt.Errorf("coalesce %d: %w", i, err)
+			}
+		}
+	}
+	if set != 1 {
+		return errors.New("exactly one of source, constant, template and coalesce is required")
+	}
+
+	for i := range e.Functions {
+		if err := e.Functions[i].compile(); err != nil {
+			return fmt.Errorf("function %d: %w", i, err)
+		}
+	}
+	if len(e.Default) > 0 {
+		if err := json.Unmarshal(e.Default, &e.fallback); err != nil {
+			return fmt.Errorf("default: %w", err)
+		}
+	}
+	return nil
+}
+
+func (e *Expression) eval(source map[string]any) any {
+	var value any
+	switch {
+	case e.Source != "":
+		value = copyValue(e.source.get(source))
+	case len(e.Constant) > 0:
+		value = copyValue(e.constant)
+	case e.Template != "":
+		value = renderTemplate(e.template, source)
+	default:
+		for _, expr := range e.Coalesce {
+			if value = expr.eval(source); !isEmpty(value) {
+				break
+			}
+		}
+	}
+
+	for _, fn := range e.Functions {
+		value = fn.apply(value)
+	}
+	if isEmpty(value) && e.fallback != nil {
+		value = copyValue(e.fallback)
+	}
+	return value
+}
+
+func (f *Function) compile() error {
+	switch f.Name {
+	case "lower", "upper", "trim":
+	case "split":
+		if f.Separator == "" {
+			return errors.New("split needs a separator")
+		}
+	case "regexReplace":
+		pattern, err := regexp.Compile(f.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+		f.pattern = pattern
+	default:
+		return fmt.Errorf("unknown function %q", f.Name)
+	}
+	return nil
+}
+
+// apply transforms scalar values, other values are returned unchanged.
+func (f *Function) apply(value any) any {
+	s, ok := scalarString(value)
+	if !ok {
+		return value
+	}
+
+	switch f.Name {
+	case "lower":
+		return strings.ToLower(s)
+	case "upper":
+		return strings.ToUpper(s)
+	case "trim":
+		return strings.TrimSpace(s)
+	case "split":
+		parts := strings.Split(s, f.Separator)
+		i := f.Index
+		if i < 0 {
+			i += len(parts)
+		}
+		if i < 0 || i >= len(parts) {
+			return nil
+		}
+		return parts[i]
+	case "regexReplace":
+		return f.pattern.ReplaceAllString(s, f.Replacement)
+	}
+	return value
+}
+
+// attributePath is a parsed attribute path. schema is the URN of the schema
+// the attribute belongs to, names are as defined by the schema.
+type attributePath struct {
+	schema      string
+	name        string
+	multiValued bool
+	filter      *pathFilter
+	sub         string
+}
+
+// pathFilter selects the values of a multi-valued attribute whose
+// sub-attribute equals value.
+type pathFilter struct {
+	attribute string
+	value     any
+}
+
+var pathPattern = regexp.MustCompile(`^([A-Za-z$][\w$-]*)(?:\[\s*([A-Za-z$][\w$-]*)\s+eq\s+("(?:[^"\\]|\\.)*"|true|false)\s*\])?(?:\.([A-Za-z$][\w$-]*))?$`)
+
+// parsePath parses a path and resolves it against the schemas of the
+// resource. Targets may also name attributes of custom extensions, which
+// aren't validated.
+func parsePath(r schema.Resource, path string, target bool) (attributePath, error) {
+	p := attributePath{schema: r.Schema.ID}
+	rest := path
+	if strings.HasPrefix(strings.ToLower(path), "urn:") {
+		i := strings.LastIndex(path, ":")
+		p.schema, rest = path[:i], path[i+1:]
+	}
+
+	m := pathPattern.FindStringSubmatch(rest)
+	if m == nil {
+		return attributePath{}, fmt.Errorf("invalid path %q", path)
+	}
+	p.name, p.sub = m[1], m[4]
+	if m[2] != "" {
+		p.filter = &pathFilter{attribute: m[2]}
+		if err := json.Unmarshal([]byte(m[3]), &p.filter.value); err != nil {
+			return attributePath{}, fmt.Errorf("invalid filter value in %q", path)
+		}
+	}
+
+	if !schema.Known(p.schema) {
+		if !target {
+			return attributePath{}, fmt.Errorf("unknown schema %q", p.schema)
+		}
+		// Attributes of custom extensions are taken as they are.
+		p.multiValued = p.filter != nil
+		return p, nil
+	}
+
+	attr, ok := r.Find(p.schema, p.name, "")
+	if !ok {
+		return attributePath{}, fmt.Errorf("unknown attribute %q", path)
+	}
+	for _, s := range append([]schema.Schema{r.Schema}, r.Extensions...) {
+		if strings.EqualFold(s.ID, p.schema) {
+			p.schema = s.ID
+		}
+	}
+	p.name = attr.Name
+	p.multiValued = attr.MultiValued
+	if p.filter != nil {
+		if !attr.MultiValued {
+			return attributePath{}, fmt.Errorf("%q isn't multi-valued", attr.Name)
+		}
+		sub, ok := r.Find(p.schema, p.name, p.filter.attribute)
+		if !ok {
+			return attributePath{}, fmt.Errorf("unknown attribute %q in filter of %q", p.filter.attribute, path)
+		}
+		p.filter.attribute = sub.Name
+	}
+	if p.sub != "" {
+		sub, ok := r.Find(p.schema, p.name, p.sub)
+		if !ok {
+			return attributePath{}, fmt.Errorf("unknown attribute %q", path)
+		}
+		p.sub = sub.Name
+	}
+	return p, nil
+}
+
+// container returns the object the attribute is stored in, creating it if
+// create is set.
+func (p attributePath) container(resource map[string]any, create bool) map[string]any {
+	if isCoreSchema(p.schema) {
+		return resource
+	}
+	if ext, ok := lookup(resource, p.schema).(map[string]any); ok {
+		return ext
+	}
+	if !create {
+		return nil
+	}
+
+	ext := map[string]any{}
+	resource[p.schema] = ext
+	schemas, _ := resource["schemas"].([]any)
+	if !slices.Contains(schemas, any(p.schema)) {
+		resource["schemas"] = append(schemas, p.schema)
+	}
+	return ext
+}
+
+func isCoreSchema(id string) bool {
+	return id == schema.User || id == schema.Group
+}
+
+// get returns the value at the path, or nil if it isn't set.
+func (p attributePath) get(resource map[string]any) any {
+	container := p.container(resource, false)
+	if container == nil {
+		return nil
+	}
+	value := lookup(container, p.name)
+
+	if values, ok := value.([]any); ok && (p.filter != nil || p.sub != "") {
+		i := p.index(values)
+		if i < 0 {
+			return nil
+		}
+		value = values[i]
+	}
+	if p.sub == "" {
+		return value
+	}
+	object, _ := value.(map[string]any)
+	return lookup(object, p.sub)
+}
+
+// index returns the index of the value selected by the filter, or of the
+// primary or first value without a filter. It's -1 if there is none.
+func (p attributePath) index(values []any) int {
+	if p.filter == nil {
+		for i, v := range values {
+			if object, ok := v.(map[string]any); ok && lookup(object, "primary") == true {
+				return i
+			}
+		}
+		if len(values) > 0 {
+			return 0
+		}
+		return -1
+	}
+	for i, v := range values {
+		if object, ok := v.(map[string]any); ok && equalValues(lookup(object, p.filter.attribute), p.filter.value) {
+			return i
+		}
+	}
+	return -1
+}
+
+// set stores value at the path, or removes the attribute if value is empty.
+func (p attributePath) set(resource map[string]any, value any) {
+	empty := isEmpty(value)
+	container := p.container(resource, !empty)
+	if container == nil {
+		return
+	}
+	name := keyOf(container, p.name)
+
+	if p.sub == "" {
+		if empty {
+			delete(container, name)
+			return
+		}
+		container[name] = value
+		return
+	}
+
+	if !p.multiValued {
+		object, ok := container[name].(map[string]any)
+		if !ok {
+			if empty {
+				return
+			}
+			object = map[string]any{}
+			container[name] = object
+		}
+		setKey(object, p.sub, value, empty)
+		return
+	}
+
+	values, _ := container[name].([]any)
+	i := p.index(values)
+	if empty {
+		if i >= 0 && p.filter != nil {
+			container[name] = slices.Delete(values, i, i+1)
+		} else if i >= 0 {
+			object, _ := values[i].(map[string]any)
+			setKey(object, p.sub, nil, true)
+		}
+		return
+	}
+	if i < 0 {
+		object := map[string]any{}
+		if p.filter != nil {
+			object[p.filter.attribute] = p.filter.value
+		} else {
+			object["primary"] = true
+		}
+		values = append(values, object)
+		i = len(values) - 1
+	}
+	object, ok := values[i].(map[string]any)
+	if !ok {
+		object = map[string]any{}
+		values[i] = object
+	}
+	setKey(object, p.sub, value, false)
+	container[name] = values
+}
+
+func setKey(object map[string]any, name string, value any, remove bool) {
+	if object == nil {
+		return
+	}
+	key := keyOf(object, name)
+	if remove {
+		delete(object, key)
+		return
+	}
+	object[key] = value
+}
+
+// keyOf returns the key an attribute is stored under, attribute names are
+// case insensitive.
+func keyOf(object map[string]any, name string) string {
+	if _, ok := object[name]; ok {
+		return name
+	}
+	for key := range object {
+		if strings.EqualFold(key, name) {
+			return key
+		}
+	}
+	return name
+}
+
+func lookup(object map[string]any, name string) any {
+	if object == nil {
+		return nil
+	}
+	return object[keyOf(object, name)]
+}
+
+// templatePart is literal text or, if path is set, a placeholder.
+type templatePart struct {
+	text string
+	path *attributePath
+}
+
+var placeholderPattern = regexp.MustCompile(`\{\{\s*(.*?)\s*\}\}`)
+
+func parseTemplate(r schema.Resource, template string) ([]templatePart, error) {
+	var parts []templatePart
+	last := 0
+	for _, m := range placeholderPattern.FindAllStringSubmatchIndex(template, -1) {
+		if m[0] > last {
+			parts = append(parts, templatePart{text: template[last:m[0]]})
+		}
+		path, err := parsePath(r, template[m[2]:m[3]], false)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, templatePart{path: &path})
+		last = m[1]
+	}
+	if last < len(template) {
+		parts = append(parts, templatePart{text: template[last:]})
+	}
+	return parts, nil
+}
+
+// renderTemplate fills in the placeholders. The result is empty if all of
+// them are, so a default can take over.
+func renderTemplate(parts []templatePart, source map[string]any) any {
+	var b strings.Builder
+	placeholders, filled := 0, 0
+	for _, part := range parts {
+		if part.path == nil {
+			b.WriteString(part.text)
+			continue
+		}
+		placeholders++
+		if s, ok := scalarString(part.path.get(source)); ok && s != "" {
+			filled++
+			b.WriteString(s)
+		}
+	}
+	if placeholders > 0 && filled == 0 {
+		return nil
+	}
+	return b.String()
+}
+
+func scalarString(value any) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	}
+	return "", false
+}
+
+func isEmpty(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []any:
+		return len(v) == 0
+	case map[string]any:
+		return len(v) == 0
+	}
+	return false
+}
+
+// equalValues compares filter values, strings case insensitively.
+func equalValues(a, b any) bool {
+	as, aok := a.(string)
+	bs, bok := b.(string)
+	if aok && bok {
+		return strings.EqualFold(as, bs)
+	}
+	return a == b
+}
+
+// copyValue deep copies a decoded JSON value, so mapped values don't share
+// objects with the source.
+func copyValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		object := make(map[string]any, len(v))
+		for key, value := range v {
+			object[key] = copyValue(value)
+		}
+		return object
+	case []any:
+		values := make([]any, len(v))
+		for i, value := range v {
+			values[i] = copyValue(value)
+		}
+		return values
+	}
+	return value
+}
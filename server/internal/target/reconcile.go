@@ -0,0 +1,773 @@
+package target
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/scim/schema"
+)
+
+const (
+	// minReconcileInterval is the shortest interval a target can be
+	// reconciled at.
+	minReconcileInterval = 5 * time.Minute
+	// scheduleInterval is how often targets that are due are looked for.
+	scheduleInterval = time.Minute
+	// reconcileTimeout bounds how long one reconciliation may take.
+	reconcileTimeout = time.Hour
+	// listPageSize is how many resources are requested from a target at a
+	// time.
+	listPageSize = 100
+)
+
+// Reconciliation statuses.
+const (
+	ReconciliationRunning   = "running"
+	ReconciliationCompleted = "completed"
+	ReconciliationFailed    = "failed"
+)
+
+// What started a reconciliation.
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// Kinds of drift. A resource is missing when it is in the scope of a target
+// but not there, and extra when it is at the target but isn't in its scope,
+// has been deleted or was never provisioned.
+const (
+	DriftMissing    = "missing"
+	DriftExtra      = "extra"
+	DriftAttributes = "attributes"
+	DriftMembers    = "members"
+)
+
+var (
+	errNotReconcilable = fmt.Errorf("%w: only scim targets can be reconciled", errInvalidRequest)
+	errReconciling     = errors.New("target is already being reconciled")
+	errStopping        = errors.New("reconciliations are stopping")
+)
+
+// Drift is a difference between a target and the local state. ResourceID is
+// the local id and is empty for remote resources that aren't mapped to one.
+// Members are local ids, or the remote id of members that aren't mapped to a
+// local resource. Repaired is set when an operation correcting the drift was
+// queued.
+type Drift struct {
+	ResourceType   string           `json:"resourceType"`
+	Kind           string           `json:"kind"`
+	ResourceID     string           `json:"resourceId,omitempty"`
+	RemoteID       string           `json:"remoteId,omitempty"`
+	Attributes     []AttributeDrift `json:"attributes,omitempty"`
+	MissingMembers []string         `json:"missingMembers,omitempty"`
+	ExtraMembers   []string         `json:"extraMembers,omitempty"`
+	Repaired       bool             `json:"repaired"`
+}
+
+// AttributeDrift is an attribute that differs between the payload the
+// target would be sent and the resource at the target.
+type AttributeDrift struct {
+	Attribute string `json:"attribute"`
+	Expected  any    `json:"expected"`
+	Actual    any    `json:"actual"`
+}
+
+// Reconciler compares the resources at scim targets with the local state,
+// on demand and at the interval set on each target. Reconciliation can repair
+// the drift it finds by queueing the operations that correct it in the
+// outbox. A target is reconciled by one run at a time.
+type Reconciler struct {
+	repo       repository.Querier
+	dispatcher *Dispatcher
+	users      ResourceLoader
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+
+	// ctx is cancelled when shutdown runs out of time, aborting the runs in
+	// progress.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	running map[string]bool
+	stopped bool
+}
+
+// NewReconciler creates a reconciler. Repairs are queued with dispatcher, and
+// users loads the local users.
+func NewReconciler(repo repository.Querier, dispatcher *Dispatcher, users ResourceLoader) *Reconciler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Reconciler{
+		repo:       repo,
+		dispatcher: dispatcher,
+		users:      users,
+		stop:       make(chan struct{}),
+		ctx:        ctx,
+		cancel:     cancel,
+		running:    make(map[string]bool),
+	}
+}
+
+// Start starts reconciling the targets that have an interval in the
+// background. Runs a restart interrupted are marked as failed.
+func (r *Reconciler) Start() {
+	err := r.repo.FailRunningTargetReconciliations(r.ctx, repository.FailRunningTargetReconciliationsParams{
+		Error:          sql.NullString{String: "interrupted by a restart", Valid: true},
+		Completedonutc: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+	})
+	if err != nil {
+		slog.Error("failed to FailRunningTargetReconciliations", "error", err)
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.run()
+	}()
+}
+
+// Shutdown stops scheduling runs and waits for the runs in progress. Runs
+// still in progress when ctx is done are aborted and marked as failed.
+func (r *Reconciler) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	r.stopped = true
+	r.mu.Unlock()
+	close(r.stop)
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		r.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (r *Reconciler) run() {
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+
+	for {
+		r.schedule()
+
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// schedule starts the runs of the targets whose interval has passed since
+// they were last reconciled.
+func (r *Reconciler) schedule() {
+	targets, err := r.repo.GetScheduledReconciliationTargets(r.ctx)
+	if err != nil {
+		slog.Error("failed to GetScheduledReconciliationTargets", "error", err)
+		return
+	}
+
+	for _, t := range targets {
+		latest, err := r.repo.GetLatestTargetReconciliation(r.ctx, t.ID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			slog.Error("failed to GetLatestTargetReconciliation", "error", err, "targetid", t.ID)
+			continue
+		}
+		interval := time.Duration(t.ReconcileInterval.Int64) * time.Second
+		if err == nil && time.Since(latest.StartedOnUtc) < interval {
+			continue
+		}
+
+		_, err = r.Reconcile(t, TriggerSchedule, t.ReconcileRepair, "")
+		if err != nil && !errors.Is(err, errReconciling) {
+			slog.Error("Failed to start scheduled reconciliation", "error", err, "targetid", t.ID)
+		}
+	}
+}
+
+// Reconcile starts reconciling a target in the background and returns the
+// id of the run. userId is who started a manual run.
+func (r *Reconciler) Reconcile(t repository.Target, trigger string, repair bool, userId string) (string, error) {
+	if t.Type != TypeScim {
+		return "", errNotReconcilable
+	}
+	connector, err := newScimConnector(t, connectorDeps{repo: r.repo, transport: r.dispatcher.transport(t)})
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid target config: %w", errInvalidRequest, err)
+	}
+
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		return "", errStopping
+	}
+	if r.running[t.ID] {
+		r.mu.Unlock()
+		return "", errReconciling
+	}
+	r.running[t.ID] = true
+	r.wg.Add(1)
+	r.mu.Unlock()
+
+	done := func() {
+		r.mu.Lock()
+		delete(r.running, t.ID)
+		r.mu.Unlock()
+		r.wg.Done()
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		done()
+		return "", errors.New("failed to generate UUID for new reconciliation")
+	}
+	err = r.repo.CreateTargetReconciliation(r.ctx, repository.CreateTargetReconciliationParams{
+		ID:             id.String(),
+		Organisationid: t.OrganisationID,
+		Targetid:       t.ID,
+		Trigger:        trigger,
+		Repair:         repair,
+		Createdby:      sql.NullString{String: userId, Valid: userId != ""},
+		Startedonutc:   time.Now().UTC(),
+	})
+	if err != nil {
+		done()
+		return "", fmt.Errorf("failed to CreateTargetReconciliation: %w", err)
+	}
+
+	go func() {
+		defer done()
+		r.reconcile(id.String(), t, connector.(*scimConnector), repair)
+	}()
+	return id.String(), nil
+}
+
+// reconcile compares a target with the local state, repairs the drift if
+// asked to, and records the report.
+func (r *Reconciler) reconcile(id string, t repository.Target, c *scimConnector, repair bool) {
+	ctx, cancel := context.WithTimeout(r.ctx, reconcileTimeout)
+	defer cancel()
+
+	slog.Info("Reconciling target", "targetid", t.ID, "reconciliationid", id, "repair", repair)
+	drift, corrections, err := r.compare(ctx, t, c)
+	repaired := 0
+	if err == nil && repair {
+		repaired, err = r.repair(ctx, t, drift, corrections)
+	}
+
+	params := repository.CompleteTargetReconciliationParams{
+		Status:         ReconciliationCompleted,
+		Repaired:       int64(repaired),
+		Completedonutc: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		ID:             id,
+	}
+	for _, d := range drift {
+		switch d.Kind {
+		case DriftMissing:
+			params.Missing++
+		case DriftExtra:
+			params.Extra++
+		case DriftAttributes:
+			params.Changed++
+		case DriftMembers:
+			params.Membership++
+		}
+	}
+	if err != nil {
+		slog.Warn("Failed to reconcile target", "error", err, "targetid", t.ID, "reconciliationid", id)
+		params.Status = ReconciliationFailed
+		params.Error = sql.NullString{String: err.Error(), Valid: true}
+	} else {
+		slog.Info("Reconciled target", "targetid", t.ID, "reconciliationid", id, "drift", len(drift), "repaired", repaired)
+	}
+	if drift != nil {
+		report, _ := json.Marshal(drift)
+		params.Report = sql.NullString{String: string(report), Valid: true}
+	}
+
+	// The outcome is recorded even when shutdown aborted the run.
+	if err := r.repo.CompleteTargetReconciliation(context.WithoutCancel(ctx), params); err != nil {
+		slog.Error("failed to CompleteTargetReconciliation", "error", err, "reconciliationid", id)
+	}
+}
+
+// correction is the event that corrects the drift of a resource, and whether
+// the resource is in the scope of the target afterwards.
+type correction struct {
+	event   Event
+	inScope bool
+}
+
+// resourceKey identifies a resource across resource types.
+func resourceKey(resourceType, id string) string {
+	return resourceType + "/" + id
+}
+
+// remoteIds maps the local ids of the resources provisioned to a target to
+// their remote ids, and back.
+type remoteIds struct {
+	remote map[string]string
+	local  map[string]string
+}
+
+// compare lists the resources at a target and compares them with the local
+// resources, returning the drift and the events that would correct it keyed
+// by resource. Resources with events waiting in the outbox are skipped since
+// they are about to change.
+func (r *Reconciler) compare(ctx context.Context, t repository.Target, c *scimConnector) ([]Drift, map[string]correction, error) {
+	pending, err := r.repo.GetPendingOutboxResources(ctx, t.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to GetPendingOutboxResources: %w", err)
+	}
+	skip := make(map[string]bool, len(pending))
+	for _, p := range pending {
+		skip[resourceKey(p.ResourceType, p.ResourceID)] = true
+	}
+
+	ids := remoteIds{remote: make(map[string]string), local: make(map[string]string)}
+	for _, resourceType := range []string{ResourceUser, ResourceGroup} {
+		mappings, err := r.repo.GetTargetResourceMappings(ctx, repository.GetTargetResourceMappingsParams{
+			Targetid:     t.ID,
+			Resourcetype: resourceType,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to GetTargetResourceMappings: %w", err)
+		}
+		for _, m := range mappings {
+			ids.remote[resourceKey(resourceType, m.LocalID)] = m.RemoteID
+			ids.local[resourceKey(resourceType, m.RemoteID)] = m.LocalID
+		}
+	}
+
+	var drift []Drift
+	corrections := make(map[string]correction)
+	for _, resourceType := range []string{ResourceUser, ResourceGroup} {
+		d, err := r.compareType(ctx, t, c, resourceType, ids, skip, corrections)
+		if err != nil {
+			return drift, nil, err
+		}
+		drift = append(drift, d...)
+	}
+	return drift, corrections, nil
+}
+
+func (r *Reconciler) compareType(ctx context.Context, t repository.Target, c *scimConnector, resourceType string, ids remoteIds, skip map[string]bool, corrections map[string]correction) ([]Drift, error) {
+	endpoint, _ := resourceEndpoint(resourceType)
+	remote, err := c.list(ctx, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", endpoint, err)
+	}
+	remoteById := make(map[string]map[string]any, len(remote))
+	for _, resource := range remote {
+		if id, _ := resource["id"].(string); id != "" {
+			remoteById[id] = resource
+		}
+	}
+
+	local, err := r.localResources(ctx, t.OrganisationID, resourceType)
+	if err != nil {
+		return nil, err
+	}
+
+	var drift []Drift
+	seen := make(map[string]bool, len(local))
+	for _, id := range slices.Sorted(maps.Keys(local)) {
+		key := resourceKey(resourceType, id)
+		remoteId, mapped := ids.remote[key]
+		if mapped {
+			seen[remoteId] = true
+		}
+		if skip[key] {
+			continue
+		}
+		actual, exists := remoteById[remoteId]
+		exists = mapped && exists
+
+		event := Event{
+			OrganisationID: t.OrganisationID,
+			ResourceType:   resourceType,
+			ResourceID:     id,
+			Operation:      OperationReplace,
+			Resource:       local[id],
+		}
+		in, err := inScope(t, event)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate scope: %w", err)
+		}
+
+		if !in {
+			if !exists {
+				continue
+			}
+			d, fix, err := r.compareDeprovisioned(ctx, t, c, event, remoteId, actual)
+			if err != nil {
+				return nil, err
+			}
+			if d != nil {
+				drift = append(drift, *d)
+				corrections[key] = fix
+			}
+			continue
+		}
+
+		payload, err := mapResource(t.AttributeMapping.String, resourceType, event.Resource)
+		if err != nil {
+			return nil, fmt.Errorf("failed to map %s %s: %w", resourceType, id, err)
+		}
+		event.Resource = payload
+
+		if !exists {
+			event.Operation = OperationCreate
+			drift = append(drift, Drift{ResourceType: resourceType, Kind: DriftMissing, ResourceID: id})
+			corrections[key] = correction{event: event, inScope: true}
+			continue
+		}
+
+		expected, err := c.outboundResource(ctx, event)
+		if err != nil {
+			return nil, err
+		}
+		differences := diffResource(resourceType, expected, actual, ids)
+		for i := range differences {
+			differences[i].ResourceID = id
+			differences[i].RemoteID = remoteId
+		}
+		if len(differences) > 0 {
+			drift = append(drift, differences...)
+			corrections[key] = correction{event: event, inScope: true}
+		}
+	}
+
+	for _, resource := range remote {
+		remoteId, _ := resource["id"].(string)
+		if remoteId == "" || seen[remoteId] {
+			continue
+		}
+		// The local resource of a mapped remote resource has been deleted.
+		localId := ids.local[resourceKey(resourceType, remoteId)]
+		if localId != "" && skip[resourceKey(resourceType, localId)] {
+			continue
+		}
+		drift = append(drift, Drift{ResourceType: resourceType, Kind: DriftExtra, ResourceID: localId, RemoteID: remoteId})
+		if localId != "" {
+			corrections[resourceKey(resourceType, localId)] = correction{event: Event{
+				OrganisationID: t.OrganisationID,
+				ResourceType:   resourceType,
+				ResourceID:     localId,
+				Operation:      OperationDelete,
+			}}
+		}
+	}
+	return drift, nil
+}
+
+// compareDeprovisioned compares a resource that is out of the scope of a
+// target with what deprovisioning it leaves at the target, a deleted
+// resource or a disabled user. Disabled users are only expected to be
+// inactive, since they aren't updated once they leave the scope.
+func (r *Reconciler) compareDeprovisioned(ctx context.Context, t repository.Target, c *scimConnector, event Event, remoteId string, actual map[string]any) (*Drift, correction, error) {
+	deprovisioned, ok, err := deprovisionEvent(t, event)
+	if err != nil || !ok {
+		return nil, correction{}, err
+	}
+	if deprovisioned.Operation == OperationDelete {
+		d := &Drift{ResourceType: event.ResourceType, Kind: DriftExtra, ResourceID: event.ResourceID, RemoteID: remoteId}
+		return d, correction{event: deprovisioned}, nil
+	}
+
+	if active, _ := actual["active"].(bool); !active {
+		return nil, correction{}, nil
+	}
+	payload, err := mapResource(t.AttributeMapping.String, event.ResourceType, deprovisioned.Resource)
+	if err != nil {
+		return nil, correction{}, fmt.Errorf("failed to map %s %s: %w", event.ResourceType, event.ResourceID, err)
+	}
+	deprovisioned.Resource = payload
+	d := &Drift{
+		ResourceType: event.ResourceType,
+		Kind:         DriftAttributes,
+		ResourceID:   event.ResourceID,
+		RemoteID:     remoteId,
+		Attributes:   []AttributeDrift{{Attribute: "active", Expected: false, Actual: actual["active"]}},
+	}
+	return d, correction{event: deprovisioned}, nil
+}
+
+// localResources returns the SCIM representation of the local resources of a
+// type, by id.
+func (r *Reconciler) localResources(ctx context.Context, organisationId, resourceType string) (map[string]json.RawMessage, error) {
+	resources := make(map[string]json.RawMessage)
+	if resourceType == ResourceUser {
+		users, err := r.repo.GetAllScimUsers(ctx, organisationId)
+		if err != nil {
+			return nil, fmt.Errorf("failed to GetAllScimUsers: %w", err)
+		}
+		for _, u := range users {
+			resource, err := r.users(ctx, organisationId, u.ID)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to load user: %w", err)
+			}
+			resources[u.ID] = resource
+		}
+		return resources, nil
+	}
+
+	groups, err := r.repo.GetAllScimGroups(ctx, organisationId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetAllScimGroups: %w", err)
+	}
+	for _, g := range groups {
+		members, err := r.repo.GetGroupMembers(ctx, g.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to GetGroupMembers: %w", err)
+		}
+		resource, err := GroupResource(g, members)
+		if err != nil {
+			return nil, err
+		}
+		resources[g.ID] = resource
+	}
+	return resources, nil
+}
+
+// GroupResource is the SCIM representation of a stored group.
+func GroupResource(g repository.ScimGroup, members []repository.ScimUserGroupMembership) (json.RawMessage, error) {
+	memberList := make([]map[string]any, len(members))
+	for i, m := range members {
+		memberList[i] = map[string]any{"value": m.UserID, "type": ResourceUser}
+	}
+	resource := map[string]any{
+		"schemas":     []string{schema.Group},
+		"id":          g.ID,
+		"displayName": g.DisplayName,
+		"members":     memberList,
+	}
+	if g.ExternalID.Valid {
+		resource["externalId"] = g.ExternalID.String
+	}
+	return json.Marshal(resource)
+}
+
+// diffResource compares the payload a target would be sent for a resource
+// with the resource at the target. Only the attributes that are sent are
+// compared, the target may have others of its own. Group members are compared
+// by remote id.
+func diffResource(resourceType string, expected, actual map[string]any, ids remoteIds) []Drift {
+	var drift []Drift
+
+	var attributes []AttributeDrift
+	for _, name := range slices.Sorted(maps.Keys(expected)) {
+		switch name {
+		case "schemas", "password":
+			continue
+		case "members":
+			if resourceType == ResourceGroup {
+				continue
+			}
+		}
+		// Round trip the value so it compares like the decoded remote one.
+		var value any
+		if data, err := json.Marshal(expected[name]); err == nil {
+			json.Unmarshal(data, &value)
+		}
+		if !matches(value, actual[name]) {
+			attributes = append(attributes, AttributeDrift{Attribute: name, Expected: value, Actual: actual[name]})
+		}
+	}
+	if len(attributes) > 0 {
+		drift = append(drift, Drift{ResourceType: resourceType, Kind: DriftAttributes, Attributes: attributes})
+	}
+
+	if resourceType == ResourceGroup {
+		want := memberValues(expected["members"])
+		have := memberValues(actual["members"])
+		var missing, extra []string
+		for _, value := range slices.Sorted(maps.Keys(want)) {
+			if !have[value] {
+				missing = append(missing, ids.localMember(value))
+			}
+		}
+		for _, value := range slices.Sorted(maps.Keys(have)) {
+			if !want[value] {
+				extra = append(extra, ids.localMember(value))
+			}
+		}
+		if len(missing) > 0 || len(extra) > 0 {
+			drift = append(drift, Drift{ResourceType: resourceType, Kind: DriftMembers, MissingMembers: missing, ExtraMembers: extra})
+		}
+	}
+	return drift
+}
+
+// localMember returns the local id of a remote member, or the remote id if
+// it isn't mapped.
+func (ids remoteIds) localMember(remoteId string) string {
+	for _, resourceType := range []string{ResourceUser, ResourceGroup} {
+		if localId, ok := ids.local[resourceKey(resourceType, remoteId)]; ok {
+			return localId
+		}
+	}
+	return remoteId
+}
+
+// memberValues returns the set of ids in a members attribute.
+func memberValues(members any) map[string]bool {
+	values := make(map[string]bool)
+	switch list := members.(type) {
+	case []map[string]any:
+		for _, m := range list {
+			if value, _ := m["value"].(string); value != "" {
+				values[value] = true
+			}
+		}
+	case []any:
+		for _, m := range list {
+			member, _ := m.(map[string]any)
+			if value, _ := member["value"].(string); value != "" {
+				values[value] = true
+			}
+		}
+	}
+	return values
+}
+
+// matches reports whether the value at a target matches the expected value.
+// Complex values match when the sub-attributes that are expected match, and
+// multi-valued attributes when every expected value matches a value at the
+// target, in any order. Empty values match absent ones.
+func matches(expected, actual any) bool {
+	switch e := expected.(type) {
+	case nil:
+		return isEmpty(actual)
+	case string:
+		if e == "" {
+			return isEmpty(actual)
+		}
+		a, ok := actual.(string)
+		return ok && a == e
+	case map[string]any:
+		a, _ := actual.(map[string]any)
+		for k, v := range e {
+			if !matches(v, a[k]) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		a, _ := actual.([]any)
+		if len(a) != len(e) {
+			return false
+		}
+		for _, ev := range e {
+			if !slices.ContainsFunc(a, func(av any) bool { return matches(ev, av) }) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(expected, actual)
+}
+
+// repair queues the corrections of the drift and returns how many resources
+// were corrected. Unmapped remote resources aren't deleted, they may belong to
+// another client of the target.
+func (r *Reconciler) repair(ctx context.Context, t repository.Target, drift []Drift, corrections map[string]correction) (int, error) {
+	queued := make(map[string]bool)
+	for i, d := range drift {
+		if d.ResourceID == "" {
+			continue
+		}
+		key := resourceKey(d.ResourceType, d.ResourceID)
+		fix, ok := corrections[key]
+		if !ok {
+			continue
+		}
+		if !queued[key] {
+			if err := r.enqueue(ctx, t, fix); err != nil {
+				return len(queued), err
+			}
+			queued[key] = true
+		}
+		drift[i].Repaired = true
+	}
+
+	if len(queued) > 0 {
+		r.dispatcher.Notify()
+	}
+	return len(queued), nil
+}
+
+// enqueue writes a correction to the outbox of the target, or records it for
+// targets in shadow mode, keeping track of the resources in its scope like
+// events of changes do.
+func (r *Reconciler) enqueue(ctx context.Context, t repository.Target, fix correction) error {
+	event := fix.event
+	if fix.inScope {
+		err := r.repo.CreateTargetScopedResource(ctx, repository.CreateTargetScopedResourceParams{
+			Targetid:     t.ID,
+			Resourcetype: event.ResourceType,
+			Resourceid:   event.ResourceID,
+			Createdonutc: time.Now().UTC(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to CreateTargetScopedResource: %w", err)
+		}
+	} else {
+		err := r.repo.DeleteTargetScopedResource(ctx, repository.DeleteTargetScopedResourceParams{
+			Targetid:     t.ID,
+			Resourcetype: event.ResourceType,
+			Resourceid:   event.ResourceID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to DeleteTargetScopedResource: %w", err)
+		}
+	}
+
+	return writeEvent(ctx, r.repo, t, event)
+}
+
+// list pages through the resources at an endpoint of the target.
+func (c *scimConnector) list(ctx context.Context, endpoint string) ([]map[string]any, error) {
+	var resources []map[string]any
+	startIndex := 1
+	for {
+		var page struct {
+			TotalResults int              `json:"totalResults"`
+			Resources    []map[string]any `json:"Resources"`
+		}
+		url := fmt.Sprintf("%s/%s?startIndex=%d&count=%d", c.config.BaseURL, endpoint, startIndex, listPageSize)
+		if err := c.doJSON(ctx, http.MethodGet, url, &page); err != nil {
+			return nil, err
+		}
+
+		resources = append(resources, page.Resources...)
+		startIndex += len(page.Resources)
+		if len(page.Resources) == 0 || startIndex > page.TotalResults {
+			return resources, nil
+		}
+	}
+}
@@ -0,0 +1,578 @@
+package target
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/repository"
+)
+
+const schemaPatchOp = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+
+// scimConfig is the config of a scim target.
+type scimConfig struct {
+	BaseURL     string `json:"baseUrl"`
+	BearerToken string `json:"bearerToken,omitempty"`
+}
+
+// scimConnector provisions Users and Groups to a SCIM 2.0 service provider.
+// The remote id of every resource it provisions is kept in
+// target_resource_mappings. Resources without a mapping are looked up by
+// externalId and userName, or displayName for groups, before they are
+// created, so existing remote resources are adopted instead of duplicated.
+type scimConnector struct {
+	targetID string
+	config   scimConfig
+	client   *http.Client
+	repo     repository.Querier
+}
+
+func newScimConnector(t repository.Target, deps connectorDeps) (Connector, error) {
+	var config scimConfig
+	if err := json.Unmarshal([]byte(t.Config), &config); err != nil {
+		return nil, fmt.Errorf("invalid scim config: %w", err)
+	}
+
+	u, err := url.Parse(config.BaseURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, errors.New("baseUrl must be an http or https URL")
+	}
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+
+	return &scimConnector{
+		targetID: t.ID,
+		config:   config,
+		client:   &http.Client{Timeout: 30 * time.Second, Transport: deps.transport},
+		repo:     deps.repo,
+	}, nil
+}
+
+// scimError is the error response of a SCIM service provider.
+type scimError struct {
+	Status int
+	Detail string
+}
+
+func (e *scimError) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("scim target returned %d", e.Status)
+	}
+	return fmt.Sprintf("scim target returned %d: %s", e.Status, e.Detail)
+}
+
+func isStatus(err error, status int) bool {
+	var scimErr *scimError
+	return errors.As(err, &scimErr) && scimErr.Status == status
+}
+
+// remoteResource is the part of a remote resource the connector needs.
+type remoteResource struct {
+	ID   string `json:"id"`
+	Meta struct {
+		Version string `json:"version"`
+	} `json:"meta"`
+}
+
+func (c *scimConnector) Apply(ctx context.Context, event Event) error {
+	endpoint, err := resourceEndpoint(event.ResourceType)
+	if err != nil {
+		return err
+	}
+
+	switch event.Operation {
+	case OperationCreate, OperationReplace:
+		return c.upsert(ctx, endpoint, event)
+	case OperationDelete:
+		return c.delete(ctx, endpoint, event)
+	default:
+		return fmt.Errorf("unsupported operation %q", event.Operation)
+	}
+}
+
+func resourceEndpoint(resourceType string) (string, error) {
+	switch resourceType {
+	case ResourceUser:
+		return "Users", nil
+	case ResourceGroup:
+		return "Groups", nil
+	}
+	return "", fmt.Errorf("unsupported resource type %q", resourceType)
+}
+
+// upsert makes the remote resource match the event, patching the mapped
+// remote resource or creating it when there is none.
+func (c *scimConnector) upsert(ctx context.Context, endpoint string, event Event) error {
+	attributes, err := c.outboundResource(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	mapping, err := c.repo.GetTargetResourceMapping(ctx, repository.GetTargetResourceMappingParams{
+		Targetid:     c.targetID,
+		Resourcetype: event.ResourceType,
+		Localid:      event.ResourceID,
+	})
+	switch {
+	case err == nil:
+		var sent map[string]any
+		if mapping.SentAttributes.Valid {
+			if err := json.Unmarshal([]byte(mapping.SentAttributes.String), &sent); err != nil {
+				slog.Warn("Invalid attributes stored for mapped resource, not removing cleared attributes", "targetid", c.targetID,
+					"resourceType", event.ResourceType, "resourceId", event.ResourceID, "error", err)
+			}
+		}
+		err = c.patch(ctx, endpoint, event, mapping.RemoteID, mapping.RemoteVersion.String, sent, attributes)
+		if !isStatus(err, http.StatusNotFound) {
+			return err
+		}
+		// The remote resource has been deleted, provision it again.
+		slog.Info("Mapped remote resource is gone, provisioning it again", "targetid", c.targetID,
+			"resourceType", event.ResourceType, "resourceId", event.ResourceID, "remoteId", mapping.RemoteID)
+		if err := c.deleteMapping(ctx, event); err != nil {
+			return err
+		}
+	case !errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("failed to GetTargetResourceMapping: %w", err)
+	}
+
+	remote, found, err := c.find(ctx, endpoint, event.ResourceType, attributes)
+	if err != nil {
+		return err
+	}
+	if found {
+		return c.adopt(ctx, endpoint, event, remote, attributes)
+	}
+
+	remote, err = c.create(ctx, endpoint, attributes)
+	if isStatus(err, http.StatusConflict) {
+		// Another client created the resource since it was looked up.
+		remote, found, findErr := c.find(ctx, endpoint, event.ResourceType, attributes)
+		if findErr != nil {
+			return findErr
+		}
+		if !found {
+			return fmt.Errorf("%w: %w, and no remote resource matches the filters", ErrPermanent, err)
+		}
+		return c.adopt(ctx, endpoint, event, remote, attributes)
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.saveMapping(ctx, event, remote, attributes)
+}
+
+// adopt maps an existing remote resource and patches it. What the remote
+// resource has that the local one doesn't is left alone, since it may not
+// be managed by scimtiplexer.
+func (c *scimConnector) adopt(ctx context.Context, endpoint string, event Event, remote remoteResource, attributes map[string]any) error {
+	if err := c.saveMapping(ctx, event, remote, nil); err != nil {
+		return err
+	}
+	return c.patch(ctx, endpoint, event, remote.ID, remote.Meta.Version, nil, attributes)
+}
+
+func (c *scimConnector) create(ctx context.Context, endpoint string, attributes map[string]any) (remoteResource, error) {
+	body, err := json.Marshal(attributes)
+	if err != nil {
+		return remoteResource{}, err
+	}
+
+	remote, err := c.do(ctx, http.MethodPost, c.config.BaseURL+"/"+endpoint, body, "")
+	if err != nil {
+		return remoteResource{}, err
+	}
+	if remote.ID == "" {
+		return remoteResource{}, errors.New("scim target did not return the id of the created resource")
+	}
+	return remote, nil
+}
+
+// patch replaces the attributes of a remote resource, and removes the
+// attributes that were sent before but are cleared now. When the version of
+// the remote resource is known it is sent in If-Match, and a 412 fetches the
+// current version and tries once more.
+func (c *scimConnector) patch(ctx context.Context, endpoint string, event Event, remoteId, version string, sent, attributes map[string]any) error {
+	body, err := json.Marshal(map[string]any{
+		"schemas":    []string{schemaPatchOp},
+		"Operations": patchOperations(sent, attributes),
+	})
+	if err != nil {
+		return err
+	}
+
+	resourceUrl := c.config.BaseURL + "/" + endpoint + "/" + url.PathEscape(remoteId)
+	remote, err := c.do(ctx, http.MethodPatch, resourceUrl, body, version)
+	if isStatus(err, http.StatusPreconditionFailed) {
+		current, getErr := c.do(ctx, http.MethodGet, resourceUrl, nil, "")
+		if getErr != nil {
+			return getErr
+		}
+		remote, err = c.do(ctx, http.MethodPatch, resourceUrl, body, current.Meta.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	remote.ID = remoteId
+	return c.saveMapping(ctx, event, remote, attributes)
+}
+
+// patchOperations returns the operations that make a remote resource that
+// was sent the sent attributes match attributes: a remove for every
+// attribute path that had a value and has none now, and a replace of the
+// attributes that have a value. A replace leaves the sub-attributes of a
+// complex attribute that aren't in its value alone, so those are removed
+// one by one.
+func patchOperations(sent, attributes map[string]any) []map[string]any {
+	var operations []map[string]any
+	current := attributePaths(attributes)
+	var removed []string
+	for path := range attributePaths(sent) {
+		if !current[path] {
+			removed = append(removed, path)
+		}
+	}
+	slices.Sort(removed)
+	for _, path := range removed {
+		operations = append(operations, map[string]any{"op": "remove", "path": path})
+	}
+
+	value := make(map[string]any, len(attributes))
+	for k, v := range attributes {
+		if k == "schemas" {
+			continue
+		}
+		if object, ok := v.(map[string]any); ok {
+			v = withoutEmpty(object)
+		}
+		if !hasNoValue(v) {
+			value[k] = v
+		}
+	}
+	if len(value) > 0 {
+		operations = append(operations, map[string]any{"op": "replace", "value": value})
+	}
+	return operations
+}
+
+// attributePaths returns the SCIM attribute paths of a resource that have a
+// value. The sub-attributes of complex attributes are paths of their own,
+// like name.givenName, and so are the attributes of schema extensions, like
+// urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department.
+// Multi-valued attributes are a single path.
+func attributePaths(attributes map[string]any) map[string]bool {
+	paths := make(map[string]bool)
+	for key, value := range attributes {
+		if key == "schemas" || hasNoValue(value) {
+			continue
+		}
+		object, ok := value.(map[string]any)
+		if !ok {
+			paths[key] = true
+			continue
+		}
+		separator := "."
+		if strings.HasPrefix(key, "urn:") {
+			separator = ":"
+		}
+		for sub, subValue := range object {
+			if !hasNoValue(subValue) {
+				paths[key+separator+sub] = true
+			}
+		}
+	}
+	return paths
+}
+
+// withoutEmpty returns the attributes of a complex attribute that have a
+// value.
+func withoutEmpty(object map[string]any) map[string]any {
+	result := make(map[string]any, len(object))
+	for k, v := range object {
+		if !hasNoValue(v) {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// hasNoValue reports whether a JSON value is null, an empty string, an empty
+// array, or an object without values. false and 0 are values.
+func hasNoValue(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []any:
+		return len(v) == 0
+	case []map[string]any:
+		return len(v) == 0
+	case map[string]any:
+		return len(withoutEmpty(v)) == 0
+	}
+	return false
+}
+
+func (c *scimConnector) delete(ctx context.Context, endpoint string, event Event) error {
+	mapping, err := c.repo.GetTargetResourceMapping(ctx, repository.GetTargetResourceMappingParams{
+		Targetid:     c.targetID,
+		Resourcetype: event.ResourceType,
+		Localid:      event.ResourceID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		slog.Debug("Resource was never provisioned to target, nothing to delete", "targetid", c.targetID,
+			"resourceType", event.ResourceType, "resourceId", event.ResourceID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to GetTargetResourceMapping: %w", err)
+	}
+
+	_, err = c.do(ctx, http.MethodDelete, c.config.BaseURL+"/"+endpoint+"/"+url.PathEscape(mapping.RemoteID), nil, "")
+	if err != nil && !isStatus(err, http.StatusNotFound) {
+		return err
+	}
+	return c.deleteMapping(ctx, event)
+}
+
+// find looks up an existing remote resource by externalId, and then by
+// userName or displayName.
+func (c *scimConnector) find(ctx context.Context, endpoint, resourceType string, attributes map[string]any) (remoteResource, bool, error) {
+	var filters []string
+	if externalId, _ := attributes["externalId"].(string); externalId != "" {
+		filters = append(filters, eqFilter("externalId", externalId))
+	}
+	nameAttribute := "userName"
+	if resourceType == ResourceGroup {
+		nameAttribute = "displayName"
+	}
+	if name, _ := attributes[nameAttribute].(string); name != "" {
+		filters = append(filters, eqFilter(nameAttribute, name))
+	}
+
+	for _, filter := range filters {
+		var list struct {
+			TotalResults int              `json:"totalResults"`
+			Resources    []remoteResource `json:"Resources"`
+		}
+		err := c.doJSON(ctx, http.MethodGet, c.config.BaseURL+"/"+endpoint+"?filter="+url.QueryEscape(filter), &list)
+		if err != nil {
+			return remoteResource{}, false, err
+		}
+		switch {
+		case len(list.Resources) == 1:
+			return list.Resources[0], true, nil
+		case len(list.Resources) > 1:
+			return remoteResource{}, false, fmt.Errorf("%w: %d remote resources match %s", ErrPermanent, len(list.Resources), filter)
+		}
+	}
+	return remoteResource{}, false, nil
+}
+
+// eqFilter builds an eq filter, escaping the value as a JSON string.
+func eqFilter(attribute, value string) string {
+	quoted, _ := json.Marshal(value)
+	return attribute + " eq " + string(quoted)
+}
+
+// outboundResource is the SCIM representation sent to the target. The
+// attributes the service provider assigns itself are removed, and group
+// members are translated to their remote ids.
+func (c *scimConnector) outboundResource(ctx context.Context, event Event) (map[string]any, error) {
+	var attributes map[string]any
+	if err := json.Unmarshal(event.Resource, &attributes); err != nil {
+		return nil, fmt.Errorf("invalid resource: %w", err)
+	}
+	delete(attributes, "id")
+	delete(attributes, "meta")
+
+	switch event.ResourceType {
+	case ResourceUser:
+		// Group membership is managed through the groups.
+		delete(attributes, "groups")
+	case ResourceGroup:
+		members, err := c.remoteMembers(ctx, attributes["members"])
+		if err != nil {
+			return nil, err
+		}
+		attributes["members"] = members
+	}
+	return attributes, nil
+}
+
+func (c *scimConnector) remoteMembers(ctx context.Context, members any) ([]map[string]any, error) {
+	list, _ := members.([]any)
+	remote := make([]map[string]any, 0, len(list))
+	for _, m := range list {
+		member, ok := m.(map[string]any)
+		if !ok {
+			continue
+		}
+		localId, _ := member["value"].(string)
+		resourceType := ResourceUser
+		if t, _ := member["type"].(string); t == ResourceGroup {
+			resourceType = ResourceGroup
+		}
+
+		mapping, err := c.repo.GetTargetResourceMapping(ctx, repository.GetTargetResourceMappingParams{
+			Targetid:     c.targetID,
+			Resourcetype: resourceType,
+			Localid:      localId,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			slog.Warn("Group member has not been provisioned to target, leaving it out", "targetid", c.targetID,
+				"memberType", resourceType, "memberId", localId)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to GetTargetResourceMapping: %w", err)
+		}
+
+		remoteMember := map[string]any{"value": mapping.RemoteID}
+		if display, ok := member["display"]; ok {
+			remoteMember["display"] = display
+		}
+		if t, ok := member["type"]; ok {
+			remoteMember["type"] = t
+		}
+		remote = append(remote, remoteMember)
+	}
+	return remote, nil
+}
+
+// saveMapping records the remote resource a local one is provisioned as, and
+// the attributes that were sent to it, nil if none have been yet.
+func (c *scimConnector) saveMapping(ctx context.Context, event Event, remote remoteResource, sent map[string]any) error {
+	var sentAttributes sql.NullString
+	if sent != nil {
+		data, err := json.Marshal(sent)
+		if err != nil {
+			return fmt.Errorf("failed to marshal sent attributes: %w", err)
+		}
+		sentAttributes = sql.NullString{String: string(data), Valid: true}
+	}
+
+	now := time.Now().UTC()
+	err := c.repo.UpsertTargetResourceMapping(ctx, repository.UpsertTargetResourceMappingParams{
+		Targetid:       c.targetID,
+		Resourcetype:   event.ResourceType,
+		Localid:        event.ResourceID,
+		Remoteid:       remote.ID,
+		Remoteversion:  sql.NullString{String: remote.Meta.Version, Valid: remote.Meta.Version != ""},
+		Sentattributes: sentAttributes,
+		Createdonutc:   now,
+		Modifiedonutc:  now,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to UpsertTargetResourceMapping: %w", err)
+	}
+	return nil
+}
+
+func (c *scimConnector) deleteMapping(ctx context.Context, event Event) error {
+	err := c.repo.DeleteTargetResourceMapping(ctx, repository.DeleteTargetResourceMappingParams{
+		Targetid:     c.targetID,
+		Resourcetype: event.ResourceType,
+		Localid:      event.ResourceID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to DeleteTargetResourceMapping: %w", err)
+	}
+	return nil
+}
+
+// do sends a request and returns the resource in the response. The version
+// is taken from the ETag header when the body doesn't carry one.
+func (c *scimConnector) do(ctx context.Context, method, url string, body []byte, ifMatch string) (remoteResource, error) {
+	var remote remoteResource
+	resp, err := c.send(ctx, method, url, body, ifMatch, &remote)
+	if err != nil {
+		return remoteResource{}, err
+	}
+	if remote.Meta.Version == "" {
+		remote.Meta.Version = resp.Header.Get("ETag")
+	}
+	return remote, nil
+}
+
+func (c *scimConnector) doJSON(ctx context.Context, method, url string, out any) error {
+	_, err := c.send(ctx, method, url, nil, "", out)
+	return err
+}
+
+func (c *scimConnector) send(ctx context.Context, method, url string, body []byte, ifMatch string, out any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/scim+json, application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/scim+json")
+	}
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	if c.config.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.config.BearerToken)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("scim target request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scim target response: %w", err)
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if out != nil && len(bytes.TrimSpace(data)) > 0 {
+			if err := json.Unmarshal(data, out); err != nil {
+				return nil, fmt.Errorf("invalid scim target response: %w", err)
+			}
+		}
+		return resp, nil
+	}
+
+	var errResp struct {
+		Detail string `json:"detail"`
+	}
+	json.Unmarshal(data, &errResp)
+	scimErr := &scimError{Status: resp.StatusCode, Detail: errResp.Detail}
+	if isPermanentStatus(resp.StatusCode) {
+		return nil, fmt.Errorf("%w: %w", ErrPermanent, scimErr)
+	}
+	return nil, scimErr
+}
+
+// isPermanentStatus reports whether a request rejected with the status will
+// be rejected again. Authentication failures are retried since they are
+// fixed by correcting the target config, and a 412 that survives a refetch
+// is retried since the resource may settle.
+func isPermanentStatus(status int) bool {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout,
+		http.StatusPreconditionFailed, http.StatusTooManyRequests:
+		return false
+	}
+	return status >= 400 && status < 500
+}
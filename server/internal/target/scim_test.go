@@ -0,0 +1,498 @@
+package target
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jawee/scimtiplexer/internal/database/databasetest"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scimStandIn is a SCIM service provider keeping Users and Groups in memory.
+// Resources are versioned and PATCH honours If-Match.
+type scimStandIn struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	resources map[string]map[string]map[string]any
+	versions  map[string]int
+	nextId    int
+	requests  []string
+	ifMatch   []string
+
+	// filterMisses is how many filter queries find nothing, as if the
+	// resource was created by another client after the lookup.
+	filterMisses int
+}
+
+var filterPattern = regexp.MustCompile(`^(\w+) eq "(.*)"$`)
+
+func newScimStandIn(t *testing.T) *scimStandIn {
+	s := &scimStandIn{
+		resources: map[string]map[string]map[string]any{"Users": {}, "Groups": {}},
+		versions:  make(map[string]int),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *scimStandIn) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	resources, ok := s.resources[parts[0]]
+	if !ok {
+		writeScim(w, http.StatusNotFound, map[string]any{"detail": "unknown endpoint"})
+		return
+	}
+
+	if len(parts) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			s.list(w, resources, r.URL.Query().Get("filter"))
+		case http.MethodPost:
+			s.create(w, r, parts[0], resources)
+		}
+		return
+	}
+
+	id := parts[1]
+	resource, ok := resources[id]
+	if !ok {
+		writeScim(w, http.StatusNotFound, map[string]any{"detail": "resource not found"})
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeScim(w, http.StatusOK, resource)
+	case http.MethodDelete:
+		delete(resources, id)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPatch:
+		s.ifMatch = append(s.ifMatch, r.Header.Get("If-Match"))
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != s.version(id) {
+			writeScim(w, http.StatusPreconditionFailed, map[string]any{"detail": "version mismatch"})
+			return
+		}
+		var patch struct {
+			Operations []struct {
+				Op    string         `json:"op"`
+				Path  string         `json:"path"`
+				Value map[string]any `json:"value"`
+			}
+		}
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			writeScim(w, http.StatusBadRequest, map[string]any{"detail": err.Error()})
+			return
+		}
+		for _, op := range patch.Operations {
+			switch op.Op {
+			case "replace":
+				replaceAttributes(resource, op.Value)
+			case "remove":
+				removeAttribute(resource, op.Path)
+			}
+		}
+		s.bump(id)
+		writeScim(w, http.StatusOK, resource)
+	}
+}
+
+func (s *scimStandIn) list(w http.ResponseWriter, resources map[string]map[string]any, filter string) {
+	found := []map[string]any{}
+	match := filterPattern.FindStringSubmatch(filter)
+	if s.filterMisses > 0 {
+		s.filterMisses--
+		match = nil
+	}
+	if match != nil {
+		for _, resource := range resources {
+			if resource[match[1]] == match[2] {
+				found = append(found, resource)
+			}
+		}
+	}
+	writeScim(w, http.StatusOK, map[string]any{"totalResults": len(found), "Resources": found})
+}
+
+func (s *scimStandIn) create(w http.ResponseWriter, r *http.Request, endpoint string, resources map[string]map[string]any) {
+	var resource map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&resource); err != nil {
+		writeScim(w, http.StatusBadRequest, map[string]any{"detail": err.Error()})
+		return
+	}
+	nameAttribute := "userName"
+	if endpoint == "Groups" {
+		nameAttribute = "displayName"
+	}
+	for _, existing := range resources {
+		if existing[nameAttribute] == resource[nameAttribute] {
+			writeScim(w, http.StatusConflict, map[string]any{"detail": "uniqueness"})
+			return
+		}
+	}
+
+	s.nextId++
+	id := fmt.Sprintf("remote-%d", s.nextId)
+	resource["id"] = id
+	resources[id] = resource
+	s.bump(id)
+	writeScim(w, http.StatusCreated, resource)
+}
+
+func (s *scimStandIn) version(id string) string {
+	return fmt.Sprintf(`W/"%d"`, s.versions[id])
+}
+
+// bump changes the version of a resource, the caller must hold s.mu.
+func (s *scimStandIn) bump(id string) {
+	s.versions[id]++
+	for _, resources := range s.resources {
+		if resource, ok := resources[id]; ok {
+			resource["meta"] = map[string]any{"version": s.version(id)}
+		}
+	}
+}
+
+// put stores a resource as if another client created it.
+func (s *scimStandIn) put(endpoint, id string, resource map[string]any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resource["id"] = id
+	s.resources[endpoint][id] = resource
+	s.bump(id)
+}
+
+// touch changes a resource as if another client modified it.
+func (s *scimStandIn) touch(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bump(id)
+}
+
+func (s *scimStandIn) remove(endpoint, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.resources[endpoint], id)
+}
+
+func (s *scimStandIn) get(endpoint, id string) map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.resources[endpoint][id]
+}
+
+func (s *scimStandIn) count(endpoint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.resources[endpoint])
+}
+
+// takeRequests returns the requests received since the last call.
+func (s *scimStandIn) takeRequests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	requests := s.requests
+	s.requests = nil
+	return requests
+}
+
+func replaceAttributes(resource, value map[string]any) {
+	for key, v := range value {
+		current, currentOk := resource[key].(map[string]any)
+		sub, subOk := v.(map[string]any)
+		if currentOk && subOk && key != "manager" {
+			// Sub-attributes that aren't in the value are left alone.
+			replaceAttributes(current, sub)
+			continue
+		}
+		resource[key] = v
+	}
+}
+
+func removeAttribute(resource map[string]any, path string) {
+	if i := strings.LastIndex(path, ":"); i >= 0 {
+		if extension, ok := resource[path[:i]].(map[string]any); ok {
+			delete(extension, path[i+1:])
+		}
+		return
+	}
+	if attribute, sub, ok := strings.Cut(path, "."); ok {
+		if complex, ok := resource[attribute].(map[string]any); ok {
+			delete(complex, sub)
+		}
+		return
+	}
+	delete(resource, path)
+}
+
+func writeScim(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+const testTargetId = "target-1"
+
+func newTestScimConnector(t *testing.T, standIn *scimStandIn) (Connector, repository.Querier) {
+	repo := databasetest.New(t).GetRepository()
+	connector, err := newScimConnector(repository.Target{
+		ID:     testTargetId,
+		Type:   TypeScim,
+		Config: `{"baseUrl": "` + standIn.URL + `"}`,
+	}, connectorDeps{repo: repo})
+	require.NoError(t, err)
+	return connector, repo
+}
+
+func userEvent(t *testing.T, operation Operation, id string, resource map[string]any) Event {
+	event := Event{OrganisationID: "org-1", ResourceType: ResourceUser, ResourceID: id, Operation: operation}
+	if resource != nil {
+		resource["id"] = id
+		data, err := json.Marshal(resource)
+		require.NoError(t, err)
+		event.Resource = data
+	}
+	return event
+}
+
+func mappedRemoteId(t *testing.T, repo repository.Querier, resourceType, localId string) string {
+	mapping, err := repo.GetTargetResourceMapping(context.Background(), repository.GetTargetResourceMappingParams{
+		Targetid:     testTargetId,
+		Resourcetype: resourceType,
+		Localid:      localId,
+	})
+	require.NoError(t, err)
+	return mapping.RemoteID
+}
+
+func TestScimConnectorCreate(t *testing.T) {
+	standIn := newScimStandIn(t)
+	connector, repo := newTestScimConnector(t, standIn)
+
+	err := connector.Apply(context.Background(), userEvent(t, OperationCreate, "local-1", map[string]any{
+		"userName": "alice",
+		"active":   true,
+		"meta":     map[string]any{"version": "local"},
+		"groups":   []any{map[string]any{"value": "group-1"}},
+	}))
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"GET /Users", "POST /Users"}, standIn.takeRequests())
+	remoteId := mappedRemoteId(t, repo, ResourceUser, "local-1")
+	remote := standIn.get("Users", remoteId)
+	assert.Equal(t, "alice", remote["userName"])
+	assert.NotContains(t, remote, "groups", "group membership is managed through the groups")
+	assert.Equal(t, map[string]any{"version": `W/"1"`}, remote["meta"])
+}
+
+func TestScimConnectorAdoptsExistingResource(t *testing.T) {
+	standIn := newScimStandIn(t)
+	connector, repo := newTestScimConnector(t, standIn)
+	standIn.put("Users", "existing", map[string]any{"userName": "alice", "title": "Set elsewhere"})
+
+	err := connector.Apply(context.Background(), userEvent(t, OperationCreate, "local-1", map[string]any{"userName": "alice", "displayName": "Alice"}))
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"GET /Users", "PATCH /Users/existing"}, standIn.takeRequests())
+	assert.Equal(t, "existing", mappedRemoteId(t, repo, ResourceUser, "local-1"))
+	assert.Equal(t, "Alice", standIn.get("Users", "existing")["displayName"])
+	assert.Equal(t, "Set elsewhere", standIn.get("Users", "existing")["title"], "attributes never sent are left alone")
+}
+
+func TestScimConnectorAdoptsAfterConflict(t *testing.T) {
+	standIn := newScimStandIn(t)
+	connector, repo := newTestScimConnector(t, standIn)
+	standIn.put("Users", "existing", map[string]any{"userName": "alice"})
+	standIn.filterMisses = 1
+
+	err := connector.Apply(context.Background(), userEvent(t, OperationCreate, "local-1", map[string]any{"userName": "alice", "displayName": "Alice"}))
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"GET /Users", "POST /Users", "GET /Users", "PATCH /Users/existing"}, standIn.takeRequests())
+	assert.Equal(t, "existing", mappedRemoteId(t, repo, ResourceUser, "local-1"))
+	assert.Equal(t, 1, standIn.count("Users"))
+	assert.Equal(t, "Alice", standIn.get("Users", "existing")["displayName"])
+}
+
+func TestScimConnectorConflictWithoutMatchIsPermanent(t *testing.T) {
+	standIn := newScimStandIn(t)
+	connector, _ := newTestScimConnector(t, standIn)
+	standIn.put("Users", "existing", map[string]any{"userName": "alice"})
+	standIn.filterMisses = 2
+
+	err := connector.Apply(context.Background(), userEvent(t, OperationCreate, "local-1", map[string]any{"userName": "alice"}))
+
+	assert.ErrorIs(t, err, ErrPermanent)
+}
+
+func TestScimConnectorRetriesPreconditionFailed(t *testing.T) {
+	standIn := newScimStandIn(t)
+	connector, _ := newTestScimConnector(t, standIn)
+	ctx := context.Background()
+	require.NoError(t, connector.Apply(ctx, userEvent(t, OperationCreate, "local-1", map[string]any{"userName": "alice"})))
+	standIn.takeRequests()
+
+	// Another client changes the remote resource, so the mapped version is
+	// stale.
+	standIn.touch("remote-1")
+	err := connector.Apply(ctx, userEvent(t, OperationReplace, "local-1", map[string]any{"userName": "alice", "title": "Engineer"}))
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"PATCH /Users/remote-1", "GET /Users/remote-1", "PATCH /Users/remote-1"}, standIn.takeRequests())
+	assert.Equal(t, []string{`W/"1"`, `W/"2"`}, standIn.ifMatch)
+	assert.Equal(t, "Engineer", standIn.get("Users", "remote-1")["title"])
+
+	// The version the patch returned is mapped, the next patch matches.
+	require.NoError(t, connector.Apply(ctx, userEvent(t, OperationReplace, "local-1", map[string]any{"userName": "alice", "title": "Manager"})))
+	assert.Equal(t, []string{"PATCH /Users/remote-1"}, standIn.takeRequests())
+}
+
+func TestScimConnectorProvisionsAgainAfterNotFound(t *testing.T) {
+	standIn := newScimStandIn(t)
+	connector, repo := newTestScimConnector(t, standIn)
+	ctx := context.Background()
+	require.NoError(t, connector.Apply(ctx, userEvent(t, OperationCreate, "local-1", map[string]any{"userName": "alice"})))
+	standIn.takeRequests()
+
+	standIn.remove("Users", "remote-1")
+	err := connector.Apply(ctx, userEvent(t, OperationReplace, "local-1", map[string]any{"userName": "alice", "title": "Engineer"}))
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"PATCH /Users/remote-1", "GET /Users", "POST /Users"}, standIn.takeRequests())
+	assert.Equal(t, "remote-2", mappedRemoteId(t, repo, ResourceUser, "local-1"))
+	assert.Equal(t, "Engineer", standIn.get("Users", "remote-2")["title"])
+}
+
+func TestScimConnectorDelete(t *testing.T) {
+	standIn := newScimStandIn(t)
+	connector, repo := newTestScimConnector(t, standIn)
+	ctx := context.Background()
+	require.NoError(t, connector.Apply(ctx, userEvent(t, OperationCreate, "local-1", map[string]any{"userName": "alice"})))
+	standIn.takeRequests()
+
+	require.NoError(t, connector.Apply(ctx, userEvent(t, OperationDelete, "local-1", nil)))
+
+	assert.Equal(t, []string{"DELETE /Users/remote-1"}, standIn.takeRequests())
+	assert.Equal(t, 0, standIn.count("Users"))
+	_, err := repo.GetTargetResourceMapping(ctx, repository.GetTargetResourceMappingParams{
+		Targetid:     testTargetId,
+		Resourcetype: ResourceUser,
+		Localid:      "local-1",
+	})
+	assert.Error(t, err, "mapping is deleted")
+}
+
+func TestScimConnectorDeleteWithoutMapping(t *testing.T) {
+	standIn := newScimStandIn(t)
+	connector, _ := newTestScimConnector(t, standIn)
+
+	err := connector.Apply(context.Background(), userEvent(t, OperationDelete, "never-provisioned", nil))
+
+	require.NoError(t, err)
+	assert.Empty(t, standIn.takeRequests())
+}
+
+func TestScimConnectorTranslatesGroupMembers(t *testing.T) {
+	standIn := newScimStandIn(t)
+	connector, _ := newTestScimConnector(t, standIn)
+	ctx := context.Background()
+	require.NoError(t, connector.Apply(ctx, userEvent(t, OperationCreate, "local-alice", map[string]any{"userName": "alice"})))
+	require.NoError(t, connector.Apply(ctx, userEvent(t, OperationCreate, "local-bob", map[string]any{"userName": "bob"})))
+
+	group, err := json.Marshal(map[string]any{
+		"id":          "local-group",
+		"displayName": "Engineering",
+		"members": []any{
+			map[string]any{"value": "local-alice", "display": "Alice"},
+			map[string]any{"value": "local-bob", "type": "User"},
+			map[string]any{"value": "local-carol"},
+		},
+	})
+	require.NoError(t, err)
+	err = connector.Apply(ctx, Event{OrganisationID: "org-1", ResourceType: ResourceGroup, ResourceID: "local-group", Operation: OperationCreate, Resource: group})
+
+	require.NoError(t, err)
+	remote := standIn.get("Groups", "remote-3")
+	require.NotNil(t, remote)
+	assert.Equal(t, []any{
+		map[string]any{"value": "remote-1", "display": "Alice"},
+		map[string]any{"value": "remote-2", "type": "User"},
+	}, remote["members"], "members are remote ids, unprovisioned members are left out")
+}
+
+func TestScimConnectorRemovesClearedAttributes(t *testing.T) {
+	standIn := newScimStandIn(t)
+	connector, _ := newTestScimConnector(t, standIn)
+	ctx := context.Background()
+	enterprise := "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+	require.NoError(t, connector.Apply(ctx, userEvent(t, OperationCreate, "local-1", map[string]any{
+		"userName":     "alice",
+		"title":        "Engineer",
+		"name":         map[string]any{"givenName": "Alice", "familyName": "Smith"},
+		"phoneNumbers": []any{map[string]any{"value": "+46 70 123 45 67"}},
+		enterprise:     map[string]any{"department": "R&D", "manager": map[string]any{"value": "bob"}},
+	})))
+
+	err := connector.Apply(ctx, userEvent(t, OperationReplace, "local-1", map[string]any{
+		"userName":     "alice",
+		"name":         map[string]any{"givenName": "Alice"},
+		"phoneNumbers": []any{},
+		enterprise:     map[string]any{"department": "R&D"},
+	}))
+
+	require.NoError(t, err)
+	remote := standIn.get("Users", "remote-1")
+	assert.NotContains(t, remote, "title")
+	assert.NotContains(t, remote, "phoneNumbers")
+	assert.Equal(t, map[string]any{"givenName": "Alice"}, remote["name"])
+	assert.Equal(t, map[string]any{"department": "R&D"}, remote[enterprise])
+}
+
+func TestPatchOperations(t *testing.T) {
+	sent := map[string]any{
+		"schemas":  []any{"urn:ietf:params:scim:schemas:core:2.0:User"},
+		"userName": "alice",
+		"active":   true,
+		"title":    "Engineer",
+		"name":     map[string]any{"givenName": "Alice", "familyName": "Smith"},
+		"emails":   []any{map[string]any{"value": "alice@example.com"}},
+	}
+	attributes := map[string]any{
+		"schemas":  []any{"urn:ietf:params:scim:schemas:core:2.0:User"},
+		"userName": "alice",
+		"active":   false,
+		"name":     map[string]any{"familyName": ""},
+		"emails":   []any{},
+	}
+
+	operations := patchOperations(sent, attributes)
+
+	assert.Equal(t, []map[string]any{
+		{"op": "remove", "path": "emails"},
+		{"op": "remove", "path": "name.familyName"},
+		{"op": "remove", "path": "name.givenName"},
+		{"op": "remove", "path": "title"},
+		{"op": "replace", "value": map[string]any{"userName": "alice", "active": false}},
+	}, operations)
+}
+
+func TestPatchOperationsWithoutSentAttributes(t *testing.T) {
+	operations := patchOperations(nil, map[string]any{"userName": "alice", "name": map[string]any{}})
+
+	assert.Equal(t, []map[string]any{
+		{"op": "replace", "value": map[string]any{"userName": "alice"}},
+	}, operations)
+}
@@ -0,0 +1,132 @@
+package target
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/scim/filter"
+	"github.com/jawee/scimtiplexer/internal/scim/schema"
+)
+
+// Deprovision actions, what is done at a target with resources that leave
+// its scope. Groups have no active attribute, so disabling leaves a group at
+// the target as it is.
+const (
+	DeprovisionDisable = "disable"
+	DeprovisionDelete  = "delete"
+)
+
+// parseScope parses and validates a scope against the schemas of a resource
+// type.
+func parseScope(resourceType, scope string) (*filter.Filter, error) {
+	f, err := filter.Parse(scope)
+	if err != nil {
+		return nil, err
+	}
+	r, _ := schema.ResourceType(resourceType)
+	for _, path := range f.Paths() {
+		if _, err := parsePath(r, path, false); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// inScope reports whether a resource is in the scope of a target. Deleted
+// resources are in no scope.
+func inScope(t repository.Target, event Event) (bool, error) {
+	if event.Operation == OperationDelete {
+		return false, nil
+	}
+	scope := t.UserScope
+	if event.ResourceType == ResourceGroup {
+		scope = t.GroupScope
+	}
+	if !scope.Valid {
+		return true, nil
+	}
+
+	f, err := parseScope(event.ResourceType, scope.String)
+	if err != nil {
+		return false, err
+	}
+	var resource map[string]any
+	if err := json.Unmarshal(event.Resource, &resource); err != nil {
+		return false, fmt.Errorf("failed to decode resource: %w", err)
+	}
+	return f.Matches(resource), nil
+}
+
+// scopeEvent returns the event to send to a target, keeping track of the
+// resources in its scope. A resource that moves into the scope is created,
+// and one that leaves it is deprovisioned. ok is false if nothing is sent.
+func scopeEvent(ctx context.Context, repo repository.Querier, t repository.Target, event Event, in bool) (scoped Event, ok bool, err error) {
+	_, err = repo.GetTargetScopedResource(ctx, repository.GetTargetScopedResourceParams{
+		Targetid:     t.ID,
+		Resourcetype: event.ResourceType,
+		Resourceid:   event.ResourceID,
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return Event{}, false, fmt.Errorf("failed to GetTargetScopedResource: %w", err)
+	}
+	wasIn := err == nil
+
+	switch {
+	case in && !wasIn:
+		err := repo.CreateTargetScopedResource(ctx, repository.CreateTargetScopedResourceParams{
+			Targetid:     t.ID,
+			Resourcetype: event.ResourceType,
+			Resourceid:   event.ResourceID,
+			Createdonutc: time.Now().UTC(),
+		})
+		if err != nil {
+			return Event{}, false, fmt.Errorf("failed to CreateTargetScopedResource: %w", err)
+		}
+		event.Operation = OperationCreate
+		return event, true, nil
+	case in:
+		return event, true, nil
+	case wasIn:
+		err := repo.DeleteTargetScopedResource(ctx, repository.DeleteTargetScopedResourceParams{
+			Targetid:     t.ID,
+			Resourcetype: event.ResourceType,
+			Resourceid:   event.ResourceID,
+		})
+		if err != nil {
+			return Event{}, false, fmt.Errorf("failed to DeleteTargetScopedResource: %w", err)
+		}
+		return deprovisionEvent(t, event)
+	}
+	return Event{}, false, nil
+}
+
+// deprovisionEvent returns the event for a resource that left the scope of
+// a target.
+func deprovisionEvent(t repository.Target, event Event) (Event, bool, error) {
+	if event.Operation == OperationDelete || t.DeprovisionAction == DeprovisionDelete {
+		event.Operation = OperationDelete
+		event.Resource = nil
+		return event, true, nil
+	}
+	if event.ResourceType != ResourceUser {
+		return Event{}, false, nil
+	}
+
+	var resource map[string]any
+	if err := json.Unmarshal(event.Resource, &resource); err != nil {
+		return Event{}, false, fmt.Errorf("failed to decode resource: %w", err)
+	}
+	resource["active"] = false
+	disabled, err := json.Marshal(resource)
+	if err != nil {
+		return Event{}, false, err
+	}
+	event.Operation = OperationReplace
+	event.Resource = disabled
+	return event, true, nil
+}
@@ -0,0 +1,1140 @@
+package target
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jawee/scimtiplexer/internal/database"
+	"github.com/jawee/scimtiplexer/internal/repository"
+)
+
+// service manages the targets of an organisation.
+type service struct {
+	db         database.Transactor
+	repo       repository.Querier
+	users      ResourceLoader
+	dispatcher *Dispatcher
+	reconciler *Reconciler
+	backfiller *Backfiller
+}
+
+var (
+	errInvalidRequest  = errors.New("invalid request")
+	errUserNotFound    = errors.New("user not found")
+	errEventSuperseded = errors.New("event is superseded")
+)
+
+type targetDto struct {
+	ID                string
+	Name              string
+	Type              string
+	Config            json.RawMessage
+	AttributeMapping  json.RawMessage
+	UserScope         string
+	GroupScope        string
+	DeprovisionAction string
+	ReconcileInterval time.Duration
+	ReconcileRepair   bool
+	Mode              string
+	RateLimit         float64
+	MaxInFlight       int64
+	Enabled           bool
+	CreatedBy         string
+	CreatedOnUtc      time.Time
+	ModifiedOnUtc     time.Time
+}
+
+func newTargetDto(t repository.Target) targetDto {
+	dto := targetDto{
+		ID:                t.ID,
+		Name:              t.Name,
+		Type:              t.Type,
+		Config:            redactConfig(t.Type, json.RawMessage(t.Config)),
+		UserScope:         t.UserScope.String,
+		GroupScope:        t.GroupScope.String,
+		DeprovisionAction: t.DeprovisionAction,
+		ReconcileInterval: time.Duration(t.ReconcileInterval.Int64) * time.Second,
+		ReconcileRepair:   t.ReconcileRepair,
+		Mode:              t.Mode,
+		RateLimit:         t.RateLimit.Float64,
+		MaxInFlight:       t.MaxInFlight.Int64,
+		Enabled:           t.Enabled,
+		CreatedBy:         t.CreatedBy,
+		CreatedOnUtc:      t.CreatedOnUtc,
+		ModifiedOnUtc:     t.ModifiedOnUtc,
+	}
+	if t.AttributeMapping.Valid {
+		dto.AttributeMapping = json.RawMessage(t.AttributeMapping.String)
+	}
+	return dto
+}
+
+func (s *service) GetTargets(ctx context.Context, organisationId string) ([]targetDto, error) {
+	targets, err := s.repo.GetTargets(ctx, organisationId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetTargets: %w", err)
+	}
+
+	dtos := make([]targetDto, len(targets))
+	for i, t := range targets {
+		dtos[i] = newTargetDto(t)
+	}
+	return dtos, nil
+}
+
+func (s *service) GetTarget(ctx context.Context, organisationId, id string) (targetDto, error) {
+	t, err := s.repo.GetTargetById(ctx, repository.GetTargetByIdParams{
+		ID:             id,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return targetDto{}, err
+	}
+	return newTargetDto(t), nil
+}
+
+func (s *service) CreateTarget(ctx context.Context, organisationId, userId string, req TargetCreateRequest) (targetDto, error) {
+	if req.Name == "" {
+		return targetDto{}, fmt.Errorf("%w: name is required", errInvalidRequest)
+	}
+	if err := validateConfig(req.Type, req.Config); err != nil {
+		return targetDto{}, fmt.Errorf("%w: %w", errInvalidRequest, err)
+	}
+	mapping, err := validateMapping(req.AttributeMapping)
+	if err != nil {
+		return targetDto{}, err
+	}
+	userScope, err := validateScope(ResourceUser, req.UserScope)
+	if err != nil {
+		return targetDto{}, err
+	}
+	groupScope, err := validateScope(ResourceGroup, req.GroupScope)
+	if err != nil {
+		return targetDto{}, err
+	}
+	deprovisionAction := DeprovisionDisable
+	if req.DeprovisionAction != "" {
+		if err := validateDeprovisionAction(req.DeprovisionAction); err != nil {
+			return targetDto{}, err
+		}
+		deprovisionAction = req.DeprovisionAction
+	}
+	reconcileInterval, err := validateReconcileInterval(req.ReconcileInterval)
+	if err != nil {
+		return targetDto{}, err
+	}
+	mode := ModeLive
+	if req.Mode != "" {
+		if err := validateMode(req.Mode); err != nil {
+			return targetDto{}, err
+		}
+		mode = req.Mode
+	}
+	rateLimit, err := validateRateLimit(req.RateLimit)
+	if err != nil {
+		return targetDto{}, err
+	}
+	maxInFlight, err := validateMaxInFlight(req.MaxInFlight)
+	if err != nil {
+		return targetDto{}, err
+	}
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	if req.Backfill && !enabled {
+		return targetDto{}, errTargetDisabled
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return targetDto{}, errors.New("failed to generate UUID for new target")
+	}
+
+	now := time.Now().UTC()
+	_, err = s.repo.CreateTarget(ctx, repository.CreateTargetParams{
+		ID:                id.String(),
+		Organisationid:    organisationId,
+		Name:              req.Name,
+		Type:              req.Type,
+		Config:            string(req.Config),
+		Attributemapping:  mapping,
+		Userscope:         userScope,
+		Groupscope:        groupScope,
+		Deprovisionaction: deprovisionAction,
+		Reconcileinterval: reconcileInterval,
+		Reconcilerepair:   req.ReconcileRepair,
+		Mode:              mode,
+		Ratelimit:         rateLimit,
+		Maxinflight:       maxInFlight,
+		Enabled:           enabled,
+		Createdby:         userId,
+		Createdonutc:      now,
+		Modifiedonutc:     now,
+		Modifiedby:        sql.NullString{String: userId, Valid: true},
+	})
+	if err != nil {
+		return targetDto{}, fmt.Errorf("failed to CreateTarget: %w", err)
+	}
+	if req.Backfill {
+		if _, err := s.StartBackfill(ctx, organisationId, userId, id.String()); err != nil {
+			return targetDto{}, err
+		}
+	}
+
+	return s.GetTarget(ctx, organisationId, id.String())
+}
+
+// UpdateTarget changes the fields set in the request. Secret config fields
+// left out of an updated config keep their current value.
+func (s *service) UpdateTarget(ctx context.Context, organisationId, userId, id string, req TargetUpdateRequest) (targetDto, error) {
+	current, err := s.repo.GetTargetById(ctx, repository.GetTargetByIdParams{
+		ID:             id,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return targetDto{}, err
+	}
+
+	params := repository.UpdateTargetParams{
+		Name:              current.Name,
+		Config:            current.Config,
+		Attributemapping:  current.AttributeMapping,
+		Userscope:         current.UserScope,
+		Groupscope:        current.GroupScope,
+		Deprovisionaction: current.DeprovisionAction,
+		Reconcileinterval: current.ReconcileInterval,
+		Reconcilerepair:   current.ReconcileRepair,
+		Mode:              current.Mode,
+		Ratelimit:         current.RateLimit,
+		Maxinflight:       current.MaxInFlight,
+		Enabled:           current.Enabled,
+		Modifiedonutc:     time.Now().UTC(),
+		Modifiedby:        sql.NullString{String: userId, Valid: true},
+		ID:                id,
+		Organisationid:    organisationId,
+	}
+	if req.Name != nil {
+		if *req.Name == "" {
+			return targetDto{}, fmt.Errorf("%w: name is required", errInvalidRequest)
+		}
+		params.Name = *req.Name
+	}
+	if req.Enabled != nil {
+		params.Enabled = *req.Enabled
+	}
+	if len(req.Config) > 0 {
+		config, err := keepSecrets(current.Type, json.RawMessage(current.Config), req.Config)
+		if err != nil {
+			return targetDto{}, fmt.Errorf("%w: invalid config: %w", errInvalidRequest, err)
+		}
+		if err := validateConfig(current.Type, config); err != nil {
+			return targetDto{}, fmt.Errorf("%w: %w", errInvalidRequest, err)
+		}
+		params.Config = string(config)
+	}
+	if len(req.AttributeMapping) > 0 {
+		mapping, err := validateMapping(req.AttributeMapping)
+		if err != nil {
+			return targetDto{}, err
+		}
+		params.Attributemapping = mapping
+	}
+	if req.UserScope != nil {
+		if params.Userscope, err = validateScope(ResourceUser, *req.UserScope); err != nil {
+			return targetDto{}, err
+		}
+	}
+	if req.GroupScope != nil {
+		if params.Groupscope, err = validateScope(ResourceGroup, *req.GroupScope); err != nil {
+			return targetDto{}, err
+		}
+	}
+	if req.DeprovisionAction != nil {
+		if err := validateDeprovisionAction(*req.DeprovisionAction); err != nil {
+			return targetDto{}, err
+		}
+		params.Deprovisionaction = *req.DeprovisionAction
+	}
+	if req.ReconcileInterval != nil {
+		if params.Reconcileinterval, err = validateReconcileInterval(*req.ReconcileInterval); err != nil {
+			return targetDto{}, err
+		}
+	}
+	if req.ReconcileRepair != nil {
+		params.Reconcilerepair = *req.ReconcileRepair
+	}
+	if req.Mode != nil {
+		if err := validateMode(*req.Mode); err != nil {
+			return targetDto{}, err
+		}
+		params.Mode = *req.Mode
+	}
+	if req.RateLimit != nil {
+		if params.Ratelimit, err = validateRateLimit(*req.RateLimit); err != nil {
+			return targetDto{}, err
+		}
+	}
+	if req.MaxInFlight != nil {
+		if params.Maxinflight, err = validateMaxInFlight(*req.MaxInFlight); err != nil {
+			return targetDto{}, err
+		}
+	}
+
+	if req.Backfill {
+		if err := s.backfiller.check(ctx, id, params.Enabled); err != nil {
+			return targetDto{}, err
+		}
+	}
+
+	if err := s.repo.UpdateTarget(ctx, params); err != nil {
+		return targetDto{}, fmt.Errorf("failed to UpdateTarget: %w", err)
+	}
+	if req.Backfill {
+		if _, err := s.StartBackfill(ctx, organisationId, userId, id); err != nil {
+			return targetDto{}, err
+		}
+	}
+
+	return s.GetTarget(ctx, organisationId, id)
+}
+
+// validateMapping checks an attribute mapping from a request. An absent or
+// null mapping sends resources unchanged.
+func validateMapping(mapping json.RawMessage) (sql.NullString, error) {
+	if len(mapping) == 0 || string(mapping) == "null" {
+		return sql.NullString{}, nil
+	}
+	if _, err := parseMapping(mapping); err != nil {
+		return sql.NullString{}, fmt.Errorf("%w: %w", errInvalidRequest, err)
+	}
+	return sql.NullString{String: string(mapping), Valid: true}, nil
+}
+
+// validateScope checks a scope from a request. An empty scope sends all
+// resources of the type.
+func validateScope(resourceType, scope string) (sql.NullString, error) {
+	if scope == "" {
+		return sql.NullString{}, nil
+	}
+	if _, err := parseScope(resourceType, scope); err != nil {
+		return sql.NullString{}, fmt.Errorf("%w: invalid %s scope: %w", errInvalidRequest, strings.ToLower(resourceType), err)
+	}
+	return sql.NullString{String: scope, Valid: true}, nil
+}
+
+func validateDeprovisionAction(action string) error {
+	if action != DeprovisionDisable && action != DeprovisionDelete {
+		return fmt.Errorf("%w: deprovisionAction must be disable or delete", errInvalidRequest)
+	}
+	return nil
+}
+
+// validateReconcileInterval checks a reconciliation interval from a
+// request, a duration such as 24h. An empty interval only reconciles the
+// target on demand.
+func validateReconcileInterval(interval string) (sql.NullInt64, error) {
+	if interval == "" {
+		return sql.NullInt64{}, nil
+	}
+	d, err := time.ParseDuration(interval)
+	if err != nil {
+		return sql.NullInt64{}, fmt.Errorf("%w: invalid reconcileInterval: %w", errInvalidRequest, err)
+	}
+	if d < minReconcileInterval {
+		return sql.NullInt64{}, fmt.Errorf("%w: reconcileInterval must be at least %s", errInvalidRequest, minReconcileInterval)
+	}
+	return sql.NullInt64{Int64: int64(d / time.Second), Valid: true}, nil
+}
+
+// validateRateLimit checks the requests per second a target may be sent, no
+// limit is set for 0.
+func validateRateLimit(rateLimit float64) (sql.NullFloat64, error) {
+	if rateLimit < 0 {
+		return sql.NullFloat64{}, fmt.Errorf("%w: rateLimit can't be negative", errInvalidRequest)
+	}
+	return sql.NullFloat64{Float64: rateLimit, Valid: rateLimit > 0}, nil
+}
+
+// validateMaxInFlight checks the events a target may be delivered at once,
+// the default of the dispatcher is used for 0.
+func validateMaxInFlight(maxInFlight int64) (sql.NullInt64, error) {
+	if maxInFlight < 0 {
+		return sql.NullInt64{}, fmt.Errorf("%w: maxInFlight can't be negative", errInvalidRequest)
+	}
+	return sql.NullInt64{Int64: maxInFlight, Valid: maxInFlight > 0}, nil
+}
+
+// PreviewMapping renders the payload a target would be sent for a user,
+// using the mapping in the request or else the mapping of the target.
+func (s *service) PreviewMapping(ctx context.Context, organisationId, id string, req PreviewRequest) (json.RawMessage, error) {
+	t, err := s.repo.GetTargetById(ctx, repository.GetTargetByIdParams{
+		ID:             id,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	mapping := t.AttributeMapping
+	if len(req.AttributeMapping) > 0 {
+		if mapping, err = validateMapping(req.AttributeMapping); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.UserID == "" {
+		return nil, fmt.Errorf("%w: userId is required", errInvalidRequest)
+	}
+	resource, err := s.users(ctx, organisationId, req.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errUserNotFound
+		}
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+
+	return mapResource(mapping.String, ResourceUser, resource)
+}
+
+func (s *service) DeleteTarget(ctx context.Context, organisationId, id string) error {
+	if _, err := s.GetTarget(ctx, organisationId, id); err != nil {
+		return err
+	}
+
+	err := s.repo.DeleteTarget(ctx, repository.DeleteTargetParams{
+		ID:             id,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to DeleteTarget: %w", err)
+	}
+	return nil
+}
+
+type eventDto struct {
+	ID               int64
+	ResourceType     string
+	ResourceID       string
+	Operation        string
+	Status           string
+	Attempts         int64
+	NextAttemptOnUtc time.Time
+	LastError        string
+	CreatedOnUtc     time.Time
+	DeliveredOnUtc   *time.Time
+}
+
+func newEventDto(event repository.OutboxEvent) eventDto {
+	dto := eventDto{
+		ID:               event.ID,
+		ResourceType:     event.ResourceType,
+		ResourceID:       event.ResourceID,
+		Operation:        event.Operation,
+		Status:           event.Status,
+		Attempts:         event.Attempts,
+		NextAttemptOnUtc: event.NextAttemptOnUtc,
+		LastError:        event.LastError.String,
+		CreatedOnUtc:     event.CreatedOnUtc,
+	}
+	if event.DeliveredOnUtc.Valid {
+		dto.DeliveredOnUtc = &event.DeliveredOnUtc.Time
+	}
+	return dto
+}
+
+// maxEvents limits how many outbox events are listed.
+const maxEvents = 500
+
+// GetEvents lists the newest outbox events of a target with the given status.
+func (s *service) GetEvents(ctx context.Context, organisationId, targetId, status string) ([]eventDto, error) {
+	if status != StatusPending && status != StatusDelivered && status != StatusDead && status != StatusDiscarded {
+		return nil, fmt.Errorf("%w: status must be pending, delivered, dead or discarded", errInvalidRequest)
+	}
+	if _, err := s.GetTarget(ctx, organisationId, targetId); err != nil {
+		return nil, err
+	}
+
+	events, err := s.repo.GetOutboxEventsByTarget(ctx, repository.GetOutboxEventsByTargetParams{
+		Targetid:       targetId,
+		Organisationid: organisationId,
+		Status:         status,
+		Limit:          maxEvents,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetOutboxEventsByTarget: %w", err)
+	}
+
+	dtos := make([]eventDto, len(events))
+	for i, event := range events {
+		dtos[i] = newEventDto(event)
+	}
+	return dtos, nil
+}
+
+// RetryEvent moves a dead lettered event back to the outbox. An event that
+// was followed by a delivered one for the same resource isn't retried, as it
+// would send the target a state that is no longer current.
+func (s *service) RetryEvent(ctx context.Context, organisationId, targetId string, eventId int64) error {
+	return s.db.WithTx(ctx, func(repo repository.Querier) error {
+		event, err := repo.GetOutboxEvent(ctx, repository.GetOutboxEventParams{
+			ID:             eventId,
+			Targetid:       targetId,
+			Organisationid: organisationId,
+		})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+			return fmt.Errorf("failed to GetOutboxEvent: %w", err)
+		}
+		if event.Status != StatusDead {
+			return sql.ErrNoRows
+		}
+
+		next, err := repo.GetNextDeliveredOutboxEvent(ctx, repository.GetNextDeliveredOutboxEventParams{
+			Targetid:     targetId,
+			Resourcetype: event.ResourceType,
+			Resourceid:   event.ResourceID,
+			ID:           eventId,
+		})
+		if err == nil {
+			return fmt.Errorf("%w: event %d for the %s was delivered after it", errEventSuperseded, next.ID, strings.ToLower(event.ResourceType))
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to GetNextDeliveredOutboxEvent: %w", err)
+		}
+
+		rows, err := repo.RequeueOutboxEvent(ctx, repository.RequeueOutboxEventParams{
+			Nextattemptonutc: time.Now().UTC(),
+			ID:               eventId,
+			Targetid:         targetId,
+			Organisationid:   organisationId,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to RequeueOutboxEvent: %w", err)
+		}
+		if rows == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+}
+
+// DiscardEvent gives up on a dead lettered event, which lets the later events
+// of its resource be delivered.
+func (s *service) DiscardEvent(ctx context.Context, organisationId, targetId string, eventId int64) error {
+	rows, err := s.repo.DiscardOutboxEvent(ctx, repository.DiscardOutboxEventParams{
+		ID:             eventId,
+		Targetid:       targetId,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to DiscardOutboxEvent: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+type healthDto struct {
+	targetHealth
+	Pending int64
+	Dead    int64
+}
+
+// GetHealth returns the delivery state of a target with the number of
+// events waiting in its outbox.
+func (s *service) GetHealth(ctx context.Context, organisationId, targetId string) (healthDto, error) {
+	t, err := s.repo.GetTargetById(ctx, repository.GetTargetByIdParams{
+		ID:             targetId,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return healthDto{}, err
+	}
+	counts, err := s.repo.CountTargetOutboxEvents(ctx, repository.CountTargetOutboxEventsParams{
+		Targetid:       targetId,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return healthDto{}, fmt.Errorf("failed to CountTargetOutboxEvents: %w", err)
+	}
+
+	health := healthDto{targetHealth: s.dispatcher.health(t)}
+	for _, c := range counts {
+		switch c.Status {
+		case StatusPending:
+			health.Pending = c.Count
+		case StatusDead:
+			health.Dead = c.Count
+		}
+	}
+	return health, nil
+}
+
+type reconciliationDto struct {
+	ID             string
+	Trigger        string
+	Repair         bool
+	Status         string
+	Missing        int64
+	Extra          int64
+	Changed        int64
+	Membership     int64
+	Repaired       int64
+	Report         []Drift
+	Error          string
+	CreatedBy      string
+	StartedOnUtc   time.Time
+	CompletedOnUtc *time.Time
+}
+
+// newReconciliationDto converts a reconciliation, with its report when
+// withReport is set.
+func newReconciliationDto(r repository.TargetReconciliation, withReport bool) reconciliationDto {
+	dto := reconciliationDto{
+		ID:           r.ID,
+		Trigger:      r.Trigger,
+		Repair:       r.Repair,
+		Status:       r.Status,
+		Missing:      r.Missing,
+		Extra:        r.Extra,
+		Changed:      r.Changed,
+		Membership:   r.Membership,
+		Repaired:     r.Repaired,
+		Error:        r.Error.String,
+		CreatedBy:    r.CreatedBy.String,
+		StartedOnUtc: r.StartedOnUtc,
+	}
+	if r.CompletedOnUtc.Valid {
+		dto.CompletedOnUtc = &r.CompletedOnUtc.Time
+	}
+	if withReport && r.Report.Valid {
+		if err := json.Unmarshal([]byte(r.Report.String), &dto.Report); err != nil {
+			slog.Error("Invalid reconciliation report", "error", err, "reconciliationid", r.ID)
+		}
+	}
+	return dto
+}
+
+// maxReconciliations limits how many reconciliations are listed.
+const maxReconciliations = 50
+
+// Reconcile starts reconciling a target, repairing the drift if repair is
+// set.
+func (s *service) Reconcile(ctx context.Context, organisationId, userId, targetId string, repair bool) (reconciliationDto, error) {
+	t, err := s.repo.GetTargetById(ctx, repository.GetTargetByIdParams{
+		ID:             targetId,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return reconciliationDto{}, err
+	}
+
+	id, err := s.reconciler.Reconcile(t, TriggerManual, repair, userId)
+	if err != nil {
+		return reconciliationDto{}, err
+	}
+	return s.GetReconciliation(ctx, organisationId, targetId, id)
+}
+
+// GetReconciliations lists the newest reconciliations of a target, without
+// their reports.
+func (s *service) GetReconciliations(ctx context.Context, organisationId, targetId string) ([]reconciliationDto, error) {
+	if _, err := s.GetTarget(ctx, organisationId, targetId); err != nil {
+		return nil, err
+	}
+
+	reconciliations, err := s.repo.GetTargetReconciliations(ctx, repository.GetTargetReconciliationsParams{
+		Targetid:       targetId,
+		Organisationid: organisationId,
+		Limit:          maxReconciliations,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetTargetReconciliations: %w", err)
+	}
+
+	dtos := make([]reconciliationDto, len(reconciliations))
+	for i, r := range reconciliations {
+		dtos[i] = newReconciliationDto(r, false)
+	}
+	return dtos, nil
+}
+
+func (s *service) GetReconciliation(ctx context.Context, organisationId, targetId, id string) (reconciliationDto, error) {
+	r, err := s.repo.GetTargetReconciliation(ctx, repository.GetTargetReconciliationParams{
+		ID:             id,
+		Targetid:       targetId,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return reconciliationDto{}, err
+	}
+	return newReconciliationDto(r, true), nil
+}
+
+type shadowOperationDto struct {
+	ID           int64
+	ResourceType string
+	ResourceID   string
+	Operation    string
+	Payload      json.RawMessage
+	Patch        []patchOperation
+	Skipped      bool
+	Error        string
+	CreatedOnUtc time.Time
+}
+
+type shadowSummaryDto struct {
+	Create    int64
+	Replace   int64
+	Delete    int64
+	Skipped   int64
+	Failed    int64
+	Resources int64
+}
+
+type shadowReportDto struct {
+	Summary    shadowSummaryDto
+	Operations []shadowOperationDto
+}
+
+// maxShadowOperations limits how many shadow operations are listed at a time.
+const maxShadowOperations = 500
+
+// GetShadowReport summarises the operations recorded for a target in shadow
+// mode and lists the newest ones older than before, which is the id of an
+// operation or zero for the newest. Operations have the JSON Patch from the
+// payload of the previous operation of their resource, if there is one.
+func (s *service) GetShadowReport(ctx context.Context, organisationId, targetId string, before int64, limit int) (shadowReportDto, error) {
+	if _, err := s.GetTarget(ctx, organisationId, targetId); err != nil {
+		return shadowReportDto{}, err
+	}
+
+	var report shadowReportDto
+	counts, err := s.repo.GetTargetShadowOperationCounts(ctx, targetId)
+	if err != nil {
+		return shadowReportDto{}, fmt.Errorf("failed to GetTargetShadowOperationCounts: %w", err)
+	}
+	for _, c := range counts {
+		switch {
+		case c.Skipped:
+			report.Summary.Skipped += c.Count
+		case c.Operation == string(OperationCreate):
+			report.Summary.Create += c.Count
+		case c.Operation == string(OperationReplace):
+			report.Summary.Replace += c.Count
+		case c.Operation == string(OperationDelete):
+			report.Summary.Delete += c.Count
+		}
+	}
+	if report.Summary.Failed, err = s.repo.CountFailedTargetShadowOperations(ctx, targetId); err != nil {
+		return shadowReportDto{}, fmt.Errorf("failed to CountFailedTargetShadowOperations: %w", err)
+	}
+	if report.Summary.Resources, err = s.repo.CountTargetShadowResources(ctx, targetId); err != nil {
+		return shadowReportDto{}, fmt.Errorf("failed to CountTargetShadowResources: %w", err)
+	}
+
+	if before <= 0 {
+		before = math.MaxInt64
+	}
+	operations, err := s.repo.GetTargetShadowOperations(ctx, repository.GetTargetShadowOperationsParams{
+		Targetid:       targetId,
+		Organisationid: organisationId,
+		Before:         before,
+		Limit:          int64(limit),
+	})
+	if err != nil {
+		return shadowReportDto{}, fmt.Errorf("failed to GetTargetShadowOperations: %w", err)
+	}
+
+	report.Operations = make([]shadowOperationDto, len(operations))
+	for i, op := range operations {
+		dto := shadowOperationDto{
+			ID:           op.ID,
+			ResourceType: op.ResourceType,
+			ResourceID:   op.ResourceID,
+			Operation:    op.Operation,
+			Skipped:      op.Skipped,
+			Error:        op.Error.String,
+			CreatedOnUtc: op.CreatedOnUtc,
+		}
+		if op.Payload.Valid {
+			dto.Payload = json.RawMessage(op.Payload.String)
+			if dto.Patch, err = s.shadowPatch(ctx, op); err != nil {
+				return shadowReportDto{}, err
+			}
+		}
+		report.Operations[i] = dto
+	}
+	return report, nil
+}
+
+// shadowPatch returns the JSON Patch from the payload of the previous
+// operation of a resource to the payload of op, or nil for the first.
+func (s *service) shadowPatch(ctx context.Context, op repository.TargetShadowOperation) ([]patchOperation, error) {
+	previous, err := s.repo.GetPreviousTargetShadowOperation(ctx, repository.GetPreviousTargetShadowOperationParams{
+		Targetid:     op.TargetID,
+		Resourcetype: op.ResourceType,
+		Resourceid:   op.ResourceID,
+		ID:           op.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetPreviousTargetShadowOperation: %w", err)
+	}
+	return diff(json.RawMessage(previous.Payload.String), json.RawMessage(op.Payload.String))
+}
+
+// ClearShadowOperations deletes the operations recorded for a target, such
+// as before its mapping is tried again.
+func (s *service) ClearShadowOperations(ctx context.Context, organisationId, targetId string) error {
+	if _, err := s.GetTarget(ctx, organisationId, targetId); err != nil {
+		return err
+	}
+
+	err := s.repo.DeleteTargetShadowOperations(ctx, repository.DeleteTargetShadowOperationsParams{
+		Targetid:       targetId,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to DeleteTargetShadowOperations: %w", err)
+	}
+	return nil
+}
+
+type thresholdDto struct {
+	MaxCount       *int64
+	MaxPercent     *int64
+	Window         time.Duration
+	Reject         bool
+	SuspendedUntil *time.Time
+	ModifiedBy     string
+	ModifiedOnUtc  time.Time
+}
+
+func newThresholdDto(t repository.MassChangeThreshold) thresholdDto {
+	dto := thresholdDto{
+		Window:        time.Duration(t.WindowSeconds) * time.Second,
+		Reject:        t.Reject,
+		ModifiedBy:    t.ModifiedBy.String,
+		ModifiedOnUtc: t.ModifiedOnUtc,
+	}
+	if t.MaxCount.Valid {
+		dto.MaxCount = &t.MaxCount.Int64
+	}
+	if t.MaxPercent.Valid {
+		dto.MaxPercent = &t.MaxPercent.Int64
+	}
+	if t.SuspendedUntil.Valid && time.Now().Before(t.SuspendedUntil.Time) {
+		dto.SuspendedUntil = &t.SuspendedUntil.Time
+	}
+	return dto
+}
+
+func (s *service) GetThreshold(ctx context.Context, organisationId string) (thresholdDto, error) {
+	t, err := s.repo.GetMassChangeThreshold(ctx, organisationId)
+	if err != nil {
+		return thresholdDto{}, err
+	}
+	return newThresholdDto(t), nil
+}
+
+// SetThreshold sets the mass change threshold of an organisation. A change
+// to a suspended threshold keeps it suspended.
+func (s *service) SetThreshold(ctx context.Context, organisationId, userId string, req ThresholdRequest) (thresholdDto, error) {
+	if req.MaxCount == nil && req.MaxPercent == nil {
+		return thresholdDto{}, fmt.Errorf("%w: maxCount or maxPercent is required", errInvalidRequest)
+	}
+	params := repository.UpsertMassChangeThresholdParams{
+		Organisationid: organisationId,
+		Reject:         req.Reject,
+		Modifiedonutc:  time.Now().UTC(),
+		Modifiedby:     sql.NullString{String: userId, Valid: userId != ""},
+	}
+	if req.MaxCount != nil {
+		if *req.MaxCount < 0 {
+			return thresholdDto{}, fmt.Errorf("%w: maxCount can't be negative", errInvalidRequest)
+		}
+		params.Maxcount = sql.NullInt64{Int64: *req.MaxCount, Valid: true}
+	}
+	if req.MaxPercent != nil {
+		if *req.MaxPercent < 0 || *req.MaxPercent > 100 {
+			return thresholdDto{}, fmt.Errorf("%w: maxPercent must be between 0 and 100", errInvalidRequest)
+		}
+		params.Maxpercent = sql.NullInt64{Int64: *req.MaxPercent, Valid: true}
+	}
+	window, err := time.ParseDuration(req.Window)
+	if err != nil {
+		return thresholdDto{}, fmt.Errorf("%w: invalid window: %w", errInvalidRequest, err)
+	}
+	if window < minThresholdWindow || window > maxThresholdWindow {
+		return thresholdDto{}, fmt.Errorf("%w: window must be between %s and %s", errInvalidRequest, minThresholdWindow, maxThresholdWindow)
+	}
+	params.Windowseconds = int64(window / time.Second)
+
+	if err := s.repo.UpsertMassChangeThreshold(ctx, params); err != nil {
+		return thresholdDto{}, fmt.Errorf("failed to UpsertMassChangeThreshold: %w", err)
+	}
+	return s.GetThreshold(ctx, organisationId)
+}
+
+// DeleteThreshold removes the mass change threshold of an organisation. A
+// batch that is already open stays open until it's resolved.
+func (s *service) DeleteThreshold(ctx context.Context, organisationId string) error {
+	rows, err := s.repo.DeleteMassChangeThreshold(ctx, organisationId)
+	if err != nil {
+		return fmt.Errorf("failed to DeleteMassChangeThreshold: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	if err := s.repo.DeleteMassChanges(ctx, organisationId); err != nil {
+		return fmt.Errorf("failed to DeleteMassChanges: %w", err)
+	}
+	return nil
+}
+
+type heldEventDto struct {
+	ResourceType string
+	ResourceID   string
+	Operation    string
+	Deactivates  bool
+	CreatedOnUtc time.Time
+}
+
+type heldBatchDto struct {
+	ID            string
+	Status        string
+	Changes       int64
+	Users         int64
+	Events        int64
+	HeldEvents    []heldEventDto
+	OpenedOnUtc   time.Time
+	ResolvedBy    string
+	ResolvedOnUtc *time.Time
+}
+
+func newHeldBatchDto(b repository.HeldBatch) heldBatchDto {
+	dto := heldBatchDto{
+		ID:          b.ID,
+		Status:      b.Status,
+		Changes:     b.Changes,
+		Users:       b.Users,
+		Events:      b.Events,
+		OpenedOnUtc: b.OpenedOnUtc,
+		ResolvedBy:  b.ResolvedBy.String,
+	}
+	if b.ResolvedOnUtc.Valid {
+		dto.ResolvedOnUtc = &b.ResolvedOnUtc.Time
+	}
+	return dto
+}
+
+// maxHeldBatches is the number of held batches listed, and maxHeldEvents the
+// number of events listed for a batch.
+const (
+	maxHeldBatches = 50
+	maxHeldEvents  = 1000
+)
+
+// GetHeldBatches lists the newest held batches of an organisation with a
+// status.
+func (s *service) GetHeldBatches(ctx context.Context, organisationId, status string) ([]heldBatchDto, error) {
+	if status == "" {
+		status = BatchOpen
+	}
+	if status != BatchOpen && status != BatchApproved && status != BatchDiscarded {
+		return nil, fmt.Errorf("%w: status must be open, approved or discarded", errInvalidRequest)
+	}
+
+	batches, err := s.repo.GetHeldBatches(ctx, repository.GetHeldBatchesParams{
+		Organisationid: organisationId,
+		Status:         status,
+		Limit:          maxHeldBatches,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetHeldBatches: %w", err)
+	}
+
+	dtos := make([]heldBatchDto, len(batches))
+	for i, b := range batches {
+		dtos[i] = newHeldBatchDto(b)
+	}
+	return dtos, nil
+}
+
+// GetHeldBatch returns a held batch with the oldest of the events it holds.
+// Resolved batches hold no events.
+func (s *service) GetHeldBatch(ctx context.Context, organisationId, id string) (heldBatchDto, error) {
+	b, err := s.repo.GetHeldBatch(ctx, repository.GetHeldBatchParams{ID: id, Organisationid: organisationId})
+	if err != nil {
+		return heldBatchDto{}, err
+	}
+	events, err := s.repo.GetHeldEvents(ctx, repository.GetHeldEventsParams{Batchid: id, Limit: maxHeldEvents})
+	if err != nil {
+		return heldBatchDto{}, fmt.Errorf("failed to GetHeldEvents: %w", err)
+	}
+
+	dto := newHeldBatchDto(b)
+	dto.HeldEvents = make([]heldEventDto, len(events))
+	for i, e := range events {
+		dto.HeldEvents[i] = heldEventDto{
+			ResourceType: e.ResourceType,
+			ResourceID:   e.ResourceID,
+			Operation:    e.Operation,
+			Deactivates:  e.Deactivates,
+			CreatedOnUtc: e.CreatedOnUtc,
+		}
+	}
+	return dto, nil
+}
+
+// ResolveHeldBatch approves or discards the open held batch of an
+// organisation, status is BatchApproved or BatchDiscarded.
+func (s *service) ResolveHeldBatch(ctx context.Context, organisationId, userId, id, status string) (heldBatchDto, error) {
+	err := s.db.WithTx(ctx, func(repo repository.Querier) error {
+		return release(ctx, repo, organisationId, userId, id, status)
+	})
+	if err != nil {
+		return heldBatchDto{}, err
+	}
+	slog.Info("Held batch resolved", "organisationid", organisationId, "batchid", id, "status", status, "userid", userId)
+	return s.GetHeldBatch(ctx, organisationId, id)
+}
+
+type backfillDto struct {
+	ID              string
+	Status          string
+	Phase           string
+	TotalUsers      int64
+	TotalGroups     int64
+	ProcessedUsers  int64
+	ProcessedGroups int64
+	Queued          int64
+	Error           string
+	CreatedBy       string
+	StartedOnUtc    time.Time
+	ModifiedOnUtc   time.Time
+	CompletedOnUtc  *time.Time
+}
+
+func newBackfillDto(b repository.TargetBackfill) backfillDto {
+	dto := backfillDto{
+		ID:              b.ID,
+		Status:          b.Status,
+		Phase:           b.Phase,
+		TotalUsers:      b.TotalUsers,
+		TotalGroups:     b.TotalGroups,
+		ProcessedUsers:  b.ProcessedUsers,
+		ProcessedGroups: b.ProcessedGroups,
+		Queued:          b.Queued,
+		Error:           b.Error.String,
+		CreatedBy:       b.CreatedBy.String,
+		StartedOnUtc:    b.StartedOnUtc,
+		ModifiedOnUtc:   b.ModifiedOnUtc,
+	}
+	if b.CompletedOnUtc.Valid {
+		dto.CompletedOnUtc = &b.CompletedOnUtc.Time
+	}
+	return dto
+}
+
+// maxBackfills is the number of backfills listed for a target.
+const maxBackfills = 50
+
+// StartBackfill starts sending every user and group to a target.
+func (s *service) StartBackfill(ctx context.Context, organisationId, userId, targetId string) (backfillDto, error) {
+	t, err := s.repo.GetTargetById(ctx, repository.GetTargetByIdParams{
+		ID:             targetId,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return backfillDto{}, err
+	}
+
+	id, err := s.backfiller.Backfill(ctx, t, userId)
+	if err != nil {
+		return backfillDto{}, err
+	}
+	return s.GetBackfill(ctx, organisationId, targetId, id)
+}
+
+// GetBackfills lists the newest backfills of a target.
+func (s *service) GetBackfills(ctx context.Context, organisationId, targetId string) ([]backfillDto, error) {
+	if _, err := s.GetTarget(ctx, organisationId, targetId); err != nil {
+		return nil, err
+	}
+
+	backfills, err := s.repo.GetTargetBackfills(ctx, repository.GetTargetBackfillsParams{
+		Targetid:       targetId,
+		Organisationid: organisationId,
+		Limit:          maxBackfills,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetTargetBackfills: %w", err)
+	}
+
+	dtos := make([]backfillDto, len(backfills))
+	for i, b := range backfills {
+		dtos[i] = newBackfillDto(b)
+	}
+	return dtos, nil
+}
+
+func (s *service) GetBackfill(ctx context.Context, organisationId, targetId, id string) (backfillDto, error) {
+	b, err := s.repo.GetTargetBackfill(ctx, repository.GetTargetBackfillParams{
+		ID:             id,
+		Targetid:       targetId,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return backfillDto{}, err
+	}
+	return newBackfillDto(b), nil
+}
+
+// Backfill actions.
+const (
+	backfillPause  = "pause"
+	backfillResume = "resume"
+	backfillCancel = "cancel"
+)
+
+// ChangeBackfill pauses, resumes or cancels a backfill.
+func (s *service) ChangeBackfill(ctx context.Context, organisationId, targetId, id, action string) (backfillDto, error) {
+	b, err := s.repo.GetTargetBackfill(ctx, repository.GetTargetBackfillParams{
+		ID:             id,
+		Targetid:       targetId,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return backfillDto{}, err
+	}
+
+	switch action {
+	case backfillPause:
+		err = s.backfiller.Pause(ctx, b)
+	case backfillResume:
+		err = s.backfiller.Resume(ctx, b)
+	case backfillCancel:
+		err = s.backfiller.Cancel(ctx, b)
+	}
+	if err != nil {
+		return backfillDto{}, err
+	}
+	return s.GetBackfill(ctx, organisationId, targetId, id)
+}
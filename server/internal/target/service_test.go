@@ -0,0 +1,119 @@
+package target
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/database/databasetest"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// queueEvent adds an event for a user to the outbox of the test target. The
+// ids of the events count from 1.
+func queueEvent(t *testing.T, repo repository.Querier, userId string, operation Operation) {
+	now := time.Now().UTC()
+	err := repo.CreateOutboxEvent(context.Background(), repository.CreateOutboxEventParams{
+		Organisationid:   "org-1",
+		Targetid:         testTargetId,
+		Resourcetype:     ResourceUser,
+		Resourceid:       userId,
+		Operation:        string(operation),
+		Nextattemptonutc: now,
+		Createdonutc:     now,
+	})
+	require.NoError(t, err)
+}
+
+func markDead(t *testing.T, repo repository.Querier, id int64) {
+	err := repo.MarkOutboxEventFailed(context.Background(), repository.MarkOutboxEventFailedParams{
+		Status:           StatusDead,
+		Attempts:         5,
+		Nextattemptonutc: time.Now().UTC(),
+		Lasterror:        sql.NullString{String: "503 Service Unavailable", Valid: true},
+		ID:               id,
+	})
+	require.NoError(t, err)
+}
+
+func TestRetryEvent(t *testing.T) {
+	db := databasetest.New(t)
+	repo := db.GetRepository()
+	s := &service{db: db, repo: repo}
+	ctx := context.Background()
+	queueEvent(t, repo, "alice", OperationCreate)
+	queueEvent(t, repo, "bob", OperationCreate)
+	markDead(t, repo, 1)
+
+	require.NoError(t, s.RetryEvent(ctx, "org-1", testTargetId, 1))
+
+	event, err := repo.GetOutboxEvent(ctx, repository.GetOutboxEventParams{ID: 1, Targetid: testTargetId, Organisationid: "org-1"})
+	require.NoError(t, err)
+	assert.Equal(t, StatusPending, event.Status)
+	assert.Zero(t, event.Attempts)
+
+	assert.ErrorIs(t, s.RetryEvent(ctx, "org-1", testTargetId, 1), sql.ErrNoRows, "only dead events are retried")
+	assert.ErrorIs(t, s.RetryEvent(ctx, "org-1", testTargetId, 2), sql.ErrNoRows)
+	assert.ErrorIs(t, s.RetryEvent(ctx, "org-2", testTargetId, 1), sql.ErrNoRows)
+}
+
+func TestRetryEventRefusesSupersededEvent(t *testing.T) {
+	db := databasetest.New(t)
+	repo := db.GetRepository()
+	s := &service{db: db, repo: repo}
+	ctx := context.Background()
+	queueEvent(t, repo, "alice", OperationReplace)
+	queueEvent(t, repo, "alice", OperationReplace)
+	markDead(t, repo, 1)
+	require.NoError(t, repo.MarkOutboxEventDelivered(ctx, repository.MarkOutboxEventDeliveredParams{
+		Deliveredonutc: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		ID:             2,
+	}))
+
+	err := s.RetryEvent(ctx, "org-1", testTargetId, 1)
+
+	assert.ErrorIs(t, err, errEventSuperseded)
+	event, err := repo.GetOutboxEvent(ctx, repository.GetOutboxEventParams{ID: 1, Targetid: testTargetId, Organisationid: "org-1"})
+	require.NoError(t, err)
+	assert.Equal(t, StatusDead, event.Status, "stale state is not replayed")
+}
+
+// readyEvents returns the ids of the events of the test target that can be
+// delivered.
+func readyEvents(t *testing.T, repo repository.Querier) []int64 {
+	events, err := repo.GetReadyOutboxEvents(context.Background(), repository.GetReadyOutboxEventsParams{
+		Targetid: testTargetId,
+		Now:      time.Now().UTC(),
+		Limit:    100,
+	})
+	require.NoError(t, err)
+	var ids []int64
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+func TestDeadEventHoldsBackLaterEvents(t *testing.T) {
+	db := databasetest.New(t)
+	repo := db.GetRepository()
+	s := &service{db: db, repo: repo}
+	ctx := context.Background()
+	queueEvent(t, repo, "alice", OperationCreate)
+	queueEvent(t, repo, "alice", OperationReplace)
+	queueEvent(t, repo, "bob", OperationCreate)
+	markDead(t, repo, 1)
+
+	assert.Equal(t, []int64{3}, readyEvents(t, repo), "the replace waits for the dead create")
+
+	require.NoError(t, s.RetryEvent(ctx, "org-1", testTargetId, 1))
+	assert.Equal(t, []int64{1, 3}, readyEvents(t, repo), "the create goes first")
+
+	markDead(t, repo, 1)
+	require.NoError(t, s.DiscardEvent(ctx, "org-1", testTargetId, 1))
+	assert.Equal(t, []int64{2, 3}, readyEvents(t, repo))
+	assert.ErrorIs(t, s.DiscardEvent(ctx, "org-1", testTargetId, 1), sql.ErrNoRows, "only dead events are discarded")
+}
@@ -0,0 +1,225 @@
+package target
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jawee/scimtiplexer/internal/repository"
+)
+
+// Event URIs of the SCIM events profile of security event tokens,
+// draft-ietf-scim-events.
+const (
+	EventCreate     = "urn:ietf:params:SCIM:event:prov:create:full"
+	EventPatch      = "urn:ietf:params:SCIM:event:prov:patch:full"
+	EventDelete     = "urn:ietf:params:SCIM:event:prov:delete"
+	EventActivate   = "urn:ietf:params:SCIM:event:prov:activate"
+	EventDeactivate = "urn:ietf:params:SCIM:event:prov:deactivate"
+)
+
+// SetMediaType is the content type of a pushed security event token,
+// RFC 8417 section 2.3.
+const SetMediaType = "application/secevent+jwt"
+
+// Set delivery methods, push as of RFC 8935 and poll as of RFC 8936.
+const (
+	SetDeliveryPush = "push"
+	SetDeliveryPoll = "poll"
+)
+
+// setConfig is the config of a set target, an event stream of security
+// event tokens. Pushed tokens are POSTed to EndpointURL with
+// AuthorizationHeader, polled ones are kept until the receiver acknowledges
+// them. Audience is the aud claim of the tokens.
+type setConfig struct {
+	Delivery            string `json:"delivery"`
+	EndpointURL         string `json:"endpointUrl,omitempty"`
+	AuthorizationHeader string `json:"authorizationHeader,omitempty"`
+	Audience            string `json:"audience,omitempty"`
+}
+
+// SetClaims are the claims of a security event token, RFC 8417. SubID
+// identifies the resource by its SCIM URI.
+type SetClaims struct {
+	jwt.RegisteredClaims
+	SubID  SetSubject     `json:"sub_id"`
+	Txn    string         `json:"txn,omitempty"`
+	Events map[string]any `json:"events"`
+}
+
+// SetSubject is a subject identifier of the scim format.
+type SetSubject struct {
+	Format string `json:"format"`
+	URI    string `json:"uri"`
+}
+
+// setConnector emits security event tokens signed with the keys of the OAuth
+// token issuer, so receivers verify them with the published key set.
+type setConnector struct {
+	targetID string
+	config   setConfig
+	client   *http.Client
+	repo     repository.Querier
+	signer   Signer
+}
+
+func newSetConnector(t repository.Target, deps connectorDeps) (Connector, error) {
+	var config setConfig
+	if err := json.Unmarshal([]byte(t.Config), &config); err != nil {
+		return nil, fmt.Errorf("invalid set config: %w", err)
+	}
+
+	switch config.Delivery {
+	case SetDeliveryPush:
+		u, err := url.Parse(config.EndpointURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return nil, errors.New("endpointUrl must be an http or https URL")
+		}
+	case SetDeliveryPoll:
+	default:
+		return nil, errors.New("delivery must be push or poll")
+	}
+
+	return &setConnector{
+		targetID: t.ID,
+		config:   config,
+		client:   &http.Client{Timeout: 30 * time.Second, Transport: deps.transport},
+		repo:     deps.repo,
+		signer:   deps.signer,
+	}, nil
+}
+
+func (c *setConnector) Apply(ctx context.Context, event Event) error {
+	endpoint, err := resourceEndpoint(event.ResourceType)
+	if err != nil {
+		return err
+	}
+	before, err := previousResource(ctx, c.repo, c.targetID, event)
+	if err != nil {
+		return err
+	}
+	events, err := setEvents(event, before)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrPermanent, err)
+	}
+
+	// The jti is derived from the outbox event, so a redelivered token can
+	// be recognised by the receiver.
+	jti := uuid.NewSHA1(uuid.NameSpaceURL, []byte(c.targetID+"/"+strconv.FormatInt(event.Sequence, 10))).String()
+	claims := SetClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:   c.signer.Issuer(),
+			IssuedAt: jwt.NewNumericDate(time.Now().UTC()),
+			ID:       jti,
+		},
+		SubID:  SetSubject{Format: "scim", URI: "/" + endpoint + "/" + event.ResourceID},
+		Txn:    strconv.FormatInt(event.Sequence, 10),
+		Events: events,
+	}
+	if c.config.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{c.config.Audience}
+	}
+
+	signed, err := c.signer.Sign(ctx, claims, "secevent+jwt")
+	if err != nil {
+		return fmt.Errorf("failed to sign security event token: %w", err)
+	}
+
+	if c.config.Delivery == SetDeliveryPoll {
+		err := c.repo.CreateSecurityEvent(ctx, repository.CreateSecurityEventParams{
+			Jti:          jti,
+			Targetid:     c.targetID,
+			Token:        signed,
+			Createdonutc: time.Now().UTC(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to CreateSecurityEvent: %w", err)
+		}
+		return nil
+	}
+	return c.push(ctx, signed)
+}
+
+// setEvents returns the events of a change. Changes to active are reported
+// as activate or deactivate events along with the patch.
+func setEvents(event Event, before json.RawMessage) (map[string]any, error) {
+	var data map[string]any
+	if len(event.Resource) > 0 {
+		if err := json.Unmarshal(event.Resource, &data); err != nil {
+			return nil, fmt.Errorf("failed to decode resource: %w", err)
+		}
+	}
+
+	switch event.Operation {
+	case OperationCreate:
+		return map[string]any{EventCreate: map[string]any{"data": data}}, nil
+	case OperationDelete:
+		return map[string]any{EventDelete: map[string]any{}}, nil
+	case OperationReplace:
+	default:
+		return nil, fmt.Errorf("unsupported operation %q", event.Operation)
+	}
+
+	events := map[string]any{EventPatch: map[string]any{"data": data}}
+	var previous map[string]any
+	if len(before) > 0 && json.Unmarshal(before, &previous) == nil {
+		wasActive, wasOk := previous["active"].(bool)
+		active, ok := data["active"].(bool)
+		switch {
+		case wasOk && ok && !wasActive && active:
+			events[EventActivate] = map[string]any{}
+		case wasOk && ok && wasActive && !active:
+			events[EventDeactivate] = map[string]any{}
+		}
+	}
+	return events, nil
+}
+
+// push delivers a token as of RFC 8935. The receiver answers 202, or 400
+// with an error code when it rejects the token.
+func (c *setConnector) push(ctx context.Context, token string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.EndpointURL, bytes.NewReader([]byte(token)))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrPermanent, err)
+	}
+	req.Header.Set("Content-Type", SetMediaType)
+	req.Header.Set("Accept", "application/json")
+	if c.config.AuthorizationHeader != "" {
+		req.Header.Set("Authorization", c.config.AuthorizationHeader)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("set push request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	var pushErr struct {
+		Err         string `json:"err"`
+		Description string `json:"description"`
+	}
+	json.Unmarshal(data, &pushErr)
+	err = fmt.Errorf("set receiver returned %d", resp.StatusCode)
+	if pushErr.Err != "" {
+		err = fmt.Errorf("set receiver returned %d: %s: %s", resp.StatusCode, pushErr.Err, pushErr.Description)
+	}
+	if isPermanentStatus(resp.StatusCode) {
+		return fmt.Errorf("%w: %w", ErrPermanent, err)
+	}
+	return err
+}
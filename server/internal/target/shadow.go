@@ -0,0 +1,78 @@
+package target
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/repository"
+)
+
+// Target modes. A target in shadow mode is sent nothing, the operations it
+// would be sent are recorded instead, so the mapping and scopes of a new
+// target can be checked against real changes before it goes live.
+const (
+	ModeLive   = "live"
+	ModeShadow = "shadow"
+)
+
+// shadowRetention is how long the operations recorded for shadow targets are
+// kept.
+const shadowRetention = 30 * 24 * time.Hour
+
+func validateMode(mode string) error {
+	if mode != ModeLive && mode != ModeShadow {
+		return fmt.Errorf("%w: mode must be live or shadow", errInvalidRequest)
+	}
+	return nil
+}
+
+// writeEvent writes a mapped event to the outbox of a target, or records it
+// when the target is in shadow mode.
+func writeEvent(ctx context.Context, repo repository.Querier, t repository.Target, event Event) error {
+	if t.Mode == ModeShadow {
+		return recordShadow(ctx, repo, t, event, false, nil)
+	}
+
+	now := time.Now().UTC()
+	err := repo.CreateOutboxEvent(ctx, repository.CreateOutboxEventParams{
+		Organisationid:   event.OrganisationID,
+		Targetid:         t.ID,
+		Resourcetype:     event.ResourceType,
+		Resourceid:       event.ResourceID,
+		Operation:        string(event.Operation),
+		Payload:          sql.NullString{String: string(event.Resource), Valid: len(event.Resource) > 0},
+		Nextattemptonutc: now,
+		Createdonutc:     now,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to CreateOutboxEvent: %w", err)
+	}
+	return nil
+}
+
+// recordShadow records an operation a target in shadow mode would be sent. A
+// skipped operation is a change the scope of the target filtered out, and
+// cause is why a change couldn't be turned into an operation.
+func recordShadow(ctx context.Context, repo repository.Querier, t repository.Target, event Event, skipped bool, cause error) error {
+	params := repository.CreateTargetShadowOperationParams{
+		Organisationid: event.OrganisationID,
+		Targetid:       t.ID,
+		Resourcetype:   event.ResourceType,
+		Resourceid:     event.ResourceID,
+		Operation:      string(event.Operation),
+		Skipped:        skipped,
+		Createdonutc:   time.Now().UTC(),
+	}
+	if !skipped && cause == nil {
+		params.Payload = sql.NullString{String: string(event.Resource), Valid: len(event.Resource) > 0}
+	}
+	if cause != nil {
+		params.Error = sql.NullString{String: cause.Error(), Valid: true}
+	}
+	if err := repo.CreateTargetShadowOperation(ctx, params); err != nil {
+		return fmt.Errorf("failed to CreateTargetShadowOperation: %w", err)
+	}
+	return nil
+}
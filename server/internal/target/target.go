@@ -0,0 +1,150 @@
+package target
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jawee/scimtiplexer/internal/repository"
+)
+
+// Operation is the kind of change an event describes.
+type Operation string
+
+const (
+	OperationCreate  Operation = "create"
+	OperationReplace Operation = "replace"
+	OperationDelete  Operation = "delete"
+)
+
+// Resource types events are emitted for.
+const (
+	ResourceUser  = "User"
+	ResourceGroup = "Group"
+)
+
+// Event is an accepted change to a SCIM resource of an organisation.
+// Resource is the full SCIM representation after the change, and is empty for
+// deletes. Deactivates is set on replaces that deactivate a user, which count
+// towards the mass change threshold like deletes. Sequence and CreatedOnUtc
+// are set when the event is delivered, Sequence is its position in the outbox
+// and increases with every event of a target.
+type Event struct {
+	OrganisationID string
+	ResourceType   string
+	ResourceID     string
+	Operation      Operation
+	Resource       json.RawMessage
+	Deactivates    bool
+	Sequence       int64
+	CreatedOnUtc   time.Time
+}
+
+// ResourceLoader returns the SCIM representation of a stored resource. It
+// returns sql.ErrNoRows if there is no such resource.
+type ResourceLoader func(ctx context.Context, organisationId, id string) (json.RawMessage, error)
+
+// Connector applies events to one downstream system.
+type Connector interface {
+	Apply(ctx context.Context, event Event) error
+}
+
+// ErrPermanent marks a delivery error that retrying won't fix, such as a
+// request the target rejects as invalid. The event is dead lettered at once.
+var ErrPermanent = errors.New("permanent failure")
+
+// Signer signs the security event tokens sent to set targets.
+type Signer interface {
+	Issuer() string
+	Sign(ctx context.Context, claims jwt.Claims, typ string) (string, error)
+}
+
+// connectorDeps are what connectors need besides their target. They are
+// empty when a connector is only created to validate its config. transport
+// sends the requests of the connector, the default transport is used without
+// one.
+type connectorDeps struct {
+	repo      repository.Querier
+	signer    Signer
+	transport http.RoundTripper
+}
+
+// connectorType creates connectors of one type for a target. secrets are
+// the config fields that are never returned by the API.
+type connectorType struct {
+	new     func(t repository.Target, deps connectorDeps) (Connector, error)
+	secrets []string
+}
+
+const (
+	TypeScim    = "scim"
+	TypeWebhook = "webhook"
+	TypeSet     = "set"
+)
+
+var connectorTypes = map[string]connectorType{
+	TypeScim:    {new: newScimConnector, secrets: []string{"bearerToken"}},
+	TypeWebhook: {new: newWebhookConnector, secrets: []string{"secret"}},
+	TypeSet:     {new: newSetConnector, secrets: []string{"authorizationHeader"}},
+}
+
+// Types returns the names of the available connector types.
+func Types() []string {
+	return slices.Sorted(maps.Keys(connectorTypes))
+}
+
+// newConnector creates the connector of a target, validating its config.
+func newConnector(t repository.Target, deps connectorDeps) (Connector, error) {
+	ct, ok := connectorTypes[t.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown target type %q", t.Type)
+	}
+	return ct.new(t, deps)
+}
+
+// validateConfig checks that a connector of the given type can be created
+// from config.
+func validateConfig(typ string, config json.RawMessage) error {
+	_, err := newConnector(repository.Target{Type: typ, Config: string(config)}, connectorDeps{})
+	return err
+}
+
+// redactConfig removes the secret fields of a config so it can be returned by
+// the API.
+func redactConfig(typ string, config json.RawMessage) json.RawMessage {
+	var fields map[string]any
+	if err := json.Unmarshal(config, &fields); err != nil {
+		return json.RawMessage("{}")
+	}
+	for _, secret := range connectorTypes[typ].secrets {
+		delete(fields, secret)
+	}
+	redacted, _ := json.Marshal(fields)
+	return redacted
+}
+
+// keepSecrets copies secret fields missing from an updated config from the
+// current config, so a config read from the API can be sent back unchanged.
+func keepSecrets(typ string, current, updated json.RawMessage) (json.RawMessage, error) {
+	var currentFields, updatedFields map[string]any
+	if err := json.Unmarshal(current, &currentFields); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(updated, &updatedFields); err != nil {
+		return nil, err
+	}
+	for _, secret := range connectorTypes[typ].secrets {
+		if _, ok := updatedFields[secret]; !ok {
+			if value, ok := currentFields[secret]; ok {
+				updatedFields[secret] = value
+			}
+		}
+	}
+	return json.Marshal(updatedFields)
+}
@@ -0,0 +1,235 @@
+package target
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/repository"
+)
+
+// Webhook request headers. The signature is the hex encoded HMAC-SHA256 of
+// the timestamp, a dot and the body, keyed with the secret of the target.
+// Receivers should reject requests with a timestamp more than a few minutes
+// old, so a captured request can't be replayed.
+const (
+	HeaderWebhookTimestamp = "X-Scimtiplexer-Timestamp"
+	HeaderWebhookSignature = "X-Scimtiplexer-Signature"
+)
+
+// Webhook payload formats.
+const (
+	WebhookFormatFull  = "full"
+	WebhookFormatPatch = "patch"
+)
+
+// webhookConfig is the config of a webhook target. Format is full, sending
+// the resource before and after the change, or patch, sending a JSON Patch
+// from the one to the other.
+type webhookConfig struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"`
+	Format string `json:"format,omitempty"`
+}
+
+// webhookConnector POSTs a signed JSON notification of every change.
+type webhookConnector struct {
+	targetID string
+	config   webhookConfig
+	client   *http.Client
+	repo     repository.Querier
+}
+
+func newWebhookConnector(t repository.Target, deps connectorDeps) (Connector, error) {
+	var config webhookConfig
+	if err := json.Unmarshal([]byte(t.Config), &config); err != nil {
+		return nil, fmt.Errorf("invalid webhook config: %w", err)
+	}
+
+	u, err := url.Parse(config.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, errors.New("url must be an http or https URL")
+	}
+	if config.Secret == "" {
+		return nil, errors.New("secret is required")
+	}
+	switch config.Format {
+	case "":
+		config.Format = WebhookFormatFull
+	case WebhookFormatFull, WebhookFormatPatch:
+	default:
+		return nil, errors.New("format must be full or patch")
+	}
+
+	return &webhookConnector{
+		targetID: t.ID,
+		config:   config,
+		client:   &http.Client{Timeout: 30 * time.Second, Transport: deps.transport},
+		repo:     deps.repo,
+	}, nil
+}
+
+// WebhookEvent is the body of a webhook request. Before is the resource as
+// last sent to the target, and is left out if it's unknown. Sequence
+// increases with every event of the target, so receivers can order events
+// and ignore redelivered ones.
+type WebhookEvent struct {
+	Sequence       int64            `json:"sequence"`
+	OrganisationID string           `json:"organisationId"`
+	ResourceType   string           `json:"resourceType"`
+	ResourceID     string           `json:"resourceId"`
+	Operation      Operation        `json:"operation"`
+	OccurredAt     time.Time        `json:"occurredAt"`
+	Before         json.RawMessage  `json:"before,omitempty"`
+	After          json.RawMessage  `json:"after,omitempty"`
+	Patch          []patchOperation `json:"patch,omitempty"`
+}
+
+// patchOperation is a JSON Patch operation, RFC 6902.
+type patchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value"`
+}
+
+// MarshalJSON leaves out the value of remove operations only: add and
+// replace carry theirs even when it is null, false, 0 or "".
+func (op patchOperation) MarshalJSON() ([]byte, error) {
+	if op.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{op.Op, op.Path})
+	}
+	type operation patchOperation
+	return json.Marshal(operation(op))
+}
+
+func (c *webhookConnector) Apply(ctx context.Context, event Event) error {
+	before, err := previousResource(ctx, c.repo, c.targetID, event)
+	if err != nil {
+		return err
+	}
+
+	body := WebhookEvent{
+		Sequence:       event.Sequence,
+		OrganisationID: event.OrganisationID,
+		ResourceType:   event.ResourceType,
+		ResourceID:     event.ResourceID,
+		Operation:      event.Operation,
+		OccurredAt:     event.CreatedOnUtc,
+	}
+	if c.config.Format == WebhookFormatPatch {
+		if body.Patch, err = diff(before, event.Resource); err != nil {
+			return fmt.Errorf("%w: %w", ErrPermanent, err)
+		}
+	} else {
+		body.Before = before
+		body.After = event.Resource
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("%w: failed to marshal webhook event: %w", ErrPermanent, err)
+	}
+	return c.post(ctx, data)
+}
+
+func (c *webhookConnector) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrPermanent, err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderWebhookTimestamp, timestamp)
+	req.Header.Set(HeaderWebhookSignature, "sha256="+Sign(c.config.Secret, timestamp, body))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("webhook returned %d", resp.StatusCode)
+	if isPermanentStatus(resp.StatusCode) {
+		return fmt.Errorf("%w: %w", ErrPermanent, err)
+	}
+	return err
+}
+
+// Sign returns the hex encoded signature of a webhook request.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// diff returns the JSON Patch that turns before into after. Missing
+// resources are taken as empty objects. Arrays are replaced as a whole.
+func diff(before, after json.RawMessage) ([]patchOperation, error) {
+	from, to := map[string]any{}, map[string]any{}
+	if len(before) > 0 {
+		if err := json.Unmarshal(before, &from); err != nil {
+			return nil, fmt.Errorf("failed to decode previous resource: %w", err)
+		}
+	}
+	if len(after) > 0 {
+		if err := json.Unmarshal(after, &to); err != nil {
+			return nil, fmt.Errorf("failed to decode resource: %w", err)
+		}
+	}
+	return diffObjects("", from, to), nil
+}
+
+func diffObjects(path string, from, to map[string]any) []patchOperation {
+	var ops []patchOperation
+	for _, key := range slices.Sorted(maps.Keys(from)) {
+		if _, ok := to[key]; !ok {
+			ops = append(ops, patchOperation{Op: "remove", Path: path + "/" + escapePointer(key)})
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(to)) {
+		keyPath := path + "/" + escapePointer(key)
+		old, ok := from[key]
+		switch {
+		case !ok:
+			ops = append(ops, patchOperation{Op: "add", Path: keyPath, Value: to[key]})
+		case reflect.DeepEqual(old, to[key]):
+		default:
+			oldObject, oldOk := old.(map[string]any)
+			newObject, newOk := to[key].(map[string]any)
+			if oldOk && newOk {
+				ops = append(ops, diffObjects(keyPath, oldObject, newObject)...)
+			} else {
+				ops = append(ops, patchOperation{Op: "replace", Path: keyPath, Value: to[key]})
+			}
+		}
+	}
+	return ops
+}
+
+// escapePointer escapes a key for use in a JSON Pointer, RFC 6901.
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
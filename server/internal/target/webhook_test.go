@@ -0,0 +1,25 @@
+package target
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffKeepsZeroValues(t *testing.T) {
+	ops, err := diff(
+		json.RawMessage(`{"active": true, "title": "Engineer", "nickName": "al", "manager": {"value": "bob"}}`),
+		json.RawMessage(`{"active": false, "title": "", "manager": null, "displayName": null}`))
+	require.NoError(t, err)
+
+	body, err := json.Marshal(ops)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"op": "remove", "path": "/nickName"},
+		{"op": "replace", "path": "/active", "value": false},
+		{"op": "add", "path": "/displayName", "value": null},
+		{"op": "replace", "path": "/manager", "value": null},
+		{"op": "replace", "path": "/title", "value": ""}]`, string(body))
+}
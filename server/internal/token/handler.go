@@ -0,0 +1,189 @@
+package token
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/admin"
+	"github.com/jawee/scimtiplexer/internal/repository"
+)
+
+type handler struct {
+	service *service
+}
+
+func RegisterEndpoints(api *admin.API, repo repository.Querier) {
+	h := &handler{
+		service: &service{repo: repo},
+	}
+
+	slog.Debug("Registering token endpoints")
+	api.Member("GET", "/orgs/{orgId}/tokens", h.handleGetTokens, admin.Operation{
+		Summary:  "List the SCIM tokens of an organisation",
+		Response: []TokenResponse{},
+	})
+	api.Member("POST", "/orgs/{orgId}/tokens", h.handlePostToken, admin.Operation{
+		Summary:  "Create a SCIM token, returned only in this response",
+		Request:  TokenRequest{},
+		Response: TokenResponse{},
+		Status:   http.StatusCreated,
+	})
+	api.Member("PATCH", "/orgs/{orgId}/tokens/{id}", h.handlePatchToken, admin.Operation{
+		Summary:     "Change the label, scopes, source or expiry of a token",
+		Description: "Fields left out, or null, keep their current value. Set clearExpiry to true to make the token never expire.",
+		Request:     TokenUpdateRequest{},
+		Response:    TokenResponse{},
+	})
+	api.Member("DELETE", "/orgs/{orgId}/tokens/{id}", h.handleDeleteToken, admin.Operation{
+		Summary: "Revoke a token",
+		Status:  http.StatusNoContent,
+	})
+	api.Member("POST", "/orgs/{orgId}/tokens/{id}/rotate", h.handleRotateToken, admin.Operation{
+		Summary:  "Replace the secret of a token, returned only in this response",
+		Response: TokenResponse{},
+	})
+}
+
+// TokenResponse describes a token. Token is only set in the response that
+// creates or rotates it. Source is the inbound source the token writes as.
+type TokenResponse struct {
+	ID            string     `json:"id"`
+	Label         string     `json:"label,omitempty"`
+	Prefix        string     `json:"prefix"`
+	Token         string     `json:"token,omitempty"`
+	Scopes        []string   `json:"scopes"`
+	Source        string     `json:"source,omitempty"`
+	Status        string     `json:"status"`
+	ExpiresOnUtc  *time.Time `json:"expiresOnUtc,omitempty"`
+	RevokedOnUtc  *time.Time `json:"revokedOnUtc,omitempty"`
+	LastUsedOnUtc *time.Time `json:"lastUsedOnUtc,omitempty"`
+	LastUsedIp    string     `json:"lastUsedIp,omitempty"`
+	CreatedBy     string     `json:"createdBy"`
+	CreatedOnUtc  time.Time  `json:"createdOnUtc"`
+	ModifiedOnUtc time.Time  `json:"modifiedOnUtc"`
+}
+
+func newTokenResponse(token tokenDto) TokenResponse {
+	return TokenResponse{
+		ID:            token.ID,
+		Label:         token.Label,
+		Prefix:        token.Prefix,
+		Token:         token.Token,
+		Scopes:        token.Scopes,
+		Source:        token.Source,
+		Status:        token.Status,
+		ExpiresOnUtc:  token.ExpiresOnUtc,
+		RevokedOnUtc:  token.RevokedOnUtc,
+		LastUsedOnUtc: token.LastUsedOnUtc,
+		LastUsedIp:    token.LastUsedIp,
+		CreatedBy:     token.CreatedBy,
+		CreatedOnUtc:  token.CreatedOnUtc,
+		ModifiedOnUtc: token.ModifiedOnUtc,
+	}
+}
+
+// TokenRequest creates a token. Leaving out scopes grants all of them, and
+// leaving out the expiry creates a token that does not expire. Source names
+// the inbound source, such as hr, that writes through the token, see the
+// attribute policies.
+type TokenRequest struct {
+	Label        string     `json:"label"`
+	Scopes       []string   `json:"scopes"`
+	Source       string     `json:"source"`
+	ExpiresOnUtc *time.Time `json:"expiresOnUtc"`
+}
+
+// TokenUpdateRequest changes a token. Fields left out, or null, keep their
+// current value. ClearExpiry removes the expiry, so the token does not
+// expire, and can't be combined with ExpiresOnUtc.
+type TokenUpdateRequest struct {
+	Label        *string    `json:"label"`
+	Scopes       *[]string  `json:"scopes"`
+	Source       *string    `json:"source"`
+	ExpiresOnUtc *time.Time `json:"expiresOnUtc"`
+	ClearExpiry  bool       `json:"clearExpiry"`
+}
+
+func (h *handler) handleGetTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := h.service.GetTokens(r.Context(), r.PathValue("orgId"))
+	if err != nil {
+		slog.Error("Failed to get tokens", "error", err)
+		admin.WriteError(w, http.StatusInternalServerError, "Failed to get tokens")
+		return
+	}
+
+	resp := make([]TokenResponse, len(tokens))
+	for i, token := range tokens {
+		resp[i] = newTokenResponse(token)
+	}
+	admin.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (h *handler) handlePostToken(w http.ResponseWriter, r *http.Request) {
+	var req TokenRequest
+	if !admin.ReadJSON(w, r, &req) {
+		return
+	}
+
+	token, err := h.service.CreateToken(r.Context(), r.PathValue("orgId"), admin.UserID(r.Context()), req)
+	if err != nil {
+		writeServiceError(w, err, "Failed to create token")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusCreated, newTokenResponse(token))
+}
+
+func (h *handler) handlePatchToken(w http.ResponseWriter, r *http.Request) {
+	var req TokenUpdateRequest
+	if !admin.ReadJSON(w, r, &req) {
+		return
+	}
+
+	token, err := h.service.UpdateToken(r.Context(), r.PathValue("orgId"), admin.UserID(r.Context()), r.PathValue("id"), req)
+	if err != nil {
+		writeServiceError(w, err, "Failed to update token")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusOK, newTokenResponse(token))
+}
+
+func (h *handler) handleDeleteToken(w http.ResponseWriter, r *http.Request) {
+	err := h.service.RevokeToken(r.Context(), r.PathValue("orgId"), admin.UserID(r.Context()), r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, err, "Failed to revoke token")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) handleRotateToken(w http.ResponseWriter, r *http.Request) {
+	token, err := h.service.RotateToken(r.Context(), r.PathValue("orgId"), admin.UserID(r.Context()), r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, err, "Failed to rotate token")
+		return
+	}
+
+	admin.WriteJSON(w, http.StatusOK, newTokenResponse(token))
+}
+
+func writeServiceError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		admin.WriteError(w, http.StatusNotFound, "Token not found")
+		return
+	case errors.Is(err, errInvalidRequest):
+		admin.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, ErrTokenRevoked):
+		admin.WriteError(w, http.StatusConflict, "Token has been revoked")
+		return
+	}
+	slog.Error(message, "error", err)
+	admin.WriteError(w, http.StatusInternalServerError, message)
+}
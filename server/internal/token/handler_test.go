@@ -0,0 +1,107 @@
+package token_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/admin"
+	"github.com/jawee/scimtiplexer/internal/database/databasetest"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const tokensPath = admin.APIPrefix + "/orgs/org-1/tokens"
+
+// newTestAPI serves the token endpoints for an admin of org-1.
+func newTestAPI(t *testing.T) (http.Handler, repository.Querier) {
+	repo := databasetest.New(t).GetRepository()
+	databasetest.CreateMember(t, repo, "admin", "org-1", admin.RoleAdmin)
+	mux := http.NewServeMux()
+	token.RegisterEndpoints(admin.NewAPI(mux, admin.NewAuthenticator(repo)), repo)
+	return mux, repo
+}
+
+// do sends a request as the admin of org-1 and decodes the response into
+// resp when it isn't nil.
+func do(t *testing.T, h http.Handler, method, path, body string, resp any) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.SetBasicAuth("admin", databasetest.Password)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if resp != nil && rec.Code < 300 {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), resp), rec.Body.String())
+	}
+	return rec
+}
+
+func TestUpdateTokenExpiry(t *testing.T) {
+	h, _ := newTestAPI(t)
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	var created token.TokenResponse
+	rec := do(t, h, "POST", tokensPath, `{"label": "hr", "expiresOnUtc": "`+expires.Format(time.RFC3339)+`"}`, &created)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	for _, body := range []string{`{"label": "workday"}`, `{"expiresOnUtc": null}`} {
+		var updated token.TokenResponse
+		rec = do(t, h, "PATCH", tokensPath+"/"+created.ID, body, &updated)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		require.NotNil(t, updated.ExpiresOnUtc, "%s keeps the expiry", body)
+		assert.True(t, expires.Equal(*updated.ExpiresOnUtc))
+	}
+
+	rec = do(t, h, "PATCH", tokensPath+"/"+created.ID, `{"clearExpiry": true, "expiresOnUtc": "`+expires.Format(time.RFC3339)+`"}`, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	var updated token.TokenResponse
+	rec = do(t, h, "PATCH", tokensPath+"/"+created.ID, `{"clearExpiry": true}`, &updated)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, updated.ExpiresOnUtc)
+	assert.Equal(t, "workday", updated.Label)
+	assert.Equal(t, "active", updated.Status)
+}
+
+func TestTokenIsOnlyShownOnce(t *testing.T) {
+	h, repo := newTestAPI(t)
+	var created token.TokenResponse
+	rec := do(t, h, "POST", tokensPath, `{"label": "entra", "scopes": ["users:read"]}`, &created)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	require.NotEmpty(t, created.Token)
+	assert.Equal(t, token.Prefix(created.Token), created.Prefix)
+	assert.Equal(t, []string{token.ScopeUsersRead}, created.Scopes)
+
+	stored, err := repo.GetOrganisationTokenByHash(context.Background(), token.Hash(created.Token))
+	require.NoError(t, err, "the token is stored by its hash")
+	assert.Equal(t, created.ID, stored.ID)
+
+	var listed []token.TokenResponse
+	rec = do(t, h, "GET", tokensPath, "", &listed)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Len(t, listed, 1)
+	assert.Empty(t, listed[0].Token, "listings only show the prefix")
+	assert.Equal(t, created.Prefix, listed[0].Prefix)
+
+	var rotated token.TokenResponse
+	rec = do(t, h, "POST", tokensPath+"/"+created.ID+"/rotate", "", &rotated)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NotEmpty(t, rotated.Token)
+	assert.NotEqual(t, created.Token, rotated.Token)
+	_, err = repo.GetOrganisationTokenByHash(context.Background(), token.Hash(created.Token))
+	assert.ErrorIs(t, err, sql.ErrNoRows, "the old secret stops working")
+
+	rec = do(t, h, "DELETE", tokensPath+"/"+created.ID, "", nil)
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	listed = nil
+	do(t, h, "GET", tokensPath, "", &listed)
+	require.Len(t, listed, 1)
+	assert.Equal(t, "revoked", listed[0].Status)
+	assert.NotNil(t, listed[0].RevokedOnUtc)
+}
@@ -0,0 +1,68 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jawee/scimtiplexer/internal/repository"
+)
+
+// Scopes limit what a token may do on the SCIM endpoints. They are stored as
+// a space separated list, the same format as an OAuth scope parameter.
+const (
+	ScopeUsersRead   = "users:read"
+	ScopeUsersWrite  = "users:write"
+	ScopeGroupsRead  = "groups:read"
+	ScopeGroupsWrite = "groups:write"
+	ScopeEventsRead  = "events:read"
+)
+
+var AllScopes = []string{ScopeUsersRead, ScopeUsersWrite, ScopeGroupsRead, ScopeGroupsWrite, ScopeEventsRead}
+
+var (
+	ErrTokenExpired = errors.New("token has expired")
+	ErrTokenRevoked = errors.New("token has been revoked")
+)
+
+// ParseScopes splits a stored scope string.
+func ParseScopes(scopes string) []string {
+	return strings.Fields(scopes)
+}
+
+// FormatScopes validates scopes and joins them for storage. An empty list
+// grants every scope.
+func FormatScopes(scopes []string) (string, error) {
+	if len(scopes) == 0 {
+		return strings.Join(AllScopes, " "), nil
+	}
+
+	var valid []string
+	for _, scope := range scopes {
+		if !slices.Contains(AllScopes, scope) {
+			return "", fmt.Errorf("unknown scope %q", scope)
+		}
+		if !slices.Contains(valid, scope) {
+			valid = append(valid, scope)
+		}
+	}
+	return strings.Join(valid, " "), nil
+}
+
+// HasScope reports whether the scope list contains scope.
+func HasScope(scopes []string, scope string) bool {
+	return slices.Contains(scopes, scope)
+}
+
+// Validate checks that a token is usable at the given time.
+func Validate(token repository.OrganisationToken, now time.Time) error {
+	if token.RevokedOnUtc.Valid {
+		return ErrTokenRevoked
+	}
+	if token.ExpiresOnUtc.Valid && !now.Before(token.ExpiresOnUtc.Time) {
+		return ErrTokenExpired
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package token
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jawee/scimtiplexer/internal/repository"
+	"github.com/jawee/scimtiplexer/internal/sources"
+)
+
+type service struct {
+	repo repository.Querier
+}
+
+var errInvalidRequest = errors.New("invalid request")
+
+type tokenDto struct {
+	ID            string
+	Label         string
+	Prefix        string
+	Token         string
+	Scopes        []string
+	Source        string
+	Status        string
+	ExpiresOnUtc  *time.Time
+	RevokedOnUtc  *time.Time
+	LastUsedOnUtc *time.Time
+	LastUsedIp    string
+	CreatedBy     string
+	CreatedOnUtc  time.Time
+	ModifiedOnUtc time.Time
+}
+
+func newTokenDto(token repository.OrganisationToken) tokenDto {
+	status := "active"
+	switch Validate(token, time.Now().UTC()) {
+	case ErrTokenExpired:
+		status = "expired"
+	case ErrTokenRevoked:
+		status = "revoked"
+	}
+
+	return tokenDto{
+		ID:            token.ID,
+		Label:         token.Label.String,
+		Prefix:        token.TokenPrefix,
+		Scopes:        ParseScopes(token.Scopes),
+		Source:        token.Source.String,
+		Status:        status,
+		ExpiresOnUtc:  nullTime(token.ExpiresOnUtc),
+		RevokedOnUtc:  nullTime(token.RevokedOnUtc),
+		LastUsedOnUtc: nullTime(token.LastUsedOnUtc),
+		LastUsedIp:    token.LastUsedIp.String,
+		CreatedBy:     token.CreatedBy,
+		CreatedOnUtc:  token.CreatedOnUtc,
+		ModifiedOnUtc: token.ModifiedOnUtc,
+	}
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func toNullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+// toSource validates the source of a token, empty for none.
+func toSource(source string) (sql.NullString, error) {
+	if source == "" {
+		return sql.NullString{}, nil
+	}
+	if err := sources.ValidateName(source); err != nil {
+		return sql.NullString{}, fmt.Errorf("%w: %w", errInvalidRequest, err)
+	}
+	return sql.NullString{String: source, Valid: true}, nil
+}
+
+func (s *service) GetTokens(ctx context.Context, organisationId string) ([]tokenDto, error) {
+	tokens, err := s.repo.GetOrganisationTokens(ctx, organisationId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetOrganisationTokens: %w", err)
+	}
+
+	dtos := make([]tokenDto, len(tokens))
+	for i, token := range tokens {
+		dtos[i] = newTokenDto(token)
+	}
+	return dtos, nil
+}
+
+// CreateToken issues a new token. The returned dto is the only place the
+// clear text token is available.
+func (s *service) CreateToken(ctx context.Context, organisationId, userId string, req TokenRequest) (tokenDto, error) {
+	scopes, err := FormatScopes(req.Scopes)
+	if err != nil {
+		return tokenDto{}, fmt.Errorf("%w: %w", errInvalidRequest, err)
+	}
+
+	source, err := toSource(req.Source)
+	if err != nil {
+		return tokenDto{}, err
+	}
+
+	tokenId, err := uuid.NewV7()
+	if err != nil {
+		return tokenDto{}, errors.New("failed to generate UUID for new token")
+	}
+
+	raw, err := Generate()
+	if err != nil {
+		return tokenDto{}, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	now := time.Now().UTC()
+	_, err = s.repo.CreateOrganisationToken(ctx, repository.CreateOrganisationTokenParams{
+		ID:             tokenId.String(),
+		Organisationid: organisationId,
+		Label:          sql.NullString{String: req.Label, Valid: req.Label != ""},
+		Tokenprefix:    Prefix(raw),
+		Tokenhash:      Hash(raw),
+		Scopes:         scopes,
+		Source:         source,
+		Expiresonutc:   toNullTime(req.ExpiresOnUtc),
+		Createdby:      userId,
+		Createdonutc:   now,
+		Modifiedonutc:  now,
+		Modifiedby:     sql.NullString{String: userId, Valid: true},
+	})
+	if err != nil {
+		return tokenDto{}, fmt.Errorf("failed to CreateOrganisationToken: %w", err)
+	}
+
+	dto, err := s.getToken(ctx, organisationId, tokenId.String())
+	if err != nil {
+		return tokenDto{}, err
+	}
+	dto.Token = raw
+	return dto, nil
+}
+
+// UpdateToken changes the label, scopes, source and expiry of a token. Fields left
+// out of the request keep their current value, and ClearExpiry removes the
+// expiry.
+func (s *service) UpdateToken(ctx context.Context, organisationId, userId, id string, req TokenUpdateRequest) (tokenDto, error) {
+	current, err := s.repo.GetOrganisationTokenById(ctx, repository.GetOrganisationTokenByIdParams{
+		ID:             id,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return tokenDto{}, err
+	}
+
+	params := repository.UpdateOrganisationTokenParams{
+		Label:          current.Label,
+		Scopes:         current.Scopes,
+		Source:         current.Source,
+		Expiresonutc:   current.ExpiresOnUtc,
+		Modifiedonutc:  time.Now().UTC(),
+		Modifiedby:     sql.NullString{String: userId, Valid: true},
+		ID:             id,
+		Organisationid: organisationId,
+	}
+	if req.Label != nil {
+		params.Label = sql.NullString{String: *req.Label, Valid: *req.Label != ""}
+	}
+	if req.Scopes != nil {
+		params.Scopes, err = FormatScopes(*req.Scopes)
+		if err != nil {
+			return tokenDto{}, fmt.Errorf("%w: %w", errInvalidRequest, err)
+		}
+	}
+	if req.Source != nil {
+		params.Source, err = toSource(*req.Source)
+		if err != nil {
+			return tokenDto{}, err
+		}
+	}
+	switch {
+	case req.ClearExpiry && req.ExpiresOnUtc != nil:
+		return tokenDto{}, fmt.Errorf("%w: expiresOnUtc and clearExpiry can't both be set", errInvalidRequest)
+	case req.ClearExpiry:
+		params.Expiresonutc = sql.NullTime{}
+	case req.ExpiresOnUtc != nil:
+		params.Expiresonutc = toNullTime(req.ExpiresOnUtc)
+	}
+
+	if err := s.repo.UpdateOrganisationToken(ctx, params); err != nil {
+		return tokenDto{}, fmt.Errorf("failed to UpdateOrganisationToken: %w", err)
+	}
+
+	return s.getToken(ctx, organisationId, id)
+}
+
+// RotateToken replaces the secret of a token, keeping its id and label. The
+// previous secret stops working immediately. Revoked tokens cannot be rotated.
+func (s *service) RotateToken(ctx context.Context, organisationId, userId, id string) (tokenDto, error) {
+	current, err := s.getToken(ctx, organisationId, id)
+	if err != nil {
+		return tokenDto{}, err
+	}
+	if current.RevokedOnUtc != nil {
+		return tokenDto{}, ErrTokenRevoked
+	}
+
+	raw, err := Generate()
+	if err != nil {
+		return tokenDto{}, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	err = s.repo.UpdateOrganisationTokenHash(ctx, repository.UpdateOrganisationTokenHashParams{
+		Tokenprefix:    Prefix(raw),
+		Tokenhash:      Hash(raw),
+		Modifiedonutc:  time.Now().UTC(),
+		Modifiedby:     sql.NullString{String: userId, Valid: true},
+		ID:             id,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return tokenDto{}, fmt.Errorf("failed to UpdateOrganisationTokenHash: %w", err)
+	}
+
+	dto, err := s.getToken(ctx, organisationId, id)
+	if err != nil {
+		return tokenDto{}, err
+	}
+	dto.Token = raw
+	return dto, nil
+}
+
+// RevokeToken disables a token. The row is kept so the token still shows up
+// in listings with its usage history.
+func (s *service) RevokeToken(ctx context.Context, organisationId, userId, id string) error {
+	current, err := s.getToken(ctx, organisationId, id)
+	if err != nil {
+		return err
+	}
+	if current.RevokedOnUtc != nil {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	err = s.repo.RevokeOrganisationToken(ctx, repository.RevokeOrganisationTokenParams{
+		Revokedonutc:   sql.NullTime{Time: now, Valid: true},
+		Modifiedonutc:  now,
+		Modifiedby:     sql.NullString{String: userId, Valid: true},
+		ID:             id,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to RevokeOrganisationToken: %w", err)
+	}
+	return nil
+}
+
+func (s *service) getToken(ctx context.Context, organisationId, id string) (tokenDto, error) {
+	token, err := s.repo.GetOrganisationTokenById(ctx, repository.GetOrganisationTokenByIdParams{
+		ID:             id,
+		Organisationid: organisationId,
+	})
+	if err != nil {
+		return tokenDto{}, err
+	}
+	return newTokenDto(token), nil
+}
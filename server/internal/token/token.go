@@ -0,0 +1,36 @@
+package token
+
+import (
+	"github.com/jawee/scimtiplexer/internal/utils"
+)
+
+// tokenPrefix marks bearer tokens issued by this server, which makes leaked
+// tokens easy to recognise by secret scanners.
+const tokenPrefix = "stx_"
+
+// displayPrefixLength is the number of characters kept in clear text so a
+// token can be recognised in listings.
+const displayPrefixLength = 12
+
+// Generate returns a new random bearer token.
+func Generate() (string, error) {
+	random, err := utils.RandomToken()
+	if err != nil {
+		return "", err
+	}
+	return tokenPrefix + random, nil
+}
+
+// Hash returns the value stored for a token.
+func Hash(token string) string {
+	return utils.HashToken(token)
+}
+
+// Prefix returns the part of a token that is stored in clear text. Short
+// tokens from before hashing was introduced only reveal a quarter of their length.
+func Prefix(token string) string {
+	if len(token) < 3*displayPrefixLength {
+		return token[:len(token)/4]
+	}
+	return token[:displayPrefixLength]
+}
@@ -0,0 +1,36 @@
+package token_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jawee/scimtiplexer/internal/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	a, err := token.Generate()
+	require.NoError(t, err)
+	b, err := token.Generate()
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(a, "stx_"), a)
+	assert.NotEqual(t, a, b)
+}
+
+func TestHash(t *testing.T) {
+	hash := token.Hash("stx_secret")
+
+	assert.Equal(t, hash, token.Hash("stx_secret"))
+	assert.NotEqual(t, hash, token.Hash("stx_other"))
+	assert.NotContains(t, hash, "secret")
+}
+
+func TestPrefix(t *testing.T) {
+	generated, err := token.Generate()
+	require.NoError(t, err)
+
+	assert.Equal(t, generated[:12], token.Prefix(generated))
+	assert.Equal(t, "abcd", token.Prefix("abcdefghijklmnop"), "short tokens reveal a quarter")
+}
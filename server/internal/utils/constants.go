@@ -1,3 +1,36 @@
 package utils
 
 var EnvLogLevel = "LOG_LEVEL"
+
+var EnvOAuthIssuer = "OAUTH_ISSUER"
+var EnvOAuthTokenLifetime = "OAUTH_TOKEN_LIFETIME"
+var EnvOAuthKeyRotation = "OAUTH_KEY_ROTATION"
+
+var EnvTrustedIssuerAllowHTTP = "TRUSTED_ISSUER_ALLOW_HTTP"
+
+var EnvTLSCertFile = "TLS_CERT_FILE"
+var EnvTLSKeyFile = "TLS_KEY_FILE"
+var EnvTLSClientAuth = "TLS_CLIENT_AUTH"
+
+var EnvOutboxWorkers = "OUTBOX_WORKERS"
+var EnvOutboxMaxAttempts = "OUTBOX_MAX_ATTEMPTS"
+
+var EnvScimRateLimit = "SCIM_RATE_LIMIT"
+var EnvScimTokenRateLimit = "SCIM_TOKEN_RATE_LIMIT"
+var EnvScimMaxBodyBytes = "SCIM_MAX_BODY_BYTES"
+
+var EnvMetricsToken = "METRICS_TOKEN"
+
+var EnvPortalSessionSecret = "PORTAL_SESSION_SECRET"
+var EnvPortalSessionLifetime = "PORTAL_SESSION_LIFETIME"
+var EnvLoginMaxFailures = "LOGIN_MAX_FAILURES"
+var EnvLoginLockoutDuration = "LOGIN_LOCKOUT_DURATION"
+
+var EnvOIDCIssuer = "OIDC_ISSUER"
+var EnvOIDCClientID = "OIDC_CLIENT_ID"
+var EnvOIDCClientSecret = "OIDC_CLIENT_SECRET"
+var EnvOIDCRedirectURL = "OIDC_REDIRECT_URL"
+var EnvOIDCScopes = "OIDC_SCOPES"
+var EnvOIDCUsernameClaim = "OIDC_USERNAME_CLAIM"
+var EnvOIDCEmailClaim = "OIDC_EMAIL_CLAIM"
+var EnvOIDCClaimMapping = "OIDC_CLAIM_MAPPING"
@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"log/slog"
+	"os"
+	"time"
+)
+
+// DurationFromEnv returns the positive duration set in the environment
+// variable key, or fallback when it is unset or invalid.
+func DurationFromEnv(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		slog.Warn("Invalid duration, using default", "key", key, "value", value, "default", fallback)
+		return fallback
+	}
+	return d
+}
@@ -0,0 +1,20 @@
+-- name: GetAttributePolicies :many
+SELECT * FROM attribute_policies
+WHERE organisation_id = sqlc.arg(organisationId)
+ORDER BY attribute;
+
+-- name: GetAttributePolicy :one
+SELECT * FROM attribute_policies
+WHERE organisation_id = sqlc.arg(organisationId)
+AND attribute = sqlc.arg(attribute);
+
+-- name: UpsertAttributePolicy :exec
+INSERT INTO attribute_policies (organisation_id, attribute, sources, on_conflict, created_on_utc, modified_on_utc, modified_by)
+VALUES (sqlc.arg(organisationId), sqlc.arg(attribute), sqlc.arg(sources), sqlc.arg(onConflict), sqlc.arg(createdOnUtc), sqlc.arg(modifiedOnUtc), sqlc.arg(modifiedBy))
+ON CONFLICT (organisation_id, attribute) DO UPDATE
+SET sources = excluded.sources, on_conflict = excluded.on_conflict, modified_on_utc = excluded.modified_on_utc, modified_by = excluded.modified_by;
+
+-- name: DeleteAttributePolicy :exec
+DELETE FROM attribute_policies
+WHERE organisation_id = sqlc.arg(organisationId)
+AND attribute = sqlc.arg(attribute);
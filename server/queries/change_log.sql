@@ -0,0 +1,10 @@
+-- name: CreateChange :exec
+INSERT INTO change_log (organisation_id, resource_type, resource_id, operation, resource, created_on_utc)
+VALUES (sqlc.arg(organisationId), sqlc.arg(resourceType), sqlc.arg(resourceId), sqlc.arg(operation), sqlc.arg(resource), sqlc.arg(createdOnUtc));
+
+-- name: GetChangesSince :many
+SELECT * FROM change_log
+WHERE organisation_id = sqlc.arg(organisationId)
+AND id > sqlc.arg(since)
+ORDER BY id
+LIMIT sqlc.arg(limit);
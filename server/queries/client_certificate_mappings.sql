@@ -0,0 +1,24 @@
+-- name: CreateClientCertificateMapping :one
+INSERT INTO client_certificate_mappings (id, organisation_id, label, ca_bundle, match_type, match_value, scopes, created_by, created_on_utc, modified_on_utc, modified_by)
+VALUES (sqlc.arg(id), sqlc.arg(organisationId), sqlc.arg(label), sqlc.arg(caBundle), sqlc.arg(matchType), sqlc.arg(matchValue), sqlc.arg(scopes), sqlc.arg(createdBy), sqlc.arg(createdOnUtc), sqlc.arg(modifiedOnUtc), sqlc.arg(modifiedBy))
+RETURNING id;
+
+-- name: GetClientCertificateMappings :many
+SELECT * FROM client_certificate_mappings
+WHERE organisation_id = sqlc.arg(organisationId)
+ORDER BY id;
+
+-- name: GetClientCertificateMappingById :one
+SELECT * FROM client_certificate_mappings
+WHERE id = sqlc.arg(id)
+AND organisation_id = sqlc.arg(organisationId);
+
+-- name: GetClientCertificateMappingByMatch :one
+SELECT * FROM client_certificate_mappings
+WHERE match_type = sqlc.arg(matchType)
+AND match_value = sqlc.arg(matchValue);
+
+-- name: DeleteClientCertificateMapping :exec
+DELETE FROM client_certificate_mappings
+WHERE id = sqlc.arg(id)
+AND organisation_id = sqlc.arg(organisationId);
@@ -0,0 +1,33 @@
+-- name: CreateCorrelationReview :exec
+INSERT INTO correlation_reviews (id, organisation_id, identity_id, candidate_user_id, rules, confidence, created_on_utc)
+VALUES (sqlc.arg(id), sqlc.arg(organisationId), sqlc.arg(identityId), sqlc.arg(candidateUserId), sqlc.arg(rules), sqlc.arg(confidence), sqlc.arg(createdOnUtc));
+
+-- name: GetCorrelationReviews :many
+SELECT * FROM correlation_reviews
+WHERE organisation_id = sqlc.arg(organisationId)
+AND status = sqlc.arg(status)
+ORDER BY created_on_utc, id;
+
+-- name: GetCorrelationReviewById :one
+SELECT * FROM correlation_reviews
+WHERE id = sqlc.arg(id)
+AND organisation_id = sqlc.arg(organisationId);
+
+-- name: ResolveCorrelationReview :exec
+UPDATE correlation_reviews
+SET status = sqlc.arg(status), resolved_by = sqlc.arg(resolvedBy), resolved_on_utc = sqlc.arg(resolvedOnUtc)
+WHERE id = sqlc.arg(id);
+
+-- name: DismissUserCorrelationReviews :exec
+UPDATE correlation_reviews
+SET status = 'dismissed', resolved_by = sqlc.arg(resolvedBy), resolved_on_utc = sqlc.arg(resolvedOnUtc)
+WHERE status = 'pending'
+AND (candidate_user_id = sqlc.arg(userId) OR identity_id IN (SELECT id FROM scim_user_identities WHERE scim_user_identities.user_id = sqlc.arg(userId)));
+
+-- name: DeleteIdentityCorrelationReviews :exec
+DELETE FROM correlation_reviews
+WHERE identity_id = sqlc.arg(identityId);
+
+-- name: DeleteCandidateCorrelationReviews :exec
+DELETE FROM correlation_reviews
+WHERE candidate_user_id = sqlc.arg(candidateUserId);
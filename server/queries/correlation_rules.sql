@@ -0,0 +1,18 @@
+-- name: CreateCorrelationRule :exec
+INSERT INTO correlation_rules (id, organisation_id, match, birth_date_attribute, confidence, created_by, created_on_utc)
+VALUES (sqlc.arg(id), sqlc.arg(organisationId), sqlc.arg(match), sqlc.arg(birthDateAttribute), sqlc.arg(confidence), sqlc.arg(createdBy), sqlc.arg(createdOnUtc));
+
+-- name: GetCorrelationRules :many
+SELECT * FROM correlation_rules
+WHERE organisation_id = sqlc.arg(organisationId)
+ORDER BY created_on_utc, id;
+
+-- name: GetCorrelationRuleById :one
+SELECT * FROM correlation_rules
+WHERE id = sqlc.arg(id)
+AND organisation_id = sqlc.arg(organisationId);
+
+-- name: DeleteCorrelationRule :exec
+DELETE FROM correlation_rules
+WHERE id = sqlc.arg(id)
+AND organisation_id = sqlc.arg(organisationId);
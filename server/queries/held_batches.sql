@@ -0,0 +1,48 @@
+-- name: CreateHeldBatch :exec
+INSERT INTO held_batches (id, organisation_id, changes, users, opened_on_utc)
+VALUES (sqlc.arg(id), sqlc.arg(organisationId), sqlc.arg(changes), sqlc.arg(users), sqlc.arg(openedOnUtc));
+
+-- name: GetOpenHeldBatch :one
+SELECT * FROM held_batches
+WHERE organisation_id = sqlc.arg(organisationId)
+AND status = 'open';
+
+-- name: GetHeldBatch :one
+SELECT * FROM held_batches
+WHERE id = sqlc.arg(id)
+AND organisation_id = sqlc.arg(organisationId);
+
+-- name: GetHeldBatches :many
+SELECT * FROM held_batches
+WHERE organisation_id = sqlc.arg(organisationId)
+AND status = sqlc.arg(status)
+ORDER BY opened_on_utc DESC
+LIMIT sqlc.arg(limit);
+
+-- name: IncrementHeldBatchEvents :exec
+UPDATE held_batches
+SET events = events + 1
+WHERE id = sqlc.arg(id);
+
+-- name: ResolveHeldBatch :execrows
+UPDATE held_batches
+SET status = sqlc.arg(status),
+    resolved_by = sqlc.arg(resolvedBy),
+    resolved_on_utc = sqlc.arg(resolvedOnUtc)
+WHERE id = sqlc.arg(id)
+AND organisation_id = sqlc.arg(organisationId)
+AND status = 'open';
+
+-- name: CreateHeldEvent :exec
+INSERT INTO held_events (batch_id, organisation_id, resource_type, resource_id, operation, resource, deactivates, created_on_utc)
+VALUES (sqlc.arg(batchId), sqlc.arg(organisationId), sqlc.arg(resourceType), sqlc.arg(resourceId), sqlc.arg(operation), sqlc.arg(resource), sqlc.arg(deactivates), sqlc.arg(createdOnUtc));
+
+-- name: GetHeldEvents :many
+SELECT * FROM held_events
+WHERE batch_id = sqlc.arg(batchId)
+ORDER BY id
+LIMIT sqlc.arg(limit);
+
+-- name: DeleteHeldEvents :exec
+DELETE FROM held_events
+WHERE batch_id = sqlc.arg(batchId);
@@ -0,0 +1,40 @@
+-- name: GetMassChangeThreshold :one
+SELECT * FROM mass_change_thresholds
+WHERE organisation_id = sqlc.arg(organisationId);
+
+-- name: UpsertMassChangeThreshold :exec
+INSERT INTO mass_change_thresholds (organisation_id, max_count, max_percent, window_seconds, reject, modified_on_utc, modified_by)
+VALUES (sqlc.arg(organisationId), sqlc.arg(maxCount), sqlc.arg(maxPercent), sqlc.arg(windowSeconds), sqlc.arg(reject), sqlc.arg(modifiedOnUtc), sqlc.arg(modifiedBy))
+ON CONFLICT (organisation_id) DO UPDATE
+SET max_count = excluded.max_count,
+    max_percent = excluded.max_percent,
+    window_seconds = excluded.window_seconds,
+    reject = excluded.reject,
+    modified_on_utc = excluded.modified_on_utc,
+    modified_by = excluded.modified_by;
+
+-- name: SuspendMassChangeThreshold :exec
+UPDATE mass_change_thresholds
+SET suspended_until = sqlc.arg(suspendedUntil)
+WHERE organisation_id = sqlc.arg(organisationId);
+
+-- name: DeleteMassChangeThreshold :execrows
+DELETE FROM mass_change_thresholds
+WHERE organisation_id = sqlc.arg(organisationId);
+
+-- name: CreateMassChange :exec
+INSERT INTO mass_changes (organisation_id, resource_id, operation, created_on_utc)
+VALUES (sqlc.arg(organisationId), sqlc.arg(resourceId), sqlc.arg(operation), sqlc.arg(createdOnUtc));
+
+-- name: CountMassChanges :one
+SELECT COUNT(*) FROM mass_changes
+WHERE organisation_id = sqlc.arg(organisationId)
+AND created_on_utc >= sqlc.arg(since);
+
+-- name: DeleteMassChanges :exec
+DELETE FROM mass_changes
+WHERE organisation_id = sqlc.arg(organisationId);
+
+-- name: DeleteOldMassChanges :exec
+DELETE FROM mass_changes
+WHERE created_on_utc < sqlc.arg(createdBefore);
@@ -0,0 +1,24 @@
+-- name: CreateOauthClient :one
+INSERT INTO oauth_clients (id, organisation_id, client_id, secret_hash, label, scopes, created_by, created_on_utc, modified_on_utc, modified_by)
+VALUES (sqlc.arg(id), sqlc.arg(organisationId), sqlc.arg(clientId), sqlc.arg(secretHash), sqlc.arg(label), sqlc.arg(scopes), sqlc.arg(createdBy), sqlc.arg(createdOnUtc), sqlc.arg(modifiedOnUtc), sqlc.arg(modifiedBy))
+RETURNING id;
+
+-- name: GetOauthClients :many
+SELECT * FROM oauth_clients
+WHERE organisation_id = sqlc.arg(organisationId)
+ORDER BY id DESC;
+
+-- name: GetOauthClientById :one
+SELECT * FROM oauth_clients
+WHERE id = sqlc.arg(id)
+AND organisation_id = sqlc.arg(organisationId);
+
+-- name: GetOauthClientByClientId :one
+SELECT * FROM oauth_clients
+WHERE client_id = sqlc.arg(clientId);
+
+-- name: RevokeOauthClient :exec
+UPDATE oauth_clients
+SET revoked_on_utc = sqlc.arg(revokedOnUtc), modified_on_utc = sqlc.arg(modifiedOnUtc), modified_by = sqlc.arg(modifiedBy)
+WHERE id = sqlc.arg(id)
+AND organisation_id = sqlc.arg(organisationId);
@@ -0,0 +1,11 @@
+-- name: CreateOauthSigningKey :exec
+INSERT INTO oauth_signing_keys (id, algorithm, private_key, created_on_utc)
+VALUES (sqlc.arg(id), sqlc.arg(algorithm), sqlc.arg(privateKey), sqlc.arg(createdOnUtc));
+
+-- name: GetOauthSigningKeys :many
+SELECT * FROM oauth_signing_keys
+ORDER BY created_on_utc DESC;
+
+-- name: DeleteOauthSigningKey :exec
+DELETE FROM oauth_signing_keys
+WHERE id = sqlc.arg(id);
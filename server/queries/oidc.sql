@@ -0,0 +1,30 @@
+-- name: GetOidcIdentity :one
+SELECT * FROM oidc_identities
+WHERE issuer = sqlc.arg(issuer)
+AND subject = sqlc.arg(subject);
+
+-- name: CreateOidcIdentity :exec
+INSERT INTO oidc_identities (issuer, subject, user_id, created_on_utc, last_login_on_utc)
+VALUES (sqlc.arg(issuer), sqlc.arg(subject), sqlc.arg(userId), sqlc.arg(createdOnUtc), sqlc.arg(lastLoginOnUtc));
+
+-- name: UpdateOidcIdentityLastLogin :exec
+UPDATE oidc_identities
+SET last_login_on_utc = sqlc.arg(lastLoginOnUtc)
+WHERE issuer = sqlc.arg(issuer)
+AND subject = sqlc.arg(subject);
+
+-- name: CreateOidcLogin :exec
+INSERT INTO oidc_logins (state, nonce, code_verifier, redirect, created_on_utc)
+VALUES (sqlc.arg(state), sqlc.arg(nonce), sqlc.arg(codeVerifier), sqlc.arg(redirect), sqlc.arg(createdOnUtc));
+
+-- name: GetOidcLogin :one
+SELECT * FROM oidc_logins
+WHERE state = sqlc.arg(state);
+
+-- name: DeleteOidcLogin :execrows
+DELETE FROM oidc_logins
+WHERE state = sqlc.arg(state);
+
+-- name: DeleteExpiredOidcLogins :execrows
+DELETE FROM oidc_logins
+WHERE created_on_utc < sqlc.arg(before);
@@ -1,6 +1,6 @@
 -- name: CreateOrganisationToken :one
-INSERT INTO organisation_tokens (id, organisation_id, token, created_by, created_on_utc, modified_on_utc, modified_by)
-VALUES (sqlc.arg(id), sqlc.arg(organisationId), sqlc.arg(token), sqlc.arg(createdBy), sqlc.arg(createdOnUtc), sqlc.arg(modifiedOnUtc), sqlc.arg(modifiedBy))
+INSERT INTO organisation_tokens (id, organisation_id, label, token_prefix, token_hash, scopes, source, expires_on_utc, created_by, created_on_utc, modified_on_utc, modified_by)
+VALUES (sqlc.arg(id), sqlc.arg(organisationId), sqlc.arg(label), sqlc.arg(tokenPrefix), sqlc.arg(tokenHash), sqlc.arg(scopes), sqlc.arg(source), sqlc.arg(expiresOnUtc), sqlc.arg(createdBy), sqlc.arg(createdOnUtc), sqlc.arg(modifiedOnUtc), sqlc.arg(modifiedBy))
 RETURNING id;
 
 -- name: GetOrganisationTokens :many
@@ -8,6 +8,34 @@ SELECT * FROM organisation_tokens
 WHERE organisation_id = sqlc.arg(organisationId)
 ORDER BY id DESC;
 
--- name: GetOrganisationTokenByToken :one
+-- name: GetOrganisationTokenById :one
 SELECT * FROM organisation_tokens
-WHERE token = sqlc.arg(token);
+WHERE id = sqlc.arg(id)
+AND organisation_id = sqlc.arg(organisationId);
+
+-- name: GetOrganisationTokenByHash :one
+SELECT * FROM organisation_tokens
+WHERE token_hash = sqlc.arg(tokenHash);
+
+-- name: UpdateOrganisationToken :exec
+UPDATE organisation_tokens
+SET label = sqlc.arg(label), scopes = sqlc.arg(scopes), source = sqlc.arg(source), expires_on_utc = sqlc.arg(expiresOnUtc), modified_on_utc = sqlc.arg(modifiedOnUtc), modified_by = sqlc.arg(modifiedBy)
+WHERE id = sqlc.arg(id)
+AND organisation_id = sqlc.arg(organisationId);
+
+-- name: UpdateOrganisationTokenHash :exec
+UPDATE organisation_tokens
+SET token_prefix = sqlc.arg(tokenPrefix), token_hash = sqlc.arg(tokenHash), modified_on_utc = sqlc.arg(modifiedOnUtc), modified_by = sqlc.arg(modifiedBy)
+WHERE id = sqlc.arg(id)
+AND organisation_id = sqlc.arg(organisationId);
+
+-- name: UpdateOrganisationTokenLastUsed :exec
+UPDATE organisation_tokens
+SET last_used_on_utc = sqlc.arg(lastUsedOnUtc), last_used_ip = sqlc.arg(lastUsedIp)
+WHERE id = sqlc.arg(id);
+
+-- name: RevokeOrganisationToken :exec
+UPDATE organisation_tokens
+SET revoked_on_utc = sqlc.arg(revokedOnUtc), modified_on_utc = sqlc.arg(modifiedOnUtc), modified_by = sqlc.arg(modifiedBy)
+WHERE id = sqlc.arg(id)
+AND organisation_id = sqlc.arg(organisationId);
@@ -1,3 +1,32 @@
 -- name: CreateOrganisationUser :exec
-INSERT INTO user_organisations (user_id, organisation_id, created_on_utc, modified_on_utc)
-VALUES (sqlc.arg(userId), sqlc.arg(organisationId), sqlc.arg(createdOnUTC), sqlc.arg(modifiedOnUTC));
+INSERT INTO user_organisations (user_id, organisation_id, role, created_on_utc, modified_on_utc)
+VALUES (sqlc.arg(userId), sqlc.arg(organisationId), sqlc.arg(role), sqlc.arg(createdOnUTC), sqlc.arg(modifiedOnUTC));
+
+-- name: GetOrganisationUser :one
+SELECT * FROM user_organisations
+WHERE user_id = sqlc.arg(userId)
+AND organisation_id = sqlc.arg(organisationId);
+
+-- name: GetOrganisationMembers :many
+SELECT users.id, users.username, users.email, user_organisations.role, user_organisations.created_on_utc FROM user_organisations
+JOIN users ON users.id = user_organisations.user_id
+WHERE user_organisations.organisation_id = sqlc.arg(organisationId)
+ORDER BY users.username;
+
+-- name: CountOrganisationUsersWithRole :one
+SELECT COUNT(*) FROM user_organisations
+WHERE organisation_id = sqlc.arg(organisationId)
+AND role = sqlc.arg(role);
+
+-- name: DeleteOrganisationUser :execrows
+DELETE FROM user_organisations
+WHERE user_id = sqlc.arg(userId)
+AND organisation_id = sqlc.arg(organisationId);
+
+-- name: UpsertOrganisationUser :exec
+INSERT INTO user_organisations (user_id, organisation_id, role, created_on_utc, modified_on_utc)
+VALUES (sqlc.arg(userId), sqlc.arg(organisationId), sqlc.arg(role), sqlc.arg(createdOnUTC), sqlc.arg(modifiedOnUTC))
+ON CONFLICT (user_id, organisation_id) DO UPDATE
+SET role = excluded.role,
+    modified_on_utc = excluded.modified_on_utc
+WHERE role != excluded.role;
@@ -1,4 +1,33 @@
 -- name: CreateOrganisation :one
-INSERT INTO organisations (id, name, created_by, created_on_utc, modified_on_utc, modified_by)
-VALUES (sqlc.arg(id), sqlc.arg(name), sqlc.arg(createdBy), sqlc.arg(createdOnUTC), sqlc.arg(modifiedOnUTC), sqlc.arg(modifiedBy))
+INSERT INTO organisations (id, name, slug, created_by, created_on_utc, modified_on_utc, modified_by)
+VALUES (sqlc.arg(id), sqlc.arg(name), sqlc.arg(slug), sqlc.arg(createdBy), sqlc.arg(createdOnUTC), sqlc.arg(modifiedOnUTC), sqlc.arg(modifiedBy))
 RETURNING id;
+
+-- name: GetOrganisationBySlug :one
+SELECT * FROM organisations
+WHERE slug = sqlc.arg(slug);
+
+-- name: GetOrganisationById :one
+SELECT * FROM organisations
+WHERE id = sqlc.arg(id);
+
+-- name: GetOrganisationsForUser :many
+SELECT * FROM organisations
+WHERE id IN (SELECT organisation_id FROM user_organisations WHERE user_organisations.user_id = sqlc.arg(userId))
+ORDER BY name;
+
+-- name: UpdateOrganisation :exec
+UPDATE organisations
+SET name = sqlc.arg(name),
+    slug = sqlc.arg(slug),
+    modified_on_utc = sqlc.arg(modifiedOnUtc),
+    modified_by = sqlc.arg(modifiedBy)
+WHERE id = sqlc.arg(id);
+
+-- name: DeleteOrganisation :execrows
+DELETE FROM organisations
+WHERE id = sqlc.arg(id);
+
+-- name: GetOrganisationByName :one
+SELECT * FROM organisations
+WHERE name = sqlc.arg(name);
@@ -0,0 +1,102 @@
+-- name: CreateOutboxEvent :exec
+INSERT INTO outbox_events (organisation_id, target_id, resource_type, resource_id, operation, payload, next_attempt_on_utc, created_on_utc)
+VALUES (sqlc.arg(organisationId), sqlc.arg(targetId), sqlc.arg(resourceType), sqlc.arg(resourceId), sqlc.arg(operation), sqlc.arg(payload), sqlc.arg(nextAttemptOnUtc), sqlc.arg(createdOnUtc));
+
+-- name: GetReadyOutboxEvents :many
+SELECT * FROM outbox_events
+WHERE target_id = sqlc.arg(targetId)
+AND status = 'pending'
+AND next_attempt_on_utc <= sqlc.arg(now)
+AND NOT EXISTS (
+    SELECT 1 FROM outbox_events p
+    WHERE p.target_id = outbox_events.target_id
+    AND p.resource_type = outbox_events.resource_type
+    AND p.resource_id = outbox_events.resource_id
+    AND p.status IN ('pending', 'dead')
+    AND p.id < outbox_events.id
+)
+ORDER BY id
+LIMIT sqlc.arg(limit);
+
+-- name: GetOutboxEventsByTarget :many
+SELECT * FROM outbox_events
+WHERE target_id = sqlc.arg(targetId)
+AND organisation_id = sqlc.arg(organisationId)
+AND status = sqlc.arg(status)
+ORDER BY id DESC
+LIMIT sqlc.arg(limit);
+
+-- name: MarkOutboxEventDelivered :exec
+UPDATE outbox_events
+SET status = 'delivered',
+    attempts = attempts + 1,
+    last_error = NULL,
+    delivered_on_utc = sqlc.arg(deliveredOnUtc)
+WHERE id = sqlc.arg(id);
+
+-- name: MarkOutboxEventFailed :exec
+UPDATE outbox_events
+SET status = sqlc.arg(status),
+    attempts = sqlc.arg(attempts),
+    next_attempt_on_utc = sqlc.arg(nextAttemptOnUtc),
+    last_error = sqlc.arg(lastError)
+WHERE id = sqlc.arg(id);
+
+-- name: GetOutboxEvent :one
+SELECT * FROM outbox_events
+WHERE id = sqlc.arg(id)
+AND target_id = sqlc.arg(targetId)
+AND organisation_id = sqlc.arg(organisationId);
+
+-- name: RequeueOutboxEvent :execrows
+UPDATE outbox_events
+SET status = 'pending',
+    attempts = 0,
+    next_attempt_on_utc = sqlc.arg(nextAttemptOnUtc)
+WHERE id = sqlc.arg(id)
+AND target_id = sqlc.arg(targetId)
+AND organisation_id = sqlc.arg(organisationId)
+AND status = 'dead';
+
+-- name: DiscardOutboxEvent :execrows
+UPDATE outbox_events
+SET status = 'discarded'
+WHERE id = sqlc.arg(id)
+AND target_id = sqlc.arg(targetId)
+AND organisation_id = sqlc.arg(organisationId)
+AND status = 'dead';
+
+-- name: DeleteDeliveredOutboxEvents :exec
+DELETE FROM outbox_events
+WHERE status = 'delivered'
+AND delivered_on_utc < sqlc.arg(deliveredBefore);
+
+-- name: GetPreviousOutboxEvent :one
+SELECT * FROM outbox_events
+WHERE target_id = sqlc.arg(targetId)
+AND resource_type = sqlc.arg(resourceType)
+AND resource_id = sqlc.arg(resourceId)
+AND id < sqlc.arg(id)
+ORDER BY id DESC
+LIMIT 1;
+
+-- name: GetNextDeliveredOutboxEvent :one
+SELECT * FROM outbox_events
+WHERE target_id = sqlc.arg(targetId)
+AND resource_type = sqlc.arg(resourceType)
+AND resource_id = sqlc.arg(resourceId)
+AND id > sqlc.arg(id)
+AND status = 'delivered'
+ORDER BY id
+LIMIT 1;
+
+-- name: GetPendingOutboxResources :many
+SELECT resource_type, resource_id FROM outbox_events
+WHERE target_id = sqlc.arg(targetId)
+AND status = 'pending';
+
+-- name: CountTargetOutboxEvents :many
+SELECT status, COUNT(*) AS count FROM outbox_events
+WHERE target_id = sqlc.arg(targetId)
+AND organisation_id = sqlc.arg(organisationId)
+GROUP BY status;
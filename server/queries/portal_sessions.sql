@@ -0,0 +1,26 @@
+-- name: CreatePortalSession :exec
+INSERT INTO portal_sessions (id, user_id, refresh_token_hash, csrf_token, created_on_utc, refreshed_on_utc, expires_on_utc)
+VALUES (sqlc.arg(id), sqlc.arg(userId), sqlc.arg(refreshTokenHash), sqlc.arg(csrfToken), sqlc.arg(createdOnUtc), sqlc.arg(refreshedOnUtc), sqlc.arg(expiresOnUtc));
+
+-- name: GetPortalSession :one
+SELECT * FROM portal_sessions
+WHERE id = sqlc.arg(id);
+
+-- name: RefreshPortalSession :execrows
+UPDATE portal_sessions
+SET refresh_token_hash = sqlc.arg(refreshTokenHash),
+    refreshed_on_utc = sqlc.arg(refreshedOnUtc),
+    expires_on_utc = sqlc.arg(expiresOnUtc)
+WHERE id = sqlc.arg(id)
+  AND refresh_token_hash = sqlc.arg(previousRefreshTokenHash)
+  AND revoked_on_utc IS NULL;
+
+-- name: RevokePortalSession :exec
+UPDATE portal_sessions
+SET revoked_on_utc = sqlc.arg(revokedOnUtc)
+WHERE id = sqlc.arg(id)
+  AND revoked_on_utc IS NULL;
+
+-- name: DeleteExpiredPortalSessions :execrows
+DELETE FROM portal_sessions
+WHERE expires_on_utc < sqlc.arg(before);
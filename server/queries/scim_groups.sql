@@ -4,6 +4,40 @@ WHERE organisation_id = sqlc.arg(organisationId)
 ORDER BY id;
 
 -- name: CreateScimGroup :one
-INSERT INTO scim_groups (id, display_name, external_id, meta_version, organisation_id)
-VALUES (sqlc.arg(id), sqlc.arg(displayName), sqlc.arg(externalId), sqlc.arg(metaVersion), sqlc.arg(organisationId))
+INSERT INTO scim_groups (id, display_name, external_id, meta_resource_type, meta_created, meta_last_modified, meta_version, organisation_id)
+VALUES (sqlc.arg(id), sqlc.arg(displayName), sqlc.arg(externalId), 'Group', sqlc.arg(metaCreated), sqlc.arg(metaCreated), sqlc.arg(metaVersion), sqlc.arg(organisationId))
 RETURNING id;
+
+-- name: GetScimGroupsAfter :many
+SELECT * FROM scim_groups
+WHERE organisation_id = sqlc.arg(organisationId)
+AND id > sqlc.arg(after)
+ORDER BY id
+LIMIT sqlc.arg(limit);
+
+-- name: CountScimGroups :one
+SELECT COUNT(*) FROM scim_groups
+WHERE organisation_id = sqlc.arg(organisationId);
+
+-- name: GetScimGroupById :one
+SELECT * FROM scim_groups
+WHERE id = sqlc.arg(id)
+AND organisation_id = sqlc.arg(organisationId);
+
+-- name: GetScimGroupByDisplayName :one
+SELECT * FROM scim_groups
+WHERE organisation_id = sqlc.arg(organisationId)
+AND display_name = sqlc.arg(displayName) COLLATE NOCASE;
+
+-- name: UpdateScimGroup :exec
+UPDATE scim_groups
+SET display_name = sqlc.arg(displayName),
+    external_id = sqlc.arg(externalId),
+    meta_last_modified = sqlc.arg(metaLastModified)
+WHERE id = sqlc.arg(id)
+AND organisation_id = sqlc.arg(organisationId);
+
+-- name: DeleteScimGroup :execrows
+DELETE FROM scim_groups
+WHERE id = sqlc.arg(id)
+AND organisation_id = sqlc.arg(organisationId);
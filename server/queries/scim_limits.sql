@@ -0,0 +1,19 @@
+-- name: GetScimLimits :one
+SELECT * FROM scim_limits
+WHERE organisation_id = sqlc.arg(organisationId);
+
+-- name: UpsertScimLimits :exec
+INSERT INTO scim_limits (organisation_id, rate_limit, burst, token_rate_limit, token_burst, max_body_bytes, modified_on_utc, modified_by)
+VALUES (sqlc.arg(organisationId), sqlc.arg(rateLimit), sqlc.arg(burst), sqlc.arg(tokenRateLimit), sqlc.arg(tokenBurst), sqlc.arg(maxBodyBytes), sqlc.arg(modifiedOnUtc), sqlc.arg(modifiedBy))
+ON CONFLICT (organisation_id) DO UPDATE
+SET rate_limit = excluded.rate_limit,
+    burst = excluded.burst,
+    token_rate_limit = excluded.token_rate_limit,
+    token_burst = excluded.token_burst,
+    max_body_bytes = excluded.max_body_bytes,
+    modified_on_utc = excluded.modified_on_utc,
+    modified_by = excluded.modified_by;
+
+-- name: DeleteScimLimits :execrows
+DELETE FROM scim_limits
+WHERE organisation_id = sqlc.arg(organisationId);
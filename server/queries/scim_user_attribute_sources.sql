@@ -0,0 +1,14 @@
+-- name: GetUserAttributeSources :many
+SELECT * FROM scim_user_attribute_sources
+WHERE user_id = sqlc.arg(userId)
+ORDER BY attribute;
+
+-- name: UpsertUserAttributeSource :exec
+INSERT INTO scim_user_attribute_sources (user_id, attribute, source, modified_on_utc)
+VALUES (sqlc.arg(userId), sqlc.arg(attribute), sqlc.arg(source), sqlc.arg(modifiedOnUtc))
+ON CONFLICT (user_id, attribute) DO UPDATE
+SET source = excluded.source, modified_on_utc = excluded.modified_on_utc;
+
+-- name: DeleteUserAttributeSources :exec
+DELETE FROM scim_user_attribute_sources
+WHERE user_id = sqlc.arg(userId);
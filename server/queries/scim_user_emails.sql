@@ -21,3 +21,7 @@ SELECT
 FROM scim_user_emails
 WHERE user_id = sqlc.arg(user_id)
 ORDER BY value;
+
+-- name: DeleteUserEmails :exec
+DELETE FROM scim_user_emails
+WHERE user_id = sqlc.arg(user_id);
@@ -14,3 +14,19 @@ SELECT
 FROM scim_user_group_memberships
 WHERE user_id = sqlc.arg(user_id)
 ORDER BY group_id;
+
+-- name: DeleteUserGroupMemberships :exec
+DELETE FROM scim_user_group_memberships
+WHERE user_id = sqlc.arg(user_id);
+
+-- name: GetGroupMembers :many
+SELECT
+    user_id,
+    group_id
+FROM scim_user_group_memberships
+WHERE group_id = sqlc.arg(group_id)
+ORDER BY user_id;
+
+-- name: DeleteGroupMembers :exec
+DELETE FROM scim_user_group_memberships
+WHERE group_id = sqlc.arg(group_id);
@@ -0,0 +1,57 @@
+-- name: CreateUserIdentity :exec
+INSERT INTO scim_user_identities (id, organisation_id, user_id, source, resource, normalised_name, birth_date, rules, confidence, created_on_utc, modified_on_utc)
+VALUES (sqlc.arg(id), sqlc.arg(organisationId), sqlc.arg(userId), sqlc.arg(source), sqlc.arg(resource), sqlc.arg(normalisedName), sqlc.arg(birthDate), sqlc.arg(rules), sqlc.arg(confidence), sqlc.arg(createdOnUtc), sqlc.arg(modifiedOnUtc));
+
+-- name: GetUserIdentity :one
+SELECT * FROM scim_user_identities
+WHERE id = sqlc.arg(id)
+AND organisation_id = sqlc.arg(organisationId);
+
+-- name: GetUserIdentities :many
+SELECT * FROM scim_user_identities
+WHERE user_id = sqlc.arg(userId)
+ORDER BY created_on_utc, id;
+
+-- name: GetOrganisationUserIdentities :many
+SELECT * FROM scim_user_identities
+WHERE organisation_id = sqlc.arg(organisationId)
+AND resource IS NOT NULL
+ORDER BY id;
+
+-- name: UpdateUserIdentityResource :exec
+UPDATE scim_user_identities
+SET resource = sqlc.arg(resource), normalised_name = sqlc.arg(normalisedName), birth_date = sqlc.arg(birthDate), modified_on_utc = sqlc.arg(modifiedOnUtc)
+WHERE id = sqlc.arg(id);
+
+-- name: UpdateUserIdentityBirthDate :exec
+UPDATE scim_user_identities
+SET birth_date = sqlc.arg(birthDate)
+WHERE id = sqlc.arg(id);
+
+-- name: GetUserIdentitiesByNameAndBirthDate :many
+SELECT * FROM scim_user_identities
+WHERE organisation_id = sqlc.arg(organisationId)
+AND normalised_name = sqlc.arg(normalisedName)
+AND birth_date = sqlc.arg(birthDate)
+ORDER BY user_id;
+
+-- name: UpdateUserIdentityUser :exec
+UPDATE scim_user_identities
+SET user_id = sqlc.arg(userId), rules = sqlc.arg(rules), confidence = sqlc.arg(confidence), modified_on_utc = sqlc.arg(modifiedOnUtc)
+WHERE id = sqlc.arg(id);
+
+-- name: MoveUserIdentities :exec
+UPDATE scim_user_identities
+SET user_id = sqlc.arg(userId), modified_on_utc = sqlc.arg(modifiedOnUtc)
+WHERE user_id = sqlc.arg(previousUserId);
+
+-- name: GetSourceUserIdentities :many
+SELECT * FROM scim_user_identities
+WHERE organisation_id = sqlc.arg(organisationId)
+AND source = sqlc.arg(source)
+ORDER BY created_on_utc, id;
+
+-- name: DeleteUserIdentity :exec
+DELETE FROM scim_user_identities
+WHERE id = sqlc.arg(id)
+AND organisation_id = sqlc.arg(organisationId);
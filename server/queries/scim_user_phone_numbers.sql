@@ -19,3 +19,7 @@ INSERT INTO scim_user_phone_numbers (
 SELECT * FROM scim_user_phone_numbers
 WHERE user_id = sqlc.arg(user_id)
 ORDER BY value;
+
+-- name: DeleteUserPhoneNumbers :exec
+DELETE FROM scim_user_phone_numbers
+WHERE user_id = sqlc.arg(user_id);
@@ -72,3 +72,71 @@ INSERT INTO scim_users (
     sqlc.arg(manager_id),
     sqlc.arg(organisation_id)
 ) RETURNING id;
+
+-- name: UpdateScimUser :exec
+UPDATE scim_users
+SET external_id = sqlc.arg(external_id),
+    user_name = sqlc.arg(user_name),
+    display_name = sqlc.arg(display_name),
+    nick_name = sqlc.arg(nick_name),
+    profile_url = sqlc.arg(profile_url),
+    title = sqlc.arg(title),
+    user_type = sqlc.arg(user_type),
+    preferred_language = sqlc.arg(preferred_language),
+    locale = sqlc.arg(locale),
+    timezone = sqlc.arg(timezone),
+    active = sqlc.arg(active),
+    meta_last_modified = sqlc.arg(meta_last_modified),
+    name_formatted = sqlc.arg(name_formatted),
+    name_family_name = sqlc.arg(name_family_name),
+    name_given_name = sqlc.arg(name_given_name),
+    name_middle_name = sqlc.arg(name_middle_name),
+    name_honorific_prefix = sqlc.arg(name_honorific_prefix),
+    name_honorific_suffix = sqlc.arg(name_honorific_suffix),
+    employee_number = sqlc.arg(employee_number),
+    organization = sqlc.arg(organization),
+    department = sqlc.arg(department),
+    division = sqlc.arg(division),
+    cost_center = sqlc.arg(cost_center),
+    manager_id = sqlc.arg(manager_id)
+WHERE id = sqlc.arg(id)
+AND organisation_id = sqlc.arg(organisation_id);
+
+-- name: GetScimUsersByExternalId :many
+SELECT * FROM scim_users
+WHERE organisation_id = sqlc.arg(organisationId)
+AND external_id = sqlc.arg(externalId);
+
+-- name: GetScimUsersByEmployeeNumber :many
+SELECT * FROM scim_users
+WHERE organisation_id = sqlc.arg(organisationId)
+AND employee_number = sqlc.arg(employeeNumber);
+
+-- name: GetScimUsersByPrimaryEmail :many
+SELECT * FROM scim_users
+WHERE organisation_id = sqlc.arg(organisationId)
+AND id IN (
+    SELECT user_id FROM scim_user_emails
+    WHERE scim_user_emails.value = sqlc.arg(email) COLLATE NOCASE
+    AND primary_email = TRUE
+);
+
+-- name: GetScimUserByUserName :one
+SELECT * FROM scim_users
+WHERE user_name = sqlc.arg(userName);
+
+-- name: DeleteScimUser :exec
+DELETE FROM scim_users
+WHERE id = sqlc.arg(id)
+AND organisation_id = sqlc.arg(organisationId);
+
+-- name: CountScimUsers :one
+SELECT COUNT(*) FROM scim_users
+WHERE organisation_id = sqlc.arg(organisationId);
+
+-- name: GetScimUserIdsAfter :many
+SELECT id FROM scim_users
+WHERE organisation_id = sqlc.arg(organisationId)
+AND id > sqlc.arg(after)
+ORDER BY id
+LIMIT sqlc.arg(limit);
@@ -0,0 +1,19 @@
+-- name: CreateSecurityEvent :exec
+INSERT INTO security_events (jti, target_id, token, created_on_utc)
+VALUES (sqlc.arg(jti), sqlc.arg(targetId), sqlc.arg(token), sqlc.arg(createdOnUtc))
+ON CONFLICT (jti) DO NOTHING;
+
+-- name: GetSecurityEvents :many
+SELECT * FROM security_events
+WHERE target_id = sqlc.arg(targetId)
+ORDER BY created_on_utc, jti
+LIMIT sqlc.arg(limit);
+
+-- name: CountSecurityEvents :one
+SELECT COUNT(*) FROM security_events
+WHERE target_id = sqlc.arg(targetId);
+
+-- name: DeleteSecurityEvent :exec
+DELETE FROM security_events
+WHERE jti = sqlc.arg(jti)
+AND target_id = sqlc.arg(targetId);
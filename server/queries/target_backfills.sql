@@ -0,0 +1,52 @@
+-- name: CreateTargetBackfill :exec
+INSERT INTO target_backfills (id, organisation_id, target_id, status, phase, total_users, total_groups, created_by, started_on_utc, modified_on_utc)
+VALUES (sqlc.arg(id), sqlc.arg(organisationId), sqlc.arg(targetId), sqlc.arg(status), sqlc.arg(phase), sqlc.arg(totalUsers), sqlc.arg(totalGroups), sqlc.arg(createdBy), sqlc.arg(startedOnUtc), sqlc.arg(modifiedOnUtc));
+
+-- name: GetTargetBackfill :one
+SELECT * FROM target_backfills
+WHERE id = sqlc.arg(id)
+AND target_id = sqlc.arg(targetId)
+AND organisation_id = sqlc.arg(organisationId);
+
+-- name: GetTargetBackfills :many
+SELECT * FROM target_backfills
+WHERE target_id = sqlc.arg(targetId)
+AND organisation_id = sqlc.arg(organisationId)
+ORDER BY started_on_utc DESC
+LIMIT sqlc.arg(limit);
+
+-- name: GetActiveTargetBackfill :one
+SELECT * FROM target_backfills
+WHERE target_id = sqlc.arg(targetId)
+AND status IN ('running', 'paused');
+
+-- name: GetRunningTargetBackfills :many
+SELECT * FROM target_backfills
+WHERE status = 'running'
+ORDER BY started_on_utc;
+
+-- name: UpdateTargetBackfillProgress :exec
+UPDATE target_backfills
+SET phase = sqlc.arg(phase),
+    last_resource_id = sqlc.arg(lastResourceId),
+    processed_users = sqlc.arg(processedUsers),
+    processed_groups = sqlc.arg(processedGroups),
+    queued = sqlc.arg(queued),
+    modified_on_utc = sqlc.arg(modifiedOnUtc)
+WHERE id = sqlc.arg(id);
+
+-- name: SetTargetBackfillStatus :execrows
+UPDATE target_backfills
+SET status = sqlc.arg(status),
+    modified_on_utc = sqlc.arg(modifiedOnUtc)
+WHERE id = sqlc.arg(id)
+AND status = sqlc.arg(currentStatus);
+
+-- name: CompleteTargetBackfill :execrows
+UPDATE target_backfills
+SET status = sqlc.arg(status),
+    error = sqlc.arg(error),
+    modified_on_utc = sqlc.arg(completedOnUtc),
+    completed_on_utc = sqlc.arg(completedOnUtc)
+WHERE id = sqlc.arg(id)
+AND status IN ('running', 'paused');
@@ -0,0 +1,42 @@
+-- name: CreateTargetReconciliation :exec
+INSERT INTO target_reconciliations (id, organisation_id, target_id, trigger, repair, created_by, started_on_utc)
+VALUES (sqlc.arg(id), sqlc.arg(organisationId), sqlc.arg(targetId), sqlc.arg(trigger), sqlc.arg(repair), sqlc.arg(createdBy), sqlc.arg(startedOnUtc));
+
+-- name: CompleteTargetReconciliation :exec
+UPDATE target_reconciliations
+SET status = sqlc.arg(status),
+    missing = sqlc.arg(missing),
+    extra = sqlc.arg(extra),
+    changed = sqlc.arg(changed),
+    membership = sqlc.arg(membership),
+    repaired = sqlc.arg(repaired),
+    report = sqlc.arg(report),
+    error = sqlc.arg(error),
+    completed_on_utc = sqlc.arg(completedOnUtc)
+WHERE id = sqlc.arg(id);
+
+-- name: GetTargetReconciliations :many
+SELECT * FROM target_reconciliations
+WHERE target_id = sqlc.arg(targetId)
+AND organisation_id = sqlc.arg(organisationId)
+ORDER BY started_on_utc DESC
+LIMIT sqlc.arg(limit);
+
+-- name: GetTargetReconciliation :one
+SELECT * FROM target_reconciliations
+WHERE id = sqlc.arg(id)
+AND target_id = sqlc.arg(targetId)
+AND organisation_id = sqlc.arg(organisationId);
+
+-- name: GetLatestTargetReconciliation :one
+SELECT * FROM target_reconciliations
+WHERE target_id = sqlc.arg(targetId)
+ORDER BY started_on_utc DESC
+LIMIT 1;
+
+-- name: FailRunningTargetReconciliations :exec
+UPDATE target_reconciliations
+SET status = 'failed',
+    error = sqlc.arg(error),
+    completed_on_utc = sqlc.arg(completedOnUtc)
+WHERE status = 'running';
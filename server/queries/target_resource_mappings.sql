@@ -0,0 +1,26 @@
+-- name: GetTargetResourceMapping :one
+SELECT * FROM target_resource_mappings
+WHERE target_id = sqlc.arg(targetId)
+AND resource_type = sqlc.arg(resourceType)
+AND local_id = sqlc.arg(localId);
+
+-- name: UpsertTargetResourceMapping :exec
+INSERT INTO target_resource_mappings (target_id, resource_type, local_id, remote_id, remote_version, sent_attributes, created_on_utc, modified_on_utc)
+VALUES (sqlc.arg(targetId), sqlc.arg(resourceType), sqlc.arg(localId), sqlc.arg(remoteId), sqlc.arg(remoteVersion), sqlc.arg(sentAttributes), sqlc.arg(createdOnUtc), sqlc.arg(modifiedOnUtc))
+ON CONFLICT (target_id, resource_type, local_id) DO UPDATE
+SET remote_id = excluded.remote_id,
+    remote_version = excluded.remote_version,
+    sent_attributes = excluded.sent_attributes,
+    modified_on_utc = excluded.modified_on_utc;
+
+-- name: DeleteTargetResourceMapping :exec
+DELETE FROM target_resource_mappings
+WHERE target_id = sqlc.arg(targetId)
+AND resource_type = sqlc.arg(resourceType)
+AND local_id = sqlc.arg(localId);
+
+-- name: GetTargetResourceMappings :many
+SELECT * FROM target_resource_mappings
+WHERE target_id = sqlc.arg(targetId)
+AND resource_type = sqlc.arg(resourceType)
+ORDER BY local_id;
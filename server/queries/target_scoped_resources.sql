@@ -0,0 +1,16 @@
+-- name: GetTargetScopedResource :one
+SELECT * FROM target_scoped_resources
+WHERE target_id = sqlc.arg(targetId)
+AND resource_type = sqlc.arg(resourceType)
+AND resource_id = sqlc.arg(resourceId);
+
+-- name: CreateTargetScopedResource :exec
+INSERT INTO target_scoped_resources (target_id, resource_type, resource_id, created_on_utc)
+VALUES (sqlc.arg(targetId), sqlc.arg(resourceType), sqlc.arg(resourceId), sqlc.arg(createdOnUtc))
+ON CONFLICT (target_id, resource_type, resource_id) DO NOTHING;
+
+-- name: DeleteTargetScopedResource :exec
+DELETE FROM target_scoped_resources
+WHERE target_id = sqlc.arg(targetId)
+AND resource_type = sqlc.arg(resourceType)
+AND resource_id = sqlc.arg(resourceId);
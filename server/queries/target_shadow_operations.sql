@@ -0,0 +1,47 @@
+-- name: CreateTargetShadowOperation :exec
+INSERT INTO target_shadow_operations (organisation_id, target_id, resource_type, resource_id, operation, payload, skipped, error, created_on_utc)
+VALUES (sqlc.arg(organisationId), sqlc.arg(targetId), sqlc.arg(resourceType), sqlc.arg(resourceId), sqlc.arg(operation), sqlc.arg(payload), sqlc.arg(skipped), sqlc.arg(error), sqlc.arg(createdOnUtc));
+
+-- name: GetTargetShadowOperations :many
+SELECT * FROM target_shadow_operations
+WHERE target_id = sqlc.arg(targetId)
+AND organisation_id = sqlc.arg(organisationId)
+AND id < sqlc.arg(before)
+ORDER BY id DESC
+LIMIT sqlc.arg(limit);
+
+-- name: GetPreviousTargetShadowOperation :one
+SELECT * FROM target_shadow_operations
+WHERE target_id = sqlc.arg(targetId)
+AND resource_type = sqlc.arg(resourceType)
+AND resource_id = sqlc.arg(resourceId)
+AND id < sqlc.arg(id)
+AND skipped = 0
+AND error IS NULL
+ORDER BY id DESC
+LIMIT 1;
+
+-- name: GetTargetShadowOperationCounts :many
+SELECT operation, skipped, COUNT(*) AS count FROM target_shadow_operations
+WHERE target_id = sqlc.arg(targetId)
+AND error IS NULL
+GROUP BY operation, skipped
+ORDER BY operation;
+
+-- name: CountFailedTargetShadowOperations :one
+SELECT COUNT(*) FROM target_shadow_operations
+WHERE target_id = sqlc.arg(targetId)
+AND error IS NOT NULL;
+
+-- name: CountTargetShadowResources :one
+SELECT COUNT(DISTINCT resource_id) FROM target_shadow_operations
+WHERE target_id = sqlc.arg(targetId);
+
+-- name: DeleteTargetShadowOperations :exec
+DELETE FROM target_shadow_operations
+WHERE target_id = sqlc.arg(targetId)
+AND organisation_id = sqlc.arg(organisationId);
+
+-- name: DeleteOldTargetShadowOperations :exec
+DELETE FROM target_shadow_operations
+WHERE created_on_utc < sqlc.arg(createdBefore);
@@ -0,0 +1,62 @@
+-- name: CreateTarget :one
+INSERT INTO targets (id, organisation_id, name, type, config, attribute_mapping, user_scope, group_scope, deprovision_action, reconcile_interval, reconcile_repair, mode, rate_limit, max_in_flight, enabled, created_by, created_on_utc, modified_on_utc, modified_by)
+VALUES (sqlc.arg(id), sqlc.arg(organisationId), sqlc.arg(name), sqlc.arg(type), sqlc.arg(config), sqlc.arg(attributeMapping), sqlc.arg(userScope), sqlc.arg(groupScope), sqlc.arg(deprovisionAction), sqlc.arg(reconcileInterval), sqlc.arg(reconcileRepair), sqlc.arg(mode), sqlc.arg(rateLimit), sqlc.arg(maxInFlight), sqlc.arg(enabled), sqlc.arg(createdBy), sqlc.arg(createdOnUtc), sqlc.arg(modifiedOnUtc), sqlc.arg(modifiedBy))
+RETURNING id;
+
+-- name: GetTargets :many
+SELECT * FROM targets
+WHERE organisation_id = sqlc.arg(organisationId)
+ORDER BY name;
+
+-- name: GetEnabledTargets :many
+SELECT * FROM targets
+WHERE organisation_id = sqlc.arg(organisationId)
+AND enabled = 1
+ORDER BY name;
+
+-- name: GetTargetById :one
+SELECT * FROM targets
+WHERE id = sqlc.arg(id)
+AND organisation_id = sqlc.arg(organisationId);
+
+-- name: UpdateTarget :exec
+UPDATE targets
+SET name = sqlc.arg(name),
+    config = sqlc.arg(config),
+    attribute_mapping = sqlc.arg(attributeMapping),
+    user_scope = sqlc.arg(userScope),
+    group_scope = sqlc.arg(groupScope),
+    deprovision_action = sqlc.arg(deprovisionAction),
+    reconcile_interval = sqlc.arg(reconcileInterval),
+    reconcile_repair = sqlc.arg(reconcileRepair),
+    mode = sqlc.arg(mode),
+    rate_limit = sqlc.arg(rateLimit),
+    max_in_flight = sqlc.arg(maxInFlight),
+    enabled = sqlc.arg(enabled),
+    modified_on_utc = sqlc.arg(modifiedOnUtc),
+    modified_by = sqlc.arg(modifiedBy)
+WHERE id = sqlc.arg(id)
+AND organisation_id = sqlc.arg(organisationId);
+
+-- name: DeleteTarget :exec
+DELETE FROM targets
+WHERE id = sqlc.arg(id)
+AND organisation_id = sqlc.arg(organisationId);
+
+-- name: GetScheduledReconciliationTargets :many
+SELECT * FROM targets
+WHERE enabled = 1
+AND reconcile_interval IS NOT NULL
+ORDER BY id;
+
+-- name: GetReadyOutboxTargets :many
+SELECT * FROM targets
+WHERE enabled = 1
+AND mode = 'live'
+AND EXISTS (
+    SELECT 1 FROM outbox_events
+    WHERE outbox_events.target_id = targets.id
+    AND outbox_events.status = 'pending'
+    AND outbox_events.next_attempt_on_utc <= sqlc.arg(now)
+)
+ORDER BY id;
@@ -0,0 +1,31 @@
+-- name: CreateTrustedIssuer :one
+INSERT INTO trusted_issuers (id, organisation_id, issuer, audience, jwks_uri, jwks, organisation_claim, organisation_claim_value, scopes, created_by, created_on_utc, modified_on_utc, modified_by)
+VALUES (sqlc.arg(id), sqlc.arg(organisationId), sqlc.arg(issuer), sqlc.arg(audience), sqlc.arg(jwksUri), sqlc.arg(jwks), sqlc.arg(organisationClaim), sqlc.arg(organisationClaimValue), sqlc.arg(scopes), sqlc.arg(createdBy), sqlc.arg(createdOnUtc), sqlc.arg(modifiedOnUtc), sqlc.arg(modifiedBy))
+RETURNING id;
+
+-- name: GetTrustedIssuers :many
+SELECT * FROM trusted_issuers
+WHERE organisation_id = sqlc.arg(organisationId)
+ORDER BY id;
+
+-- name: GetTrustedIssuerById :one
+SELECT * FROM trusted_issuers
+WHERE id = sqlc.arg(id)
+AND organisation_id = sqlc.arg(organisationId);
+
+-- name: GetTrustedIssuersByIssuer :many
+SELECT * FROM trusted_issuers
+WHERE issuer = sqlc.arg(issuer)
+ORDER BY id;
+
+-- name: GetTrustedIssuerByClaimValue :one
+SELECT * FROM trusted_issuers
+WHERE issuer = sqlc.arg(issuer)
+AND audience = sqlc.arg(audience)
+AND organisation_claim = sqlc.arg(organisationClaim)
+AND organisation_claim_value = sqlc.arg(organisationClaimValue);
+
+-- name: DeleteTrustedIssuer :exec
+DELETE FROM trusted_issuers
+WHERE id = sqlc.arg(id)
+AND organisation_id = sqlc.arg(organisationId);
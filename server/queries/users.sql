@@ -5,3 +5,33 @@ SELECT * FROM users;
 INSERT INTO users (id, username, email, password, created_by, created_on_utc, modified_on_utc, modified_by)
 VALUES (sqlc.arg(id), sqlc.arg(username), sqlc.arg(email), sqlc.arg(password), sqlc.arg(createdBy), sqlc.arg(createdOnUTC), sqlc.arg(modifiedOnUTC), sqlc.arg(modifiedBy))
 RETURNING id;
+
+-- name: GetUserByUsername :one
+SELECT * FROM users
+WHERE username = sqlc.arg(username);
+
+-- name: GetUserById :one
+SELECT * FROM users
+WHERE id = sqlc.arg(id);
+
+-- name: GetUserByEmail :one
+SELECT * FROM users
+WHERE email = sqlc.arg(email);
+
+-- name: RecordFailedLogin :one
+UPDATE users
+SET failed_logins = failed_logins + 1
+WHERE id = sqlc.arg(id)
+RETURNING failed_logins;
+
+-- name: LockUser :exec
+UPDATE users
+SET failed_logins = 0,
+    locked_until_utc = sqlc.arg(lockedUntilUtc)
+WHERE id = sqlc.arg(id);
+
+-- name: ResetFailedLogins :exec
+UPDATE users
+SET failed_logins = 0,
+    locked_until_utc = NULL
+WHERE id = sqlc.arg(id);